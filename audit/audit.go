@@ -0,0 +1,262 @@
+/*
+Package audit records the configuration changes committed to datastores
+in an audit log: the session, user and time of each commit, with a
+summary of its changes, or the full patch, written to pluggable sinks
+and kept in memory to be queried.
+
+	l := audit.New(mgr, audit.WithSink(audit.JSONLines(f)), audit.WithPatch())
+	l.Watch(set.Get(datastore.Running))
+	...
+	records := l.Query(audit.Query{Username: "alice"})
+
+The records kept are available as YANG operational data, the
+audit-log container of the opr8-audit module, from Element.
+*/
+package audit
+
+import (
+	"bytes"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/andaru/opr8/datastore"
+	"github.com/andaru/opr8/dom"
+	"github.com/andaru/opr8/modules"
+	"github.com/andaru/opr8/session"
+	"github.com/andaru/opr8/transport"
+)
+
+// DefaultSize is the number of records kept by a Log by default.
+const DefaultSize = 1000
+
+// Record is the audit record of a commit to a datastore.
+type Record struct {
+	// ID is the record's sequence number, increasing with each commit
+	// recorded.
+	ID uint64 `json:"id"`
+	// Time is the time of the commit.
+	Time time.Time `json:"time"`
+	// Session is the ID of the session which made the commit, or zero
+	// if it was not made by a session.
+	Session session.ID `json:"session-id,omitempty"`
+	// Username is the user of the session, if known.
+	Username string `json:"username,omitempty"`
+	// Datastore is the name of the datastore changed.
+	Datastore string `json:"datastore"`
+	// Generation is the datastore generation the commit created.
+	Generation uint64 `json:"generation"`
+	// Comment is the commit comment, such as the operation making it.
+	Comment string `json:"comment,omitempty"`
+	// Changes are the changes made by the commit.
+	Changes []Change `json:"changes"`
+}
+
+// Change is a change to a data node made by a commit.
+type Change struct {
+	// Operation is the edit operation: "create", "replace" or
+	// "delete".
+	Operation string `json:"operation"`
+	// Path is the instance-identifier of the data node changed, in
+	// the YANG/JSON encoding.
+	Path string `json:"path"`
+	// Value is the new data node encoded as YANG/XML, if the Log
+	// records full patches and the node was not deleted.
+	Value string `json:"value,omitempty"`
+}
+
+// Summary returns the number of changes of each operation made by the
+// commit.
+func (r *Record) Summary() map[string]int {
+	summary := map[string]int{}
+	for _, c := range r.Changes {
+		summary[c.Operation]++
+	}
+	return summary
+}
+
+// Sink receives the records of a Log, such as to write them to
+// storage. Write is called once per commit, in commit order, while
+// the datastore's writer lock is held, so must not update the
+// datastore.
+type Sink interface {
+	Write(*Record) error
+}
+
+// SinkFunc is a function implementing Sink, called with each record.
+type SinkFunc func(*Record) error
+
+// Write calls f with the record r.
+func (f SinkFunc) Write(r *Record) error { return f(r) }
+
+// Option is a Log configuration option.
+type Option func(*Log)
+
+// WithSink adds the sink s, to which each record is written.
+func WithSink(s Sink) Option {
+	return func(l *Log) { l.sinks = append(l.sinks, s) }
+}
+
+// WithPatch records the new value of each data node changed, in
+// addition to the changes' paths.
+func WithPatch() Option {
+	return func(l *Log) { l.patch = true }
+}
+
+// WithSize sets the number of records kept in memory to be queried,
+// DefaultSize by default. Records are discarded, oldest first, once
+// size are kept; sinks receive every record.
+func WithSize(size int) Option {
+	return func(l *Log) { l.size = size }
+}
+
+// Log is an audit log of the commits to the datastores it watches. It
+// is safe for concurrent use.
+type Log struct {
+	mgr   session.Manager
+	sinks []Sink
+	patch bool
+	size  int
+
+	mu sync.Mutex
+	// records is a ring of the records kept, the oldest at head once
+	// it is full
+	records []*Record
+	head    int
+	last    uint64
+
+	sinkErrors uint64 // accessed atomically
+}
+
+// New returns a new audit log, finding the users of the sessions
+// making commits with the manager mgr, which may be nil.
+func New(mgr session.Manager, options ...Option) *Log {
+	l := &Log{mgr: mgr, size: DefaultSize}
+	for _, option := range options {
+		option(l)
+	}
+	return l
+}
+
+// Watch records the commits made to the datastore ds.
+func (l *Log) Watch(ds *datastore.Datastore) {
+	name, c := ds.Name(), ds.Modules()
+	ds.Listen(func(prev, next *datastore.Snapshot) {
+		r := &Record{
+			Time:       next.Time,
+			Session:    next.Session,
+			Datastore:  name,
+			Generation: next.Generation,
+			Comment:    next.Comment,
+			Username:   l.username(next.Session),
+		}
+		for _, edit := range datastore.Diff(prev.Root, next.Root, c) {
+			change := Change{Operation: edit.Operation.String(), Path: edit.Path.Format(moduleName(c))}
+			if l.patch {
+				var b bytes.Buffer
+				for _, n := range edit.Nodes {
+					_, _ = dom.NewMarshaler(n).XMLWriter().WriteTo(&b)
+				}
+				change.Value = b.String()
+			}
+			r.Changes = append(r.Changes, change)
+		}
+		l.record(r)
+	})
+}
+
+// username returns the user of the session with the ID, or the empty
+// string if unknown.
+func (l *Log) username(id session.ID) string {
+	if l.mgr == nil || id == 0 {
+		return ""
+	}
+	s, ok := l.mgr.Get(id)
+	if !ok {
+		return ""
+	}
+	if u, ok := s.Transport().(transport.ClientUsernameProvider); ok {
+		return u.Username()
+	}
+	return ""
+}
+
+// record assigns r its ID, keeps it and writes it to the sinks.
+func (l *Log) record(r *Record) {
+	l.mu.Lock()
+	l.last++
+	r.ID = l.last
+	if l.size > 0 {
+		if len(l.records) < l.size {
+			l.records = append(l.records, r)
+		} else {
+			l.records[l.head] = r
+			l.head = (l.head + 1) % l.size
+		}
+	}
+	l.mu.Unlock()
+	for _, s := range l.sinks {
+		if err := s.Write(r); err != nil {
+			atomic.AddUint64(&l.sinkErrors, 1)
+		}
+	}
+}
+
+// SinkErrors returns the number of records sinks failed to write.
+func (l *Log) SinkErrors() uint64 { return atomic.LoadUint64(&l.sinkErrors) }
+
+// Query selects records from a Log. Zero fields match any record.
+type Query struct {
+	// Datastore matches the records of the named datastore.
+	Datastore string
+	// Session matches the records of commits by the session.
+	Session session.ID
+	// Username matches the records of commits by the user.
+	Username string
+	// Since and Until match the records of commits made at or after
+	// Since, and before Until.
+	Since, Until time.Time
+	// Limit, if positive, is the most records returned, the latest.
+	Limit int
+}
+
+func (q Query) match(r *Record) bool {
+	switch {
+	case q.Datastore != "" && r.Datastore != q.Datastore,
+		q.Session != 0 && r.Session != q.Session,
+		q.Username != "" && r.Username != q.Username,
+		!q.Since.IsZero() && r.Time.Before(q.Since),
+		!q.Until.IsZero() && !r.Time.Before(q.Until):
+		return false
+	}
+	return true
+}
+
+// Query returns the records kept which match q, oldest first. Records
+// must not be modified.
+func (l *Log) Query(q Query) []*Record {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var records []*Record
+	for i := range l.records {
+		if r := l.records[(l.head+i)%len(l.records)]; q.match(r) {
+			records = append(records, r)
+		}
+	}
+	if q.Limit > 0 && len(records) > q.Limit {
+		records = records[len(records)-q.Limit:]
+	}
+	return records
+}
+
+// moduleName returns the prefix function of instance-identifiers
+// formatted in the YANG/JSON encoding, naming the module of each
+// namespace in the collection c.
+func moduleName(c *modules.Collection) func(string) string {
+	return func(ns string) string {
+		if m, err := c.ModuleByNamespace(ns); err == nil {
+			return m.Name
+		}
+		return ns
+	}
+}
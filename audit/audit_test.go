@@ -0,0 +1,183 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	xml "github.com/andaru/flexml"
+	"github.com/andaru/opr8/datastore"
+	"github.com/andaru/opr8/dom"
+	"github.com/andaru/opr8/modules"
+	"github.com/andaru/opr8/session"
+	"github.com/andaru/opr8/transport"
+	"github.com/andaru/opr8/transport/transporttest"
+)
+
+const testModule = `module audit-test {
+  namespace "urn:audit-test"; prefix at;
+  container system {
+    leaf host-name { type string; }
+    leaf location { type string; }
+  }
+}`
+
+// setLeaf returns an edit setting the system leaf named local to value.
+func setLeaf(local, value string) func(dom.Document) error {
+	return func(root dom.Document) error {
+		system := root.FirstChild()
+		if system == nil {
+			_ = root.AppendChild(dom.CreateElement(xml.StartElement{Name: xml.Name{Space: "urn:audit-test", Local: "system"}}))
+			system = root.FirstChild()
+		}
+		name := xml.Name{Space: "urn:audit-test", Local: local}
+		if leaf := system.ChildByName(name); leaf != nil {
+			return leaf.FirstChild().SetValue(value)
+		}
+		leaf := dom.CreateElement(xml.StartElement{Name: name})
+		_ = leaf.AppendChild(dom.CreateText(xml.CharData(value)))
+		return system.AppendChild(leaf)
+	}
+}
+
+// newTestCollection returns the collection of the audit-test and
+// opr8-audit modules.
+func newTestCollection(t *testing.T) *modules.Collection {
+	t.Helper()
+	c := modules.NewCollection()
+	if err := c.ReadString("audit-test", testModule); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ReadString("opr8-audit", Module); err != nil {
+		t.Fatal(err)
+	}
+	if errs := c.Process(); errs != nil {
+		t.Fatal(errs)
+	}
+	return c
+}
+
+func TestLog(t *testing.T) {
+	c := newTestCollection(t)
+	var lines bytes.Buffer
+	var called []uint64
+	l := New(nil, WithSize(2), WithPatch(),
+		WithSink(JSONLines(&lines)),
+		WithSink(SinkFunc(func(r *Record) error { called = append(called, r.ID); return nil })))
+	running, candidate := datastore.New(datastore.Running, c), datastore.New(datastore.Candidate, c)
+	l.Watch(running)
+	l.Watch(candidate)
+
+	start := time.Now()
+	for _, edit := range []struct {
+		ds    *datastore.Datastore
+		sid   session.ID
+		local string
+	}{
+		{running, 1, "host-name"},
+		{candidate, 2, "host-name"},
+		{running, 2, "location"},
+	} {
+		if _, err := edit.ds.Update(edit.sid, "edit-config", setLeaf(edit.local, "r1")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(called) != 3 || called[2] != 3 {
+		t.Errorf("SinkFunc called with records %v, want 1, 2, 3", called)
+	}
+	var first Record
+	if err := json.Unmarshal([]byte(strings.SplitN(lines.String(), "\n", 2)[0]), &first); err != nil {
+		t.Fatalf("JSON line: %v", err)
+	}
+	if first.Datastore != datastore.Running || first.Session != 1 || first.Comment != "edit-config" || first.Time.Before(start) {
+		t.Errorf("first record = %+v", first)
+	}
+	if len(first.Changes) != 1 || first.Changes[0].Operation != "create" || first.Changes[0].Path != "/audit-test:system" ||
+		!strings.Contains(first.Changes[0].Value, "<host-name>r1</host-name>") {
+		t.Errorf("first record changes = %+v", first.Changes)
+	}
+
+	// the first record is no longer kept
+	if got := l.Query(Query{}); len(got) != 2 || got[0].ID != 2 || got[1].ID != 3 {
+		t.Errorf("Query() = %+v, want records 2 and 3", got)
+	}
+	got := l.Query(Query{Datastore: datastore.Running, Session: 2})
+	if len(got) != 1 || got[0].ID != 3 {
+		t.Fatalf("Query(running, session 2) = %+v, want record 3", got)
+	}
+	if s := got[0].Summary(); s["create"] != 1 || len(s) != 1 {
+		t.Errorf("Summary() = %v, want 1 create", s)
+	}
+	if got := l.Query(Query{Until: start}); len(got) != 0 {
+		t.Errorf("Query(Until: start) = %+v, want none", got)
+	}
+	if got := l.Query(Query{Limit: 1}); len(got) != 1 || got[0].ID != 3 {
+		t.Errorf("Query(Limit: 1) = %+v, want record 3", got)
+	}
+
+	var b bytes.Buffer
+	if _, err := dom.NewMarshaler(l.Element(Query{Datastore: datastore.Candidate})).XMLWriter().WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	if s := b.String(); !strings.HasPrefix(s, `<audit-log xmlns="urn:opr8:audit"><record><id>2</id>`) ||
+		!strings.Contains(s, `<session-id>2</session-id><datastore>candidate</datastore><generation>1</generation><comment>edit-config</comment>`) {
+		t.Errorf("Element() = %s", s)
+	}
+}
+
+// testSession is a server session on a transport.
+type testSession struct {
+	id   session.ID
+	t    transport.Transport
+	once sync.Once
+	done chan error
+}
+
+func (s *testSession) ID() session.ID                 { return s.id }
+func (s *testSession) Type() session.Type             { return session.TypeServer }
+func (s *testSession) Transport() transport.Transport { return s.t }
+func (s *testSession) Wait() <-chan error             { return s.done }
+func (s *testSession) Release()                       { s.once.Do(func() { close(s.done) }) }
+
+// testAcceptor accepts testSession sessions on any transport.
+type testAcceptor struct{}
+
+func (testAcceptor) Supported(transport.ServerTransport) bool { return true }
+func (testAcceptor) Accept(_ context.Context, t transport.ServerTransport, id session.ID) (session.Server, error) {
+	return &testSession{id: id, t: t, done: make(chan error, 1)}, nil
+}
+
+func TestLog_username(t *testing.T) {
+	c := newTestCollection(t)
+	mgr := session.NewManager(session.WithAcceptor(testAcceptor{}))
+	_, server := transporttest.Pipe(transporttest.WithUsername("alice"))
+	s, err := mgr.Accept(context.Background(), server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Release()
+
+	l := New(mgr)
+	running := datastore.New(datastore.Running, c)
+	l.Watch(running)
+	for _, sid := range []session.ID{s.ID(), s.ID() + 1, 0} {
+		if _, err := running.Update(sid, "edit-config", setLeaf("host-name", fmt.Sprint("r", sid))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got := l.Query(Query{})
+	if len(got) != 3 {
+		t.Fatalf("Query() = %+v, want 3 records", got)
+	}
+	for i, want := range []string{"alice", "", ""} {
+		if got[i].Username != want {
+			t.Errorf("record %d username = %q, want %q", got[i].ID, got[i].Username, want)
+		}
+	}
+}
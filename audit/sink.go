@@ -0,0 +1,46 @@
+package audit
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+)
+
+// jsonLines is a Sink writing JSON lines.
+type jsonLines struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// JSONLines returns a Sink writing each record to w as a line of JSON.
+// Records of concurrent commits to different datastores are written
+// one at a time.
+func JSONLines(w io.Writer) Sink {
+	return &jsonLines{enc: json.NewEncoder(w)}
+}
+
+func (s *jsonLines) Write(r *Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.enc.Encode(r)
+}
+
+// File is a Sink appending each record to a file as a line of JSON.
+type File struct {
+	f *os.File
+	Sink
+}
+
+// OpenFile returns a Sink appending records to the file at path,
+// created if it does not exist. It is closed with Close.
+func OpenFile(path string) (*File, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &File{f: f, Sink: JSONLines(f)}, nil
+}
+
+// Close closes the file.
+func (f *File) Close() error { return f.f.Close() }
@@ -0,0 +1,85 @@
+package audit
+
+import (
+	"strconv"
+	"time"
+
+	xml "github.com/andaru/flexml"
+	"github.com/andaru/opr8/dom"
+)
+
+// Namespace is the XML namespace of the opr8-audit module.
+const Namespace = "urn:opr8:audit"
+
+// Module is the source of the opr8-audit YANG module, describing the
+// audit log as operational data. It is read into a collection with
+// modules.Collection.ReadString("opr8-audit", audit.Module).
+const Module = `module opr8-audit {
+  yang-version 1.1;
+  namespace "urn:opr8:audit";
+  prefix audit;
+
+  description "The audit log of configuration changes.";
+
+  container audit-log {
+    config false;
+    list record {
+      key id;
+      leaf id { type uint64; }
+      leaf time { type string; description "RFC 3339 date and time."; }
+      leaf session-id { type uint32; }
+      leaf username { type string; }
+      leaf datastore { type string; }
+      leaf generation { type uint64; }
+      leaf comment { type string; }
+      list change {
+        leaf operation { type string; }
+        leaf path { type string; }
+        leaf value { type string; }
+      }
+    }
+  }
+}
+`
+
+// Element returns the opr8-audit audit-log container of the records
+// matching q.
+func (l *Log) Element(q Query) dom.Element {
+	log := dom.CreateElement(xml.StartElement{Name: xml.Name{Space: Namespace, Local: "audit-log"}})
+	for _, r := range l.Query(q) {
+		record := appendElement(log, "record", "")
+		appendElement(record, "id", strconv.FormatUint(r.ID, 10))
+		appendElement(record, "time", r.Time.UTC().Format(time.RFC3339Nano))
+		if r.Session != 0 {
+			appendElement(record, "session-id", strconv.FormatUint(uint64(r.Session), 10))
+		}
+		if r.Username != "" {
+			appendElement(record, "username", r.Username)
+		}
+		appendElement(record, "datastore", r.Datastore)
+		appendElement(record, "generation", strconv.FormatUint(r.Generation, 10))
+		if r.Comment != "" {
+			appendElement(record, "comment", r.Comment)
+		}
+		for _, c := range r.Changes {
+			change := appendElement(record, "change", "")
+			appendElement(change, "operation", c.Operation)
+			appendElement(change, "path", c.Path)
+			if c.Value != "" {
+				appendElement(change, "value", c.Value)
+			}
+		}
+	}
+	return log
+}
+
+// appendElement appends an opr8-audit element named local, with the
+// value if not empty, to parent, and returns it.
+func appendElement(parent dom.Node, local, value string) dom.Node {
+	e := dom.CreateElement(xml.StartElement{Name: xml.Name{Space: Namespace, Local: local}})
+	if value != "" {
+		_ = e.AppendChild(dom.CreateText(xml.CharData(value)))
+	}
+	_ = parent.AppendChild(e)
+	return parent.LastChild()
+}
@@ -0,0 +1,507 @@
+/*
+Package client is a NETCONF client (RFC 6241): a session with a server
+over a client transport, with the operations of the base protocol,
+event notification subscriptions (RFC 5277) and the retrieval of the
+server's schemas (RFC 6022).
+
+A Client is made by dialing a server, or by New with a transport
+already connected, and exchanges <hello> messages before it is
+returned:
+
+	c, err := client.DialSSH(ctx, "router1:830", "admin", hostKey, transport.WithPassword(pw))
+	if err != nil {
+		...
+	}
+	defer c.Close()
+	data, err := c.GetConfig(ctx, datastore.Running)
+
+Operations are sent in <rpc> messages, and may be called concurrently;
+replies are matched to them by their message-id. An <rpc-reply> with
+errors is returned as an *rpc.RPCError, or an rpc.ErrorList of several.
+Notifications received after CreateSubscription are sent to the
+channel returned by Notifications.
+*/
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	xml "github.com/andaru/flexml"
+	"github.com/andaru/opr8/datastore"
+	"github.com/andaru/opr8/dom"
+	"github.com/andaru/opr8/notification"
+	"github.com/andaru/opr8/rpc"
+	"github.com/andaru/opr8/session"
+	"github.com/andaru/opr8/session/netconf"
+	"github.com/andaru/opr8/transport"
+	"github.com/pkg/errors"
+)
+
+// ErrClosed is returned by operations on a Client whose session has
+// ended.
+var ErrClosed = errors.New("client session closed")
+
+// closeTimeout bounds the time Close waits for the reply to
+// <close-session>.
+const closeTimeout = 5 * time.Second
+
+// Option is a constructor option for New.
+type Option func(*Client)
+
+// WithCapabilities is an option adding capability URIs to those
+// advertised in the client's <hello>, the base capabilities.
+func WithCapabilities(uris ...string) Option {
+	return func(c *Client) { c.capabilities = append(c.capabilities, uris...) }
+}
+
+// WithNotificationBuffer is an option setting the capacity of the
+// channel of notifications received, 64 by default. Replies are not
+// read while the channel is full.
+func WithNotificationBuffer(n int) Option {
+	return func(c *Client) { c.notifyBuffer = n }
+}
+
+// Client is a NETCONF client session. It implements
+// modules.RPCClient.
+type Client struct {
+	t            transport.ClientTransport
+	capabilities []string
+	notifyBuffer int
+
+	// id and peer are the session-id and capabilities of the server's
+	// <hello>, and version the base protocol version negotiated
+	id      session.ID
+	peer    []string
+	version string
+
+	wmu sync.Mutex
+
+	mu        sync.Mutex
+	messageID uint64
+	pending   map[string]chan dom.Element
+	err       error
+
+	notifications chan *notification.Notification
+	done          chan struct{}
+}
+
+// DialSSH returns a Client of the NETCONF server at the address addr,
+// connected over SSH as transport.DialSSH does.
+func DialSSH(ctx context.Context, addr, user string, hostKey transport.HostKeyPolicy, options ...transport.SSHOption) (*Client, error) {
+	t, err := transport.DialSSH(ctx, addr, user, hostKey, options...)
+	if err != nil {
+		return nil, err
+	}
+	return New(ctx, t)
+}
+
+// DialTLS returns a Client of the NETCONF server at the address addr,
+// connected over TLS (RFC 7589) as transport.DialTLS does.
+func DialTLS(ctx context.Context, addr string, config *tls.Config, dialer transport.ContextDialer) (*Client, error) {
+	t, err := transport.DialTLS(ctx, addr, config, dialer)
+	if err != nil {
+		return nil, err
+	}
+	return New(ctx, t)
+}
+
+// New returns a Client of the session on the transport t, once the
+// <hello> messages are exchanged, which the context bounds. Chunked
+// framing is used if both peers have the :base:1.1 capability and t
+// implements transport.RFC6242Framer. The transport is closed if the
+// exchange fails.
+func New(ctx context.Context, t transport.ClientTransport, options ...Option) (*Client, error) {
+	c := &Client{
+		t:            t,
+		capabilities: []string{netconf.CapBase10},
+		notifyBuffer: 64,
+		pending:      map[string]chan dom.Element{},
+		done:         make(chan struct{}),
+	}
+	if _, ok := t.(transport.RFC6242Framer); ok {
+		c.capabilities = append(c.capabilities, netconf.CapBase11)
+	}
+	for _, option := range options {
+		option(c)
+	}
+	c.notifications = make(chan *notification.Notification, c.notifyBuffer)
+
+	hello := make(chan error, 1)
+	d := xml.NewDecoder(t)
+	go func() { hello <- c.hello(d) }()
+	select {
+	case err := <-hello:
+		if err != nil {
+			_ = t.Close()
+			return nil, err
+		}
+	case <-ctx.Done():
+		_ = t.Close()
+		return nil, ctx.Err()
+	}
+	go c.read(d)
+	return c, nil
+}
+
+// hello exchanges <hello> messages with the server, reading its from
+// d, and negotiates the base protocol version.
+func (c *Client) hello(d *xml.Decoder) error {
+	var b bytes.Buffer
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>`)
+	b.WriteString(`<hello xmlns="` + netconf.BaseNamespace + `"><capabilities>`)
+	for _, uri := range c.capabilities {
+		b.WriteString(`<capability>`)
+		_ = xml.EscapeText(&b, []byte(uri))
+		b.WriteString(`</capability>`)
+	}
+	b.WriteString(`</capabilities></hello>`)
+	if _, err := c.t.Write(b.Bytes()); err != nil {
+		return errors.Wrap(err, "hello")
+	}
+
+	start, err := netconf.NextStartElement(d)
+	if err != nil {
+		return errors.Wrap(err, "hello")
+	}
+	if start.Name != (xml.Name{Space: netconf.BaseNamespace, Local: "hello"}) {
+		return errors.Errorf("expected hello, got %s", start.Name.Local)
+	}
+	var hello struct {
+		Capabilities []string `xml:"capabilities>capability"`
+		SessionID    string   `xml:"session-id"`
+	}
+	if err := d.DecodeElement(&hello, &start); err != nil {
+		return errors.Wrap(err, "hello")
+	}
+	id, err := strconv.ParseUint(strings.TrimSpace(hello.SessionID), 10, 32)
+	if err != nil || id == 0 {
+		return errors.Errorf("hello has an invalid session-id %q", hello.SessionID)
+	}
+	c.id = session.ID(id)
+	for i, uri := range hello.Capabilities {
+		hello.Capabilities[i] = strings.TrimSpace(uri)
+	}
+	c.peer = hello.Capabilities
+	c.version = "1.0"
+	framer, chunked := c.t.(transport.RFC6242Framer)
+	switch {
+	case chunked && c.HasCapability(netconf.CapBase11):
+		if err := framer.EnableChunkedFraming(); err != nil {
+			return errors.Wrap(err, "enable chunked framing")
+		}
+		c.version = "1.1"
+	case !c.HasCapability(netconf.CapBase10):
+		return errors.New("no common base capability")
+	}
+	return nil
+}
+
+// SessionID returns the session-id the server assigned the session.
+func (c *Client) SessionID() session.ID { return c.id }
+
+// Capabilities returns the capabilities of the server's <hello>.
+func (c *Client) Capabilities() []string { return c.peer }
+
+// HasCapability returns true if the server advertised the capability
+// uri, with any parameters.
+func (c *Client) HasCapability(uri string) bool {
+	for _, it := range c.peer {
+		if it == uri || strings.HasPrefix(it, uri+"?") {
+			return true
+		}
+	}
+	return false
+}
+
+// Version returns the version of the base protocol negotiated, "1.0"
+// or "1.1".
+func (c *Client) Version() string { return c.version }
+
+// Transport returns the session transport.
+func (c *Client) Transport() transport.Transport { return c.t }
+
+// Done returns a channel closed when the session ends.
+func (c *Client) Done() <-chan struct{} { return c.done }
+
+// Err returns the error which ended the session, ErrClosed if it ended
+// normally, or nil if it has not ended.
+func (c *Client) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Notifications returns the channel of the notifications received,
+// closed when the session ends.
+func (c *Client) Notifications() <-chan *notification.Notification { return c.notifications }
+
+// Close ends the session with <close-session>, waiting a short time
+// for its reply, and closes the transport.
+func (c *Client) Close() error {
+	select {
+	case <-c.done:
+	default:
+		ctx, cancel := context.WithTimeout(context.Background(), closeTimeout)
+		defer cancel()
+		_, _ = c.Call(ctx, element(netconf.BaseNamespace, "close-session"))
+	}
+	err := c.t.Close()
+	c.end(ErrClosed)
+	return err
+}
+
+// read reads the server's messages from d until the session ends,
+// passing replies to their operations and notifications to the
+// notification channel, which it closes when done.
+func (c *Client) read(d *xml.Decoder) {
+	defer close(c.notifications)
+	for {
+		start, err := netconf.NextStartElement(d)
+		if err != nil {
+			if err == io.EOF {
+				err = ErrClosed
+			}
+			c.end(err)
+			return
+		}
+		msg, err := netconf.ReadElement(d, start)
+		if err != nil {
+			c.end(errors.Wrap(err, "malformed message"))
+			return
+		}
+		switch start.Name {
+		case xml.Name{Space: netconf.BaseNamespace, Local: "rpc-reply"}:
+			id, _ := attrValue(msg, xml.Name{Local: "message-id"})
+			c.mu.Lock()
+			reply := c.pending[id]
+			delete(c.pending, id)
+			c.mu.Unlock()
+			if reply != nil {
+				reply <- msg
+			}
+		case xml.Name{Space: notification.Namespace, Local: "notification"}:
+			if n := parseNotification(msg); n != nil {
+				select {
+				case c.notifications <- n:
+				case <-c.done:
+					return
+				}
+			}
+		}
+	}
+}
+
+// end ends the session with the error err, if it has not ended.
+func (c *Client) end(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return
+	}
+	c.err = err
+	close(c.done)
+}
+
+// Call sends an <rpc> with the operation element op and returns the
+// children of the <rpc-reply>, which are empty if the reply is <ok/>.
+// A reply with <rpc-error> elements of severity error is returned as
+// an *rpc.RPCError or an rpc.ErrorList.
+func (c *Client) Call(ctx context.Context, op dom.Node) ([]dom.Node, error) {
+	var b bytes.Buffer
+	if _, err := dom.NewMarshaler(dom.CloneNode(op, true)).XMLWriter().WriteTo(&b); err != nil {
+		return nil, errors.Wrap(err, "rpc")
+	}
+	reply, err := c.call(ctx, b.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	var nodes []dom.Node
+	for it := reply.FirstChild(); it != nil; it = it.NextSibling() {
+		if it.NodeType() == dom.NodeTypeElement && it.Name() != (xml.Name{Space: netconf.BaseNamespace, Local: "ok"}) {
+			nodes = append(nodes, it)
+		}
+	}
+	return nodes, nil
+}
+
+// RPC sends an <rpc> containing the operation element request, and
+// returns the content of the <rpc-reply>, as modules.RPCClient
+// requires.
+func (c *Client) RPC(ctx context.Context, request []byte) ([]byte, error) {
+	reply, err := c.call(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	for it := reply.FirstChild(); it != nil; it = it.NextSibling() {
+		if it.NodeType() != dom.NodeTypeElement {
+			continue
+		}
+		// detached copies are encoded with their namespaces
+		if _, err := dom.NewMarshaler(dom.CloneNode(it, true)).XMLWriter().WriteTo(&b); err != nil {
+			return nil, errors.Wrap(err, "rpc-reply")
+		}
+	}
+	return b.Bytes(), nil
+}
+
+// call sends an <rpc> with the operation op, and returns the
+// <rpc-reply>, or the errors it reports.
+func (c *Client) call(ctx context.Context, op []byte) (dom.Element, error) {
+	reply := make(chan dom.Element, 1)
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return nil, c.err
+	}
+	c.messageID++
+	id := strconv.FormatUint(c.messageID, 10)
+	c.pending[id] = reply
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	msg := make([]byte, 0, len(op)+100)
+	msg = append(msg, `<rpc xmlns="`+netconf.BaseNamespace+`" message-id="`+id+`">`...)
+	msg = append(append(msg, op...), "</rpc>"...)
+	c.wmu.Lock()
+	_, err := c.t.Write(msg)
+	c.wmu.Unlock()
+	if err != nil {
+		return nil, errors.Wrap(err, "rpc")
+	}
+	select {
+	case r := <-reply:
+		return r, replyErrors(r)
+	case <-c.done:
+		return nil, c.Err()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// replyErrors returns the errors of the <rpc-error> elements of reply
+// with severity error, nil if there are none.
+func replyErrors(reply dom.Element) error {
+	var list rpc.ErrorList
+	for it := reply.FirstChild(); it != nil; it = it.NextSibling() {
+		if it.Name() != (xml.Name{Space: netconf.BaseNamespace, Local: "rpc-error"}) {
+			continue
+		}
+		if e := parseRPCError(it); e.Severity == datastore.SeverityError {
+			list = append(list, e)
+		}
+	}
+	switch len(list) {
+	case 0:
+		return nil
+	case 1:
+		return list[0]
+	}
+	return list
+}
+
+// parseRPCError returns the error of the <rpc-error> element n.
+func parseRPCError(n dom.Node) *rpc.RPCError {
+	e := &rpc.RPCError{}
+	for it := n.FirstChild(); it != nil; it = it.NextSibling() {
+		if it.NodeType() != dom.NodeTypeElement {
+			continue
+		}
+		value := strings.TrimSpace(it.ChildValue())
+		switch it.Name().Local {
+		case "error-type":
+			e.Type = rpc.ErrorType(value)
+		case "error-tag":
+			e.Tag = rpc.ErrorTag(value)
+		case "error-severity":
+			if value == datastore.SeverityWarning.String() {
+				e.Severity = datastore.SeverityWarning
+			}
+		case "error-app-tag":
+			e.AppTag = value
+		case "error-path":
+			e.Path = value
+		case "error-message":
+			e.Message = value
+		case "error-info":
+			for info := it.FirstChild(); info != nil; info = info.NextSibling() {
+				if info.NodeType() == dom.NodeTypeElement {
+					name := info.Name()
+					if name.Space == netconf.BaseNamespace {
+						name.Space = ""
+					}
+					e.Info = append(e.Info, rpc.ErrorInfo{Name: name, Value: strings.TrimSpace(info.ChildValue())})
+				}
+			}
+		}
+	}
+	if e.Message == "" {
+		e.Message = string(e.Tag)
+	}
+	return e
+}
+
+// parseNotification returns the notification of the <notification>
+// element n, or nil if it has no valid eventTime.
+func parseNotification(n dom.Node) *notification.Notification {
+	var notif *notification.Notification
+	for it := n.FirstChild(); it != nil; it = it.NextSibling() {
+		if it.NodeType() != dom.NodeTypeElement {
+			continue
+		}
+		if notif == nil {
+			if it.Name() != (xml.Name{Space: notification.Namespace, Local: "eventTime"}) {
+				return nil
+			}
+			t, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(it.ChildValue()))
+			if err != nil {
+				return nil
+			}
+			notif = &notification.Notification{EventTime: t}
+			continue
+		}
+		notif.Event = it
+		break
+	}
+	return notif
+}
+
+// attrValue returns the value of the attribute of n named name, and
+// true if it has one.
+func attrValue(n dom.Node, name xml.Name) (string, bool) {
+	if ap, ok := n.(dom.AttributeProvider); ok {
+		for a := dom.Node(ap.FirstAttribute()); a != nil; a = a.NextSibling() {
+			if a.Name() == name {
+				return a.Value(), true
+			}
+		}
+	}
+	return "", false
+}
+
+// element returns a new element in the namespace ns named local, with
+// the children.
+func element(ns, local string, children ...dom.Node) dom.Element {
+	e := dom.CreateElement(xml.StartElement{Name: xml.Name{Space: ns, Local: local}})
+	for _, child := range children {
+		_ = e.AppendChild(child)
+	}
+	return e
+}
+
+// leaf returns a new element in the namespace ns named local, with the
+// text value.
+func leaf(ns, local, value string) dom.Element {
+	return element(ns, local, dom.CreateText(xml.CharData(value)))
+}
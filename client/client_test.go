@@ -0,0 +1,376 @@
+package client
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	xml "github.com/andaru/flexml"
+	"github.com/andaru/opr8/datastore"
+	"github.com/andaru/opr8/dom"
+	"github.com/andaru/opr8/modules"
+	"github.com/andaru/opr8/notification"
+	"github.com/andaru/opr8/rpc"
+	"github.com/andaru/opr8/session"
+	"github.com/andaru/opr8/session/netconf"
+	"github.com/andaru/opr8/transport/transporttest"
+	"github.com/pkg/errors"
+)
+
+const testModule = `module client-test {
+  namespace "urn:client-test"; prefix ct;
+  container system {
+    leaf host-name { type string; }
+    leaf mtu { type uint16; }
+  }
+}`
+
+// testServer is a NETCONF server with the base operations on the
+// running and candidate datastores, event notifications, and
+// <get-schema> of the test module.
+type testServer struct {
+	mgr    session.Manager
+	broker *notification.Broker
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	c := modules.NewCollection()
+	if err := c.ReadString("client-test", testModule); err != nil {
+		t.Fatal(err)
+	}
+	if errs := c.Process(); errs != nil {
+		t.Fatal(errs)
+	}
+	set := datastore.NewSet(datastore.New(datastore.Running, c), datastore.New(datastore.Candidate, c))
+	d := rpc.NewDispatcher()
+	acc := &netconfAcceptor{}
+	mgr := session.NewManager(session.WithAcceptor(acc))
+	base := rpc.NewBase(set, mgr)
+	base.Register(d)
+	broker := notification.NewBroker(mgr)
+	broker.Register(d)
+	d.HandleFunc(xml.Name{Space: modules.NetconfMonitoringNamespace, Local: "get-schema"}, func(ctx context.Context, s *netconf.Session, op dom.Node) ([]dom.Node, error) {
+		if id := op.FirstChild().ChildValue(); id != "client-test" {
+			return nil, rpc.NewError(rpc.ErrorTypeApplication, rpc.ErrorTagInvalidValue, "no schema %s", id)
+		}
+		return []dom.Node{leaf(modules.NetconfMonitoringNamespace, "data", testModule)}, nil
+	})
+	acc.Acceptor = netconf.NewAcceptor(c, d, netconf.WithCapabilities(append(base.Capabilities(), broker.Capabilities()...)...))
+	return &testServer{mgr: mgr, broker: broker}
+}
+
+// netconfAcceptor is the NETCONF acceptor of a test server, made once
+// the manager it uses is.
+type netconfAcceptor struct{ *netconf.Acceptor }
+
+// dial returns a client of a new session with the server.
+func (s *testServer) dial(t *testing.T) *Client {
+	t.Helper()
+	client, server := transporttest.Pipe(transporttest.WithUsername("admin"), transporttest.WithKind("ssh"))
+	if _, err := s.mgr.Accept(context.Background(), server); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c, err := New(ctx, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = c.Close() })
+	return c
+}
+
+// testDocument returns the Document of the XML s.
+func testDocument(t *testing.T, s string) dom.Document {
+	t.Helper()
+	doc := dom.NewDocument(nil)
+	if _, err := dom.NewUnmarshaler(dom.NewBuilder(doc)).XMLReader().ReadFrom(strings.NewReader(s)); err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+// content returns the XML encoding of the children of n.
+func content(t *testing.T, n dom.Node) string {
+	t.Helper()
+	var b strings.Builder
+	for it := n.FirstChild(); it != nil; it = it.NextSibling() {
+		if _, err := dom.NewMarshaler(dom.CloneNode(it, true)).XMLWriter().WriteTo(&b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return b.String()
+}
+
+// errorTag returns the error-tag of the *rpc.RPCError err, or its text.
+func errorTag(err error) string {
+	var re *rpc.RPCError
+	if errors.As(err, &re) {
+		return string(re.Tag)
+	}
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+func TestClient(t *testing.T) {
+	s := newTestServer(t)
+	a, b := s.dial(t), s.dial(t)
+	if a.SessionID() == 0 || a.SessionID() == b.SessionID() {
+		t.Errorf("SessionID() = %d and %d, want distinct session-ids", a.SessionID(), b.SessionID())
+	}
+	if !a.HasCapability(rpc.CapCandidate) || !a.HasCapability(notification.CapNotification) || a.HasCapability(rpc.CapStartup) {
+		t.Errorf("Capabilities() = %v", a.Capabilities())
+	}
+	if got := a.Version(); got != "1.0" {
+		t.Errorf("Version() = %q, want 1.0", got)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	const (
+		system   = `<system xmlns="urn:client-test"><host-name>r1</host-name><mtu>1500</mtu></system>`
+		hostName = `<system xmlns="urn:client-test"><host-name>r1</host-name></system>`
+		// paddedHostName has a leaf value with significant whitespace
+		paddedHostName = `<system xmlns="urn:client-test"><host-name>  r2  </host-name></system>`
+	)
+	for _, tt := range []struct {
+		name string
+		call func() (string, error)
+		want string
+		// wantTag is the error-tag of the error returned
+		wantTag string
+	}{
+		{
+			name: "edit-config candidate",
+			call: func() (string, error) {
+				return "", a.EditConfig(ctx, datastore.Candidate, testDocument(t, system))
+			},
+		},
+		{
+			name: "get-config candidate",
+			call: func() (string, error) {
+				data, err := a.GetConfig(ctx, datastore.Candidate)
+				return content(t, data), err
+			},
+			want: system,
+		},
+		{
+			name: "get-config running before commit",
+			call: func() (string, error) {
+				data, err := a.GetConfig(ctx, datastore.Running)
+				return content(t, data), err
+			},
+		},
+		{
+			name: "validate",
+			call: func() (string, error) { return "", a.Validate(ctx, datastore.Candidate) },
+		},
+		{
+			name: "commit",
+			call: func() (string, error) { return "", a.Commit(ctx) },
+		},
+		{
+			name: "get with filter",
+			call: func() (string, error) {
+				data, err := b.Get(ctx, testDocument(t, `<system xmlns="urn:client-test"><host-name/></system>`).DocumentElement())
+				return content(t, data), err
+			},
+			want: hostName,
+		},
+		{
+			name: "edit-config invalid value",
+			call: func() (string, error) {
+				return "", a.EditConfig(ctx, datastore.Running, testDocument(t, `<system xmlns="urn:client-test"><mtu>70000</mtu></system>`), ErrorOption("rollback-on-error"))
+			},
+			wantTag: string(rpc.ErrorTagInvalidValue),
+		},
+		{
+			name: "edit-config replace",
+			call: func() (string, error) {
+				return "", a.EditConfig(ctx, datastore.Running, testDocument(t, hostName), DefaultOperation(datastore.EditReplace))
+			},
+		},
+		{
+			name: "get-config running after replace",
+			call: func() (string, error) {
+				data, err := b.GetConfig(ctx, datastore.Running)
+				return content(t, data), err
+			},
+			want: hostName,
+		},
+		{
+			name: "lock",
+			call: func() (string, error) { return "", a.Lock(ctx, datastore.Running) },
+		},
+		{
+			name:    "lock denied",
+			call:    func() (string, error) { return "", b.Lock(ctx, datastore.Running) },
+			wantTag: string(rpc.ErrorTagLockDenied),
+		},
+		{
+			name: "unlock",
+			call: func() (string, error) { return "", a.Unlock(ctx, datastore.Running) },
+		},
+		{
+			name: "discard-changes",
+			call: func() (string, error) { return "", b.DiscardChanges(ctx) },
+		},
+		{
+			name: "edit-config padded value",
+			call: func() (string, error) {
+				return "", a.EditConfig(ctx, datastore.Running, testDocument(t, paddedHostName))
+			},
+		},
+		{
+			name: "get-config padded value",
+			call: func() (string, error) {
+				data, err := b.GetConfig(ctx, datastore.Running)
+				return content(t, data), err
+			},
+			want: paddedHostName,
+		},
+		{
+			name: "get-schema",
+			call: func() (string, error) { return b.GetSchema(ctx, "client-test", "") },
+			want: testModule,
+		},
+		{
+			name:    "get-schema unknown",
+			call:    func() (string, error) { return b.GetSchema(ctx, "unknown", "") },
+			wantTag: string(rpc.ErrorTagInvalidValue),
+		},
+		{
+			name: "unknown operation",
+			call: func() (string, error) {
+				_, err := a.Call(ctx, element("urn:unknown", "reboot"))
+				return "", err
+			},
+			wantTag: string(rpc.ErrorTagOperationNotSupported),
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.call()
+			if tag := errorTag(err); tag != tt.wantTag {
+				t.Fatalf("error = %v, want error-tag %q", err, tt.wantTag)
+			}
+			if got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClient_RPC(t *testing.T) {
+	c := newTestServer(t).dial(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	reply, err := c.RPC(ctx, []byte(`<get-schema xmlns="`+modules.NetconfMonitoringNamespace+`"><identifier>client-test</identifier></get-schema>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `<data xmlns="` + modules.NetconfMonitoringNamespace + `">`; !strings.HasPrefix(string(reply), want) {
+		t.Errorf("RPC() = %s, want it to begin %s", reply, want)
+	}
+	var _ modules.RPCClient = c
+}
+
+func TestClient_Notifications(t *testing.T) {
+	s := newTestServer(t)
+	c := s.dial(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ports := s.broker.AddStream("ports", "port events")
+	if err := c.CreateSubscription(ctx, Stream("ports")); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.CreateSubscription(ctx); errorTag(err) != string(rpc.ErrorTagInUse) {
+		t.Errorf("second CreateSubscription() error = %v, want in-use", err)
+	}
+	eventTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	event := testDocument(t, `<link-down xmlns="urn:test"><if>eth0</if></link-down>`).DocumentElement()
+	if err := ports.Publish(ctx, &notification.Notification{EventTime: eventTime, Event: event}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case n := <-c.Notifications():
+		if !n.EventTime.Equal(eventTime) || n.Event.Name() != (xml.Name{Space: "urn:test", Local: "link-down"}) || n.Event.ChildValue() != "" {
+			t.Errorf("notification = %v %v", n.EventTime, n.Event.Name())
+		}
+		if got := n.Event.FirstChild().ChildValue(); got != "eth0" {
+			t.Errorf("notification if = %q, want eth0", got)
+		}
+	case <-ctx.Done():
+		t.Fatal("no notification received")
+	}
+}
+
+func TestClient_Close(t *testing.T) {
+	c := newTestServer(t).dial(t)
+	if err := c.Close(); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+	select {
+	case <-c.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Done() not closed")
+	}
+	if err := c.Err(); err != ErrClosed {
+		t.Errorf("Err() = %v, want %v", err, ErrClosed)
+	}
+	if _, err := c.Get(context.Background()); err != ErrClosed {
+		t.Errorf("Get() after Close() error = %v, want %v", err, ErrClosed)
+	}
+	if _, ok := <-c.Notifications(); ok {
+		t.Error("Notifications() not closed")
+	}
+}
+
+func TestNew(t *testing.T) {
+	for _, tt := range []struct {
+		name, hello string
+		wantErr     string
+	}{
+		{
+			name:  "base 1.0",
+			hello: `<hello xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><capabilities><capability>urn:ietf:params:netconf:base:1.0</capability></capabilities><session-id>4</session-id></hello>`,
+		},
+		{
+			name:    "no session-id",
+			hello:   `<hello xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><capabilities><capability>urn:ietf:params:netconf:base:1.0</capability></capabilities></hello>`,
+			wantErr: "invalid session-id",
+		},
+		{
+			name:    "no common base",
+			hello:   `<hello xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><capabilities><capability>urn:ietf:params:netconf:base:2.0</capability></capabilities><session-id>4</session-id></hello>`,
+			wantErr: "no common base capability",
+		},
+		{
+			name:    "not hello",
+			hello:   `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"/>`,
+			wantErr: "expected hello",
+		},
+		{name: "no hello", wantErr: context.DeadlineExceeded.Error()},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := transporttest.Pipe()
+			if tt.hello != "" {
+				if _, err := server.Write([]byte(tt.hello)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			c, err := New(ctx, client)
+			if (err != nil) != (tt.wantErr != "") || err != nil && !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("New() error = %v, want %q", err, tt.wantErr)
+			}
+			if err == nil && c.SessionID() != 4 {
+				t.Errorf("SessionID() = %d, want 4", c.SessionID())
+			}
+		})
+	}
+}
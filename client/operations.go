@@ -0,0 +1,305 @@
+package client
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	xml "github.com/andaru/flexml"
+	"github.com/andaru/opr8/datastore"
+	"github.com/andaru/opr8/dom"
+	"github.com/andaru/opr8/modules"
+	"github.com/andaru/opr8/notification"
+	"github.com/andaru/opr8/session"
+	"github.com/andaru/opr8/session/netconf"
+	"github.com/pkg/errors"
+)
+
+// Get returns the <data> element of the reply to <get>, the running
+// configuration and state data selected by the subtree filter, or all
+// data if there is none.
+func (c *Client) Get(ctx context.Context, filter ...dom.Node) (dom.Node, error) {
+	return c.data(ctx, base("get", subtreeFilter(netconf.BaseNamespace, filter)...))
+}
+
+// GetConfig returns the <data> element of the reply to <get-config>,
+// the configuration of the datastore named source selected by the
+// subtree filter, or all of it if there is none.
+func (c *Client) GetConfig(ctx context.Context, source string, filter ...dom.Node) (dom.Node, error) {
+	children := append([]dom.Node{base("source", base(source))}, subtreeFilter(netconf.BaseNamespace, filter)...)
+	return c.data(ctx, base("get-config", children...))
+}
+
+// data returns the <data> element of the reply to the operation op, an
+// empty one if the reply has none.
+func (c *Client) data(ctx context.Context, op dom.Node) (dom.Node, error) {
+	nodes, err := c.Call(ctx, op)
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range nodes {
+		if n.Name().Local == "data" {
+			return n, nil
+		}
+	}
+	return base("data"), nil
+}
+
+// EditOption is an option of EditConfig.
+type EditOption func(*editOptions)
+
+type editOptions struct {
+	defaultOperation, testOption, errorOption string
+}
+
+// DefaultOperation is an EditConfig option setting the
+// default-operation, merge by default.
+func DefaultOperation(op datastore.EditOperation) EditOption {
+	return func(o *editOptions) { o.defaultOperation = op.String() }
+}
+
+// TestOption is an EditConfig option setting the test-option, such as
+// "test-only", of servers with the :validate capability.
+func TestOption(option string) EditOption {
+	return func(o *editOptions) { o.testOption = option }
+}
+
+// ErrorOption is an EditConfig option setting the error-option, such
+// as "rollback-on-error".
+func ErrorOption(option string) EditOption {
+	return func(o *editOptions) { o.errorOption = option }
+}
+
+// EditConfig edits the datastore named target with <edit-config>, the
+// content of its <config> the element config, or the elements of the
+// Document config.
+func (c *Client) EditConfig(ctx context.Context, target string, config dom.Node, options ...EditOption) error {
+	var o editOptions
+	for _, option := range options {
+		option(&o)
+	}
+	op := base("edit-config", base("target", base(target)))
+	appendLeaves(op, netconf.BaseNamespace,
+		"default-operation", o.defaultOperation,
+		"test-option", o.testOption,
+		"error-option", o.errorOption)
+	_ = op.AppendChild(base("config", copies(config)...))
+	_, err := c.Call(ctx, op)
+	return err
+}
+
+// CommitOption is an option of Commit.
+type CommitOption func(*commitOptions)
+
+type commitOptions struct {
+	confirmed          bool
+	timeout            time.Duration
+	persist, persistID string
+}
+
+// Confirmed is a Commit option making the commit a confirmed commit,
+// reverted unless confirmed within the timeout, or 600 seconds if it
+// is zero. It requires the :confirmed-commit:1.1 capability.
+func Confirmed(timeout time.Duration) CommitOption {
+	return func(o *commitOptions) { o.confirmed, o.timeout = true, timeout }
+}
+
+// Persist is a Commit option making a confirmed commit persist beyond
+// the session, to be confirmed or cancelled with PersistID(id).
+func Persist(id string) CommitOption {
+	return func(o *commitOptions) { o.persist = id }
+}
+
+// PersistID is a Commit option confirming the persistent confirmed
+// commit made with Persist(id).
+func PersistID(id string) CommitOption {
+	return func(o *commitOptions) { o.persistID = id }
+}
+
+// Commit commits the candidate configuration to the running
+// configuration.
+func (c *Client) Commit(ctx context.Context, options ...CommitOption) error {
+	var o commitOptions
+	for _, option := range options {
+		option(&o)
+	}
+	op := base("commit")
+	if o.confirmed {
+		_ = op.AppendChild(base("confirmed"))
+	}
+	var timeout string
+	if o.timeout > 0 {
+		timeout = strconv.Itoa(int(o.timeout / time.Second))
+	}
+	appendLeaves(op, netconf.BaseNamespace,
+		"confirm-timeout", timeout,
+		"persist", o.persist,
+		"persist-id", o.persistID)
+	_, err := c.Call(ctx, op)
+	return err
+}
+
+// DiscardChanges reverts the candidate configuration to the running
+// configuration.
+func (c *Client) DiscardChanges(ctx context.Context) error {
+	_, err := c.Call(ctx, base("discard-changes"))
+	return err
+}
+
+// Validate validates the configuration of the datastore named source.
+func (c *Client) Validate(ctx context.Context, source string) error {
+	_, err := c.Call(ctx, base("validate", base("source", base(source))))
+	return err
+}
+
+// Lock locks the datastore named target.
+func (c *Client) Lock(ctx context.Context, target string) error {
+	_, err := c.Call(ctx, base("lock", base("target", base(target))))
+	return err
+}
+
+// Unlock unlocks the datastore named target.
+func (c *Client) Unlock(ctx context.Context, target string) error {
+	_, err := c.Call(ctx, base("unlock", base("target", base(target))))
+	return err
+}
+
+// KillSession ends the session with the session-id id.
+func (c *Client) KillSession(ctx context.Context, id session.ID) error {
+	_, err := c.Call(ctx, base("kill-session", leaf(netconf.BaseNamespace, "session-id", strconv.FormatUint(uint64(id), 10))))
+	return err
+}
+
+// SubscriptionOption is an option of CreateSubscription.
+type SubscriptionOption func(*subscriptionOptions)
+
+type subscriptionOptions struct {
+	stream              string
+	filter              []dom.Node
+	startTime, stopTime time.Time
+}
+
+// Stream is a CreateSubscription option subscribing to the stream
+// named name, rather than the NETCONF stream.
+func Stream(name string) SubscriptionOption {
+	return func(o *subscriptionOptions) { o.stream = name }
+}
+
+// Filter is a CreateSubscription option selecting the notifications
+// sent with the subtree filter.
+func Filter(filter ...dom.Node) SubscriptionOption {
+	return func(o *subscriptionOptions) { o.filter = filter }
+}
+
+// StartTime is a CreateSubscription option replaying the notifications
+// of the stream since the time t, before those that follow.
+func StartTime(t time.Time) SubscriptionOption {
+	return func(o *subscriptionOptions) { o.startTime = t }
+}
+
+// StopTime is a CreateSubscription option ending a subscription
+// replaying notifications at the time t.
+func StopTime(t time.Time) SubscriptionOption {
+	return func(o *subscriptionOptions) { o.stopTime = t }
+}
+
+// CreateSubscription subscribes the session to event notifications
+// (RFC 5277), which are sent to the Notifications channel.
+func (c *Client) CreateSubscription(ctx context.Context, options ...SubscriptionOption) error {
+	var o subscriptionOptions
+	for _, option := range options {
+		option(&o)
+	}
+	format := func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.Format(time.RFC3339Nano)
+	}
+	op := element(notification.Namespace, "create-subscription")
+	appendLeaves(op, notification.Namespace, "stream", o.stream)
+	for _, f := range subtreeFilter(notification.Namespace, o.filter) {
+		_ = op.AppendChild(f)
+	}
+	appendLeaves(op, notification.Namespace,
+		"startTime", format(o.startTime),
+		"stopTime", format(o.stopTime))
+	_, err := c.Call(ctx, op)
+	return err
+}
+
+// GetSchema returns the text of the schema with the identifier, such
+// as a YANG module name, and version, if not empty, retrieved with the
+// <get-schema> operation of ietf-netconf-monitoring (RFC 6022).
+func (c *Client) GetSchema(ctx context.Context, identifier, version string) (string, error) {
+	op := element(modules.NetconfMonitoringNamespace, "get-schema", leaf(modules.NetconfMonitoringNamespace, "identifier", identifier))
+	if version != "" {
+		_ = op.AppendChild(leaf(modules.NetconfMonitoringNamespace, "version", version))
+	}
+	_ = op.AppendChild(leaf(modules.NetconfMonitoringNamespace, "format", "yang"))
+	data, err := c.data(ctx, op)
+	if err != nil {
+		return "", err
+	}
+	text := data.ChildValue()
+	if text == "" {
+		return "", errors.Errorf("empty schema %s", identifier)
+	}
+	return text, nil
+}
+
+// ImportSchemas reads the YANG modules and submodules of the server
+// into the collection, as modules.Collection.ImportNETCONF does.
+// Process must be called before the collection is used.
+func (c *Client) ImportSchemas(ctx context.Context, mc *modules.Collection) []error {
+	return mc.ImportNETCONF(ctx, c)
+}
+
+// base returns a new element in the NETCONF base namespace named
+// local, with the children.
+func base(local string, children ...dom.Node) dom.Element {
+	return element(netconf.BaseNamespace, local, children...)
+}
+
+// subtreeFilter returns the <filter> element, in the namespace ns, of
+// the subtree filter, or nothing if it is empty.
+func subtreeFilter(ns string, filter []dom.Node) []dom.Node {
+	if len(filter) == 0 {
+		return nil
+	}
+	var children []dom.Node
+	for _, n := range filter {
+		children = append(children, copies(n)...)
+	}
+	f := element(ns, "filter", children...)
+	_ = f.AppendAttribute(xml.Attr{Name: xml.Name{Local: "type"}, Value: "subtree"})
+	return []dom.Node{f}
+}
+
+// appendLeaves appends to e an element in the namespace ns of each
+// pair of local name and value in pairs whose value is not empty.
+func appendLeaves(e dom.Element, ns string, pairs ...string) {
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if pairs[i+1] != "" {
+			_ = e.AppendChild(leaf(ns, pairs[i], pairs[i+1]))
+		}
+	}
+}
+
+// copies returns a copy of the node n, or of its element children if
+// it is a Document.
+func copies(n dom.Node) []dom.Node {
+	if n == nil {
+		return nil
+	}
+	if n.NodeType() != dom.NodeTypeDocument {
+		return []dom.Node{dom.CloneNode(n, true)}
+	}
+	var nodes []dom.Node
+	for it := n.FirstChild(); it != nil; it = it.NextSibling() {
+		if it.NodeType() == dom.NodeTypeElement {
+			nodes = append(nodes, dom.CloneNode(it, true))
+		}
+	}
+	return nodes
+}
@@ -0,0 +1,419 @@
+/*
+Command opr8 converts, validates and compares YANG instance documents,
+and prints the schema trees of YANG modules.
+
+Usage:
+
+	opr8 [-path dir[:dir...]] [-modules name[,name...]] command [arguments]
+
+The module collection is read from the YANG path, the directories of
+the -path flag, and is either the modules named by -modules and those
+they import, or every module found. The commands are:
+
+	convert [-format xml|json] file
+		convert the YANG data in file to the other encoding, or
+		that of -format
+	validate file...
+		validate the YANG data in each file against the modules
+	fmt file
+		pretty-print the YANG data in file in its own encoding
+	diff file1 file2
+		print the edits changing the data of file1 into that of
+		file2
+	tree [-depth n] module...
+		print the RFC 8340 tree diagram of each module
+
+Files with a ".json" extension hold YANG/JSON (RFC 7951) data and
+other files YANG/XML data; a file of "-" is YANG/XML data read from
+the standard input, or YANG/JSON data with the -json flag of the
+command. The exit status is 1 if a document is invalid or documents
+differ, and 2 if a command fails.
+*/
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	xml "github.com/andaru/flexml"
+	"github.com/andaru/opr8/datastore"
+	"github.com/andaru/opr8/dom"
+	"github.com/andaru/opr8/modules"
+	"github.com/pkg/errors"
+)
+
+// errFailed is returned by commands which have already reported why a
+// document is invalid or documents differ.
+var errFailed = errors.New("failed")
+
+// usages are the usages of the commands, in the order listed.
+var usages = []struct{ name, usage string }{
+	{"convert", "convert [-format xml|json] [-json] file"},
+	{"validate", "validate [-json] file..."},
+	{"fmt", "fmt [-json] file"},
+	{"diff", "diff [-json] file1 file2"},
+	{"tree", "tree [-depth n] module..."},
+}
+
+// commands are the opr8 commands, each run with the arguments
+// following its name.
+var commands = map[string]func(cli *cli, args []string) error{
+	"convert":  (*cli).convert,
+	"validate": (*cli).validate,
+	"fmt":      (*cli).format,
+	"diff":     (*cli).diff,
+	"tree":     (*cli).tree,
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// cli is the state of an invocation of opr8.
+type cli struct {
+	c      *modules.Collection
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// run runs the opr8 command line args, returning the exit status.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("opr8", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	path := fs.String("path", ".", "the YANG path, directories separated by "+string(filepath.ListSeparator))
+	names := fs.String("modules", "", "the modules to import, separated by commas; all modules in the YANG path if empty")
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "usage: opr8 [flags] command [arguments]\n\nflags:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(stderr, "\ncommands:\n")
+		for _, u := range usages {
+			fmt.Fprintf(stderr, "  %s\n", u.usage)
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+	cmd, ok := commands[fs.Arg(0)]
+	if !ok {
+		fmt.Fprintf(stderr, "opr8: unknown command %q\n", fs.Arg(0))
+		fs.Usage()
+		return 2
+	}
+
+	c, err := collection(filepath.SplitList(*path), *names)
+	if err != nil {
+		fmt.Fprintf(stderr, "opr8: %v\n", err)
+		return 2
+	}
+	cli := &cli{c: c, stdin: stdin, stdout: stdout, stderr: stderr}
+	switch err := cmd(cli, fs.Args()[1:]); {
+	case err == errFailed:
+		return 1
+	case err == flag.ErrHelp:
+		return 2
+	case err != nil:
+		fmt.Fprintf(stderr, "opr8 %s: %v\n", fs.Arg(0), err)
+		return 2
+	}
+	return 0
+}
+
+// collection returns the processed collection of the modules named,
+// separated by commas, or of all modules in the YANG path if names is
+// empty.
+func collection(path []string, names string) (*modules.Collection, error) {
+	modules.SetYANGPath(path...)
+	c := modules.NewCollection()
+	var errs []error
+	if names == "" {
+		errs = c.ImportAll()
+	} else {
+		for _, name := range strings.Split(names, ",") {
+			if err := c.Import(strings.TrimSpace(name)); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	if len(errs) == 0 {
+		errs = c.Process()
+	}
+	if len(errs) > 0 {
+		return nil, errors.Wrapf(errs[0], "%d module errors, first", len(errs))
+	}
+	return c, nil
+}
+
+// flags returns the flag set of the command named name, with the -json
+// flag setting stdinJSON if it is not nil.
+func (cli *cli) flags(name string, stdinJSON *bool) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(cli.stderr)
+	fs.Usage = func() {
+		for _, u := range usages {
+			if u.name == name {
+				fmt.Fprintf(cli.stderr, "usage: opr8 %s\n", u.usage)
+			}
+		}
+		fs.PrintDefaults()
+	}
+	if stdinJSON != nil {
+		fs.BoolVar(stdinJSON, "json", false, "the standard input is YANG/JSON data")
+	}
+	return fs
+}
+
+// isJSON returns true if the file at path holds YANG/JSON data.
+func isJSON(path string, stdinJSON bool) bool {
+	if path == "-" {
+		return stdinJSON
+	}
+	return strings.EqualFold(filepath.Ext(path), ".json")
+}
+
+// read returns the data tree of the YANG data in the file at path,
+// with any errors decoding it.
+func (cli *cli) read(path string, stdinJSON bool) (dom.Document, []error, error) {
+	var r io.Reader = cli.stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	root := dom.NewDocument(nil)
+	td := &datastore.Decoder{Node: root, Modules: cli.c, Attrs: datastore.AttrNamespaces()}
+	un := dom.NewUnmarshaler(td)
+	reader := un.XMLReader()
+	un.InitializeArgs = []string{"mediatype", "application/yang-data+xml"}
+	if isJSON(path, stdinJSON) {
+		reader = un.JSONReader()
+		un.InitializeArgs = []string{"mediatype", "application/yang-data+json"}
+	}
+	if _, err := reader.ReadFrom(r); err != nil {
+		return nil, nil, errors.Wrapf(err, "%s", path)
+	}
+	return root, td.DecodingErrors(), nil
+}
+
+// readValid returns the data tree of the YANG data in the file at
+// path, failing if it could not be decoded.
+func (cli *cli) readValid(path string, stdinJSON bool) (dom.Document, error) {
+	root, errs, err := cli.read(path, stdinJSON)
+	if err != nil {
+		return nil, err
+	}
+	if len(errs) > 0 {
+		return nil, errors.Wrapf(errs[0], "%s: %d decoding errors, first", path, len(errs))
+	}
+	return root, nil
+}
+
+// write writes the data tree root in the YANG/JSON encoding if toJSON
+// is true, and the YANG/XML encoding otherwise, indented.
+func (cli *cli) write(root dom.Node, toJSON bool) error {
+	var children []dom.Node
+	for it := root.FirstChild(); it != nil; it = it.NextSibling() {
+		if it.NodeType() == dom.NodeTypeElement {
+			children = append(children, it)
+		}
+	}
+	if toJSON {
+		return writeJSON(cli.stdout, datastore.MarshalJSON(cli.c, children))
+	}
+	enc := xml.NewEncoder(cli.stdout)
+	enc.Indent("", "  ")
+	for _, n := range children {
+		// detached copies are encoded with their namespaces
+		if err := dom.NewMarshaler(dom.CloneNode(n, true)).MarshalXML(enc, xml.StartElement{}); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(cli.stdout, "\n")
+	return err
+}
+
+// writeJSON writes the JSON value b to w, indented.
+func writeJSON(w io.Writer, b []byte) error {
+	var out bytes.Buffer
+	if err := json.Indent(&out, b, "", "  "); err != nil {
+		return err
+	}
+	out.WriteByte('\n')
+	_, err := out.WriteTo(w)
+	return err
+}
+
+func (cli *cli) convert(args []string) error {
+	var stdinJSON bool
+	fs := cli.flags("convert", &stdinJSON)
+	format := fs.String("format", "", "the encoding converted to, xml or json; the other encoding if empty")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+	path := fs.Arg(0)
+	toJSON := !isJSON(path, stdinJSON)
+	switch *format {
+	case "":
+	case "xml", "json":
+		toJSON = *format == "json"
+	default:
+		return errors.Errorf("unknown format %q", *format)
+	}
+	root, err := cli.readValid(path, stdinJSON)
+	if err != nil {
+		return err
+	}
+	return cli.write(root, toJSON)
+}
+
+func (cli *cli) format(args []string) error {
+	var stdinJSON bool
+	fs := cli.flags("fmt", &stdinJSON)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+	root, err := cli.readValid(fs.Arg(0), stdinJSON)
+	if err != nil {
+		return err
+	}
+	return cli.write(root, isJSON(fs.Arg(0), stdinJSON))
+}
+
+// validate reports the decoding and validation errors of each file,
+// failing if any has an error of severity error.
+func (cli *cli) validate(args []string) error {
+	var stdinJSON bool
+	fs := cli.flags("validate", &stdinJSON)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+	valid := true
+	for _, path := range fs.Args() {
+		root, errs, err := cli.read(path, stdinJSON)
+		if err != nil {
+			return err
+		}
+		// values the decoder found invalid are found so again
+		reported := map[string]bool{}
+		for _, err := range errs {
+			reported[describe(err)] = true
+			fmt.Fprintf(cli.stdout, "%s: %s\n", path, describe(err))
+			if de, ok := err.(*datastore.DecodeError); !ok || de.Severity == datastore.SeverityError {
+				valid = false
+			}
+		}
+		report := datastore.Validate(root, cli.c, nil)
+		for _, err := range report.Errors {
+			if !reported[describe(err)] {
+				fmt.Fprintf(cli.stdout, "%s: %s\n", path, describe(err))
+			}
+		}
+		valid = valid && report.Valid()
+	}
+	if !valid {
+		return errFailed
+	}
+	return nil
+}
+
+// describe returns a line describing the decoding or validation error
+// err.
+func describe(err error) string {
+	de, ok := err.(*datastore.DecodeError)
+	if !ok {
+		return err.Error()
+	}
+	s := fmt.Sprintf("%s: %s (%s)", de.Severity, de.Error(), de.Tag)
+	if de.Path != "" {
+		s = de.Path + ": " + s
+	}
+	return s
+}
+
+// diff prints the edits changing the data of the first file into that
+// of the second, one per line, failing if there are any.
+func (cli *cli) diff(args []string) error {
+	var stdinJSON bool
+	fs := cli.flags("diff", &stdinJSON)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+	a, err := cli.readValid(fs.Arg(0), stdinJSON)
+	if err != nil {
+		return err
+	}
+	b, err := cli.readValid(fs.Arg(1), stdinJSON)
+	if err != nil {
+		return err
+	}
+	edits := datastore.Diff(a, b, cli.c)
+	prefix := func(ns string) string {
+		if mod, err := cli.c.ModuleByNamespace(ns); err == nil {
+			return mod.Name
+		}
+		return ns
+	}
+	for _, edit := range edits {
+		line := edit.Operation.String() + " " + edit.Path.Format(prefix)
+		if len(edit.Nodes) > 0 {
+			// the nodes of b are encoded, as the edit's copies have no
+			// parents to find their schema by
+			line += " " + string(datastore.MarshalJSONValue(cli.c, edit.Path.ResolveAll(b)))
+		}
+		fmt.Fprintln(cli.stdout, line)
+	}
+	if len(edits) > 0 {
+		return errFailed
+	}
+	return nil
+}
+
+func (cli *cli) tree(args []string) error {
+	fs := cli.flags("tree", nil)
+	depth := fs.Int("depth", 0, "the levels of schema nodes shown; unlimited if zero")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+	for i, module := range fs.Args() {
+		if i > 0 {
+			fmt.Fprintln(cli.stdout)
+		}
+		if err := cli.c.Tree(cli.stdout, module, modules.TreeDepth(*depth)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		args  []string
+		stdin string
+		want  []string
+		// wantStatus is the exit status
+		wantStatus int
+	}{
+		{
+			name: "convert xml to json",
+			args: []string{"convert", "testdata/a.xml"},
+			want: []string{`"example:system": {`, `"mtu": 1500`, `"enabled": true`},
+		},
+		{
+			name: "convert json to xml",
+			args: []string{"convert", "testdata/b.json"},
+			want: []string{`<system xmlns="urn:example">`, "    <name>eth1</name>"},
+		},
+		{
+			name: "convert to the same format",
+			args: []string{"convert", "-format", "json", "testdata/b.json"},
+			want: []string{`"host-name": "router2"`},
+		},
+		{
+			name:  "convert stdin json",
+			args:  []string{"convert", "-json", "-"},
+			stdin: `{"example:system":{"host-name":"stdin"}}`,
+			want:  []string{"<host-name>stdin</host-name>"},
+		},
+		{
+			name:       "convert unknown format",
+			args:       []string{"convert", "-format", "yaml", "testdata/a.xml"},
+			wantStatus: 2,
+		},
+		{
+			name:       "convert invalid document",
+			args:       []string{"convert", "testdata/invalid.xml"},
+			wantStatus: 2,
+		},
+		{
+			name: "fmt",
+			args: []string{"fmt", "testdata/a.xml"},
+			want: []string{"<interfaces xmlns=\"urn:example\">\n  <interface>\n    <name>eth0</name>"},
+		},
+		{
+			name: "validate",
+			args: []string{"validate", "testdata/a.xml", "testdata/b.json"},
+		},
+		{
+			name: "validate invalid",
+			args: []string{"validate", "testdata/a.xml", "testdata/invalid.xml"},
+			want: []string{
+				`testdata/invalid.xml: /example:system/mtu: error: invalid value for mtu: "70000" is not a valid uint16 (invalid-value)`,
+				"testdata/invalid.xml: /example:system/speed: error: unexpected child element",
+			},
+			wantStatus: 1,
+		},
+		{
+			name: "diff",
+			args: []string{"diff", "testdata/a.xml", "testdata/b.json"},
+			want: []string{
+				`replace /example:system/host-name "router2"`,
+				`create /example:interfaces/interface[name='eth1'] {"name":"eth1","enabled":false}`,
+			},
+			wantStatus: 1,
+		},
+		{
+			name: "diff same",
+			args: []string{"diff", "testdata/a.xml", "testdata/a.xml"},
+		},
+		{
+			name: "tree",
+			args: []string{"tree", "-depth", "1", "example"},
+			want: []string{"module: example\n  +--rw system\n  |  ...\n"},
+		},
+		{
+			name:       "tree unknown module",
+			args:       []string{"tree", "unknown"},
+			wantStatus: 2,
+		},
+		{name: "no command", wantStatus: 2},
+		{name: "unknown command", args: []string{"unknown"}, wantStatus: 2},
+		{name: "missing arguments", args: []string{"diff", "testdata/a.xml"}, wantStatus: 2},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			args := append([]string{"-path", "testdata", "-modules", "example"}, tt.args...)
+			if status := run(args, strings.NewReader(tt.stdin), &stdout, &stderr); status != tt.wantStatus {
+				t.Errorf("run() = %d, want %d; stderr:\n%s", status, tt.wantStatus, stderr.String())
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(stdout.String(), want) {
+					t.Errorf("run() output:\n%s\nwant it to contain:\n%s", stdout.String(), want)
+				}
+			}
+		})
+	}
+}
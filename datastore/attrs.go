@@ -0,0 +1,68 @@
+package datastore
+
+import (
+	xml "github.com/andaru/flexml"
+	"github.com/andaru/opr8/dom"
+)
+
+// AttrFilter selects the XML attributes of decoded elements kept on
+// their data nodes, returning true if the attribute attr of the
+// element named elem is to be kept.
+type AttrFilter func(elem xml.Name, attr xml.Attr) bool
+
+// AttrNamespaces returns an AttrFilter keeping namespace declarations
+// and the attributes in the namespaces provided, e.g., the NETCONF
+// base namespace for edit-config operation attributes.
+func AttrNamespaces(spaces ...string) AttrFilter {
+	keep := map[string]bool{xmlnsPrefix: true}
+	for _, space := range spaces {
+		keep[space] = true
+	}
+	return func(_ xml.Name, attr xml.Attr) bool {
+		return keep[attr.Name.Space] || attr.Name.Space == "" && attr.Name.Local == xmlnsPrefix
+	}
+}
+
+const xmlnsPrefix = "xmlns"
+
+// filterAttrs returns a copy of the attributes of se selected by
+// filter, or all attributes if filter is nil.
+func filterAttrs(se xml.StartElement, filter AttrFilter) []xml.Attr {
+	if len(se.Attr) == 0 {
+		return nil
+	}
+	attrs := make([]xml.Attr, 0, len(se.Attr))
+	for _, attr := range se.Attr {
+		if filter == nil || filter(se.Name, attr) {
+			attrs = append(attrs, attr)
+		}
+	}
+	return attrs
+}
+
+// mergeAttrs sets the attributes of src on dst, replacing the values
+// of attributes dst already has with the same name.
+func mergeAttrs(dst, src dom.Node) {
+	sp, ok := src.(dom.AttributeProvider)
+	if !ok {
+		return
+	}
+	dp, ok := dst.(dom.AttributeProvider)
+	if !ok {
+		return
+	}
+	for a := dom.Node(sp.FirstAttribute()); a != nil; a = a.NextSibling() {
+		var existing dom.Node
+		for d := dom.Node(dp.FirstAttribute()); d != nil; d = d.NextSibling() {
+			if d.Name() == a.Name() {
+				existing = d
+				break
+			}
+		}
+		if existing != nil {
+			_ = existing.SetValue(a.Value())
+		} else {
+			_ = dp.AppendAttribute(xml.Attr{Name: a.Name(), Value: a.Value()})
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package datastore
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/andaru/opr8/dom"
+)
+
+// attrStrings returns the attributes of n, formatted as
+// "{space}local=value".
+func attrStrings(n dom.Node) []string {
+	var attrs []string
+	for a := dom.Node(n.(dom.AttributeProvider).FirstAttribute()); a != nil; a = a.NextSibling() {
+		attrs = append(attrs, "{"+a.Name().Space+"}"+a.Name().Local+"="+a.Value())
+	}
+	return attrs
+}
+
+func TestDecoderAttrs(t *testing.T) {
+	c := newTestCollection(t)
+	const nc = "urn:ietf:params:xml:ns:netconf:base:1.0"
+
+	for _, tt := range []struct {
+		name      string
+		inputs    []string
+		attrs     AttrFilter
+		merge     bool
+		want      []string
+		wantChild []string
+	}{
+		{
+			name:      "all attributes kept",
+			inputs:    []string{`<system xmlns="urn:mod1" xmlns:nc="` + nc + `" nc:operation="replace" other="x"><host-name nc:operation="delete"/></system>`},
+			want:      []string{"{}xmlns=urn:mod1", "{xmlns}nc=" + nc, "{" + nc + "}operation=replace", "{}other=x"},
+			wantChild: []string{"{" + nc + "}operation=delete"},
+		},
+		{
+			name:   "filtered by namespace",
+			inputs: []string{`<system xmlns="urn:mod1" xmlns:nc="` + nc + `" xmlns:md="urn:md" nc:operation="replace" md:tag="t" other="x"><host-name md:tag="u">a</host-name></system>`},
+			attrs:  AttrNamespaces(nc),
+			want:   []string{"{}xmlns=urn:mod1", "{xmlns}nc=" + nc, "{xmlns}md=urn:md", "{" + nc + "}operation=replace"},
+		},
+		{
+			name:  "merged attributes",
+			merge: true,
+			inputs: []string{
+				`<system xmlns="urn:mod1" a="1" b="1"><host-name>a</host-name></system>`,
+				`<system xmlns="urn:mod1" b="2" c="2"><host-name c="3">b</host-name></system>`,
+			},
+			want:      []string{"{}xmlns=urn:mod1", "{}a=1", "{}b=2", "{}c=2"},
+			wantChild: []string{"{}c=3"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := dom.NewDocument(nil)
+			for _, input := range tt.inputs {
+				td := &Decoder{Node: doc, Modules: c, Merge: tt.merge, Attrs: tt.attrs}
+				un := dom.NewUnmarshaler(td)
+				un.InitializeArgs = []string{"mediatype", "application/yang-data+xml"}
+				if _, err := un.XMLReader().ReadFrom(strings.NewReader(input)); err != nil {
+					t.Fatalf("ReadFrom() err = %v, wantErr false", err)
+				}
+				if errs := td.DecodingErrors(); len(errs) > 0 {
+					t.Fatalf("got decoding errors %v", errs)
+				}
+			}
+			if doc.FirstChild() != doc.LastChild() {
+				t.Fatalf("got more than one top-level element")
+			}
+			if got := attrStrings(doc.FirstChild()); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("element attributes = %q, want %q", got, tt.want)
+			}
+			if got := attrStrings(doc.FirstChild().FirstChild()); !reflect.DeepEqual(got, tt.wantChild) {
+				t.Errorf("child attributes = %q, want %q", got, tt.wantChild)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package datastore
+
+import (
+	"strings"
+
+	"github.com/andaru/opr8/dom"
+	"github.com/andaru/opr8/modules"
+	"github.com/openconfig/goyang/pkg/yang"
+	"github.com/pkg/errors"
+)
+
+// ConfigFilter selects the data kept by FilterConfig.
+type ConfigFilter int
+
+const (
+	// ConfigOnly keeps configuration data, removing all state
+	// (config false) nodes, as for a get-config reply.
+	ConfigOnly ConfigFilter = iota
+	// StateOnly keeps state data, along with the configuration
+	// ancestors and list keys needed to reach it, as for an
+	// operational state view.
+	StateOnly
+)
+
+// FilterConfig removes the descendants of root not selected by
+// filter, according to the config property of their schema nodes.
+// Elements unknown to the schema are left in place.
+//
+// The schema is the schema node for root, or nil if root is a
+// Document, whose top-level elements are found in the collection c.
+func FilterConfig(root dom.Node, c *modules.Collection, schema *yang.Entry, filter ConfigFilter) error {
+	if root == nil || c == nil {
+		return errors.New("filter requires a root node and module collection")
+	}
+	if schema != nil {
+		filterChildren(c, root, schema, filter)
+		return nil
+	}
+	if root.NodeType() != dom.NodeTypeDocument {
+		return errors.New("filter requires the schema of a root element")
+	}
+	var remove []dom.Node
+	for it := root.FirstChild(); it != nil; it = it.NextSibling() {
+		if it.NodeType() != dom.NodeTypeElement {
+			continue
+		}
+		if e := rootEntry(c, it.Name()); e != nil && !filterNode(c, it, e, filter) {
+			remove = append(remove, it)
+		}
+	}
+	for _, n := range remove {
+		_ = root.RemoveChild(n)
+	}
+	return nil
+}
+
+// filterNode filters the descendants of n, of schema node e of the
+// collection c, and returns true if n itself is to be kept.
+func filterNode(c *modules.Collection, n dom.Node, e *yang.Entry, filter ConfigFilter) bool {
+	if e.ReadOnly() {
+		return filter == StateOnly
+	}
+	if e.Kind != yang.DirectoryEntry {
+		return filter == ConfigOnly
+	}
+	state := filterChildren(c, n, e, filter)
+	return filter == ConfigOnly || state
+}
+
+// filterChildren filters the children of n, of schema node e, and
+// returns true if any child other than a list key was kept.
+func filterChildren(c *modules.Collection, n dom.Node, e *yang.Entry, filter ConfigFilter) bool {
+	keys := map[string]bool{}
+	if e.IsList() {
+		for _, key := range strings.Fields(e.Key) {
+			keys[key] = true
+		}
+	}
+	kept := false
+	var remove []dom.Node
+	for it := n.FirstChild(); it != nil; it = it.NextSibling() {
+		if it.NodeType() != dom.NodeTypeElement || keys[it.Name().Local] {
+			continue
+		}
+		ce := c.DataChild(e, it.Name().Local)
+		if ce == nil {
+			continue
+		}
+		if filterNode(c, it, ce, filter) {
+			kept = true
+		} else {
+			remove = append(remove, it)
+		}
+	}
+	for _, child := range remove {
+		_ = n.RemoveChild(child)
+	}
+	return kept
+}
@@ -0,0 +1,90 @@
+package datastore
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/andaru/flexml"
+	"github.com/andaru/opr8/dom"
+)
+
+func TestFilterConfig(t *testing.T) {
+	c := newTestCollection(t)
+	input := `<refs xmlns="urn:mod2">` +
+		`<server><name>a</name><port>1</port><connections>3</connections></server>` +
+		`<server><name>b</name><port>2</port></server>` +
+		`<tag>x</tag><stats><uptime>10</uptime></stats></refs>` +
+		`<system xmlns="urn:mod1"><host-name>h</host-name></system>`
+
+	for _, tt := range []struct {
+		name    string
+		filter  ConfigFilter
+		wantXML string
+	}{
+		{
+			name:   "config only",
+			filter: ConfigOnly,
+			wantXML: `<refs xmlns="urn:mod2">` +
+				`<server><name>a</name><port>1</port></server>` +
+				`<server><name>b</name><port>2</port></server>` +
+				`<tag>x</tag></refs>` +
+				`<system xmlns="urn:mod1"><host-name>h</host-name></system>`,
+		},
+		{
+			name:   "state only",
+			filter: StateOnly,
+			wantXML: `<refs xmlns="urn:mod2">` +
+				`<server><name>a</name><connections>3</connections></server>` +
+				`<stats><uptime>10</uptime></stats></refs>`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, doc := decodeXML(t, c, input)
+			if err := FilterConfig(doc, c, nil, tt.filter); err != nil {
+				t.Fatalf("FilterConfig() error = %v, wantErr false", err)
+			}
+			b, err := flexml.Marshal(dom.NewMarshaler(doc))
+			if err != nil {
+				t.Fatalf("xml.Marshal(doc) error: %v, wantErr false", err)
+			} else if string(b) != tt.wantXML {
+				t.Errorf("encoded XML got:\n%s\nwant:\n%s\n", b, tt.wantXML)
+			}
+		})
+	}
+}
+
+func TestDecoderConfig(t *testing.T) {
+	c := newTestCollection(t)
+	doc := dom.NewDocument(nil)
+	td := &Decoder{Node: doc, Modules: c, Config: true}
+	un := dom.NewUnmarshaler(td)
+	un.InitializeArgs = []string{"mediatype", "application/yang-data+xml"}
+	input := `<refs xmlns="urn:mod2"><server><name>a</name><connections>3</connections></server>` +
+		`<stats><uptime>10</uptime></stats><tag>x</tag></refs>`
+	if _, err := un.XMLReader().ReadFrom(strings.NewReader(input)); err != nil {
+		t.Fatalf("ReadFrom() err = %v, wantErr false", err)
+	}
+
+	errs := td.DecodingErrors()
+	wantPaths := []string{"/module2:refs/server[name='a']/connections", "/module2:refs/stats"}
+	if len(errs) != len(wantPaths) {
+		t.Fatalf("got %d decoding errors %v, want %d", len(errs), errs, len(wantPaths))
+	}
+	for i, err := range errs {
+		de, ok := err.(*DecodeError)
+		if !ok {
+			t.Fatalf("error %d is %T, want *DecodeError", i, err)
+		}
+		if de.Tag != ErrorTagBadElement || de.Path != wantPaths[i] {
+			t.Errorf("error %d = (%s, %s), want (%s, %s)", i, de.Tag, de.Path, ErrorTagBadElement, wantPaths[i])
+		}
+	}
+
+	want := `<refs xmlns="urn:mod2"><server><name>a</name></server><tag>x</tag></refs>`
+	b, err := flexml.Marshal(dom.NewMarshaler(doc))
+	if err != nil {
+		t.Fatalf("xml.Marshal(doc) error: %v, wantErr false", err)
+	} else if string(b) != want {
+		t.Errorf("encoded XML got:\n%s\nwant:\n%s\n", b, want)
+	}
+}
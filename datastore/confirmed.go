@@ -0,0 +1,398 @@
+package datastore
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andaru/opr8/dom"
+	"github.com/andaru/opr8/log"
+	"github.com/andaru/opr8/session"
+	"github.com/pkg/errors"
+)
+
+// DefaultConfirmTimeout is the time a confirmed commit is rolled back
+// after, unless confirmed, if no timeout is given (RFC 6241 section
+// 8.4.5.1).
+const DefaultConfirmTimeout = 600 * time.Second
+
+var (
+	// ErrNoConfirmedCommit is returned by Confirmer operations
+	// requiring a pending confirmed commit, or a pending commit with
+	// the persist-id given, when there is none.
+	ErrNoConfirmedCommit = errors.New("no confirmed commit is pending")
+	// ErrConfirmedCommitInUse is returned by Confirmer operations on a
+	// pending confirmed commit which may only be confirmed or
+	// cancelled by the session making it.
+	ErrConfirmedCommitInUse = errors.New("confirmed commit is pending for another session")
+)
+
+// ConfirmedCommit is the state of a pending confirmed commit of the
+// running datastore (RFC 6241 section 8.4).
+type ConfirmedCommit struct {
+	// Session is the ID of the session making the commit, or of its
+	// latest follow-up confirmed commit.
+	Session session.ID
+	// PersistID is the persist parameter of the commit, empty if the
+	// commit is not persistent, and so rolled back when its session
+	// ends.
+	PersistID string
+	// Deadline is the time the commit is rolled back at unless
+	// confirmed.
+	Deadline time.Time
+	// Rollback is the running configuration before the commit,
+	// restored if the commit is cancelled or not confirmed. It must
+	// not be modified.
+	Rollback dom.Document
+}
+
+// ConfirmedStore stores the state of the pending confirmed commit, so
+// a persistent commit remains pending, or is rolled back, when the
+// server restarts during its confirmation window.
+type ConfirmedStore interface {
+	// Save stores the pending commit, replacing any stored.
+	Save(*ConfirmedCommit) error
+	// Load returns the stored commit, or nil if none is stored.
+	Load() (*ConfirmedCommit, error)
+	// Clear removes the stored commit, if any.
+	Clear() error
+}
+
+// FileConfirmedStore is a ConfirmedStore keeping the pending commit in
+// a file, written atomically by renaming a temporary file.
+type FileConfirmedStore struct {
+	path string
+}
+
+// NewFileConfirmedStore returns a ConfirmedStore keeping the pending
+// commit in the file at path. Its directory must exist.
+func NewFileConfirmedStore(path string) *FileConfirmedStore {
+	return &FileConfirmedStore{path: path}
+}
+
+// confirmedFile is the stored form of a ConfirmedCommit, with the
+// rollback configuration encoded as YANG/XML.
+type confirmedFile struct {
+	Session   session.ID `json:"session"`
+	PersistID string     `json:"persist-id,omitempty"`
+	Deadline  time.Time  `json:"deadline"`
+	Rollback  string     `json:"rollback"`
+}
+
+// Save writes cc to the file, synchronizing it before it replaces the
+// file's previous content.
+func (s *FileConfirmedStore) Save(cc *ConfirmedCommit) error {
+	var config bytes.Buffer
+	if _, err := dom.NewMarshaler(cc.Rollback).XMLWriter().WriteTo(&config); err != nil {
+		return errors.Wrap(err, "encoding rollback configuration")
+	}
+	b, err := json.Marshal(confirmedFile{
+		Session:   cc.Session,
+		PersistID: cc.PersistID,
+		Deadline:  cc.Deadline,
+		Rollback:  config.String(),
+	})
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(b); err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), s.path)
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return errors.Wrapf(err, "saving confirmed commit to %s", s.path)
+	}
+	return nil
+}
+
+// Load reads the commit stored in the file, returning nil if the file
+// does not exist.
+func (s *FileConfirmedStore) Load() (*ConfirmedCommit, error) {
+	b, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var stored confirmedFile
+	if err := json.Unmarshal(b, &stored); err != nil {
+		return nil, errors.Wrapf(err, "%s", s.path)
+	}
+	root := dom.NewDocument(nil)
+	un := dom.NewUnmarshaler(dom.NewBuilder(root))
+	if _, err := un.XMLReader().ReadFrom(strings.NewReader(stored.Rollback)); err != nil {
+		return nil, errors.Wrapf(err, "%s: rollback configuration", s.path)
+	}
+	return &ConfirmedCommit{
+		Session:   stored.Session,
+		PersistID: stored.PersistID,
+		Deadline:  stored.Deadline,
+		Rollback:  root,
+	}, nil
+}
+
+// Clear removes the file, if it exists.
+func (s *FileConfirmedStore) Clear() error {
+	if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// ConfirmParams are the confirmed commit parameters of a commit (RFC
+// 6241 section 8.4.5.1).
+type ConfirmParams struct {
+	// Confirmed makes the commit a confirmed commit, rolled back
+	// unless confirmed within Timeout, or DefaultConfirmTimeout if
+	// zero.
+	Confirmed bool
+	Timeout   time.Duration
+	// Persist, if not empty, makes a confirmed commit persistent:
+	// it survives the end of its session, and is confirmed or
+	// cancelled by any session giving Persist as its PersistID.
+	Persist string
+	// PersistID identifies the pending persistent commit the commit
+	// confirms, or follows up.
+	PersistID string
+}
+
+// Confirmer makes confirmed commits to the running datastore, rolling
+// them back to the configuration before the first of them unless they
+// are confirmed in time. If it has a ConfirmedStore, the pending commit
+// is stored so that a server restart during the confirmation window
+// restores it: a persistent commit remains pending until its deadline,
+// and any other is rolled back, its session having ended.
+type Confirmer struct {
+	running *Datastore
+	store   ConfirmedStore
+
+	mu      sync.Mutex
+	pending *ConfirmedCommit
+	timer   *time.Timer
+
+	// now returns the current time; replaced in tests
+	now func() time.Time
+}
+
+// NewConfirmer returns a Confirmer of commits to the running
+// datastore, restoring the commit pending in store, if not nil.
+func NewConfirmer(running *Datastore, store ConfirmedStore) (*Confirmer, error) {
+	c := &Confirmer{running: running, store: store, now: time.Now}
+	if err := c.restore(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Confirmer) restore() error {
+	if c.store == nil {
+		return nil
+	}
+	cc, err := c.store.Load()
+	if err != nil {
+		return errors.Wrap(err, "loading confirmed commit")
+	} else if cc == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pending = cc
+	if cc.PersistID == "" {
+		return c.rollback(0, "confirmed commit session ended")
+	} else if !c.now().Before(cc.Deadline) {
+		return c.rollback(0, "confirmed commit timed out")
+	}
+	c.timer = time.AfterFunc(cc.Deadline.Sub(c.now()), func() { c.expire(cc) })
+	return nil
+}
+
+// Pending returns the pending confirmed commit, or nil if there is
+// none.
+func (c *Confirmer) Pending() *ConfirmedCommit {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.pending
+}
+
+// Commit commits the change made by edit to the running datastore for
+// the session sid. A confirmed commit, or a follow-up confirmed commit
+// to a pending commit, sets the pending commit's deadline. Any other
+// commit confirms the pending commit, if any. Commits while a commit
+// is pending must be made by its session or, if it is persistent,
+// give its persist-id.
+func (c *Confirmer) Commit(sid session.ID, comment string, p ConfirmParams, edit func(root dom.Document) error) (*Snapshot, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.check(sid, p.PersistID); err != nil {
+		return nil, err
+	}
+	prior := c.pending
+	var prev dom.Document
+	snap, err := c.running.Update(sid, comment, func(root dom.Document) error {
+		// Update holds the writer lock, so this is the snapshot
+		// being changed
+		prev = c.running.Snapshot().Root
+		return edit(root)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !p.Confirmed {
+		return snap, c.clear()
+	}
+	cc := &ConfirmedCommit{Session: sid, PersistID: p.Persist, Rollback: prev}
+	if prior != nil {
+		// follow-up commits keep the configuration before the first
+		cc.Rollback = prior.Rollback
+	}
+	timeout := p.Timeout
+	if timeout <= 0 {
+		timeout = DefaultConfirmTimeout
+	}
+	cc.Deadline = c.now().Add(timeout)
+	if c.store != nil {
+		if err := c.store.Save(cc); err != nil {
+			// a commit which could not be stored would not be
+			// rolled back after a restart, so is not made
+			c.pending = cc
+			if rerr := c.rollback(sid, "confirmed commit not stored"); rerr != nil {
+				return nil, errors.Wrapf(rerr, "%v, rollback failed", err)
+			}
+			return nil, err
+		}
+	}
+	c.stop()
+	c.pending = cc
+	c.timer = time.AfterFunc(timeout, func() { c.expire(cc) })
+	return snap, nil
+}
+
+// Cancel rolls back the pending confirmed commit, for the session sid
+// giving the persist-id of a persistent commit, if not empty.
+func (c *Confirmer) Cancel(sid session.ID, persistID string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.pending == nil {
+		return ErrNoConfirmedCommit
+	} else if err := c.check(sid, persistID); err != nil {
+		return err
+	}
+	return c.rollback(sid, "confirmed commit cancelled")
+}
+
+// Release rolls back the pending confirmed commit if it was made by
+// the session sid and is not persistent. It is called when the
+// session ends.
+func (c *Confirmer) Release(sid session.ID) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cc := c.pending; cc == nil || cc.PersistID != "" || cc.Session != sid {
+		return nil
+	}
+	return c.rollback(0, "confirmed commit session ended")
+}
+
+// Stop stops the timer of the pending confirmed commit, if any, such
+// as when the server shuts down. A stored commit remains stored.
+func (c *Confirmer) Stop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stop()
+}
+
+// check returns an error if the session sid, giving the persistID,
+// may not confirm, follow up or cancel the pending commit.
+func (c *Confirmer) check(sid session.ID, persistID string) error {
+	cc := c.pending
+	switch {
+	case cc == nil && persistID != "":
+		return ErrNoConfirmedCommit
+	case cc == nil:
+		return nil
+	case cc.PersistID != "" && persistID != cc.PersistID:
+		if persistID == "" {
+			return ErrConfirmedCommitInUse
+		}
+		return ErrNoConfirmedCommit
+	case cc.PersistID == "" && persistID != "":
+		return ErrNoConfirmedCommit
+	case cc.PersistID == "" && cc.Session != sid:
+		return ErrConfirmedCommitInUse
+	}
+	return nil
+}
+
+// expire rolls back the commit cc if it is still pending once its
+// timer fires.
+func (c *Confirmer) expire(cc *ConfirmedCommit) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.pending == cc {
+		if err := c.rollback(0, "confirmed commit timed out"); err != nil {
+			log.Error(c.running.logger, "confirmed commit not rolled back", "session-id", cc.Session, "error", err)
+		} else {
+			log.Info(c.running.logger, "confirmed commit timed out", "session-id", cc.Session)
+		}
+	}
+}
+
+// rollback restores the running configuration before the pending
+// commit, which is no longer pending. The caller holds mu.
+func (c *Confirmer) rollback(sid session.ID, comment string) error {
+	rollback := c.pending.Rollback
+	if _, err := c.running.Update(sid, comment, func(root dom.Document) error {
+		for it := root.FirstChild(); it != nil; it = root.FirstChild() {
+			if err := root.RemoveChild(it); err != nil {
+				return err
+			}
+		}
+		for it := rollback.FirstChild(); it != nil; it = it.NextSibling() {
+			if it.NodeType() != dom.NodeTypeElement {
+				continue
+			}
+			if err := root.AppendChild(dom.CloneNode(it, true)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return errors.Wrap(err, "confirmed commit rollback failed")
+	}
+	return c.clear()
+}
+
+// clear ends the pending commit, if any. The caller holds mu.
+func (c *Confirmer) clear() error {
+	if c.pending == nil {
+		return nil
+	}
+	c.stop()
+	c.pending = nil
+	if c.store != nil {
+		return c.store.Clear()
+	}
+	return nil
+}
+
+// stop stops the pending commit's timer, if any. The caller holds mu.
+func (c *Confirmer) stop() {
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+}
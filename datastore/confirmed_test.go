@@ -0,0 +1,129 @@
+package datastore
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestConfirmer(t *testing.T) {
+	c := newTestCollection(t)
+	hostName := func(ds *Datastore) string {
+		if system := ds.Snapshot().Root.FirstChild(); system != nil {
+			return system.FirstChild().ChildValue()
+		}
+		return ""
+	}
+	running := New(Running, c)
+	if _, err := running.Update(0, "", setSystem("a")); err != nil {
+		t.Fatal(err)
+	}
+	cf, err := NewConfirmer(running, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := cf.Commit(1, "", ConfirmParams{Confirmed: true}, setSystem("b")); err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+	if _, err := cf.Commit(2, "", ConfirmParams{}, setSystem("c")); err != ErrConfirmedCommitInUse {
+		t.Errorf("Commit() by another session error = %v, want %v", err, ErrConfirmedCommitInUse)
+	}
+	if _, err := cf.Commit(1, "", ConfirmParams{Confirmed: true}, setSystem("c")); err != nil {
+		t.Fatalf("follow-up Commit() error = %v", err)
+	}
+	if err := cf.Release(1); err != nil || hostName(running) != "a" || cf.Pending() != nil {
+		t.Errorf("Release() = %v, host-name %q, want the configuration before the first commit", err, hostName(running))
+	}
+
+	if _, err := cf.Commit(1, "", ConfirmParams{Confirmed: true, Persist: "p1"}, setSystem("b")); err != nil {
+		t.Fatalf("persistent Commit() error = %v", err)
+	}
+	if err := cf.Release(1); err != nil || hostName(running) != "b" {
+		t.Errorf("Release() of a persistent commit = %v, host-name %q, want %q", err, hostName(running), "b")
+	}
+	if err := cf.Cancel(2, "p2"); err != ErrNoConfirmedCommit {
+		t.Errorf("Cancel() with the wrong persist-id error = %v, want %v", err, ErrNoConfirmedCommit)
+	}
+	if _, err := cf.Commit(2, "", ConfirmParams{PersistID: "p1"}, setSystem("c")); err != nil {
+		t.Fatalf("confirming Commit() error = %v", err)
+	}
+	if cf.Pending() != nil || hostName(running) != "c" {
+		t.Errorf("confirming Commit() left %+v pending, host-name %q", cf.Pending(), hostName(running))
+	}
+	if err := cf.Cancel(2, ""); err != ErrNoConfirmedCommit {
+		t.Errorf("Cancel() with no commit pending error = %v, want %v", err, ErrNoConfirmedCommit)
+	}
+
+	if _, err := cf.Commit(1, "", ConfirmParams{Confirmed: true, Timeout: 10 * time.Millisecond}, setSystem("d")); err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); cf.Pending() != nil; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("confirmed commit did not time out")
+		}
+	}
+	if hostName(running) != "c" {
+		t.Errorf("host-name after timeout = %q, want %q", hostName(running), "c")
+	}
+}
+
+func TestConfirmerRestart(t *testing.T) {
+	c := newTestCollection(t)
+	path := filepath.Join(t.TempDir(), "confirmed-commit.json")
+	start := func(value string) (*Datastore, *Confirmer) {
+		t.Helper()
+		running := New(Running, c)
+		if _, err := running.Update(0, "", setSystem(value)); err != nil {
+			t.Fatal(err)
+		}
+		cf, err := NewConfirmer(running, NewFileConfirmedStore(path))
+		if err != nil {
+			t.Fatalf("NewConfirmer() error = %v", err)
+		}
+		return running, cf
+	}
+	hostName := func(ds *Datastore) string { return ds.Snapshot().Root.FirstChild().FirstChild().ChildValue() }
+
+	_, cf := start("a")
+	if _, err := cf.Commit(1, "", ConfirmParams{Confirmed: true, Persist: "p1"}, setSystem("b")); err != nil {
+		t.Fatal(err)
+	}
+	cf.Stop()
+
+	// the restarted server loads the confirmed configuration
+	running, cf := start("b")
+	cc := cf.Pending()
+	if cc == nil || cc.PersistID != "p1" || cc.Session != 1 || time.Until(cc.Deadline) > DefaultConfirmTimeout {
+		t.Fatalf("Pending() after restart = %+v, want persist-id p1", cc)
+	}
+	if err := cf.Cancel(2, "p1"); err != nil {
+		t.Fatalf("Cancel() after restart error = %v", err)
+	}
+	if hostName(running) != "a" {
+		t.Errorf("host-name after Cancel() = %q, want %q", hostName(running), "a")
+	}
+
+	if _, err := cf.Commit(1, "", ConfirmParams{Confirmed: true}, setSystem("b")); err != nil {
+		t.Fatal(err)
+	}
+	cf.Stop()
+	// the session of a commit which is not persistent ended with the
+	// restart, so the commit is rolled back
+	running, cf = start("b")
+	if cf.Pending() != nil || hostName(running) != "a" {
+		t.Errorf("after restart, pending %+v, host-name %q, want none and %q", cf.Pending(), hostName(running), "a")
+	}
+
+	_, cf = start("a")
+	cf.now = func() time.Time { return time.Now().Add(-time.Hour) }
+	if _, err := cf.Commit(1, "", ConfirmParams{Confirmed: true, Persist: "p1"}, setSystem("b")); err != nil {
+		t.Fatal(err)
+	}
+	cf.Stop()
+	// the deadline passed while the server was stopped
+	running, cf = start("b")
+	if cf.Pending() != nil || hostName(running) != "a" {
+		t.Errorf("after restart, pending %+v, host-name %q, want none and %q", cf.Pending(), hostName(running), "a")
+	}
+}
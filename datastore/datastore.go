@@ -0,0 +1,282 @@
+package datastore
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/andaru/opr8/dom"
+	"github.com/andaru/opr8/log"
+	"github.com/andaru/opr8/metrics"
+	"github.com/andaru/opr8/modules"
+	"github.com/andaru/opr8/session"
+	"github.com/pkg/errors"
+)
+
+// Datastore is a named YANG datastore, such as "running", holding a
+// data tree for the modules of its collection.
+//
+// A Datastore supports any number of concurrent readers and a single
+// writer. Readers call Snapshot to obtain an immutable view of the
+// data tree, which remains valid and unchanged for as long as the
+// reader holds it, regardless of later commits. Writers call Update,
+// which applies an edit to a private copy of the tree and then
+// publishes the result as the new snapshot. Update calls are
+// serialized; a reader calling Snapshot sees either the tree before or
+// after a commit, never a partially applied edit.
+type Datastore struct {
+	name     string
+	modules  *modules.Collection
+	history  *History
+	readOnly bool
+	// validate is true if commits are validated using validators
+	validate   bool
+	validators *Validators
+	when       WhenEvaluator
+
+	// writer serializes updates and guards listeners; mu guards
+	// current
+	writer    sync.Mutex
+	listeners []func(prev, next *Snapshot)
+	mu        sync.RWMutex
+	current   *Snapshot
+
+	validationFailures uint64 // accessed atomically
+	metrics            metrics.Registry
+	logger             log.Logger
+}
+
+// Snapshot is an immutable view of a datastore's data tree.
+type Snapshot struct {
+	// Root is the data tree's document node. It must not be
+	// modified; use dom.CloneNode to obtain a copy for editing.
+	Root dom.Document
+	// Generation counts the commits made to the datastore, and is
+	// zero for the initial, empty tree.
+	Generation uint64
+	// Time is the time of the commit creating the snapshot.
+	Time time.Time
+	// Changes are the changes made by the commit in addition to its
+	// edit, such as the removal of nodes whose when conditions became
+	// false.
+	Changes []Change
+	// Session is the ID of the session which made the commit, or zero
+	// if the commit was not made by a session.
+	Session session.ID
+	// Comment is the commit comment.
+	Comment string
+
+	// tree statistics, computed on first use
+	sizeOnce sync.Once
+	nodes    int
+	bytes    int
+}
+
+// Option is a Datastore configuration option.
+type Option func(*Datastore)
+
+// WithHistory enables commit history, keeping up to size revisions
+// for rollback. See NewHistory.
+func WithHistory(size int) Option {
+	return func(ds *Datastore) { ds.history = NewHistory(size) }
+}
+
+// WithReadOnly makes the datastore read-only; Update and Rollback
+// return an error.
+func WithReadOnly() Option {
+	return func(ds *Datastore) { ds.readOnly = true }
+}
+
+// WithValidation enables validation of each commit made by Update.
+// Commits failing validation are rejected. The custom validators v
+// are used in addition to the standard checks; v may be nil.
+func WithValidation(v *Validators) Option {
+	return func(ds *Datastore) { ds.validate, ds.validators = true, v }
+}
+
+// WithWhenEvaluator sets the evaluator of when expressions used to
+// prune data nodes during commits, in place of EvalWhen.
+func WithWhenEvaluator(eval WhenEvaluator) Option {
+	return func(ds *Datastore) { ds.when = eval }
+}
+
+// WithMetrics reports the datastore's commits, failed commits and
+// validation failures, and the latency of commits made by Update,
+// labelled by the datastore name, with the registry r.
+func WithMetrics(r metrics.Registry) Option {
+	return func(ds *Datastore) { ds.metrics = metrics.OrDiscard(r) }
+}
+
+// WithLogger sets the logger of the datastore's commits, at
+// log.LevelDebug, and rollbacks, at log.LevelInfo. The logger adds the
+// datastore name to each message.
+func WithLogger(l log.Logger) Option {
+	return func(ds *Datastore) { ds.logger = l }
+}
+
+// New returns a new, empty datastore with the name and YANG module
+// collection provided.
+func New(name string, c *modules.Collection, options ...Option) *Datastore {
+	ds := &Datastore{
+		name:    name,
+		modules: c,
+		current: &Snapshot{Root: dom.NewDocument(nil), Time: time.Now()},
+		metrics: metrics.Discard(),
+	}
+	for _, option := range options {
+		option(ds)
+	}
+	ds.logger = log.OrNop(ds.logger).With("datastore", name)
+	return ds
+}
+
+// Name returns the datastore name.
+func (ds *Datastore) Name() string { return ds.name }
+
+// Modules returns the datastore's YANG module collection.
+func (ds *Datastore) Modules() *modules.Collection { return ds.modules }
+
+// ReadOnly returns true if the datastore is read-only.
+func (ds *Datastore) ReadOnly() bool { return ds.readOnly }
+
+// History returns the datastore's commit history, or nil if history
+// is not enabled.
+func (ds *Datastore) History() *History { return ds.history }
+
+// Snapshot returns the current snapshot of the data tree.
+func (ds *Datastore) Snapshot() *Snapshot {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	return ds.current
+}
+
+// Update calls edit with a copy of the current data tree and, if edit
+// returns no error, commits the edited tree as the new snapshot,
+// which is returned. Before the tree is validated, data nodes whose
+// when conditions are false are removed, as recorded in the
+// snapshot's Changes. The session ID and comment are recorded in the
+// commit history, if enabled. The edit function must not retain root
+// after it returns.
+func (ds *Datastore) Update(sid session.ID, comment string, edit func(root dom.Document) error) (*Snapshot, error) {
+	if ds.readOnly {
+		return nil, errors.Errorf("datastore %s is read-only", ds.name)
+	}
+	ds.writer.Lock()
+	defer ds.writer.Unlock()
+	start := time.Now()
+
+	root := dom.CloneNode(ds.Snapshot().Root, true).(dom.Document)
+	if err := edit(root); err != nil {
+		ds.failed(sid, err)
+		return nil, err
+	}
+	snap, err := ds.commit(root, sid, comment)
+	if err != nil {
+		return nil, err
+	}
+	metrics.ObserveSince(ds.metrics.Histogram("datastore_commit_seconds", "Latency of commits.", nil, "datastore", ds.name), start)
+	return snap, nil
+}
+
+// commit prunes the data nodes of root whose when conditions are
+// false, validates root if enabled, and records and publishes it as
+// the new snapshot. The caller must hold the writer lock.
+func (ds *Datastore) commit(root dom.Document, sid session.ID, comment string) (*Snapshot, error) {
+	changes, err := PruneWhen(root, ds.modules, ds.when)
+	if err != nil {
+		ds.failed(sid, err)
+		return nil, err
+	}
+	if ds.validate {
+		if err := ds.Validate(root).Err(); err != nil {
+			atomic.AddUint64(&ds.validationFailures, 1)
+			ds.metrics.Counter("datastore_validation_failures_total", "Commits rejected by validation.", "datastore", ds.name).Add(1)
+			ds.failed(sid, err)
+			return nil, err
+		}
+	}
+	if ds.history != nil {
+		ds.history.record(root, sid, comment)
+	}
+	return ds.publish(root, changes, sid, comment), nil
+}
+
+// failed counts and logs a commit by the session sid which failed with
+// the error err.
+func (ds *Datastore) failed(sid session.ID, err error) {
+	ds.metrics.Counter("datastore_commit_failures_total", "Commits failed.", "datastore", ds.name).Add(1)
+	log.Debug(ds.logger, "commit failed", "session-id", sid, "error", err)
+}
+
+// Listen registers f to be called with the previous and new snapshots
+// of each commit made by Update or Rollback, such as to notify clients
+// of the changes. Calls are made in commit order, before the commit
+// returns, and f must not update the datastore.
+func (ds *Datastore) Listen(f func(prev, next *Snapshot)) {
+	ds.writer.Lock()
+	defer ds.writer.Unlock()
+	ds.listeners = append(ds.listeners, f)
+}
+
+// Validate validates the data tree root against the datastore's
+// schema and validators. See Validate.
+func (ds *Datastore) Validate(root dom.Node) *ValidationReport {
+	return Validate(root, ds.modules, ds.validators)
+}
+
+// Rollback restores the configuration of the history revision n
+// commits before the latest as a new commit. As for Update, the
+// restored tree is pruned by its when conditions and, if enabled,
+// validated; the rollback fails if validation does. If comment is
+// empty, a comment naming the restored revision is used.
+func (ds *Datastore) Rollback(n int, sid session.ID, comment string) (*Snapshot, error) {
+	if ds.readOnly {
+		return nil, errors.Errorf("datastore %s is read-only", ds.name)
+	} else if ds.history == nil {
+		return nil, errors.Errorf("datastore %s has no commit history", ds.name)
+	}
+	ds.writer.Lock()
+	defer ds.writer.Unlock()
+
+	rev, err := ds.history.Revision(n)
+	if err != nil {
+		return nil, errors.Wrap(err, "rollback failed")
+	}
+	root, ok := dom.CloneNode(rev.Config, true).(dom.Document)
+	if !ok {
+		return nil, errors.Errorf("revision %d configuration is not a document", rev.ID)
+	}
+	if comment == "" {
+		comment = rollbackComment(rev)
+	}
+	log.Info(ds.logger, "rollback", "session-id", sid, "comment", comment)
+	snap, err := ds.commit(root, sid, comment)
+	if err != nil {
+		return nil, errors.Wrap(err, "rollback failed")
+	}
+	return snap, nil
+}
+
+// publish makes root the current snapshot's tree, committed by the
+// session sid, and calls the listeners. The caller must hold the
+// writer lock.
+func (ds *Datastore) publish(root dom.Document, changes []Change, sid session.ID, comment string) *Snapshot {
+	ds.mu.Lock()
+	prev := ds.current
+	next := &Snapshot{
+		Root:       root,
+		Generation: prev.Generation + 1,
+		Time:       time.Now(),
+		Changes:    changes,
+		Session:    sid,
+		Comment:    comment,
+	}
+	ds.current = next
+	ds.mu.Unlock()
+	ds.metrics.Counter("datastore_commits_total", "Commits made.", "datastore", ds.name).Add(1)
+	log.Debug(ds.logger, "commit", "generation", next.Generation, "session-id", sid, "comment", comment)
+	for _, f := range ds.listeners {
+		f(prev, next)
+	}
+	return next
+}
@@ -0,0 +1,174 @@
+package datastore
+
+import (
+	"bytes"
+	stdlog "log"
+	"strconv"
+	"sync"
+	"testing"
+
+	xml "github.com/andaru/flexml"
+	"github.com/andaru/opr8/dom"
+	"github.com/andaru/opr8/log"
+	"github.com/openconfig/goyang/pkg/yang"
+	"github.com/pkg/errors"
+)
+
+// setSystem replaces the configuration with a system container whose
+// host-name and domain-name-servers leaves both have the value v.
+func setSystem(v string) func(root dom.Document) error {
+	return func(root dom.Document) error {
+		for it := root.FirstChild(); it != nil; it = root.FirstChild() {
+			_ = root.RemoveChild(it)
+		}
+		system := dom.CreateElement(xml.StartElement{Name: xml.Name{Space: "urn:mod1", Local: "system"}})
+		for _, local := range []string{"host-name", "domain-name-servers"} {
+			leaf := dom.CreateElement(xml.StartElement{Name: xml.Name{Space: "urn:mod1", Local: local}})
+			_ = leaf.AppendChild(dom.CreateText(xml.CharData(v)))
+			_ = system.AppendChild(leaf)
+		}
+		return root.AppendChild(system)
+	}
+}
+
+func TestDatastoreUpdate(t *testing.T) {
+	ds := New("running", newTestCollection(t), WithHistory(10))
+	initial := ds.Snapshot()
+	if initial.Generation != 0 || initial.Root.FirstChild() != nil {
+		t.Fatalf("initial snapshot = %+v, want empty generation 0", initial)
+	}
+
+	snap, err := ds.Update(1, "set a", setSystem("a"))
+	if err != nil {
+		t.Fatalf("Update() error = %v, wantErr false", err)
+	}
+	if snap.Generation != 1 || ds.Snapshot() != snap {
+		t.Errorf("Update() generation = %d, want 1 and current", snap.Generation)
+	}
+	if initial.Root.FirstChild() != nil {
+		t.Errorf("initial snapshot modified by Update()")
+	}
+
+	wantErr := errors.New("edit failed")
+	if _, err := ds.Update(1, "", func(root dom.Document) error {
+		_ = setSystem("b")(root)
+		return wantErr
+	}); err != wantErr {
+		t.Errorf("Update() error = %v, want %v", err, wantErr)
+	}
+	if got := ds.Snapshot(); got != snap || got.Root.FirstChild().FirstChild().ChildValue() != "a" {
+		t.Errorf("failed Update() changed the current snapshot")
+	}
+
+	if _, err := ds.Update(2, "set b", setSystem("b")); err != nil {
+		t.Fatalf("Update() error = %v, wantErr false", err)
+	}
+	rolled, err := ds.Rollback(1, 2, "")
+	if err != nil {
+		t.Fatalf("Rollback() error = %v, wantErr false", err)
+	}
+	if rolled.Generation != 3 || rolled.Root.FirstChild().FirstChild().ChildValue() != "a" {
+		t.Errorf("Rollback() = generation %d value %q, want 3 %q",
+			rolled.Generation, rolled.Root.FirstChild().FirstChild().ChildValue(), "a")
+	}
+	if _, err := New("candidate", nil).Rollback(0, 0, ""); err == nil {
+		t.Errorf("Rollback() without history error = nil, wantErr true")
+	}
+}
+
+func TestDatastoreRollback_validation(t *testing.T) {
+	v := NewValidators()
+	ds := New(Running, newTestCollection(t), WithHistory(10), WithValidation(v))
+	for _, value := range []string{"a", "b"} {
+		if _, err := ds.Update(1, "", setSystem(value)); err != nil {
+			t.Fatalf("Update() error = %v, wantErr false", err)
+		}
+	}
+	v.Register("/module1/system/host-name", func(n dom.Node, _ *yang.Entry) error {
+		if n.ChildValue() == "a" {
+			return errors.New("host-name a is retired")
+		}
+		return nil
+	})
+
+	if _, err := ds.Rollback(1, 2, ""); err == nil {
+		t.Fatal("Rollback() of an invalid revision error = nil, wantErr true")
+	}
+	if snap := ds.Snapshot(); snap.Generation != 2 || snap.Root.FirstChild().FirstChild().ChildValue() != "b" {
+		t.Errorf("failed Rollback() changed the current snapshot")
+	}
+	if got := ds.History().Len(); got != 2 {
+		t.Errorf("History().Len() = %d after a failed Rollback(), want 2", got)
+	}
+	if got := ds.Stats().ValidationFailures; got != 1 {
+		t.Errorf("Stats().ValidationFailures = %d, want 1", got)
+	}
+}
+
+func TestDatastoreConcurrentReaders(t *testing.T) {
+	ds := New("running", newTestCollection(t))
+	const commits = 200
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				snap := ds.Snapshot()
+				system := snap.Root.FirstChild()
+				if system == nil {
+					continue
+				}
+				a := system.FirstChild().ChildValue()
+				b := system.LastChild().ChildValue()
+				if a != b || a != strconv.FormatUint(snap.Generation, 10) {
+					t.Errorf("generation %d snapshot is inconsistent: %q, %q", snap.Generation, a, b)
+					return
+				}
+			}
+		}()
+	}
+
+	for i := 1; i <= commits; i++ {
+		if _, err := ds.Update(0, "", setSystem(strconv.Itoa(i))); err != nil {
+			t.Fatalf("Update() error = %v, wantErr false", err)
+		}
+	}
+	close(done)
+	wg.Wait()
+	if got := ds.Snapshot().Generation; got != commits {
+		t.Errorf("final generation = %d, want %d", got, commits)
+	}
+}
+
+func TestDatastoreLogger(t *testing.T) {
+	var b bytes.Buffer
+	ds := New(Running, newTestCollection(t), WithHistory(2), WithLogger(log.NewStd(stdlog.New(&b, "", 0), log.LevelDebug)))
+	if _, err := ds.Update(1, "edit-config", setSystem("a")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ds.Update(2, "", func(dom.Document) error { return errors.New("bad edit") }); err == nil {
+		t.Fatal("Update() error = nil, want an error")
+	}
+	if _, err := ds.Update(1, "edit-config", setSystem("b")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ds.Rollback(1, 3, ""); err != nil {
+		t.Fatal(err)
+	}
+	want := "debug commit datastore=running generation=1 session-id=1 comment=edit-config\n" +
+		"debug commit failed datastore=running session-id=2 error=bad edit\n" +
+		"debug commit datastore=running generation=2 session-id=1 comment=edit-config\n" +
+		"info rollback datastore=running session-id=3 comment=rollback to revision 1\n" +
+		"debug commit datastore=running generation=3 session-id=3 comment=rollback to revision 1\n"
+	if b.String() != want {
+		t.Errorf("logged\n%s\nwant\n%s", b.String(), want)
+	}
+}
@@ -0,0 +1,862 @@
+/*
+Package datastoretest generates random data trees for testing the
+datastore package and the layers above it.
+
+A Generator makes data trees valid for the schema of a module
+collection: leaf values are of their types, with their ranges,
+lengths, patterns and members, list entries have unique keys, lists
+and leaf-lists have between their min-elements and max-elements
+entries, and mandatory nodes and one case of each choice are present.
+The trees may fuzz the round trip of the XML and JSON encodings, or
+seed benchmarks with large documents:
+
+	g := datastoretest.NewGenerator(c, datastoretest.WithSeed(seed), datastoretest.WithMaxEntries(1000))
+	doc, err := g.Document()
+
+Leafref values are those of the leaves their paths select, once the
+rest of the tree is made, and instance-identifiers refer to top-level
+data nodes. The when, must and unique statements are not evaluated:
+optional nodes with when statements are not generated, and other
+constraints may not hold.
+*/
+package datastoretest
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"math/rand"
+	"regexp"
+	"regexp/syntax"
+	"sort"
+	"strings"
+
+	xml "github.com/andaru/flexml"
+	"github.com/andaru/opr8/datastore"
+	"github.com/andaru/opr8/dom"
+	"github.com/andaru/opr8/modules"
+	"github.com/openconfig/goyang/pkg/yang"
+	"github.com/pkg/errors"
+)
+
+// Option is a constructor option for NewGenerator.
+type Option func(*Generator)
+
+// WithSeed is an option seeding the Generator's random source, so it
+// generates the same trees each time. The seed is 1 by default.
+func WithSeed(seed int64) Option {
+	return func(g *Generator) { g.r = rand.New(rand.NewSource(seed)) }
+}
+
+// WithMaxEntries is an option setting the largest number of entries
+// generated for a list or leaf-list, 3 by default, unless its
+// min-elements is larger.
+func WithMaxEntries(n int) Option {
+	return func(g *Generator) { g.maxEntries = n }
+}
+
+// WithOptional is an option setting the probability, from 0 to 1, of
+// generating each optional node, 0.5 by default.
+func WithOptional(p float64) Option {
+	return func(g *Generator) { g.optional = p }
+}
+
+// WithConfigOnly is an option generating configuration only, omitting
+// the nodes with config false.
+func WithConfigOnly() Option {
+	return func(g *Generator) { g.configOnly = true }
+}
+
+// Generator generates random data trees of the schema of a module
+// collection. It is not safe for concurrent use.
+type Generator struct {
+	c          *modules.Collection
+	r          *rand.Rand
+	maxEntries int
+	optional   float64
+	configOnly bool
+
+	// refs are the leafref and instance-identifier leaves whose values
+	// are set once the tree is made
+	refs []reference
+}
+
+// reference is a leaf, or leaf-list entry, whose value refers to other
+// data nodes.
+type reference struct {
+	n dom.Node
+	e *yang.Entry
+	t modules.ResolvedType
+}
+
+// key returns true if the reference is a list key.
+func (ref reference) key() bool { return listKeys(ref.e.Parent)[ref.e.Name] }
+
+// unique returns true if no other entry of the leaf-list, or other
+// entry of the list of the key, has the value.
+func (ref reference) unique(value string) bool {
+	parent := ref.n.Parent()
+	if parent == nil {
+		return true
+	}
+	var others []dom.Node
+	if ref.e.IsLeafList() {
+		for it := parent.FirstChild(); it != nil; it = it.NextSibling() {
+			if it != ref.n && it.Name() == ref.n.Name() {
+				others = append(others, it)
+			}
+		}
+	}
+	if grand := parent.Parent(); grand != nil && ref.key() {
+		for it := grand.FirstChild(); it != nil; it = it.NextSibling() {
+			if it == parent || it.Name() != parent.Name() {
+				continue
+			}
+			if key := it.ChildByName(ref.n.Name()); key != nil {
+				others = append(others, key)
+			}
+		}
+	}
+	for _, it := range others {
+		if it.ChildValue() == value {
+			return false
+		}
+	}
+	return true
+}
+
+// NewGenerator returns a new Generator of data trees of the schema of
+// the processed collection c.
+func NewGenerator(c *modules.Collection, options ...Option) *Generator {
+	g := &Generator{c: c, r: rand.New(rand.NewSource(1)), maxEntries: 3, optional: 0.5}
+	for _, option := range options {
+		option(g)
+	}
+	return g
+}
+
+// Document returns a new data tree with the top-level data nodes of
+// the modules of the collection.
+func (g *Generator) Document() (dom.Document, error) {
+	doc := dom.NewDocument(nil)
+	var entries []*yang.Entry
+	err := g.c.IterLatest(func(mod *yang.Module) error {
+		e, err := g.c.ModuleEntry(mod.Name)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, children(e)...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if err := g.node(doc, e, false); err != nil {
+			return nil, err
+		}
+	}
+	if err := g.resolve(); err != nil {
+		return nil, err
+	}
+	for it := doc.FirstChild(); it != nil; it = it.NextSibling() {
+		if e, err := g.c.RootEntry(it.Name()); err == nil {
+			_ = datastore.SortSchemaOrder(it, g.c, e)
+		}
+	}
+	return doc, nil
+}
+
+// Generate appends the instances of the schema node e generated to
+// parent: a container, if mandatory or chosen, the entries of a list
+// or leaf-list, or a leaf.
+func (g *Generator) Generate(parent dom.Node, e *yang.Entry) error {
+	last := parent.LastChild()
+	if err := g.node(parent, e, false); err != nil {
+		return err
+	}
+	if err := g.resolve(); err != nil {
+		return err
+	}
+	it := parent.FirstChild()
+	if last != nil {
+		it = last.NextSibling()
+	}
+	for ; it != nil; it = it.NextSibling() {
+		// the instances of choices are those of their cases' nodes
+		if ce := g.c.DataChild(e.Parent, it.Name().Local); ce != nil {
+			_ = datastore.SortSchemaOrder(it, g.c, ce)
+		}
+	}
+	return nil
+}
+
+// node appends the instances of the data node, choice or case e to
+// parent, or none if it is optional and not chosen, unless required.
+func (g *Generator) node(parent dom.Node, e *yang.Entry, required bool) error {
+	if g.configOnly && e.ReadOnly() || e.RPC != nil {
+		return nil
+	}
+	required = required || mandatory(e)
+	switch {
+	case e.Kind == yang.ChoiceEntry:
+		cases := children(e)
+		if len(cases) == 0 || !required && !g.chosen(e) {
+			return nil
+		}
+		c := cases[g.r.Intn(len(cases))]
+		if c.Kind != yang.CaseEntry {
+			// a shorthand case
+			return g.node(parent, c, true)
+		}
+		for _, ce := range children(c) {
+			if err := g.node(parent, ce, false); err != nil {
+				return err
+			}
+		}
+		return nil
+	case e.IsList(), e.IsLeafList():
+		return g.entries(parent, e)
+	case e.Kind == yang.DirectoryEntry:
+		if !required && !needed(e) && !g.chosen(e) {
+			return nil
+		}
+		container := element(e)
+		if err := g.children(container, e); err != nil {
+			return err
+		}
+		if container.FirstChild() == nil && statementArg(e, "presence") == "" {
+			return nil
+		}
+		return parent.AppendChild(container)
+	case e.Kind == yang.LeafEntry:
+		if !required && !g.chosen(e) {
+			return nil
+		}
+		return g.leaf(parent, e, required)
+	}
+	return nil
+}
+
+// chosen returns true if the optional node e is to be generated.
+func (g *Generator) chosen(e *yang.Entry) bool {
+	if statementArg(e, "when") != "" {
+		return false
+	}
+	return g.r.Float64() < g.optional
+}
+
+// children appends the children of the schema node e to n.
+func (g *Generator) children(n dom.Node, e *yang.Entry) error {
+	keys := listKeys(e)
+	for _, ce := range children(e) {
+		if err := g.node(n, ce, keys[ce.Name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// entries appends the entries of the list or leaf-list e to parent.
+func (g *Generator) entries(parent dom.Node, e *yang.Entry) error {
+	min, max := cardinality(e)
+	if max < 0 || max > min+g.maxEntries {
+		max = min + g.maxEntries
+	}
+	n := min + g.r.Intn(max-min+1)
+	// seen are the key values, or values, of the entries
+	seen := map[string]bool{}
+	for i, tries := 0, 0; i < n && tries < 10*n; tries++ {
+		var entry dom.Element
+		if e.IsLeafList() {
+			entry = element(e)
+			value, err := g.value(entry, e, modules.ResolveType(e))
+			if err != nil {
+				return err
+			}
+			if value != "" {
+				// references are made unique by resolve
+				if seen[value] {
+					continue
+				}
+				seen[value] = true
+				_ = entry.AppendChild(dom.CreateText(xml.CharData(value)))
+			}
+		} else {
+			entry = element(e)
+			if err := g.children(entry, e); err != nil {
+				return err
+			}
+			key := keyValues(entry, e)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+		}
+		if err := parent.AppendChild(entry); err != nil {
+			return err
+		}
+		i++
+	}
+	return nil
+}
+
+// leaf appends the leaf e to parent. Leaves whose value cannot be
+// generated are omitted, unless required.
+func (g *Generator) leaf(parent dom.Node, e *yang.Entry, required bool) error {
+	leaf := element(e)
+	t := modules.ResolveType(e)
+	if t.Kind == yang.Yempty {
+		return parent.AppendChild(leaf)
+	}
+	value, err := g.value(leaf, e, t)
+	switch {
+	case err != nil && required:
+		return err
+	case err != nil:
+		return nil
+	case value != "":
+		_ = leaf.AppendChild(dom.CreateText(xml.CharData(value)))
+	}
+	return parent.AppendChild(leaf)
+}
+
+// value returns a random value of the type t of the leaf or leaf-list
+// entry n, of schema node e. The values of references are set later,
+// by resolve, and are the empty string.
+func (g *Generator) value(n dom.Node, e *yang.Entry, t modules.ResolvedType) (string, error) {
+	switch t.Kind {
+	case yang.Yleafref, yang.YinstanceIdentifier:
+		g.refs = append(g.refs, reference{n: n, e: e, t: t})
+		return "", nil
+	case yang.Yunion:
+		var members []modules.ResolvedType
+		for _, m := range t.Members {
+			switch m.Kind {
+			case yang.Yleafref, yang.YinstanceIdentifier, yang.Yempty:
+			default:
+				members = append(members, m)
+			}
+		}
+		if len(members) == 0 {
+			return "", errors.Errorf("%s: no union member to generate", e.Path())
+		}
+		return g.value(n, e, members[g.r.Intn(len(members))])
+	case yang.Yint8, yang.Yint16, yang.Yint32, yang.Yint64,
+		yang.Yuint8, yang.Yuint16, yang.Yuint32, yang.Yuint64:
+		lo, hi := intBounds(t.Kind)
+		v, err := g.number(t.Range, lo, hi, 0)
+		if err != nil {
+			return "", errors.Wrap(err, e.Path())
+		}
+		return v.String(), nil
+	case yang.Ydecimal64:
+		fd := t.FractionDigits
+		v, err := g.number(t.Range, big.NewInt(-1<<63), big.NewInt(1<<63-1), fd)
+		if err != nil {
+			return "", errors.Wrap(err, e.Path())
+		}
+		return formatDecimal(v, fd), nil
+	case yang.Ybool:
+		return fmt.Sprint(g.r.Intn(2) == 1), nil
+	case yang.Yenum:
+		if t.Enum == nil || len(t.Enum.Names()) == 0 {
+			return "", errors.Errorf("%s: enumeration has no members", e.Path())
+		}
+		names := t.Enum.Names()
+		return names[g.r.Intn(len(names))], nil
+	case yang.Ybits:
+		var bits []string
+		if t.Bit != nil {
+			for _, name := range t.Bit.Names() {
+				if g.r.Intn(2) == 1 {
+					bits = append(bits, name)
+				}
+			}
+			sort.Slice(bits, func(i, j int) bool { return t.Bit.Value(bits[i]) < t.Bit.Value(bits[j]) })
+		}
+		return strings.Join(bits, " "), nil
+	case yang.Ybinary:
+		length, err := g.length(t.Length, 16)
+		if err != nil {
+			return "", errors.Wrap(err, e.Path())
+		}
+		b := make([]byte, length)
+		_, _ = g.r.Read(b)
+		return base64.StdEncoding.EncodeToString(b), nil
+	case yang.Yidentityref:
+		if t.IdentityBase == nil {
+			return "", errors.Errorf("%s: identityref has no base", e.Path())
+		}
+		ids := g.c.Identities(identityName(t.IdentityBase))
+		if len(ids) == 0 {
+			return "", errors.Errorf("%s: no identities derived from %s", e.Path(), t.IdentityBase.Name)
+		}
+		return ids[g.r.Intn(len(ids))].String(), nil
+	case yang.Ystring:
+		s, err := g.string(t)
+		return s, errors.Wrap(err, e.Path())
+	}
+	return "", errors.Errorf("%s: cannot generate a value of type %s", e.Path(), t.Kind)
+}
+
+// resolve sets the values of the references of the tree generated, or
+// removes them if they have no value and are not required.
+func (g *Generator) resolve() error {
+	refs := g.refs
+	g.refs = nil
+	for _, ref := range refs {
+		var values []string
+		if ref.t.Kind == yang.Yleafref {
+			values = leafrefValues(ref.n, ref.t.Path)
+		} else {
+			values = g.instances(ref.n)
+		}
+		var value string
+		for _, i := range g.r.Perm(len(values)) {
+			if ref.unique(values[i]) {
+				value = values[i]
+				break
+			}
+		}
+		if t := modules.ResolveType(ref.t.Target); value == "" && !ref.optional() && ref.t.Target != nil && t.Kind != yang.Yleafref {
+			// nothing to refer to, so a value of the target's type
+			if v, err := g.value(ref.n, ref.t.Target, t); err == nil && ref.unique(v) {
+				value = v
+			}
+		}
+		if value == "" && ref.optional() {
+			if parent := ref.n.Parent(); parent != nil {
+				_ = parent.RemoveChild(ref.n)
+			}
+			continue
+		}
+		if value == "" {
+			return errors.Errorf("%s: no value to refer to", ref.e.Path())
+		}
+		_ = ref.n.AppendChild(dom.CreateText(xml.CharData(value)))
+	}
+	return nil
+}
+
+// optional returns true if the reference may be removed from the
+// tree.
+func (ref reference) optional() bool {
+	if ref.e.IsLeafList() {
+		min, _ := cardinality(ref.e)
+		return min == 0
+	}
+	return !mandatory(ref.e) && !ref.key()
+}
+
+// instances returns the instance-identifiers of the top-level elements
+// of the tree of n.
+func (g *Generator) instances(n dom.Node) []string {
+	var ids []string
+	for it := root(n).FirstChild(); it != nil; it = it.NextSibling() {
+		if it.NodeType() != dom.NodeTypeElement {
+			continue
+		}
+		if mod, err := g.c.ModuleByNamespace(it.Name().Space); err == nil {
+			ids = append(ids, "/"+mod.Name+":"+it.Name().Local)
+		}
+	}
+	return ids
+}
+
+// number returns a random number of a part of the range r, or of lo
+// to hi if r is empty, scaled by 10^fd.
+func (g *Generator) number(r yang.YangRange, lo, hi *big.Int, fd int) (*big.Int, error) {
+	min, max := lo, hi
+	if len(r) > 0 {
+		part := r[g.r.Intn(len(r))]
+		min, max = bigNumber(part.Min, lo, hi, fd), bigNumber(part.Max, lo, hi, fd)
+	}
+	if max.Cmp(min) < 0 {
+		return nil, errors.Errorf("empty range %s", r)
+	}
+	span := new(big.Int).Sub(max, min)
+	span.Add(span, big.NewInt(1))
+	v := new(big.Int).Rand(g.r, span)
+	return v.Add(v, min), nil
+}
+
+// length returns a random length of a part of the length restriction
+// r, up to extra beyond its minimum, or from 1 to extra if r is empty.
+func (g *Generator) length(r yang.YangRange, extra int) (int, error) {
+	if len(r) == 0 {
+		return 1 + g.r.Intn(extra), nil
+	}
+	part := r[g.r.Intn(len(r))]
+	zero := big.NewInt(0)
+	min := bigNumber(part.Min, zero, zero, 0).Int64()
+	max := bigNumber(part.Max, zero, big.NewInt(min+int64(extra)), 0).Int64()
+	if max > min+int64(extra) {
+		max = min + int64(extra)
+	}
+	if max < min {
+		return 0, errors.Errorf("empty length %s", r)
+	}
+	return int(min + g.r.Int63n(max-min+1)), nil
+}
+
+// alphabet are the characters of strings without patterns.
+const alphabet = "abcdefghijklmnopqrstuvwxyz0123456789-"
+
+// string returns a random string of the type t, matching its patterns
+// and of a length it allows.
+func (g *Generator) string(t modules.ResolvedType) (string, error) {
+	var res []*regexp.Regexp
+	var gen *syntax.Regexp
+	for _, p := range t.Patterns {
+		expr := fmt.Sprintf("^(?:%s)$", strings.Replace(p, `$`, `\$`, -1))
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			// unsupported XSD regular expression syntax is not
+			// validated either
+			continue
+		}
+		res = append(res, re)
+		if gen == nil {
+			if gen, err = syntax.Parse(expr, syntax.Perl); err == nil {
+				gen = gen.Simplify()
+			}
+		}
+	}
+	for tries := 0; tries < 100; tries++ {
+		var s string
+		if gen != nil {
+			var b strings.Builder
+			g.regexp(&b, gen)
+			s = b.String()
+		} else {
+			n, err := g.length(t.Length, 8)
+			if err != nil {
+				return "", err
+			}
+			runes := make([]byte, n)
+			for i := range runes {
+				runes[i] = alphabet[g.r.Intn(len(alphabet))]
+			}
+			s = string(runes)
+		}
+		if validString(s, t.Length, res) {
+			return s, nil
+		}
+	}
+	return "", errors.Errorf("no string of length %s matching %q generated", t.Length, t.Patterns)
+}
+
+// validString returns true if s is of a length allowed by r and
+// matches the regular expressions res.
+func validString(s string, r yang.YangRange, res []*regexp.Regexp) bool {
+	if len(r) > 0 {
+		n := yang.FromInt(int64(len([]rune(s))))
+		if !r.Contains(yang.YangRange{{Min: n, Max: n}}) {
+			return false
+		}
+	}
+	for _, re := range res {
+		if !re.MatchString(s) {
+			return false
+		}
+	}
+	return true
+}
+
+// maxRepeat is the largest number of repetitions of unbounded
+// regular expression repeats.
+const maxRepeat = 5
+
+// regexp writes a random string matching re to b.
+func (g *Generator) regexp(b *strings.Builder, re *syntax.Regexp) {
+	switch re.Op {
+	case syntax.OpLiteral:
+		b.WriteString(string(re.Rune))
+	case syntax.OpCharClass:
+		b.WriteRune(g.class(re.Rune))
+	case syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		b.WriteByte(alphabet[g.r.Intn(len(alphabet))])
+	case syntax.OpCapture:
+		g.regexp(b, re.Sub[0])
+	case syntax.OpStar, syntax.OpPlus, syntax.OpQuest, syntax.OpRepeat:
+		min, max := re.Min, re.Max
+		switch re.Op {
+		case syntax.OpStar:
+			min, max = 0, maxRepeat
+		case syntax.OpPlus:
+			min, max = 1, maxRepeat
+		case syntax.OpQuest:
+			min, max = 0, 1
+		}
+		if max < 0 {
+			max = min + maxRepeat
+		}
+		for n := min + g.r.Intn(max-min+1); n > 0; n-- {
+			g.regexp(b, re.Sub[0])
+		}
+	case syntax.OpConcat:
+		for _, sub := range re.Sub {
+			g.regexp(b, sub)
+		}
+	case syntax.OpAlternate:
+		g.regexp(b, re.Sub[g.r.Intn(len(re.Sub))])
+	}
+}
+
+// class returns a random rune of the character class ranges, printable
+// ASCII other than space if it has any.
+func (g *Generator) class(ranges []rune) rune {
+	var ascii []rune
+	for i := 0; i+1 < len(ranges); i += 2 {
+		lo, hi := ranges[i], ranges[i+1]
+		if lo < '!' {
+			lo = '!'
+		}
+		if hi > '~' {
+			hi = '~'
+		}
+		for r := lo; r <= hi; r++ {
+			ascii = append(ascii, r)
+		}
+	}
+	if len(ascii) > 0 {
+		return ascii[g.r.Intn(len(ascii))]
+	}
+	if len(ranges) < 2 {
+		return 'a'
+	}
+	i := 2 * g.r.Intn(len(ranges)/2)
+	return ranges[i] + rune(g.r.Intn(int(ranges[i+1]-ranges[i]+1)))
+}
+
+// leafrefValues returns the values of the leaves selected by the
+// leafref path from the leaf n, ignoring its predicates.
+func leafrefValues(n dom.Node, path string) []string {
+	path = leafrefPredicate.ReplaceAllString(path, "")
+	nodes := []dom.Node{n}
+	if strings.HasPrefix(path, "/") {
+		nodes = []dom.Node{root(n)}
+	}
+	for _, step := range strings.Split(strings.Trim(path, "/"), "/") {
+		step = strings.TrimSpace(step)
+		if i := strings.IndexByte(step, ':'); i >= 0 {
+			step = step[i+1:]
+		}
+		var next []dom.Node
+		for _, it := range nodes {
+			switch step {
+			case "..":
+				if p := it.Parent(); p != nil {
+					next = append(next, p)
+				}
+			case ".", "":
+				next = append(next, it)
+			default:
+				for child := it.FirstChild(); child != nil; child = child.NextSibling() {
+					if child.NodeType() == dom.NodeTypeElement && child.Name().Local == step {
+						next = append(next, child)
+					}
+				}
+			}
+		}
+		nodes = next
+	}
+	var values []string
+	for _, it := range nodes {
+		if v := it.ChildValue(); v != "" && it != n {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+var leafrefPredicate = regexp.MustCompile(`\[[^\]]*\]`)
+
+// root returns the root of the tree of n.
+func root(n dom.Node) dom.Node {
+	for n.Parent() != nil {
+		n = n.Parent()
+	}
+	return n
+}
+
+// element returns a new element of the data node e.
+func element(e *yang.Entry) dom.Element {
+	return dom.CreateElement(xml.StartElement{Name: xml.Name{Space: e.Namespace().Name, Local: e.Name}})
+}
+
+// children returns the data node, choice and case children of e, keys
+// first and the others sorted by name, so trees are generated in the
+// same order each time.
+func children(e *yang.Entry) []*yang.Entry {
+	keys := listKeys(e)
+	var entries []*yang.Entry
+	for _, ce := range e.Dir {
+		switch ce.Kind {
+		case yang.LeafEntry, yang.DirectoryEntry, yang.ChoiceEntry, yang.CaseEntry:
+			entries = append(entries, ce)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if a, b := keys[entries[i].Name], keys[entries[j].Name]; a != b {
+			return a
+		}
+		return entries[i].Name < entries[j].Name
+	})
+	return entries
+}
+
+// listKeys returns the set of the key names of the list e.
+func listKeys(e *yang.Entry) map[string]bool {
+	keys := map[string]bool{}
+	if e != nil && e.IsList() {
+		for _, key := range strings.Fields(e.Key) {
+			keys[key] = true
+		}
+	}
+	return keys
+}
+
+// keyValues returns the key values of the list entry n of the list
+// e, or a string unique to n if they are not yet known.
+func keyValues(n dom.Node, e *yang.Entry) string {
+	var values []string
+	for _, key := range strings.Fields(e.Key) {
+		leaf := n.ChildByName(xml.Name{Space: n.Name().Space, Local: key})
+		if leaf == nil || leaf.FirstChild() == nil {
+			// keyless, or a reference made unique by resolve
+			return fmt.Sprintf("%p", n)
+		}
+		values = append(values, leaf.ChildValue())
+	}
+	return strings.Join(values, "\x00")
+}
+
+// cardinality returns the min-elements and max-elements of the list or
+// leaf-list e, the latter -1 if unbounded.
+func cardinality(e *yang.Entry) (min, max int) {
+	max = -1
+	if e.ListAttr == nil {
+		return 0, max
+	}
+	if v := e.ListAttr.MinElements; v != nil {
+		_, _ = fmt.Sscan(v.Name, &min)
+	}
+	if v := e.ListAttr.MaxElements; v != nil && v.Name != "unbounded" {
+		_, _ = fmt.Sscan(v.Name, &max)
+	}
+	return min, max
+}
+
+// needed returns true if the container e must exist: it is not a
+// presence container, and has a mandatory leaf or choice, a list or
+// leaf-list with min-elements, or such a container.
+func needed(e *yang.Entry) bool {
+	if statementArg(e, "presence") != "" {
+		return false
+	}
+	for _, ce := range e.Dir {
+		switch {
+		case ce.IsList(), ce.IsLeafList():
+			if min, _ := cardinality(ce); min > 0 {
+				return true
+			}
+		case ce.Kind == yang.DirectoryEntry:
+			if needed(ce) {
+				return true
+			}
+		case mandatory(ce):
+			return true
+		}
+	}
+	return false
+}
+
+// mandatory returns true if the leaf or choice e is mandatory.
+func mandatory(e *yang.Entry) bool {
+	return e.Mandatory == yang.TSTrue || statementArg(e, "mandatory") == "true"
+}
+
+// statementArg returns the argument of the first substatement of the
+// statement defining e with the keyword, or the empty string.
+func statementArg(e *yang.Entry, keyword string) string {
+	if e.Node == nil || e.Node.Statement() == nil {
+		return ""
+	}
+	for _, s := range e.Node.Statement().SubStatements() {
+		if s.Keyword == keyword {
+			return s.Argument
+		}
+	}
+	return ""
+}
+
+// identityName returns the qualified name of the identity id.
+func identityName(id *yang.Identity) string {
+	mod := yang.RootNode(id)
+	if mod == nil {
+		return id.Name
+	}
+	name := mod.Name
+	if mod.BelongsTo != nil {
+		name = mod.BelongsTo.Name
+	}
+	return name + ":" + id.Name
+}
+
+// intBounds returns the smallest and largest values of the integer
+// type kind k.
+func intBounds(k yang.TypeKind) (lo, hi *big.Int) {
+	bits := map[yang.TypeKind]uint{
+		yang.Yint8: 8, yang.Yint16: 16, yang.Yint32: 32, yang.Yint64: 64,
+		yang.Yuint8: 8, yang.Yuint16: 16, yang.Yuint32: 32, yang.Yuint64: 64,
+	}[k]
+	one := big.NewInt(1)
+	switch k {
+	case yang.Yuint8, yang.Yuint16, yang.Yuint32, yang.Yuint64:
+		hi = new(big.Int).Lsh(one, bits)
+		return big.NewInt(0), hi.Sub(hi, one)
+	}
+	hi = new(big.Int).Lsh(one, bits-1)
+	lo = new(big.Int).Neg(hi)
+	return lo, hi.Sub(hi, one)
+}
+
+// bigNumber returns the number n scaled by 10^fd, lo if it is min and
+// hi if it is max.
+func bigNumber(n yang.Number, lo, hi *big.Int, fd int) *big.Int {
+	switch n.Kind {
+	case yang.MinNumber:
+		return new(big.Int).Set(lo)
+	case yang.MaxNumber:
+		return new(big.Int).Set(hi)
+	}
+	v := new(big.Int).SetUint64(n.Value)
+	if d := fd - int(n.FractionDigits); d > 0 {
+		v.Mul(v, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(d)), nil))
+	} else if d < 0 {
+		v.Quo(v, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(-d)), nil))
+	}
+	if n.Kind == yang.Negative {
+		v.Neg(v)
+	}
+	return v
+}
+
+// formatDecimal returns the canonical decimal64 value of v scaled by
+// 10^fd.
+func formatDecimal(v *big.Int, fd int) string {
+	s := new(big.Int).Abs(v).String()
+	if len(s) <= fd {
+		s = strings.Repeat("0", fd-len(s)+1) + s
+	}
+	whole, frac := s[:len(s)-fd], strings.TrimRight(s[len(s)-fd:], "0")
+	if frac == "" {
+		frac = "0"
+	}
+	if v.Sign() < 0 {
+		whole = "-" + whole
+	}
+	return whole + "." + frac
+}
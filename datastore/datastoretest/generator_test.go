@@ -0,0 +1,212 @@
+package datastoretest
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	xml "github.com/andaru/flexml"
+	"github.com/andaru/opr8/datastore"
+	"github.com/andaru/opr8/dom"
+	"github.com/andaru/opr8/modules"
+)
+
+const testModule = `module gen-test {
+  namespace "urn:gen-test"; prefix gt;
+
+  identity transport;
+  identity tcp { base transport; }
+  identity udp { base transport; }
+
+  typedef percent { type uint8 { range "0..100"; } }
+
+  container system {
+    leaf host-name {
+      type string { length "1..16"; pattern "[a-z][a-z0-9-]*"; }
+      mandatory true;
+    }
+    leaf load { type percent; }
+    leaf ratio { type decimal64 { fraction-digits 2; range "-1.5..1.5"; } }
+    leaf port { type union { type uint16 { range "1..1023"; } type enumeration { enum any; } } }
+    leaf flags { type bits { bit up; bit running; bit loopback; } }
+    leaf debug { type empty; }
+    leaf enabled { type boolean; }
+    leaf key { type binary { length "4..8"; } }
+    leaf protocol { type identityref { base transport; } }
+    leaf-list servers {
+      type string { pattern "[0-9]{1,3}(\.[0-9]{1,3}){3}"; }
+      min-elements 1;
+      max-elements 3;
+    }
+    choice address {
+      mandatory true;
+      leaf dhcp { type empty; }
+      case static {
+        leaf ip { type string; }
+        leaf prefix-length { type uint8 { range "0..32"; } }
+      }
+    }
+  }
+
+  container interfaces {
+    list interface {
+      key "name unit";
+      min-elements 2;
+      leaf name { type string { length "1..4"; } }
+      leaf unit { type int8 { range "0..1"; } }
+      leaf mtu { type uint16 { range "68..9000"; } }
+      leaf parent { type leafref { path "../../interface/name"; } }
+      container state {
+        config false;
+        leaf oper-status { type enumeration { enum up; enum down; } }
+      }
+    }
+  }
+
+  list route {
+    key prefix;
+    leaf prefix { type string { length "1..8"; } }
+    leaf-list next-hop { type leafref { path "/interfaces/interface/name"; } }
+  }
+}`
+
+func newTestCollection(t *testing.T) *modules.Collection {
+	t.Helper()
+	c := modules.NewCollection()
+	if err := c.ReadString("gen-test", testModule); err != nil {
+		t.Fatal(err)
+	}
+	if errs := c.Process(); errs != nil {
+		t.Fatal(errs)
+	}
+	return c
+}
+
+// decode returns the data tree of the document s, in the YANG/JSON
+// encoding if json is true and the YANG/XML encoding otherwise.
+func decode(t *testing.T, c *modules.Collection, s []byte, json bool) dom.Document {
+	t.Helper()
+	root := dom.NewDocument(nil)
+	td := &datastore.Decoder{Node: root, Modules: c, Attrs: datastore.AttrNamespaces()}
+	un := dom.NewUnmarshaler(td)
+	reader := un.XMLReader()
+	un.InitializeArgs = []string{"mediatype", "application/yang-data+xml"}
+	if json {
+		reader = un.JSONReader()
+		un.InitializeArgs = []string{"mediatype", "application/yang-data+json"}
+	}
+	if _, err := reader.ReadFrom(bytes.NewReader(s)); err != nil {
+		t.Fatalf("%v: %s", err, s)
+	}
+	if errs := td.DecodingErrors(); len(errs) > 0 {
+		t.Fatalf("decoding errors %v: %s", errs, s)
+	}
+	return root
+}
+
+// elements returns the element children of n.
+func elements(n dom.Node) []dom.Node {
+	var nodes []dom.Node
+	for it := n.FirstChild(); it != nil; it = it.NextSibling() {
+		if it.NodeType() == dom.NodeTypeElement {
+			nodes = append(nodes, it)
+		}
+	}
+	return nodes
+}
+
+func TestGenerator_Document(t *testing.T) {
+	c := newTestCollection(t)
+	for seed := int64(1); seed <= 20; seed++ {
+		doc, err := NewGenerator(c, WithSeed(seed)).Document()
+		if err != nil {
+			t.Fatalf("seed %d: Document() error = %v", seed, err)
+		}
+		if report := datastore.Validate(doc, c, nil); !report.Valid() {
+			t.Fatalf("seed %d: Validate() = %v", seed, report.Err())
+		}
+
+		var b bytes.Buffer
+		for _, n := range elements(doc) {
+			if _, err := dom.NewMarshaler(dom.CloneNode(n, true)).XMLWriter().WriteTo(&b); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if edits := datastore.Diff(doc, decode(t, c, b.Bytes(), false), c); len(edits) > 0 {
+			t.Errorf("seed %d: XML round trip edits = %v", seed, edits)
+		}
+		js := datastore.MarshalJSON(c, elements(doc))
+		if edits := datastore.Diff(doc, decode(t, c, js, true), c); len(edits) > 0 {
+			t.Errorf("seed %d: JSON round trip edits = %v of %s", seed, edits, js)
+		}
+
+		interfaces := doc.ChildByName(xml.Name{Space: "urn:gen-test", Local: "interfaces"})
+		if interfaces == nil {
+			t.Fatalf("seed %d: no interfaces, want the container of a list with min-elements", seed)
+		}
+		keys := map[string]bool{}
+		for _, entry := range elements(interfaces) {
+			key := entry.FirstChild().ChildValue() + " " + entry.FirstChild().NextSibling().ChildValue()
+			if keys[key] {
+				t.Errorf("seed %d: duplicate interface %s", seed, key)
+			}
+			keys[key] = true
+		}
+		if n := len(keys); n < 2 || n > 5 {
+			t.Errorf("seed %d: %d interfaces, want 2 to 5", seed, n)
+		}
+	}
+}
+
+func TestGenerator_options(t *testing.T) {
+	c := newTestCollection(t)
+	a, err := NewGenerator(c, WithSeed(7), WithOptional(1)).Document()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewGenerator(c, WithSeed(7), WithOptional(1)).Document()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if edits := datastore.Diff(a, b, c); len(edits) > 0 {
+		t.Errorf("documents of the same seed differ: %v", edits)
+	}
+	if js := string(datastore.MarshalJSON(c, elements(a))); !strings.Contains(js, `"oper-status"`) {
+		t.Errorf("document with all optional nodes = %s, want state", js)
+	}
+
+	doc, err := NewGenerator(c, WithConfigOnly(), WithOptional(1), WithMaxEntries(100)).Document()
+	if err != nil {
+		t.Fatal(err)
+	}
+	js := string(datastore.MarshalJSON(c, elements(doc)))
+	if strings.Contains(js, `"state"`) {
+		t.Errorf("configuration = %s, want no state", js)
+	}
+	if n := strings.Count(js, `"prefix":`); n < 1 {
+		t.Errorf("configuration has %d routes, want many", n)
+	}
+}
+
+func TestGenerator_Generate(t *testing.T) {
+	c := newTestCollection(t)
+	module, err := c.ModuleEntry("gen-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	system := module.Dir["system"]
+	root := dom.NewDocument(nil)
+	if err := NewGenerator(c).Generate(root, system); err != nil {
+		t.Fatal(err)
+	}
+	n := root.FirstChild()
+	if n == nil || n.Name().Local != "system" {
+		t.Fatalf("Generate() = %v, want a system container", n)
+	}
+	if host := n.FirstChild(); host.Name().Local != "host-name" || host.ChildValue() == "" {
+		t.Errorf("first child = %s %q, want host-name in schema order", host.Name().Local, host.ChildValue())
+	}
+	if report := datastore.Validate(root, c, nil); !report.Valid() {
+		t.Errorf("Validate() = %v", report.Err())
+	}
+}
@@ -1,11 +1,14 @@
 package datastore
 
 import (
+	"bytes"
+	"fmt"
 	"io"
 	"strings"
 
 	xml "github.com/andaru/flexml"
 	"github.com/andaru/opr8/dom"
+	"github.com/andaru/opr8/log"
 	"github.com/andaru/opr8/modules"
 	"github.com/openconfig/goyang/pkg/yang"
 	"github.com/pkg/errors"
@@ -13,6 +16,9 @@ import (
 
 // Decoder is a YANG data decoder. It may be used with a dom.Unmarshaler to
 // read YANG data from JSON or XML sources with streaming support.
+// Character data outside of leaves is a bad-element error, unless it is
+// only whitespace, such as the indentation of an XML document, which is
+// ignored.
 //
 // Example:
 //   modules := modules.NewCollection()
@@ -28,18 +34,72 @@ import (
 type Decoder struct {
 	Node    dom.Node
 	Modules *modules.Collection
+	// Merge causes decoded data to be merged with data already
+	// present in the tree, rather than appended. Containers and list
+	// entries (by key) are merged, leaf values replaced and existing
+	// leaf-list entries are not duplicated.
+	Merge bool
+	// Config causes state (config false) data to be rejected, as is
+	// required when decoding the content of a configuration edit.
+	// Each state element is reported as a decoding error and skipped.
+	Config bool
+	// UniqueState causes duplicate entries of state (config false)
+	// leaf-lists to be reported and skipped, as those of
+	// configuration leaf-lists always are. YANG allows state
+	// leaf-list entries to repeat. Merged data is not duplicated.
+	UniqueState bool
+	// DirectiveHandler, if not nil, is called with each XML directive
+	// in the input, such as a DOCTYPE declaration, and may return an
+	// error to abort decoding. Directives are otherwise ignored. The
+	// directive's bytes are only valid for the duration of the call.
+	DirectiveHandler func(xml.Directive) error
+	// Attrs selects the XML attributes of each decoded element kept on
+	// its data node, such as edit operation attributes and metadata.
+	// All attributes are kept if Attrs is nil. Namespace declarations
+	// are needed to resolve prefixes in identityref and
+	// instance-identifier values once decoding is complete.
+	Attrs AttrFilter
+	// Logger, if not nil, logs the decoding errors found, and the
+	// data skipped because of them, at log.LevelDebug.
+	Logger log.Logger
 
 	schema    *yang.Entry
 	stack     yangDecoderStack
+	names     []xml.Name
+	resolved  map[dom.Node]*yang.YangType
+	entries   map[LeafList]map[string]bool
+	merged    map[siblings]map[string]dom.Node
+	instances []instanceRef
 	skip      bool
+	discard   int
 	errors    []error
 	childname nameLookup
+	prefixes  prefixLookup
+	// depth is the number of names of elements added to the tree
+	depth int
+	// mount is true if the schema node is a schema mount point, whose
+	// children include the top-level nodes of Modules
+	mount bool
+	// qualify is true if unqualified names take the namespace of
+	// their schema node, as YANG/JSON member names do
+	qualify bool
+}
+
+// instanceRef is an instance-identifier value requiring an instance,
+// resolved when decoding ends.
+type instanceRef struct {
+	id  InstanceID
+	err *DecodeError
 }
 
 // DecodingErrors returns the YANG schema errors accumulated during
-// data decoding.
+// data decoding. Each error is a *DecodeError.
 func (un Decoder) DecodingErrors() []error { return un.errors }
 
+// ResolvedType returns the member type of the union which matched the
+// value of the decoded leaf node n, or nil if n is not a union leaf.
+func (un Decoder) ResolvedType(n dom.Node) *yang.YangType { return un.resolved[n] }
+
 // Root returns the decoder root node
 func (un Decoder) Root() dom.Node {
 	for n := un.Node; n != nil; n = n.Parent() {
@@ -88,13 +148,13 @@ func (un *Decoder) Initialize(kv ...string) error {
 	// default to XML name resolution (pass-through): JSON users must
 	// pass arguments to Initialize to have their namespaces decoded
 	// correctly in the resulting DOM document.
-	un.childname = rfc6020Lookup
+	un.childname, un.prefixes, un.qualify = rfc6020Lookup, rfc6020Prefix, false
 
 	switch format {
 	case "rfc7951", "application/yang-data+json", "json":
-		un.childname = rfc7951Lookup
+		un.childname, un.prefixes, un.qualify = rfc7951Lookup, rfc7951Prefix, true
 	case "default", "rfc6020", "application/yang-data+xml", "xml":
-		un.childname = rfc6020Lookup
+		un.childname, un.prefixes, un.qualify = rfc6020Lookup, rfc6020Prefix, false
 	default:
 		return errors.Errorf("unsupported '%s' key value: %v", k, format)
 	}
@@ -116,88 +176,285 @@ func (un Decoder) Begin(se xml.StartElement) error {
 
 // StartElement responds to a new start element token.
 func (un *Decoder) StartElement(se xml.StartElement) error {
+	if un.discard > 0 {
+		// descendants of rejected state data are discarded silently
+		un.names = append(un.names, se.Name)
+		un.discard++
+		un.stack.push(func() { un.discard-- })
+		return nil
+	}
 	oldSchema := un.schema
 	oldNode := un.Node
+	oldModules, oldMount, oldDepth := un.Modules, un.mount, un.depth
 
 	name, err := un.childname(un.Modules, se.Name)
+	un.names = append(un.names, name)
 	if err == nil {
 		var newSchema *yang.Entry
 		newSchema, err = un.dataChild(name)
+		if err == nil && !un.skip && un.Config && newSchema.ReadOnly() {
+			un.addError(&DecodeError{
+				Tag:        ErrorTagBadElement,
+				SchemaPath: newSchema.Path(),
+				Message:    fmt.Sprintf("state data %s not allowed in configuration", newSchema.Name),
+			})
+			un.logger().Log(log.LevelDebug, "discarding state data", "path", un.instancePath())
+			un.discard = 1
+			un.stack.push(func() { un.discard = 0 })
+			return nil
+		}
 		if err == nil {
 			if !un.skip {
+				// YANG/JSON member names are qualified only where
+				// their namespace differs from their parent's (RFC
+				// 7951 section 4); XML names are used as decoded
+				if un.qualify && name.Space == "" {
+					name.Space = newSchema.Namespace().Name
+				}
 				se.Name = name
+				se.Attr = filterAttrs(se, un.Attrs)
 				newNode := dom.CreateElement(se)
 				if crit := un.Node.AppendChild(newNode); crit != nil {
 					return crit
 				}
 				un.schema = newSchema
-				un.Node = newNode
+				// use the node as found in the tree, so it compares
+				// equal to nodes found by tree traversal
+				un.Node = un.Node.LastChild()
+				un.depth++
+				// descendants of a mount point are decoded with the
+				// mounted schema
+				un.mount = false
+				if mounted := un.Modules.Mounted(newSchema); mounted != nil {
+					un.Modules, un.mount = mounted, true
+				}
 			}
 			un.stack.push(func() {
 				un.schema = oldSchema
 				un.Node = oldNode
+				un.Modules, un.mount, un.depth = oldModules, oldMount, oldDepth
 			})
 			return nil
 		}
 	}
 
-	un.errors = append(un.errors, err)
+	un.addError(err)
+	if !un.skip {
+		un.logger().Log(log.LevelDebug, "skipping element", "path", un.instancePath())
+	}
+	// the descendants of an unexpected element are skipped too, so
+	// skipping ends with the outermost skipped element
+	oldSkip := un.skip
 	un.skip = true
 	un.stack.push(func() {
 		un.schema = oldSchema
 		un.Node = oldNode
-		un.skip = false
+		un.skip = oldSkip
 	})
 	return nil
 }
 
 // EndElement responds to a new end element token.
 func (un *Decoder) EndElement(xml.EndElement) error {
+	if !un.skip && un.discard == 0 && un.schema != nil {
+		if un.schema.Kind == yang.LeafEntry {
+			un.checkLeaf()
+		}
+		if un.Merge {
+			un.mergeElement(un.Node, un.schema)
+		} else if un.schema.IsLeafList() && (un.UniqueState || !un.schema.ReadOnly()) {
+			un.checkDuplicate()
+		}
+	}
 	un.stack.pop()()
+	un.names = un.names[:len(un.names)-1]
 	return nil
 }
 
 // CharData responds to a new text token.
 func (un *Decoder) CharData(cd xml.CharData) error {
-	if un.skip {
+	if un.skip || un.discard > 0 {
 		return nil
 	}
 	// YANG violation
 	if un.schema == nil || un.schema.Kind != yang.LeafEntry {
-		un.errors = append(un.errors,
-			errors.Wrap(dom.ErrHierarchyRequest, "schema node is not a leaf"))
+		if len(bytes.TrimSpace(cd)) == 0 {
+			// whitespace between elements, e.g., XML indentation,
+			// is insignificant outside of leaves
+			return nil
+		}
+		un.addError(&DecodeError{
+			Tag:     ErrorTagBadElement,
+			Message: "schema node is not a leaf",
+			Err:     dom.ErrHierarchyRequest,
+		})
 	}
 
-	// TODO: perform constraint checks against schema
-	update := un.stack.pop()
-	un.stack.push(update)
+	// empty leaves have no value; RFC 7951 encodes them as [null]
+	if un.schema != nil && un.schema.Type != nil && un.schema.Type.Kind == yang.Yempty {
+		if len(bytes.TrimSpace(cd)) > 0 {
+			un.addError(&DecodeError{
+				Tag:     ErrorTagInvalidValue,
+				Message: fmt.Sprintf("character data not allowed in empty leaf %s", un.schema.Name),
+			})
+		}
+		return nil
+	}
+
+	// leaf values are checked against the schema by EndElement
 	text := dom.CreateText(cd)
 	if crit := un.Node.AppendChild(text); crit != nil {
 		return crit
 	}
-	update()
 	return nil
 }
 
+// checkLeaf validates the value of the current leaf node against its
+// schema type, replacing the value with its canonical form.
+func (un *Decoder) checkLeaf() {
+	value := un.Node.ChildValue()
+	resolved, err := checkValue(un.schema, un.schema.Type, value)
+	if err != nil {
+		un.addError(&DecodeError{
+			Tag:     ErrorTagInvalidValue,
+			Message: fmt.Sprintf("invalid value for %s", un.schema.Name),
+			Err:     err,
+		})
+		return
+	}
+	if canonical := canonicalValue(resolved, value); canonical != value {
+		if err := un.Node.FirstChild().SetValue(canonical); err != nil {
+			un.addError(err)
+		}
+	}
+	if resolved.Kind == yang.YinstanceIdentifier {
+		un.checkInstanceID(resolved, value)
+	}
+	if un.schema.Type.Kind == yang.Yunion {
+		if un.resolved == nil {
+			un.resolved = map[dom.Node]*yang.YangType{}
+		}
+		un.resolved[un.Node] = resolved
+	}
+}
+
+// checkDuplicate reports and removes the current leaf-list entry if a
+// preceding entry has the same value. The values of the entries of
+// each leaf-list under a parent are kept in a set, built from the
+// entries in the tree when the first entry is decoded.
+func (un *Decoder) checkDuplicate() {
+	parent := un.Node.Parent()
+	if parent == nil {
+		return
+	}
+	list := LeafList{Parent: parent, Name: un.Node.Name()}
+	values, ok := un.entries[list]
+	if !ok {
+		values = map[string]bool{}
+		for it := dom.NewPrecedingSiblingNamedIterator(un.Node, list.Name); it.NextSibling() != nil; {
+			values[un.entryKey(it.Node())] = true
+		}
+		if un.entries == nil {
+			un.entries = map[LeafList]map[string]bool{}
+		}
+		un.entries[list] = values
+	}
+	key := un.entryKey(un.Node)
+	if !values[key] {
+		values[key] = true
+		return
+	}
+	un.addError(duplicateEntry(un.schema, un.Node.ChildValue()))
+	delete(un.resolved, un.Node)
+	_ = parent.RemoveChild(un.Node)
+}
+
+// entryKey returns the value of the leaf-list entry n as compared with
+// those of other entries: its canonical value, with the prefixes of
+// identityref and instance-identifier values, which name the same
+// namespace differently in different documents, resolved.
+func (un *Decoder) entryKey(n dom.Node) string {
+	value := n.ChildValue()
+	t := un.resolved[n]
+	if t == nil {
+		t = valueType(un.schema, value)
+	}
+	if t == nil {
+		return value
+	}
+	switch t.Kind {
+	case yang.Yidentityref:
+		if id := identityName(un.Modules, value, namespaceLookup(n, un.Modules), n.Name().Space); id != "" {
+			return id
+		}
+	case yang.YinstanceIdentifier:
+		if id, err := ParseInstanceID(value, namespaceLookup(n, un.Modules)); err == nil {
+			return id.Format(nil)
+		}
+	}
+	return canonicalValue(t, value)
+}
+
+// checkInstanceID parses the instance-identifier leaf value, and if
+// the type requires an instance, records it to be resolved by End.
+func (un *Decoder) checkInstanceID(t *yang.YangType, value string) {
+	id, err := ParseInstanceID(value, func(prefix string) (string, error) { return un.prefixes(un, prefix) })
+	if err != nil {
+		un.addError(&DecodeError{
+			Tag:     ErrorTagInvalidValue,
+			Message: fmt.Sprintf("invalid value for %s", un.schema.Name),
+			Err:     err,
+		})
+		return
+	}
+	if t.OptionalInstance {
+		return
+	}
+	de := &DecodeError{
+		Tag:        ErrorTagDataMissing,
+		AppTag:     "instance-required",
+		Path:       un.instancePath(),
+		SchemaPath: un.schema.Path(),
+		Element:    un.schema.Name,
+		Message:    fmt.Sprintf("required instance %s for %s not found", value, un.schema.Name),
+	}
+	un.instances = append(un.instances, instanceRef{id, de})
+}
+
 // Comment responds to a new comment token.
 func (un *Decoder) Comment(c xml.Comment) error { return nil }
 
 // ProcInst responds to a new processing instruction or declaration.
 func (un *Decoder) ProcInst(pi xml.ProcInst) error { return nil }
 
-// Directive responds to a new XML directive.
-func (un *Decoder) Directive(xml.Directive) error { return errors.New("TODO") }
+// Directive responds to a new XML directive, passing it to the
+// DirectiveHandler if one is set.
+func (un *Decoder) Directive(d xml.Directive) error {
+	if un.DirectiveHandler == nil {
+		un.logger().Log(log.LevelDebug, "ignoring directive", "directive", string(d))
+		return nil
+	}
+	return un.DirectiveHandler(d)
+}
 
-// End responds to the end of document processing. The error EOF indicates
-// normal completion.
-func (un Decoder) End(err error) error {
-	if err == io.EOF {
-		if un.Node.Parent() == nil {
-			return nil
-		}
+// End responds to the end of document processing. The error EOF (or
+// nil, from the JSON decoder) indicates normal completion, at which
+// time instance-identifier values requiring an instance are resolved.
+func (un *Decoder) End(err error) error {
+	if err != nil && err != io.EOF {
+		return err
+	} else if err == io.EOF && un.Node.Parent() != nil {
 		return io.ErrUnexpectedEOF
 	}
-	return err
+	root := un.Root()
+	for _, ref := range un.instances {
+		if _, err := ref.id.Resolve(root); err != nil {
+			un.logger().Log(log.LevelDebug, "decoding error", "error", ref.err)
+			un.errors = append(un.errors, ref.err)
+		}
+	}
+	un.instances, un.entries, un.merged = nil, nil, nil
+	return nil
 }
 
 func (un *Decoder) dataChild(n xml.Name) (candidate *yang.Entry, err error) {
@@ -207,7 +464,12 @@ func (un *Decoder) dataChild(n xml.Name) (candidate *yang.Entry, err error) {
 			return nil, errUnexpectedElementName(n)
 		}
 	} else {
-		candidate = dataChild(un.schema, n)
+		candidate = un.Modules.DataChild(un.schema, n.Local)
+		if candidate == nil && un.mount {
+			// a mount point's children include the top-level
+			// nodes of the mounted schema
+			candidate, _ = un.Modules.RootEntry(n)
+		}
 	}
 	if candidate == nil {
 		return nil, errUnexpectedElementName(n)
@@ -216,51 +478,62 @@ func (un *Decoder) dataChild(n xml.Name) (candidate *yang.Entry, err error) {
 	// validate the candidate child
 	if ns := n.Space; ns != "" {
 		if want := candidate.Namespace().Name; want != ns {
-			return nil, errors.Errorf(`unexpected child element <%s> in namespace %q (expected namespace %q)`, n.Local, ns, want)
+			return nil, &DecodeError{
+				Tag:     ErrorTagUnknownNamespace,
+				Element: n.Local,
+				Message: fmt.Sprintf(`unexpected child element <%s> in namespace %q (expected namespace %q)`, n.Local, ns, want),
+			}
 		}
 	}
 
 	return candidate, nil
 }
 
-func errUnexpectedElementName(n xml.Name) error {
-	// TODO: contextualize the error; with schema node identifier of YANG node
-	// without the suggested child
-	if n.Space != "" {
-		return errors.Errorf(`unexpected child element <%s xmlns=%q>`, n.Local, n.Space)
+// addError records a decoding error, annotating *DecodeError values
+// with the current instance and schema paths.
+func (un *Decoder) addError(err error) {
+	if de, ok := err.(*DecodeError); ok {
+		if de.Path == "" {
+			de.Path = un.instancePath()
+		}
+		if de.SchemaPath == "" {
+			de.SchemaPath = un.schema.Path()
+		}
+		if de.Element == "" && len(un.names) > 0 {
+			de.Element = un.names[len(un.names)-1].Local
+		}
 	}
-	return errors.Errorf("unexpected child element <%s>", n.Local)
+	un.logger().Log(log.LevelDebug, "decoding error", "error", err)
+	un.errors = append(un.errors, err)
 }
 
-func isData(e *yang.Entry) bool {
-	switch e.Kind {
-	case yang.LeafEntry, yang.DirectoryEntry, yang.AnyXMLEntry, yang.AnyDataEntry:
-		return true
+// logger returns the decoder's logger.
+func (un *Decoder) logger() log.Logger { return log.OrNop(un.Logger) }
+
+// instancePath returns the data instance path of the current element,
+// in the RFC 7951 style where the module name prefixes the first node
+// and any node whose namespace differs from its parent. Elements in the
+// tree have the keys of list entries; those skipped follow by name.
+func (un *Decoder) instancePath() string {
+	id := instanceIDOf(un.Modules, un.Node)
+	for _, name := range un.names[un.depth:] {
+		if name.Space == "" && len(id) > 0 {
+			name.Space = id[len(id)-1].Name.Space
+		}
+		id = append(id, InstanceIDElem{Name: name})
 	}
-	return false
+	if len(id) == 0 {
+		return "/"
+	}
+	return id.Format(func(ns string) string { return moduleName(un.Modules, ns) })
 }
 
-func dataChild(e *yang.Entry, n xml.Name) *yang.Entry {
-	if e == nil {
-		return nil
-	} else if next, ok := e.Dir[n.Local]; ok && isData(next) {
-		return next
-	}
-	for _, ch := range e.Dir {
-		if ch.Kind == yang.ChoiceEntry || ch.Kind == yang.CaseEntry {
-			if next, ok := ch.Dir[n.Local]; ok && isData(next) {
-				return next
-			}
-		}
-		for _, chch := range ch.Dir {
-			if chch.Kind == yang.CaseEntry {
-				if next, ok := chch.Dir[n.Local]; ok && isData(next) {
-					return next
-				}
-			}
-		}
+func errUnexpectedElementName(n xml.Name) error {
+	msg := fmt.Sprintf("unexpected child element <%s>", n.Local)
+	if n.Space != "" {
+		msg = fmt.Sprintf(`unexpected child element <%s xmlns=%q>`, n.Local, n.Space)
 	}
-	return nil
+	return &DecodeError{Tag: ErrorTagUnknownElement, Element: n.Local, Message: msg}
 }
 
 type yangDecoderStack struct{ d []func() }
@@ -281,7 +554,44 @@ func rfc7951Lookup(ms *modules.Collection, n xml.Name) (xml.Name, error) {
 		nn := xml.Name{Local: n.Local, Space: mod.Namespace().Name}
 		return nn, nil
 	}
-	return n, errors.Errorf(`unexpected element <%s> in unknown module %q`, n.Local, n.Space)
+	return n, &DecodeError{
+		Tag:     ErrorTagUnknownNamespace,
+		Element: n.Local,
+		Message: fmt.Sprintf(`unexpected element <%s> in unknown module %q`, n.Local, n.Space),
+	}
 }
 
 func rfc6020Lookup(ms *modules.Collection, n xml.Name) (xml.Name, error) { return n, nil }
+
+// prefixLookup returns the namespace for a prefix found in a value,
+// such as an instance-identifier.
+type prefixLookup func(*Decoder, string) (string, error)
+
+func rfc7951Prefix(un *Decoder, prefix string) (string, error) {
+	// In RFC7951 (YANG/JSON), prefixes are module names
+	mod, err := un.Modules.ModuleEntry(prefix)
+	if err != nil {
+		return "", errors.Errorf("unknown module %q", prefix)
+	}
+	return mod.Namespace().Name, nil
+}
+
+func rfc6020Prefix(un *Decoder, prefix string) (string, error) {
+	// search for the XML namespace declaration in scope
+	for n := un.Node; n != nil; n = n.Parent() {
+		ap, ok := n.(dom.AttributeProvider)
+		if !ok {
+			continue
+		}
+		for a := dom.Node(ap.FirstAttribute()); a != nil; a = a.NextSibling() {
+			if name := a.Name(); name.Space == "xmlns" && name.Local == prefix {
+				return a.Value(), nil
+			}
+		}
+	}
+	// otherwise, use the module prefix
+	if mod, err := un.Modules.Raw().FindModuleByPrefix(prefix); err == nil && mod.Namespace != nil {
+		return mod.Namespace.Name, nil
+	}
+	return "", errors.Errorf("undeclared namespace prefix %q", prefix)
+}
@@ -1,15 +1,24 @@
 package datastore
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/andaru/flexml"
 	"github.com/andaru/opr8/dom"
 	"github.com/andaru/opr8/modules"
+	"github.com/openconfig/goyang/pkg/yang"
 )
 
-func TestYANGDecoder(t *testing.T) {
+func newTestCollection(t testing.TB) *modules.Collection {
 	c := modules.NewCollection()
 	modules.SetYANGPath("../yang_modules/ietf/RFC/...", "./testdata/")
 	if errs := c.ImportAll(); errs != nil {
@@ -23,6 +32,11 @@ func TestYANGDecoder(t *testing.T) {
 		}
 		t.Fatal("fatal YANG processing errors")
 	}
+	return c
+}
+
+func TestYANGDecoder(t *testing.T) {
+	c := newTestCollection(t)
 
 	for _, tt := range []struct {
 		name         string
@@ -186,3 +200,612 @@ func TestYANGDecoder(t *testing.T) {
 		}
 	}
 }
+
+func TestDecodeErrorPaths(t *testing.T) {
+	c := newTestCollection(t)
+
+	for _, tt := range []struct {
+		name  string
+		xml   string
+		json  string
+		wants []DecodeError
+	}{
+		{
+			name: "unknown child of container",
+			xml:  `<system xmlns="urn:mod1"><hostname>abc123</hostname></system>`,
+			wants: []DecodeError{
+				{Path: "/module1:system/hostname", SchemaPath: "/module1/system", Element: "hostname", Tag: ErrorTagUnknownElement},
+			},
+		},
+		{
+			name: "unknown namespace for child",
+			xml:  `<system xmlns="urn:mod1"><host-name xmlns="foo">abc123</host-name></system>`,
+			wants: []DecodeError{
+				{Path: "/module1:system/foo:host-name", SchemaPath: "/module1/system", Element: "host-name", Tag: ErrorTagUnknownNamespace},
+			},
+		},
+		{
+			name: "unknown JSON module",
+			json: `{"module1:system": {"bad:host-name":"foo"}}`,
+			wants: []DecodeError{
+				{Path: "/module1:system/bad:host-name", SchemaPath: "/module1/system", Element: "host-name", Tag: ErrorTagUnknownNamespace},
+			},
+		},
+		{
+			name: "text in container",
+			xml:  `<system xmlns="urn:mod1">abc</system>`,
+			wants: []DecodeError{
+				{Path: "/module1:system", SchemaPath: "/module1/system", Element: "system", Tag: ErrorTagBadElement},
+			},
+		},
+		{
+			name: "duplicate leaf-list entry",
+			xml:  `<refs xmlns="urn:mod2"><tag>x</tag><tag>y</tag><tag>x</tag></refs>`,
+			wants: []DecodeError{
+				{Path: "/module2:refs/tag[.='x']", SchemaPath: "/module2/refs/tag", Element: "tag", Tag: ErrorTagOperationFailed},
+			},
+		},
+		{
+			name: "duplicate JSON leaf-list entry",
+			json: `{"module2:refs": {"tag": ["x", "x"]}}`,
+			wants: []DecodeError{
+				{Path: "/module2:refs/tag[.='x']", SchemaPath: "/module2/refs/tag", Element: "tag", Tag: ErrorTagOperationFailed},
+			},
+		},
+		{
+			name: "duplicate state leaf-list entry",
+			xml:  `<refs xmlns="urn:mod2"><alarm>a</alarm><alarm>a</alarm></refs>`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			td := &Decoder{Node: dom.NewDocument(nil), Modules: c}
+			un := dom.NewUnmarshaler(td)
+			var err error
+			if tt.json != "" {
+				un.InitializeArgs = []string{"mediatype", "application/yang-data+json"}
+				_, err = un.JSONReader().ReadFrom(strings.NewReader(tt.json))
+			} else {
+				un.InitializeArgs = []string{"mediatype", "application/yang-data+xml"}
+				_, err = un.XMLReader().ReadFrom(strings.NewReader(tt.xml))
+			}
+			if err != nil {
+				t.Fatalf("ReadFrom() err = %v, wantErr false", err)
+			}
+			got := td.DecodingErrors()
+			if len(got) != len(tt.wants) {
+				t.Fatalf("got %d decoding errors, want %d: %v", len(got), len(tt.wants), got)
+			}
+			for i, err := range got {
+				de, ok := err.(*DecodeError)
+				if !ok {
+					t.Fatalf("decoding error %d is a %T, want *DecodeError", i, err)
+				}
+				want := tt.wants[i]
+				if de.Path != want.Path || de.SchemaPath != want.SchemaPath || de.Element != want.Element ||
+					de.Tag != want.Tag || de.Severity != SeverityError {
+					t.Errorf("decoding error %d = %+v, want %+v", i, *de, want)
+				}
+			}
+		})
+	}
+}
+
+func decodeXML(t *testing.T, c *modules.Collection, input string) (*Decoder, dom.Document) {
+	doc := dom.NewDocument(nil)
+	td := &Decoder{Node: doc, Modules: c}
+	un := dom.NewUnmarshaler(td)
+	un.InitializeArgs = []string{"mediatype", "application/yang-data+xml"}
+	if _, err := un.XMLReader().ReadFrom(strings.NewReader(input)); err != nil {
+		t.Fatalf("Unmarshaler.XMLReader().ReadFrom() err = %v, wantErr = false", err)
+	}
+	return td, doc
+}
+
+func TestDecoderNamespaces(t *testing.T) {
+	c := newTestCollection(t)
+
+	for _, tt := range []struct {
+		mediatype string
+		input     string
+		want      string
+	}{
+		{
+			mediatype: "application/yang-data+json",
+			input:     `{"module2:refs": {"server": [{"name": "a"}]}}`,
+			want:      "urn:mod2",
+		},
+		{
+			mediatype: "application/yang-data+xml",
+			input:     `<refs xmlns="urn:mod2"><server xmlns=""><name>a</name></server></refs>`,
+			want:      "",
+		},
+	} {
+		t.Run(tt.mediatype, func(t *testing.T) {
+			doc := dom.NewDocument(nil)
+			un := dom.NewUnmarshaler(&Decoder{Node: doc, Modules: c})
+			un.InitializeArgs = []string{"mediatype", tt.mediatype}
+			var err error
+			if strings.HasSuffix(tt.mediatype, "json") {
+				_, err = un.JSONReader().ReadFrom(strings.NewReader(tt.input))
+			} else {
+				_, err = un.XMLReader().ReadFrom(strings.NewReader(tt.input))
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			server := doc.FirstChild().FirstChild()
+			if server == nil {
+				t.Fatal("no server element decoded")
+			}
+			if got := server.Name(); got.Local != "server" || got.Space != tt.want {
+				t.Errorf("server element name = %+v, want namespace %q", got, tt.want)
+			}
+			if got := server.FirstChild().Name().Space; got != tt.want {
+				t.Errorf("name element namespace = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecoderWhitespace(t *testing.T) {
+	c := newTestCollection(t)
+
+	td, doc := decodeXML(t, c, "<refs xmlns=\"urn:mod2\">\n  <server>\n    <name> a </name>\n  </server>\n</refs>\n")
+	if errs := td.DecodingErrors(); len(errs) > 0 {
+		t.Fatalf("indented document decoding errors %v, want none", errs)
+	}
+	refs := doc.FirstChild()
+	for _, n := range []dom.Node{refs, refs.FirstChild()} {
+		for it := n.FirstChild(); it != nil; it = it.NextSibling() {
+			if it.NodeType() != dom.NodeTypeElement {
+				t.Errorf("<%s> has a %v child %q, want elements only", n.Name().Local, it.NodeType(), it.Value())
+			}
+		}
+	}
+	if got := refs.FirstChild().FirstChild().ChildValue(); got != " a " {
+		t.Errorf("name leaf value = %q, want %q", got, " a ")
+	}
+
+	td, _ = decodeXML(t, c, `<refs xmlns="urn:mod2">x<server><name>a</name></server></refs>`)
+	if errs := td.DecodingErrors(); len(errs) != 1 || errs[0].(*DecodeError).Tag != ErrorTagBadElement {
+		t.Errorf("text in a container decoding errors %v, want a bad-element error", errs)
+	}
+}
+
+func TestDecoderWatchReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "opr8-reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	write := func(extra string) {
+		src := `module a { namespace urn:a; prefix a; container top { leaf name { type string; }
+			leaf ref { type leafref { path "/a:top/a:name"; } } leaf ` + extra + ` { type string; } } }`
+		if err := ioutil.WriteFile(filepath.Join(dir, "a.yang"), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("x")
+
+	defer func(interval time.Duration) { modules.WatchInterval = interval }(modules.WatchInterval)
+	modules.WatchInterval = time.Millisecond
+	modules.SetYANGPath(dir)
+	c := modules.NewCollection()
+	if errs := c.ImportAll(); errs != nil {
+		t.Fatal(errs)
+	}
+	if errs := c.Process(); errs != nil {
+		t.Fatal(errs)
+	}
+	events := make(chan modules.SchemaEvent)
+	c.Listen(func(ev modules.SchemaEvent) { events <- ev })
+	ctx, cancel := context.WithCancel(context.Background())
+	watched := make(chan error)
+	go func() { watched <- c.Watch(ctx) }()
+
+	// decoders use the schema of the collection while it is reloaded
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				doc := dom.NewDocument(nil)
+				td := &Decoder{Node: doc, Modules: c}
+				un := dom.NewUnmarshaler(td)
+				un.InitializeArgs = []string{"mediatype", "application/yang-data+json"}
+				if _, err := un.JSONReader().ReadFrom(strings.NewReader(`{"a:top": {"name": "n", "ref": "n"}}`)); err != nil {
+					t.Error(err)
+					return
+				}
+				if errs := td.DecodingErrors(); len(errs) > 0 {
+					t.Errorf("decoding errors %v, want none", errs)
+					return
+				}
+			}
+		}()
+	}
+	for i := 1; i <= 3; i++ {
+		write(strings.Repeat("y", i))
+		select {
+		case ev := <-events:
+			if ev.Errors != nil {
+				t.Errorf("SchemaEvent.Errors = %v, want none", ev.Errors)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("no schema event")
+		}
+	}
+	close(done)
+	wg.Wait()
+	cancel()
+	if err := <-watched; err != context.Canceled {
+		t.Errorf("Watch() = %v, want %v", err, context.Canceled)
+	}
+	if _, err := c.SchemaNode("/a:top/a:yyy"); err != nil {
+		t.Errorf("SchemaNode() after reloads = %v", err)
+	}
+}
+
+func TestUnionResolution(t *testing.T) {
+	c := newTestCollection(t)
+
+	for _, tt := range []struct {
+		leaf     string
+		value    string
+		wantKind yang.TypeKind
+		wantErr  bool
+	}{
+		{leaf: "port", value: "830", wantKind: yang.Yuint16},
+		{leaf: "port", value: "netconf", wantKind: yang.Ystring},
+		{leaf: "port", value: "70000", wantErr: true},
+		{leaf: "port", value: "NETCONF", wantErr: true},
+		{leaf: "nested", value: "true", wantKind: yang.Ybool},
+		{leaf: "nested", value: "22", wantKind: yang.Yuint16},
+		{leaf: "nested", value: "ssh", wantKind: yang.Ystring},
+		{leaf: "nested", value: "-1", wantErr: true},
+		{leaf: "name-ref", value: "-1", wantKind: yang.Yint8},
+		{leaf: "name-ref", value: "eth0", wantKind: yang.Yleafref},
+	} {
+		t.Run(tt.leaf+"="+tt.value, func(t *testing.T) {
+			td, doc := decodeXML(t, c, fmt.Sprintf(`<types xmlns="urn:mod2"><%s>%s</%s></types>`, tt.leaf, tt.value, tt.leaf))
+			errs := td.DecodingErrors()
+			if (len(errs) > 0) != tt.wantErr {
+				t.Fatalf("got decoding errors %v, wantErr %v", errs, tt.wantErr)
+			}
+			leaf := doc.FirstChild().FirstChild()
+			got := td.ResolvedType(leaf)
+			if tt.wantErr {
+				if tag := errs[0].(*DecodeError).Tag; tag != ErrorTagInvalidValue {
+					t.Errorf("got error tag %q, want %q", tag, ErrorTagInvalidValue)
+				}
+				if got != nil {
+					t.Errorf("Decoder.ResolvedType() = %v, want nil", got)
+				}
+				return
+			}
+			if got == nil || got.Kind != tt.wantKind {
+				t.Errorf("Decoder.ResolvedType() = %v, want kind %v", got, tt.wantKind)
+			}
+		})
+	}
+}
+
+func TestEmptyLeaf(t *testing.T) {
+	c := newTestCollection(t)
+
+	for _, tt := range []struct {
+		name    string
+		xml     string
+		json    string
+		wantXML string
+		wantErr bool
+	}{
+		{
+			name:    "xml empty element",
+			xml:     `<types xmlns="urn:mod2"><enabled/></types>`,
+			wantXML: `<types xmlns="urn:mod2"><enabled></enabled></types>`,
+		},
+		{
+			name:    "xml start and end element",
+			xml:     `<types xmlns="urn:mod2"><enabled></enabled></types>`,
+			wantXML: `<types xmlns="urn:mod2"><enabled></enabled></types>`,
+		},
+		{
+			name:    "xml character data",
+			xml:     `<types xmlns="urn:mod2"><enabled>true</enabled></types>`,
+			wantXML: `<types xmlns="urn:mod2"><enabled></enabled></types>`,
+			wantErr: true,
+		},
+		{
+			name:    "json null array",
+			json:    `{"module2:types":{"enabled":[null]}}`,
+			wantXML: `<types xmlns="urn:mod2"><enabled></enabled></types>`,
+		},
+		{
+			name:    "json string value",
+			json:    `{"module2:types":{"enabled":"true"}}`,
+			wantXML: `<types xmlns="urn:mod2"><enabled></enabled></types>`,
+			wantErr: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := dom.NewDocument(nil)
+			td := &Decoder{Node: doc, Modules: c}
+			un := dom.NewUnmarshaler(td)
+			var err error
+			if tt.json != "" {
+				un.InitializeArgs = []string{"mediatype", "application/yang-data+json"}
+				_, err = un.JSONReader().ReadFrom(strings.NewReader(tt.json))
+			} else {
+				un.InitializeArgs = []string{"mediatype", "application/yang-data+xml"}
+				_, err = un.XMLReader().ReadFrom(strings.NewReader(tt.xml))
+			}
+			if err != nil {
+				t.Fatalf("ReadFrom() err = %v, wantErr false", err)
+			}
+			if errs := td.DecodingErrors(); (len(errs) > 0) != tt.wantErr {
+				t.Errorf("got decoding errors %v, wantErr %v", errs, tt.wantErr)
+			}
+			b, err := flexml.Marshal(dom.NewMarshaler(doc))
+			if err != nil {
+				t.Fatalf("xml.Marshal(doc) error: %v, wantErr false", err)
+			} else if string(b) != tt.wantXML {
+				t.Errorf("encoded XML got:\n%s\nwant:\n%s\n", b, tt.wantXML)
+			}
+		})
+	}
+}
+
+func TestLeafValues(t *testing.T) {
+	c := newTestCollection(t)
+
+	for _, tt := range []struct {
+		leaf      string
+		value     string
+		wantValue string
+		wantErr   bool
+	}{
+		{leaf: "speed", value: "auto", wantValue: "auto"},
+		{leaf: "speed", value: "100M", wantValue: "100M"},
+		{leaf: "speed", value: "1G", wantErr: true},
+		{leaf: "speed", value: "", wantErr: true},
+		{leaf: "flags", value: "up", wantValue: "up"},
+		{leaf: "flags", value: "", wantValue: ""},
+		{leaf: "flags", value: "loopback  up running", wantValue: "up running loopback"},
+		{leaf: "flags", value: "running up running", wantValue: "up running"},
+		{leaf: "flags", value: "up down", wantErr: true},
+		{leaf: "key", value: "AAEC", wantValue: "AAEC"},
+		{leaf: "key", value: "AAECAw", wantErr: true},
+		{leaf: "key", value: "AAECAw==", wantValue: "AAECAw=="},
+		{leaf: "key", value: "AAEC\n AwQ=", wantValue: "AAECAwQ="},
+		{leaf: "key", value: "", wantErr: true},
+		{leaf: "key", value: "AAECAwQFBgcI", wantErr: true},
+		{leaf: "key", value: "A!EC", wantErr: true},
+		{leaf: "ratio", value: "1", wantValue: "1.0"},
+		{leaf: "ratio", value: "007.50", wantValue: "7.5"},
+		{leaf: "ratio", value: "+0.05", wantValue: "0.05"},
+		{leaf: "ratio", value: "-0.00", wantValue: "0.0"},
+		{leaf: "ratio", value: "-1.5", wantValue: "-1.5"},
+		{leaf: "ratio", value: "100.00", wantValue: "100.0"},
+		{leaf: "ratio", value: "100.01", wantErr: true},
+		{leaf: "ratio", value: "-1.51", wantErr: true},
+		{leaf: "ratio", value: "1.005", wantErr: true},
+		{leaf: "ratio", value: "1.", wantErr: true},
+		{leaf: "ratio", value: ".5", wantErr: true},
+		{leaf: "ratio", value: "1e2", wantErr: true},
+	} {
+		t.Run(tt.leaf+"="+tt.value, func(t *testing.T) {
+			td, doc := decodeXML(t, c, fmt.Sprintf(`<types xmlns="urn:mod2"><%s>%s</%s></types>`, tt.leaf, tt.value, tt.leaf))
+			errs := td.DecodingErrors()
+			if (len(errs) > 0) != tt.wantErr {
+				t.Fatalf("got decoding errors %v, wantErr %v", errs, tt.wantErr)
+			}
+			if tt.wantErr {
+				if tag := errs[0].(*DecodeError).Tag; tag != ErrorTagInvalidValue {
+					t.Errorf("got error tag %q, want %q", tag, ErrorTagInvalidValue)
+				}
+				return
+			}
+			if got := doc.FirstChild().FirstChild().ChildValue(); got != tt.wantValue {
+				t.Errorf("got leaf value %q, want %q", got, tt.wantValue)
+			}
+		})
+	}
+}
+
+func TestBinaryValue(t *testing.T) {
+	c := newTestCollection(t)
+	_, doc := decodeXML(t, c, `<types xmlns="urn:mod2"><key>AAEC
+ /w==</key></types>`)
+	got, err := BinaryValue(doc.FirstChild().FirstChild())
+	if err != nil {
+		t.Fatalf("BinaryValue() error = %v, wantErr false", err)
+	}
+	if want := []byte{0, 1, 2, 255}; !bytes.Equal(got, want) {
+		t.Errorf("BinaryValue() = %v, want %v", got, want)
+	}
+	if _, err := BinaryValue(nil); err == nil {
+		t.Error("BinaryValue(nil) error = nil, wantErr true")
+	}
+}
+
+func TestDirective(t *testing.T) {
+	c := newTestCollection(t)
+	const input = `<?xml version="1.0"?><!DOCTYPE types><types xmlns="urn:mod2"><name>a</name></types>`
+
+	for _, tt := range []struct {
+		name    string
+		handler func(flexml.Directive) error
+		wantErr bool
+	}{
+		{name: "ignored"},
+		{name: "accepted", handler: func(flexml.Directive) error { return nil }},
+		{name: "rejected", handler: func(d flexml.Directive) error { return fmt.Errorf("directive %s not allowed", d) }, wantErr: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			doc := dom.NewDocument(nil)
+			td := &Decoder{Node: doc, Modules: c}
+			if tt.handler != nil {
+				td.DirectiveHandler = func(d flexml.Directive) error {
+					got = append(got, string(d))
+					return tt.handler(d)
+				}
+			}
+			un := dom.NewUnmarshaler(td)
+			un.InitializeArgs = []string{"mediatype", "application/yang-data+xml"}
+			_, err := un.XMLReader().ReadFrom(strings.NewReader(input))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unmarshaler.XMLReader().ReadFrom() err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.handler != nil && (len(got) != 1 || got[0] != "DOCTYPE types") {
+				t.Errorf("DirectiveHandler called with %q, want [\"DOCTYPE types\"]", got)
+			}
+			if !tt.wantErr && (len(td.DecodingErrors()) > 0 || doc.FirstChild() == nil || doc.FirstChild().FirstChild().ChildValue() != "a") {
+				t.Errorf("decoding errors = %v, want document decoded", td.DecodingErrors())
+			}
+		})
+	}
+}
+
+func BenchmarkDecodeXML(b *testing.B) {
+	c := modules.NewCollection()
+	modules.SetYANGPath("../yang_modules/ietf/RFC/...", "./testdata/")
+	c.ImportAll()
+	if errs := c.Process(); errs != nil {
+		b.Fatalf("Collection.Process() = %v", errs)
+	}
+	var input bytes.Buffer
+	input.WriteString(`<ordered xmlns="urn:mod2">`)
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(&input, `<entry><id>%d</id><value>v</value></entry><address>a</address><alpha>a</alpha>`, i)
+	}
+	input.WriteString(`</ordered>`)
+
+	b.ReportAllocs()
+	b.SetBytes(int64(input.Len()))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		td := &Decoder{Node: dom.NewDocument(nil), Modules: c}
+		un := dom.NewUnmarshaler(td)
+		un.InitializeArgs = []string{"mediatype", "application/yang-data+xml"}
+		if _, err := un.XMLReader().ReadFrom(bytes.NewReader(input.Bytes())); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDataChild(b *testing.B) {
+	c := modules.NewCollection()
+	modules.SetYANGPath("../yang_modules/ietf/RFC/...", "./testdata/")
+	c.ImportAll()
+	if errs := c.Process(); errs != nil {
+		b.Fatalf("Collection.Process() = %v", errs)
+	}
+	mod, err := c.ModuleEntry("module2")
+	if err != nil {
+		b.Fatal(err)
+	}
+	e := mod.Dir["ordered"]
+	names := []string{"first", "address", "alpha", "beta", "last"}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if c.DataChild(e, names[i%len(names)]) == nil {
+			b.Fatal("no schema node")
+		}
+	}
+}
+
+func BenchmarkDecodeXMLTopLevel(b *testing.B) {
+	c := modules.NewCollection()
+	modules.SetYANGPath("../yang_modules/ietf/RFC/...", "./testdata/")
+	c.ImportAll()
+	if errs := c.Process(); errs != nil {
+		b.Fatalf("Collection.Process() = %v", errs)
+	}
+	var input bytes.Buffer
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(&input, `<link xmlns="urn:mod2"><mtu>%d</mtu></link>`, i)
+	}
+
+	b.ReportAllocs()
+	b.SetBytes(int64(input.Len()))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		td := &Decoder{Node: dom.NewDocument(nil), Modules: c}
+		un := dom.NewUnmarshaler(td)
+		un.InitializeArgs = []string{"mediatype", "application/yang-data+xml"}
+		if _, err := un.XMLReader().ReadFrom(bytes.NewReader(input.Bytes())); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestSchemaMount(t *testing.T) {
+	parent, mounted := modules.NewCollection(), modules.NewCollection()
+	if err := parent.ReadString("lne", `module lne {
+  namespace urn:lne; prefix lne;
+  list lne { key name; leaf name { type string; } container root; }
+}`); err != nil {
+		t.Fatal(err)
+	}
+	if err := mounted.ReadString("inner", `module inner {
+  namespace urn:inner; prefix in;
+  container system { leaf host-name { type string; } }
+}`); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []*modules.Collection{parent, mounted} {
+		if errs := c.Process(); errs != nil {
+			t.Fatalf("Collection.Process() = %v", errs)
+		}
+	}
+	if err := parent.Mount("/lne:lne/root", mounted); err != nil {
+		t.Fatalf("Collection.Mount() = %v", err)
+	}
+
+	for _, tt := range []struct {
+		name    string
+		input   string
+		wantErr bool
+	}{
+		{
+			name:  "mounted schema",
+			input: `<lne xmlns="urn:lne"><name>a</name><root><system xmlns="urn:inner"><host-name>h</host-name></system></root></lne>`,
+		},
+		{
+			name:    "parent schema below mount point",
+			input:   `<lne xmlns="urn:lne"><name>a</name><root><lne><name>b</name></lne></root></lne>`,
+			wantErr: true,
+		},
+		{
+			name:    "mounted schema outside mount point",
+			input:   `<lne xmlns="urn:lne"><name>a</name><system xmlns="urn:inner"/></lne>`,
+			wantErr: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			td, doc := decodeXML(t, parent, tt.input)
+			if errs := td.DecodingErrors(); (len(errs) > 0) != tt.wantErr {
+				t.Fatalf("decoding errors = %v, wantErr %v", errs, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			got, err := flexml.Marshal(dom.NewMarshaler(doc))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.input {
+				t.Errorf("decoded document = %s, want %s", got, tt.input)
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package datastore
+
+import (
+	"sort"
+
+	xml "github.com/andaru/flexml"
+	"github.com/andaru/opr8/dom"
+	"github.com/andaru/opr8/modules"
+	"github.com/openconfig/goyang/pkg/yang"
+	"github.com/pkg/errors"
+)
+
+// WithDefaults is a with-defaults retrieval mode (RFC 6243), selecting
+// how leaves whose values are their schema defaults are reported.
+type WithDefaults int
+
+// With-defaults retrieval modes. Report-all-tagged is not supported.
+const (
+	// DefaultsExplicit reports the data as stored.
+	DefaultsExplicit WithDefaults = iota
+	// DefaultsReportAll adds each absent leaf that has a default.
+	DefaultsReportAll
+	// DefaultsTrim removes each leaf whose value is its default.
+	DefaultsTrim
+)
+
+func (m WithDefaults) String() string {
+	switch m {
+	case DefaultsReportAll:
+		return "report-all"
+	case DefaultsTrim:
+		return "trim"
+	}
+	return "explicit"
+}
+
+// ParseWithDefaults parses the with-defaults mode s.
+func ParseWithDefaults(s string) (WithDefaults, error) {
+	for _, m := range []WithDefaults{DefaultsExplicit, DefaultsReportAll, DefaultsTrim} {
+		if m.String() == s {
+			return m, nil
+		}
+	}
+	return DefaultsExplicit, errors.Errorf("unsupported with-defaults mode %q", s)
+}
+
+// ApplyDefaults changes the data tree root, with the schema of the
+// collection c, to report defaults by the mode m. Report-all adds the
+// leaves with defaults absent from each container and list entry,
+// including non-presence containers holding only such leaves, but not
+// those of choices, whose active case is not known.
+func ApplyDefaults(root dom.Node, c *modules.Collection, m WithDefaults) {
+	if m == DefaultsExplicit || c == nil {
+		return
+	}
+	if root.NodeType() == dom.NodeTypeElement {
+		if e := schemaOf(c, root); e != nil {
+			applyDefaults(c, root, e, m)
+		}
+		return
+	}
+	for _, n := range dataChildren(root) {
+		if e, err := c.RootEntry(n.Name()); err == nil {
+			applyDefaults(c, n, e, m)
+		}
+	}
+	if m != DefaultsReportAll {
+		return
+	}
+	_ = c.IterLatest(func(mod *yang.Module) error {
+		me, err := c.ModuleEntry(mod.Name)
+		if err != nil {
+			return nil
+		}
+		for _, e := range schemaChildren(c, me) {
+			addContainerDefaults(c, root, e)
+		}
+		return nil
+	})
+}
+
+// applyDefaults reports the defaults of the data node n, of schema
+// node e, and its descendants, by the mode m.
+func applyDefaults(c *modules.Collection, n dom.Node, e *yang.Entry, m WithDefaults) {
+	if e.Kind != yang.DirectoryEntry {
+		return
+	}
+	for _, child := range dataChildren(n) {
+		ce := c.DataChild(e, child.Name().Local)
+		switch {
+		case ce == nil || ce.Namespace().Name != child.Name().Space:
+		case ce.Kind == yang.DirectoryEntry:
+			applyDefaults(c, child, ce, m)
+		case m == DefaultsTrim && !ce.IsLeafList() && !isKey(e, ce.Name):
+			if d := leafDefault(ce); d != "" && child.ChildValue() == d {
+				_ = n.RemoveChild(child)
+			}
+		}
+	}
+	if m != DefaultsReportAll {
+		return
+	}
+	for _, ce := range schemaChildren(c, e) {
+		if d := leafDefault(ce); d != "" && !ce.IsLeafList() {
+			name := xml.Name{Space: ce.Namespace().Name, Local: ce.Name}
+			if n.ChildByName(name) == nil {
+				leaf := dom.CreateElement(xml.StartElement{Name: name})
+				_ = leaf.AppendChild(dom.CreateText(xml.CharData(d)))
+				_ = n.AppendChild(leaf)
+			}
+			continue
+		}
+		addContainerDefaults(c, n, ce)
+	}
+}
+
+// addContainerDefaults appends the non-presence container e to n, if
+// n has no such child, with the defaults of its descendants, if it
+// has any.
+func addContainerDefaults(c *modules.Collection, n dom.Node, e *yang.Entry) {
+	if !e.IsContainer() {
+		return
+	}
+	if ct, ok := e.Node.(*yang.Container); ok && ct.Presence != nil {
+		return
+	}
+	name := xml.Name{Space: e.Namespace().Name, Local: e.Name}
+	if n.ChildByName(name) != nil {
+		return
+	}
+	container := dom.CreateElement(xml.StartElement{Name: name})
+	applyDefaults(c, container, e, DefaultsReportAll)
+	if container.FirstChild() != nil {
+		_ = n.AppendChild(container)
+	}
+}
+
+// schemaChildren returns the children of the schema node e in schema
+// order.
+func schemaChildren(c *modules.Collection, e *yang.Entry) []*yang.Entry {
+	order := c.SchemaOrder(e)
+	children := make([]*yang.Entry, 0, len(e.Dir))
+	for _, ce := range e.Dir {
+		children = append(children, ce)
+	}
+	index := func(ce *yang.Entry) int {
+		if i, ok := order[ce.Name]; ok {
+			return i
+		}
+		return len(order)
+	}
+	sort.Slice(children, func(i, j int) bool {
+		if a, b := index(children[i]), index(children[j]); a != b {
+			return a < b
+		}
+		return children[i].Name < children[j].Name
+	})
+	return children
+}
+
+// leafDefault returns the default value of the leaf e, its own or its
+// type's, or the empty string if it has none.
+func leafDefault(e *yang.Entry) string {
+	if e.Kind != yang.LeafEntry {
+		return ""
+	}
+	if e.Default != "" {
+		return e.Default
+	}
+	return modules.ResolveType(e).Default
+}
+
+// isKey returns true if local is a key of the list e.
+func isKey(e *yang.Entry, local string) bool {
+	for _, key := range listKeys(e) {
+		if key == local {
+			return true
+		}
+	}
+	return false
+}
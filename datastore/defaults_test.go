@@ -0,0 +1,100 @@
+package datastore
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/andaru/opr8/dom"
+	"github.com/andaru/opr8/modules"
+)
+
+const testDefaultsModule = `module defaults {
+  namespace "urn:defaults"; prefix d;
+  typedef mtu { type uint16; default 1500; }
+  container system {
+    leaf host-name { type string; default "localhost"; }
+    leaf mtu { type mtu; }
+    leaf location { type string; }
+    container clock { leaf timezone { type string; default "UTC"; } }
+    container ntp { presence "enables ntp"; leaf port { type uint16; default 123; } }
+    list user { key name; leaf name { type string; } leaf shell { type string; default "sh"; } }
+  }
+}`
+
+func TestApplyDefaults(t *testing.T) {
+	c := modules.NewCollection()
+	if err := c.ReadString("defaults", testDefaultsModule); err != nil {
+		t.Fatal(err)
+	}
+	if errs := c.Process(); errs != nil {
+		t.Fatal(errs)
+	}
+	const data = `<system xmlns="urn:defaults"><host-name>localhost</host-name><location>x</location>` +
+		`<user><name>a</name></user><user><name>b</name><shell>sh</shell></user></system>`
+
+	for _, tt := range []struct {
+		mode WithDefaults
+		want string
+	}{
+		{DefaultsExplicit, data},
+		{DefaultsTrim, `<system xmlns="urn:defaults"><location>x</location><user><name>a</name></user><user><name>b</name></user></system>`},
+		{DefaultsReportAll, `<system xmlns="urn:defaults"><host-name>localhost</host-name><location>x</location>` +
+			`<user><name>a</name><shell>sh</shell></user><user><name>b</name><shell>sh</shell></user>` +
+			`<mtu>1500</mtu><clock><timezone>UTC</timezone></clock></system>`},
+	} {
+		t.Run(tt.mode.String(), func(t *testing.T) {
+			_, doc := decodeXML(t, c, data)
+			ApplyDefaults(doc, c, tt.mode)
+			var b bytes.Buffer
+			if _, err := dom.NewMarshaler(doc.FirstChild()).XMLWriter().WriteTo(&b); err != nil {
+				t.Fatal(err)
+			}
+			if got := b.String(); got != tt.want {
+				t.Errorf("ApplyDefaults() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("empty", func(t *testing.T) {
+		doc := dom.NewDocument(nil)
+		ApplyDefaults(doc, c, DefaultsReportAll)
+		var b bytes.Buffer
+		if _, err := dom.NewMarshaler(doc.FirstChild()).XMLWriter().WriteTo(&b); err != nil {
+			t.Fatal(err)
+		}
+		if got := b.String(); !strings.Contains(got, "<host-name>localhost</host-name>") {
+			t.Errorf("ApplyDefaults() of an empty tree = %s, want the system container's defaults", got)
+		}
+	})
+
+	for _, s := range []string{"explicit", "trim", "report-all"} {
+		if m, err := ParseWithDefaults(s); err != nil || m.String() != s {
+			t.Errorf("ParseWithDefaults(%s) = %v, %v", s, m, err)
+		}
+	}
+	if _, err := ParseWithDefaults("report-all-tagged"); err == nil {
+		t.Error("ParseWithDefaults(report-all-tagged) error = nil, want error")
+	}
+}
+
+func TestHash(t *testing.T) {
+	c := newTestCollection(t)
+	hash := func(s string) string {
+		_, doc := decodeXML(t, c, s)
+		return Hash(doc)
+	}
+	a := hash(`<refs xmlns="urn:mod2"><tag>x</tag><tag>y</tag></refs>`)
+	if b := hash(`<refs xmlns="urn:mod2"><tag>x</tag><tag>y</tag></refs>`); a != b {
+		t.Errorf("Hash() of equal trees = %s, %s, want equal", a, b)
+	}
+	for _, s := range []string{
+		`<refs xmlns="urn:mod2"><tag>y</tag><tag>x</tag></refs>`,
+		`<refs xmlns="urn:mod2"><tag>xy</tag></refs>`,
+		`<refs xmlns="urn:mod2"><tag>x</tag></refs>`,
+	} {
+		if b := hash(s); a == b {
+			t.Errorf("Hash(%s) = %s, want it to differ", s, b)
+		}
+	}
+}
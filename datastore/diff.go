@@ -0,0 +1,101 @@
+package datastore
+
+import (
+	xml "github.com/andaru/flexml"
+	"github.com/andaru/opr8/dom"
+	"github.com/andaru/opr8/modules"
+	"github.com/openconfig/goyang/pkg/yang"
+)
+
+// Diff returns the edits changing the data tree a into the data tree
+// b, both Documents of the schema of the collection c, as ApplyEdits
+// applies them. Data nodes only in a are deleted, those only in b
+// created, and leaves whose values differ replaced; containers and
+// list entries present in both are compared by their descendants.
+// Entries of keyless lists are never the same, so they are deleted
+// and created. Elements unknown to the schema are not compared.
+//
+// Each edit's Nodes are copies of the nodes of b.
+func Diff(a, b dom.Node, c *modules.Collection) []Edit {
+	var edits []Edit
+	diffChildren(&edits, c, a, b, nil, nil)
+	return edits
+}
+
+// diffChildren appends the edits changing the children of a, of schema
+// node e, or nil for the document, at the path id, into those of b.
+func diffChildren(edits *[]Edit, c *modules.Collection, a, b dom.Node, e *yang.Entry, id InstanceID) {
+	entry := func(n dom.Node) *yang.Entry {
+		if e == nil {
+			return rootEntry(c, n.Name())
+		}
+		return c.DataChild(e, n.Name().Local)
+	}
+	matched := map[dom.Node]bool{}
+	for _, x := range dataChildren(a) {
+		xe := entry(x)
+		if xe == nil {
+			continue
+		}
+		path := append(id[:len(id):len(id)], StepOf(x, xe))
+		var y dom.Node
+		for _, it := range dataChildren(b) {
+			if !matched[it] && sameDataNode(xe, x, it) {
+				y = it
+				break
+			}
+		}
+		switch {
+		case y == nil:
+			*edits = append(*edits, Edit{Operation: EditDelete, Path: path, Schema: xe})
+		case xe.Kind == yang.DirectoryEntry:
+			matched[y] = true
+			diffChildren(edits, c, x, y, xe, path)
+		default:
+			matched[y] = true
+			if x.ChildValue() != y.ChildValue() {
+				*edits = append(*edits, Edit{Operation: EditReplace, Path: path, Schema: xe, Nodes: []dom.Node{dom.CloneNode(y, true)}})
+			}
+		}
+	}
+	for _, y := range dataChildren(b) {
+		if matched[y] {
+			continue
+		}
+		if ye := entry(y); ye != nil {
+			path := append(id[:len(id):len(id)], StepOf(y, ye))
+			*edits = append(*edits, Edit{Operation: EditCreate, Path: path, Schema: ye, Nodes: []dom.Node{dom.CloneNode(y, true)}})
+		}
+	}
+}
+
+// StepOf returns the instance-identifier step of the data node n, of
+// schema node e, with the key predicates of list entries and the value
+// predicate of leaf-list entries.
+func StepOf(n dom.Node, e *yang.Entry) InstanceIDElem {
+	elem := InstanceIDElem{Name: n.Name()}
+	switch {
+	case e.IsLeafList():
+		elem.Keys = []InstanceIDKey{{Name: xml.Name{Local: "."}, Value: n.ChildValue()}}
+	case e.IsList():
+		for _, key := range listKeys(e) {
+			name := n.Name()
+			name.Local = key
+			if k := n.ChildByName(name); k != nil {
+				elem.Keys = append(elem.Keys, InstanceIDKey{Name: name, Value: k.ChildValue()})
+			}
+		}
+	}
+	return elem
+}
+
+// dataChildren returns the element children of n.
+func dataChildren(n dom.Node) []dom.Node {
+	var children []dom.Node
+	for it := n.FirstChild(); it != nil; it = it.NextSibling() {
+		if it.NodeType() == dom.NodeTypeElement {
+			children = append(children, it)
+		}
+	}
+	return children
+}
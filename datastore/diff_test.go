@@ -0,0 +1,91 @@
+package datastore
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/andaru/flexml"
+	"github.com/andaru/opr8/dom"
+)
+
+func TestDiff(t *testing.T) {
+	c := newTestCollection(t)
+	prefix := func(ns string) string { return map[string]string{"urn:mod1": "module1", "urn:mod2": "module2"}[ns] }
+
+	for _, tt := range []struct {
+		name, a, b string
+		want       []string
+	}{
+		{
+			name: "equal",
+			a:    `<refs xmlns="urn:mod2"><server><name>a</name><port>1</port></server><tag>x</tag></refs>`,
+			b:    `<refs xmlns="urn:mod2"><tag>x</tag><server><port>1</port><name>a</name></server></refs>`,
+		},
+		{
+			name: "leaf changed",
+			a:    `<refs xmlns="urn:mod2"><server><name>a</name><port>1</port></server></refs>`,
+			b:    `<refs xmlns="urn:mod2"><server><name>a</name><port>2</port></server></refs>`,
+			want: []string{"replace /module2:refs/server[name='a']/port"},
+		},
+		{
+			name: "list entries and leaf-list values",
+			a:    `<refs xmlns="urn:mod2"><server><name>a</name></server><server><name>b</name></server><tag>x</tag><tag>y</tag></refs>`,
+			b:    `<refs xmlns="urn:mod2"><server><name>b</name></server><server><name>c</name></server><tag>y</tag><tag>z</tag></refs>`,
+			want: []string{
+				"delete /module2:refs/server[name='a']",
+				"delete /module2:refs/tag[.='x']",
+				"create /module2:refs/server[name='c']",
+				"create /module2:refs/tag[.='z']",
+			},
+		},
+		{
+			name: "top-level containers",
+			a:    `<system xmlns="urn:mod1"><host-name>a</host-name></system>`,
+			b:    `<refs xmlns="urn:mod2"><tag>x</tag></refs>`,
+			want: []string{"delete /module1:system", "create /module2:refs"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, a := decodeXML(t, c, tt.a)
+			_, b := decodeXML(t, c, tt.b)
+			edits := Diff(a, b, c)
+			var got []string
+			for _, edit := range edits {
+				got = append(got, edit.Operation.String()+" "+edit.Path.Format(prefix))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Diff() = %q, want %q", got, tt.want)
+			}
+
+			if err := ApplyEdits(a, c, edits); err != nil {
+				t.Fatalf("ApplyEdits() error = %v, wantErr false", err)
+			}
+			if again := Diff(a, b, c); len(again) != 0 {
+				got, _ := flexml.Marshal(dom.NewMarshaler(a))
+				t.Errorf("Diff() after ApplyEdits() = %d edits, want none; tree is %s", len(again), got)
+			}
+		})
+	}
+}
+
+func TestDatastoreListen(t *testing.T) {
+	ds := New("running", newTestCollection(t), WithHistory(10))
+	var got []uint64
+	ds.Listen(func(prev, next *Snapshot) {
+		if next.Generation != prev.Generation+1 {
+			t.Errorf("listener generations = %d, %d, want consecutive", prev.Generation, next.Generation)
+		}
+		got = append(got, next.Generation)
+	})
+	for _, v := range []string{"a", "b"} {
+		if _, err := ds.Update(1, "set "+v, setSystem(v)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := ds.Rollback(1, 1, "undo"); err != nil {
+		t.Fatal(err)
+	}
+	if want := []uint64{1, 2, 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("listener called for generations %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,206 @@
+package datastore
+
+import (
+	"fmt"
+
+	xml "github.com/andaru/flexml"
+	"github.com/andaru/opr8/dom"
+	"github.com/andaru/opr8/modules"
+	"github.com/openconfig/goyang/pkg/yang"
+	"github.com/pkg/errors"
+)
+
+// EditOperation is the operation of an Edit.
+type EditOperation int
+
+const (
+	// EditMerge merges the edit's nodes with the data at its path,
+	// creating the path if needed.
+	EditMerge EditOperation = iota
+	// EditReplace replaces the data at the edit's path with its
+	// nodes, creating the path if needed.
+	EditReplace
+	// EditDelete removes the data at the edit's path, if present.
+	EditDelete
+	// EditCreate adds the edit's nodes at its path, failing if the
+	// data is already present.
+	EditCreate
+	// EditRemove removes the data at the edit's path, as EditDelete
+	// does.
+	EditRemove
+	// EditNone makes no change to the data at the edit's path, only
+	// to its descendants, as for an edit-config default-operation of
+	// none. It is not supported by ApplyEdits.
+	EditNone
+)
+
+func (op EditOperation) String() string {
+	switch op {
+	case EditMerge:
+		return "merge"
+	case EditReplace:
+		return "replace"
+	case EditDelete:
+		return "delete"
+	case EditCreate:
+		return "create"
+	case EditRemove:
+		return "remove"
+	case EditNone:
+		return "none"
+	default:
+		return fmt.Sprintf("UNKNOWN(%d)", op)
+	}
+}
+
+// ParseEditOperation returns the operation named s, such as the value
+// of an edit-config operation attribute.
+func ParseEditOperation(s string) (EditOperation, error) {
+	for op := EditMerge; op <= EditNone; op++ {
+		if op.String() == s {
+			return op, nil
+		}
+	}
+	return 0, errors.Errorf("unknown edit operation %q", s)
+}
+
+// Edit is a single change to a data tree.
+type Edit struct {
+	Operation EditOperation
+	// Path addresses the edited data node. Leaf-list paths without a
+	// value predicate address all entries of the leaf-list.
+	Path InstanceID
+	// Schema is the schema node of the edited data node.
+	Schema *yang.Entry
+	// Nodes are the new data nodes at Path, for merge and replace
+	// edits. Each is an element named as the last step of Path; there
+	// may be several for leaf-list values.
+	Nodes []dom.Node
+}
+
+// ApplyEdits applies the edits, in order, to the data tree root, a
+// Document, whose schema nodes are those of the collection c. It is typically called by the edit function passed to
+// Datastore.Update, so the edits are validated and committed together.
+func ApplyEdits(root dom.Node, c *modules.Collection, edits []Edit) error {
+	for i, edit := range edits {
+		if err := applyEdit(root, c, edit); err != nil {
+			return errors.Wrapf(err, "edit %d (%s %s)", i, edit.Operation, edit.Path.Format(nil))
+		}
+	}
+	return nil
+}
+
+func applyEdit(root dom.Node, c *modules.Collection, edit Edit) error {
+	if len(edit.Path) == 0 {
+		return errors.New("empty path")
+	}
+	last := edit.Path[len(edit.Path)-1]
+
+	parent := root
+	for _, elem := range edit.Path[:len(edit.Path)-1] {
+		next := findStep(parent, elem)
+		if next == nil {
+			if edit.Operation == EditDelete || edit.Operation == EditRemove {
+				return nil
+			}
+			var err error
+			if next, err = createStep(parent, elem); err != nil {
+				return err
+			}
+		}
+		parent = next
+	}
+
+	var existing []dom.Node
+	for _, child := range parent.ChildrenByName(last.Name) {
+		if last.matchKeys(child) {
+			existing = append(existing, child)
+		}
+	}
+
+	switch edit.Operation {
+	case EditCreate:
+		if len(existing) > 0 {
+			return &DecodeError{
+				Path:    edit.Path.Format(nil),
+				Element: last.Name.Local,
+				Tag:     ErrorTagDataExists,
+				Message: fmt.Sprintf("%s already exists", last.Name.Local),
+			}
+		}
+		for _, n := range edit.Nodes {
+			if err := parent.AppendChild(n); err != nil {
+				return err
+			}
+		}
+	case EditDelete, EditRemove, EditReplace:
+		for _, n := range existing {
+			if err := parent.RemoveChild(n); err != nil {
+				return err
+			}
+		}
+		if edit.Operation != EditReplace {
+			return nil
+		}
+		for _, n := range edit.Nodes {
+			if err := parent.AppendChild(n); err != nil {
+				return err
+			}
+		}
+	case EditMerge:
+		if edit.Schema == nil {
+			return errors.New("merge requires a schema node")
+		}
+		un := &Decoder{Modules: c}
+		for _, n := range edit.Nodes {
+			if err := parent.AppendChild(n); err != nil {
+				return err
+			}
+			for _, dst := range existing {
+				if sameDataNode(edit.Schema, dst, n) {
+					un.mergeInto(dst, n, edit.Schema)
+					break
+				}
+			}
+		}
+	default:
+		return errors.Errorf("unsupported operation %s", edit.Operation)
+	}
+	return nil
+}
+
+// findStep returns the first child of n matching the instance
+// identifier step elem, or nil.
+func findStep(n dom.Node, elem InstanceIDElem) dom.Node {
+	for _, child := range n.ChildrenByName(elem.Name) {
+		if elem.matchKeys(child) {
+			return child
+		}
+	}
+	return nil
+}
+
+// createStep appends a new child of n for the step elem, with any key
+// leaves of the step.
+func createStep(n dom.Node, elem InstanceIDElem) (dom.Node, error) {
+	if elem.Position > 0 {
+		return nil, errors.Errorf("cannot create %s by position", elem.Name.Local)
+	}
+	child := dom.CreateElement(xml.StartElement{Name: elem.Name})
+	for _, key := range elem.Keys {
+		if key.Name.Local == "." {
+			return nil, errors.Errorf("cannot create leaf-list %s ancestor", elem.Name.Local)
+		}
+		leaf := dom.CreateElement(xml.StartElement{Name: key.Name})
+		if err := leaf.AppendChild(dom.CreateText(xml.CharData(key.Value))); err != nil {
+			return nil, err
+		}
+		if err := child.AppendChild(leaf); err != nil {
+			return nil, err
+		}
+	}
+	if err := n.AppendChild(child); err != nil {
+		return nil, err
+	}
+	return n.LastChild(), nil
+}
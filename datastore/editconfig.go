@@ -0,0 +1,288 @@
+package datastore
+
+import (
+	"fmt"
+	"strings"
+
+	xml "github.com/andaru/flexml"
+	"github.com/andaru/opr8/dom"
+	"github.com/andaru/opr8/modules"
+	"github.com/openconfig/goyang/pkg/yang"
+)
+
+// OperationAttr is the name of the NETCONF edit-config operation
+// attribute.
+var OperationAttr = xml.Name{Space: "urn:ietf:params:xml:ns:netconf:base:1.0", Local: "operation"}
+
+// EditConfig applies the configuration edit, a data tree decoded with
+// its operation attributes (see AttrNamespaces), to the data tree
+// root, as the NETCONF edit-config operation does (RFC 6241 section
+// 7.2). Data nodes without an operation attribute inherit that of
+// their parent, and top-level nodes the default operation op, which
+// is EditMerge, EditReplace or EditNone. The operation attributes are
+// not copied to root.
+//
+// Entries of ordered-by user leaf-lists are positioned by their insert
+// and value attributes (see InsertAttr), if any; merging an existing
+// entry with an insert attribute moves it.
+//
+// Errors are *DecodeError values, such as those with the data-exists
+// and data-missing tags for create and delete operations on data
+// nodes which are present and missing. The edit is not complete on
+// error, so EditConfig is called by the edit function passed to
+// Datastore.Update, which discards the tree.
+func EditConfig(root, edit dom.Node, c *modules.Collection, op EditOperation) error {
+	return configEdit{c}.children(root, edit, nil, op)
+}
+
+type configEdit struct{ c *modules.Collection }
+
+// children applies the element children of src, whose parent's schema
+// node is e, or nil for the document, to their siblings under dst.
+func (ce configEdit) children(dst, src dom.Node, e *yang.Entry, op EditOperation) error {
+	var children []dom.Node
+	for it := src.FirstChild(); it != nil; it = it.NextSibling() {
+		if it.NodeType() == dom.NodeTypeElement {
+			children = append(children, it)
+		}
+	}
+	for _, n := range children {
+		var ne *yang.Entry
+		if e == nil {
+			ne = rootEntry(ce.c, n.Name())
+		} else {
+			ne = ce.c.DataChild(e, n.Name().Local)
+		}
+		if ne == nil {
+			return ce.error(n, ErrorTagUnknownElement, "unknown element %s", n.Name().Local)
+		}
+		if err := ce.node(dst, n, ne, op); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// node applies the edit node n, of schema node e, to its matching
+// child of dst, with the operation op unless n has one of its own.
+func (ce configEdit) node(dst, n dom.Node, e *yang.Entry, op EditOperation) error {
+	if attr := operationAttr(n); attr != nil {
+		var err error
+		if op, err = ParseEditOperation(attr.Value()); err != nil || op == EditNone {
+			return ce.error(n, ErrorTagBadAttribute, "bad operation %q on %s", attr.Value(), n.Name().Local)
+		}
+	}
+	pos, err := ce.position(n, e)
+	if err != nil {
+		return err
+	}
+	var match dom.Node
+	for it := dst.FirstChild(); it != nil; it = it.NextSibling() {
+		if it.NodeType() == dom.NodeTypeElement && sameDataNode(e, it, n) {
+			match = it
+			break
+		}
+	}
+
+	switch op {
+	case EditCreate:
+		if match != nil {
+			return ce.error(n, ErrorTagDataExists, "%s already exists", n.Name().Local)
+		}
+		return ce.add(dst, configCopy(n), n, pos)
+	case EditDelete, EditRemove:
+		if match == nil {
+			if op == EditDelete {
+				return ce.error(n, ErrorTagDataMissing, "%s does not exist", n.Name().Local)
+			}
+			return nil
+		}
+		return dst.RemoveChild(match)
+	case EditReplace:
+		if match == nil {
+			return ce.add(dst, configCopy(n), n, pos)
+		}
+		c := configCopy(n)
+		if err := dst.InsertChildAfter(c, match); err != nil {
+			return err
+		}
+		if err := dst.RemoveChild(match); err != nil || pos == nil {
+			return err
+		}
+		return ce.add(dst, c, n, pos)
+	case EditMerge, EditNone:
+	default:
+		return ce.error(n, ErrorTagBadAttribute, "unsupported operation %s", op)
+	}
+
+	// merge and none
+	if e.Kind != yang.DirectoryEntry {
+		switch {
+		case op == EditNone:
+		case match == nil:
+			return ce.add(dst, configCopy(n), n, pos)
+		case e.IsLeafList():
+			if pos != nil {
+				return ce.add(dst, match, n, pos)
+			}
+		default:
+			for it := match.FirstChild(); it != nil; it = match.FirstChild() {
+				if err := match.RemoveChild(it); err != nil {
+					return err
+				}
+			}
+			for it := n.FirstChild(); it != nil; it = it.NextSibling() {
+				if err := match.AppendChild(configCopy(it)); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	created := match == nil
+	if created {
+		// a new container or list entry, with the list's keys
+		if err := dst.AppendChild(dom.CreateElement(xml.StartElement{Name: n.Name()})); err != nil {
+			return err
+		}
+		match = dst.LastChild()
+		for _, key := range listKeys(e) {
+			if k := n.ChildByName(xml.Name{Space: n.Name().Space, Local: key}); k != nil {
+				if err := match.AppendChild(configCopy(k)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if err := ce.children(match, n, e, op); err != nil {
+		return err
+	}
+	if created && op == EditNone && !hasContent(match, e) {
+		// only created as the ancestor of deleted data
+		return dst.RemoveChild(match)
+	}
+	return nil
+}
+
+func (ce configEdit) error(n dom.Node, tag ErrorTag, format string, args ...interface{}) error {
+	return &DecodeError{
+		Path:    dataPath(ce.c, n),
+		Element: n.Name().Local,
+		Tag:     tag,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+// position returns the position of the edit node n, of schema node e,
+// given by its insert and value attributes, or nil if it has none.
+func (ce configEdit) position(n dom.Node, e *yang.Entry) (*position, error) {
+	insert := attrNamed(n, InsertAttr)
+	if insert == nil {
+		return nil, nil
+	}
+	if !OrderedByUser(e) {
+		return nil, ce.error(n, ErrorTagBadAttribute, "insert on %s, which is not ordered-by user", n.Name().Local)
+	}
+	if !e.IsLeafList() {
+		// list entries are appended; the key attribute is not supported
+		return nil, nil
+	}
+	where, err := ParseInsert(insert.Value())
+	if err != nil {
+		return nil, ce.error(n, ErrorTagBadAttribute, "bad insert %q on %s", insert.Value(), n.Name().Local)
+	}
+	pos := &position{where: where}
+	if where == InsertBefore || where == InsertAfter {
+		value := attrNamed(n, ValueAttr)
+		if value == nil {
+			return nil, ce.error(n, ErrorTagMissingAttribute, "insert %s on %s requires a value", where, n.Name().Local)
+		}
+		pos.point = value.Value()
+	}
+	return pos, nil
+}
+
+// position is the position of an ordered-by user leaf-list entry.
+type position struct {
+	where Insert
+	point string
+}
+
+// add inserts the leaf-list entry c, the copy of the edit node n or an
+// entry of dst to move, at the position pos in dst. Without a
+// position, c is appended.
+func (ce configEdit) add(dst, c, n dom.Node, pos *position) error {
+	if pos == nil {
+		return dst.AppendChild(c)
+	}
+	err := LeafList{Parent: dst, Name: n.Name()}.Insert(c, pos.where, pos.point)
+	if de, ok := err.(*DecodeError); ok {
+		de.Path, de.Element = dataPath(ce.c, n), n.Name().Local
+	}
+	return err
+}
+
+// operationAttr returns the operation attribute of n, or nil.
+func operationAttr(n dom.Node) dom.Node { return attrNamed(n, OperationAttr) }
+
+// attrNamed returns the attribute of n with the name, or nil.
+func attrNamed(n dom.Node, name xml.Name) dom.Node {
+	ap, ok := n.(dom.AttributeProvider)
+	if !ok {
+		return nil
+	}
+	for a := dom.Node(ap.FirstAttribute()); a != nil; a = a.NextSibling() {
+		if a.Name() == name {
+			return a
+		}
+	}
+	return nil
+}
+
+// editAttrs are the names of the attributes of edit nodes which are
+// not copied to the data tree.
+var editAttrs = map[xml.Name]bool{OperationAttr: true, InsertAttr: true, ValueAttr: true}
+
+// configCopy returns a deep copy of n without edit attributes.
+func configCopy(n dom.Node) dom.Node {
+	if n.NodeType() != dom.NodeTypeElement {
+		return dom.CloneNode(n, true)
+	}
+	se := xml.StartElement{Name: n.Name()}
+	if ap, ok := n.(dom.AttributeProvider); ok {
+		for a := dom.Node(ap.FirstAttribute()); a != nil; a = a.NextSibling() {
+			if !editAttrs[a.Name()] {
+				se.Attr = append(se.Attr, xml.Attr{Name: a.Name(), Value: a.Value()})
+			}
+		}
+	}
+	c := dom.CreateElement(se)
+	for it := n.FirstChild(); it != nil; it = it.NextSibling() {
+		_ = c.AppendChild(configCopy(it))
+	}
+	return c
+}
+
+// listKeys returns the key leaf names of the list e, or nil if e is
+// not a list.
+func listKeys(e *yang.Entry) []string {
+	if !e.IsList() {
+		return nil
+	}
+	return strings.Fields(e.Key)
+}
+
+// hasContent returns true if n, of schema node e, has element
+// children other than list keys.
+func hasContent(n dom.Node, e *yang.Entry) bool {
+	keys := map[string]bool{}
+	for _, key := range listKeys(e) {
+		keys[key] = true
+	}
+	for it := n.FirstChild(); it != nil; it = it.NextSibling() {
+		if it.NodeType() == dom.NodeTypeElement && !keys[it.Name().Local] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,225 @@
+package datastore
+
+import (
+	"testing"
+
+	"github.com/andaru/flexml"
+	"github.com/andaru/opr8/dom"
+)
+
+func TestEditConfig(t *testing.T) {
+	c := newTestCollection(t)
+	const (
+		nc      = `xmlns:nc="urn:ietf:params:xml:ns:netconf:base:1.0"`
+		initial = `<refs xmlns="urn:mod2">` +
+			`<server><name>a</name><port>1</port></server>` +
+			`<server><name>b</name><port>2</port></server>` +
+			`<tag>x</tag></refs>`
+	)
+	for _, tt := range []struct {
+		name    string
+		edit    string
+		op      EditOperation
+		want    string
+		wantTag ErrorTag
+	}{
+		{
+			name: "merge",
+			edit: `<refs xmlns="urn:mod2"><server><name>a</name><port>10</port></server>` +
+				`<server><name>c</name><port>3</port></server><tag>x</tag><tag>y</tag></refs>`,
+			want: `<refs xmlns="urn:mod2">` +
+				`<server><name>a</name><port>10</port></server>` +
+				`<server><name>b</name><port>2</port></server>` +
+				`<tag>x</tag><server><name>c</name><port>3</port></server><tag>y</tag></refs>`,
+		},
+		{
+			name: "replace",
+			edit: `<refs xmlns="urn:mod2"><server><name>b</name></server></refs>`,
+			op:   EditReplace,
+			want: `<refs xmlns="urn:mod2"><server><name>b</name></server></refs>`,
+		},
+		{
+			name: "replace list entry",
+			edit: `<refs xmlns="urn:mod2" ` + nc + `><server nc:operation="replace"><name>a</name></server></refs>`,
+			want: `<refs xmlns="urn:mod2">` +
+				`<server><name>a</name></server>` +
+				`<server><name>b</name><port>2</port></server>` +
+				`<tag>x</tag></refs>`,
+		},
+		{
+			name: "delete with none",
+			edit: `<refs xmlns="urn:mod2" ` + nc + `><server nc:operation="delete"><name>a</name></server>` +
+				`<tag nc:operation="remove">z</tag></refs>`,
+			op: EditNone,
+			want: `<refs xmlns="urn:mod2">` +
+				`<server><name>b</name><port>2</port></server>` +
+				`<tag>x</tag></refs>`,
+		},
+		{
+			name: "none creates no ancestors",
+			edit: `<ordered xmlns="urn:mod2" ` + nc + `><entry nc:operation="remove"><id>1</id></entry></ordered>`,
+			op:   EditNone,
+			want: initial,
+		},
+		{
+			name: "create",
+			edit: `<refs xmlns="urn:mod2" ` + nc + `><server nc:operation="create"><name>c</name></server></refs>`,
+			want: `<refs xmlns="urn:mod2">` +
+				`<server><name>a</name><port>1</port></server>` +
+				`<server><name>b</name><port>2</port></server>` +
+				`<tag>x</tag><server><name>c</name></server></refs>`,
+		},
+		{
+			name:    "create existing",
+			edit:    `<refs xmlns="urn:mod2" ` + nc + `><server nc:operation="create"><name>a</name></server></refs>`,
+			wantTag: ErrorTagDataExists,
+		},
+		{
+			name:    "delete missing",
+			edit:    `<refs xmlns="urn:mod2" ` + nc + `><tag nc:operation="delete">z</tag></refs>`,
+			wantTag: ErrorTagDataMissing,
+		},
+		{
+			name:    "bad operation",
+			edit:    `<refs xmlns="urn:mod2" ` + nc + `><tag nc:operation="none">x</tag></refs>`,
+			wantTag: ErrorTagBadAttribute,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, root := decodeXML(t, c, initial)
+			_, edit := decodeXML(t, c, tt.edit)
+			err := EditConfig(root, edit, c, tt.op)
+			if tt.wantTag != "" {
+				if de, ok := err.(*DecodeError); !ok || de.Tag != tt.wantTag {
+					t.Errorf("EditConfig() error = %v, want tag %s", err, tt.wantTag)
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("EditConfig() error = %v", err)
+			}
+			b, err := flexml.Marshal(dom.NewMarshaler(root))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != tt.want {
+				t.Errorf("EditConfig() tree:\n%s\nwant:\n%s", b, tt.want)
+			}
+		})
+	}
+
+	// elements unknown to the schema, which the decoder skips
+	_, root := decodeXML(t, c, initial)
+	edit := dom.NewDocument(nil)
+	_ = edit.AppendChild(dom.CreateElement(flexml.StartElement{Name: flexml.Name{Space: "urn:mod2", Local: "unknown"}}))
+	if err := EditConfig(root, edit, c, EditMerge); err == nil || err.(*DecodeError).Tag != ErrorTagUnknownElement {
+		t.Errorf("EditConfig() of an unknown element error = %v, want tag %s", err, ErrorTagUnknownElement)
+	}
+}
+
+func TestEditConfig_insert(t *testing.T) {
+	c := newTestCollection(t)
+	const (
+		nc      = `xmlns:nc="urn:ietf:params:xml:ns:netconf:base:1.0"`
+		yang    = `xmlns:yang="urn:ietf:params:xml:ns:yang:1"`
+		initial = `<refs xmlns="urn:mod2"><priority>a</priority><tag>x</tag><priority>b</priority><priority>c</priority></refs>`
+	)
+	for _, tt := range []struct {
+		name    string
+		edit    string
+		want    string
+		wantTag ErrorTag
+	}{
+		{
+			name: "last by default",
+			edit: `<refs xmlns="urn:mod2"><priority>d</priority></refs>`,
+			want: `<refs xmlns="urn:mod2"><priority>a</priority><tag>x</tag><priority>b</priority><priority>c</priority><priority>d</priority></refs>`,
+		},
+		{
+			name: "first",
+			edit: `<refs xmlns="urn:mod2" ` + yang + `><priority yang:insert="first">d</priority></refs>`,
+			want: `<refs xmlns="urn:mod2"><priority>d</priority><priority>a</priority><tag>x</tag><priority>b</priority><priority>c</priority></refs>`,
+		},
+		{
+			name: "before",
+			edit: `<refs xmlns="urn:mod2" ` + yang + `><priority yang:insert="before" yang:value="b">d</priority></refs>`,
+			want: `<refs xmlns="urn:mod2"><priority>a</priority><tag>x</tag><priority>d</priority><priority>b</priority><priority>c</priority></refs>`,
+		},
+		{
+			name: "after",
+			edit: `<refs xmlns="urn:mod2" ` + yang + `><priority yang:insert="after" yang:value="a">d</priority></refs>`,
+			want: `<refs xmlns="urn:mod2"><priority>a</priority><priority>d</priority><tag>x</tag><priority>b</priority><priority>c</priority></refs>`,
+		},
+		{
+			name: "merge moves an existing entry",
+			edit: `<refs xmlns="urn:mod2" ` + yang + `><priority yang:insert="first">c</priority></refs>`,
+			want: `<refs xmlns="urn:mod2"><priority>c</priority><priority>a</priority><tag>x</tag><priority>b</priority></refs>`,
+		},
+		{
+			name: "replace moves an existing entry",
+			edit: `<refs xmlns="urn:mod2" ` + nc + ` ` + yang + `><priority nc:operation="replace" yang:insert="last">a</priority></refs>`,
+			want: `<refs xmlns="urn:mod2"><tag>x</tag><priority>b</priority><priority>c</priority><priority>a</priority></refs>`,
+		},
+		{
+			name: "move after itself",
+			edit: `<refs xmlns="urn:mod2" ` + yang + `><priority yang:insert="after" yang:value="b">b</priority></refs>`,
+			want: initial,
+		},
+		{
+			name:    "create after itself",
+			edit:    `<refs xmlns="urn:mod2" ` + nc + ` ` + yang + `><priority nc:operation="create" yang:insert="after" yang:value="d">d</priority></refs>`,
+			wantTag: ErrorTagBadAttribute,
+		},
+		{
+			name:    "missing instance",
+			edit:    `<refs xmlns="urn:mod2" ` + yang + `><priority yang:insert="before" yang:value="z">d</priority></refs>`,
+			wantTag: ErrorTagBadAttribute,
+		},
+		{
+			name:    "missing value",
+			edit:    `<refs xmlns="urn:mod2" ` + yang + `><priority yang:insert="after">d</priority></refs>`,
+			wantTag: ErrorTagMissingAttribute,
+		},
+		{
+			name:    "bad insert",
+			edit:    `<refs xmlns="urn:mod2" ` + yang + `><priority yang:insert="middle">d</priority></refs>`,
+			wantTag: ErrorTagBadAttribute,
+		},
+		{
+			name:    "ordered-by system",
+			edit:    `<refs xmlns="urn:mod2" ` + yang + `><tag yang:insert="first">y</tag></refs>`,
+			wantTag: ErrorTagBadAttribute,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, root := decodeXML(t, c, initial)
+			_, edit := decodeXML(t, c, tt.edit)
+			err := EditConfig(root, edit, c, EditMerge)
+			if tt.wantTag != "" {
+				if de, ok := err.(*DecodeError); !ok || de.Tag != tt.wantTag || de.Path != "/module2:refs/priority[.='d']" && de.Path != "/module2:refs/tag[.='y']" {
+					t.Errorf("EditConfig() error = %#v, want tag %s", err, tt.wantTag)
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("EditConfig() error = %v", err)
+			}
+			b, err := flexml.Marshal(dom.NewMarshaler(root))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != tt.want {
+				t.Errorf("EditConfig() tree:\n%s\nwant:\n%s", b, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseEditOperation(t *testing.T) {
+	for _, op := range []EditOperation{EditMerge, EditReplace, EditDelete, EditCreate, EditRemove, EditNone} {
+		if got, err := ParseEditOperation(op.String()); err != nil || got != op {
+			t.Errorf("ParseEditOperation(%q) = %v, %v, want %v", op.String(), got, err, op)
+		}
+	}
+	if _, err := ParseEditOperation("insert"); err == nil {
+		t.Error(`ParseEditOperation("insert") error = nil, want an error`)
+	}
+}
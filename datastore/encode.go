@@ -0,0 +1,84 @@
+package datastore
+
+import (
+	"github.com/andaru/opr8/dom"
+	"github.com/andaru/opr8/modules"
+	"github.com/openconfig/goyang/pkg/yang"
+)
+
+// EncodeOption is an option of the XML and JSON encoding of data
+// nodes.
+type EncodeOption func(*encodeOptions)
+
+type encodeOptions struct {
+	keysFirst bool
+}
+
+// WithKeysFirst causes the key leaves of each list entry to be
+// encoded before its other children, in the order of the list's key
+// statement, whatever their order in the data tree. RFC 7950 requires
+// this order of list entries encoded as XML.
+func WithKeysFirst() EncodeOption { return func(o *encodeOptions) { o.keysFirst = true } }
+
+func newEncodeOptions(options []EncodeOption) encodeOptions {
+	var o encodeOptions
+	for _, opt := range options {
+		opt(&o)
+	}
+	return o
+}
+
+// NewMarshaler returns a marshaler of the XML encoding of the node n,
+// in a data tree with the schema of the collection c, with the
+// options given.
+func NewMarshaler(c *modules.Collection, n dom.Node, options ...EncodeOption) *dom.Marshaler {
+	if o := newEncodeOptions(options); o.keysFirst {
+		// the schema nodes of the elements yet to be encoded, found
+		// from their parent's as it is encoded
+		schemas := map[dom.Node]*yang.Entry{}
+		return dom.NewMarshaler(n, dom.WithLeadingChildren(func(parent dom.Node) []dom.Node {
+			e, ok := schemas[parent]
+			if ok {
+				delete(schemas, parent)
+			} else {
+				e = schemaOf(c, parent)
+			}
+			for it := parent.FirstChild(); it != nil; it = it.NextSibling() {
+				if it.FirstChild() != nil {
+					var ce *yang.Entry
+					if e != nil {
+						ce = c.DataChild(e, it.Name().Local)
+					}
+					schemas[it] = ce
+				}
+			}
+			return keyNodes(c, parent, e)
+		}))
+	}
+	return dom.NewMarshaler(n)
+}
+
+// keyNodes returns the key leaves of the list entry n, of schema node
+// e, in key order, or nil if n is not a list entry.
+func keyNodes(c *modules.Collection, n dom.Node, e *yang.Entry) []dom.Node {
+	if e == nil || !e.IsList() {
+		return nil
+	}
+	rank := keyRank(c, e)
+	keys := make([]dom.Node, len(listKeys(e)))
+	for it := n.FirstChild(); it != nil; it = it.NextSibling() {
+		if it.NodeType() != dom.NodeTypeElement {
+			continue
+		}
+		if i := rank(it.Name()); i < len(keys) && keys[i] == nil {
+			keys[i] = it
+		}
+	}
+	found := keys[:0]
+	for _, k := range keys {
+		if k != nil {
+			found = append(found, k)
+		}
+	}
+	return found
+}
@@ -0,0 +1,65 @@
+package datastore
+
+import (
+	"testing"
+
+	"github.com/andaru/flexml"
+	"github.com/andaru/opr8/dom"
+)
+
+func TestWithKeysFirst(t *testing.T) {
+	c := newTestCollection(t)
+	_, doc := decodeXML(t, c, `<ordered xmlns="urn:mod2"><entry><value>v</value><id>1</id></entry><entry><id>2</id></entry></ordered>`+
+		`<refs xmlns="urn:mod2"><server><port>1</port><name>a</name></server></refs>`)
+	entry := doc.FirstChild().FirstChild()
+
+	for _, tt := range []struct {
+		name             string
+		options          []EncodeOption
+		xml, json, value string
+		entry            string
+	}{
+		{
+			name: "document order",
+			xml: `<ordered xmlns="urn:mod2"><entry><value>v</value><id>1</id></entry><entry><id>2</id></entry></ordered>` +
+				`<refs xmlns="urn:mod2"><server><port>1</port><name>a</name></server></refs>`,
+			json:  `{"module2:ordered":{"entry":[{"value":"v","id":"1"},{"id":"2"}]},"module2:refs":{"server":[{"port":1,"name":"a"}]}}`,
+			value: `{"value":"v","id":"1"}`,
+			entry: `<entry><value>v</value><id>1</id></entry>`,
+		},
+		{
+			name:    "keys first",
+			options: []EncodeOption{WithKeysFirst()},
+			xml: `<ordered xmlns="urn:mod2"><entry><id>1</id><value>v</value></entry><entry><id>2</id></entry></ordered>` +
+				`<refs xmlns="urn:mod2"><server><name>a</name><port>1</port></server></refs>`,
+			json:  `{"module2:ordered":{"entry":[{"id":"1","value":"v"},{"id":"2"}]},"module2:refs":{"server":[{"name":"a","port":1}]}}`,
+			value: `{"id":"1","value":"v"}`,
+			entry: `<entry><id>1</id><value>v</value></entry>`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := flexml.Marshal(NewMarshaler(c, doc, tt.options...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != tt.xml {
+				t.Errorf("XML:\n%s\nwant:\n%s", b, tt.xml)
+			}
+			if b, err = flexml.Marshal(NewMarshaler(c, entry, tt.options...)); err != nil {
+				t.Fatal(err)
+			} else if string(b) != tt.entry {
+				t.Errorf("XML of entry:\n%s\nwant:\n%s", b, tt.entry)
+			}
+			var top []dom.Node
+			for it := doc.FirstChild(); it != nil; it = it.NextSibling() {
+				top = append(top, it)
+			}
+			if got := string(MarshalJSON(c, top, tt.options...)); got != tt.json {
+				t.Errorf("MarshalJSON():\n%s\nwant:\n%s", got, tt.json)
+			}
+			if got := string(MarshalJSONValue(c, []dom.Node{entry}, tt.options...)); got != tt.value {
+				t.Errorf("MarshalJSONValue() = %s, want %s", got, tt.value)
+			}
+		})
+	}
+}
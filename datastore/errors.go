@@ -0,0 +1,100 @@
+package datastore
+
+import (
+	"fmt"
+)
+
+// ErrorTag is an RFC 6241 rpc-error error-tag value describing the
+// class of a decoding error.
+type ErrorTag string
+
+const (
+	// ErrorTagUnknownElement indicates an unexpected element was
+	// found in the input.
+	ErrorTagUnknownElement ErrorTag = "unknown-element"
+	// ErrorTagUnknownNamespace indicates an element was found in an
+	// unexpected namespace, or a module name was not known.
+	ErrorTagUnknownNamespace ErrorTag = "unknown-namespace"
+	// ErrorTagBadElement indicates an element is known, but is not
+	// valid in its position (e.g., text found under a container).
+	ErrorTagBadElement ErrorTag = "bad-element"
+	// ErrorTagInvalidValue indicates a leaf value does not match
+	// its schema type.
+	ErrorTagInvalidValue ErrorTag = "invalid-value"
+	// ErrorTagDataMissing indicates data required by the schema,
+	// such as the instance referred to by an instance-identifier, is
+	// missing.
+	ErrorTagDataMissing ErrorTag = "data-missing"
+	// ErrorTagDataExists indicates data a create operation was to
+	// add is already present.
+	ErrorTagDataExists ErrorTag = "data-exists"
+	// ErrorTagBadAttribute indicates an attribute value is not
+	// correct, such as an unknown edit operation.
+	ErrorTagBadAttribute ErrorTag = "bad-attribute"
+	// ErrorTagMissingAttribute indicates an expected attribute, such
+	// as the value attribute of an insert before another entry, is
+	// missing.
+	ErrorTagMissingAttribute ErrorTag = "missing-attribute"
+	// ErrorTagMissingElement indicates an expected element, such as
+	// a list key, is missing.
+	ErrorTagMissingElement ErrorTag = "missing-element"
+	// ErrorTagOperationFailed indicates the request could not be
+	// completed for a reason not covered by any other error-tag,
+	// such as a failed custom validation.
+	ErrorTagOperationFailed ErrorTag = "operation-failed"
+)
+
+// ErrorSeverity is an RFC 6241 rpc-error error-severity value.
+type ErrorSeverity int
+
+const (
+	// SeverityError is an error which prevents use of the data.
+	SeverityError ErrorSeverity = iota
+	// SeverityWarning is advisory; the data remains usable.
+	SeverityWarning
+)
+
+func (s ErrorSeverity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	default:
+		return fmt.Sprintf("UNKNOWN(%d)", s)
+	}
+}
+
+// DecodeError is a YANG data decoding error. It carries enough
+// context for callers to construct an RFC 6241 rpc-error reply.
+type DecodeError struct {
+	// Path is the data instance path of the offending node, e.g.,
+	// "/module1:system/host-name".
+	Path string
+	// SchemaPath is the schema node identifier of the deepest schema
+	// node known at the time of the error.
+	SchemaPath string
+	// Element is the local name of the offending element, suitable
+	// for use as the rpc-error error-info bad-element value.
+	Element string
+
+	Tag      ErrorTag
+	Severity ErrorSeverity
+	// AppTag is the optional rpc-error error-app-tag value, e.g.,
+	// "instance-required".
+	AppTag  string
+	Message string
+
+	// Err is the underlying cause of the error, if any.
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+// Cause returns the underlying cause of the error, if any.
+func (e *DecodeError) Cause() error { return e.Err }
@@ -0,0 +1,57 @@
+package datastore
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/andaru/opr8/dom"
+	"github.com/andaru/opr8/modules"
+	"github.com/pkg/errors"
+)
+
+// Builder populates an empty data tree with the content of a new
+// datastore.
+type Builder func(root dom.Document) error
+
+// NewFactoryDefault returns the read-only factory-default datastore
+// (RFC 8808) for the collection, with the content added by build.
+func NewFactoryDefault(c *modules.Collection, build Builder) (*Datastore, error) {
+	ds := New(FactoryDefault, c, WithReadOnly())
+	root := dom.NewDocument(nil)
+	if err := build(root); err != nil {
+		return nil, errors.Wrap(err, "failed to build factory-default datastore")
+	}
+	ds.publish(root, nil, 0, "")
+	return ds, nil
+}
+
+// FileBuilder returns a Builder decoding the YANG data in the file at
+// path, using the YANG/JSON encoding if the file name has a ".json"
+// extension and YANG/XML otherwise. Any decoding error fails the
+// build.
+func FileBuilder(c *modules.Collection, path string) Builder {
+	return func(root dom.Document) error {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		td := &Decoder{Node: root, Modules: c}
+		un := dom.NewUnmarshaler(td)
+		reader := un.XMLReader()
+		un.InitializeArgs = []string{"mediatype", "application/yang-data+xml"}
+		if strings.EqualFold(filepath.Ext(path), ".json") {
+			reader = un.JSONReader()
+			un.InitializeArgs = []string{"mediatype", "application/yang-data+json"}
+		}
+		if _, err := reader.ReadFrom(f); err != nil {
+			return errors.Wrapf(err, "%s", path)
+		}
+		if errs := td.DecodingErrors(); len(errs) > 0 {
+			return errors.Wrapf(errs[0], "%s: %d decoding errors, first", path, len(errs))
+		}
+		return nil
+	}
+}
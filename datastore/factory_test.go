@@ -0,0 +1,57 @@
+package datastore
+
+import (
+	"testing"
+
+	"github.com/andaru/flexml"
+	"github.com/andaru/opr8/dom"
+)
+
+func TestFactoryReset(t *testing.T) {
+	c := newTestCollection(t)
+	factory, err := NewFactoryDefault(c, FileBuilder(c, "testdata/factory-default.xml"))
+	if err != nil {
+		t.Fatalf("NewFactoryDefault() error = %v, wantErr false", err)
+	}
+	if _, err := factory.Update(0, "", func(dom.Document) error { return nil }); err == nil {
+		t.Errorf("factory-default Update() error = nil, wantErr true")
+	}
+	if _, err := NewFactoryDefault(c, FileBuilder(c, "testdata/nonexistent.xml")); err == nil {
+		t.Errorf("NewFactoryDefault() with missing file error = nil, wantErr true")
+	}
+
+	running := New(Running, c, WithHistory(0))
+	startup := New(Startup, c)
+	for _, ds := range []*Datastore{running, startup} {
+		if _, err := ds.Update(1, "", setSystem("configured")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	set := NewSet(running, startup)
+	if _, err := set.Reset(Running, 1); err == nil {
+		t.Errorf("Reset() without factory-default error = nil, wantErr true")
+	}
+	set.Add(factory)
+	if _, err := set.Reset("bogus", 1); err == nil {
+		t.Errorf("Reset() of unknown datastore error = nil, wantErr true")
+	}
+
+	if err := set.FactoryReset(2); err != nil {
+		t.Fatalf("FactoryReset() error = %v, wantErr false", err)
+	}
+	want := `<system xmlns="urn:mod1"><host-name>factory</host-name></system><refs xmlns="urn:mod2"><tag>default</tag></refs>`
+	for _, ds := range []*Datastore{running, startup} {
+		b, err := flexml.Marshal(dom.NewMarshaler(ds.Snapshot().Root))
+		if err != nil {
+			t.Fatalf("xml.Marshal(%s) error: %v, wantErr false", ds.Name(), err)
+		} else if string(b) != want {
+			t.Errorf("%s after FactoryReset() got:\n%s\nwant:\n%s\n", ds.Name(), b, want)
+		}
+	}
+	if rev, _ := running.History().Revision(0); rev.Session != 2 {
+		t.Errorf("reset revision session = %d, want 2", rev.Session)
+	}
+	if factory.Snapshot().Root.FirstChild() == running.Snapshot().Root.FirstChild() {
+		t.Errorf("running shares nodes with factory-default")
+	}
+}
@@ -0,0 +1,158 @@
+package datastore
+
+import (
+	"net/url"
+	"strings"
+
+	xml "github.com/andaru/flexml"
+	"github.com/andaru/opr8/dom"
+	"github.com/andaru/opr8/modules"
+	"github.com/openconfig/goyang/pkg/yang"
+	"github.com/pkg/errors"
+)
+
+// Find returns the data node addressed by the RESTCONF (RFC 8040)
+// data resource identifier path, e.g.,
+// "/ietf-interfaces:interfaces/interface=eth0/mtu", in the Document
+// root, whose schema is that of the collection c. The path is parsed
+// by ParseAPIPath, and must address a single data node: list entries
+// require their keys, and leaf-list entries their value.
+func Find(root dom.Node, c *modules.Collection, path string) (dom.Node, error) {
+	if root == nil || c == nil {
+		return nil, errors.New("find requires a root node and module collection")
+	}
+	if root.NodeType() != dom.NodeTypeDocument {
+		return nil, errors.New("find requires a Document root")
+	}
+	id, e, err := ParseAPIPath(path, c)
+	if err != nil {
+		return nil, err
+	}
+	if len(id) == 0 {
+		return root, nil
+	}
+	if len(id[len(id)-1].Keys) == 0 && (e.IsLeafList() || len(listKeys(e)) > 0) {
+		return nil, errors.Errorf("invalid path %q: %s requires a key or value", path, e.Name)
+	}
+	return id.Resolve(root)
+}
+
+// ParseAPIPath returns the instance identifier of the RESTCONF (RFC
+// 8040) data resource identifier path, e.g.,
+// "/ietf-interfaces:interfaces/interface=eth0", and the schema node it
+// addresses, with the schema of the collection c. The first segment,
+// and each whose module differs from its parent's, is qualified by its
+// module name. List entries are addressed by all of their keys, and
+// leaf-list entries by their value; only the last segment may omit
+// them, to address every entry. The empty path, or "/", addresses the
+// datastore's root, for which the identifier and schema node are nil.
+func ParseAPIPath(path string, c *modules.Collection) (InstanceID, *yang.Entry, error) {
+	if path == "" || path == "/" {
+		return nil, nil, nil
+	}
+	segments := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	var id InstanceID
+	var e *yang.Entry
+	var ns string
+	for i, segment := range segments {
+		name, keys, err := parseSegment(segment)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "invalid path %q", path)
+		}
+		module := name.Space
+		if module == "" && e == nil {
+			return nil, nil, errors.Errorf("invalid path %q: first segment %q has no module name", path, segment)
+		} else if module != "" {
+			if ns = moduleNamespace(c, module); ns == "" {
+				return nil, nil, errors.Errorf("invalid path %q: unknown module %q", path, module)
+			}
+		}
+		var next *yang.Entry
+		if e == nil {
+			next = gnmiRootEntry(c, module, name.Local)
+		} else {
+			next = c.DataChild(e, name.Local)
+		}
+		if next == nil || next.Namespace().Name != ns {
+			return nil, nil, errors.Errorf("invalid path %q: unknown node %q", path, segment)
+		}
+		e = next
+
+		step := InstanceIDElem{Name: xml.Name{Space: ns, Local: e.Name}}
+		last := i == len(segments)-1
+		switch {
+		case e.IsList():
+			names := listKeys(e)
+			if len(keys) != len(names) && (len(keys) > 0 || !last) {
+				return nil, nil, errors.Errorf("invalid path %q: list %s requires keys %v", path, e.Name, names)
+			}
+			for j, key := range keys {
+				step.Keys = append(step.Keys, InstanceIDKey{Name: xml.Name{Space: ns, Local: names[j]}, Value: key})
+			}
+		case e.IsLeafList():
+			if len(keys) > 1 || len(keys) == 0 && !last {
+				return nil, nil, errors.Errorf("invalid path %q: leaf-list %s requires a value", path, e.Name)
+			}
+			for _, key := range keys {
+				step.Keys = append(step.Keys, InstanceIDKey{Name: xml.Name{Local: "."}, Value: key})
+			}
+		case len(keys) > 0:
+			return nil, nil, errors.Errorf("invalid path %q: %s is not a list or leaf-list", path, e.Name)
+		}
+		id = append(id, step)
+	}
+	return id, e, nil
+}
+
+// FormatAPIPath returns the RESTCONF data resource identifier of id,
+// the inverse of ParseAPIPath, with the module names of the collection
+// c. Key values are percent-encoded.
+func FormatAPIPath(id InstanceID, c *modules.Collection) string {
+	var b strings.Builder
+	var ns string
+	for _, elem := range id {
+		b.WriteByte('/')
+		if elem.Name.Space != ns {
+			ns = elem.Name.Space
+			module := ns
+			if m, err := c.ModuleByNamespace(ns); err == nil {
+				module = m.Name
+			}
+			b.WriteString(module + ":")
+		}
+		b.WriteString(elem.Name.Local)
+		for i, key := range elem.Keys {
+			if i == 0 {
+				b.WriteByte('=')
+			} else {
+				b.WriteByte(',')
+			}
+			b.WriteString(strings.Replace(url.PathEscape(key.Value), ",", "%2C", -1))
+		}
+	}
+	return b.String()
+}
+
+// parseSegment parses an api-path segment, "[module:]name[=key,...]".
+// The returned name's Space field holds the module name, if present.
+func parseSegment(segment string) (name xml.Name, keys []string, err error) {
+	id := segment
+	if i := strings.IndexByte(segment, '='); i >= 0 {
+		id = segment[:i]
+		for _, key := range strings.Split(segment[i+1:], ",") {
+			value, err := url.PathUnescape(key)
+			if err != nil {
+				return name, nil, err
+			}
+			keys = append(keys, value)
+		}
+	}
+	if i := strings.IndexByte(id, ':'); i >= 0 {
+		name.Space, id = id[:i], id[i+1:]
+	}
+	if id == "" {
+		return name, nil, errors.Errorf("empty node name in segment %q", segment)
+	}
+	name.Local = id
+	return name, keys, nil
+}
@@ -0,0 +1,112 @@
+package datastore
+
+import (
+	"testing"
+)
+
+func TestFind(t *testing.T) {
+	c := newTestCollection(t)
+	_, doc := decodeXML(t, c, `<refs xmlns="urn:mod2">`+
+		`<server><name>a</name><port>1</port></server>`+
+		`<server><name>b/c</name><port>2</port></server>`+
+		`<tag>blue</tag><tag>red</tag></refs>`)
+
+	for _, tt := range []struct {
+		path      string
+		wantName  string
+		wantValue string
+		wantErr   bool
+	}{
+		{path: "/", wantName: ""},
+		{path: "/module2:refs", wantName: "refs"},
+		{path: "/module2:refs/server=a/port", wantName: "port", wantValue: "1"},
+		{path: "/module2:refs/server=b%2Fc/port", wantName: "port", wantValue: "2"},
+		{path: "/module2:refs/module2:server=a/name", wantName: "name", wantValue: "a"},
+		{path: "/module2:refs/tag=red", wantName: "tag", wantValue: "red"},
+		{path: "/module2:refs/server=z", wantErr: true},
+		{path: "/module2:refs/server", wantErr: true},
+		{path: "/module2:refs/server=a,b", wantErr: true},
+		{path: "/module2:refs/tag=green", wantErr: true},
+		{path: "/module2:refs/target", wantErr: true},
+		{path: "/module2:refs=a", wantErr: true},
+		{path: "/refs", wantErr: true},
+		{path: "/module1:system", wantErr: true},
+		{path: "/nosuchmodule:refs", wantErr: true},
+		{path: "/module2:refs/bogus", wantErr: true},
+		{path: "/module2:refs/tag", wantErr: true},
+		{path: "/module2:refs/module1:server=a", wantErr: true},
+		{path: "/module2:refs/module1:tag=red", wantErr: true},
+	} {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := Find(doc, c, tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Find() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.Name().Local != tt.wantName || got.ChildValue() != tt.wantValue {
+				t.Errorf("Find() = %s (%q), want %s (%q)", got.Name().Local, got.ChildValue(), tt.wantName, tt.wantValue)
+			}
+		})
+	}
+
+	t.Run("within a choice", func(t *testing.T) {
+		_, doc := decodeXML(t, c, `<ordered xmlns="urn:mod2"><alpha>x</alpha></ordered>`)
+		got, err := Find(doc, c, "/module2:ordered/alpha")
+		if err != nil {
+			t.Fatalf("Find() error = %v, wantErr false", err)
+		}
+		if got.ChildValue() != "x" {
+			t.Errorf("Find() value = %q, want %q", got.ChildValue(), "x")
+		}
+	})
+
+	if _, err := Find(doc.FirstChild(), c, "/module2:refs"); err == nil {
+		t.Error("Find() of an element root error = nil, wantErr true")
+	}
+}
+
+func TestParseAPIPath(t *testing.T) {
+	c := newTestCollection(t)
+	prefix := func(ns string) string { return map[string]string{"urn:mod1": "module1", "urn:mod2": "module2"}[ns] }
+
+	for _, tt := range []struct {
+		path, want string
+		wantErr    bool
+	}{
+		{path: "/", want: ""},
+		{path: "/module2:refs", want: "/module2:refs"},
+		{path: "/module2:refs/server=a/port", want: "/module2:refs/server[name='a']/port"},
+		{path: "/module2:refs/server=b%2Cc", want: "/module2:refs/server[name='b,c']"},
+		{path: "/module2:refs/server", want: "/module2:refs/server"},
+		{path: "/module2:refs/tag=red", want: "/module2:refs/tag[.='red']"},
+		{path: "/module1:interfaces/interface=eth0/config/ip-address", want: "/module1:interfaces/interface[interface-name='eth0']/config/ip-address"},
+		{path: "/module2:refs/server/port", wantErr: true},
+		{path: "/module2:refs/server=a,b", wantErr: true},
+		{path: "/module2:refs/tag=a,b", wantErr: true},
+		{path: "/module2:refs=a", wantErr: true},
+		{path: "/module2:refs/module1:system", wantErr: true},
+		{path: "/refs", wantErr: true},
+		{path: "/nosuchmodule:refs", wantErr: true},
+	} {
+		t.Run(tt.path, func(t *testing.T) {
+			id, e, err := ParseAPIPath(tt.path, c)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseAPIPath() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := id.Format(prefix); got != tt.want {
+				t.Errorf("ParseAPIPath() = %s, want %s", got, tt.want)
+			}
+			if (e == nil) != (tt.want == "") || e != nil && e.Name != id[len(id)-1].Name.Local {
+				t.Errorf("ParseAPIPath() schema node = %v, want that of %s", e, tt.want)
+			}
+			if got := FormatAPIPath(id, c); tt.path != "/" && got != tt.path {
+				t.Errorf("FormatAPIPath() = %s, want %s", got, tt.path)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package datastore
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/andaru/opr8/dom"
+)
+
+func FuzzDecoder(f *testing.F) {
+	c := newTestCollection(f)
+	b, err := ioutil.ReadFile("testdata/factory-default.xml")
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(b, false)
+	for _, seed := range []string{
+		`<system xmlns="urn:mod1"><host-name>abc123</host-name><domain-name-servers>ns1.local</domain-name-servers></system>`,
+		`<interfaces xmlns="urn:mod1"><interface><interface-name>Ethernet1</interface-name><config><interface-name>Ethernet1</interface-name></config></interface></interfaces>`,
+		`<system xmlns="BAD:urn:mod1"><host-name>abc123</host-name></system>`,
+	} {
+		f.Add([]byte(seed), false)
+	}
+	for _, seed := range []string{
+		`{"module1:system":{"domain-name-servers":["ns1.local","ns2.local"],"host-name":"abc456"}}`,
+		`{"module1:interfaces": {"interface":[{"config":{"interface-name":"Ethernet1"}, "interface-name": "Ethernet1"}]}}`,
+		`{"module1:system": {"bad:host-name":"foo"}}`,
+	} {
+		f.Add([]byte(seed), true)
+	}
+	f.Fuzz(func(t *testing.T, b []byte, json bool) {
+		doc := dom.NewDocument(nil)
+		td := &Decoder{Node: doc, Modules: c}
+		un := dom.NewUnmarshaler(td)
+		var err error
+		if json {
+			un.InitializeArgs = []string{"mediatype", "application/yang-data+json"}
+			_, err = un.JSONReader().ReadFrom(bytes.NewReader(b))
+		} else {
+			un.InitializeArgs = []string{"mediatype", "application/yang-data+xml"}
+			_, err = un.XMLReader().ReadFrom(bytes.NewReader(b))
+		}
+		if err != nil {
+			return
+		}
+		var out bytes.Buffer
+		_, _ = dom.NewMarshaler(doc).XMLWriter().WriteTo(&out)
+	})
+}
@@ -0,0 +1,417 @@
+package datastore
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	xml "github.com/andaru/flexml"
+	"github.com/andaru/opr8/dom"
+	"github.com/andaru/opr8/modules"
+	"github.com/openconfig/gnmi/proto/gnmi"
+	"github.com/openconfig/goyang/pkg/yang"
+	"github.com/pkg/errors"
+)
+
+// SetRequestEdits converts the gNMI SetRequest req into edits of the
+// data tree with the schema of the collection c, to be applied by
+// ApplyEdits. As for gNMI, deletes come first, followed by replaces
+// and then updates, each in request order.
+//
+// Path element names may be qualified by their module name, as in
+// RFC 7951; top-level names without a module name are searched for in
+// every module. Values may be scalar or JSON (JSON_IETF or JSON)
+// encoded.
+func SetRequestEdits(req *gnmi.SetRequest, c *modules.Collection) ([]Edit, error) {
+	var edits []Edit
+	for _, path := range req.GetDelete() {
+		edit, err := gnmiEdit(c, req.GetPrefix(), path, nil, EditDelete)
+		if err != nil {
+			return nil, err
+		}
+		edits = append(edits, edit)
+	}
+	for _, op := range []struct {
+		updates []*gnmi.Update
+		op      EditOperation
+	}{
+		{req.GetReplace(), EditReplace},
+		{req.GetUpdate(), EditMerge},
+	} {
+		for _, update := range op.updates {
+			edit, err := gnmiEdit(c, req.GetPrefix(), update.GetPath(), update.GetVal(), op.op)
+			if err != nil {
+				return nil, err
+			}
+			edits = append(edits, edit)
+		}
+	}
+	return edits, nil
+}
+
+func gnmiEdit(c *modules.Collection, prefix, path *gnmi.Path, val *gnmi.TypedValue, op EditOperation) (Edit, error) {
+	elems := append(append([]*gnmi.PathElem(nil), prefix.GetElem()...), path.GetElem()...)
+	id, e, err := gnmiPath(c, elems)
+	if err != nil {
+		return Edit{}, errors.Wrapf(err, "invalid path %s", gnmiPathString(elems))
+	}
+	edit := Edit{Operation: op, Path: id, Schema: e}
+	if op != EditDelete {
+		if edit.Nodes, err = gnmiNodes(c, id[len(id)-1], e, val); err != nil {
+			return Edit{}, errors.Wrapf(err, "invalid value for %s", gnmiPathString(elems))
+		}
+	}
+	return edit, nil
+}
+
+// ResolveGNMIPath resolves the gNMI path, appended to the prefix, if
+// any, to an instance identifier and the schema node it addresses, with
+// the schema of the collection c. Path element names are as for
+// SetRequestEdits. The last element of a list may have no keys,
+// addressing every entry, as the instance identifier's ResolveAll
+// does. An empty path addresses the data tree's root, returning a nil
+// identifier and schema node.
+func ResolveGNMIPath(c *modules.Collection, prefix, path *gnmi.Path) (InstanceID, *yang.Entry, error) {
+	elems := append(append([]*gnmi.PathElem(nil), prefix.GetElem()...), path.GetElem()...)
+	if len(elems) == 0 {
+		return nil, nil, nil
+	}
+	id, e, err := gnmiPath(c, elems)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "invalid path %s", gnmiPathString(elems))
+	}
+	return id, e, nil
+}
+
+// GNMIPath returns the gNMI path of id, the inverse of
+// ResolveGNMIPath, with the module names of the collection c. Element
+// names are qualified by their module name where their namespace
+// differs from the preceding element's. Leaf-list entry values are not
+// part of gNMI paths, so are omitted.
+func GNMIPath(id InstanceID, c *modules.Collection) *gnmi.Path {
+	path := &gnmi.Path{}
+	var ns string
+	for _, elem := range id {
+		name := elem.Name.Local
+		if elem.Name.Space != ns {
+			ns = elem.Name.Space
+			module := ns
+			if m, err := c.ModuleByNamespace(ns); err == nil {
+				module = m.Name
+			}
+			name = module + ":" + name
+		}
+		pe := &gnmi.PathElem{Name: name}
+		for _, key := range elem.Keys {
+			if key.Name.Local == "." {
+				continue
+			}
+			if pe.Key == nil {
+				pe.Key = map[string]string{}
+			}
+			pe.Key[key.Name.Local] = key.Value
+		}
+		path.Elem = append(path.Elem, pe)
+	}
+	return path
+}
+
+func gnmiPathString(elems []*gnmi.PathElem) string {
+	var b strings.Builder
+	for _, elem := range elems {
+		b.WriteString("/" + elem.GetName())
+		for k, v := range elem.GetKey() {
+			b.WriteString("[" + k + "=" + v + "]")
+		}
+	}
+	return b.String()
+}
+
+// gnmiPath resolves the gNMI path elements to an instance identifier
+// and the schema node it addresses.
+func gnmiPath(c *modules.Collection, elems []*gnmi.PathElem) (InstanceID, *yang.Entry, error) {
+	if len(elems) == 0 {
+		return nil, nil, errors.New("empty path")
+	}
+	var id InstanceID
+	var e *yang.Entry
+	for i, elem := range elems {
+		module, local := "", elem.GetName()
+		if j := strings.IndexByte(local, ':'); j >= 0 {
+			module, local = local[:j], local[j+1:]
+		}
+		var next *yang.Entry
+		if e == nil {
+			next = gnmiRootEntry(c, module, local)
+		} else {
+			next = c.DataChild(e, local)
+			if next != nil && module != "" && next.Namespace().Name != moduleNamespace(c, module) {
+				next = nil
+			}
+		}
+		if next == nil {
+			return nil, nil, errors.Errorf("unknown node %q", elem.GetName())
+		}
+		e = next
+
+		step := InstanceIDElem{Name: xml.Name{Space: e.Namespace().Name, Local: e.Name}}
+		keys := elem.GetKey()
+		if e.IsList() {
+			names := strings.Fields(e.Key)
+			if len(keys) == 0 && i < len(elems)-1 {
+				// only the last step may address all entries
+				return nil, nil, errors.Errorf("list %s requires keys %v", e.Name, names)
+			} else if len(keys) > 0 && len(keys) != len(names) {
+				return nil, nil, errors.Errorf("list %s requires keys %v", e.Name, names)
+			}
+			for _, name := range names {
+				value, ok := keys[name]
+				if !ok && len(keys) > 0 {
+					return nil, nil, errors.Errorf("list %s requires key %s", e.Name, name)
+				} else if ok {
+					step.Keys = append(step.Keys, InstanceIDKey{Name: xml.Name{Space: step.Name.Space, Local: name}, Value: value})
+				}
+			}
+		} else if len(keys) > 0 {
+			return nil, nil, errors.Errorf("%s is not a list", e.Name)
+		}
+		id = append(id, step)
+	}
+	return id, e, nil
+}
+
+func gnmiRootEntry(c *modules.Collection, module, local string) *yang.Entry {
+	if module != "" {
+		e, err := c.ModuleEntry(module)
+		if err != nil {
+			return nil
+		}
+		return c.DataChild(e, local)
+	}
+	var found *yang.Entry
+	_ = c.IterLatest(func(mod *yang.Module) error {
+		me, err := c.ModuleEntry(mod.Name)
+		if err != nil {
+			return nil
+		}
+		if e := c.DataChild(me, local); e != nil {
+			found = e
+			return errors.New("stop")
+		}
+		return nil
+	})
+	return found
+}
+
+func moduleNamespace(c *modules.Collection, module string) string {
+	if e, err := c.ModuleEntry(module); err == nil {
+		return e.Namespace().Name
+	}
+	return ""
+}
+
+// gnmiNodes returns the data nodes for the value val of the schema
+// node e, at the path step.
+func gnmiNodes(c *modules.Collection, step InstanceIDElem, e *yang.Entry, val *gnmi.TypedValue) ([]dom.Node, error) {
+	if val == nil {
+		return nil, errors.New("missing value")
+	}
+	if raw := gnmiJSON(val); raw != nil {
+		if e.Kind == yang.DirectoryEntry {
+			n, err := gnmiJSONNode(c, step, e, raw)
+			if err != nil {
+				return nil, err
+			}
+			return []dom.Node{n}, nil
+		}
+		var v interface{}
+		d := json.NewDecoder(bytes.NewReader(raw))
+		d.UseNumber()
+		if err := d.Decode(&v); err != nil {
+			return nil, err
+		}
+		values, ok := v.([]interface{})
+		if !ok || e.Type.Kind == yang.Yempty {
+			values = []interface{}{v}
+		}
+		var nodes []dom.Node
+		for _, value := range values {
+			text, err := jsonScalar(e, value)
+			if err != nil {
+				return nil, err
+			}
+			n, err := leafNode(step, e, text)
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, n)
+		}
+		return nodes, nil
+	}
+
+	if e.Kind != yang.LeafEntry {
+		return nil, errors.Errorf("%s requires a JSON value", e.Name)
+	}
+	values := []*gnmi.TypedValue{val}
+	if ll := val.GetLeaflistVal(); ll != nil {
+		values = ll.GetElement()
+	}
+	var nodes []dom.Node
+	for _, value := range values {
+		text, err := scalarValue(value)
+		if err != nil {
+			return nil, err
+		}
+		n, err := leafNode(step, e, text)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, n)
+	}
+	return nodes, nil
+}
+
+func gnmiJSON(val *gnmi.TypedValue) []byte {
+	switch val.GetValue().(type) {
+	case *gnmi.TypedValue_JsonIetfVal:
+		return val.GetJsonIetfVal()
+	case *gnmi.TypedValue_JsonVal:
+		return val.GetJsonVal()
+	}
+	return nil
+}
+
+// gnmiJSONNode decodes the RFC 7951 JSON object raw as the content of
+// the container or list entry e, adding the list keys of step if they
+// are not present.
+func gnmiJSONNode(c *modules.Collection, step InstanceIDElem, e *yang.Entry, raw []byte) (dom.Node, error) {
+	parent := dom.NewDocument(nil)
+	if err := parent.AppendChild(dom.CreateElement(xml.StartElement{Name: step.Name})); err != nil {
+		return nil, err
+	}
+	n := parent.FirstChild()
+
+	td := &Decoder{Node: n, Modules: c}
+	td.SetSchema(e)
+	un := dom.NewUnmarshaler(td)
+	un.InitializeArgs = []string{"mediatype", "application/yang-data+json"}
+	if _, err := un.JSONReader().ReadFrom(bytes.NewReader(raw)); err != nil {
+		return nil, err
+	}
+	for _, err := range td.DecodingErrors() {
+		// instances required by instance-identifier values are
+		// outside the fragment, so cannot be resolved here
+		if de, ok := err.(*DecodeError); !ok || de.Tag != ErrorTagDataMissing {
+			return nil, err
+		}
+	}
+
+	for i, key := range step.Keys {
+		leaf := n.ChildByName(key.Name)
+		if leaf == nil {
+			kn, err := leafNode(InstanceIDElem{Name: key.Name}, e.Dir[key.Name.Local], key.Value)
+			if err != nil {
+				return nil, err
+			}
+			// keys come first, in key order
+			if ref := keyBefore(n, step.Keys[:i]); ref != nil {
+				err = n.InsertChildAfter(kn, ref)
+			} else {
+				err = n.PrependChild(kn)
+			}
+			if err != nil {
+				return nil, err
+			}
+		} else if leaf.ChildValue() != key.Value {
+			return nil, errors.Errorf("key %s value %q does not match path value %q", key.Name.Local, leaf.ChildValue(), key.Value)
+		}
+	}
+	_ = parent.RemoveChild(n)
+	return n, nil
+}
+
+// keyBefore returns the last present key leaf of keys in n, or nil.
+func keyBefore(n dom.Node, keys []InstanceIDKey) dom.Node {
+	for i := len(keys) - 1; i >= 0; i-- {
+		if leaf := n.ChildByName(keys[i].Name); leaf != nil {
+			return leaf
+		}
+	}
+	return nil
+}
+
+// leafNode returns a new leaf element for step with the text value,
+// which is checked against the type of e and canonicalized.
+func leafNode(step InstanceIDElem, e *yang.Entry, text string) (dom.Node, error) {
+	if e == nil || e.Type == nil {
+		return nil, errors.Errorf("%s is not a leaf", step.Name.Local)
+	}
+	n := dom.CreateElement(xml.StartElement{Name: step.Name})
+	if e.Type.Kind == yang.Yempty {
+		return n, nil
+	}
+	t, err := checkValue(e, e.Type, text)
+	if err != nil {
+		return nil, err
+	}
+	if err := n.AppendChild(dom.CreateText(xml.CharData(canonicalValue(t, text)))); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// jsonScalar returns the lexical value of the decoded RFC 7951 JSON
+// scalar v.
+func jsonScalar(e *yang.Entry, v interface{}) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case []interface{}:
+		// [null] is the value of an empty leaf
+		if len(v) == 1 && v[0] == nil && e.Type.Kind == yang.Yempty {
+			return "", nil
+		}
+	}
+	return "", errors.Errorf("unexpected JSON value %v for %s", v, e.Name)
+}
+
+// scalarValue returns the lexical value of the scalar gNMI value.
+func scalarValue(val *gnmi.TypedValue) (string, error) {
+	switch v := val.GetValue().(type) {
+	case *gnmi.TypedValue_StringVal:
+		return v.StringVal, nil
+	case *gnmi.TypedValue_AsciiVal:
+		return v.AsciiVal, nil
+	case *gnmi.TypedValue_IntVal:
+		return strconv.FormatInt(v.IntVal, 10), nil
+	case *gnmi.TypedValue_UintVal:
+		return strconv.FormatUint(v.UintVal, 10), nil
+	case *gnmi.TypedValue_BoolVal:
+		return strconv.FormatBool(v.BoolVal), nil
+	case *gnmi.TypedValue_BytesVal:
+		return base64.StdEncoding.EncodeToString(v.BytesVal), nil
+	case *gnmi.TypedValue_FloatVal:
+		return strconv.FormatFloat(float64(v.FloatVal), 'f', -1, 32), nil
+	case *gnmi.TypedValue_DecimalVal:
+		precision := v.DecimalVal.GetPrecision()
+		if precision < 1 || precision > uint32(yang.MaxFractionDigits) {
+			return "", errors.Errorf("invalid decimal64 precision %d", precision)
+		}
+		n := yang.Number{Kind: yang.Positive, FractionDigits: uint8(precision)}
+		// the magnitude is negated as unsigned, as that of the least
+		// int64 has no int64 representation
+		if digits := v.DecimalVal.GetDigits(); digits < 0 {
+			n.Kind, n.Value = yang.Negative, -uint64(digits)
+		} else {
+			n.Value = uint64(digits)
+		}
+		return formatDecimal64(n), nil
+	}
+	return "", errors.Errorf("unsupported value type %T", val.GetValue())
+}
@@ -0,0 +1,253 @@
+package datastore
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/andaru/flexml"
+	"github.com/andaru/opr8/dom"
+	"github.com/openconfig/gnmi/proto/gnmi"
+)
+
+func gnmiTestPath(elems ...*gnmi.PathElem) *gnmi.Path { return &gnmi.Path{Elem: elems} }
+
+func TestSetRequestEdits(t *testing.T) {
+	c := newTestCollection(t)
+	initial := `<refs xmlns="urn:mod2"><server><name>a</name><port>1</port></server>` +
+		`<server><name>b</name><port>2</port></server><tag>x</tag></refs>`
+
+	refs := &gnmi.PathElem{Name: "module2:refs"}
+	server := func(name string) *gnmi.PathElem {
+		return &gnmi.PathElem{Name: "server", Key: map[string]string{"name": name}}
+	}
+	for _, tt := range []struct {
+		name    string
+		req     *gnmi.SetRequest
+		wantXML string
+		wantErr bool
+	}{
+		{
+			name: "update leaf with scalar",
+			req: &gnmi.SetRequest{
+				Prefix: gnmiTestPath(refs),
+				Update: []*gnmi.Update{{
+					Path: gnmiTestPath(server("a"), &gnmi.PathElem{Name: "port"}),
+					Val:  &gnmi.TypedValue{Value: &gnmi.TypedValue_UintVal{UintVal: 80}},
+				}},
+			},
+			wantXML: `<refs xmlns="urn:mod2"><server><name>a</name><port>80</port></server>` +
+				`<server><name>b</name><port>2</port></server><tag>x</tag></refs>`,
+		},
+		{
+			name: "create list entry with JSON_IETF, key from path",
+			req: &gnmi.SetRequest{
+				Update: []*gnmi.Update{{
+					Path: gnmiTestPath(&gnmi.PathElem{Name: "refs"}, server("c")),
+					Val:  &gnmi.TypedValue{Value: &gnmi.TypedValue_JsonIetfVal{JsonIetfVal: []byte(`{"port": 3}`)}},
+				}},
+			},
+			wantXML: `<refs xmlns="urn:mod2"><server><name>a</name><port>1</port></server>` +
+				`<server><name>b</name><port>2</port></server><tag>x</tag>` +
+				`<server><name>c</name><port>3</port></server></refs>`,
+		},
+		{
+			name: "delete, replace and merge leaf-list",
+			req: &gnmi.SetRequest{
+				Prefix: gnmiTestPath(refs),
+				Delete: []*gnmi.Path{gnmiTestPath(server("b"))},
+				Replace: []*gnmi.Update{{
+					Path: gnmiTestPath(server("a")),
+					Val:  &gnmi.TypedValue{Value: &gnmi.TypedValue_JsonIetfVal{JsonIetfVal: []byte(`{"name": "a"}`)}},
+				}},
+				Update: []*gnmi.Update{{
+					Path: gnmiTestPath(&gnmi.PathElem{Name: "tag"}),
+					Val: &gnmi.TypedValue{Value: &gnmi.TypedValue_LeaflistVal{LeaflistVal: &gnmi.ScalarArray{Element: []*gnmi.TypedValue{
+						{Value: &gnmi.TypedValue_StringVal{StringVal: "x"}},
+						{Value: &gnmi.TypedValue_StringVal{StringVal: "y"}},
+					}}}},
+				}},
+			},
+			wantXML: `<refs xmlns="urn:mod2"><tag>x</tag><server><name>a</name></server><tag>y</tag></refs>`,
+		},
+		{
+			name: "replace leaf-list with JSON array",
+			req: &gnmi.SetRequest{
+				Prefix: gnmiTestPath(refs),
+				Replace: []*gnmi.Update{{
+					Path: gnmiTestPath(&gnmi.PathElem{Name: "tag"}),
+					Val:  &gnmi.TypedValue{Value: &gnmi.TypedValue_JsonIetfVal{JsonIetfVal: []byte(`["p", "q"]`)}},
+				}},
+			},
+			wantXML: `<refs xmlns="urn:mod2"><server><name>a</name><port>1</port></server>` +
+				`<server><name>b</name><port>2</port></server><tag>p</tag><tag>q</tag></refs>`,
+		},
+		{
+			name: "create path and decimal value",
+			req: &gnmi.SetRequest{
+				Update: []*gnmi.Update{{
+					Path: gnmiTestPath(&gnmi.PathElem{Name: "module2:types"}, &gnmi.PathElem{Name: "ratio"}),
+					Val:  &gnmi.TypedValue{Value: &gnmi.TypedValue_DecimalVal{DecimalVal: &gnmi.Decimal64{Digits: -150, Precision: 2}}},
+				}},
+			},
+			wantXML: initial + `<types xmlns="urn:mod2"><ratio>-1.5</ratio></types>`,
+		},
+		{
+			name: "delete missing path",
+			req: &gnmi.SetRequest{
+				Delete: []*gnmi.Path{gnmiTestPath(refs, server("z"), &gnmi.PathElem{Name: "port"})},
+			},
+			wantXML: initial,
+		},
+		{
+			name: "invalid value",
+			req: &gnmi.SetRequest{
+				Update: []*gnmi.Update{{
+					Path: gnmiTestPath(refs, server("a"), &gnmi.PathElem{Name: "port"}),
+					Val:  &gnmi.TypedValue{Value: &gnmi.TypedValue_IntVal{IntVal: -1}},
+				}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "key mismatch",
+			req: &gnmi.SetRequest{
+				Update: []*gnmi.Update{{
+					Path: gnmiTestPath(refs, server("a")),
+					Val:  &gnmi.TypedValue{Value: &gnmi.TypedValue_JsonIetfVal{JsonIetfVal: []byte(`{"name": "b"}`)}},
+				}},
+			},
+			wantErr: true,
+		},
+		{
+			name:    "list without keys in path",
+			req:     &gnmi.SetRequest{Delete: []*gnmi.Path{gnmiTestPath(refs, &gnmi.PathElem{Name: "server"}, &gnmi.PathElem{Name: "port"})}},
+			wantErr: true,
+		},
+		{
+			name:    "unknown node",
+			req:     &gnmi.SetRequest{Delete: []*gnmi.Path{gnmiTestPath(refs, &gnmi.PathElem{Name: "bogus"})}},
+			wantErr: true,
+		},
+		{
+			name:    "wrong module",
+			req:     &gnmi.SetRequest{Delete: []*gnmi.Path{gnmiTestPath(refs, &gnmi.PathElem{Name: "module1:tag"})}},
+			wantErr: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			edits, err := SetRequestEdits(tt.req, c)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SetRequestEdits() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			_, doc := decodeXML(t, c, initial)
+			if err := ApplyEdits(doc, c, edits); err != nil {
+				t.Fatalf("ApplyEdits() error = %v, wantErr false", err)
+			}
+			b, err := flexml.Marshal(dom.NewMarshaler(doc))
+			if err != nil {
+				t.Fatalf("xml.Marshal(doc) error: %v, wantErr false", err)
+			} else if string(b) != tt.wantXML {
+				t.Errorf("encoded XML got:\n%s\nwant:\n%s\n", b, tt.wantXML)
+			}
+		})
+	}
+}
+
+func TestScalarValue_Decimal(t *testing.T) {
+	for _, tt := range []struct {
+		digits    int64
+		precision uint32
+		want      string
+		wantErr   bool
+	}{
+		{digits: -150, precision: 2, want: "-1.5"},
+		{digits: 5, precision: 18, want: "0.000000000000000005"},
+		{digits: math.MaxInt64, precision: 18, want: "9.223372036854775807"},
+		{digits: math.MinInt64, precision: 18, want: "-9.223372036854775808"},
+		{digits: 1, precision: 0, wantErr: true},
+		{digits: 1, precision: 19, wantErr: true},
+	} {
+		val := &gnmi.TypedValue{Value: &gnmi.TypedValue_DecimalVal{DecimalVal: &gnmi.Decimal64{Digits: tt.digits, Precision: tt.precision}}}
+		got, err := scalarValue(val)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("scalarValue(%d, %d) error = %v, wantErr %v", tt.digits, tt.precision, err, tt.wantErr)
+		} else if got != tt.want {
+			t.Errorf("scalarValue(%d, %d) = %q, want %q", tt.digits, tt.precision, got, tt.want)
+		}
+	}
+}
+
+func TestResolveGNMIPath(t *testing.T) {
+	c := newTestCollection(t)
+	_, doc := decodeXML(t, c, `<refs xmlns="urn:mod2"><server><name>a</name><port>1</port></server>`+
+		`<server><name>b</name><port>2</port></server><tag>x</tag><tag>y</tag></refs>`)
+
+	refs := &gnmi.PathElem{Name: "module2:refs"}
+	for _, tt := range []struct {
+		name      string
+		path      *gnmi.Path
+		wantPaths []string
+		wantJSON  []string
+		wantErr   bool
+	}{
+		{
+			name:      "list entry",
+			path:      gnmiTestPath(refs, &gnmi.PathElem{Name: "server", Key: map[string]string{"name": "b"}}),
+			wantPaths: []string{"/module2:refs/server[name=b]"},
+			wantJSON:  []string{`{"name":"b","port":2}`},
+		},
+		{
+			name:      "every list entry",
+			path:      gnmiTestPath(refs, &gnmi.PathElem{Name: "server"}),
+			wantPaths: []string{"/module2:refs/server[name=a]", "/module2:refs/server[name=b]"},
+			wantJSON:  []string{`{"name":"a","port":1}`, `{"name":"b","port":2}`},
+		},
+		{
+			name:      "leaf",
+			path:      gnmiTestPath(refs, &gnmi.PathElem{Name: "server", Key: map[string]string{"name": "a"}}, &gnmi.PathElem{Name: "port"}),
+			wantPaths: []string{"/module2:refs/server[name=a]/port"},
+			wantJSON:  []string{`1`},
+		},
+		{
+			name:      "missing entry",
+			path:      gnmiTestPath(refs, &gnmi.PathElem{Name: "server", Key: map[string]string{"name": "z"}}),
+			wantPaths: nil,
+		},
+		{
+			name:    "unknown node",
+			path:    gnmiTestPath(refs, &gnmi.PathElem{Name: "bogus"}),
+			wantErr: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			id, _, err := ResolveGNMIPath(c, nil, tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ResolveGNMIPath() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			var paths, values []string
+			for _, n := range id.ResolveAll(doc) {
+				p := GNMIPath(instanceIDOf(c, n), c)
+				paths = append(paths, gnmiPathString(p.GetElem()))
+				values = append(values, string(MarshalJSONValue(c, []dom.Node{n})))
+			}
+			if !reflect.DeepEqual(paths, tt.wantPaths) {
+				t.Errorf("paths got %q, want %q", paths, tt.wantPaths)
+			}
+			if len(tt.wantJSON) > 0 && !reflect.DeepEqual(values, tt.wantJSON) {
+				t.Errorf("values got %q, want %q", values, tt.wantJSON)
+			}
+		})
+	}
+
+	tags := InstanceID{{Name: flexml.Name{Space: "urn:mod2", Local: "refs"}}, {Name: flexml.Name{Space: "urn:mod2", Local: "tag"}}}
+	if got := string(MarshalJSONValue(c, tags.ResolveAll(doc))); got != `["x","y"]` {
+		t.Errorf("MarshalJSONValue(tag) got %s, want [\"x\",\"y\"]", got)
+	}
+}
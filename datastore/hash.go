@@ -0,0 +1,48 @@
+package datastore
+
+import (
+	"encoding/hex"
+	"hash"
+	"hash/fnv"
+	"io"
+	"strconv"
+
+	"github.com/andaru/opr8/dom"
+)
+
+// Hash returns a hash of the data node n and its descendants, such as
+// for an HTTP entity tag, which changes when the names, attributes or
+// values of any of them do, or their order.
+func Hash(n dom.Node) string {
+	h := fnv.New128a()
+	hashNode(h, n)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func hashNode(h hash.Hash, n dom.Node) {
+	switch n.NodeType() {
+	case dom.NodeTypeElement:
+		hashString(h, "<", n.Name().Space, n.Name().Local)
+		if ap, ok := n.(dom.AttributeProvider); ok {
+			for a := ap.FirstAttribute(); a != nil; a = a.NextSibling() {
+				hashString(h, "@", a.Name().Space, a.Name().Local, a.Value())
+			}
+		}
+	case dom.NodeTypeDocument:
+	default:
+		hashString(h, "#", n.Value())
+	}
+	for it := n.FirstChild(); it != nil; it = it.NextSibling() {
+		hashNode(h, it)
+	}
+	_, _ = io.WriteString(h, ">")
+}
+
+// hashString writes the marker and the length prefixed strings to h,
+// so distinct trees have distinct inputs.
+func hashString(h hash.Hash, marker string, strs ...string) {
+	_, _ = io.WriteString(h, marker)
+	for _, s := range strs {
+		_, _ = io.WriteString(h, strconv.Itoa(len(s))+":"+s)
+	}
+}
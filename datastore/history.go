@@ -0,0 +1,145 @@
+package datastore
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/andaru/opr8/dom"
+	"github.com/andaru/opr8/session"
+	"github.com/pkg/errors"
+)
+
+// DefaultHistorySize is the number of revisions kept by a History
+// created with a size of zero.
+const DefaultHistorySize = 50
+
+// Revision is a committed configuration snapshot.
+type Revision struct {
+	// ID is the revision identifier, unique within its History and
+	// increasing with each commit.
+	ID uint64
+	// Timestamp is the time of the commit.
+	Timestamp time.Time
+	// Session is the ID of the session which committed the revision,
+	// or zero if the commit was not made by a session.
+	Session session.ID
+	// Comment is the optional commit comment.
+	Comment string
+	// Config is the committed configuration. It must not be modified;
+	// use dom.CloneNode to obtain a copy for editing.
+	Config dom.Node
+}
+
+// History is a ring of the most recently committed configuration
+// revisions, supporting rollback to earlier revisions. It is safe for
+// concurrent use.
+type History struct {
+	mu   sync.Mutex
+	revs []*Revision // ring, oldest at head
+	head int
+	size int
+	last uint64
+
+	// now returns the current time; replaced in tests
+	now func() time.Time
+}
+
+// NewHistory returns a History keeping up to size revisions. If size
+// is zero, DefaultHistorySize revisions are kept.
+func NewHistory(size int) *History {
+	if size <= 0 {
+		size = DefaultHistorySize
+	}
+	return &History{size: size, now: time.Now}
+}
+
+// Commit records a snapshot of config as a new revision, discarding
+// the oldest revision if the history is full. The config tree is
+// copied, so the caller may continue to modify it.
+func (h *History) Commit(config dom.Node, sid session.ID, comment string) *Revision {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.commit(dom.CloneNode(config, true), sid, comment)
+}
+
+// record is Commit without copying config, for callers which never
+// modify config once committed.
+func (h *History) record(config dom.Node, sid session.ID, comment string) *Revision {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.commit(config, sid, comment)
+}
+
+func (h *History) commit(config dom.Node, sid session.ID, comment string) *Revision {
+	h.last++
+	rev := &Revision{
+		ID:        h.last,
+		Timestamp: h.now(),
+		Session:   sid,
+		Comment:   comment,
+		Config:    config,
+	}
+	if len(h.revs) < h.size {
+		h.revs = append(h.revs, rev)
+	} else {
+		h.revs[h.head] = rev
+		h.head = (h.head + 1) % h.size
+	}
+	return rev
+}
+
+// Len returns the number of revisions in the history.
+func (h *History) Len() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.revs)
+}
+
+// Revision returns the revision n commits before the latest, so that
+// Revision(0) is the latest revision and Revision(1) the one before.
+func (h *History) Revision(n int) (*Revision, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.revision(n)
+}
+
+func (h *History) revision(n int) (*Revision, error) {
+	if n < 0 || n >= len(h.revs) {
+		return nil, errors.Errorf("revision %d not in history of %d revisions", n, len(h.revs))
+	}
+	return h.revs[(h.head+len(h.revs)-1-n)%len(h.revs)], nil
+}
+
+// Revisions returns the revisions in the history, latest first.
+func (h *History) Revisions() []*Revision {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	revs := make([]*Revision, len(h.revs))
+	for i := range revs {
+		revs[i], _ = h.revision(i)
+	}
+	return revs
+}
+
+// Rollback commits the configuration of Revision(n) as a new revision,
+// which is returned. The caller installs a copy of the returned
+// revision's Config as the running configuration. If comment is
+// empty, a comment naming the restored revision is used.
+func (h *History) Rollback(n int, sid session.ID, comment string) (*Revision, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	rev, err := h.revision(n)
+	if err != nil {
+		return nil, errors.Wrap(err, "rollback failed")
+	}
+	if comment == "" {
+		comment = rollbackComment(rev)
+	}
+	return h.commit(dom.CloneNode(rev.Config, true), sid, comment), nil
+}
+
+// rollbackComment returns the comment of a rollback to rev.
+func rollbackComment(rev *Revision) string {
+	return fmt.Sprintf("rollback to revision %d", rev.ID)
+}
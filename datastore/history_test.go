@@ -0,0 +1,66 @@
+package datastore
+
+import (
+	"testing"
+	"time"
+
+	xml "github.com/andaru/flexml"
+	"github.com/andaru/opr8/dom"
+)
+
+func TestHistory(t *testing.T) {
+	config := func(value string) dom.Node {
+		doc := dom.NewDocument(nil)
+		e := dom.CreateElement(xml.StartElement{Name: xml.Name{Space: "urn:mod1", Local: "system"}})
+		_ = e.AppendChild(dom.CreateText(xml.CharData(value)))
+		_ = doc.AppendChild(e)
+		return doc
+	}
+	value := func(rev *Revision) string { return rev.Config.FirstChild().ChildValue() }
+
+	h := NewHistory(3)
+	start := time.Unix(1500000000, 0)
+	h.now = func() time.Time { start = start.Add(time.Second); return start }
+
+	running := config("a")
+	h.Commit(running, 1, "first")
+	_ = running.FirstChild().FirstChild().SetValue("changed")
+	if rev, _ := h.Revision(0); value(rev) != "a" {
+		t.Errorf("committed value = %q after editing running, want %q", value(rev), "a")
+	}
+	h.Commit(config("b"), 1, "")
+	h.Commit(config("c"), 2, "")
+	h.Commit(config("d"), 2, "")
+
+	if h.Len() != 3 {
+		t.Fatalf("Len() = %d, want 3", h.Len())
+	}
+	var got []string
+	for _, rev := range h.Revisions() {
+		got = append(got, value(rev))
+	}
+	if want := []string{"d", "c", "b"}; len(got) != 3 || got[0] != want[0] || got[1] != want[1] || got[2] != want[2] {
+		t.Errorf("Revisions() values = %v, want %v", got, want)
+	}
+	if _, err := h.Revision(3); err == nil {
+		t.Errorf("Revision(3) error = nil, wantErr true")
+	}
+
+	rev, err := h.Rollback(2, 3, "")
+	if err != nil {
+		t.Fatalf("Rollback(2) error = %v, wantErr false", err)
+	}
+	if rev.ID != 5 || value(rev) != "b" || rev.Session != 3 || rev.Comment != "rollback to revision 2" {
+		t.Errorf("Rollback(2) = {ID: %d, value: %q, Session: %d, Comment: %q}, want {5, %q, 3, %q}",
+			rev.ID, value(rev), rev.Session, rev.Comment, "b", "rollback to revision 2")
+	}
+	if latest, _ := h.Revision(0); latest != rev {
+		t.Errorf("Revision(0) is not the rollback revision")
+	}
+	if prev, _ := h.Revision(1); !prev.Timestamp.Before(rev.Timestamp) {
+		t.Errorf("rollback timestamp %v not after previous %v", rev.Timestamp, prev.Timestamp)
+	}
+	if _, err := h.Rollback(3, 3, ""); err == nil {
+		t.Errorf("Rollback(3) error = nil, wantErr true")
+	}
+}
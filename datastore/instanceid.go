@@ -0,0 +1,359 @@
+package datastore
+
+import (
+	"strconv"
+	"strings"
+
+	xml "github.com/andaru/flexml"
+	"github.com/andaru/opr8/dom"
+	"github.com/andaru/opr8/modules"
+	"github.com/openconfig/goyang/pkg/yang"
+	"github.com/pkg/errors"
+)
+
+// InstanceID is a YANG instance-identifier, which uniquely identifies
+// a node in the data tree. It is a sequence of element steps from
+// the document root.
+type InstanceID []InstanceIDElem
+
+// InstanceIDElem is a single step of an InstanceID.
+type InstanceIDElem struct {
+	// Name is the element name. The Space field is the namespace URI.
+	Name xml.Name
+	// Keys are the element's list key predicates in order. For
+	// leaf-list entries, a single key with the Local name "." holds
+	// the entry's value.
+	Keys []InstanceIDKey
+	// Position is the element's 1-based positional predicate, or 0
+	// if the element has no positional predicate.
+	Position int
+}
+
+// InstanceIDKey is an InstanceID key predicate.
+type InstanceIDKey struct {
+	Name  xml.Name
+	Value string
+}
+
+// ParseInstanceID parses the instance-identifier s, in either the
+// YANG/XML or the YANG/JSON encoding. The namespace function returns
+// the namespace URI for a name prefix; this is an XML namespace prefix
+// for YANG/XML values and a module name for YANG/JSON values. Node
+// names without a prefix take the namespace of the preceding step.
+func ParseInstanceID(s string, namespace func(prefix string) (string, error)) (InstanceID, error) {
+	p := &instanceIDParser{s: s, namespace: namespace}
+	return p.parse()
+}
+
+// Resolve returns the node addressed by the instance-identifier,
+// relative to root, which is typically a Document. An error is
+// returned if no such node exists.
+func (id InstanceID) Resolve(root dom.Node) (dom.Node, error) {
+	if len(id) == 0 {
+		return nil, errors.New("empty instance-identifier")
+	}
+	cur := root
+	for _, elem := range id {
+		var next dom.Node
+		position := 0
+		for _, child := range cur.ChildrenByName(elem.Name) {
+			if !elem.matchKeys(child) {
+				continue
+			}
+			position++
+			if elem.Position == 0 || elem.Position == position {
+				next = child
+				break
+			}
+		}
+		if next == nil {
+			return nil, errors.Errorf("instance %s not found", id.Format(nil))
+		}
+		cur = next
+	}
+	return cur, nil
+}
+
+// ResolveAll returns the nodes addressed by the instance-identifier,
+// relative to root, in document order. Unlike Resolve, steps without
+// key predicates select every entry of a list or leaf-list, so several
+// nodes may be returned, or none.
+func (id InstanceID) ResolveAll(root dom.Node) []dom.Node {
+	nodes := []dom.Node{root}
+	for _, elem := range id {
+		var next []dom.Node
+		for _, n := range nodes {
+			position := 0
+			for _, child := range n.ChildrenByName(elem.Name) {
+				if !elem.matchKeys(child) {
+					continue
+				}
+				position++
+				if elem.Position == 0 || elem.Position == position {
+					next = append(next, child)
+				}
+			}
+		}
+		nodes = next
+	}
+	return nodes
+}
+
+func (elem InstanceIDElem) matchKeys(n dom.Node) bool {
+	for _, key := range elem.Keys {
+		if key.Name.Local == "." {
+			if n.ChildValue() != key.Value {
+				return false
+			}
+			continue
+		}
+		leaf := n.ChildByName(key.Name)
+		if leaf == nil || leaf.ChildValue() != key.Value {
+			return false
+		}
+	}
+	return true
+}
+
+// Format returns the instance-identifier in the YANG/JSON encoding.
+// The prefix function returns the prefix (module name) used for a
+// namespace; it is called for the first step and for any step whose
+// namespace differs from the preceding step. If prefix is nil, the
+// namespace is used as the prefix.
+//
+// Key values are quoted with ' unless they contain one, then with ".
+// A value containing both has no quoted-string encoding (RFC 7950
+// section 14), so it is single-quoted with each ' doubled, as in XPath
+// 2.0 string literals, which ParseInstanceID accepts.
+func (id InstanceID) Format(prefix func(namespace string) string) string {
+	if prefix == nil {
+		prefix = func(ns string) string { return ns }
+	}
+	var b strings.Builder
+	var ns string
+	for _, elem := range id {
+		b.WriteByte('/')
+		if elem.Name.Space != ns {
+			ns = elem.Name.Space
+			b.WriteString(prefix(ns))
+			b.WriteByte(':')
+		}
+		b.WriteString(elem.Name.Local)
+		for _, key := range elem.Keys {
+			b.WriteByte('[')
+			if key.Name.Space != "" && key.Name.Space != ns {
+				b.WriteString(prefix(key.Name.Space))
+				b.WriteByte(':')
+			}
+			b.WriteString(key.Name.Local)
+			b.WriteByte('=')
+			b.WriteString(quoteValue(key.Value))
+			b.WriteByte(']')
+		}
+		if elem.Position > 0 {
+			b.WriteString("[" + strconv.Itoa(elem.Position) + "]")
+		}
+	}
+	return b.String()
+}
+
+// quoteValue returns the key value v as a quoted string.
+func quoteValue(v string) string {
+	switch {
+	case !strings.Contains(v, "'"):
+		return "'" + v + "'"
+	case !strings.Contains(v, `"`):
+		return `"` + v + `"`
+	}
+	return "'" + strings.Replace(v, "'", "''", -1) + "'"
+}
+
+// instanceIDOf returns the instance-identifier of the element n, from
+// the top-level element of its tree. Steps have the keys of list
+// entries and the values of leaf-list entries, for those elements with
+// schema nodes in the collection c.
+func instanceIDOf(c *modules.Collection, n dom.Node) InstanceID {
+	var nodes []dom.Node
+	for it := n; it != nil && it.NodeType() == dom.NodeTypeElement; it = it.Parent() {
+		nodes = append(nodes, it)
+	}
+	id := make(InstanceID, 0, len(nodes))
+	var e *yang.Entry
+	for i := len(nodes) - 1; i >= 0; i-- {
+		n, name := nodes[i], nodes[i].Name()
+		switch {
+		case i == len(nodes)-1 && c != nil:
+			e = rootEntry(c, name)
+		case e != nil:
+			e = c.DataChild(e, name.Local)
+		}
+		elem := InstanceIDElem{Name: name}
+		if e != nil {
+			elem = StepOf(n, e)
+		}
+		id = append(id, elem)
+	}
+	return id
+}
+
+// moduleName returns the name of the module of c with the namespace
+// ns, or ns itself if there is none.
+func moduleName(c *modules.Collection, ns string) string {
+	if c != nil {
+		if mod, err := c.ModuleByNamespace(ns); err == nil {
+			return mod.Name
+		}
+	}
+	return ns
+}
+
+type instanceIDParser struct {
+	s         string
+	i         int
+	namespace func(string) (string, error)
+}
+
+func (p *instanceIDParser) errorf(format string, args ...interface{}) error {
+	return errors.Errorf("invalid instance-identifier %q at offset %d: %s", p.s, p.i, errors.Errorf(format, args...))
+}
+
+func (p *instanceIDParser) parse() (InstanceID, error) {
+	var id InstanceID
+	var ns string
+	for p.i < len(p.s) {
+		if p.s[p.i] != '/' {
+			return nil, p.errorf("expected '/'")
+		}
+		p.i++
+		name, err := p.nodeIdentifier(ns)
+		if err != nil {
+			return nil, err
+		}
+		if name.Space == "" {
+			return nil, p.errorf("first node %q must have a prefix", name.Local)
+		}
+		ns = name.Space
+		elem := InstanceIDElem{Name: name}
+		for p.i < len(p.s) && p.s[p.i] == '[' {
+			if err := p.predicate(&elem); err != nil {
+				return nil, err
+			}
+		}
+		id = append(id, elem)
+	}
+	if len(id) == 0 {
+		return nil, p.errorf("empty instance-identifier")
+	}
+	return id, nil
+}
+
+// nodeIdentifier parses an optionally prefixed node name. Unprefixed
+// names take the namespace ns.
+func (p *instanceIDParser) nodeIdentifier(ns string) (xml.Name, error) {
+	start := p.i
+	for p.i < len(p.s) && isIdentifierChar(p.s[p.i]) {
+		p.i++
+	}
+	ident := p.s[start:p.i]
+	if p.i < len(p.s) && p.s[p.i] == ':' {
+		p.i++
+		prefix := ident
+		start = p.i
+		for p.i < len(p.s) && isIdentifierChar(p.s[p.i]) {
+			p.i++
+		}
+		ident = p.s[start:p.i]
+		if prefix == "" {
+			return xml.Name{}, p.errorf("empty prefix")
+		}
+		var err error
+		if ns, err = p.namespace(prefix); err != nil {
+			return xml.Name{}, p.errorf("unknown prefix %q", prefix)
+		}
+	}
+	if ident == "" {
+		return xml.Name{}, p.errorf("expected node identifier")
+	}
+	return xml.Name{Space: ns, Local: ident}, nil
+}
+
+func (p *instanceIDParser) predicate(elem *InstanceIDElem) error {
+	p.i++ // '['
+	p.skipSpace()
+	if p.i < len(p.s) && p.s[p.i] >= '0' && p.s[p.i] <= '9' {
+		start := p.i
+		for p.i < len(p.s) && p.s[p.i] >= '0' && p.s[p.i] <= '9' {
+			p.i++
+		}
+		pos, err := strconv.Atoi(p.s[start:p.i])
+		if err != nil || pos < 1 {
+			return p.errorf("invalid position %q", p.s[start:p.i])
+		}
+		elem.Position = pos
+	} else {
+		var key InstanceIDKey
+		if p.i < len(p.s) && p.s[p.i] == '.' {
+			p.i++
+			key.Name = xml.Name{Local: "."}
+		} else {
+			name, err := p.nodeIdentifier(elem.Name.Space)
+			if err != nil {
+				return err
+			}
+			key.Name = name
+		}
+		p.skipSpace()
+		if p.i >= len(p.s) || p.s[p.i] != '=' {
+			return p.errorf("expected '='")
+		}
+		p.i++
+		p.skipSpace()
+		if p.i >= len(p.s) || (p.s[p.i] != '\'' && p.s[p.i] != '"') {
+			return p.errorf("expected quoted value")
+		}
+		value, err := p.quoted()
+		if err != nil {
+			return err
+		}
+		key.Value = value
+		elem.Keys = append(elem.Keys, key)
+	}
+	p.skipSpace()
+	if p.i >= len(p.s) || p.s[p.i] != ']' {
+		return p.errorf("expected ']'")
+	}
+	p.i++
+	return nil
+}
+
+// quoted parses a quoted key value, in which a doubled quote character
+// stands for the character itself, as written by Format.
+func (p *instanceIDParser) quoted() (string, error) {
+	quote := p.s[p.i]
+	p.i++
+	var b strings.Builder
+	for {
+		end := strings.IndexByte(p.s[p.i:], quote)
+		if end < 0 {
+			return "", p.errorf("unterminated quoted value")
+		}
+		b.WriteString(p.s[p.i : p.i+end])
+		p.i += end + 1
+		if p.i >= len(p.s) || p.s[p.i] != quote {
+			return b.String(), nil
+		}
+		b.WriteByte(quote)
+		p.i++
+	}
+}
+
+func (p *instanceIDParser) skipSpace() {
+	for p.i < len(p.s) && (p.s[p.i] == ' ' || p.s[p.i] == '\t') {
+		p.i++
+	}
+}
+
+func isIdentifierChar(c byte) bool {
+	return c == '_' || c == '-' || c == '.' ||
+		(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
@@ -0,0 +1,163 @@
+package datastore
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	xml "github.com/andaru/flexml"
+	"github.com/andaru/opr8/dom"
+	"github.com/pkg/errors"
+)
+
+func TestParseInstanceID(t *testing.T) {
+	namespaces := map[string]string{"mod2": "urn:mod2", "module2": "urn:mod2", "x": "urn:x"}
+	namespace := func(prefix string) (string, error) {
+		if ns, ok := namespaces[prefix]; ok {
+			return ns, nil
+		}
+		return "", errors.New("not found")
+	}
+	name := func(local string) xml.Name { return xml.Name{Space: "urn:mod2", Local: local} }
+
+	for _, tt := range []struct {
+		in      string
+		want    InstanceID
+		wantErr bool
+	}{
+		{
+			in:   "/mod2:refs/mod2:server[mod2:name='a']/mod2:port",
+			want: InstanceID{{Name: name("refs")}, {Name: name("server"), Keys: []InstanceIDKey{{name("name"), "a"}}}, {Name: name("port")}},
+		},
+		{
+			in:   `/module2:refs/server[name="a b"]/port`,
+			want: InstanceID{{Name: name("refs")}, {Name: name("server"), Keys: []InstanceIDKey{{name("name"), "a b"}}}, {Name: name("port")}},
+		},
+		{
+			in:   "/module2:refs/tag[ . = 'blue' ]",
+			want: InstanceID{{Name: name("refs")}, {Name: name("tag"), Keys: []InstanceIDKey{{xml.Name{Local: "."}, "blue"}}}},
+		},
+		{
+			in:   "/module2:refs/server[2]/x:port",
+			want: InstanceID{{Name: name("refs")}, {Name: name("server"), Position: 2}, {Name: xml.Name{Space: "urn:x", Local: "port"}}},
+		},
+		{
+			in:   `/module2:refs/server[name='it''s "a"']`,
+			want: InstanceID{{Name: name("refs")}, {Name: name("server"), Keys: []InstanceIDKey{{name("name"), `it's "a"`}}}},
+		},
+		{in: "", wantErr: true},
+		{in: "/", wantErr: true},
+		{in: "/refs", wantErr: true},
+		{in: "/bad:refs", wantErr: true},
+		{in: "module2:refs", wantErr: true},
+		{in: "/module2:refs/server[name='a'", wantErr: true},
+		{in: "/module2:refs/server[name=a]", wantErr: true},
+		{in: "/module2:refs/server[0]", wantErr: true},
+	} {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseInstanceID(tt.in, namespace)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseInstanceID() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseInstanceID() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInstanceIDFormat(t *testing.T) {
+	id := InstanceID{
+		{Name: xml.Name{Space: "urn:mod2", Local: "refs"}},
+		{Name: xml.Name{Space: "urn:mod2", Local: "server"}, Keys: []InstanceIDKey{{xml.Name{Space: "urn:mod2", Local: "name"}, "a"}}},
+		{Name: xml.Name{Space: "urn:x", Local: "port"}},
+	}
+	prefix := func(ns string) string { return strings.TrimPrefix(ns, "urn:") }
+	if got, want := id.Format(prefix), "/mod2:refs/server[name='a']/x:port"; got != want {
+		t.Errorf("InstanceID.Format() = %q, want %q", got, want)
+	}
+
+	namespace := func(prefix string) (string, error) { return "urn:" + prefix, nil }
+	for value, want := range map[string]string{
+		"a":        "/mod2:refs/server[name='a']/x:port",
+		"it's":     `/mod2:refs/server[name="it's"]/x:port`,
+		`say "hi"`: `/mod2:refs/server[name='say "hi"']/x:port`,
+		`it's "a"`: `/mod2:refs/server[name='it''s "a"']/x:port`,
+	} {
+		id[1].Keys[0].Value = value
+		got := id.Format(prefix)
+		if got != want {
+			t.Errorf("InstanceID.Format() of key %q = %q, want %q", value, got, want)
+		}
+		if parsed, err := ParseInstanceID(got, namespace); err != nil || !reflect.DeepEqual(parsed, id) {
+			t.Errorf("ParseInstanceID(%q) = %v, %v, want %v", got, parsed, err, id)
+		}
+	}
+}
+
+func TestInstanceIDDecoding(t *testing.T) {
+	c := newTestCollection(t)
+	const servers = `<server><name>a</name><port>1</port></server><server><name>b</name><port>2</port></server><tag>blue</tag>`
+
+	for _, tt := range []struct {
+		name     string
+		xml      string
+		json     string
+		wantTags []ErrorTag
+	}{
+		{
+			name: "xml target found",
+			xml:  `<refs xmlns="urn:mod2" xmlns:m="urn:mod2">` + servers + `<target>/m:refs/m:server[m:name='b']/m:port</target></refs>`,
+		},
+		{
+			name: "xml target found by module prefix",
+			xml:  `<refs xmlns="urn:mod2"><target>/mod2:refs/mod2:tag[.='blue']</target>` + servers + `</refs>`,
+		},
+		{
+			name:     "xml target missing",
+			xml:      `<refs xmlns="urn:mod2">` + servers + `<target>/mod2:refs/mod2:server[mod2:name='c']</target></refs>`,
+			wantTags: []ErrorTag{ErrorTagDataMissing},
+		},
+		{
+			name: "xml optional target missing",
+			xml:  `<refs xmlns="urn:mod2"><optional-target>/mod2:refs/mod2:server[mod2:name='c']</optional-target></refs>`,
+		},
+		{
+			name:     "xml undeclared prefix",
+			xml:      `<refs xmlns="urn:mod2"><optional-target>/bad:refs</optional-target></refs>`,
+			wantTags: []ErrorTag{ErrorTagInvalidValue},
+		},
+		{
+			name: "json target found",
+			json: `{"module2:refs":{"server":[{"name":"a","port":1}],"target":"/module2:refs/server[name='a']"}}`,
+		},
+		{
+			name:     "json target missing",
+			json:     `{"module2:refs":{"target":"/module2:refs/server[name='a']"}}`,
+			wantTags: []ErrorTag{ErrorTagDataMissing},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			td := &Decoder{Node: dom.NewDocument(nil), Modules: c}
+			un := dom.NewUnmarshaler(td)
+			var err error
+			if tt.json != "" {
+				un.InitializeArgs = []string{"mediatype", "application/yang-data+json"}
+				_, err = un.JSONReader().ReadFrom(strings.NewReader(tt.json))
+			} else {
+				un.InitializeArgs = []string{"mediatype", "application/yang-data+xml"}
+				_, err = un.XMLReader().ReadFrom(strings.NewReader(tt.xml))
+			}
+			if err != nil {
+				t.Fatalf("ReadFrom() err = %v, wantErr false", err)
+			}
+			var gotTags []ErrorTag
+			for _, err := range td.DecodingErrors() {
+				gotTags = append(gotTags, err.(*DecodeError).Tag)
+			}
+			if !reflect.DeepEqual(gotTags, tt.wantTags) {
+				t.Errorf("got decoding errors %v, want tags %v", td.DecodingErrors(), tt.wantTags)
+			}
+		})
+	}
+}
@@ -0,0 +1,251 @@
+package datastore
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	xml "github.com/andaru/flexml"
+	"github.com/andaru/opr8/dom"
+	"github.com/andaru/opr8/modules"
+	"github.com/openconfig/goyang/pkg/yang"
+	"github.com/pkg/errors"
+)
+
+// MarshalJSON returns the RFC 7951 JSON encoding of the data nodes, an
+// object with a member for the nodes of each name, in the order the
+// names first appear, but for list keys with WithKeysFirst. The nodes
+// are siblings in a data tree with the schema of the collection c,
+// such as the children of a snapshot's root, or a single node. Member
+// names are qualified by their module name where their namespace
+// differs from their parent's, and at the top level.
+//
+// List and leaf-list entries are encoded as arrays, and leaf values
+// according to their type: integers of up to 32 bits as numbers,
+// booleans as literals, empty leaves as [null], identityref and
+// instance-identifier values with module name prefixes, and other
+// values as strings. Nodes with no schema node, such as the content
+// of anydata, are encoded as objects or strings.
+func MarshalJSON(c *modules.Collection, nodes []dom.Node, options ...EncodeOption) []byte {
+	var b bytes.Buffer
+	var e *yang.Entry
+	if len(nodes) > 0 {
+		if parent := nodes[0].Parent(); parent != nil && parent.NodeType() == dom.NodeTypeElement {
+			e = schemaOf(c, parent)
+		}
+	}
+	enc := jsonEncoder{c: c, b: &b, encodeOptions: newEncodeOptions(options)}
+	enc.object(nodes, e, "")
+	return b.Bytes()
+}
+
+// MarshalJSONValue returns the RFC 7951 JSON encoding of the value of
+// the data nodes, the instances of a single schema node in a data tree
+// with the schema of the collection c, as for a gNMI JSON_IETF value:
+// the value of a leaf, the object of a container or list entry, or an
+// array of the values of several nodes, such as leaf-list entries.
+// Member names are qualified by their module name where their
+// namespace differs from the nodes'.
+func MarshalJSONValue(c *modules.Collection, nodes []dom.Node, options ...EncodeOption) []byte {
+	var b bytes.Buffer
+	if len(nodes) == 0 {
+		return []byte("null")
+	}
+	e := schemaOf(c, nodes[0])
+	enc := jsonEncoder{c: c, b: &b, encodeOptions: newEncodeOptions(options)}
+	if len(nodes) == 1 && (e == nil || !e.IsLeafList()) {
+		enc.node(nodes[0], e)
+		return b.Bytes()
+	}
+	b.WriteByte('[')
+	for i, n := range nodes {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		enc.node(n, e)
+	}
+	b.WriteByte(']')
+	return b.Bytes()
+}
+
+type jsonEncoder struct {
+	c *modules.Collection
+	b *bytes.Buffer
+	encodeOptions
+}
+
+// object writes the object of the data nodes, children of a node of
+// schema node parent, or nil, in the namespace ns.
+func (enc *jsonEncoder) object(nodes []dom.Node, parent *yang.Entry, ns string) {
+	var names []xml.Name
+	groups := map[xml.Name][]dom.Node{}
+	for _, n := range nodes {
+		if n.NodeType() != dom.NodeTypeElement {
+			continue
+		}
+		name := n.Name()
+		if _, ok := groups[name]; !ok {
+			names = append(names, name)
+		}
+		groups[name] = append(groups[name], n)
+	}
+	if enc.keysFirst && parent != nil && parent.IsList() {
+		rank := keyRank(enc.c, parent)
+		sort.SliceStable(names, func(i, j int) bool { return rank(names[i]) < rank(names[j]) })
+	}
+
+	enc.b.WriteByte('{')
+	for i, name := range names {
+		group := groups[name]
+		var e *yang.Entry
+		if parent != nil {
+			e = enc.c.DataChild(parent, name.Local)
+		} else if enc.c != nil {
+			e, _ = enc.c.RootEntry(name)
+		}
+		if e != nil && e.Namespace().Name != name.Space {
+			e = nil
+		}
+
+		if i > 0 {
+			enc.b.WriteByte(',')
+		}
+		member := name.Local
+		if name.Space != ns {
+			member = enc.module(name.Space) + ":" + member
+		}
+		enc.string(member)
+		enc.b.WriteByte(':')
+
+		switch {
+		case e != nil && (e.IsList() || e.IsLeafList()):
+			enc.b.WriteByte('[')
+			for j, n := range group {
+				if j > 0 {
+					enc.b.WriteByte(',')
+				}
+				enc.node(n, e)
+			}
+			enc.b.WriteByte(']')
+		case len(group) > 1:
+			// repeated nodes with no schema are kept as an array
+			enc.b.WriteByte('[')
+			for j, n := range group {
+				if j > 0 {
+					enc.b.WriteByte(',')
+				}
+				enc.node(n, nil)
+			}
+			enc.b.WriteByte(']')
+		default:
+			enc.node(group[0], e)
+		}
+	}
+	enc.b.WriteByte('}')
+}
+
+// node writes the value of the data node n, of schema node e, or nil.
+func (enc *jsonEncoder) node(n dom.Node, e *yang.Entry) {
+	switch {
+	case e != nil && e.Kind == yang.LeafEntry:
+		enc.leaf(n, e, e.Type)
+	case e != nil && e.Kind == yang.DirectoryEntry:
+		enc.object(dataChildren(n), e, n.Name().Space)
+	case len(dataChildren(n)) > 0:
+		enc.object(dataChildren(n), nil, n.Name().Space)
+	default:
+		enc.string(n.ChildValue())
+	}
+}
+
+// leaf writes the value of the leaf or leaf-list entry n, of schema
+// node e, with the type t.
+func (enc *jsonEncoder) leaf(n dom.Node, e *yang.Entry, t *yang.YangType) {
+	value := n.ChildValue()
+	if t == nil {
+		enc.string(value)
+		return
+	}
+	switch t.Kind {
+	case yang.Yunion:
+		if member, err := checkUnion(e, t, value); err == nil {
+			enc.leaf(n, e, member)
+			return
+		}
+	case yang.Yleafref:
+		if target, err := leafrefTarget(e, t); err == nil {
+			enc.leaf(n, target, target.Type)
+			return
+		}
+	case yang.Yint8, yang.Yint16, yang.Yint32, yang.Yuint8, yang.Yuint16, yang.Yuint32:
+		if isDigits(strings.TrimPrefix(value, "-")) {
+			enc.b.WriteString(value)
+			return
+		}
+	case yang.Ybool:
+		if value == "true" || value == "false" {
+			enc.b.WriteString(value)
+			return
+		}
+	case yang.Yempty:
+		enc.b.WriteString("[null]")
+		return
+	case yang.Yidentityref:
+		if i := strings.IndexByte(value, ':'); i >= 0 {
+			if ns, err := namespaceLookup(n, enc.c)(value[:i]); err == nil {
+				value = enc.module(ns) + value[i:]
+			}
+		}
+	case yang.YinstanceIdentifier:
+		if id, err := ParseInstanceID(value, namespaceLookup(n, enc.c)); err == nil {
+			value = id.Format(enc.module)
+		}
+	}
+	enc.string(value)
+}
+
+// module returns the name of the module with the namespace ns, or ns
+// if it is unknown.
+func (enc *jsonEncoder) module(ns string) string {
+	if enc.c != nil {
+		if m, err := enc.c.ModuleByNamespace(ns); err == nil {
+			return m.Name
+		}
+	}
+	return ns
+}
+
+func (enc *jsonEncoder) string(s string) {
+	// strings are always encoded
+	b, _ := json.Marshal(s)
+	enc.b.Write(b)
+}
+
+// namespaceLookup returns the namespace of a prefix of a value of the
+// leaf n: an XML namespace prefix in scope, or a module name or prefix
+// of c.
+func namespaceLookup(n dom.Node, c *modules.Collection) func(string) (string, error) {
+	return func(prefix string) (string, error) {
+		for it := n; it != nil; it = it.Parent() {
+			ap, ok := it.(dom.AttributeProvider)
+			if !ok {
+				continue
+			}
+			for a := dom.Node(ap.FirstAttribute()); a != nil; a = a.NextSibling() {
+				if name := a.Name(); name.Space == "xmlns" && name.Local == prefix {
+					return a.Value(), nil
+				}
+			}
+		}
+		if c != nil {
+			if ns := moduleNamespace(c, prefix); ns != "" {
+				return ns, nil
+			}
+			if mod, err := c.Raw().FindModuleByPrefix(prefix); err == nil && mod.Namespace != nil {
+				return mod.Namespace.Name, nil
+			}
+		}
+		return "", errors.Errorf("undeclared namespace prefix %q", prefix)
+	}
+}
@@ -0,0 +1,65 @@
+package datastore
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/andaru/opr8/dom"
+)
+
+func TestMarshalJSON(t *testing.T) {
+	c := newTestCollection(t)
+	for _, tt := range []struct {
+		name, data, want string
+		// child selects the children of the top-level node
+		child bool
+	}{
+		{
+			name: "types",
+			data: `<types xmlns="urn:mod2"><port>830</port><nested>true</nested><name>a"b</name><enabled/>` +
+				`<ratio>1.5</ratio><name-ref>a"b</name-ref></types>`,
+			want: `{"module2:types":{"port":830,"nested":true,"name":"a\"b","enabled":[null],"ratio":"1.5","name-ref":"a\"b"}}`,
+		},
+		{
+			name: "lists and leaf-lists",
+			data: `<refs xmlns="urn:mod2"><server><name>a</name><port>1</port></server><tag>x</tag>` +
+				`<server><name>b</name></server><tag>y</tag></refs>`,
+			want: `{"module2:refs":{"server":[{"name":"a","port":1},{"name":"b"}],"tag":["x","y"]}}`,
+		},
+		{
+			name:  "list entries",
+			data:  `<refs xmlns="urn:mod2"><server><name>a</name></server><tag>x</tag></refs>`,
+			want:  `{"module2:server":[{"name":"a"}],"module2:tag":["x"]}`,
+			child: true,
+		},
+		{
+			name: "identities and instance-identifiers",
+			data: `<link xmlns="urn:mod2" xmlns:m="urn:mod2"><type>m:tunnel</type></link>` +
+				`<refs xmlns="urn:mod2"><optional-target xmlns:p="urn:mod2">/p:refs/p:tag[.='x']</optional-target></refs>`,
+			want: `{"module2:link":{"type":"module2:tunnel"},"module2:refs":{"optional-target":"/module2:refs/tag[.='x']"}}`,
+		},
+		{
+			name: "unknown nodes",
+			data: `<x xmlns="urn:x"><y>1</y><y>2</y></x>`,
+			want: `{"urn:x:x":{"y":["1","2"]}}`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := dom.NewDocument(nil)
+			if _, err := dom.NewUnmarshaler(dom.NewBuilder(doc, dom.WithTrimPCData())).XMLReader().ReadFrom(strings.NewReader(tt.data)); err != nil {
+				t.Fatal(err)
+			}
+			nodes := dataChildren(doc)
+			if tt.child {
+				nodes = dataChildren(doc.FirstChild())
+			}
+			if got := string(MarshalJSON(c, nodes)); got != tt.want {
+				t.Errorf("MarshalJSON() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	if got := string(MarshalJSON(c, []dom.Node{})); got != "{}" {
+		t.Errorf("MarshalJSON() of no nodes = %s, want {}", got)
+	}
+}
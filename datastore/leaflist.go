@@ -0,0 +1,204 @@
+package datastore
+
+import (
+	"fmt"
+
+	xml "github.com/andaru/flexml"
+	"github.com/andaru/opr8/dom"
+	"github.com/openconfig/goyang/pkg/yang"
+	"github.com/pkg/errors"
+)
+
+// YANGNamespace is the namespace of the XML attributes defined by
+// YANG, such as those positioning entries of ordered-by user lists
+// and leaf-lists in an edit.
+const YANGNamespace = "urn:ietf:params:xml:ns:yang:1"
+
+// InsertAttr and ValueAttr are the names of the XML attributes of an
+// edit of an ordered-by user leaf-list entry giving its position
+// (RFC 7950 section 7.7.9). The value attribute is the value of the
+// entry the edited entry is inserted before or after.
+var (
+	InsertAttr = xml.Name{Space: YANGNamespace, Local: "insert"}
+	ValueAttr  = xml.Name{Space: YANGNamespace, Local: "value"}
+)
+
+// Insert is the position an entry of an ordered-by user leaf-list is
+// inserted at, as given by the insert attribute of an edit.
+type Insert int
+
+const (
+	// InsertLast inserts the entry after the last entry. It is the
+	// position of entries without an insert attribute.
+	InsertLast Insert = iota
+	// InsertFirst inserts the entry before the first entry.
+	InsertFirst
+	// InsertBefore inserts the entry before the entry of a value.
+	InsertBefore
+	// InsertAfter inserts the entry after the entry of a value.
+	InsertAfter
+)
+
+func (i Insert) String() string {
+	switch i {
+	case InsertLast:
+		return "last"
+	case InsertFirst:
+		return "first"
+	case InsertBefore:
+		return "before"
+	case InsertAfter:
+		return "after"
+	default:
+		return fmt.Sprintf("UNKNOWN(%d)", i)
+	}
+}
+
+// ParseInsert returns the position named s, such as the value of an
+// insert attribute.
+func ParseInsert(s string) (Insert, error) {
+	for i := InsertLast; i <= InsertAfter; i++ {
+		if i.String() == s {
+			return i, nil
+		}
+	}
+	return 0, errors.Errorf("unknown insert position %q", s)
+}
+
+// OrderedByUser returns true if e is a list or leaf-list whose entries
+// are ordered by the user, rather than by the server.
+func OrderedByUser(e *yang.Entry) bool {
+	return e.ListAttr != nil && e.ListAttr.OrderedBy != nil && e.ListAttr.OrderedBy.Name == "user"
+}
+
+// LeafList is the set of entries of a leaf-list under their parent
+// node, the elements named Name. Entries are compared by their
+// values, which are canonical once decoded.
+type LeafList struct {
+	Parent dom.Node
+	Name   xml.Name
+}
+
+// Entries returns the entries, in document order.
+func (l LeafList) Entries() []dom.Node {
+	var entries []dom.Node
+	for it := dom.NewChildNamedIterator(l.Parent, l.Name); it.NextSibling() != nil; {
+		entries = append(entries, it.Node())
+	}
+	return entries
+}
+
+// Values returns the values of the entries, in document order.
+func (l LeafList) Values() []string {
+	var values []string
+	for it := dom.NewChildNamedIterator(l.Parent, l.Name); it.NextSibling() != nil; {
+		values = append(values, it.Node().ChildValue())
+	}
+	return values
+}
+
+// Entry returns the first entry with the value, or nil if there is
+// none.
+func (l LeafList) Entry(value string) dom.Node {
+	for it := dom.NewChildNamedIterator(l.Parent, l.Name); it.NextSibling() != nil; {
+		if it.Node().ChildValue() == value {
+			return it.Node()
+		}
+	}
+	return nil
+}
+
+// Contains returns true if there is an entry with the value.
+func (l LeafList) Contains(value string) bool { return l.Entry(value) != nil }
+
+// Add appends an entry with the value after the last entry, unless
+// there is one already. It returns true if the entry was added.
+func (l LeafList) Add(value string) (bool, error) {
+	if l.Contains(value) {
+		return false, nil
+	}
+	n := dom.CreateElement(xml.StartElement{Name: l.Name})
+	if err := n.AppendChild(dom.CreateText(xml.CharData(value))); err != nil {
+		return false, err
+	}
+	return true, l.Insert(n, InsertLast, "")
+}
+
+// Remove removes the entries with the value. It returns true if there
+// were any.
+func (l LeafList) Remove(value string) bool {
+	var removed bool
+	for n := l.Entry(value); n != nil; n = l.Entry(value) {
+		if l.Parent.RemoveChild(n) != nil {
+			break
+		}
+		removed = true
+	}
+	return removed
+}
+
+// Duplicates returns the entries with the value of an entry before
+// them, in document order.
+func (l LeafList) Duplicates() []dom.Node {
+	var dups []dom.Node
+	seen := map[string]bool{}
+	for it := dom.NewChildNamedIterator(l.Parent, l.Name); it.NextSibling() != nil; {
+		if value := it.Node().ChildValue(); seen[value] {
+			dups = append(dups, it.Node())
+		} else {
+			seen[value] = true
+		}
+	}
+	return dups
+}
+
+// Insert inserts the entry n, a new entry or one already in the
+// leaf-list, at the position where among the other entries. For
+// InsertBefore and InsertAfter, point is the value of the entry n is
+// inserted before or after; if there is no such entry, a *DecodeError
+// with the error-app-tag missing-instance is returned.
+func (l LeafList) Insert(n dom.Node, where Insert, point string) error {
+	var ref dom.Node
+	if where == InsertBefore || where == InsertAfter {
+		if n.Parent() != nil && n.ChildValue() == point {
+			// the entry is its own insertion point
+			return nil
+		}
+		if ref = l.Entry(point); ref == nil {
+			return &DecodeError{
+				Tag:     ErrorTagBadAttribute,
+				AppTag:  "missing-instance",
+				Message: fmt.Sprintf("no %s entry %q to insert %s", l.Name.Local, point, where),
+			}
+		}
+	}
+	if p := n.Parent(); p != nil {
+		if err := p.RemoveChild(n); err != nil {
+			return err
+		}
+	}
+	switch where {
+	case InsertFirst:
+		if first := dom.NewChildNamedIterator(l.Parent, l.Name).NextSibling(); first != nil {
+			return l.Parent.InsertChildBefore(n, first)
+		}
+	case InsertBefore:
+		return l.Parent.InsertChildBefore(n, ref)
+	case InsertAfter:
+		return l.Parent.InsertChildAfter(n, ref)
+	default:
+		if last := dom.NewChildNamedIterator(l.Parent, l.Name).PreviousSibling(); last != nil {
+			return l.Parent.InsertChildAfter(n, last)
+		}
+	}
+	return l.Parent.AppendChild(n)
+}
+
+// duplicateEntry returns the error reported for the duplicate value of
+// an entry of the leaf-list e.
+func duplicateEntry(e *yang.Entry, value string) *DecodeError {
+	return &DecodeError{
+		Tag:     ErrorTagOperationFailed,
+		Message: fmt.Sprintf("duplicate value %q of leaf-list %s", value, e.Name),
+	}
+}
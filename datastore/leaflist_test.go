@@ -0,0 +1,145 @@
+package datastore
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	xml "github.com/andaru/flexml"
+	"github.com/andaru/opr8/dom"
+)
+
+func TestLeafList(t *testing.T) {
+	c := newTestCollection(t)
+	_, doc := decodeXML(t, c, `<refs xmlns="urn:mod2"><tag>x</tag><server><name>a</name></server><tag>y</tag></refs>`)
+	l := LeafList{Parent: doc.FirstChild(), Name: xml.Name{Space: "urn:mod2", Local: "tag"}}
+
+	if got := l.Values(); !reflect.DeepEqual(got, []string{"x", "y"}) {
+		t.Errorf("Values() = %v, want [x y]", got)
+	}
+	if !l.Contains("y") || l.Contains("z") {
+		t.Errorf("Contains(y), Contains(z) = %v, %v, want true, false", l.Contains("y"), l.Contains("z"))
+	}
+	if added, err := l.Add("x"); added || err != nil {
+		t.Errorf("Add(x) = %v, %v, want false, nil", added, err)
+	}
+	if added, err := l.Add("z"); !added || err != nil {
+		t.Errorf("Add(z) = %v, %v, want true, nil", added, err)
+	}
+	if err := l.Insert(l.Entry("z"), InsertFirst, ""); err != nil {
+		t.Fatal(err)
+	}
+	n := dom.CreateElement(xml.StartElement{Name: l.Name})
+	_ = n.AppendChild(dom.CreateText(xml.CharData("w")))
+	if err := l.Insert(n, InsertAfter, "x"); err != nil {
+		t.Fatal(err)
+	}
+	if got := l.Values(); !reflect.DeepEqual(got, []string{"z", "x", "w", "y"}) {
+		t.Errorf("Values() after Insert() = %v, want [z x w y]", got)
+	}
+	if last := doc.FirstChild().LastChild(); last.ChildValue() != "y" {
+		t.Errorf("last child = %s, want entry y", last.Name().Local)
+	}
+	err := l.Insert(l.Entry("w"), InsertBefore, "v")
+	if de, ok := err.(*DecodeError); !ok || de.AppTag != "missing-instance" {
+		t.Errorf("Insert() before a missing entry error = %v, want missing-instance", err)
+	}
+
+	_ = l.Parent.AppendChild(dom.CloneNode(l.Entry("x"), true))
+	if dups := l.Duplicates(); len(dups) != 1 || dups[0].ChildValue() != "x" {
+		t.Errorf("Duplicates() = %v, want an entry x", dups)
+	}
+	if !l.Remove("x") || l.Contains("x") || l.Remove("x") {
+		t.Error("Remove(x) did not remove both entries")
+	}
+	if got := len(l.Entries()); got != 3 {
+		t.Errorf("len(Entries()) = %d, want 3", got)
+	}
+}
+
+func TestParseInsert(t *testing.T) {
+	for _, i := range []Insert{InsertLast, InsertFirst, InsertBefore, InsertAfter} {
+		if got, err := ParseInsert(i.String()); err != nil || got != i {
+			t.Errorf("ParseInsert(%q) = %v, %v, want %v", i.String(), got, err, i)
+		}
+	}
+	if _, err := ParseInsert("middle"); err == nil {
+		t.Error(`ParseInsert("middle") error = nil, want an error`)
+	}
+}
+
+func TestOrderedByUser(t *testing.T) {
+	c := newTestCollection(t)
+	refs, err := c.RootEntry(xml.Name{Space: "urn:mod2", Local: "refs"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]bool{"priority": true, "tag": false, "server": false, "target": false} {
+		if got := OrderedByUser(refs.Dir[name]); got != want {
+			t.Errorf("OrderedByUser(%s) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestDecoder_UniqueState(t *testing.T) {
+	c := newTestCollection(t)
+	const input = `<refs xmlns="urn:mod2"><alarm>a</alarm><alarm>b</alarm><alarm>a</alarm></refs>`
+	for _, unique := range []bool{false, true} {
+		doc := dom.NewDocument(nil)
+		td := &Decoder{Node: doc, Modules: c, UniqueState: unique}
+		un := dom.NewUnmarshaler(td)
+		un.InitializeArgs = []string{"mediatype", "application/yang-data+xml"}
+		if _, err := un.XMLReader().ReadFrom(strings.NewReader(input)); err != nil {
+			t.Fatal(err)
+		}
+		want, wantErrs := []string{"a", "b", "a"}, 0
+		if unique {
+			want, wantErrs = want[:2], 1
+		}
+		l := LeafList{Parent: doc.FirstChild(), Name: xml.Name{Space: "urn:mod2", Local: "alarm"}}
+		if got := l.Values(); !reflect.DeepEqual(got, want) {
+			t.Errorf("UniqueState %v: entries %v, want %v", unique, got, want)
+		}
+		if got := len(td.DecodingErrors()); got != wantErrs {
+			t.Errorf("UniqueState %v: %d decoding errors, want %d", unique, got, wantErrs)
+		}
+	}
+}
+
+func TestDecoder_DuplicateValues(t *testing.T) {
+	c := newTestCollection(t)
+	for _, tt := range []struct {
+		name, input string
+		want        []string
+	}{
+		{
+			name:  "uint16",
+			input: `<refs xmlns="urn:mod2"><port>7</port><port>80</port><port>007</port><port>0080</port></refs>`,
+			want:  []string{"7", "80"},
+		},
+		{
+			name: "identityref",
+			input: `<refs xmlns="urn:mod2" xmlns:a="urn:mod2"><link-types>ethernet</link-types>` +
+				`<link-types xmlns:b="urn:mod2">b:ethernet</link-types><link-types>a:tunnel</link-types>` +
+				`<link-types>tunnel</link-types></refs>`,
+			want: []string{"ethernet", "a:tunnel"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := dom.NewDocument(nil)
+			td := &Decoder{Node: doc, Modules: c}
+			un := dom.NewUnmarshaler(td)
+			un.InitializeArgs = []string{"mediatype", "application/yang-data+xml"}
+			if _, err := un.XMLReader().ReadFrom(strings.NewReader(tt.input)); err != nil {
+				t.Fatal(err)
+			}
+			l := LeafList{Parent: doc.FirstChild(), Name: xml.Name{Space: "urn:mod2", Local: doc.FirstChild().FirstChild().Name().Local}}
+			if got := l.Values(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("entries %v, want %v", got, tt.want)
+			}
+			if got, want := len(td.DecodingErrors()), 2; got != want {
+				t.Errorf("%d decoding errors, want %d", got, want)
+			}
+		})
+	}
+}
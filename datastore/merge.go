@@ -0,0 +1,154 @@
+package datastore
+
+import (
+	"strings"
+
+	xml "github.com/andaru/flexml"
+	"github.com/andaru/opr8/dom"
+	"github.com/openconfig/goyang/pkg/yang"
+)
+
+// mergeElement merges the just decoded element n with schema e into
+// a matching preceding sibling, if one exists. Containers and list
+// entries with equal keys are merged recursively, leaf values are
+// replaced and duplicate leaf-list entries are dropped.
+func (un *Decoder) mergeElement(n dom.Node, e *yang.Entry) {
+	parent := n.Parent()
+	if parent == nil {
+		return
+	}
+	if match := un.mergeTarget(parent, n, e); match != nil {
+		un.mergeInto(match, n, e)
+	}
+}
+
+// siblings are the child elements of a name of a parent.
+type siblings struct {
+	parent dom.Node
+	name   xml.Name
+}
+
+// mergeTarget returns the first child of parent addressing the same
+// data node as n, of schema node e, or nil if there is none, when n is
+// added to those merged into. The children of each name of a parent
+// are indexed by data node, from those in the tree on first use.
+func (un *Decoder) mergeTarget(parent, n dom.Node, e *yang.Entry) dom.Node {
+	id, ok := dataNodeID(e, n)
+	if !ok {
+		return nil
+	}
+	key := siblings{parent, n.Name()}
+	index, ok := un.merged[key]
+	if !ok {
+		index = map[string]dom.Node{}
+		for it := dom.NewChildNamedIterator(parent, key.name); it.NextSibling() != nil; {
+			if it.Node() == n {
+				continue
+			}
+			if cid, ok := dataNodeID(e, it.Node()); ok && index[cid] == nil {
+				index[cid] = it.Node()
+			}
+		}
+		if un.merged == nil {
+			un.merged = map[siblings]map[string]dom.Node{}
+		}
+		un.merged[key] = index
+	}
+	if match := index[id]; match != nil {
+		return match
+	}
+	index[id] = n
+	return nil
+}
+
+// mergeInto merges src into dst, both instances of the schema node e,
+// and removes src from the tree. The attributes of src are set on dst.
+func (un *Decoder) mergeInto(dst, src dom.Node, e *yang.Entry) {
+	mergeAttrs(dst, src)
+	switch {
+	case e.IsLeafList():
+		// the entry is already present
+		delete(un.resolved, src)
+	case e.Kind == yang.DirectoryEntry:
+		var children []dom.Node
+		for it := src.FirstChild(); it != nil; it = it.NextSibling() {
+			children = append(children, it)
+		}
+		for _, child := range children {
+			ce := un.Modules.DataChild(e, child.Name().Local)
+			var match dom.Node
+			if ce != nil {
+				match = un.mergeTarget(dst, child, ce)
+			}
+			if match != nil {
+				un.mergeInto(match, child, ce)
+			} else {
+				moveNode(child, dst)
+			}
+		}
+	default:
+		// leaves and anydata replace the existing content
+		for it := dst.FirstChild(); it != nil; it = dst.FirstChild() {
+			_ = dst.RemoveChild(it)
+		}
+		for it := src.FirstChild(); it != nil; it = src.FirstChild() {
+			moveNode(it, dst)
+		}
+		if t, ok := un.resolved[src]; ok {
+			delete(un.resolved, src)
+			un.resolved[dst] = t
+		} else {
+			delete(un.resolved, dst)
+		}
+	}
+	if p := src.Parent(); p != nil {
+		_ = p.RemoveChild(src)
+	}
+}
+
+// sameDataNode returns true if a and b, of schema node e, address the
+// same data node: the same container or leaf, the list entry with the
+// same keys or the leaf-list entry with the same value.
+func sameDataNode(e *yang.Entry, a, b dom.Node) bool {
+	if a.Name() != b.Name() {
+		return false
+	}
+	ida, oka := dataNodeID(e, a)
+	idb, okb := dataNodeID(e, b)
+	return oka && okb && ida == idb
+}
+
+// dataNodeID returns the identity of the element n, of schema node e,
+// among its siblings of the same name: the values of its keys if a
+// list entry, its value if a leaf-list entry, and otherwise empty. It
+// returns false for the entries of keyless lists, which are never the
+// same, and for list entries missing a key.
+func dataNodeID(e *yang.Entry, n dom.Node) (string, bool) {
+	switch {
+	case e.IsList():
+		keys := strings.Fields(e.Key)
+		if len(keys) == 0 {
+			return "", false
+		}
+		values := make([]string, len(keys))
+		for i, key := range keys {
+			k := n.ChildByName(xml.Name{Space: n.Name().Space, Local: key})
+			if k == nil {
+				return "", false
+			}
+			values[i] = k.ChildValue()
+		}
+		// key values are separated by a character XML excludes
+		return strings.Join(values, "\x00"), true
+	case e.IsLeafList():
+		return n.ChildValue(), true
+	}
+	return "", true
+}
+
+func moveNode(n, parent dom.Node) {
+	if p := n.Parent(); p != nil {
+		_ = p.RemoveChild(n)
+	}
+	_ = parent.AppendChild(n)
+}
@@ -0,0 +1,89 @@
+package datastore
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/andaru/flexml"
+	"github.com/andaru/opr8/dom"
+)
+
+func TestDecoderMerge(t *testing.T) {
+	c := newTestCollection(t)
+
+	for _, tt := range []struct {
+		name    string
+		inputs  []string
+		merge   bool
+		wantXML string
+	}{
+		{
+			name:    "append without merge",
+			inputs:  []string{`<system xmlns="urn:mod1"><host-name>a</host-name></system>`, `<system xmlns="urn:mod1"><host-name>b</host-name></system>`},
+			wantXML: `<system xmlns="urn:mod1"><host-name>a</host-name></system><system xmlns="urn:mod1"><host-name>b</host-name></system>`,
+		},
+		{
+			name:    "container merged and leaf replaced",
+			merge:   true,
+			inputs:  []string{`<system xmlns="urn:mod1"><host-name>a</host-name></system>`, `<system xmlns="urn:mod1"><host-name>b</host-name></system>`},
+			wantXML: `<system xmlns="urn:mod1"><host-name>b</host-name></system>`,
+		},
+		{
+			name:  "leaf-list entries are not duplicated",
+			merge: true,
+			inputs: []string{
+				`<system xmlns="urn:mod1"><domain-name-servers>ns1</domain-name-servers><domain-name-servers>ns2</domain-name-servers></system>`,
+				`<system xmlns="urn:mod1"><domain-name-servers>ns2</domain-name-servers><domain-name-servers>ns3</domain-name-servers><host-name>a</host-name></system>`,
+			},
+			wantXML: `<system xmlns="urn:mod1"><domain-name-servers>ns1</domain-name-servers><domain-name-servers>ns2</domain-name-servers><domain-name-servers>ns3</domain-name-servers><host-name>a</host-name></system>`,
+		},
+		{
+			name:  "list entries merged by key",
+			merge: true,
+			inputs: []string{
+				`<refs xmlns="urn:mod2"><server><name>a</name><port>1</port></server><server><name>b</name></server></refs>`,
+				`<refs xmlns="urn:mod2"><server><port>2</port><name>b</name></server><server><name>c</name><port>3</port></server></refs>`,
+				`<refs xmlns="urn:mod2"><server><name>a</name><port>4</port></server></refs>`,
+			},
+			wantXML: `<refs xmlns="urn:mod2"><server><name>a</name><port>4</port></server><server><name>b</name><port>2</port></server><server><name>c</name><port>3</port></server></refs>`,
+		},
+		{
+			name:  "list entries merged in any order",
+			merge: true,
+			inputs: []string{
+				`<refs xmlns="urn:mod2"><server><name>a</name></server><server><name>b</name></server><server><name>c</name></server></refs>`,
+				`<refs xmlns="urn:mod2"><server><name>c</name><port>3</port></server><server><name>b</name><port>2</port></server><server><name>a</name><port>1</port></server></refs>`,
+			},
+			wantXML: `<refs xmlns="urn:mod2"><server><name>a</name><port>1</port></server><server><name>b</name><port>2</port></server><server><name>c</name><port>3</port></server></refs>`,
+		},
+		{
+			name:  "duplicates within one document",
+			merge: true,
+			inputs: []string{
+				`<refs xmlns="urn:mod2"><tag>x</tag><server><name>a</name></server><tag>x</tag><server><name>a</name><port>1</port></server></refs>`,
+			},
+			wantXML: `<refs xmlns="urn:mod2"><tag>x</tag><server><name>a</name><port>1</port></server></refs>`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := dom.NewDocument(nil)
+			for _, input := range tt.inputs {
+				td := &Decoder{Node: doc, Modules: c, Merge: tt.merge}
+				un := dom.NewUnmarshaler(td)
+				un.InitializeArgs = []string{"mediatype", "application/yang-data+xml"}
+				if _, err := un.XMLReader().ReadFrom(strings.NewReader(input)); err != nil {
+					t.Fatalf("ReadFrom() err = %v, wantErr false", err)
+				}
+				if errs := td.DecodingErrors(); len(errs) > 0 {
+					t.Fatalf("got decoding errors %v", errs)
+				}
+			}
+			b, err := flexml.Marshal(dom.NewMarshaler(doc))
+			if err != nil {
+				t.Fatalf("xml.Marshal(doc) error: %v, wantErr false", err)
+			} else if string(b) != tt.wantXML {
+				t.Errorf("encoded XML got:\n%s\nwant:\n%s\n", b, tt.wantXML)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package datastore
+
+import (
+	"sort"
+
+	xml "github.com/andaru/flexml"
+	"github.com/andaru/opr8/dom"
+	"github.com/andaru/opr8/modules"
+	"github.com/openconfig/goyang/pkg/yang"
+	"github.com/pkg/errors"
+)
+
+// SortSchemaOrder reorders the children of root and its descendants
+// into schema definition order. List entry keys are ordered first, in
+// key order. Entries of the same list or leaf-list keep their
+// relative order, as do elements unknown to the schema, which are
+// placed last.
+//
+// The schema is the schema node for root, or nil if root is a
+// Document, whose top-level elements are found in the collection c.
+func SortSchemaOrder(root dom.Node, c *modules.Collection, schema *yang.Entry) error {
+	if root == nil || c == nil {
+		return errors.New("sort requires a root node and module collection")
+	}
+	if schema != nil {
+		sortChildren(c, root, schema)
+		return nil
+	}
+	if root.NodeType() != dom.NodeTypeDocument {
+		return errors.New("sort requires the schema of a root element")
+	}
+	for it := root.FirstChild(); it != nil; it = it.NextSibling() {
+		if it.NodeType() != dom.NodeTypeElement {
+			continue
+		}
+		if e := rootEntry(c, it.Name()); e != nil {
+			sortChildren(c, it, e)
+		}
+	}
+	return nil
+}
+
+func sortChildren(c *modules.Collection, n dom.Node, e *yang.Entry) {
+	if e.Kind != yang.DirectoryEntry || n.FirstChild() == nil {
+		return
+	}
+	order := c.SchemaOrder(e)
+	var children []dom.Node
+	for it := n.FirstChild(); it != nil; it = it.NextSibling() {
+		children = append(children, it)
+	}
+	index := func(child dom.Node) int {
+		if child.NodeType() == dom.NodeTypeElement {
+			if i, ok := order[child.Name().Local]; ok {
+				return i
+			}
+		}
+		return len(order)
+	}
+	sort.SliceStable(children, func(i, j int) bool { return index(children[i]) < index(children[j]) })
+	for _, child := range children {
+		_ = n.RemoveChild(child)
+		_ = n.AppendChild(child)
+		if child.NodeType() != dom.NodeTypeElement {
+			continue
+		}
+		if ce := c.DataChild(e, child.Name().Local); ce != nil {
+			sortChildren(c, child, ce)
+		}
+	}
+}
+
+// keyRank returns the rank of the children of an entry of the list e in
+// the schema order of the collection c: that of the list keys, which
+// are first in key order, or the number of keys for the other
+// children, so that a stable sort by rank moves the keys first.
+func keyRank(c *modules.Collection, e *yang.Entry) func(xml.Name) int {
+	order, nkeys, ns := c.SchemaOrder(e), len(listKeys(e)), e.Namespace().Name
+	return func(name xml.Name) int {
+		if i, ok := order[name.Local]; ok && i < nkeys && name.Space == ns {
+			return i
+		}
+		return nkeys
+	}
+}
+
+// rootEntry returns the top-level data node of the collection c with
+// the name, or nil if there is none.
+func rootEntry(c *modules.Collection, name xml.Name) *yang.Entry {
+	mod, err := c.ModuleByNamespace(name.Space)
+	if err != nil {
+		return nil
+	}
+	me, err := c.ModuleEntry(mod.Name)
+	if err != nil {
+		return nil
+	}
+	return c.DataChild(me, name.Local)
+}
@@ -0,0 +1,73 @@
+package datastore
+
+import (
+	"testing"
+
+	"github.com/andaru/flexml"
+	"github.com/andaru/opr8/dom"
+)
+
+func TestSortSchemaOrder(t *testing.T) {
+	c := newTestCollection(t)
+	mod, err := c.ModuleEntry("module2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name    string
+		input   string
+		wantXML string
+	}{
+		{
+			name:    "already ordered",
+			input:   `<ordered xmlns="urn:mod2"><first>a</first><last>z</last></ordered>`,
+			wantXML: `<ordered xmlns="urn:mod2"><first>a</first><last>z</last></ordered>`,
+		},
+		{
+			name: "grouping and choice children",
+			input: `<ordered xmlns="urn:mod2"><last>z</last><beta>b</beta><mask>24</mask>` +
+				`<first>a</first><address>10.0.0.1</address></ordered>`,
+			wantXML: `<ordered xmlns="urn:mod2"><first>a</first><address>10.0.0.1</address>` +
+				`<mask>24</mask><beta>b</beta><last>z</last></ordered>`,
+		},
+		{
+			name: "list keys first and entries keep their order",
+			input: `<ordered xmlns="urn:mod2"><entry><value>2</value><id>b</id></entry><first>a</first>` +
+				`<entry><id>a</id><value>1</value></entry></ordered>`,
+			wantXML: `<ordered xmlns="urn:mod2"><first>a</first><entry><id>b</id><value>2</value></entry>` +
+				`<entry><id>a</id><value>1</value></entry></ordered>`,
+		},
+		{
+			name: "top-level elements of several modules",
+			input: `<refs xmlns="urn:mod2"><tag>x</tag><server><port>1</port><name>a</name></server></refs>` +
+				`<system xmlns="urn:mod1"><domain-name-servers>ns1</domain-name-servers><host-name>h</host-name></system>`,
+			wantXML: `<refs xmlns="urn:mod2"><server><name>a</name><port>1</port></server><tag>x</tag></refs>` +
+				`<system xmlns="urn:mod1"><host-name>h</host-name><domain-name-servers>ns1</domain-name-servers></system>`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, doc := decodeXML(t, c, tt.input)
+			if err := SortSchemaOrder(doc, c, nil); err != nil {
+				t.Fatalf("SortSchemaOrder() error = %v, wantErr false", err)
+			}
+			b, err := flexml.Marshal(dom.NewMarshaler(doc))
+			if err != nil {
+				t.Fatalf("xml.Marshal(doc) error: %v, wantErr false", err)
+			} else if string(b) != tt.wantXML {
+				t.Errorf("encoded XML got:\n%s\nwant:\n%s\n", b, tt.wantXML)
+			}
+		})
+	}
+
+	t.Run("relative to a container", func(t *testing.T) {
+		_, doc := decodeXML(t, c, `<refs xmlns="urn:mod2"><target>/mod2:refs</target><tag>x</tag></refs>`)
+		refs := doc.FirstChild()
+		if err := SortSchemaOrder(refs, c, mod.Dir["refs"]); err != nil {
+			t.Fatalf("SortSchemaOrder() error = %v, wantErr false", err)
+		}
+		if got := refs.FirstChild().Name().Local; got != "tag" {
+			t.Errorf("first child = %s, want tag", got)
+		}
+	})
+}
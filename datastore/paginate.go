@@ -0,0 +1,173 @@
+package datastore
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	xml "github.com/andaru/flexml"
+	"github.com/andaru/opr8/dom"
+	"github.com/andaru/opr8/modules"
+	"github.com/openconfig/goyang/pkg/yang"
+	"github.com/pkg/errors"
+)
+
+// PageQuery describes the page of list or leaf-list entries to
+// retrieve, following the query parameters of the IETF list
+// pagination drafts. The zero value selects all entries in system
+// order.
+type PageQuery struct {
+	// Where selects the entries to include. All entries are included
+	// if Where is nil.
+	Where func(entry dom.Node) bool
+	// SortBy is the "/" separated path of a descendant leaf of each
+	// list entry, e.g., "config/mtu", by whose value entries are
+	// sorted. Leaf-list entries are sorted by value if SortBy is
+	// non-empty. If empty, entries remain in system order.
+	SortBy string
+	// Backwards reverses the direction of the entries, which are
+	// otherwise returned in ascending (or system) order.
+	Backwards bool
+	// Offset is the number of entries to skip.
+	Offset int
+	// Limit is the maximum number of entries returned, or zero for
+	// no limit.
+	Limit int
+}
+
+// Page is a page of list or leaf-list entries.
+type Page struct {
+	// Entries are the entries of the page, in order.
+	Entries []dom.Node
+	// Remaining is the number of entries which follow the page.
+	Remaining int
+}
+
+// Paginate returns the page of entries of the list or leaf-list
+// schema node e of the collection c, the children of parent, selected
+// by the query q.
+// Entries are filtered by q.Where before being sorted and the page
+// is selected. An error is returned if q.Offset exceeds the number
+// of selected entries.
+//
+// The parent node may be found using Find, e.g.,
+//
+//	parent, err := Find(snapshot.Root, c, "/example:routes")
+//	page, err := Paginate(c, parent, mod.Dir["routes"].Dir["route"], PageQuery{Limit: 100})
+func Paginate(c *modules.Collection, parent dom.Node, e *yang.Entry, q PageQuery) (*Page, error) {
+	if !e.IsList() && !e.IsLeafList() {
+		return nil, errors.Errorf("%s is not a list or leaf-list", e.Name)
+	}
+	if q.Offset < 0 || q.Limit < 0 {
+		return nil, errors.Errorf("invalid offset %d or limit %d", q.Offset, q.Limit)
+	}
+
+	var entries []dom.Node
+	for _, entry := range parent.ChildrenByName(xml.Name{Space: e.Namespace().Name, Local: e.Name}) {
+		if q.Where == nil || q.Where(entry) {
+			entries = append(entries, entry)
+		}
+	}
+
+	if q.SortBy != "" {
+		key, err := sortKey(c, e, q.SortBy)
+		if err != nil {
+			return nil, err
+		}
+		sort.SliceStable(entries, func(i, j int) bool { return key(entries[i], entries[j]) })
+	}
+	if q.Backwards {
+		for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+			entries[i], entries[j] = entries[j], entries[i]
+		}
+	}
+
+	if q.Offset > len(entries) {
+		return nil, errors.Errorf("offset %d out of range of %d entries", q.Offset, len(entries))
+	}
+	entries = entries[q.Offset:]
+	page := &Page{Entries: entries}
+	if q.Limit > 0 && q.Limit < len(entries) {
+		page.Entries = entries[:q.Limit]
+		page.Remaining = len(entries) - q.Limit
+	}
+	return page, nil
+}
+
+// sortKey returns a less function comparing entries of e, a schema node
+// of the collection c, by the value
+// of the descendant leaf at path. Numeric leaves compare numerically,
+// by the type they resolve to.
+func sortKey(c *modules.Collection, e *yang.Entry, path string) (func(a, b dom.Node) bool, error) {
+	leaf := e
+	var names []string
+	if e.IsList() {
+		for _, local := range strings.Split(strings.Trim(path, "/"), "/") {
+			leaf = c.DataChild(leaf, local)
+			if leaf == nil {
+				return nil, errors.Errorf("invalid sort-by %q: unknown node %q", path, local)
+			}
+			names = append(names, local)
+		}
+		if leaf.Kind != yang.LeafEntry {
+			return nil, errors.Errorf("invalid sort-by %q: not a leaf", path)
+		}
+	}
+
+	value := func(n dom.Node) (string, bool) {
+		for _, local := range names {
+			if n = n.ChildByName(xml.Name{Space: n.Name().Space, Local: local}); n == nil {
+				return "", false
+			}
+		}
+		return n.ChildValue(), true
+	}
+	t := modules.ResolveType(leaf)
+	if t.Target != nil {
+		// leafrefs compare as the leaf referred to
+		t = modules.ResolveType(t.Target)
+	}
+	// values not of the type, which are invalid, compare as strings
+	less := func(a, b string) bool { return a < b }
+	switch t.Kind {
+	case yang.Yint8, yang.Yint16, yang.Yint32, yang.Yint64:
+		less = func(a, b string) bool {
+			ia, erra := strconv.ParseInt(a, 10, 64)
+			ib, errb := strconv.ParseInt(b, 10, 64)
+			if erra != nil || errb != nil {
+				return a < b
+			}
+			return ia < ib
+		}
+	case yang.Yuint8, yang.Yuint16, yang.Yuint32, yang.Yuint64:
+		less = func(a, b string) bool {
+			ua, erra := strconv.ParseUint(a, 10, 64)
+			ub, errb := strconv.ParseUint(b, 10, 64)
+			if erra != nil || errb != nil {
+				return a < b
+			}
+			return ua < ub
+		}
+	case yang.Ydecimal64:
+		// decimal64 values compare as integers scaled by their
+		// fraction digits
+		less = func(a, b string) bool {
+			na, erra := parseDecimal64(a, t.FractionDigits)
+			nb, errb := parseDecimal64(b, t.FractionDigits)
+			if erra != nil || errb != nil {
+				return a < b
+			}
+			return na.Less(nb)
+		}
+	}
+
+	return func(a, b dom.Node) bool {
+		va, oka := value(a)
+		vb, okb := value(b)
+		if !oka || !okb {
+			// entries without the leaf sort last
+			return oka && !okb
+		}
+		return less(va, vb)
+	}, nil
+}
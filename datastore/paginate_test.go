@@ -0,0 +1,101 @@
+package datastore
+
+import (
+	"strings"
+	"testing"
+
+	xml "github.com/andaru/flexml"
+	"github.com/andaru/opr8/dom"
+)
+
+func TestPaginate(t *testing.T) {
+	c := newTestCollection(t)
+	_, doc := decodeXML(t, c, `<refs xmlns="urn:mod2">`+
+		`<server><name>c</name><port>10</port></server>`+
+		`<server><name>a</name><port>9</port></server>`+
+		`<server><name>d</name></server>`+
+		`<server><name>b</name><port>100</port></server>`+
+		`<tag>z</tag><tag>x</tag><tag>y</tag></refs>`)
+	mod, err := c.ModuleEntry("module2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	refs := doc.FirstChild()
+	server, tag := mod.Dir["refs"].Dir["server"], mod.Dir["refs"].Dir["tag"]
+	hasPort := func(n dom.Node) bool { return n.ChildByName(xml.Name{Space: "urn:mod2", Local: "port"}) != nil }
+
+	for _, tt := range []struct {
+		name          string
+		tag           bool
+		q             PageQuery
+		want          string
+		wantRemaining int
+		wantErr       bool
+	}{
+		{name: "all in system order", want: "c a d b"},
+		{name: "limit", q: PageQuery{Limit: 2}, want: "c a", wantRemaining: 2},
+		{name: "offset and limit", q: PageQuery{Offset: 1, Limit: 2}, want: "a d", wantRemaining: 1},
+		{name: "offset at end", q: PageQuery{Offset: 4}, want: ""},
+		{name: "offset out of range", q: PageQuery{Offset: 5}, wantErr: true},
+		{name: "sort by key", q: PageQuery{SortBy: "name"}, want: "a b c d"},
+		{name: "sort numerically, missing last", q: PageQuery{SortBy: "port"}, want: "a c b d"},
+		{name: "sort backwards", q: PageQuery{SortBy: "name", Backwards: true, Limit: 3}, want: "d c b", wantRemaining: 1},
+		{name: "where", q: PageQuery{Where: hasPort, SortBy: "port", Offset: 1}, want: "c b"},
+		{name: "unknown sort-by", q: PageQuery{SortBy: "bogus"}, wantErr: true},
+		{name: "negative limit", q: PageQuery{Limit: -1}, wantErr: true},
+		{name: "leaf-list sorted by value", tag: true, q: PageQuery{SortBy: "."}, want: "x y z"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			e, key := server, "name"
+			if tt.tag {
+				e, key = tag, ""
+			}
+			page, err := Paginate(c, refs, e, tt.q)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Paginate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			var got []string
+			for _, entry := range page.Entries {
+				if key != "" {
+					entry = entry.ChildByName(xml.Name{Space: "urn:mod2", Local: key})
+				}
+				got = append(got, entry.ChildValue())
+			}
+			if strings.Join(got, " ") != tt.want || page.Remaining != tt.wantRemaining {
+				t.Errorf("Paginate() = %q remaining %d, want %q remaining %d", strings.Join(got, " "), page.Remaining, tt.want, tt.wantRemaining)
+			}
+		})
+	}
+
+	if _, err := Paginate(c, refs, mod.Dir["refs"], PageQuery{}); err == nil {
+		t.Errorf("Paginate() of a container error = nil, wantErr true")
+	}
+}
+
+func TestPaginate_numericTypes(t *testing.T) {
+	c := newTestCollection(t)
+	_, doc := decodeXML(t, c, `<refs xmlns="urn:mod2">`+
+		`<server><name>a</name><octets>18446744073709551615</octets><weight>-0.5</weight></server>`+
+		`<server><name>b</name><octets>18446744073709551614</octets><weight>-10.25</weight></server>`+
+		`<server><name>c</name><octets>9</octets><weight>2.5</weight></server></refs>`)
+	mod, err := c.ModuleEntry("module2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for sortBy, want := range map[string]string{"octets": "c b a", "weight": "b a c"} {
+		page, err := Paginate(c, doc.FirstChild(), mod.Dir["refs"].Dir["server"], PageQuery{SortBy: sortBy})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, entry := range page.Entries {
+			got = append(got, entry.ChildByName(xml.Name{Space: "urn:mod2", Local: "name"}).ChildValue())
+		}
+		if strings.Join(got, " ") != want {
+			t.Errorf("Paginate() sorted by %s = %q, want %q", sortBy, strings.Join(got, " "), want)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package datastore
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/andaru/opr8/dom"
+	"github.com/andaru/opr8/session"
+	"github.com/pkg/errors"
+)
+
+// Datastore names defined by NMDA (RFC 8342) and RFC 8808.
+const (
+	Running        = "running"
+	Startup        = "startup"
+	Candidate      = "candidate"
+	FactoryDefault = "factory-default"
+)
+
+// Set is the set of datastores of a server, by name. It is safe for
+// concurrent use.
+type Set struct {
+	mu sync.RWMutex
+	ds map[string]*Datastore
+}
+
+// NewSet returns a new Set with the datastores provided.
+func NewSet(datastores ...*Datastore) *Set {
+	s := &Set{ds: map[string]*Datastore{}}
+	for _, ds := range datastores {
+		s.Add(ds)
+	}
+	return s
+}
+
+// Add adds ds to the set, replacing any datastore of the same name.
+func (s *Set) Add(ds *Datastore) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ds[ds.Name()] = ds
+}
+
+// Get returns the named datastore, or nil if it is not in the set.
+func (s *Set) Get(name string) *Datastore {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.ds[name]
+}
+
+// Names returns the names of the datastores in the set, in order.
+func (s *Set) Names() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var names []string
+	for name := range s.ds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Reset replaces the content of the named datastore with a copy of
+// the factory-default datastore's content, as a new commit.
+func (s *Set) Reset(name string, sid session.ID) (*Snapshot, error) {
+	factory := s.Get(FactoryDefault)
+	if factory == nil {
+		return nil, errors.New("no factory-default datastore")
+	}
+	target := s.Get(name)
+	if target == nil {
+		return nil, errors.Errorf("unknown datastore %s", name)
+	}
+	content := factory.Snapshot().Root
+	return target.Update(sid, "reset to factory-default", func(root dom.Document) error {
+		for it := root.FirstChild(); it != nil; it = root.FirstChild() {
+			if err := root.RemoveChild(it); err != nil {
+				return err
+			}
+		}
+		for it := content.FirstChild(); it != nil; it = it.NextSibling() {
+			if err := root.AppendChild(dom.CloneNode(it, true)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// FactoryReset resets every writable datastore in the set to the
+// content of the factory-default datastore, as for the RFC 8808
+// factory-reset operation.
+func (s *Set) FactoryReset(sid session.ID) error {
+	for _, name := range s.Names() {
+		if s.Get(name).ReadOnly() {
+			continue
+		}
+		if _, err := s.Reset(name, sid); err != nil {
+			return errors.Wrapf(err, "reset of %s failed", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package datastore
+
+import (
+	"expvar"
+	"sync/atomic"
+	"time"
+
+	"github.com/andaru/opr8/dom"
+)
+
+// nodeOverhead is the approximate memory used by a tree node, other
+// than its names and value.
+const nodeOverhead = 96
+
+// Stats is a point in time summary of a datastore, suitable for
+// publishing with expvar (see Datastore.Var) or as metrics (see
+// Stats.Samples).
+type Stats struct {
+	// Name is the datastore name.
+	Name string `json:"name"`
+	// Nodes is the number of element nodes in the data tree.
+	Nodes int `json:"nodes"`
+	// TreeBytes is an estimate of the memory used by the data tree.
+	TreeBytes int `json:"tree_bytes"`
+	// Commits is the number of commits made to the datastore.
+	Commits uint64 `json:"commits"`
+	// ValidationFailures is the number of commits rejected by
+	// validation.
+	ValidationFailures uint64 `json:"validation_failures"`
+	// LastCommit is the time of the latest commit, or the zero time
+	// if there have been no commits.
+	LastCommit time.Time `json:"last_commit"`
+}
+
+// Stats returns the datastore's current statistics.
+func (ds *Datastore) Stats() Stats {
+	snap := ds.Snapshot()
+	snap.sizeOnce.Do(func() { snap.nodes, snap.bytes = treeSize(snap.Root) })
+	stats := Stats{
+		Name:               ds.name,
+		Nodes:              snap.nodes,
+		TreeBytes:          snap.bytes,
+		Commits:            snap.Generation,
+		ValidationFailures: atomic.LoadUint64(&ds.validationFailures),
+	}
+	if snap.Generation > 0 {
+		stats.LastCommit = snap.Time
+	}
+	return stats
+}
+
+// Var returns an expvar.Var reporting the datastore's statistics as
+// a JSON object, e.g., for expvar.Publish("datastore.running", v).
+func (ds *Datastore) Var() expvar.Var {
+	return expvar.Func(func() interface{} { return ds.Stats() })
+}
+
+// Samples returns the statistics as metric samples by name, such as
+// for export as Prometheus gauges and counters labelled with the
+// datastore name. Times are in seconds since the Unix epoch.
+func (s Stats) Samples() map[string]float64 {
+	samples := map[string]float64{
+		"datastore_nodes":                     float64(s.Nodes),
+		"datastore_tree_bytes":                float64(s.TreeBytes),
+		"datastore_commits_total":             float64(s.Commits),
+		"datastore_validation_failures_total": float64(s.ValidationFailures),
+		"datastore_last_commit_seconds":       0,
+	}
+	if !s.LastCommit.IsZero() {
+		samples["datastore_last_commit_seconds"] = float64(s.LastCommit.UnixNano()) / float64(time.Second)
+	}
+	return samples
+}
+
+// treeSize returns the number of element nodes below root and an
+// estimate of the memory used by all nodes below root.
+func treeSize(root dom.Node) (nodes, bytes int) {
+	for it := root.FirstChild(); it != nil; it = it.NextSibling() {
+		bytes += nodeOverhead
+		switch it.NodeType() {
+		case dom.NodeTypeElement:
+			nodes++
+			bytes += len(it.Name().Space) + len(it.Name().Local)
+			if ap, ok := it.(dom.AttributeProvider); ok {
+				for a := ap.FirstAttribute(); a != nil; a = a.NextSibling() {
+					bytes += nodeOverhead + len(a.Name().Space) + len(a.Name().Local) + len(a.Value())
+				}
+			}
+			n, b := treeSize(it)
+			nodes += n
+			bytes += b
+		default:
+			bytes += len(it.Value())
+		}
+	}
+	return nodes, bytes
+}
@@ -0,0 +1,62 @@
+package datastore
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/andaru/opr8/dom"
+	"github.com/andaru/opr8/metrics"
+	"github.com/openconfig/goyang/pkg/yang"
+	"github.com/pkg/errors"
+)
+
+func TestDatastoreStats(t *testing.T) {
+	v := NewValidators()
+	v.Register("/module1/system/host-name", func(n dom.Node, e *yang.Entry) error {
+		if n.ChildValue() == "bad" {
+			return errors.New("bad host-name")
+		}
+		return nil
+	})
+	r := metrics.NewExpvar()
+	ds := New(Running, newTestCollection(t), WithValidation(v), WithMetrics(r))
+
+	stats := ds.Stats()
+	if stats.Name != Running || stats.Nodes != 0 || stats.Commits != 0 || !stats.LastCommit.IsZero() {
+		t.Errorf("initial Stats() = %+v, want empty", stats)
+	}
+
+	if _, err := ds.Update(1, "", setSystem("good")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ds.Update(1, "", setSystem("bad")); err == nil {
+		t.Fatal("Update() error = nil, wantErr true")
+	}
+	stats = ds.Stats()
+	if stats.Nodes != 3 || stats.Commits != 1 || stats.ValidationFailures != 1 || stats.LastCommit.IsZero() {
+		t.Errorf("Stats() = %+v, want 3 nodes, 1 commit and 1 validation failure", stats)
+	}
+	if stats.TreeBytes < 3*nodeOverhead {
+		t.Errorf("Stats().TreeBytes = %d, want at least %d", stats.TreeBytes, 3*nodeOverhead)
+	}
+
+	var got Stats
+	if err := json.Unmarshal([]byte(ds.Var().String()), &got); err != nil {
+		t.Fatalf("Var() is not a JSON Stats object: %v", err)
+	}
+	if got.Nodes != stats.Nodes || got.Commits != stats.Commits {
+		t.Errorf("Var() = %+v, want %+v", got, stats)
+	}
+	if samples := stats.Samples(); samples["datastore_commits_total"] != 1 || samples["datastore_last_commit_seconds"] == 0 {
+		t.Errorf("Samples() = %v", samples)
+	}
+	for name, want := range map[string]float64{
+		"datastore_commits_total":             1,
+		"datastore_commit_failures_total":     1,
+		"datastore_validation_failures_total": 1,
+	} {
+		if got, _ := r.Value(name + `{datastore="running"}`); got != want {
+			t.Errorf("%s = %v, want %v", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,315 @@
+package datastore
+
+import (
+	"encoding/base64"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andaru/opr8/dom"
+	"github.com/andaru/opr8/modules"
+	"github.com/openconfig/goyang/pkg/yang"
+	"github.com/pkg/errors"
+)
+
+// checkValue validates the lexical value of leaf e against the YANG
+// type t, returning the type which accepted the value. For unions,
+// this is the first member type (searched depth first, in schema
+// order) accepting the value.
+func checkValue(e *yang.Entry, t *yang.YangType, value string) (*yang.YangType, error) {
+	if t == nil {
+		return nil, errors.Errorf("schema node %s has no type", e.Path())
+	}
+	switch t.Kind {
+	case yang.Yunion:
+		return checkUnion(e, t, value)
+	case yang.Yleafref:
+		target, err := leafrefTarget(e, t)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := checkValue(target, target.Type, value); err != nil {
+			return nil, err
+		}
+		return t, nil
+	case yang.Yint8, yang.Yint16, yang.Yint32, yang.Yint64:
+		return t, checkInt(t, value)
+	case yang.Yuint8, yang.Yuint16, yang.Yuint32, yang.Yuint64:
+		return t, checkUint(t, value)
+	case yang.Ybool:
+		if value != "true" && value != "false" {
+			return nil, errors.Errorf("%q is not a valid boolean", value)
+		}
+		return t, nil
+	case yang.Ystring:
+		return t, checkString(t, value)
+	case yang.Yempty:
+		if value != "" {
+			return nil, errors.Errorf("%q is not valid for an empty leaf", value)
+		}
+		return t, nil
+	case yang.Ybinary:
+		b, err := decodeBinary(value)
+		if err != nil {
+			return nil, err
+		}
+		if len(t.Length) > 0 {
+			n := yang.FromInt(int64(len(b)))
+			if !t.Length.Contains(yang.YangRange{{Min: n, Max: n}}) {
+				return nil, errors.Errorf("binary length %d is outside of %s", len(b), t.Length)
+			}
+		}
+		return t, nil
+	case yang.Ydecimal64:
+		n, err := parseDecimal64(value, t.FractionDigits)
+		if err != nil {
+			return nil, err
+		}
+		return t, checkRange(t.Range, n, value)
+	case yang.YinstanceIdentifier:
+		// prefixes are resolved by the decoder; check syntax only
+		if _, err := ParseInstanceID(value, func(prefix string) (string, error) { return prefix, nil }); err != nil {
+			return nil, err
+		}
+		return t, nil
+	case yang.Yenum:
+		if t.Enum == nil || !t.Enum.IsDefined(value) {
+			return nil, errors.Errorf("%q is not a member of enumeration %s", value, t.Name)
+		}
+		return t, nil
+	case yang.Ybits:
+		for _, bit := range strings.Fields(value) {
+			if t.Bit == nil || !t.Bit.IsDefined(bit) {
+				return nil, errors.Errorf("%q is not a bit of %s", bit, t.Name)
+			}
+		}
+		return t, nil
+	}
+	// remaining types are accepted as is
+	return t, nil
+}
+
+// canonicalValue returns the canonical lexical form of value, which
+// must have been accepted by the (resolved, non-union) type t.
+func canonicalValue(t *yang.YangType, value string) string {
+	switch t.Kind {
+	case yang.Ybits:
+		bits := strings.Fields(value)
+		sort.Slice(bits, func(i, j int) bool { return t.Bit.Value(bits[i]) < t.Bit.Value(bits[j]) })
+		// remove duplicate bit names
+		out := bits[:0]
+		for i, bit := range bits {
+			if i == 0 || bit != bits[i-1] {
+				out = append(out, bit)
+			}
+		}
+		return strings.Join(out, " ")
+	case yang.Ybinary:
+		if b, err := decodeBinary(value); err == nil {
+			return base64.StdEncoding.EncodeToString(b)
+		}
+	case yang.Ydecimal64:
+		if n, err := parseDecimal64(value, t.FractionDigits); err == nil {
+			return formatDecimal64(n)
+		}
+	case yang.Yint8, yang.Yint16, yang.Yint32, yang.Yint64:
+		// without a leading + or zeros
+		if i, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return strconv.FormatInt(i, 10)
+		}
+	case yang.Yuint8, yang.Yuint16, yang.Yuint32, yang.Yuint64:
+		if i, err := strconv.ParseUint(value, 10, 64); err == nil {
+			return strconv.FormatUint(i, 10)
+		}
+	}
+	return value
+}
+
+// parseDecimal64 parses the decimal64 value with fd fraction digits.
+// The returned number's Value is the absolute value scaled by 10^fd,
+// so comparisons are performed on integers.
+func parseDecimal64(value string, fd int) (yang.Number, error) {
+	var n yang.Number
+	if fd < 1 || fd > int(yang.MaxFractionDigits) {
+		return n, errors.Errorf("invalid decimal64 fraction-digits %d", fd)
+	}
+	digits := value
+	n.Kind = yang.Positive
+	if strings.HasPrefix(digits, "-") {
+		n.Kind = yang.Negative
+		digits = digits[1:]
+	} else if strings.HasPrefix(digits, "+") {
+		digits = digits[1:]
+	}
+	whole, frac := digits, ""
+	if i := strings.IndexByte(digits, '.'); i >= 0 {
+		whole, frac = digits[:i], digits[i+1:]
+		if frac == "" {
+			return n, errors.Errorf("%q is not a valid decimal64", value)
+		}
+	}
+	if whole == "" || !isDigits(whole) || !isDigits(frac) {
+		return n, errors.Errorf("%q is not a valid decimal64", value)
+	}
+	if len(frac) > fd {
+		return n, errors.Errorf("%q has more than %d fraction digits", value, fd)
+	}
+	scaled, err := strconv.ParseUint(whole+frac+strings.Repeat("0", fd-len(frac)), 10, 64)
+	if err != nil || scaled > 1<<63 || (scaled == 1<<63 && n.Kind != yang.Negative) {
+		return n, errors.Errorf("%q is out of range for decimal64 with %d fraction digits", value, fd)
+	}
+	if scaled == 0 {
+		n.Kind = yang.Positive
+	}
+	n.Value = scaled
+	n.FractionDigits = uint8(fd)
+	return n, nil
+}
+
+// formatDecimal64 returns the canonical form of the decimal64 n: no
+// leading zeros in the integer part, and no trailing zeros after the
+// first fraction digit.
+func formatDecimal64(n yang.Number) string {
+	s := strconv.FormatUint(n.Value, 10)
+	fd := int(n.FractionDigits)
+	if len(s) <= fd {
+		s = strings.Repeat("0", fd-len(s)+1) + s
+	}
+	whole, frac := s[:len(s)-fd], strings.TrimRight(s[len(s)-fd:], "0")
+	if frac == "" {
+		frac = "0"
+	}
+	if n.Kind == yang.Negative {
+		whole = "-" + whole
+	}
+	return whole + "." + frac
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// BinaryValue returns the decoded octets of the binary leaf node n.
+func BinaryValue(n dom.Node) ([]byte, error) {
+	if n == nil {
+		return nil, errors.New("nil node")
+	}
+	return decodeBinary(n.ChildValue())
+}
+
+// decodeBinary decodes the base64 value of a binary leaf, ignoring any
+// whitespace, as might be found in line-wrapped XML values.
+func decodeBinary(value string) ([]byte, error) {
+	b, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(value), ""))
+	if err != nil {
+		return nil, errors.Errorf("invalid base64 binary value: %v", err)
+	}
+	return b, nil
+}
+
+// checkUnion returns the first member type of union t accepting value.
+func checkUnion(e *yang.Entry, t *yang.YangType, value string) (*yang.YangType, error) {
+	for _, member := range t.Type {
+		if resolved, err := checkValue(e, member, value); err == nil {
+			return resolved, nil
+		}
+	}
+	return nil, errors.Errorf("%q does not match any member of union %s", value, t.Name)
+}
+
+// leafrefTarget returns the schema node referred to by leafref type t
+// of leaf e, the type of e or a member of its union type, as resolved
+// by modules.ResolveType.
+func leafrefTarget(e *yang.Entry, t *yang.YangType) (*yang.Entry, error) {
+	r := modules.ResolveType(e)
+	for _, m := range append([]modules.ResolvedType{r}, r.Members...) {
+		if m.Type == t && m.Target != nil {
+			return m.Target, nil
+		}
+	}
+	return nil, errors.Errorf("leafref path %q does not refer to a leaf", t.Path)
+}
+
+func intBits(k yang.TypeKind) int {
+	switch k {
+	case yang.Yint8, yang.Yuint8:
+		return 8
+	case yang.Yint16, yang.Yuint16:
+		return 16
+	case yang.Yint32, yang.Yuint32:
+		return 32
+	}
+	return 64
+}
+
+func checkInt(t *yang.YangType, value string) error {
+	i, err := strconv.ParseInt(value, 10, intBits(t.Kind))
+	if err != nil {
+		return errors.Errorf("%q is not a valid %s", value, t.Kind)
+	}
+	return checkRange(t.Range, yang.FromInt(i), value)
+}
+
+func checkUint(t *yang.YangType, value string) error {
+	i, err := strconv.ParseUint(value, 10, intBits(t.Kind))
+	if err != nil {
+		return errors.Errorf("%q is not a valid %s", value, t.Kind)
+	}
+	return checkRange(t.Range, yang.FromUint(i), value)
+}
+
+func checkRange(r yang.YangRange, n yang.Number, value string) error {
+	if !r.Contains(yang.YangRange{{Min: n, Max: n}}) {
+		return errors.Errorf("%q is out of range %s", value, r)
+	}
+	return nil
+}
+
+func checkString(t *yang.YangType, value string) error {
+	if len(t.Length) > 0 {
+		n := yang.FromInt(int64(len([]rune(value))))
+		if !t.Length.Contains(yang.YangRange{{Min: n, Max: n}}) {
+			return errors.Errorf("%q length is outside of %s", value, t.Length)
+		}
+	}
+	for _, p := range t.Pattern {
+		re := compilePattern(p)
+		if re == nil {
+			// unsupported XSD regular expression syntax
+			continue
+		}
+		if !re.MatchString(value) {
+			return errors.Errorf("%q does not match pattern %s", value, p)
+		}
+	}
+	return nil
+}
+
+var patterns = struct {
+	sync.Mutex
+	m map[string]*regexp.Regexp
+}{m: map[string]*regexp.Regexp{}}
+
+// compilePattern returns the anchored regular expression for the YANG
+// pattern p, or nil if p cannot be compiled.
+func compilePattern(p string) *regexp.Regexp {
+	patterns.Lock()
+	defer patterns.Unlock()
+	if re, ok := patterns.m[p]; ok {
+		return re
+	}
+	re, err := regexp.Compile(fmt.Sprintf("^(?:%s)$", strings.Replace(p, `$`, `\$`, -1)))
+	if err != nil {
+		re = nil
+	}
+	patterns.m[p] = re
+	return re
+}
@@ -0,0 +1,250 @@
+package datastore
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	xml "github.com/andaru/flexml"
+	"github.com/andaru/opr8/dom"
+	"github.com/andaru/opr8/modules"
+	"github.com/openconfig/goyang/pkg/yang"
+	"github.com/pkg/errors"
+)
+
+// Validator is a custom validation function, called for each data
+// node n of the schema node e it is registered for. A *DecodeError
+// returned is reported as is; other errors are reported with the
+// error-tag operation-failed.
+type Validator func(n dom.Node, e *yang.Entry) error
+
+// Validators is a registry of custom validators, keyed by schema node
+// path. It is safe for concurrent use.
+type Validators struct {
+	mu sync.RWMutex
+	m  map[string][]Validator
+}
+
+// NewValidators returns a new, empty validator registry.
+func NewValidators() *Validators { return &Validators{m: map[string][]Validator{}} }
+
+// Register adds the validator fn for data nodes of the schema node at
+// path, the schema node path as returned by yang.Entry.Path, e.g.,
+// "/example/interfaces/interface/mtu". Validators for the same path
+// are called in the order registered.
+func (v *Validators) Register(path string, fn Validator) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.m[path] = append(v.m[path], fn)
+}
+
+func (v *Validators) lookup(path string) []Validator {
+	if v == nil {
+		return nil
+	}
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.m[path]
+}
+
+// ValidationReport is the result of data tree validation.
+type ValidationReport struct {
+	// Errors are the validation errors found, in document order.
+	Errors []*DecodeError
+}
+
+// Valid returns true if the report has no errors of severity error.
+func (r *ValidationReport) Valid() bool {
+	for _, err := range r.Errors {
+		if err.Severity == SeverityError {
+			return false
+		}
+	}
+	return true
+}
+
+// Err returns an error describing the first validation error, or nil
+// if the report is valid.
+func (r *ValidationReport) Err() error {
+	for _, err := range r.Errors {
+		if err.Severity == SeverityError {
+			return errors.Wrapf(err, "validation failed with %d errors, first at %s", len(r.Errors), err.Path)
+		}
+	}
+	return nil
+}
+
+// Validate validates the data tree root, a Document, against the
+// schema of the collection c. Leaf values are checked against their
+// types, leafrefs and instance-identifiers for the data they refer to,
+// list entries for their keys, configuration leaf-lists for duplicate
+// values and data nodes for their must conditions; the validators
+// registered in v, which may be nil, are then called for their schema
+// nodes.
+func Validate(root dom.Node, c *modules.Collection, v *Validators) *ValidationReport {
+	val := &validation{c: c, v: v, report: &ValidationReport{}}
+	for it := root.FirstChild(); it != nil; it = it.NextSibling() {
+		if it.NodeType() != dom.NodeTypeElement {
+			continue
+		}
+		e := rootEntry(c, it.Name())
+		if e == nil {
+			val.unknown(it)
+			continue
+		}
+		val.node(it, e)
+	}
+	return val.report
+}
+
+type validation struct {
+	c      *modules.Collection
+	v      *Validators
+	report *ValidationReport
+}
+
+func (val *validation) add(n dom.Node, e *yang.Entry, de *DecodeError) {
+	// errors returned by validators are theirs, so are copied
+	copied := *de
+	de = &copied
+	if de.Path == "" {
+		de.Path = dataPath(val.c, n)
+	}
+	if de.SchemaPath == "" && e != nil {
+		de.SchemaPath = e.Path()
+	}
+	if de.Element == "" {
+		de.Element = n.Name().Local
+	}
+	val.report.Errors = append(val.report.Errors, de)
+}
+
+func (val *validation) unknown(n dom.Node) {
+	val.add(n, nil, &DecodeError{
+		Tag:     ErrorTagUnknownElement,
+		Message: fmt.Sprintf("unknown element %s", n.Name().Local),
+	})
+}
+
+func (val *validation) node(n dom.Node, e *yang.Entry) {
+	switch {
+	case e.Kind == yang.LeafEntry:
+		if e.Type != nil && e.Type.Kind != yang.Yempty {
+			t, err := checkValue(e, e.Type, n.ChildValue())
+			if err != nil {
+				val.add(n, e, &DecodeError{
+					Tag:     ErrorTagInvalidValue,
+					Message: fmt.Sprintf("invalid value for %s", e.Name),
+					Err:     err,
+				})
+			} else if requiresInstance(t) {
+				if targets, err := deref(val.c, n); err == nil && len(targets) == 0 {
+					val.add(n, e, &DecodeError{
+						Tag:     ErrorTagDataMissing,
+						AppTag:  "instance-required",
+						Message: fmt.Sprintf("no instance %q referred to by %s", n.ChildValue(), e.Name),
+					})
+				}
+			}
+		}
+	case e.Kind == yang.DirectoryEntry:
+		if e.IsList() {
+			for _, key := range strings.Fields(e.Key) {
+				if n.ChildByName(xml.Name{Space: n.Name().Space, Local: key}) == nil {
+					val.add(n, e, &DecodeError{
+						Tag:     ErrorTagMissingElement,
+						Message: fmt.Sprintf("list %s entry missing key %s", e.Name, key),
+					})
+				}
+			}
+		}
+		// the values of each configuration leaf-list's entries
+		values := map[xml.Name]map[string]bool{}
+		for it := n.FirstChild(); it != nil; it = it.NextSibling() {
+			if it.NodeType() != dom.NodeTypeElement {
+				continue
+			}
+			if ce := val.c.DataChild(e, it.Name().Local); ce != nil {
+				if ce.IsLeafList() && !ce.ReadOnly() {
+					seen := values[it.Name()]
+					if seen == nil {
+						seen = map[string]bool{}
+						values[it.Name()] = seen
+					}
+					if value := it.ChildValue(); seen[value] {
+						val.add(it, ce, duplicateEntry(ce, value))
+					} else {
+						seen[value] = true
+					}
+				}
+				val.node(it, ce)
+			} else {
+				val.unknown(it)
+			}
+		}
+	}
+	val.must(n, e)
+
+	for _, fn := range val.v.lookup(e.Path()) {
+		if err := fn(n, e); err != nil {
+			de, ok := err.(*DecodeError)
+			if !ok {
+				de = &DecodeError{
+					Tag:     ErrorTagOperationFailed,
+					Message: fmt.Sprintf("validation of %s failed", e.Name),
+					Err:     err,
+				}
+			}
+			val.add(n, e, de)
+		}
+	}
+}
+
+// must evaluates the must statements of the schema node e for its data
+// node n (RFC 7950 section 7.5.3).
+func (val *validation) must(n dom.Node, e *yang.Entry) {
+	if e.Node == nil || e.Node.Statement() == nil {
+		return
+	}
+	for _, s := range e.Node.Statement().SubStatements() {
+		if s.Keyword != "must" {
+			continue
+		}
+		ok, err := EvalWhen(val.c, s.Argument, n, e.Node)
+		if ok {
+			continue
+		}
+		de := &DecodeError{
+			Tag:     ErrorTagOperationFailed,
+			AppTag:  "must-violation",
+			Message: fmt.Sprintf("must condition %q of %s is false", s.Argument, e.Name),
+			Err:     err,
+		}
+		for _, sub := range s.SubStatements() {
+			switch sub.Keyword {
+			case "error-app-tag":
+				de.AppTag = sub.Argument
+			case "error-message":
+				de.Message = sub.Argument
+			}
+		}
+		val.add(n, e, de)
+	}
+}
+
+// requiresInstance returns true if values of the type t, a leafref or
+// instance-identifier, must refer to existing data.
+func requiresInstance(t *yang.YangType) bool {
+	return (t.Kind == yang.Yleafref || t.Kind == yang.YinstanceIdentifier) && !t.OptionalInstance
+}
+
+// dataPath returns the RFC 7951 style data instance path of the node
+// n, with the keys of list entries and the values of leaf-list
+// entries, e.g., "/module2:refs/server[name='a']/port".
+func dataPath(c *modules.Collection, n dom.Node) string {
+	id := instanceIDOf(c, n)
+	if len(id) == 0 {
+		return "/"
+	}
+	return id.Format(func(ns string) string { return moduleName(c, ns) })
+}
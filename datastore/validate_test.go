@@ -0,0 +1,164 @@
+package datastore
+
+import (
+	"strconv"
+	"testing"
+
+	xml "github.com/andaru/flexml"
+	"github.com/andaru/opr8/dom"
+	"github.com/openconfig/goyang/pkg/yang"
+	"github.com/pkg/errors"
+)
+
+func TestValidate(t *testing.T) {
+	c := newTestCollection(t)
+	v := NewValidators()
+	v.Register("/module2/refs/server/port", func(n dom.Node, e *yang.Entry) error {
+		if port, _ := strconv.Atoi(n.ChildValue()); port < 1024 {
+			return errors.Errorf("port %d is privileged", port)
+		}
+		return nil
+	})
+	v.Register("/module2/refs/server/port", func(n dom.Node, e *yang.Entry) error {
+		if n.ChildValue() == "8080" {
+			return &DecodeError{Tag: ErrorTagInvalidValue, Severity: SeverityWarning, Message: "port 8080 is discouraged"}
+		}
+		return nil
+	})
+
+	type wantErr struct {
+		tag      ErrorTag
+		severity ErrorSeverity
+		path     string
+	}
+	for _, tt := range []struct {
+		name      string
+		input     string
+		edit      func(doc dom.Document)
+		want      []wantErr
+		wantValid bool
+	}{
+		{
+			name:      "valid",
+			input:     `<refs xmlns="urn:mod2"><server><name>a</name><port>1024</port></server></refs>`,
+			wantValid: true,
+		},
+		{
+			name:  "custom validators",
+			input: `<refs xmlns="urn:mod2"><server><name>a</name><port>22</port></server><server><name>b</name><port>8080</port></server></refs>`,
+			want: []wantErr{
+				{ErrorTagOperationFailed, SeverityError, "/module2:refs/server[name='a']/port"},
+				{ErrorTagInvalidValue, SeverityWarning, "/module2:refs/server[name='b']/port"},
+			},
+		},
+		{
+			name:      "warnings only",
+			input:     `<refs xmlns="urn:mod2"><server><name>b</name><port>8080</port></server></refs>`,
+			want:      []wantErr{{ErrorTagInvalidValue, SeverityWarning, "/module2:refs/server[name='b']/port"}},
+			wantValid: true,
+		},
+		{
+			name:  "missing list key",
+			input: `<refs xmlns="urn:mod2"><server><port>2000</port></server></refs>`,
+			want:  []wantErr{{ErrorTagMissingElement, SeverityError, "/module2:refs/server"}},
+		},
+		{
+			name:  "invalid value",
+			input: `<system xmlns="urn:mod1"><host-name>h</host-name></system><types xmlns="urn:mod2"><port>1</port></types>`,
+			edit: func(doc dom.Document) {
+				_ = doc.LastChild().FirstChild().FirstChild().SetValue("70000")
+			},
+			want: []wantErr{{ErrorTagInvalidValue, SeverityError, "/module2:types/port"}},
+		},
+		{
+			name:  "duplicate leaf-list entry",
+			input: `<refs xmlns="urn:mod2"><tag>x</tag><tag>y</tag><alarm>a</alarm><alarm>a</alarm></refs>`,
+			edit: func(doc dom.Document) {
+				_ = doc.FirstChild().AppendChild(dom.CloneNode(doc.FirstChild().FirstChild(), true))
+			},
+			want: []wantErr{{ErrorTagOperationFailed, SeverityError, "/module2:refs/tag[.='x']"}},
+		},
+		{
+			name:  "must condition",
+			input: `<refs xmlns="urn:mod2"><server><name>a</name><port>9</port></server></refs>`,
+			want: []wantErr{
+				{ErrorTagOperationFailed, SeverityError, "/module2:refs/server[name='a']/port"},
+				{ErrorTagOperationFailed, SeverityError, "/module2:refs/server[name='a']"},
+			},
+		},
+		{
+			name: "missing leafref instances",
+			input: `<types xmlns="urn:mod2"><name>eth</name><name-ref>eth</name-ref></types>` +
+				`<refs xmlns="urn:mod2"><server><name>a</name><port>1024</port></server><target>/mod2:refs/mod2:server[mod2:name='a']</target></refs>`,
+			edit: func(doc dom.Document) {
+				_ = doc.FirstChild().FirstChild().FirstChild().SetValue("lo")
+				_ = doc.LastChild().LastChild().FirstChild().SetValue("/mod2:refs/mod2:server[mod2:name='b']")
+			},
+			want: []wantErr{
+				{ErrorTagDataMissing, SeverityError, "/module2:types/name-ref"},
+				{ErrorTagDataMissing, SeverityError, "/module2:refs/target"},
+			},
+		},
+		{
+			name:  "unknown elements",
+			input: `<system xmlns="urn:mod1"></system>`,
+			edit: func(doc dom.Document) {
+				_ = doc.FirstChild().AppendChild(dom.CreateElement(xml.StartElement{Name: xml.Name{Space: "urn:mod1", Local: "bogus"}}))
+				_ = doc.AppendChild(dom.CreateElement(xml.StartElement{Name: xml.Name{Space: "urn:x", Local: "other"}}))
+			},
+			want: []wantErr{
+				{ErrorTagUnknownElement, SeverityError, "/module1:system/bogus"},
+				{ErrorTagUnknownElement, SeverityError, "/urn:x:other"},
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, doc := decodeXML(t, c, tt.input)
+			if tt.edit != nil {
+				tt.edit(doc)
+			}
+			report := Validate(doc, c, v)
+			if report.Valid() != tt.wantValid || (report.Err() == nil) != tt.wantValid {
+				t.Errorf("Valid() = %v, Err() = %v, want valid %v", report.Valid(), report.Err(), tt.wantValid)
+			}
+			if len(report.Errors) != len(tt.want) {
+				t.Fatalf("got %d errors %v, want %d", len(report.Errors), report.Errors, len(tt.want))
+			}
+			for i, want := range tt.want {
+				got := report.Errors[i]
+				if got.Tag != want.tag || got.Severity != want.severity || got.Path != want.path {
+					t.Errorf("error %d = (%s, %s, %s), want (%s, %s, %s)", i,
+						got.Tag, got.Severity, got.Path, want.tag, want.severity, want.path)
+				}
+			}
+		})
+	}
+
+	t.Run("validator errors are copied", func(t *testing.T) {
+		shared := &DecodeError{Tag: ErrorTagInvalidValue, Message: "invalid port"}
+		v := NewValidators()
+		v.Register("/module2/refs/server/port", func(dom.Node, *yang.Entry) error { return shared })
+		_, doc := decodeXML(t, c, `<refs xmlns="urn:mod2"><server><name>a</name><port>1</port></server><server><name>b</name><port>2</port></server></refs>`)
+		report := Validate(doc, c, v)
+		if len(report.Errors) != 2 || report.Errors[1].Path != "/module2:refs/server[name='b']/port" {
+			t.Errorf("Validate() errors = %v, want one for each port", report.Errors)
+		}
+		if shared.Path != "" || shared.Element != "" {
+			t.Errorf("Validate() modified the validator's error: %#v", shared)
+		}
+	})
+
+	t.Run("datastore commit", func(t *testing.T) {
+		ds := New(Running, c, WithValidation(v))
+		_, err := ds.Update(1, "", func(root dom.Document) error {
+			_, doc := decodeXML(t, c, `<refs xmlns="urn:mod2"><server><name>a</name><port>22</port></server></refs>`)
+			return root.AppendChild(dom.CloneNode(doc.FirstChild(), true))
+		})
+		if err == nil {
+			t.Errorf("Update() error = nil, wantErr true")
+		}
+		if ds.Snapshot().Generation != 0 {
+			t.Errorf("invalid Update() was committed")
+		}
+	})
+}
@@ -0,0 +1,191 @@
+package datastore
+
+import (
+	"github.com/andaru/opr8/dom"
+	"github.com/andaru/opr8/modules"
+	"github.com/openconfig/goyang/pkg/yang"
+)
+
+// WhenEvaluator evaluates the YANG when expression expr with the
+// context node ctx, returning its result converted to a boolean. The
+// scope is the statement defining the expression, used to resolve
+// the module prefixes it contains.
+type WhenEvaluator func(c *modules.Collection, expr string, ctx dom.Node, scope yang.Node) (bool, error)
+
+// Change records a change made to a data tree during a commit in
+// addition to the edit itself, such as the removal of a data node
+// whose when condition became false.
+type Change struct {
+	// Path is the data path of the node, e.g., "/module1:system/mtu".
+	Path string
+	// Schema is the schema node of the node.
+	Schema *yang.Entry
+	// Node is the removed node.
+	Node dom.Node
+	// When is the when expression which evaluated false.
+	When string
+}
+
+// PruneWhen removes the data nodes of the data tree root, a Document,
+// whose when conditions evaluate false, returning a change record for
+// each node removed. As removals may affect the conditions of other
+// nodes, the tree is pruned repeatedly until no further nodes are
+// removed. The nodes' descendants are removed along with them, and
+// are not reported.
+//
+// The conditions considered are the when statements of a data node,
+// of the choices and cases containing it, and of the augment or uses
+// adding it. Conditions are evaluated with eval, or EvalWhen if eval is nil.
+func PruneWhen(root dom.Node, c *modules.Collection, eval WhenEvaluator) ([]Change, error) {
+	if eval == nil {
+		eval = EvalWhen
+	}
+	p := &pruner{c: c, eval: eval}
+	for {
+		n := len(p.changes)
+		if err := p.prune(root, nil); err != nil {
+			return nil, err
+		}
+		if len(p.changes) == n {
+			return p.changes, nil
+		}
+	}
+}
+
+type pruner struct {
+	c       *modules.Collection
+	eval    WhenEvaluator
+	changes []Change
+}
+
+// whenCondition is a when expression applying to a data node.
+type whenCondition struct {
+	expr  string
+	scope yang.Node
+	// parent is true if the context node is the data node's parent
+	parent bool
+}
+
+// prune prunes the children of n, of schema node e, which is nil if
+// n is the document.
+func (p *pruner) prune(n dom.Node, e *yang.Entry) error {
+	for it := n.FirstChild(); it != nil; {
+		next := it.NextSibling()
+		if it.NodeType() != dom.NodeTypeElement {
+			it = next
+			continue
+		}
+
+		var ce *yang.Entry
+		if e == nil {
+			ce = rootEntry(p.c, it.Name())
+		} else {
+			ce = p.c.DataChild(e, it.Name().Local)
+		}
+		if ce == nil {
+			it = next
+			continue
+		}
+
+		keep := true
+		for _, cond := range whenConditions(ce) {
+			ctx := it
+			if cond.parent {
+				ctx = n
+			}
+			ok, err := p.eval(p.c, cond.expr, ctx, cond.scope)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				p.changes = append(p.changes, Change{
+					Path:   dataPath(p.c, it),
+					Schema: ce,
+					Node:   it,
+					When:   cond.expr,
+				})
+				if err := n.RemoveChild(it); err != nil {
+					return err
+				}
+				keep = false
+				break
+			}
+		}
+		if keep && ce.Kind == yang.DirectoryEntry {
+			if err := p.prune(it, ce); err != nil {
+				return err
+			}
+		}
+		it = next
+	}
+	return nil
+}
+
+// whenConditions returns the when conditions applying to data nodes
+// of the schema node e.
+func whenConditions(e *yang.Entry) []whenCondition {
+	var conds []whenCondition
+	if expr, ok := e.GetWhenXPath(); ok {
+		conds = append(conds, whenCondition{expr: expr, scope: e.Node})
+	}
+	for it := e; it != nil && it.Node != nil; it = it.Parent {
+		if aug, ok := it.Node.ParentNode().(*yang.Augment); ok && aug.When != nil {
+			conds = append(conds, whenCondition{expr: aug.When.Name, scope: aug, parent: true})
+		}
+		conds = append(conds, usesConditions(it)...)
+		if it.Parent == nil || !it.Parent.IsChoice() && !it.Parent.IsCase() {
+			break
+		}
+		if expr, ok := it.Parent.GetWhenXPath(); ok {
+			conds = append(conds, whenCondition{expr: expr, scope: it.Parent.Node, parent: true})
+		}
+	}
+	return conds
+}
+
+// usesConditions returns the when conditions of the uses statements
+// adding the schema node e, defined in a grouping, to its parent,
+// directly or through the groupings using that grouping. The uses
+// statements are found under the parent's statement or those of the
+// augments of the parent, whose when conditions then also apply.
+func usesConditions(e *yang.Entry) []whenCondition {
+	g, ok := e.Node.ParentNode().(*yang.Grouping)
+	if !ok || e.Parent == nil || e.Parent.Node == nil {
+		return nil
+	}
+	var conds []whenCondition
+	var find func(n yang.Node) bool
+	find = func(n yang.Node) bool {
+		if n.Statement() == nil {
+			return false
+		}
+		for _, s := range n.Statement().SubStatements() {
+			if s.Keyword != "uses" {
+				continue
+			}
+			used := yang.FindGrouping(n, s.Argument, map[string]bool{})
+			if used == nil || used != g && !find(used) {
+				continue
+			}
+			for _, sub := range s.SubStatements() {
+				if sub.Keyword == "when" {
+					conds = append(conds, whenCondition{expr: sub.Argument, scope: n, parent: true})
+				}
+			}
+			return true
+		}
+		return false
+	}
+	if find(e.Parent.Node) {
+		return conds
+	}
+	for _, a := range e.Parent.Augmented {
+		if aug, ok := a.Node.(*yang.Augment); ok && find(aug) {
+			if aug.When != nil {
+				conds = append(conds, whenCondition{expr: aug.When.Name, scope: aug, parent: true})
+			}
+			return conds
+		}
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package datastore
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/andaru/flexml"
+	"github.com/andaru/opr8/dom"
+)
+
+func TestPruneWhen(t *testing.T) {
+	c := newTestCollection(t)
+	for _, tt := range []struct {
+		name      string
+		input     string
+		wantPaths []string
+		wantXML   string
+	}{
+		{
+			name:    "conditions true",
+			input:   `<link xmlns="urn:mod2"><type>mod2:fast-ethernet</type><vlan><id>1</id></vlan><mtu>9000</mtu><autoneg>true</autoneg></link>`,
+			wantXML: `<link xmlns="urn:mod2"><type>mod2:fast-ethernet</type><vlan><id>1</id></vlan><mtu>9000</mtu><autoneg>true</autoneg></link>`,
+		},
+		{
+			name:      "derived-from excludes self",
+			input:     `<link xmlns="urn:mod2"><type>mod2:ethernet</type><mtu>1400</mtu><autoneg>true</autoneg></link>`,
+			wantPaths: []string{"/module2:link/autoneg"},
+			wantXML:   `<link xmlns="urn:mod2"><type>mod2:ethernet</type><mtu>1400</mtu></link>`,
+		},
+		{
+			name:  "dependent removals",
+			input: `<link xmlns="urn:mod2"><type>mod2:tunnel</type><vlan><id>1</id></vlan><mtu>9000</mtu><key>7</key><endpoint>e</endpoint></link>`,
+			// vlan depends upon mtu, which is removed after it is visited
+			wantPaths: []string{"/module2:link/mtu", "/module2:link/vlan"},
+			wantXML:   `<link xmlns="urn:mod2"><type>mod2:tunnel</type><key>7</key><endpoint>e</endpoint></link>`,
+		},
+		{
+			name:      "case and augment",
+			input:     `<link xmlns="urn:mod2"><type>mod2:ethernet</type><key>7</key><endpoint>e</endpoint></link>`,
+			wantPaths: []string{"/module2:link/key", "/module2:link/endpoint"},
+			wantXML:   `<link xmlns="urn:mod2"><type>mod2:ethernet</type></link>`,
+		},
+		{
+			name:      "uses",
+			input:     `<link xmlns="urn:mod2"><type>mod2:ethernet</type><ttl>8</ttl></link>`,
+			wantPaths: []string{"/module2:link/ttl"},
+			wantXML:   `<link xmlns="urn:mod2"><type>mod2:ethernet</type></link>`,
+		},
+		{
+			name:    "uses condition true",
+			input:   `<link xmlns="urn:mod2"><type>mod2:tunnel</type><ttl>8</ttl><endpoint>e</endpoint><peer>p</peer></link>`,
+			wantXML: `<link xmlns="urn:mod2"><type>mod2:tunnel</type><ttl>8</ttl><endpoint>e</endpoint><peer>p</peer></link>`,
+		},
+		{
+			name:      "uses in augment",
+			input:     `<link xmlns="urn:mod2"><type>mod2:tunnel</type><peer>p</peer></link>`,
+			wantPaths: []string{"/module2:link/peer"},
+			wantXML:   `<link xmlns="urn:mod2"><type>mod2:tunnel</type></link>`,
+		},
+		{
+			name:    "augment with absent leaf",
+			input:   `<link xmlns="urn:mod2"><endpoint>e</endpoint></link>`,
+			wantXML: `<link xmlns="urn:mod2"><endpoint>e</endpoint></link>`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, doc := decodeXML(t, c, tt.input)
+			changes, err := PruneWhen(doc, c, nil)
+			if err != nil {
+				t.Fatalf("PruneWhen() error = %v", err)
+			}
+			var paths []string
+			for _, change := range changes {
+				paths = append(paths, change.Path)
+			}
+			if !reflect.DeepEqual(paths, tt.wantPaths) {
+				t.Errorf("PruneWhen() removed %q, want %q", paths, tt.wantPaths)
+			}
+			b, err := flexml.Marshal(dom.NewMarshaler(doc))
+			if err != nil {
+				t.Fatalf("xml.Marshal(doc) error: %v, wantErr false", err)
+			}
+			if got := string(b); got != tt.wantXML {
+				t.Errorf("PruneWhen() tree = %s, want %s", got, tt.wantXML)
+			}
+		})
+	}
+
+	t.Run("datastore commit", func(t *testing.T) {
+		ds := New(Running, c)
+		snap, err := ds.Update(1, "", func(root dom.Document) error {
+			_, doc := decodeXML(t, c, `<link xmlns="urn:mod2"><type>mod2:tunnel</type><mtu>1500</mtu></link>`)
+			return root.AppendChild(dom.CloneNode(doc.FirstChild(), true))
+		})
+		if err != nil {
+			t.Fatalf("Update() error = %v", err)
+		}
+		if len(snap.Changes) != 1 || snap.Changes[0].When != "derived-from-or-self(../type, 'mod2:ethernet')" {
+			t.Errorf("Update() changes = %+v, want mtu removal", snap.Changes)
+		}
+		if snap.Root.FirstChild().ChildByName(snap.Changes[0].Node.Name()) != nil {
+			t.Errorf("Update() did not remove %s", snap.Changes[0].Path)
+		}
+	})
+}
+
+func TestEvalWhen(t *testing.T) {
+	c := newTestCollection(t)
+	_, doc := decodeXML(t, c, `<link xmlns="urn:mod2"><type>mod2:ethernet</type><mtu>1500</mtu><vlan><id>10</id></vlan></link>`)
+	link := doc.FirstChild()
+	scope := c.Raw().Modules["module2"]
+	for _, tt := range []struct {
+		expr    string
+		want    bool
+		wantErr bool
+	}{
+		{expr: "vlan[id = 10]/id = /mod2:link/vlan/id", want: true},
+		{expr: "starts-with(type, 'mod2:') and contains(string(type), 'eth')", want: true},
+		{expr: "child::mod2:* [self::mtu] and vlan/ancestor::link and vlan/id/ancestor-or-self::*[1] = 10", want: true},
+		{expr: "(type | vlan)[2]/id = 10 and local-name(*) = 'type' and namespace-uri() = 'urn:mod2' and name() = 'mod2:link'", want: true},
+		{expr: "re-match(mtu, '1[0-9]+') and not(re-match(type, 'eth.*'))", want: true},
+		{expr: "derived-from-or-self(type, 'ethernet') and not(derived-from(type, 'mod2:ethernet'))", want: true},
+		{expr: "derived-from(type, 'mod2:link-type') and not(derived-from(mtu, 'mod2:link-type'))", want: true},
+		{expr: "other:mtu", wantErr: true},
+	} {
+		t.Run(tt.expr, func(t *testing.T) {
+			got, err := EvalWhen(c, tt.expr, link, scope)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("EvalWhen() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("EvalWhen() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvalWhenYANGFunctions(t *testing.T) {
+	c := newTestCollection(t)
+	scope := c.Raw().Modules["module2"]
+	_, types := decodeXML(t, c, `<types xmlns="urn:mod2"><name>eth</name><speed>100M</speed><flags>up loopback</flags><name-ref>eth</name-ref><port>ssh</port></types>`)
+	_, refs := decodeXML(t, c, `<refs xmlns="urn:mod2"><server><name>a</name><port>80</port></server><server><name>b</name><port>443</port></server>`+
+		`<target xmlns:m="urn:mod2">/m:refs/m:server[m:name='b']</target><optional-target>/mod2:refs/mod2:server[mod2:name='c']</optional-target></refs>`)
+	for _, tt := range []struct {
+		ctx  dom.Node
+		expr string
+		want bool
+	}{
+		{ctx: types.FirstChild(), expr: "enum-value(speed) = 2 and enum-value(name) != enum-value(name)", want: true},
+		{ctx: types.FirstChild(), expr: "bit-is-set(flags, 'loopback') and not(bit-is-set(flags, 'running'))", want: true},
+		{ctx: types.FirstChild(), expr: "bit-is-set(name, 'eth') or bit-is-set(absent, 'up')", want: false},
+		{ctx: types.FirstChild(), expr: "deref(name-ref) = 'eth' and local-name(deref(name-ref)) = 'name'", want: true},
+		{ctx: types.FirstChild(), expr: "deref(name) or deref(port)", want: false},
+		{ctx: refs.FirstChild(), expr: "deref(target)/port = 443 and count(deref(target)) = 1", want: true},
+		{ctx: refs.FirstChild(), expr: "deref(optional-target)", want: false},
+		{ctx: refs.FirstChild(), expr: "server[port > current()/server[1]/port]/name = 'b'", want: true},
+	} {
+		t.Run(tt.expr, func(t *testing.T) {
+			got, err := EvalWhen(c, tt.expr, tt.ctx, scope)
+			if err != nil {
+				t.Fatalf("EvalWhen() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("EvalWhen() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
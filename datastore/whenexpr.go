@@ -0,0 +1,280 @@
+package datastore
+
+import (
+	"math"
+	"strings"
+
+	xml "github.com/andaru/flexml"
+	"github.com/andaru/opr8/dom"
+	"github.com/andaru/opr8/modules"
+	"github.com/andaru/opr8/xpath"
+	"github.com/openconfig/goyang/pkg/yang"
+	"github.com/pkg/errors"
+)
+
+// EvalWhen is the default WhenEvaluator. It evaluates the XPath 1.0
+// expression expr with the xpath package, which YANG uses for when and
+// must expressions and leafref paths (RFC 7950 section 6.4), along with
+// the YANG functions deref, derived-from, derived-from-or-self,
+// enum-value, bit-is-set and re-match.
+//
+// Prefixed names are matched against the namespace of the module
+// whose prefix they use, relative to scope; unprefixed names match
+// elements by local name alone. Identities named by the arguments of
+// derived-from and derived-from-or-self are likewise resolved relative
+// to scope, and those that are leaf values relative to their leaf, and
+// compared by module and name.
+func EvalWhen(c *modules.Collection, expr string, ctx dom.Node, scope yang.Node) (bool, error) {
+	x, err := xpath.Compile(expr, yangFunctions(c))
+	if err != nil {
+		return false, err
+	}
+	v, err := x.Eval(ctx, yangEnv(c, scope))
+	if err != nil {
+		return false, err
+	}
+	return xpath.Boolean(v), nil
+}
+
+// yangEnv returns the environment of an expression defined by the
+// statement scope: prefixes are those of the modules it imports, and
+// names are qualified by the prefix of the module of their namespace.
+func yangEnv(c *modules.Collection, scope yang.Node) *xpath.Env {
+	return &xpath.Env{
+		Namespace: func(prefix string) (string, error) {
+			var mod *yang.Module
+			if scope != nil {
+				mod = yang.FindModuleByPrefix(scope, prefix)
+			}
+			if mod == nil {
+				return "", errors.Errorf("unknown prefix %q", prefix)
+			}
+			if mod.Kind() == "submodule" && mod.BelongsTo != nil && c != nil {
+				if parent, ok := c.Raw().Modules[mod.BelongsTo.Name]; ok {
+					mod = parent
+				}
+			}
+			if mod.Namespace == nil {
+				return "", errors.Errorf("module %s has no namespace", mod.Name)
+			}
+			return mod.Namespace.Name, nil
+		},
+		Prefix: func(space string) string {
+			if c != nil {
+				if mod, err := c.ModuleByNamespace(space); err == nil && mod.Prefix != nil {
+					return mod.Prefix.Name
+				}
+			}
+			return ""
+		},
+	}
+}
+
+// yangFunctions returns the functions YANG adds to XPath (RFC 7950
+// section 10), but for current, which the xpath package provides.
+func yangFunctions(c *modules.Collection) xpath.Functions {
+	derivedFrom := func(orSelf bool) xpath.Function {
+		return xpath.Function{MinArgs: 2, MaxArgs: 2, Call: func(x *xpath.Context, args []interface{}) (interface{}, error) {
+			nodes, err := xpath.NodeSet("derived-from", args[0])
+			if err != nil {
+				return nil, err
+			}
+			base := identityName(c, xpath.String(args[1]), x.Env.Namespace, "")
+			if base == "" {
+				return false, nil
+			} else if _, ok := c.Identity(base); !ok {
+				return false, nil
+			}
+			for _, n := range nodes {
+				value := xpath.NodeString(n)
+				if t := valueType(schemaOf(c, n), value); t == nil || t.Kind != yang.Yidentityref {
+					continue
+				}
+				id := identityName(c, value, namespaceLookup(n, c), n.Name().Space)
+				if id == "" {
+					continue
+				}
+				if orSelf && id == base || c.DerivedFrom(id, base) {
+					return true, nil
+				}
+			}
+			return false, nil
+		}}
+	}
+	return xpath.Functions{
+		"re-match": {MinArgs: 2, MaxArgs: 2, Call: func(x *xpath.Context, args []interface{}) (interface{}, error) {
+			re := compilePattern(xpath.String(args[1]))
+			if re == nil {
+				return nil, errors.Errorf("invalid regular expression %q", xpath.String(args[1]))
+			}
+			return re.MatchString(xpath.String(args[0])), nil
+		}},
+		"deref": {MinArgs: 1, MaxArgs: 1, Call: func(x *xpath.Context, args []interface{}) (interface{}, error) {
+			nodes, err := xpath.NodeSet("deref", args[0])
+			if err != nil || len(nodes) == 0 {
+				return []dom.Node(nil), err
+			}
+			return deref(c, nodes[0])
+		}},
+		"derived-from":         derivedFrom(false),
+		"derived-from-or-self": derivedFrom(true),
+		"enum-value": {MinArgs: 1, MaxArgs: 1, Call: func(x *xpath.Context, args []interface{}) (interface{}, error) {
+			nodes, err := xpath.NodeSet("enum-value", args[0])
+			if err != nil {
+				return nil, err
+			}
+			if len(nodes) > 0 {
+				value := xpath.NodeString(nodes[0])
+				if t := valueType(schemaOf(c, nodes[0]), value); t != nil && t.Kind == yang.Yenum && t.Enum.IsDefined(value) {
+					return float64(t.Enum.Value(value)), nil
+				}
+			}
+			return math.NaN(), nil
+		}},
+		"bit-is-set": {MinArgs: 2, MaxArgs: 2, Call: func(x *xpath.Context, args []interface{}) (interface{}, error) {
+			nodes, err := xpath.NodeSet("bit-is-set", args[0])
+			if err != nil {
+				return nil, err
+			}
+			if len(nodes) > 0 {
+				value := xpath.NodeString(nodes[0])
+				if t := valueType(schemaOf(c, nodes[0]), value); t != nil && t.Kind == yang.Ybits {
+					for _, bit := range strings.Fields(value) {
+						if bit == xpath.String(args[1]) {
+							return true, nil
+						}
+					}
+				}
+			}
+			return false, nil
+		}},
+	}
+}
+
+// deref returns the node referred to by the value of the leafref or
+// instance-identifier leaf n, or an empty node-set if there is none.
+func deref(c *modules.Collection, n dom.Node) ([]dom.Node, error) {
+	e := schemaOf(c, n)
+	if e == nil || e.Type == nil {
+		return nil, nil
+	}
+	value := xpath.NodeString(n)
+	t, err := checkValue(e, e.Type, value)
+	if err != nil {
+		return nil, nil
+	}
+	switch t.Kind {
+	case yang.Yleafref:
+		x, err := xpath.Compile(t.Path, yangFunctions(c))
+		if err != nil {
+			return nil, err
+		}
+		// prefixes of the path are those of the module defining it
+		var scope yang.Node = e.Node
+		if t.Base != nil {
+			scope = t.Base
+		}
+		v, err := x.Eval(n, yangEnv(c, scope))
+		if err != nil {
+			return nil, err
+		}
+		targets, err := xpath.NodeSet("leafref path", v)
+		if err != nil {
+			return nil, err
+		}
+		var out []dom.Node
+		for _, target := range targets {
+			if xpath.NodeString(target) == value {
+				out = append(out, target)
+			}
+		}
+		return out, nil
+	case yang.YinstanceIdentifier:
+		id, err := ParseInstanceID(value, namespaceLookup(n, c))
+		if err != nil {
+			return nil, nil
+		}
+		root := n
+		for root.Parent() != nil {
+			root = root.Parent()
+		}
+		if target, err := id.Resolve(root); err == nil {
+			return []dom.Node{target}, nil
+		}
+	}
+	return nil, nil
+}
+
+// identityName returns the qualified name of the identity named name,
+// as modules.Collection.DerivedFrom takes it: its prefix is resolved
+// to a namespace by namespace, and a name without one is of the
+// namespace space, or resolved with the empty prefix if space is
+// empty. It returns the empty string if the namespace is unknown.
+func identityName(c *modules.Collection, name string, namespace func(string) (string, error), space string) string {
+	if c == nil {
+		return ""
+	}
+	local := name
+	if i := strings.IndexByte(name, ':'); i >= 0 || space == "" {
+		var prefix string
+		if i >= 0 {
+			prefix, local = name[:i], name[i+1:]
+		}
+		if namespace == nil {
+			return ""
+		}
+		ns, err := namespace(prefix)
+		if err != nil {
+			return ""
+		}
+		space = ns
+	}
+	mod, err := c.ModuleByNamespace(space)
+	if err != nil {
+		return ""
+	}
+	return mod.Name + ":" + local
+}
+
+// valueType returns the type of the value of leaf e, resolving unions
+// and leafrefs, or nil if e has no type or the value is invalid.
+func valueType(e *yang.Entry, value string) *yang.YangType {
+	if e == nil || e.Type == nil {
+		return nil
+	}
+	t, err := checkValue(e, e.Type, value)
+	if err != nil {
+		return nil
+	}
+	if t.Kind == yang.Yleafref {
+		target, err := leafrefTarget(e, t)
+		if err != nil {
+			return nil
+		}
+		return valueType(target, value)
+	}
+	return t
+}
+
+// schemaOf returns the schema node of the element n, found from the
+// top-level element of its tree, or nil.
+func schemaOf(c *modules.Collection, n dom.Node) *yang.Entry {
+	if c == nil {
+		return nil
+	}
+	var names []xml.Name
+	for it := n; it != nil && it.NodeType() == dom.NodeTypeElement; it = it.Parent() {
+		names = append(names, it.Name())
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	e, err := c.RootEntry(names[len(names)-1])
+	if err != nil {
+		return nil
+	}
+	for i := len(names) - 2; i >= 0 && e != nil; i-- {
+		e = c.DataChild(e, names[i].Local)
+	}
+	return e
+}
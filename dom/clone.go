@@ -0,0 +1,52 @@
+package dom
+
+import xml "github.com/andaru/flexml"
+
+// CloneNode returns a copy of n, disconnected from any tree. If deep
+// is true, the copy includes copies of all of n's descendants.
+// Attributes are always copied. A cloned Document shares the context
+// of the original.
+func CloneNode(n Node, deep bool) Node {
+	if n == nil {
+		return nil
+	}
+	c := cloneNode(n.nodePtr(), deep)
+	switch c.NodeType() {
+	case NodeTypeElement:
+		return c.asElement()
+	case NodeTypeDocument:
+		return c.asDocument()
+	}
+	return c
+}
+
+func cloneNode(n *node, deep bool) *node {
+	var c *node
+	switch v := n.value.(type) {
+	case *element:
+		c = &node{value: &element{name: v.name, prefix: v.prefix}}
+		for it := n.firstAttr; it != nil; it = it.nextSib {
+			appendAttribute(newAttribute(it.value.(*attribute).Attr), c)
+		}
+	case *text:
+		c = newText(xml.CharData(v.value).Copy())
+	case *comment:
+		c = newComment(xml.Comment(v.value))
+	case *procinst:
+		c = newProcInst(v.ProcInst)
+	case *declaration:
+		c = newDeclaration(v.ProcInst)
+	case *document:
+		c = newDocument(v.ctx)
+	case *attribute:
+		c = newAttribute(v.Attr)
+	default:
+		c = &node{value: n.value}
+	}
+	if deep {
+		for it := n.firstChild; it != nil; it = it.nextSib {
+			appendNode(cloneNode(it, true), c)
+		}
+	}
+	return c
+}
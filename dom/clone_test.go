@@ -0,0 +1,66 @@
+package dom
+
+import (
+	"testing"
+
+	xml "github.com/andaru/flexml"
+)
+
+func TestCloneNode(t *testing.T) {
+	doc := NewDocument(nil)
+	root := CreateElement(xml.StartElement{
+		Name: xml.Name{Space: "urn:a", Local: "root"},
+		Attr: []xml.Attr{{Name: xml.Name{Local: "id"}, Value: "1"}},
+	})
+	child := CreateElement(xml.StartElement{Name: xml.Name{Space: "urn:a", Local: "child"}})
+	_ = child.AppendChild(CreateText(xml.CharData("value")))
+	_ = root.AppendChild(child)
+	_ = root.AppendChild(CreateComment(xml.Comment("note")))
+	_ = doc.AppendChild(root)
+
+	t.Run("deep", func(t *testing.T) {
+		c := CloneNode(doc, true)
+		if c.NodeType() != NodeTypeDocument || c.Parent() != nil {
+			t.Fatalf("CloneNode() = %v, want a disconnected document", c)
+		}
+		croot := c.FirstChild()
+		if croot.Name() != root.Name() {
+			t.Errorf("cloned root name = %v, want %v", croot.Name(), root.Name())
+		}
+		if a := croot.(AttributeProvider).FirstAttribute(); a == nil || a.Name().Local != "id" || a.Value() != "1" {
+			t.Errorf("cloned root attribute id = %v, want 1", a)
+		}
+		if got := croot.FirstChild().ChildValue(); got != "value" {
+			t.Errorf("cloned child value = %q, want %q", got, "value")
+		}
+		if got := croot.LastChild().NodeType(); got != NodeTypeComment {
+			t.Errorf("cloned last child type = %s, want %s", got, NodeTypeComment)
+		}
+
+		// the clone is independent of the original
+		_ = croot.FirstChild().FirstChild().SetValue("changed")
+		_ = croot.RemoveChild(croot.LastChild())
+		if got := child.ChildValue(); got != "value" {
+			t.Errorf("original child value = %q after editing clone, want %q", got, "value")
+		}
+		if got := root.LastChild().NodeType(); got != NodeTypeComment {
+			t.Errorf("original last child type = %s after editing clone, want %s", got, NodeTypeComment)
+		}
+	})
+
+	t.Run("shallow", func(t *testing.T) {
+		c := CloneNode(root, false)
+		if c.Parent() != nil || c.FirstChild() != nil {
+			t.Errorf("CloneNode(root, false) = %#v, want no parent or children", c)
+		}
+		if c.Name() != root.Name() {
+			t.Errorf("cloned name = %v, want %v", c.Name(), root.Name())
+		}
+	})
+
+	t.Run("nil", func(t *testing.T) {
+		if c := CloneNode(nil, true); c != nil {
+			t.Errorf("CloneNode(nil) = %v, want nil", c)
+		}
+	})
+}
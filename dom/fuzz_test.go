@@ -0,0 +1,81 @@
+package dom
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"testing"
+)
+
+// walk visits the nodes of the tree of n, in both directions, so
+// malformed trees panic or loop.
+func walk(t *testing.T, n Node) {
+	var count int
+	var visit func(Node)
+	visit = func(n Node) {
+		if count++; count > 1e6 {
+			t.Fatal("tree has a cycle")
+		}
+		var forward []Node
+		for it := n.FirstChild(); it != nil; it = it.NextSibling() {
+			if p := it.Parent(); p == nil || p.nodePtr() != n.nodePtr() {
+				t.Fatalf("child %v has parent %v, want %v", it.Name(), it.Parent(), n)
+			}
+			forward = append(forward, it)
+			visit(it)
+		}
+		i := len(forward)
+		for it := n.LastChild(); it != nil; it = it.PreviousSibling() {
+			if i--; i < 0 || forward[i] != it {
+				t.Fatalf("children of %v differ in reverse", n.Name())
+			}
+		}
+		if ap, ok := n.(AttributeProvider); ok {
+			for a := Node(ap.FirstAttribute()); a != nil; a = a.NextSibling() {
+				_ = a.Value()
+			}
+		}
+	}
+	visit(n)
+}
+
+// addFiles adds the files of the testdata directory to the corpus.
+func addFiles(f *testing.F) {
+	for _, name := range []string{"testdata/record1.xml", "testdata/utftest_utf8_clean.xml"} {
+		b, err := ioutil.ReadFile(name)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(b)
+	}
+}
+
+func FuzzXMLReader(f *testing.F) {
+	addFiles(f)
+	f.Add([]byte(`<?xml version="1.0"?><!-- c --><a xmlns="urn:a" xmlns:b="urn:b" b:x="1"><b:c>text</b:c><?pi data?><d/></a>`))
+	f.Fuzz(func(t *testing.T, b []byte) {
+		doc := NewDocument(context.Background())
+		builder := NewBuilder(doc, WithDeclaration(), WithComments(), WithProcInst(), WithTrimPCData(), WithDoctype())
+		if _, err := NewUnmarshaler(builder).XMLReader().ReadFrom(bytes.NewReader(b)); err != nil {
+			return
+		}
+		walk(t, doc)
+		var out bytes.Buffer
+		_, _ = NewMarshaler(doc).XMLWriter().WriteTo(&out)
+	})
+}
+
+func FuzzJSONReader(f *testing.F) {
+	for _, tt := range jsonDecoderTestCases {
+		f.Add([]byte(tt.json))
+	}
+	f.Fuzz(func(t *testing.T, b []byte) {
+		doc := NewDocument(context.Background())
+		if _, err := NewUnmarshaler(NewBuilder(doc)).JSONReader().ReadFrom(bytes.NewReader(b)); err != nil {
+			return
+		}
+		walk(t, doc)
+		var out bytes.Buffer
+		_, _ = NewMarshaler(doc).XMLWriter().WriteTo(&out)
+	})
+}
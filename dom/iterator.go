@@ -17,6 +17,13 @@ type NodeIterator interface {
 }
 
 // NewChildIterator returns a new NodeIterator parent's child nodes.
+//
+// An iterator starts positioned before the first and after the last
+// child of its parent, so NextSibling returns the first child and
+// PreviousSibling the last. Moving past either end returns nil and
+// returns the iterator to its start, as does moving from a node which
+// has since been removed from the parent. An iterator with a nil or
+// empty parent returns only nil.
 func NewChildIterator(parent Node) NodeIterator {
 	return &nodeIterator{parent, nil, func(Node) bool { return true }}
 }
@@ -28,14 +35,15 @@ func NewChildNamedIterator(parent Node, name xml.Name) NodeIterator {
 }
 
 // NewChildFilteringIterator returns a new filtered NodeIterator over the
-// children of parent matching the filter.
+// children of parent matching the filter. A nil filter matches all
+// children.
 func NewChildFilteringIterator(parent Node, filter func(Node) bool) NodeIterator {
 	return &nodeIterator{parent, nil, filter}
 }
 
 func (it *nodeIterator) Equal(o NodeIterator) bool {
 	if ni, ok := o.(*nodeIterator); ok {
-		return it.wrap == ni.wrap && it.parent == ni.parent
+		return ptrOf(it.wrap) == ptrOf(ni.wrap) && ptrOf(it.parent) == ptrOf(ni.parent)
 	}
 	return false
 }
@@ -61,33 +69,189 @@ func (it *nodeIterator) Parent() Node {
 }
 
 func (it *nodeIterator) NextSibling() Node {
+	parent := ptrOf(it.parent)
+	if parent == nil {
+		return it.stop()
+	}
+	var cur *node
 	if it.wrap == nil {
-		it.wrap = it.parent.FirstChild()
-	} else {
-		it.wrap = it.wrap.NextSibling()
+		cur = parent.firstChild
+	} else if w := ptrOf(it.wrap); w != nil && w.parent == parent {
+		cur = w.nextSib
 	}
-	for cur := it.wrap.nodePtr(); cur != nil; cur = cur.nextSib {
-		if it.match(cur) {
+	for ; cur != nil; cur = cur.nextSib {
+		if it.matches(cur) {
 			it.wrap = cur
 			return cur
 		}
 	}
-	it.wrap = nil
-	return nil
+	return it.stop()
 }
 
 func (it *nodeIterator) PreviousSibling() Node {
+	parent := ptrOf(it.parent)
+	if parent == nil || parent.firstChild == nil {
+		return it.stop()
+	}
+	var cur *node
 	if it.wrap == nil {
-		it.wrap = it.parent.LastChild()
-	} else {
-		it.wrap = it.wrap.PreviousSibling()
+		cur = parent.firstChild.prevSib
+	} else if w := ptrOf(it.wrap); w != nil && w.parent == parent && w != parent.firstChild {
+		cur = w.prevSib
+	}
+	// the first child's prevSib is the last child, ending the walk
+	for ; cur != nil; cur = cur.prevSib {
+		if it.matches(cur) {
+			it.wrap = cur
+			return cur
+		}
+		if cur == parent.firstChild {
+			break
+		}
+	}
+	return it.stop()
+}
+
+// matches returns true if n passes the iterator's filter.
+func (it *nodeIterator) matches(n *node) bool {
+	return it.match == nil || it.match(n)
+}
+
+// stop returns the iterator to its start and returns nil.
+func (it *nodeIterator) stop() Node {
+	it.wrap = nil
+	return nil
+}
+
+// ptrOf returns the node of n, or nil if n is nil.
+func ptrOf(n Node) *node {
+	if n == nil {
+		return nil
+	}
+	return n.nodePtr()
+}
+
+// NewFollowingSiblingIterator returns a new NodeIterator over the
+// following-sibling axis of n: the siblings after n, in document
+// order.
+//
+// An axis iterator starts positioned at n. NextSibling moves away from
+// n along the axis and PreviousSibling back towards it, returning nil
+// and returning the iterator to n on passing either end. The axis of a
+// node with no parent, such as an attribute, is empty.
+func NewFollowingSiblingIterator(n Node) NodeIterator {
+	return &axisIterator{origin: n}
+}
+
+// NewFollowingSiblingNamedIterator returns a new NodeIterator over the
+// siblings after n whose Name is name.
+func NewFollowingSiblingNamedIterator(n Node, name xml.Name) NodeIterator {
+	return &axisIterator{origin: n, match: func(n Node) bool { return name == n.Name() }}
+}
+
+// NewFollowingSiblingFilteringIterator returns a new NodeIterator over
+// the siblings after n matching the filter.
+func NewFollowingSiblingFilteringIterator(n Node, filter func(Node) bool) NodeIterator {
+	return &axisIterator{origin: n, match: filter}
+}
+
+// NewPrecedingSiblingIterator returns a new NodeIterator over the
+// preceding-sibling axis of n: the siblings before n, in reverse
+// document order, so NextSibling returns n's previous sibling first.
+func NewPrecedingSiblingIterator(n Node) NodeIterator {
+	return &axisIterator{origin: n, reverse: true}
+}
+
+// NewPrecedingSiblingNamedIterator returns a new NodeIterator over the
+// siblings before n whose Name is name, in reverse document order.
+func NewPrecedingSiblingNamedIterator(n Node, name xml.Name) NodeIterator {
+	return &axisIterator{origin: n, reverse: true, match: func(n Node) bool { return name == n.Name() }}
+}
+
+// NewPrecedingSiblingFilteringIterator returns a new NodeIterator over
+// the siblings before n matching the filter, in reverse document order.
+func NewPrecedingSiblingFilteringIterator(n Node, filter func(Node) bool) NodeIterator {
+	return &axisIterator{origin: n, reverse: true, match: filter}
+}
+
+// axisIterator is a NodeIterator over a sibling axis of the origin
+// node, its NextSibling moving away from the origin.
+type axisIterator struct {
+	origin  Node
+	wrap    *node
+	reverse bool
+	match   func(n Node) bool
+}
+
+func (it *axisIterator) Equal(o NodeIterator) bool {
+	if ai, ok := o.(*axisIterator); ok {
+		return it.wrap == ai.wrap && it.reverse == ai.reverse && ptrOf(it.origin) == ptrOf(ai.origin)
 	}
-	for cur := it.wrap.nodePtr(); cur.nextSib != nil; cur = cur.prevSib {
-		if it.match(cur) {
+	return false
+}
+
+func (it *axisIterator) Node() Node {
+	if it.wrap != nil {
+		return it.wrap
+	}
+	return nil
+}
+
+func (it *axisIterator) Parent() Node {
+	if o := ptrOf(it.origin); o != nil && o.parent != nil {
+		return o.parent
+	}
+	return nil
+}
+
+func (it *axisIterator) NextSibling() Node {
+	return it.walk(!it.reverse)
+}
+
+func (it *axisIterator) PreviousSibling() Node {
+	return it.walk(it.reverse)
+}
+
+// walk moves the iterator to the next matching sibling in document
+// order if forward, otherwise in reverse document order, stopping at
+// the origin.
+func (it *axisIterator) walk(forward bool) Node {
+	origin := ptrOf(it.origin)
+	if origin == nil || origin.parent == nil {
+		return it.stop()
+	}
+	cur := it.wrap
+	if cur == nil {
+		if forward == it.reverse {
+			// the origin is the start of the axis
+			return nil
+		}
+		cur = origin
+	} else if cur.parent != origin.parent {
+		return it.stop()
+	}
+	for cur = siblingOf(cur, forward); cur != nil && cur != origin; cur = siblingOf(cur, forward) {
+		if it.match == nil || it.match(cur) {
 			it.wrap = cur
 			return cur
 		}
 	}
+	return it.stop()
+}
+
+// stop returns the iterator to its origin and returns nil.
+func (it *axisIterator) stop() Node {
 	it.wrap = nil
 	return nil
 }
+
+// siblingOf returns the next sibling of the attached node n if
+// forward, otherwise its previous sibling, or nil if there is none.
+func siblingOf(n *node, forward bool) *node {
+	if forward {
+		return n.nextSib
+	} else if n == n.parent.firstChild {
+		return nil
+	}
+	return n.prevSib
+}
@@ -234,6 +234,14 @@ func Test_nodeIterator_NextSibling(t *testing.T) {
 }
 
 func Test_nodeIterator_PreviousSibling(t *testing.T) {
+	root := CreateElement(xml.StartElement{Name: xml.Name{Local: "root"}})
+	for _, local := range []string{"foo", "bar", "foo", "baz"} {
+		if err := root.AppendChild(CreateElement(xml.StartElement{Name: xml.Name{Local: local}})); err != nil {
+			panic(err)
+		}
+	}
+	isFoo := func(n Node) bool { return n.Name().Local == "foo" }
+
 	type fields struct {
 		parent Node
 		wrap   Node
@@ -244,7 +252,12 @@ func Test_nodeIterator_PreviousSibling(t *testing.T) {
 		fields fields
 		want   Node
 	}{
-	// TODO: Add test cases.
+		{name: "start", fields: fields{parent: root}, want: root.LastChild()},
+		{name: "start filtered", fields: fields{parent: root, match: isFoo}, want: root.LastChild().PreviousSibling()},
+		{name: "from last", fields: fields{parent: root, wrap: root.LastChild(), match: isFoo}, want: root.LastChild().PreviousSibling()},
+		{name: "from middle", fields: fields{parent: root, wrap: root.LastChild().PreviousSibling(), match: isFoo}, want: root.FirstChild()},
+		{name: "from first", fields: fields{parent: root, wrap: root.FirstChild()}, want: nil},
+		{name: "no match", fields: fields{parent: root, match: func(Node) bool { return false }}, want: nil},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -259,3 +272,236 @@ func Test_nodeIterator_PreviousSibling(t *testing.T) {
 		})
 	}
 }
+
+func Test_nodeIterator_edges(t *testing.T) {
+	element := func(local string) Element {
+		return CreateElement(xml.StartElement{Name: xml.Name{Local: local}})
+	}
+	names := func(next func() Node) (got []string) {
+		for n := next(); n != nil; n = next() {
+			got = append(got, n.Name().Local)
+		}
+		return
+	}
+	forward := func(it NodeIterator) []string { return names(it.NextSibling) }
+	backward := func(it NodeIterator) []string { return names(it.PreviousSibling) }
+
+	t.Run("nil parent", func(t *testing.T) {
+		it := NewChildIterator(nil)
+		if n := it.NextSibling(); n != nil {
+			t.Errorf("NextSibling() = %v, want nil", n)
+		}
+		if n := it.PreviousSibling(); n != nil {
+			t.Errorf("PreviousSibling() = %v, want nil", n)
+		}
+		if it.Node() != nil || it.Parent() != nil {
+			t.Errorf("Node() = %v, Parent() = %v, want nil", it.Node(), it.Parent())
+		}
+	})
+
+	t.Run("empty parent", func(t *testing.T) {
+		for _, parent := range []Node{element("root"), NewDocument(nil), CreateText(xml.CharData("text"))} {
+			it := NewChildIterator(parent)
+			if n := it.NextSibling(); n != nil {
+				t.Errorf("%s: NextSibling() = %v, want nil", parent.NodeType(), n)
+			}
+			if n := it.PreviousSibling(); n != nil {
+				t.Errorf("%s: PreviousSibling() = %v, want nil", parent.NodeType(), n)
+			}
+		}
+	})
+
+	root := element("root")
+	for _, local := range []string{"a", "b", "c"} {
+		if err := root.AppendChild(element(local)); err != nil {
+			panic(err)
+		}
+	}
+
+	t.Run("both directions", func(t *testing.T) {
+		it := NewChildIterator(root)
+		if got := forward(it); !reflect.DeepEqual(got, []string{"a", "b", "c"}) {
+			t.Errorf("forward = %v", got)
+		}
+		if got := backward(it); !reflect.DeepEqual(got, []string{"c", "b", "a"}) {
+			t.Errorf("backward after forward = %v", got)
+		}
+		it.NextSibling()
+		it.NextSibling()
+		if n := it.PreviousSibling(); n == nil || n.Name().Local != "a" {
+			t.Errorf("PreviousSibling() after two NextSibling() = %v, want a", n)
+		}
+	})
+
+	t.Run("nil filter", func(t *testing.T) {
+		if got := forward(NewChildFilteringIterator(root, nil)); !reflect.DeepEqual(got, []string{"a", "b", "c"}) {
+			t.Errorf("forward = %v", got)
+		}
+	})
+
+	t.Run("only child", func(t *testing.T) {
+		parent := element("root")
+		parent.AppendChild(element("a"))
+		it := NewChildIterator(parent)
+		if got := forward(it); !reflect.DeepEqual(got, []string{"a"}) {
+			t.Errorf("forward = %v", got)
+		}
+		if got := backward(it); !reflect.DeepEqual(got, []string{"a"}) {
+			t.Errorf("backward = %v", got)
+		}
+	})
+
+	t.Run("current node removed", func(t *testing.T) {
+		parent := element("root")
+		for _, local := range []string{"a", "b", "c"} {
+			parent.AppendChild(element(local))
+		}
+		for _, step := range []func(NodeIterator) Node{NodeIterator.NextSibling, NodeIterator.PreviousSibling} {
+			it := NewChildIterator(parent)
+			it.NextSibling()
+			b := it.NextSibling()
+			if err := parent.RemoveChild(b); err != nil {
+				t.Fatal(err)
+			}
+			if n := step(it); n != nil {
+				t.Errorf("step from removed node = %v, want nil", n)
+			}
+			if it.Node() != nil {
+				t.Errorf("Node() after step from removed node = %v, want nil", it.Node())
+			}
+			parent.InsertChildAfter(b, parent.FirstChild())
+		}
+	})
+
+	t.Run("current node moved", func(t *testing.T) {
+		parent, other := element("root"), element("other")
+		a, b := element("a"), element("b")
+		parent.AppendChild(a)
+		other.AppendChild(b)
+		it := NewChildIterator(parent)
+		it.NextSibling()
+		parent.RemoveChild(a)
+		other.InsertChildBefore(a, b)
+		if n := it.NextSibling(); n != nil {
+			t.Errorf("NextSibling() from moved node = %v, want nil", n)
+		}
+		if n := it.PreviousSibling(); n != nil {
+			t.Errorf("PreviousSibling() in empty parent = %v, want nil", n)
+		}
+	})
+
+	t.Run("restart", func(t *testing.T) {
+		it := NewChildNamedIterator(root, xml.Name{Local: "b"})
+		for i := 0; i < 2; i++ {
+			if got := forward(it); !reflect.DeepEqual(got, []string{"b"}) {
+				t.Errorf("pass %d: forward = %v", i, got)
+			}
+		}
+	})
+
+	t.Run("equal", func(t *testing.T) {
+		it, o := NewChildIterator(root), NewChildIterator(root)
+		it.NextSibling()
+		if it.Equal(o) {
+			t.Error("Equal() at different positions")
+		}
+		o.NextSibling()
+		if !it.Equal(o) {
+			t.Error("!Equal() at the same position")
+		}
+		if !NewChildIterator(root).Equal(&nodeIterator{parent: root.(elementNode).node}) {
+			t.Error("!Equal() of the same parent, wrapped and unwrapped")
+		}
+	})
+}
+
+func Test_axisIterator(t *testing.T) {
+	root := CreateElement(xml.StartElement{Name: xml.Name{Local: "root"}})
+	for _, local := range []string{"a", "b", "c", "b", "d"} {
+		if err := root.AppendChild(CreateElement(xml.StartElement{Name: xml.Name{Local: local}})); err != nil {
+			panic(err)
+		}
+	}
+	c := root.FirstChild().NextSibling().NextSibling()
+	isNotB := func(n Node) bool { return n.Name().Local != "b" }
+	names := func(next func() Node) (got []string) {
+		for n := next(); n != nil; n = next() {
+			got = append(got, n.Name().Local)
+		}
+		return
+	}
+
+	tests := []struct {
+		name string
+		it   NodeIterator
+		want []string
+	}{
+		{"following", NewFollowingSiblingIterator(c), []string{"b", "d"}},
+		{"following named", NewFollowingSiblingNamedIterator(c, xml.Name{Local: "d"}), []string{"d"}},
+		{"following filtering", NewFollowingSiblingFilteringIterator(c, isNotB), []string{"d"}},
+		{"following last", NewFollowingSiblingIterator(root.LastChild()), nil},
+		{"preceding", NewPrecedingSiblingIterator(c), []string{"b", "a"}},
+		{"preceding named", NewPrecedingSiblingNamedIterator(c, xml.Name{Local: "a"}), []string{"a"}},
+		{"preceding filtering", NewPrecedingSiblingFilteringIterator(c, isNotB), []string{"a"}},
+		{"preceding first", NewPrecedingSiblingIterator(root.FirstChild()), nil},
+		{"preceding last", NewPrecedingSiblingIterator(root.LastChild()), []string{"b", "c", "b", "a"}},
+		{"no parent", NewFollowingSiblingIterator(root), nil},
+		{"nil", NewPrecedingSiblingIterator(nil), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := names(tt.it.NextSibling); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NextSibling() = %v, want %v", got, tt.want)
+			}
+			// exhausted, the iterator returns to its origin
+			if got := names(tt.it.NextSibling); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NextSibling() after exhaustion = %v, want %v", got, tt.want)
+			}
+			if n := tt.it.PreviousSibling(); n != nil {
+				t.Errorf("PreviousSibling() at origin = %v, want nil", n)
+			}
+		})
+	}
+
+	t.Run("back to origin", func(t *testing.T) {
+		it := NewFollowingSiblingIterator(c)
+		it.NextSibling()
+		it.NextSibling()
+		if n := it.PreviousSibling(); n == nil || n.Name().Local != "b" {
+			t.Errorf("PreviousSibling() = %v, want b", n)
+		}
+		if n := it.PreviousSibling(); n != nil || it.Node() != nil {
+			t.Errorf("PreviousSibling() past origin = %v, Node() = %v, want nil", n, it.Node())
+		}
+		if ptrOf(it.Parent()) != ptrOf(root) {
+			t.Errorf("Parent() = %v, want root", it.Parent())
+		}
+	})
+
+	t.Run("equal", func(t *testing.T) {
+		it, o := NewPrecedingSiblingIterator(c), NewPrecedingSiblingIterator(c)
+		if !it.Equal(o) || it.Equal(NewFollowingSiblingIterator(c)) || it.Equal(NewChildIterator(root)) {
+			t.Error("Equal() at the origin")
+		}
+		it.NextSibling()
+		if it.Equal(o) {
+			t.Error("Equal() at different positions")
+		}
+	})
+
+	t.Run("current node removed", func(t *testing.T) {
+		parent := CreateElement(xml.StartElement{Name: xml.Name{Local: "root"}})
+		for _, local := range []string{"a", "b", "c"} {
+			parent.AppendChild(CreateElement(xml.StartElement{Name: xml.Name{Local: local}}))
+		}
+		it := NewFollowingSiblingIterator(parent.FirstChild())
+		b := it.NextSibling()
+		parent.RemoveChild(b)
+		if n := it.NextSibling(); n != nil {
+			t.Errorf("NextSibling() from removed node = %v, want nil", n)
+		}
+		if got := names(it.NextSibling); !reflect.DeepEqual(got, []string{"c"}) {
+			t.Errorf("NextSibling() after removal = %v, want [c]", got)
+		}
+	})
+}
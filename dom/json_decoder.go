@@ -151,7 +151,7 @@ func jsDecodeObject(d *JSONDecoder) jsonDecoderFn {
 		if err != nil {
 			return d.bail(err)
 		} else if err2 != nil {
-			return d.bail(err)
+			return d.bail(err2)
 		}
 
 		key, ok := t1.(string)
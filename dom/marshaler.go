@@ -2,6 +2,7 @@ package dom
 
 import (
 	"io"
+	"sync"
 
 	xml "github.com/andaru/flexml"
 	"github.com/pkg/errors"
@@ -16,11 +17,29 @@ import (
 // Specific XML and JSON io.WriterTo encoders are provided by functions:
 //   XMLWriter() io.WriterTo
 //   JSONWriter() io.WriterTo
+//
+// A Marshaler keeps the state of its encoding between calls, so that
+// marshaling many trees with one, changing its node with Reset,
+// allocates little. It must not be used concurrently.
 type Marshaler struct {
 	Node
 
-	opts           bitflag
-	emitExplicitNS bool
+	opts bitflag
+	lead func(parent Node) []Node
+
+	// stack holds the open ancestors of the node being encoded, and
+	// attrs the attributes of its start element
+	stack []marshalFrame
+	attrs []xml.Attr
+}
+
+// marshalFrame is an open ancestor of the node being encoded, with
+// the order of its children if not document order, and the index in
+// it of the next child.
+type marshalFrame struct {
+	n     *node
+	order []*node
+	next  int
 }
 
 const (
@@ -44,12 +63,25 @@ type MarshalerOption func(*Marshaler)
 // namespace.
 func WithExplicitNS() MarshalerOption { return func(e *Marshaler) { e.opts.Add(marshalExplicitNS) } }
 
+// WithLeadingChildren is a marshaler option which causes the children
+// of each element returned by lead, such as the keys of a YANG list
+// entry, to be emitted first, in the order returned, followed by its
+// other children in document order. Nodes returned which are not
+// children of the element are ignored.
+func WithLeadingChildren(lead func(parent Node) []Node) MarshalerOption {
+	return func(e *Marshaler) { e.lead = lead }
+}
+
+// Reset sets the node marshaled, keeping the marshaler's options and
+// reusing its state.
+func (m *Marshaler) Reset(node Node) { m.Node = node }
+
 // XMLWriter returns an XML io.WriterTo for the Node
 func (m *Marshaler) XMLWriter() io.WriterTo { return writerXML{m} }
 
 // MarshalXML encodes .Node to the XML encoder.
 func (m *Marshaler) MarshalXML(enc *xml.Encoder, se xml.StartElement) error {
-	if err := treeOrder(m, enc); err != nil {
+	if err := m.encode(enc); err != nil {
 		return err
 	}
 	return enc.Flush()
@@ -58,14 +90,21 @@ func (m *Marshaler) MarshalXML(enc *xml.Encoder, se xml.StartElement) error {
 type writerXML struct{ *Marshaler }
 
 func (wx writerXML) WriteTo(w io.Writer) (n int64, err error) {
-	cw := &countWriter{w, 0}
-	enc := xml.NewEncoder(cw)
-	err = treeOrder(wx.Marshaler, enc)
-	err2 := enc.Flush()
+	pe := xmlEncoders.Get().(*pooledEncoder)
+	pe.w.Writer, pe.w.n = w, 0
+	err = wx.encode(pe.enc)
+	err2 := pe.enc.Flush()
 	if err == nil {
 		err = err2
 	}
-	return cw.n, err
+	n = pe.w.n
+	pe.w.Writer = nil
+	if err == nil {
+		// encoders failing may hold the state of the failed
+		// encoding, so are not reused
+		xmlEncoders.Put(pe)
+	}
+	return n, err
 }
 
 type countWriter struct {
@@ -79,96 +118,155 @@ func (w *countWriter) Write(b []byte) (n int, err error) {
 	return
 }
 
-var xmlnsDefault = xml.Name{Local: "xmlns"}
-
-type encoderStack struct {
-	d []func() (*node, error)
+// pooledEncoder is an XML encoder, and its buffer, reused by WriteTo
+// calls writing to different writers.
+type pooledEncoder struct {
+	enc *xml.Encoder
+	w   countWriter
 }
 
-func (s *encoderStack) len() int { return len(s.d) }
-func (s *encoderStack) push(fn func() (*node, error)) {
-	s.d = append(s.d, fn)
-}
-func (s *encoderStack) pop() (fn func() (*node, error)) {
-	fn, s.d = s.d[len(s.d)-1], s.d[:len(s.d)-1]
-	return
-}
+var xmlEncoders = sync.Pool{New: func() interface{} {
+	pe := &pooledEncoder{}
+	pe.enc = xml.NewEncoder(&pe.w)
+	return pe
+}}
 
-func treeOrder(e *Marshaler, enc *xml.Encoder) error {
-	s := &encoderStack{}
-	s.push(encodeNodeValueStart(e, enc, e.Node.nodePtr()))
-	for s.len() > 0 {
-		n, err := s.pop()()
-		if err != nil {
-			return errors.WithStack(err)
-		} else if n == nil {
-			continue
+var xmlnsDefault = xml.Name{Local: "xmlns"}
+
+// encode encodes the tokens of the marshaler's node and its
+// descendants to enc, in document order.
+func (m *Marshaler) encode(enc *xml.Encoder) error {
+	stack := m.stack[:0]
+	for n := m.Node.nodePtr(); n != nil; {
+		if err := m.encodeStart(enc, n); err != nil {
+			m.stack = stack[:0]
+			return err
 		}
-		s.push(encodeNodeValueEnd(e, enc, n))
-		if n.firstChild == nil {
+		if n.firstChild != nil {
+			stack = append(stack, marshalFrame{n: n, order: m.childOrder(n)})
+			n = stack[len(stack)-1].nextChild(nil)
 			continue
 		}
-		s.push(encodeNodeValueStart(e, enc, n.firstChild.prevSib))
-		for it := n.firstChild.prevSib.prevSib; it.nextSib != nil; it = it.prevSib {
-			s.push(encodeNodeValueStart(e, enc, it))
+		// end n, and the ancestors it is the last descendant of,
+		// then continue with the next sibling of the last ended
+		for {
+			if err := m.encodeEnd(enc, n); err != nil {
+				m.stack = stack[:0]
+				return err
+			}
+			if len(stack) == 0 {
+				n = nil
+				break
+			}
+			if next := stack[len(stack)-1].nextChild(n); next != nil {
+				n = next
+				break
+			}
+			n, stack = stack[len(stack)-1].n, stack[:len(stack)-1]
 		}
 	}
+	m.stack = stack[:0]
 	return nil
 }
 
-func endElementForNode(n *node, explicitNS bool) xml.EndElement {
-	name := n.xmlName()
-	if n.parent != nil && !explicitNS && n.parent.xmlName().Space == name.Space {
-		name.Space = ""
+// childOrder returns the order the children of n are encoded in, or
+// nil for document order.
+func (m *Marshaler) childOrder(n *node) []*node {
+	if m.lead == nil || n.NodeType() != NodeTypeElement {
+		return nil
+	}
+	leaders := m.lead(n)
+	if len(leaders) == 0 {
+		return nil
+	}
+	var order []*node
+	for _, l := range leaders {
+		if c := ptrOf(l); c != nil && c.parent == n && !containsNode(order, c) {
+			order = append(order, c)
+		}
+	}
+	nlead := len(order)
+	if nlead == 0 {
+		return nil
 	}
-	return xml.EndElement{Name: name}
+	for c := n.firstChild; c != nil; c = c.nextSib {
+		if !containsNode(order[:nlead], c) {
+			order = append(order, c)
+		}
+	}
+	return order
 }
 
-func encodeNodeValueStart(e *Marshaler, enc *xml.Encoder, n *node) func() (*node, error) {
-	return func() (*node, error) {
-		var err error
-		switch n.NodeType() {
-		case NodeTypeElement:
-			name := n.xmlName()
-			if n.parent != nil && !e.opts.Has(marshalExplicitNS) && n.parent.xmlName().Space == name.Space {
-				name.Space = ""
-			}
-			var attrs []xml.Attr
-			for it := n.firstAttr; it != nil; it = it.nextSib {
-				this := it.value.(*attribute).Attr
-				if this.Name != xmlnsDefault {
-					attrs = append(attrs, this)
-				}
-			}
-			err = enc.EncodeToken(xml.StartElement{Name: name, Attr: attrs})
-		case NodeTypeComment:
-			err = enc.EncodeToken(xml.Comment(n.asComment().text.value))
-		case NodeTypeText:
-			err = enc.EncodeToken(n.asText().charData())
-		case NodeTypeDeclaration:
-			err = enc.EncodeToken(n.asDeclaration().declaration.ProcInst)
-		case NodeTypeProcessingInstruction:
-			err = enc.EncodeToken(n.asProcInst().procinst.ProcInst)
-		case NodeTypeDocumentFragment, NodeTypeDocument:
-			// these nodes have no value to encode
-		default:
-			err = errors.Errorf("MarshalXML called on unexpected node type %s", n.NodeType())
+// nextChild returns the child of the frame's node encoded after prev,
+// or the first if prev is nil, or nil if there is none.
+func (f *marshalFrame) nextChild(prev *node) *node {
+	if f.order == nil {
+		if prev == nil {
+			return f.n.firstChild
 		}
-		if err != nil {
-			return n, errors.WithStack(err)
+		return prev.nextSib
+	}
+	if f.next == len(f.order) {
+		return nil
+	}
+	f.next++
+	return f.order[f.next-1]
+}
+
+func containsNode(nodes []*node, n *node) bool {
+	for _, it := range nodes {
+		if it == n {
+			return true
 		}
-		return n, nil
 	}
+	return false
+}
+
+// elementName returns the name of the element n as encoded, without
+// its namespace if it is that of its parent, unless namespaces are
+// explicit.
+func (m *Marshaler) elementName(n *node) xml.Name {
+	name := n.xmlName()
+	if n.parent != nil && !m.opts.Has(marshalExplicitNS) && n.parent.xmlName().Space == name.Space {
+		name.Space = ""
+	}
+	return name
 }
 
-func encodeNodeValueEnd(e *Marshaler, enc *xml.Encoder, n *node) func() (*node, error) {
-	return func() (*node, error) {
-		switch n.NodeType() {
-		case NodeTypeElement:
-			if err := enc.EncodeToken(endElementForNode(n, e.emitExplicitNS)); err != nil {
-				return nil, errors.WithStack(err)
+// encodeStart encodes the start element of the element n, or the
+// token of other nodes.
+func (m *Marshaler) encodeStart(enc *xml.Encoder, n *node) error {
+	var err error
+	switch value := n.value.(type) {
+	case *element:
+		attrs := m.attrs[:0]
+		for it := n.firstAttr; it != nil; it = it.nextSib {
+			if this := it.value.(*attribute).Attr; this.Name != xmlnsDefault {
+				attrs = append(attrs, this)
 			}
 		}
-		return nil, nil
+		err = enc.EncodeToken(xml.StartElement{Name: m.elementName(n), Attr: attrs})
+		m.attrs = attrs[:0]
+	case *comment:
+		err = enc.EncodeToken(xml.Comment(value.value))
+	case *text:
+		err = enc.EncodeToken(xml.CharData(value.value))
+	case *declaration:
+		err = enc.EncodeToken(value.ProcInst)
+	case *procinst:
+		err = enc.EncodeToken(value.ProcInst)
+	case *document, *documentFragment:
+		// these nodes have no value to encode
+	default:
+		err = errors.Errorf("MarshalXML called on unexpected node type %s", n.NodeType())
+	}
+	return errors.WithStack(err)
+}
+
+// encodeEnd encodes the end element of the element n.
+func (m *Marshaler) encodeEnd(enc *xml.Encoder, n *node) error {
+	if _, ok := n.value.(*element); !ok {
+		return nil
 	}
+	return errors.WithStack(enc.EncodeToken(xml.EndElement{Name: m.elementName(n)}))
 }
@@ -3,8 +3,10 @@ package dom
 import (
 	"bytes"
 	"context"
+	"io/ioutil"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
 
 	xml "github.com/andaru/flexml"
@@ -113,3 +115,96 @@ func TestNodeUnmarshalMarshalEquality(t *testing.T) {
 		})
 	}
 }
+
+func TestMarshaler_explicitNS(t *testing.T) {
+	a := CreateElement(xml.StartElement{Name: xml.Name{Space: "urn:a", Local: "a"}})
+	_ = a.AppendChild(CreateElement(xml.StartElement{Name: xml.Name{Space: "urn:a", Local: "b"}}))
+	for _, tt := range []struct {
+		opts []MarshalerOption
+		want string
+	}{
+		{nil, `<a xmlns="urn:a"><b></b></a>`},
+		{[]MarshalerOption{WithExplicitNS()}, `<a xmlns="urn:a"><b xmlns="urn:a"></b></a>`},
+	} {
+		var b bytes.Buffer
+		if _, err := NewMarshaler(a, tt.opts...).XMLWriter().WriteTo(&b); err != nil {
+			t.Fatalf("WriteTo() error = %v", err)
+		}
+		if b.String() != tt.want {
+			t.Errorf("WriteTo() = %s, want %s", b.String(), tt.want)
+		}
+	}
+}
+
+func TestMarshaler_leadingChildren(t *testing.T) {
+	const input = `<r><e><v>1</v><k2>b</k2><k1>a</k1></e><e><k1>c</k1></e><o><k1>d</k1><x></x></o></r>`
+	doc := NewDocument(context.Background())
+	if _, err := NewUnmarshaler(NewBuilder(doc)).XMLReader().ReadFrom(strings.NewReader(input)); err != nil {
+		t.Fatal(err)
+	}
+	other := CreateElement(xml.StartElement{Name: xml.Name{Local: "k1"}})
+	lead := func(parent Node) []Node {
+		if parent.Name().Local != "e" {
+			return nil
+		}
+		// children of other elements, repeated children and nil
+		// are ignored
+		k1 := parent.ChildByName(xml.Name{Local: "k1"})
+		return []Node{other, k1, parent.ChildByName(xml.Name{Local: "k2"}), k1}
+	}
+	for _, tt := range []struct {
+		opts []MarshalerOption
+		want string
+	}{
+		{nil, input},
+		{
+			[]MarshalerOption{WithLeadingChildren(lead)},
+			`<r><e><k1>a</k1><k2>b</k2><v>1</v></e><e><k1>c</k1></e><o><k1>d</k1><x></x></o></r>`,
+		},
+	} {
+		var b bytes.Buffer
+		if _, err := NewMarshaler(doc, tt.opts...).XMLWriter().WriteTo(&b); err != nil {
+			t.Fatalf("WriteTo() error = %v", err)
+		}
+		if b.String() != tt.want {
+			t.Errorf("WriteTo() = %s, want %s", b.String(), tt.want)
+		}
+	}
+}
+
+func TestMarshaler_Reset(t *testing.T) {
+	m := NewMarshaler(nil)
+	for _, want := range []string{`<a><b x="1">t</b><!--c--><c></c></a>`, `<d></d>`, `<e>u</e>`} {
+		doc := NewDocument(context.Background())
+		if _, err := NewUnmarshaler(NewBuilder(doc, WithComments())).XMLReader().ReadFrom(strings.NewReader(want)); err != nil {
+			t.Fatal(err)
+		}
+		m.Reset(doc)
+		var b bytes.Buffer
+		n, err := m.XMLWriter().WriteTo(&b)
+		if err != nil || b.String() != want || int(n) != b.Len() {
+			t.Errorf("WriteTo() = %d, %v, wrote %s, want %s", n, err, b.String(), want)
+		}
+	}
+}
+
+func BenchmarkXMLTreeEncoder(b *testing.B) {
+	b.ReportAllocs()
+
+	f, err := os.Open("./testdata/record1.xml")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer f.Close()
+	doc := NewDocument(context.Background())
+	if _, err := NewUnmarshaler(NewBuilder(doc, WithComments(), WithProcInst(), WithDeclaration())).XMLReader().ReadFrom(f); err != nil {
+		b.Fatal(err)
+	}
+	m := NewMarshaler(doc)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := m.XMLWriter().WriteTo(ioutil.Discard); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -61,6 +61,10 @@ type Node interface {
 	// adding such a child node to this node would be illegal by the
 	// DOM's rules on tree layout.
 	InsertChildBefore(child, ref Node) error
+	// RemoveChild removes the provided child node, which is then
+	// disconnected from the tree. Returns an error if child is not a
+	// child of this node.
+	RemoveChild(child Node) error
 
 	nodePtr
 }
@@ -295,7 +299,8 @@ func (n *node) NextSibling() Node {
 }
 
 func (n *node) PreviousSibling() Node {
-	if n.prevSib.nextSib != nil {
+	// detached nodes have no prevSib
+	if n.prevSib != nil && n.prevSib.nextSib != nil {
 		return n.prevSib
 	}
 	return nil
@@ -361,6 +366,14 @@ func (n *node) InsertChildBefore(child, before Node) error {
 	return nil
 }
 
+func (n *node) RemoveChild(child Node) error {
+	if child == nil || child.nodePtr().parent != n {
+		return ErrChildNotFound
+	}
+	removeNode(child.nodePtr())
+	return nil
+}
+
 func (n *node) defaultNamespace() (owner *node, attrValue string) {
 	for it := n; it != nil; it = it.parent {
 		if err := iterAttributes(it, func(n *node) error {
@@ -518,11 +531,12 @@ func prependNode(child, parent *node) {
 
 func insertNodeBefore(child, before *node) {
 	parent := before.parent
-	child.parent = before
-	if before.prevSib != nil {
-		before.prevSib.nextSib = child
+	child.parent = parent
+	// before's prevSib is the last child if it is the first
+	if parent.firstChild == before {
+		parent.firstChild = child
 	} else {
-		parent.firstChild.prevSib = child
+		before.prevSib.nextSib = child
 	}
 	child.prevSib = before.prevSib
 	child.nextSib = before
@@ -542,6 +556,23 @@ func insertNodeAfter(child, after *node) {
 	after.nextSib = child
 }
 
+func removeNode(child *node) {
+	parent := child.parent
+	if next := child.nextSib; next != nil {
+		next.prevSib = child.prevSib
+	} else if parent.firstChild != child {
+		parent.firstChild.prevSib = child.prevSib
+	}
+	if parent.firstChild == child {
+		parent.firstChild = child.nextSib
+	} else {
+		child.prevSib.nextSib = child.nextSib
+	}
+	child.parent = nil
+	child.prevSib = nil
+	child.nextSib = nil
+}
+
 func allowInsertChild(parent, child NodeType) bool {
 	if parent == NodeTypeNull || child == NodeTypeNull {
 		return false
@@ -641,10 +672,10 @@ func insertAttributeBefore(attr, place, parent *node) {
 			place.value.nodeType(), attr.value.nodeType()))
 	}
 
-	if pprev := place.prevSib; pprev != nil {
-		pprev.nextSib = attr
-	} else {
+	if parent.firstAttr == place {
 		parent.firstAttr = attr
+	} else {
+		place.prevSib.nextSib = attr
 	}
 	attr.prevSib = place.prevSib
 	attr.nextSib = place
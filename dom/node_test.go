@@ -0,0 +1,116 @@
+package dom
+
+import (
+	"reflect"
+	"testing"
+
+	xml "github.com/andaru/flexml"
+)
+
+func Test_node_RemoveChild(t *testing.T) {
+	names := func(n Node) (got []string) {
+		for it := n.FirstChild(); it != nil; it = it.NextSibling() {
+			got = append(got, it.Name().Local)
+		}
+		return
+	}
+	newRoot := func() Node {
+		root := CreateElement(xml.StartElement{Name: xml.Name{Local: "root"}})
+		for _, local := range []string{"a", "b", "c"} {
+			if err := root.AppendChild(CreateElement(xml.StartElement{Name: xml.Name{Local: local}})); err != nil {
+				panic(err)
+			}
+		}
+		return root
+	}
+
+	tests := []struct {
+		name   string
+		remove func(root Node) Node
+		want   []string
+	}{
+		{"first", func(root Node) Node { return root.FirstChild() }, []string{"b", "c"}},
+		{"middle", func(root Node) Node { return root.FirstChild().NextSibling() }, []string{"a", "c"}},
+		{"last", func(root Node) Node { return root.LastChild() }, []string{"a", "b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := newRoot()
+			child := tt.remove(root)
+			if err := root.RemoveChild(child); err != nil {
+				t.Fatalf("RemoveChild() error = %v, wantErr false", err)
+			}
+			if got := names(root); len(got) != len(tt.want) || got[0] != tt.want[0] || got[1] != tt.want[1] {
+				t.Errorf("children after RemoveChild() = %v, want %v", got, tt.want)
+			}
+			if got := root.LastChild().Name().Local; got != tt.want[1] {
+				t.Errorf("LastChild() after RemoveChild() = %s, want %s", got, tt.want[1])
+			}
+			if child.Parent() != nil || child.NextSibling() != nil {
+				t.Errorf("removed child remains connected: %#v", child)
+			}
+			if err := root.RemoveChild(child); err != ErrChildNotFound {
+				t.Errorf("second RemoveChild() error = %v, want %v", err, ErrChildNotFound)
+			}
+		})
+	}
+
+	t.Run("only child", func(t *testing.T) {
+		root := CreateElement(xml.StartElement{Name: xml.Name{Local: "root"}})
+		child := CreateElement(xml.StartElement{Name: xml.Name{Local: "a"}})
+		root.AppendChild(child)
+		if err := root.RemoveChild(root.FirstChild()); err != nil {
+			t.Fatalf("RemoveChild() error = %v, wantErr false", err)
+		}
+		if root.FirstChild() != nil || root.LastChild() != nil {
+			t.Errorf("root has children after removing its only child")
+		}
+		if err := root.AppendChild(child); err != nil || root.FirstChild() == nil {
+			t.Errorf("AppendChild() after RemoveChild() error = %v", err)
+		}
+	})
+}
+
+func Test_node_InsertChildBefore(t *testing.T) {
+	newRoot := func() Node {
+		root := CreateElement(xml.StartElement{Name: xml.Name{Local: "root"}})
+		for _, local := range []string{"a", "b"} {
+			if err := root.AppendChild(CreateElement(xml.StartElement{Name: xml.Name{Local: local}})); err != nil {
+				panic(err)
+			}
+		}
+		return root
+	}
+
+	tests := []struct {
+		name   string
+		before func(root Node) Node
+		want   []string
+	}{
+		{"first", func(root Node) Node { return root.FirstChild() }, []string{"x", "a", "b"}},
+		{"last", func(root Node) Node { return root.LastChild() }, []string{"a", "x", "b"}},
+		{"nil", func(root Node) Node { return nil }, []string{"x", "a", "b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := newRoot()
+			child := CreateElement(xml.StartElement{Name: xml.Name{Local: "x"}})
+			if err := root.InsertChildBefore(child, tt.before(root)); err != nil {
+				t.Fatalf("InsertChildBefore() error = %v, wantErr false", err)
+			}
+			var got, gotReverse []string
+			for it := root.FirstChild(); it != nil; it = it.NextSibling() {
+				got = append(got, it.Name().Local)
+			}
+			for it := root.LastChild(); it != nil; it = it.PreviousSibling() {
+				gotReverse = append([]string{it.Name().Local}, gotReverse...)
+			}
+			if !reflect.DeepEqual(got, tt.want) || !reflect.DeepEqual(gotReverse, tt.want) {
+				t.Errorf("children after InsertChildBefore() = %v (reversed %v), want %v", got, gotReverse, tt.want)
+			}
+			if ptrOf(child.Parent()) != ptrOf(root) {
+				t.Errorf("inserted child's Parent() = %v, want %v", child.Parent(), root)
+			}
+		})
+	}
+}
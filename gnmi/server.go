@@ -0,0 +1,348 @@
+/*
+Package gnmi has the gNMI server of the running datastore of a Set,
+implementing the gNMI service's Capabilities, Get, Set and Subscribe
+RPCs:
+
+	srv := gnmi.NewServer(set, gnmi.WithAuthorizer(enforcer))
+	g := grpc.NewServer(
+		grpc.UnaryInterceptor(gnmisession.UnaryServerInterceptor(mgr, gnmisession.MetadataUsername)),
+		grpc.StreamInterceptor(gnmisession.StreamServerInterceptor(mgr, gnmisession.MetadataUsername)))
+	gpb.RegisterGNMIServer(g, srv)
+
+gNMI paths are translated to instance identifiers of the datastore's
+schema, as by datastore.ResolveGNMIPath: element names may be qualified
+by their module name, and the last element of a list may have no keys,
+addressing every entry. Values are JSON_IETF (RFC 7951) encoded, and
+Set requests may also have JSON and scalar values. Each Set request is
+committed to the running datastore as a single change.
+
+Subscriptions are ONCE, POLL or STREAM. The updates of subscriptions
+are of the subscribed leaves and leaf-lists, each with its full path.
+STREAM subscriptions of the ON_CHANGE and TARGET_DEFINED modes are
+updated when a commit changes the subscribed data, and those of the
+SAMPLE mode at their sample interval. Heartbeats and aliases are not
+supported.
+
+When the Server is registered with the interceptors of the
+session/gnmi package, each RPC is a session of the session manager,
+whose username is that whose access is controlled by the Server's
+Authorizer.
+*/
+package gnmi
+
+import (
+	"context"
+	"sync"
+
+	"github.com/andaru/opr8/datastore"
+	"github.com/andaru/opr8/dom"
+	"github.com/andaru/opr8/modules"
+	"github.com/andaru/opr8/rpc"
+	"github.com/andaru/opr8/session"
+	gnmisession "github.com/andaru/opr8/session/gnmi"
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+	"github.com/openconfig/goyang/pkg/yang"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Version is the version of the gNMI service implemented.
+const Version = "0.7.0"
+
+// Option is a constructor option for Server.
+type Option func(*Server)
+
+// WithAuthorizer is a Server option setting the access control of the
+// data read and written, by the username of each RPC's session.
+func WithAuthorizer(a rpc.Authorizer) Option {
+	return func(s *Server) { s.authorizer = a }
+}
+
+// Server is the gNMI server of the datastores of a Set. It implements
+// the gNMI service, gpb.GNMIServer, and is safe for concurrent use.
+type Server struct {
+	set        *datastore.Set
+	authorizer rpc.Authorizer
+
+	mu   sync.Mutex
+	subs map[*subscription]bool
+	// listening are the datastores whose commits are listened to
+	listening map[*datastore.Datastore]bool
+}
+
+// NewServer returns a new gNMI server of the datastores of set, whose
+// running datastore's data it serves.
+func NewServer(set *datastore.Set, options ...Option) *Server {
+	s := &Server{
+		set:       set,
+		subs:      map[*subscription]bool{},
+		listening: map[*datastore.Datastore]bool{},
+	}
+	for _, option := range options {
+		option(s)
+	}
+	return s
+}
+
+// Capabilities returns the modules of the running datastore's schema,
+// the encodings supported and the gNMI version.
+func (s *Server) Capabilities(ctx context.Context, req *gpb.CapabilityRequest) (*gpb.CapabilityResponse, error) {
+	ds, err := s.running()
+	if err != nil {
+		return nil, err
+	}
+	resp := &gpb.CapabilityResponse{
+		SupportedEncodings: []gpb.Encoding{gpb.Encoding_JSON_IETF, gpb.Encoding_JSON},
+		GNMIVersion:        Version,
+	}
+	_ = ds.Modules().IterLatest(func(mod *yang.Module) error {
+		model := &gpb.ModelData{Name: mod.Name, Version: mod.Current()}
+		if mod.Organization != nil {
+			model.Organization = mod.Organization.Name
+		}
+		resp.SupportedModels = append(resp.SupportedModels, model)
+		return nil
+	})
+	return resp, nil
+}
+
+// Get returns a notification of the data at each path of the request,
+// with an update for each data node addressed, or for every entry of a
+// leaf-list. Paths addressing no data fail with the code NotFound.
+func (s *Server) Get(ctx context.Context, req *gpb.GetRequest) (*gpb.GetResponse, error) {
+	if err := checkEncoding(req.GetEncoding()); err != nil {
+		return nil, err
+	}
+	if len(req.GetUseModels()) > 0 {
+		return nil, status.Error(codes.Unimplemented, "use_models is not supported")
+	}
+	ds, err := s.running()
+	if err != nil {
+		return nil, err
+	}
+	c := ds.Modules()
+	snap := ds.Snapshot()
+	root := s.readTree(ctx, ds, snap.Root, req.GetType())
+
+	resp := &gpb.GetResponse{}
+	for _, path := range req.GetPath() {
+		id, e, err := datastore.ResolveGNMIPath(c, req.GetPrefix(), path)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		n := &gpb.Notification{Timestamp: snap.Time.UnixNano(), Prefix: targetPrefix(req.GetPrefix())}
+		if len(id) == 0 {
+			n.Update = []*gpb.Update{{Path: &gpb.Path{}, Val: jsonValue(datastore.MarshalJSON(c, dataChildren(root)))}}
+		} else {
+			nodes := id.ResolveAll(root)
+			if len(nodes) == 0 {
+				return nil, status.Errorf(codes.NotFound, "no data at %s", id.Format(moduleName(c)))
+			}
+			if e.IsLeafList() {
+				// the leaf-list is a single value
+				n.Update = []*gpb.Update{{Path: datastore.GNMIPath(instanceID(c, nodes[0]), c), Val: jsonValue(datastore.MarshalJSONValue(c, nodes))}}
+			} else {
+				for _, node := range nodes {
+					n.Update = append(n.Update, &gpb.Update{
+						Path: datastore.GNMIPath(instanceID(c, node), c),
+						Val:  jsonValue(datastore.MarshalJSONValue(c, []dom.Node{node})),
+					})
+				}
+			}
+		}
+		resp.Notification = append(resp.Notification, n)
+	}
+	return resp, nil
+}
+
+// Set commits the deletes, replaces and updates of the request to the
+// running datastore, as a single change, returning a result for each.
+func (s *Server) Set(ctx context.Context, req *gpb.SetRequest) (*gpb.SetResponse, error) {
+	ds, err := s.running()
+	if err != nil {
+		return nil, err
+	}
+	if ds.ReadOnly() {
+		return nil, status.Errorf(codes.FailedPrecondition, "datastore %s is read-only", ds.Name())
+	}
+	edits, err := datastore.SetRequestEdits(req, ds.Modules())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	sid, user := s.user(ctx)
+	snap, err := ds.Update(sid, "gnmi Set", func(root dom.Document) error {
+		// the snapshot is that being changed, as Update holds the
+		// writer lock
+		prev := ds.Snapshot()
+		if err := datastore.ApplyEdits(root, ds.Modules(), edits); err != nil {
+			return err
+		}
+		if s.authorizer != nil {
+			return s.authorizer.AuthorizeWrite(user, prev.Root, root)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	resp := &gpb.SetResponse{Prefix: req.GetPrefix(), Timestamp: snap.Time.UnixNano()}
+	for _, path := range req.GetDelete() {
+		resp.Response = append(resp.Response, &gpb.UpdateResult{Path: path, Op: gpb.UpdateResult_DELETE})
+	}
+	for _, update := range req.GetReplace() {
+		resp.Response = append(resp.Response, &gpb.UpdateResult{Path: update.GetPath(), Op: gpb.UpdateResult_REPLACE})
+	}
+	for _, update := range req.GetUpdate() {
+		resp.Response = append(resp.Response, &gpb.UpdateResult{Path: update.GetPath(), Op: gpb.UpdateResult_UPDATE})
+	}
+	return resp, nil
+}
+
+// running returns the running datastore.
+func (s *Server) running() (*datastore.Datastore, error) {
+	ds := s.set.Get(datastore.Running)
+	if ds == nil || ds.Modules() == nil {
+		return nil, status.Error(codes.Unavailable, "no running datastore with a schema")
+	}
+	return ds, nil
+}
+
+// user returns the session ID and username of the RPC's session, or
+// zero and the empty string if the RPC has no session.
+func (s *Server) user(ctx context.Context) (session.ID, string) {
+	sess, ok := gnmisession.FromContext(ctx)
+	if !ok {
+		return 0, ""
+	}
+	if t, ok := sess.Transport().(*gnmisession.Transport); ok {
+		return sess.ID(), t.Username()
+	}
+	return sess.ID(), ""
+}
+
+// readTree returns a copy of the data tree root of the datastore ds,
+// with the data of the type, and with the data the user of the RPC
+// context ctx may not read removed.
+func (s *Server) readTree(ctx context.Context, ds *datastore.Datastore, root dom.Node, t gpb.GetRequest_DataType) dom.Node {
+	tree := dom.CloneNode(root, true)
+	switch t {
+	case gpb.GetRequest_CONFIG:
+		_ = datastore.FilterConfig(tree, ds.Modules(), nil, datastore.ConfigOnly)
+	case gpb.GetRequest_STATE, gpb.GetRequest_OPERATIONAL:
+		_ = datastore.FilterConfig(tree, ds.Modules(), nil, datastore.StateOnly)
+	}
+	if s.authorizer != nil {
+		_, user := s.user(ctx)
+		s.authorizer.FilterRead(user, tree)
+	}
+	return tree
+}
+
+// checkEncoding returns an error with the code Unimplemented if values
+// may not be encoded with the encoding.
+func checkEncoding(enc gpb.Encoding) error {
+	switch enc {
+	case gpb.Encoding_JSON_IETF, gpb.Encoding_JSON:
+		return nil
+	}
+	return status.Errorf(codes.Unimplemented, "unsupported encoding %s", enc)
+}
+
+// jsonValue returns the JSON_IETF value of the RFC 7951 JSON b.
+func jsonValue(b []byte) *gpb.TypedValue {
+	return &gpb.TypedValue{Value: &gpb.TypedValue_JsonIetfVal{JsonIetfVal: b}}
+}
+
+// targetPrefix returns the prefix of notifications of requests with
+// the prefix, having only its target and origin; paths of updates are
+// complete.
+func targetPrefix(prefix *gpb.Path) *gpb.Path {
+	if prefix.GetTarget() == "" && prefix.GetOrigin() == "" {
+		return nil
+	}
+	return &gpb.Path{Target: prefix.GetTarget(), Origin: prefix.GetOrigin()}
+}
+
+// statusError returns the gRPC status error of the error err of a
+// commit, by the error-tag of the rpc-error it is or describes.
+func statusError(err error) error {
+	var re *rpc.RPCError
+	var list rpc.ErrorList
+	tag := rpc.ErrorTagOperationFailed
+	switch err := rpc.FromError(err); {
+	case errors.As(err, &re):
+		tag = re.Tag
+	case errors.As(err, &list) && len(list) > 0:
+		tag = list[0].Tag
+	}
+	code := codes.InvalidArgument
+	switch tag {
+	case rpc.ErrorTagAccessDenied:
+		code = codes.PermissionDenied
+	case rpc.ErrorTagDataExists:
+		code = codes.AlreadyExists
+	case rpc.ErrorTagDataMissing:
+		code = codes.NotFound
+	case rpc.ErrorTagInUse, rpc.ErrorTagLockDenied:
+		code = codes.Aborted
+	case rpc.ErrorTagResourceDenied, rpc.ErrorTagTooBig:
+		code = codes.ResourceExhausted
+	case rpc.ErrorTagOperationNotSupported:
+		code = codes.Unimplemented
+	case rpc.ErrorTagOperationFailed:
+		code = codes.FailedPrecondition
+	case rpc.ErrorTagRollbackFailed:
+		code = codes.Internal
+	}
+	return status.Error(code, err.Error())
+}
+
+// instanceID returns the instance identifier of the data node n, in a
+// data tree with the schema of the collection c.
+func instanceID(c *modules.Collection, n dom.Node) datastore.InstanceID {
+	var nodes []dom.Node
+	for it := n; it != nil && it.NodeType() == dom.NodeTypeElement; it = it.Parent() {
+		nodes = append([]dom.Node{it}, nodes...)
+	}
+	id := make(datastore.InstanceID, 0, len(nodes))
+	var e *yang.Entry
+	for _, it := range nodes {
+		if e == nil {
+			e, _ = c.RootEntry(it.Name())
+		} else {
+			e = c.DataChild(e, it.Name().Local)
+		}
+		if e == nil {
+			id = append(id, datastore.InstanceIDElem{Name: it.Name()})
+			continue
+		}
+		id = append(id, datastore.StepOf(it, e))
+	}
+	return id
+}
+
+// moduleName returns a function returning the name of the module of c
+// with a namespace, or the namespace if there is none.
+func moduleName(c *modules.Collection) func(ns string) string {
+	return func(ns string) string {
+		if m, err := c.ModuleByNamespace(ns); err == nil {
+			return m.Name
+		}
+		return ns
+	}
+}
+
+// dataChildren returns the element children of n.
+func dataChildren(n dom.Node) []dom.Node {
+	var children []dom.Node
+	for it := n.FirstChild(); it != nil; it = it.NextSibling() {
+		if it.NodeType() == dom.NodeTypeElement {
+			children = append(children, it)
+		}
+	}
+	return children
+}
+
+var _ gpb.GNMIServer = &Server{}
@@ -0,0 +1,425 @@
+package gnmi
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andaru/opr8/datastore"
+	"github.com/andaru/opr8/dom"
+	"github.com/andaru/opr8/modules"
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const testModule = `module gnmi-test {
+  namespace "urn:gnmi-test"; prefix gt;
+  organization "opr8";
+  revision 2020-01-01;
+  container system {
+    leaf host-name { type string; }
+    leaf-list dns { type string; }
+    list user { key name; leaf name { type string; } leaf uid { type uint32; } }
+    container state { config false; leaf uptime { type uint32; } }
+  }
+}`
+
+const testData = `<system xmlns="urn:gnmi-test"><host-name>a</host-name><dns>x</dns><dns>y</dns>` +
+	`<user><name>u1</name><uid>1</uid></user><user><name>u2</name><uid>2</uid></user>` +
+	`<state><uptime>5</uptime></state></system>`
+
+func newTestServer(t *testing.T) (*Server, *datastore.Datastore) {
+	t.Helper()
+	c := modules.NewCollection()
+	if err := c.ReadString("gnmi-test", testModule); err != nil {
+		t.Fatal(err)
+	}
+	if errs := c.Process(); errs != nil {
+		t.Fatal(errs)
+	}
+	ds := datastore.New(datastore.Running, c)
+	_, err := ds.Update(0, "", func(root dom.Document) error {
+		doc := dom.NewDocument(nil)
+		if _, err := dom.NewUnmarshaler(dom.NewBuilder(doc, dom.WithTrimPCData())).XMLReader().ReadFrom(strings.NewReader(testData)); err != nil {
+			return err
+		}
+		return root.AppendChild(dom.CloneNode(doc.DocumentElement(), true))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewServer(datastore.NewSet(ds)), ds
+}
+
+// path returns the gNMI path of the elements, with keys given as
+// "name[key=value]".
+func path(elems ...string) *gpb.Path {
+	p := &gpb.Path{}
+	for _, elem := range elems {
+		pe := &gpb.PathElem{Name: elem}
+		if i := strings.IndexByte(elem, '['); i >= 0 {
+			kv := strings.SplitN(strings.TrimSuffix(elem[i+1:], "]"), "=", 2)
+			pe.Name, pe.Key = elem[:i], map[string]string{kv[0]: kv[1]}
+		}
+		p.Elem = append(p.Elem, pe)
+	}
+	return p
+}
+
+// pathString returns the string form of the gNMI path p, as parsed by
+// path.
+func pathString(p *gpb.Path) string {
+	var b strings.Builder
+	for _, elem := range p.GetElem() {
+		b.WriteString("/" + elem.GetName())
+		for k, v := range elem.GetKey() {
+			b.WriteString("[" + k + "=" + v + "]")
+		}
+	}
+	return b.String()
+}
+
+// updates returns the path and value of each update of n.
+func updates(n *gpb.Notification) []string {
+	var got []string
+	for _, u := range n.GetUpdate() {
+		got = append(got, pathString(u.GetPath())+" "+string(u.GetVal().GetJsonIetfVal()))
+	}
+	for _, p := range n.GetDelete() {
+		got = append(got, pathString(p)+" deleted")
+	}
+	return got
+}
+
+func TestServer_Capabilities(t *testing.T) {
+	srv, _ := newTestServer(t)
+	resp, err := srv.Capabilities(context.Background(), &gpb.CapabilityRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*gpb.ModelData{{Name: "gnmi-test", Organization: "opr8", Version: "2020-01-01"}}
+	if len(resp.GetSupportedModels()) != 1 || resp.GetSupportedModels()[0].String() != want[0].String() {
+		t.Errorf("SupportedModels got %v, want %v", resp.GetSupportedModels(), want)
+	}
+	if resp.GetGNMIVersion() != Version || resp.GetSupportedEncodings()[0] != gpb.Encoding_JSON_IETF {
+		t.Errorf("Capabilities() = %v", resp)
+	}
+}
+
+func TestServer_Get(t *testing.T) {
+	srv, _ := newTestServer(t)
+	for _, tt := range []struct {
+		name     string
+		req      *gpb.GetRequest
+		want     [][]string
+		wantCode codes.Code
+	}{
+		{
+			name: "leaf and container",
+			req: &gpb.GetRequest{
+				Prefix:   path("gnmi-test:system"),
+				Path:     []*gpb.Path{path("host-name"), path("user[name=u2]")},
+				Encoding: gpb.Encoding_JSON_IETF,
+			},
+			want: [][]string{
+				{`/gnmi-test:system/host-name "a"`},
+				{`/gnmi-test:system/user[name=u2] {"name":"u2","uid":2}`},
+			},
+		},
+		{
+			name: "every list entry and leaf-list",
+			req: &gpb.GetRequest{
+				Path:     []*gpb.Path{path("system", "user"), path("system", "dns")},
+				Encoding: gpb.Encoding_JSON_IETF,
+			},
+			want: [][]string{
+				{
+					`/gnmi-test:system/user[name=u1] {"name":"u1","uid":1}`,
+					`/gnmi-test:system/user[name=u2] {"name":"u2","uid":2}`,
+				},
+				{`/gnmi-test:system/dns ["x","y"]`},
+			},
+		},
+		{
+			name: "config",
+			req:  &gpb.GetRequest{Path: []*gpb.Path{path("system", "state")}, Type: gpb.GetRequest_CONFIG},
+			// the state container is removed
+			wantCode: codes.NotFound,
+		},
+		{
+			name: "state",
+			req:  &gpb.GetRequest{Path: []*gpb.Path{path("system")}, Type: gpb.GetRequest_STATE},
+			want: [][]string{{`/gnmi-test:system {"state":{"uptime":5}}`}},
+		},
+		{
+			name: "root",
+			req:  &gpb.GetRequest{Path: []*gpb.Path{{}}, Type: gpb.GetRequest_CONFIG},
+			want: [][]string{{
+				` {"gnmi-test:system":{"host-name":"a","dns":["x","y"],"user":[{"name":"u1","uid":1},{"name":"u2","uid":2}]}}`,
+			}},
+		},
+		{
+			name:     "unknown path",
+			req:      &gpb.GetRequest{Path: []*gpb.Path{path("system", "bogus")}},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "unsupported encoding",
+			req:      &gpb.GetRequest{Path: []*gpb.Path{path("system")}, Encoding: gpb.Encoding_PROTO},
+			wantCode: codes.Unimplemented,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := srv.Get(context.Background(), tt.req)
+			if status.Code(err) != tt.wantCode {
+				t.Fatalf("Get() error = %v, want code %v", err, tt.wantCode)
+			}
+			var got [][]string
+			for _, n := range resp.GetNotification() {
+				got = append(got, updates(n))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Get() got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServer_Set(t *testing.T) {
+	srv, ds := newTestServer(t)
+	resp, err := srv.Set(context.Background(), &gpb.SetRequest{
+		Prefix: path("gnmi-test:system"),
+		Delete: []*gpb.Path{path("user[name=u1]")},
+		Update: []*gpb.Update{{
+			Path: path("host-name"),
+			Val:  &gpb.TypedValue{Value: &gpb.TypedValue_StringVal{StringVal: "b"}},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.GetResponse()) != 2 || resp.GetResponse()[0].GetOp() != gpb.UpdateResult_DELETE ||
+		resp.GetResponse()[1].GetOp() != gpb.UpdateResult_UPDATE || resp.GetTimestamp() != ds.Snapshot().Time.UnixNano() {
+		t.Errorf("Set() = %v", resp)
+	}
+	got, err := srv.Get(context.Background(), &gpb.GetRequest{Path: []*gpb.Path{path("system")}, Type: gpb.GetRequest_CONFIG})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{`/gnmi-test:system {"host-name":"b","dns":["x","y"],"user":[{"name":"u2","uid":2}]}`}
+	if u := updates(got.GetNotification()[0]); !reflect.DeepEqual(u, want) {
+		t.Errorf("data after Set() got %q, want %q", u, want)
+	}
+
+	_, err = srv.Set(context.Background(), &gpb.SetRequest{Delete: []*gpb.Path{path("system", "nope")}})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Set() of an unknown path error = %v, want code %v", err, codes.InvalidArgument)
+	}
+}
+
+// testStream is a gNMI Subscribe stream, whose requests are received
+// from and responses sent to channels.
+type testStream struct {
+	grpc.ServerStream
+	ctx  context.Context
+	reqs chan *gpb.SubscribeRequest
+	resp chan *gpb.SubscribeResponse
+}
+
+func newTestStream(ctx context.Context, reqs ...*gpb.SubscribeRequest) *testStream {
+	ss := &testStream{ctx: ctx, reqs: make(chan *gpb.SubscribeRequest, 10), resp: make(chan *gpb.SubscribeResponse, 10)}
+	for _, req := range reqs {
+		ss.reqs <- req
+	}
+	return ss
+}
+
+func (ss *testStream) Context() context.Context { return ss.ctx }
+
+func (ss *testStream) Send(resp *gpb.SubscribeResponse) error {
+	ss.resp <- resp
+	return nil
+}
+
+func (ss *testStream) Recv() (*gpb.SubscribeRequest, error) {
+	select {
+	case req, ok := <-ss.reqs:
+		if !ok {
+			return nil, io.EOF
+		}
+		return req, nil
+	case <-ss.ctx.Done():
+		return nil, ss.ctx.Err()
+	}
+}
+
+// next returns the updates of the stream's next response, or nil for a
+// sync response.
+func (ss *testStream) next(t *testing.T) []string {
+	t.Helper()
+	select {
+	case resp := <-ss.resp:
+		if resp.GetSyncResponse() {
+			return nil
+		}
+		return updates(resp.GetUpdate())
+	case <-time.After(5 * time.Second):
+		t.Fatal("no response")
+		return nil
+	}
+}
+
+func subscribeRequest(mode gpb.SubscriptionList_Mode, subs ...*gpb.Subscription) *gpb.SubscribeRequest {
+	return &gpb.SubscribeRequest{Request: &gpb.SubscribeRequest_Subscribe{Subscribe: &gpb.SubscriptionList{
+		Prefix:       path("gnmi-test:system"),
+		Subscription: subs,
+		Mode:         mode,
+	}}}
+}
+
+func TestServer_Subscribe_once(t *testing.T) {
+	srv, _ := newTestServer(t)
+	ss := newTestStream(context.Background(), subscribeRequest(gpb.SubscriptionList_ONCE,
+		&gpb.Subscription{Path: path("user[name=u1]")}, &gpb.Subscription{Path: path("dns")}))
+	if err := srv.Subscribe(ss); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		`/gnmi-test:system/user[name=u1]/name "u1"`,
+		`/gnmi-test:system/user[name=u1]/uid 1`,
+		`/gnmi-test:system/dns ["x","y"]`,
+	}
+	if got := ss.next(t); !reflect.DeepEqual(got, want) {
+		t.Errorf("updates got %q, want %q", got, want)
+	}
+	if got := ss.next(t); got != nil {
+		t.Errorf("got %q, want a sync response", got)
+	}
+}
+
+func TestServer_Subscribe_poll(t *testing.T) {
+	srv, _ := newTestServer(t)
+	ss := newTestStream(context.Background(), subscribeRequest(gpb.SubscriptionList_POLL, &gpb.Subscription{Path: path("host-name")}))
+	errc := make(chan error, 1)
+	go func() { errc <- srv.Subscribe(ss) }()
+	if got, want := ss.next(t), []string{`/gnmi-test:system/host-name "a"`}; !reflect.DeepEqual(got, want) {
+		t.Errorf("updates got %q, want %q", got, want)
+	}
+	ss.next(t)
+	set(t, srv, "host-name", "b")
+	ss.reqs <- &gpb.SubscribeRequest{Request: &gpb.SubscribeRequest_Poll{Poll: &gpb.Poll{}}}
+	if got, want := ss.next(t), []string{`/gnmi-test:system/host-name "b"`}; !reflect.DeepEqual(got, want) {
+		t.Errorf("polled updates got %q, want %q", got, want)
+	}
+	ss.next(t)
+	close(ss.reqs)
+	if err := <-errc; err != nil {
+		t.Errorf("Subscribe() error = %v", err)
+	}
+}
+
+func TestServer_Subscribe_stream(t *testing.T) {
+	srv, _ := newTestServer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ss := newTestStream(ctx, subscribeRequest(gpb.SubscriptionList_STREAM,
+		&gpb.Subscription{Path: path("host-name"), Mode: gpb.SubscriptionMode_ON_CHANGE},
+		&gpb.Subscription{Path: path("user"), Mode: gpb.SubscriptionMode_ON_CHANGE}))
+	errc := make(chan error, 1)
+	go func() { errc <- srv.Subscribe(ss) }()
+
+	want := []string{
+		`/gnmi-test:system/host-name "a"`,
+		`/gnmi-test:system/user[name=u1]/name "u1"`,
+		`/gnmi-test:system/user[name=u1]/uid 1`,
+		`/gnmi-test:system/user[name=u2]/name "u2"`,
+		`/gnmi-test:system/user[name=u2]/uid 2`,
+	}
+	if got := ss.next(t); !reflect.DeepEqual(got, want) {
+		t.Errorf("initial updates got %q, want %q", got, want)
+	}
+	if got := ss.next(t); got != nil {
+		t.Errorf("got %q, want a sync response", got)
+	}
+
+	set(t, srv, "host-name", "b")
+	if got, want := ss.next(t), []string{`/gnmi-test:system/host-name "b"`}; !reflect.DeepEqual(got, want) {
+		t.Errorf("changed updates got %q, want %q", got, want)
+	}
+	_, err := srv.Set(context.Background(), &gpb.SetRequest{Delete: []*gpb.Path{path("system", "user[name=u1]")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []string{`/gnmi-test:system/user[name=u1]/name deleted`, `/gnmi-test:system/user[name=u1]/uid deleted`}
+	if got := ss.next(t); !reflect.DeepEqual(got, want) {
+		t.Errorf("deleted updates got %q, want %q", got, want)
+	}
+	// changes to data not subscribed to are not sent
+	_, err = srv.Set(context.Background(), &gpb.SetRequest{Replace: []*gpb.Update{{
+		Path: path("system", "dns"),
+		Val:  &gpb.TypedValue{Value: &gpb.TypedValue_JsonIetfVal{JsonIetfVal: []byte(`["z"]`)}},
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case resp := <-ss.resp:
+		t.Errorf("unexpected response %v", resp)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	cancel()
+	if err := <-errc; err != context.Canceled {
+		t.Errorf("Subscribe() error = %v, want %v", err, context.Canceled)
+	}
+	if len(srv.subs) != 0 {
+		t.Errorf("subscriptions remain after Subscribe() returns: %v", srv.subs)
+	}
+}
+
+func TestServer_Subscribe_sample(t *testing.T) {
+	srv, _ := newTestServer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ss := newTestStream(ctx, subscribeRequest(gpb.SubscriptionList_STREAM,
+		&gpb.Subscription{Path: path("host-name"), Mode: gpb.SubscriptionMode_SAMPLE, SampleInterval: uint64(10 * time.Millisecond)}))
+	go func() { _ = srv.Subscribe(ss) }()
+	want := []string{`/gnmi-test:system/host-name "a"`}
+	ss.next(t)
+	ss.next(t)
+	for i := 0; i < 2; i++ {
+		if got := ss.next(t); !reflect.DeepEqual(got, want) {
+			t.Errorf("sample %d got %q, want %q", i, got, want)
+		}
+	}
+}
+
+func TestServer_Subscribe_invalid(t *testing.T) {
+	srv, _ := newTestServer(t)
+	for name, req := range map[string]*gpb.SubscribeRequest{
+		"poll first":   {Request: &gpb.SubscribeRequest_Poll{Poll: &gpb.Poll{}}},
+		"unknown path": subscribeRequest(gpb.SubscriptionList_ONCE, &gpb.Subscription{Path: path("bogus")}),
+	} {
+		if err := srv.Subscribe(newTestStream(context.Background(), req)); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("%s: Subscribe() error = %v, want code %v", name, err, codes.InvalidArgument)
+		}
+	}
+}
+
+// set sets the leaf of the system container to the value with a Set
+// request of srv.
+func set(t *testing.T, srv *Server, leaf, value string) {
+	t.Helper()
+	_, err := srv.Set(context.Background(), &gpb.SetRequest{Update: []*gpb.Update{{
+		Path: path("system", leaf),
+		Val:  &gpb.TypedValue{Value: &gpb.TypedValue_StringVal{StringVal: value}},
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,377 @@
+package gnmi
+
+import (
+	"io"
+	"time"
+
+	xml "github.com/andaru/flexml"
+	"github.com/andaru/opr8/datastore"
+	"github.com/andaru/opr8/dom"
+	"github.com/andaru/opr8/modules"
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+	"github.com/openconfig/goyang/pkg/yang"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// defaultSampleInterval is the sample interval of SAMPLE subscriptions
+// with none.
+const defaultSampleInterval = 10 * time.Second
+
+// Subscribe serves the subscription list of the stream's first
+// request. ONCE subscriptions end after the current values and a sync
+// response are sent, as do POLL subscriptions on each poll request.
+// STREAM subscriptions last until the RPC is cancelled.
+func (s *Server) Subscribe(stream gpb.GNMI_SubscribeServer) error {
+	req, err := stream.Recv()
+	if err == io.EOF {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	list := req.GetSubscribe()
+	if list == nil {
+		return status.Error(codes.InvalidArgument, "the first request must be a subscription list")
+	}
+	if err := checkEncoding(list.GetEncoding()); err != nil {
+		return err
+	}
+	if list.GetUseAliases() || len(list.GetUseModels()) > 0 {
+		return status.Error(codes.Unimplemented, "aliases and use_models are not supported")
+	}
+	ds, err := s.running()
+	if err != nil {
+		return err
+	}
+	sub := &subscription{
+		s:       s,
+		stream:  stream,
+		ds:      ds,
+		prefix:  targetPrefix(list.GetPrefix()),
+		changed: make(chan struct{}, 1),
+	}
+	for _, sp := range list.GetSubscription() {
+		id, e, err := datastore.ResolveGNMIPath(ds.Modules(), list.GetPrefix(), sp.GetPath())
+		if err != nil {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+		p := subscriptionPath{id: id, parent: dataParent(e), mode: sp.GetMode(), suppress: sp.GetSuppressRedundant()}
+		if p.mode == gpb.SubscriptionMode_SAMPLE {
+			if p.interval = time.Duration(sp.GetSampleInterval()); p.interval == 0 {
+				p.interval = defaultSampleInterval
+			}
+		}
+		sub.paths = append(sub.paths, p)
+	}
+
+	switch list.GetMode() {
+	case gpb.SubscriptionList_ONCE:
+		return sub.sync()
+	case gpb.SubscriptionList_POLL:
+		for {
+			if err := sub.sync(); err != nil {
+				return err
+			}
+			req, err := stream.Recv()
+			if err == io.EOF {
+				return nil
+			} else if err != nil {
+				return err
+			} else if req.GetPoll() == nil {
+				return status.Error(codes.InvalidArgument, "POLL subscriptions may only be polled")
+			}
+		}
+	}
+	return sub.run(list.GetUpdatesOnly())
+}
+
+// add adds the STREAM subscription, listening to commits of its
+// datastore.
+func (s *Server) add(sub *subscription) {
+	s.mu.Lock()
+	s.subs[sub] = true
+	listen := !s.listening[sub.ds]
+	s.listening[sub.ds] = true
+	s.mu.Unlock()
+	// listeners are called with the datastore's writer lock held, so
+	// s.mu is not held while adding one
+	if listen {
+		ds := sub.ds
+		ds.Listen(func(prev, next *datastore.Snapshot) { s.changed(ds) })
+	}
+}
+
+// remove removes the STREAM subscription.
+func (s *Server) remove(sub *subscription) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.subs, sub)
+}
+
+// changed signals the subscriptions to ds that it has changed.
+func (s *Server) changed(ds *datastore.Datastore) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for sub := range s.subs {
+		if sub.ds == ds {
+			select {
+			case sub.changed <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// subscription is the subscription list of a Subscribe RPC.
+type subscription struct {
+	s      *Server
+	stream gpb.GNMI_SubscribeServer
+	ds     *datastore.Datastore
+	// prefix is the prefix of the notifications sent
+	prefix *gpb.Path
+	paths  []subscriptionPath
+	// changed is signalled when the datastore changes
+	changed chan struct{}
+}
+
+// subscriptionPath is a subscription to the data at a path.
+type subscriptionPath struct {
+	// id is the path, empty for the whole data tree, and parent the
+	// schema node of the parent of the data nodes it addresses
+	id     datastore.InstanceID
+	parent *yang.Entry
+	mode   gpb.SubscriptionMode
+	// interval is the sample interval of SAMPLE subscriptions, which
+	// only send changed values if suppress is true
+	interval time.Duration
+	suppress bool
+}
+
+// onChange returns true if the subscription's updates are sent when
+// the data changes.
+func (p subscriptionPath) onChange() bool { return p.mode != gpb.SubscriptionMode_SAMPLE }
+
+// sync sends the current values of every path, then a sync response.
+func (sub *subscription) sync() error {
+	values := sub.values(sub.read(), sub.paths...)
+	if err := sub.send(time.Now(), values, nil); err != nil {
+		return err
+	}
+	return sub.stream.Send(&gpb.SubscribeResponse{Response: &gpb.SubscribeResponse_SyncResponse{SyncResponse: true}})
+}
+
+// run serves a STREAM subscription, sending the current values, unless
+// updatesOnly is true, and a sync response, and then the updates of its
+// paths until the stream ends.
+func (sub *subscription) run(updatesOnly bool) error {
+	ctx := sub.stream.Context()
+	sub.s.add(sub)
+	defer sub.s.remove(sub)
+
+	var onChange []subscriptionPath
+	samples := make(chan int)
+	done := make(chan struct{})
+	defer close(done)
+	for i, p := range sub.paths {
+		if p.onChange() {
+			onChange = append(onChange, p)
+			continue
+		}
+		go func(i int, interval time.Duration) {
+			t := time.NewTicker(interval)
+			defer t.Stop()
+			for {
+				select {
+				case <-t.C:
+					select {
+					case samples <- i:
+					case <-done:
+						return
+					}
+				case <-done:
+					return
+				}
+			}
+		}(i, p.interval)
+	}
+	// further requests end the subscription, though the client may
+	// close its side of the stream
+	recv := make(chan error, 1)
+	go func() {
+		_, err := sub.stream.Recv()
+		if err == nil {
+			err = status.Error(codes.InvalidArgument, "STREAM subscriptions may not be changed")
+		}
+		recv <- err
+	}()
+
+	root := sub.read()
+	last := sub.values(root, onChange...)
+	sampled := make([]*leafValues, len(sub.paths))
+	for i, p := range sub.paths {
+		if !p.onChange() {
+			sampled[i] = sub.values(root, p)
+		}
+	}
+	if !updatesOnly {
+		if err := sub.send(time.Now(), sub.values(root, sub.paths...), nil); err != nil {
+			return err
+		}
+	}
+	if err := sub.stream.Send(&gpb.SubscribeResponse{Response: &gpb.SubscribeResponse_SyncResponse{SyncResponse: true}}); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-sub.changed:
+			if len(onChange) == 0 {
+				continue
+			}
+			snap := sub.ds.Snapshot()
+			next := sub.values(sub.readSnapshot(snap), onChange...)
+			updates, deletes := last.diff(next)
+			last = next
+			if len(updates.keys) > 0 || len(deletes) > 0 {
+				if err := sub.send(snap.Time, updates, deletes); err != nil {
+					return err
+				}
+			}
+		case i := <-samples:
+			next := sub.values(sub.read(), sub.paths[i])
+			updates := next
+			if sub.paths[i].suppress {
+				updates, _ = sampled[i].diff(next)
+			}
+			sampled[i] = next
+			if len(updates.keys) > 0 {
+				if err := sub.send(time.Now(), updates, nil); err != nil {
+					return err
+				}
+			}
+		case err := <-recv:
+			if err == io.EOF {
+				recv = nil
+				continue
+			}
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// read returns the data tree of the datastore the subscriber may read.
+func (sub *subscription) read() dom.Node { return sub.readSnapshot(sub.ds.Snapshot()) }
+
+func (sub *subscription) readSnapshot(snap *datastore.Snapshot) dom.Node {
+	return sub.s.readTree(sub.stream.Context(), sub.ds, snap.Root, gpb.GetRequest_ALL)
+}
+
+// values returns the values of the leaves of the data tree root at the
+// paths.
+func (sub *subscription) values(root dom.Node, paths ...subscriptionPath) *leafValues {
+	c := sub.ds.Modules()
+	v := &leafValues{updates: map[string]*gpb.Update{}}
+	for _, p := range paths {
+		if len(p.id) == 0 {
+			v.add(c, nil, nil, dataChildren(root))
+		} else {
+			v.add(c, p.parent, p.id[:len(p.id)-1], p.id.ResolveAll(root))
+		}
+	}
+	return v
+}
+
+// send sends a notification of the updates and deletes, with the
+// timestamp t, if there are any.
+func (sub *subscription) send(t time.Time, updates *leafValues, deletes []*gpb.Path) error {
+	n := &gpb.Notification{Timestamp: t.UnixNano(), Prefix: sub.prefix, Delete: deletes}
+	for _, key := range updates.keys {
+		n.Update = append(n.Update, updates.updates[key])
+	}
+	return sub.stream.Send(&gpb.SubscribeResponse{Response: &gpb.SubscribeResponse_Update{Update: n}})
+}
+
+// leafValues are the updates of the values of leaves and leaf-lists,
+// by the string form of their paths, in document order.
+type leafValues struct {
+	keys    []string
+	updates map[string]*gpb.Update
+}
+
+// add adds the values of the sibling data nodes at the path id, the
+// children of a node of schema node parent, or top-level nodes if
+// parent is nil, and of their descendants. The entries of a leaf-list
+// are a single value.
+func (v *leafValues) add(c *modules.Collection, parent *yang.Entry, id datastore.InstanceID, nodes []dom.Node) {
+	var lists []xml.Name
+	entries := map[xml.Name][]dom.Node{}
+	for _, n := range nodes {
+		var e *yang.Entry
+		if parent == nil {
+			e, _ = c.RootEntry(n.Name())
+		} else {
+			e = c.DataChild(parent, n.Name().Local)
+		}
+		if e == nil || e.Namespace().Name != n.Name().Space {
+			continue
+		}
+		switch {
+		case e.IsLeafList():
+			if _, ok := entries[n.Name()]; !ok {
+				lists = append(lists, n.Name())
+			}
+			entries[n.Name()] = append(entries[n.Name()], n)
+		case e.Kind == yang.LeafEntry:
+			v.set(c, append(id[:len(id):len(id)], datastore.StepOf(n, e)), datastore.MarshalJSONValue(c, []dom.Node{n}))
+		default:
+			v.add(c, e, append(id[:len(id):len(id)], datastore.StepOf(n, e)), dataChildren(n))
+		}
+	}
+	for _, name := range lists {
+		v.set(c, append(id[:len(id):len(id)], datastore.InstanceIDElem{Name: name}), datastore.MarshalJSONValue(c, entries[name]))
+	}
+}
+
+func (v *leafValues) set(c *modules.Collection, id datastore.InstanceID, value []byte) {
+	key := id.Format(nil)
+	if _, ok := v.updates[key]; !ok {
+		v.keys = append(v.keys, key)
+	}
+	v.updates[key] = &gpb.Update{Path: datastore.GNMIPath(id, c), Val: jsonValue(value)}
+}
+
+// diff returns the values of next that are new or differ from those of
+// v, and the paths of the values of v not in next.
+func (v *leafValues) diff(next *leafValues) (*leafValues, []*gpb.Path) {
+	updates := &leafValues{updates: map[string]*gpb.Update{}}
+	for _, key := range next.keys {
+		u := next.updates[key]
+		if prev, ok := v.updates[key]; !ok || string(prev.GetVal().GetJsonIetfVal()) != string(u.GetVal().GetJsonIetfVal()) {
+			updates.keys = append(updates.keys, key)
+			updates.updates[key] = u
+		}
+	}
+	var deletes []*gpb.Path
+	for _, key := range v.keys {
+		if _, ok := next.updates[key]; !ok {
+			deletes = append(deletes, v.updates[key].GetPath())
+		}
+	}
+	return updates, deletes
+}
+
+// dataParent returns the schema node of the parent of the data nodes
+// of schema node e, a module's entry for top-level nodes, or nil if e
+// is nil.
+func dataParent(e *yang.Entry) *yang.Entry {
+	if e == nil {
+		return nil
+	}
+	p := e.Parent
+	for p != nil && (p.IsChoice() || p.IsCase()) {
+		p = p.Parent
+	}
+	return p
+}
@@ -0,0 +1,131 @@
+/*
+Package log is the interface of the leveled, structured loggers
+accepted by the datastores, decoders, module collections and
+transports, reporting events which are otherwise not returned to the
+caller, such as data skipped while decoding or connections failing
+their handshake.
+
+Messages have fields given as alternating keys and values:
+
+	l := log.NewStd(stdlog.New(os.Stderr, "", stdlog.LstdFlags), log.LevelInfo)
+	ds := datastore.New(datastore.Running, c, datastore.WithLogger(l))
+	...
+	log.Warn(l, "module not imported", "path", path, "error", err)
+
+Components with no logger configured use Nop.
+*/
+package log
+
+import (
+	"fmt"
+	stdlog "log"
+	"strings"
+)
+
+// Level is the severity of a message.
+type Level int
+
+// The levels of messages, in increasing severity. Their values are
+// those of the levels of the standard library's log/slog package.
+const (
+	// LevelDebug is the level of messages describing the normal
+	// operation of a component in detail.
+	LevelDebug Level = -4
+	// LevelInfo is the level of messages about notable events, such
+	// as the start and end of sessions.
+	LevelInfo Level = 0
+	// LevelWarn is the level of messages about errors which are
+	// recovered from, such as input ignored.
+	LevelWarn Level = 4
+	// LevelError is the level of messages about errors a component
+	// does not recover from.
+	LevelError Level = 8
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	}
+	return fmt.Sprintf("level(%d)", int(l))
+}
+
+// Logger logs messages with a level and structured fields, given as
+// alternating keys and values.
+type Logger interface {
+	// Log logs the message msg at the level with the fields keyvals,
+	// after those of the logger.
+	Log(level Level, msg string, keyvals ...interface{})
+	// With returns a logger adding the fields keyvals to each
+	// message.
+	With(keyvals ...interface{}) Logger
+}
+
+// Debug logs the message msg with the fields keyvals at LevelDebug.
+func Debug(l Logger, msg string, keyvals ...interface{}) { l.Log(LevelDebug, msg, keyvals...) }
+
+// Info logs the message msg with the fields keyvals at LevelInfo.
+func Info(l Logger, msg string, keyvals ...interface{}) { l.Log(LevelInfo, msg, keyvals...) }
+
+// Warn logs the message msg with the fields keyvals at LevelWarn.
+func Warn(l Logger, msg string, keyvals ...interface{}) { l.Log(LevelWarn, msg, keyvals...) }
+
+// Error logs the message msg with the fields keyvals at LevelError.
+func Error(l Logger, msg string, keyvals ...interface{}) { l.Log(LevelError, msg, keyvals...) }
+
+// Nop returns a Logger discarding all messages.
+func Nop() Logger { return nop{} }
+
+type nop struct{}
+
+func (nop) Log(Level, string, ...interface{}) {}
+func (l nop) With(...interface{}) Logger      { return l }
+
+// OrNop returns l, or Nop() if l is nil.
+func OrNop(l Logger) Logger {
+	if l == nil {
+		return Nop()
+	}
+	return l
+}
+
+// NewStd returns a Logger writing each message at or above the level
+// min to l, as a line of the level, the message and its fields,
+// formatted key=value.
+func NewStd(l *stdlog.Logger, min Level) Logger { return &std{l: l, min: min} }
+
+type std struct {
+	l       *stdlog.Logger
+	min     Level
+	keyvals []interface{}
+}
+
+func (s *std) Log(level Level, msg string, keyvals ...interface{}) {
+	if level < s.min {
+		return
+	}
+	var b strings.Builder
+	b.WriteString(level.String())
+	b.WriteByte(' ')
+	b.WriteString(msg)
+	for _, kvs := range [][]interface{}{s.keyvals, keyvals} {
+		for i := 0; i < len(kvs); i += 2 {
+			var v interface{} = "(missing)"
+			if i+1 < len(kvs) {
+				v = kvs[i+1]
+			}
+			fmt.Fprintf(&b, " %v=%v", kvs[i], v)
+		}
+	}
+	s.l.Print(b.String())
+}
+
+func (s *std) With(keyvals ...interface{}) Logger {
+	return &std{l: s.l, min: s.min, keyvals: append(s.keyvals[:len(s.keyvals):len(s.keyvals)], keyvals...)}
+}
@@ -0,0 +1,37 @@
+package log
+
+import (
+	"bytes"
+	stdlog "log"
+	"testing"
+)
+
+func TestStd(t *testing.T) {
+	var b bytes.Buffer
+	l := NewStd(stdlog.New(&b, "", 0), LevelInfo).With("datastore", "running")
+	Debug(l, "not logged")
+	Info(l, "commit", "generation", 2)
+	Warn(l.With("session-id", 1), "skipped", "error")
+	Error(l, "failed")
+	want := "info commit datastore=running generation=2\n" +
+		"warn skipped datastore=running session-id=1 error=(missing)\n" +
+		"error failed datastore=running\n"
+	if b.String() != want {
+		t.Errorf("logged\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+func TestNop(t *testing.T) {
+	Error(OrNop(nil).With("k", "v"), "discarded")
+	if l := NewStd(stdlog.New(&bytes.Buffer{}, "", 0), LevelWarn); OrNop(l) != l {
+		t.Error("OrNop() of a logger did not return it")
+	}
+}
+
+func TestLevel_String(t *testing.T) {
+	for l, want := range map[Level]string{LevelDebug: "debug", LevelInfo: "info", LevelWarn: "warn", LevelError: "error", 2: "level(2)"} {
+		if got := l.String(); got != want {
+			t.Errorf("Level(%d).String() = %q, want %q", int(l), got, want)
+		}
+	}
+}
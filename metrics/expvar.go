@@ -0,0 +1,229 @@
+package metrics
+
+import (
+	"encoding/json"
+	"expvar"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Expvar is a Registry whose metrics are reported as a JSON object,
+// implementing expvar.Var. Each metric is keyed by its name and
+// labels in the Prometheus text format, such as
+// `rpc_requests_total{operation="get"}`. Counters and gauges report
+// their value, and histograms an object of their count, sum and
+// cumulative bucket counts.
+type Expvar struct {
+	mu      sync.RWMutex
+	metrics map[string]interface{}
+}
+
+// NewExpvar returns a new, empty Expvar registry. It is published with
+// expvar.Publish.
+func NewExpvar() *Expvar {
+	return &Expvar{metrics: map[string]interface{}{}}
+}
+
+var (
+	defaultOnce sync.Once
+	defaultReg  *Expvar
+)
+
+// Default returns the process' Expvar registry, published as the
+// expvar variable "opr8" on first use.
+func Default() *Expvar {
+	defaultOnce.Do(func() {
+		defaultReg = NewExpvar()
+		expvar.Publish("opr8", defaultReg)
+	})
+	return defaultReg
+}
+
+// Counter returns the counter with the name and labels.
+func (e *Expvar) Counter(name, help string, labels ...string) Counter {
+	return e.get(name, labels, func() interface{} { return &float{} }).(*float)
+}
+
+// Gauge returns the gauge with the name and labels.
+func (e *Expvar) Gauge(name, help string, labels ...string) Gauge {
+	return e.get(name, labels, func() interface{} { return &float{} }).(*float)
+}
+
+// Histogram returns the histogram with the name and labels.
+func (e *Expvar) Histogram(name, help string, buckets []float64, labels ...string) Histogram {
+	return e.get(name, labels, func() interface{} { return newHistogram(buckets) }).(*histogram)
+}
+
+// get returns the metric with the name and labels, made by create if
+// there is none.
+func (e *Expvar) get(name string, labels []string, create func() interface{}) interface{} {
+	key := Key(name, labels...)
+	e.mu.RLock()
+	m, ok := e.metrics[key]
+	e.mu.RUnlock()
+	if ok {
+		return m
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if m, ok := e.metrics[key]; ok {
+		return m
+	}
+	m = create()
+	e.metrics[key] = m
+	return m
+}
+
+// Value returns the value of the counter or gauge with the key, and
+// true, or false if there is none.
+func (e *Expvar) Value(key string) (float64, bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	f, ok := e.metrics[key].(*float)
+	if !ok {
+		return 0, false
+	}
+	return f.value(), true
+}
+
+// String returns the metrics as a JSON object, sorted by key.
+func (e *Expvar) String() string {
+	e.mu.RLock()
+	keys := make([]string, 0, len(e.metrics))
+	metrics := make(map[string]interface{}, len(e.metrics))
+	for key, m := range e.metrics {
+		keys = append(keys, key)
+		metrics[key] = m
+	}
+	e.mu.RUnlock()
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, key := range keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		k, _ := json.Marshal(key)
+		b.Write(k)
+		b.WriteByte(':')
+		switch m := metrics[key].(type) {
+		case *float:
+			b.WriteString(formatFloat(m.value()))
+		case *histogram:
+			b.WriteString(m.String())
+		}
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// Key returns the key of the metric with the name and labels, given
+// as alternating names and values, in the Prometheus text format.
+func Key(name string, labels ...string) string {
+	if len(labels) == 0 {
+		return name
+	}
+	var b strings.Builder
+	b.WriteString(name)
+	b.WriteByte('{')
+	for i := 0; i < len(labels); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		value := ""
+		if i+1 < len(labels) {
+			value = labels[i+1]
+		}
+		b.WriteString(labels[i])
+		b.WriteByte('=')
+		b.WriteString(strconv.Quote(value))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// formatFloat formats f as a JSON number, or null if it is not finite.
+func formatFloat(f float64) string {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return "null"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// float is a counter and gauge, its value stored as the bits of a
+// float64, accessed atomically.
+type float struct{ bits uint64 }
+
+func (f *float) value() float64 { return math.Float64frombits(atomic.LoadUint64(&f.bits)) }
+
+func (f *float) Set(value float64) { atomic.StoreUint64(&f.bits, math.Float64bits(value)) }
+
+func (f *float) Add(delta float64) {
+	for {
+		old := atomic.LoadUint64(&f.bits)
+		if atomic.CompareAndSwapUint64(&f.bits, old, math.Float64bits(math.Float64frombits(old)+delta)) {
+			return
+		}
+	}
+}
+
+// histogram is a histogram, its observations counted in the bucket
+// of the least upper bound not below them.
+type histogram struct {
+	bounds []float64
+
+	mu     sync.Mutex
+	counts []uint64 // the last counts observations above all bounds
+	count  uint64
+	sum    float64
+}
+
+func newHistogram(buckets []float64) *histogram {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	return &histogram{bounds: buckets, counts: make([]uint64, len(buckets)+1)}
+}
+
+func (h *histogram) Observe(value float64) {
+	i := sort.SearchFloat64s(h.bounds, value)
+	h.mu.Lock()
+	h.counts[i]++
+	h.count++
+	h.sum += value
+	h.mu.Unlock()
+}
+
+// String returns the histogram as a JSON object of its count, sum and
+// cumulative bucket counts keyed by upper bound.
+func (h *histogram) String() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var b strings.Builder
+	b.WriteString(`{"count":`)
+	b.WriteString(strconv.FormatUint(h.count, 10))
+	b.WriteString(`,"sum":`)
+	b.WriteString(formatFloat(h.sum))
+	b.WriteString(`,"buckets":{`)
+	var cumulative uint64
+	for i, bound := range h.bounds {
+		cumulative += h.counts[i]
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(strconv.Quote(strconv.FormatFloat(bound, 'g', -1, 64)))
+		b.WriteByte(':')
+		b.WriteString(strconv.FormatUint(cumulative, 10))
+	}
+	b.WriteString(`}}`)
+	return b.String()
+}
+
+var (
+	_ Registry   = &Expvar{}
+	_ expvar.Var = &Expvar{}
+)
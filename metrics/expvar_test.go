@@ -0,0 +1,59 @@
+package metrics
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestExpvar(t *testing.T) {
+	r := NewExpvar()
+	r.Counter("requests_total", "", "operation", "get").Add(1)
+	r.Counter("requests_total", "", "operation", "get").Add(2)
+	r.Counter("requests_total", "", "operation", "lock").Add(1)
+	g := r.Gauge("sessions", "")
+	g.Add(3)
+	g.Add(-1)
+	h := r.Histogram("latency_seconds", "", []float64{0.5, 1})
+	for _, v := range []float64{0.25, 0.5, 0.75, 2} {
+		h.Observe(v)
+	}
+	ObserveSince(r.Histogram("elapsed_seconds", "", nil), time.Now())
+
+	for key, want := range map[string]float64{
+		`requests_total{operation="get"}`:  3,
+		`requests_total{operation="lock"}`: 1,
+		`sessions`:                         2,
+	} {
+		if got, ok := r.Value(key); !ok || got != want {
+			t.Errorf("Value(%s) = %v, %v, want %v", key, got, ok, want)
+		}
+	}
+
+	var got map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(r.String()), &got); err != nil {
+		t.Fatalf("String() is not JSON: %v\n%s", err, r.String())
+	}
+	if s := string(got["latency_seconds"]); s != `{"count":4,"sum":3.5,"buckets":{"0.5":2,"1":3}}` {
+		t.Errorf("latency_seconds = %s", s)
+	}
+	if len(got) != 5 {
+		t.Errorf("String() has %d metrics, want 5", len(got))
+	}
+}
+
+func TestKey(t *testing.T) {
+	for _, tc := range []struct {
+		labels []string
+		want   string
+	}{
+		{nil, "m"},
+		{[]string{"a", "x"}, `m{a="x"}`},
+		{[]string{"a", "x", "b", `"`}, `m{a="x",b="\""}`},
+		{[]string{"a"}, `m{a=""}`},
+	} {
+		if got := Key("m", tc.labels...); got != tc.want {
+			t.Errorf("Key(m, %q) = %s, want %s", tc.labels, got, tc.want)
+		}
+	}
+}
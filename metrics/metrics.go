@@ -0,0 +1,86 @@
+/*
+Package metrics is the interface of the counters, gauges and
+histograms reported by the session manager, transports, datastores and
+the RPC dispatcher, with an implementation publishing them with
+expvar. The prometheus subpackage adapts a Prometheus registerer.
+
+Metrics are found by name and labels, given as alternating label names
+and values, and created on first use:
+
+	r := metrics.NewExpvar()
+	expvar.Publish("opr8", r)
+	mgr := session.NewManager(session.WithMetrics(r))
+	...
+	r.Counter("rpc_requests_total", "RPC requests handled.", "operation", "get").Add(1)
+
+Each use of a name must have the same label names, in the same order.
+Components with no registry configured use Discard.
+*/
+package metrics
+
+import "time"
+
+// Counter is a metric whose value only increases.
+type Counter interface {
+	// Add adds delta, which must not be negative, to the value.
+	Add(delta float64)
+}
+
+// Gauge is a metric whose value goes up and down.
+type Gauge interface {
+	// Set sets the value.
+	Set(value float64)
+	// Add adds delta to the value.
+	Add(delta float64)
+}
+
+// Histogram is a metric counting observations in buckets.
+type Histogram interface {
+	// Observe adds an observation of value.
+	Observe(value float64)
+}
+
+// Registry finds and creates metrics. It is safe for concurrent use.
+type Registry interface {
+	// Counter returns the counter with the name and labels, given
+	// as alternating names and values, described by help.
+	Counter(name, help string, labels ...string) Counter
+	// Gauge returns the gauge with the name and labels.
+	Gauge(name, help string, labels ...string) Gauge
+	// Histogram returns the histogram with the name and labels,
+	// counting observations in the buckets, upper bounds in
+	// increasing order. DefaultBuckets are used if buckets is nil.
+	Histogram(name, help string, buckets []float64, labels ...string) Histogram
+}
+
+// DefaultBuckets are the default histogram buckets, suited to
+// latencies in seconds.
+var DefaultBuckets = []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// ObserveSince observes the seconds elapsed since start with h, such
+// as the latency of an operation.
+func ObserveSince(h Histogram, start time.Time) {
+	h.Observe(time.Since(start).Seconds())
+}
+
+// Discard returns a Registry whose metrics discard their values.
+func Discard() Registry { return discard{} }
+
+type discard struct{}
+
+func (discard) Counter(string, string, ...string) Counter { return discard{} }
+func (discard) Gauge(string, string, ...string) Gauge     { return discard{} }
+func (discard) Histogram(string, string, []float64, ...string) Histogram {
+	return discard{}
+}
+func (discard) Add(float64)     {}
+func (discard) Set(float64)     {}
+func (discard) Observe(float64) {}
+
+// OrDiscard returns r, or Discard() if r is nil.
+func OrDiscard(r Registry) Registry {
+	if r == nil {
+		return Discard()
+	}
+	return r
+}
@@ -0,0 +1,115 @@
+/*
+Package prometheus adapts a Prometheus registerer to the
+metrics.Registry interface, so the metrics of the session manager,
+transports, datastores and RPC dispatcher are exported to Prometheus:
+
+	r := prometheus.New(prom.DefaultRegisterer, "opr8")
+	srv, err := server.New(server.Config{Metrics: r, ...})
+	http.Handle("/metrics", promhttp.Handler())
+*/
+package prometheus
+
+import (
+	"sync"
+
+	"github.com/andaru/opr8/metrics"
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+// Registry is a metrics.Registry registering a Prometheus vector for
+// each metric name, with the label names of its first use.
+type Registry struct {
+	reg       prom.Registerer
+	namespace string
+
+	mu      sync.Mutex
+	vectors map[string]prom.Collector
+}
+
+// New returns a Registry registering metrics with reg, their names
+// prefixed by the namespace, if not empty, and an underscore.
+func New(reg prom.Registerer, namespace string) *Registry {
+	return &Registry{reg: reg, namespace: namespace, vectors: map[string]prom.Collector{}}
+}
+
+// Counter returns the counter with the name and labels.
+func (r *Registry) Counter(name, help string, labels ...string) metrics.Counter {
+	names, values := split(labels)
+	v := r.vector(name, func() prom.Collector {
+		return prom.NewCounterVec(prom.CounterOpts{Namespace: r.namespace, Name: name, Help: help}, names)
+	})
+	if cv, ok := v.(*prom.CounterVec); ok {
+		if c, err := cv.GetMetricWithLabelValues(values...); err == nil {
+			return c
+		}
+	}
+	return metrics.Discard().Counter(name, help)
+}
+
+// Gauge returns the gauge with the name and labels.
+func (r *Registry) Gauge(name, help string, labels ...string) metrics.Gauge {
+	names, values := split(labels)
+	v := r.vector(name, func() prom.Collector {
+		return prom.NewGaugeVec(prom.GaugeOpts{Namespace: r.namespace, Name: name, Help: help}, names)
+	})
+	if gv, ok := v.(*prom.GaugeVec); ok {
+		if g, err := gv.GetMetricWithLabelValues(values...); err == nil {
+			return g
+		}
+	}
+	return metrics.Discard().Gauge(name, help)
+}
+
+// Histogram returns the histogram with the name and labels.
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) metrics.Histogram {
+	if buckets == nil {
+		buckets = metrics.DefaultBuckets
+	}
+	names, values := split(labels)
+	v := r.vector(name, func() prom.Collector {
+		return prom.NewHistogramVec(prom.HistogramOpts{Namespace: r.namespace, Name: name, Help: help, Buckets: buckets}, names)
+	})
+	if hv, ok := v.(*prom.HistogramVec); ok {
+		if h, err := hv.GetMetricWithLabelValues(values...); err == nil {
+			return h
+		}
+	}
+	return metrics.Discard().Histogram(name, help, nil)
+}
+
+// vector returns the vector of the metric name, made by create and
+// registered if there is none. A vector already registered with the
+// registerer, such as by another Registry, is used in its place.
+func (r *Registry) vector(name string, create func() prom.Collector) prom.Collector {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if v, ok := r.vectors[name]; ok {
+		return v
+	}
+	v := create()
+	if err := r.reg.Register(v); err != nil {
+		are, ok := err.(prom.AlreadyRegisteredError)
+		if !ok {
+			return nil
+		}
+		v = are.ExistingCollector
+	}
+	r.vectors[name] = v
+	return v
+}
+
+// split returns the names and values of the alternating label names
+// and values.
+func split(labels []string) (names, values []string) {
+	for i := 0; i < len(labels); i += 2 {
+		names = append(names, labels[i])
+		if i+1 < len(labels) {
+			values = append(values, labels[i+1])
+		} else {
+			values = append(values, "")
+		}
+	}
+	return names, values
+}
+
+var _ metrics.Registry = &Registry{}
@@ -0,0 +1,119 @@
+package modules
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// maxArchiveEntrySize is the largest YANG file read from an archive.
+const maxArchiveEntrySize = 16 << 20
+
+// ImportArchive reads the YANG modules and submodules in the archive
+// r of size bytes, a .zip, .tar or .tar.gz file such as a vendor's
+// YANG bundle. Files with the .yang extension are read from all
+// directories of the archive; other files, and hidden files and
+// directories such as __MACOSX, are skipped. Errors reading
+// individual files are returned, as by ImportAll. Process must be
+// called before calls to ModuleEntry after this returns.
+func (c *Collection) ImportArchive(r io.ReaderAt, size int64) []error {
+	var magic [4]byte
+	if n, _ := r.ReadAt(magic[:], 0); n < len(magic) {
+		return []error{errors.New("archive too short")}
+	}
+	switch {
+	case bytes.Equal(magic[:], []byte("PK\x03\x04")):
+		return c.importZip(r, size)
+	case magic[0] == 0x1f && magic[1] == 0x8b:
+		gz, err := gzip.NewReader(io.NewSectionReader(r, 0, size))
+		if err != nil {
+			return []error{errors.Wrap(err, "invalid gzip archive")}
+		}
+		defer gz.Close()
+		return c.importTar(gz)
+	default:
+		var ustar [5]byte
+		if n, _ := r.ReadAt(ustar[:], 257); n == len(ustar) && string(ustar[:]) == "ustar" {
+			return c.importTar(io.NewSectionReader(r, 0, size))
+		}
+	}
+	return []error{errors.New("unsupported archive format, want .zip, .tar or .tar.gz")}
+}
+
+func (c *Collection) importZip(r io.ReaderAt, size int64) []error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return []error{errors.Wrap(err, "invalid zip archive")}
+	}
+	var errs []error
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() || !isArchiveYANGFile(f.Name) {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			errs = append(errs, importError{f.Name, err.Error()})
+			continue
+		}
+		err = c.importArchiveFile(f.Name, rc)
+		_ = rc.Close()
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+func (c *Collection) importTar(r io.Reader) []error {
+	tr := tar.NewReader(r)
+	var errs []error
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return errs
+		} else if err != nil {
+			return append(errs, errors.Wrap(err, "invalid tar archive"))
+		}
+		if hdr.Typeflag != tar.TypeReg || !isArchiveYANGFile(hdr.Name) {
+			continue
+		}
+		if err := c.importArchiveFile(hdr.Name, tr); err != nil {
+			errs = append(errs, err)
+		}
+	}
+}
+
+// importArchiveFile parses the YANG file named name read from r.
+func (c *Collection) importArchiveFile(name string, r io.Reader) error {
+	data, err := ioutil.ReadAll(io.LimitReader(r, maxArchiveEntrySize+1))
+	if err != nil {
+		return importError{name, err.Error()}
+	} else if len(data) > maxArchiveEntrySize {
+		return importError{name, "file too large"}
+	}
+	if err := c.parse(string(data), name); err != nil {
+		return importError{name, err.Error()}
+	}
+	return nil
+}
+
+// isArchiveYANGFile returns true if the archive file name is a YANG
+// file outside of any hidden directory.
+func isArchiveYANGFile(name string) bool {
+	if path.Ext(name) != ".yang" {
+		return false
+	}
+	for _, elem := range strings.Split(path.Clean(name), "/") {
+		if strings.HasPrefix(elem, ".") || strings.HasPrefix(elem, "__") {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,119 @@
+package modules
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"testing"
+)
+
+var archiveFiles = []struct{ name, data string }{
+	{"vendor/", ""},
+	{"vendor/README.md", "not yang"},
+	{"vendor/common/vendor-types.yang", `module vendor-types {
+  namespace "urn:vendor:types";
+  prefix vt;
+  typedef name { type string; }
+}`},
+	{"vendor/models/deep/vendor-system.yang", `module vendor-system {
+  namespace "urn:vendor:system";
+  prefix vs;
+  import vendor-types { prefix vt; }
+  container system { leaf name { type vt:name; } }
+}`},
+	{"__MACOSX/vendor/._vendor-system.yang", "\x00\x05\x16\x07"},
+	{"vendor/.hidden/broken.yang", "module broken {"},
+}
+
+func zipArchive(t *testing.T) []byte {
+	var b bytes.Buffer
+	zw := zip.NewWriter(&b)
+	for _, f := range archiveFiles {
+		w, err := zw.Create(f.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(f.data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func tarArchive(t *testing.T, compress bool) []byte {
+	var b bytes.Buffer
+	var tw *tar.Writer
+	var gz *gzip.Writer
+	if compress {
+		gz = gzip.NewWriter(&b)
+		tw = tar.NewWriter(gz)
+	} else {
+		tw = tar.NewWriter(&b)
+	}
+	for _, f := range archiveFiles {
+		hdr := &tar.Header{Name: f.name, Mode: 0644, Size: int64(len(f.data)), Typeflag: tar.TypeReg}
+		if f.name[len(f.name)-1] == '/' {
+			hdr.Typeflag, hdr.Mode = tar.TypeDir, 0755
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(f.data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return b.Bytes()
+}
+
+func TestCollection_ImportArchive(t *testing.T) {
+	tests := []struct {
+		name    string
+		archive func(t *testing.T) []byte
+		wantErr bool
+	}{
+		{"zip", zipArchive, false},
+		{"tar", func(t *testing.T) []byte { return tarArchive(t, false) }, false},
+		{"tar.gz", func(t *testing.T) []byte { return tarArchive(t, true) }, false},
+		{"unsupported", func(t *testing.T) []byte { return []byte("module foo {}") }, true},
+		{"truncated gzip", func(t *testing.T) []byte { return tarArchive(t, true)[:20] }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetYANGPath()
+			c := NewCollection()
+			data := tt.archive(t)
+			errs := c.ImportArchive(bytes.NewReader(data), int64(len(data)))
+			if (len(errs) > 0) != tt.wantErr {
+				t.Fatalf("Collection.ImportArchive() = %v, wantErr %v", errs, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if errs := c.Process(); errs != nil {
+				t.Fatalf("Collection.Process() = %v", errs)
+			}
+			if got := c.ModulesLen(); got != 2 {
+				t.Errorf("Collection.ModulesLen() = %d, want 2", got)
+			}
+			e, err := c.ModuleEntry("vendor-system")
+			if err != nil {
+				t.Fatalf("Collection.ModuleEntry() error = %v", err)
+			}
+			if leaf := e.Dir["system"].Dir["name"]; leaf == nil || leaf.Type.Name != "name" {
+				t.Errorf("vendor-system typedef not resolved from vendor-types")
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package modules
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"sort"
+
+	"github.com/openconfig/goyang/pkg/yang"
+)
+
+// Fingerprint returns a hash of the YANG source of the modules and
+// submodules read by the collection, which changes only when modules
+// are added or removed. Formatting and comments in the source are not
+// included. The source of each module is hashed once, when the
+// collection is first fingerprinted after the module is read.
+//
+// The fingerprint keys the schema entries built by Process: they are
+// used again while the fingerprint is unchanged, as when ImportAll is
+// called again with the same YANG path, and Watch keeps them when the
+// YANG files change but the modules read from them do not.
+func (c *Collection) Fingerprint() string { return c.current().hash() }
+
+// hash returns the fingerprint of the modules.
+func (s *schema) hash() string {
+	h := sha256.New()
+	for _, mods := range []map[string]*yang.Module{s.ms.Modules, s.ms.SubModules} {
+		for _, name := range fullNames(mods) {
+			io.WriteString(h, name+"\n")
+			h.Write(s.digest(mods[name]))
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// digest returns the hash of the source statements of the module mod.
+func (s *schema) digest(mod *yang.Module) []byte {
+	s.mu.Lock()
+	d, ok := s.digests[mod]
+	s.mu.Unlock()
+	if ok {
+		return d
+	}
+	h := sha256.New()
+	if mod.Source != nil {
+		_ = mod.Source.Write(h, "")
+	}
+	d = h.Sum(nil)
+	s.mu.Lock()
+	if s.digests == nil {
+		s.digests = map[*yang.Module][]byte{}
+	}
+	s.digests[mod] = d
+	s.mu.Unlock()
+	return d
+}
+
+// fullNames returns the sorted full names of the modules mods. Modules
+// are found both by name and by name@revision, so duplicates are
+// skipped.
+func fullNames(mods map[string]*yang.Module) []string {
+	names := make([]string, 0, len(mods))
+	for name, mod := range mods {
+		if name == mod.FullName() {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
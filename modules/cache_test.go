@@ -0,0 +1,82 @@
+package modules
+
+import (
+	"testing"
+)
+
+func TestCollection_Fingerprint(t *testing.T) {
+	SetYANGPath("testdata")
+	a, b := NewCollection(), NewCollection()
+	for _, c := range []*Collection{a, b} {
+		if errs := c.ImportAll(); errs != nil {
+			t.Fatalf("Collection.ImportAll() = %v", errs)
+		}
+	}
+	if a.Fingerprint() != b.Fingerprint() {
+		t.Errorf("Collection.Fingerprint() differs for the same modules")
+	}
+	if errs := a.Process(); errs != nil {
+		t.Fatalf("Collection.Process() = %v", errs)
+	}
+	before, err := a.ModuleEntry("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// reading the same modules again does not require processing
+	fingerprint := a.Fingerprint()
+	if got, want := len(a.s.digests), len(fullNames(a.s.ms.Modules))+len(fullNames(a.s.ms.SubModules)); got != want {
+		t.Errorf("Collection.Fingerprint() hashed %d module sources, want %d", got, want)
+	}
+	a.ImportAll()
+	if got := a.Fingerprint(); got != fingerprint {
+		t.Errorf("Collection.Fingerprint() after ImportAll = %s, want %s", got, fingerprint)
+	}
+	if errs := a.Process(); errs != nil {
+		t.Fatalf("Collection.Process() = %v", errs)
+	}
+	if after, _ := a.ModuleEntry("test"); after != before {
+		t.Error("Collection.Process() rebuilt the schema of unchanged modules")
+	}
+
+	// new modules change the fingerprint, and are processed
+	if err := a.ReadString("other", `module other { namespace urn:other; prefix o; leaf x { type string; } }`); err != nil {
+		t.Fatal(err)
+	}
+	if a.Fingerprint() == fingerprint {
+		t.Error("Collection.Fingerprint() unchanged after ReadString")
+	}
+	if errs := a.Process(); errs != nil {
+		t.Fatalf("Collection.Process() = %v", errs)
+	}
+	if _, err := a.ModuleEntry("other"); err != nil {
+		t.Errorf("Collection.ModuleEntry() = %v", err)
+	}
+}
+
+func BenchmarkProcess(b *testing.B) {
+	SetYANGPath("../yang_modules/ietf/RFC/...")
+	b.Run("new", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			c := NewCollection()
+			c.ImportAll()
+			b.StartTimer()
+			if errs := c.Process(); errs != nil {
+				b.Fatalf("Collection.Process() = %v", errs)
+			}
+		}
+	})
+	b.Run("unchanged", func(b *testing.B) {
+		c := NewCollection()
+		c.ImportAll()
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			c.ImportAll()
+			b.StartTimer()
+			if errs := c.Process(); errs != nil {
+				b.Fatalf("Collection.Process() = %v", errs)
+			}
+		}
+	})
+}
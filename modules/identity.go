@@ -0,0 +1,192 @@
+package modules
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/openconfig/goyang/pkg/yang"
+)
+
+// Identity is a YANG identity defined by a module of the collection.
+type Identity struct {
+	// Module is the name of the module defining the identity, or
+	// that the defining submodule belongs to.
+	Module string
+	// Name is the identity's name.
+	Name string
+	// Bases are the qualified names of the identity's direct bases,
+	// e.g., "iana-if-type:iana-interface-type".
+	Bases []string
+	// Node is the identity statement.
+	Node *yang.Identity
+}
+
+// String returns the qualified name of the identity, in the form
+// "module:name" used by YANG/JSON.
+func (id Identity) String() string { return id.Module + ":" + id.Name }
+
+// identityGraph is the identity derivation graph of a collection.
+type identityGraph struct {
+	ids map[string]*Identity
+	// derived maps qualified names to those of the identities
+	// directly derived from them
+	derived map[string][]string
+}
+
+// Identities returns the identities derived, directly or indirectly,
+// from the identity base, or all identities of the collection if base
+// is empty, sorted by qualified name. The base is named as in
+// DerivedFrom. Identities of all modules are included, as may be
+// derived from base in the modules of other organizations.
+func (c *Collection) Identities(base string) []Identity {
+	g := c.current().identities()
+	var names []string
+	if base == "" {
+		for name := range g.ids {
+			names = append(names, name)
+		}
+	} else if root := g.lookup(base); root != nil {
+		seen := map[string]bool{}
+		var walk func(string)
+		walk = func(name string) {
+			for _, d := range g.derived[name] {
+				if !seen[d] {
+					seen[d] = true
+					names = append(names, d)
+					walk(d)
+				}
+			}
+		}
+		walk(root.String())
+	}
+	sort.Strings(names)
+	ids := make([]Identity, 0, len(names))
+	for _, name := range names {
+		ids = append(ids, *g.ids[name])
+	}
+	return ids
+}
+
+// Identity returns the identity named name, as in DerivedFrom, and
+// true, or false if there is no such identity.
+func (c *Collection) Identity(name string) (Identity, bool) {
+	if id := c.current().identities().lookup(name); id != nil {
+		return *id, true
+	}
+	return Identity{}, false
+}
+
+// DerivedFrom returns true if the identity named identity is derived,
+// directly or indirectly, from the identity named base, per the XPath
+// derived-from() function. Identities are named by qualified name,
+// e.g., "ietf-interfaces:interface-type", or by name alone if only one
+// module of the collection defines an identity of that name.
+func (c *Collection) DerivedFrom(identity, base string) bool {
+	g := c.current().identities()
+	id, root := g.lookup(identity), g.lookup(base)
+	if id == nil || root == nil {
+		return false
+	}
+	seen := map[string]bool{}
+	var derived func(*Identity) bool
+	derived = func(id *Identity) bool {
+		for _, b := range id.Bases {
+			if b == root.String() {
+				return true
+			}
+			if next := g.ids[b]; next != nil && !seen[b] {
+				seen[b] = true
+				if derived(next) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	return derived(id)
+}
+
+// lookup returns the identity named name, or nil if there is no such
+// identity, or more than one when name is unqualified.
+func (g *identityGraph) lookup(name string) *Identity {
+	if strings.IndexByte(name, ':') >= 0 {
+		return g.ids[name]
+	}
+	var found *Identity
+	for _, id := range g.ids {
+		if id.Name == name {
+			if found != nil {
+				return nil
+			}
+			found = id
+		}
+	}
+	return found
+}
+
+// identities returns the identity graph of the schema, built on first
+// use after Process.
+func (s *schema) identities() *identityGraph {
+	s.mu.Lock()
+	g := s.identityGraph
+	s.mu.Unlock()
+	if g != nil {
+		return g
+	}
+
+	g = &identityGraph{ids: map[string]*Identity{}, derived: map[string][]string{}}
+	add := func(owner string, mod *yang.Module) {
+		for _, yid := range mod.Identity {
+			id := &Identity{Module: owner, Name: yid.Name, Node: yid}
+			if yid.Source != nil {
+				for _, st := range yid.Source.SubStatements() {
+					if st.Keyword == "base" {
+						id.Bases = append(id.Bases, qualifiedIdentity(yid, owner, st.Argument))
+					}
+				}
+			} else if yid.Base != nil {
+				id.Bases = append(id.Bases, qualifiedIdentity(yid, owner, yid.Base.Name))
+			}
+			g.ids[id.String()] = id
+		}
+	}
+	for _, mod := range s.latest() {
+		add(mod.Name, mod)
+		for _, inc := range mod.Include {
+			if inc.Module != nil {
+				add(mod.Name, inc.Module)
+			}
+		}
+	}
+	for name, id := range g.ids {
+		for _, b := range id.Bases {
+			g.derived[b] = append(g.derived[b], name)
+		}
+	}
+
+	if s.processed {
+		s.mu.Lock()
+		s.identityGraph = g
+		s.mu.Unlock()
+	}
+	return g
+}
+
+// qualifiedIdentity returns the qualified name of the identity named
+// by the base statement argument base of the identity id, defined in
+// the module owner.
+func qualifiedIdentity(id *yang.Identity, owner, base string) string {
+	i := strings.IndexByte(base, ':')
+	if i < 0 {
+		return owner + ":" + base
+	}
+	prefix, name := base[:i], base[i+1:]
+	mod := yang.FindModuleByPrefix(id, prefix)
+	if mod == nil {
+		return base
+	}
+	if mod.BelongsTo != nil {
+		return mod.BelongsTo.Name + ":" + name
+	}
+	return mod.Name + ":" + name
+}
@@ -0,0 +1,89 @@
+package modules
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCollection_Identities(t *testing.T) {
+	c := NewCollection()
+	for name, src := range map[string]string{
+		"base": `module base {
+  yang-version 1.1;
+  namespace urn:base; prefix b;
+  identity link-type;
+  identity ethernet { base link-type; }
+  identity fast-ethernet { base ethernet; }
+  identity media;
+  identity copper { base media; }
+}`,
+		"vendor": `module vendor {
+  yang-version 1.1;
+  namespace urn:vendor; prefix v;
+  import base { prefix bt; }
+  identity vendor-ethernet { base bt:fast-ethernet; }
+  identity twisted-pair { base bt:copper; }
+  identity ethernet { base bt:media; }
+}`,
+	} {
+		if err := c.s.ms.Parse(src, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if errs := c.Process(); errs != nil {
+		t.Fatalf("Collection.Process() = %v", errs)
+	}
+
+	names := func(ids []Identity) []string {
+		var s []string
+		for _, id := range ids {
+			s = append(s, id.String())
+		}
+		return s
+	}
+	for _, tt := range []struct {
+		base string
+		want []string
+	}{
+		{"base:link-type", []string{"base:ethernet", "base:fast-ethernet", "vendor:vendor-ethernet"}},
+		{"link-type", []string{"base:ethernet", "base:fast-ethernet", "vendor:vendor-ethernet"}},
+		{"base:media", []string{"base:copper", "vendor:ethernet", "vendor:twisted-pair"}},
+		{"vendor:vendor-ethernet", nil},
+		{"ethernet", nil}, // ambiguous
+		{"base:nope", nil},
+	} {
+		if got := names(c.Identities(tt.base)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Collection.Identities(%q) = %v, want %v", tt.base, got, tt.want)
+		}
+	}
+	if got := len(c.Identities("")); got != 8 {
+		t.Errorf("Collection.Identities(\"\") returned %d identities, want 8", got)
+	}
+	if got := c.Identities("vendor:twisted-pair"); len(got) != 0 {
+		t.Errorf("Collection.Identities() = %v, want none", got)
+	}
+	if id := c.Identities("base:media")[1]; id.String() != "vendor:ethernet" || !reflect.DeepEqual(id.Bases, []string{"base:media"}) {
+		t.Errorf("Collection.Identities() = %+v, want vendor:ethernet with base base:media", id)
+	}
+
+	for _, tt := range []struct {
+		identity, base string
+		want           bool
+	}{
+		{"base:ethernet", "base:link-type", true},
+		{"vendor:vendor-ethernet", "base:link-type", true},
+		{"vendor:twisted-pair", "copper", true},
+		{"vendor:twisted-pair", "base:media", true},
+		{"vendor:twisted-pair", "base:link-type", false},
+		{"base:link-type", "base:link-type", false},
+		{"base:link-type", "base:ethernet", false},
+		{"vendor:ethernet", "base:link-type", false},
+		{"vendor:ethernet", "base:media", true},
+		{"ethernet", "base:link-type", false},
+		{"base:nope", "base:link-type", false},
+	} {
+		if got := c.DerivedFrom(tt.identity, tt.base); got != tt.want {
+			t.Errorf("Collection.DerivedFrom(%q, %q) = %v, want %v", tt.identity, tt.base, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package modules
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/openconfig/goyang/pkg/yang"
+)
+
+// childIndex maps the local names of the data node children of a
+// schema node, including those within its choices and cases, to
+// their entries.
+type childIndex map[string]*yang.Entry
+
+// DataChild returns the data node child of the schema node e with
+// the local name provided, or nil if there is none. Data nodes within
+// the choices and cases of e, at any depth, are children of e.
+//
+// The children of each schema node are indexed on first use, so
+// lookups do not repeatedly walk the schema when decoding large
+// documents. The index is discarded by Process.
+func (c *Collection) DataChild(e *yang.Entry, local string) *yang.Entry {
+	return c.current().dataChild(e, local)
+}
+
+func (s *schema) dataChild(e *yang.Entry, local string) *yang.Entry {
+	if e == nil {
+		return nil
+	}
+	s.mu.Lock()
+	index, ok := s.children[e]
+	s.mu.Unlock()
+	if !ok {
+		index = childIndex{}
+		index.add(e)
+		s.mu.Lock()
+		if s.children == nil {
+			s.children = map[*yang.Entry]childIndex{}
+		}
+		s.children[e] = index
+		s.mu.Unlock()
+	}
+	return index[local]
+}
+
+func (index childIndex) add(e *yang.Entry) {
+	for name, ch := range e.Dir {
+		switch ch.Kind {
+		case yang.ChoiceEntry, yang.CaseEntry:
+			index.add(ch)
+		case yang.LeafEntry, yang.DirectoryEntry, yang.AnyXMLEntry, yang.AnyDataEntry:
+			index[name] = ch
+		}
+	}
+}
+
+// SchemaOrder returns the index of each data node child of the schema
+// node e in schema definition order, with list keys first. Children
+// defined by augmentation follow the others, in name order.
+//
+// Orders are built on first use and discarded by Process, as the
+// children indexed by DataChild are.
+func (c *Collection) SchemaOrder(e *yang.Entry) map[string]int {
+	s := c.current()
+	s.mu.Lock()
+	order, ok := s.orders[e]
+	s.mu.Unlock()
+	if ok {
+		return order
+	}
+
+	order = map[string]int{}
+	add := func(name string) {
+		if _, ok := order[name]; !ok {
+			order[name] = len(order)
+		}
+	}
+	if e.IsList() {
+		for _, key := range strings.Fields(e.Key) {
+			add(key)
+		}
+	}
+	if e.Node != nil && e.Node.Statement() != nil {
+		walkDataStatements(e.Node.Statement().SubStatements(), e.Node, add)
+	}
+	index := childIndex{}
+	index.add(e)
+	var rest []string
+	for name := range index {
+		if _, ok := order[name]; !ok {
+			rest = append(rest, name)
+		}
+	}
+	sort.Strings(rest)
+	for _, name := range rest {
+		add(name)
+	}
+
+	s.mu.Lock()
+	if s.orders == nil {
+		s.orders = map[*yang.Entry]map[string]int{}
+	}
+	s.orders[e] = order
+	s.mu.Unlock()
+	return order
+}
+
+// walkDataStatements calls add for each data definition statement
+// in stmts, descending into choices, cases and the groupings used.
+// Groupings are found in the scope of the node n.
+func walkDataStatements(stmts []*yang.Statement, n yang.Node, add func(string)) {
+	for _, s := range stmts {
+		switch s.Keyword {
+		case "container", "leaf", "leaf-list", "list", "anyxml", "anydata":
+			add(s.Argument)
+		case "choice", "case":
+			walkDataStatements(s.SubStatements(), n, add)
+		case "uses":
+			if g := yang.FindGrouping(n, s.Argument, map[string]bool{}); g != nil && g.Source != nil {
+				walkDataStatements(g.Source.SubStatements(), g, add)
+			}
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package modules
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	xml "github.com/andaru/flexml"
+	"github.com/andaru/opr8/dom"
+	"github.com/openconfig/goyang/pkg/yang"
+	"github.com/pkg/errors"
+)
+
+const (
+	// YangLibraryNamespace is the XML namespace of ietf-yang-library.
+	YangLibraryNamespace = "urn:ietf:params:xml:ns:yang:ietf-yang-library"
+	// DatastoresNamespace is the XML namespace of ietf-datastores,
+	// defining the datastore identities.
+	DatastoresNamespace = "urn:ietf:params:xml:ns:yang:ietf-datastores"
+
+	// yangLibrarySet is the name of the module set and schema
+	// describing the collection.
+	yangLibrarySet = "complete"
+)
+
+// libraryModule describes a module of the yang library.
+type libraryModule struct {
+	name, revision, namespace string
+	version                   string // yang-version, "1" or "1.1"
+	features, deviations      []string
+	submodules                [][2]string // name, revision
+}
+
+// YangLibrary returns the ietf-yang-library (RFC 8525) yang-library
+// container describing the collection, and its content-id, for
+// serving to NETCONF and RESTCONF clients. All modules of the
+// collection are reported as implemented in a single module set and
+// schema, which is used by each of the datastores named, e.g.,
+// "running", or by the running datastore if none are provided.
+//
+// Every feature defined by a module is reported as supported. The
+// content-id is a hash of the module set, and changes only when the
+// modules of the collection or their properties do.
+func (c *Collection) YangLibrary(datastores ...string) (dom.Element, string, error) {
+	s := c.current()
+	if !s.processed {
+		return nil, "", errors.New("must call Process first")
+	}
+	if len(datastores) == 0 {
+		datastores = []string{"running"}
+	}
+	mods := s.libraryModules()
+	contentID := libraryContentID(mods)
+
+	lib := dom.CreateElement(xml.StartElement{Name: xml.Name{Space: YangLibraryNamespace, Local: "yang-library"}})
+	set := appendLibraryElement(lib, "module-set", "")
+	appendLibraryElement(set, "name", yangLibrarySet)
+	for _, m := range mods {
+		mod := appendLibraryElement(set, "module", "")
+		appendLibraryElement(mod, "name", m.name)
+		if m.revision != "" {
+			appendLibraryElement(mod, "revision", m.revision)
+		}
+		appendLibraryElement(mod, "namespace", m.namespace)
+		for _, sub := range m.submodules {
+			submod := appendLibraryElement(mod, "submodule", "")
+			appendLibraryElement(submod, "name", sub[0])
+			if sub[1] != "" {
+				appendLibraryElement(submod, "revision", sub[1])
+			}
+		}
+		for _, feature := range m.features {
+			appendLibraryElement(mod, "feature", feature)
+		}
+		for _, deviation := range m.deviations {
+			appendLibraryElement(mod, "deviation", deviation)
+		}
+	}
+	schema := appendLibraryElement(lib, "schema", "")
+	appendLibraryElement(schema, "name", yangLibrarySet)
+	appendLibraryElement(schema, "module-set", yangLibrarySet)
+	for _, name := range datastores {
+		ds := appendLibraryElement(lib, "datastore", "")
+		dsName := dom.CreateElement(xml.StartElement{
+			Name: xml.Name{Space: YangLibraryNamespace, Local: "name"},
+			Attr: []xml.Attr{{Name: xml.Name{Space: "xmlns", Local: "ds"}, Value: DatastoresNamespace}},
+		})
+		_ = dsName.AppendChild(dom.CreateText(xml.CharData("ds:" + name)))
+		_ = ds.AppendChild(dsName)
+		appendLibraryElement(ds, "schema", yangLibrarySet)
+	}
+	appendLibraryElement(lib, "content-id", contentID)
+	return lib, contentID, nil
+}
+
+// libraryContentID returns the yang library content-id of the module
+// set mods.
+func libraryContentID(mods []*libraryModule) string {
+	h := sha256.New()
+	for _, m := range mods {
+		fmt.Fprintf(h, "%s@%s %s %q %q %q\n", m.name, m.revision, m.namespace, m.features, m.deviations, m.submodules)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// appendLibraryElement appends an ietf-yang-library element named
+// local to parent, with the text value, if not empty, and returns it.
+func appendLibraryElement(parent dom.Node, local, value string) dom.Node {
+	e := dom.CreateElement(xml.StartElement{Name: xml.Name{Space: YangLibraryNamespace, Local: local}})
+	if value != "" {
+		_ = e.AppendChild(dom.CreateText(xml.CharData(value)))
+	}
+	_ = parent.AppendChild(e)
+	return parent.LastChild()
+}
+
+// libraryModules returns the descriptions of the selected modules,
+// sorted by name.
+func (s *schema) libraryModules() []*libraryModule {
+	byName := map[string]*libraryModule{}
+	var names []string
+	for _, m := range s.latest() {
+		lm := &libraryModule{name: m.Name, revision: moduleRevision(m), version: "1"}
+		if m.YangVersion != nil && m.YangVersion.Name != "" {
+			lm.version = m.YangVersion.Name
+		}
+		if m.Namespace != nil {
+			lm.namespace = m.Namespace.Name
+		}
+		lm.features = moduleFeatures(m)
+		for _, inc := range m.Include {
+			if inc.Module != nil {
+				lm.submodules = append(lm.submodules, [2]string{inc.Module.Name, moduleRevision(inc.Module)})
+				lm.features = append(lm.features, moduleFeatures(inc.Module)...)
+			}
+		}
+		sort.Strings(lm.features)
+		byName[m.Name] = lm
+		names = append(names, m.Name)
+	}
+
+	// each deviation is reported by the module it deviates
+	deviated := map[string]map[string]bool{}
+	addDeviations := func(m *yang.Module, owner string) {
+		for _, dev := range m.Deviation {
+			target := strings.TrimPrefix(dev.Name, "/")
+			if i := strings.IndexByte(target, '/'); i >= 0 {
+				target = target[:i]
+			}
+			prefix := ""
+			if i := strings.IndexByte(target, ':'); i >= 0 {
+				prefix = target[:i]
+			}
+			tm := yang.FindModuleByPrefix(m, prefix)
+			if tm == nil {
+				continue
+			}
+			name := tm.Name
+			if tm.BelongsTo != nil {
+				name = tm.BelongsTo.Name
+			}
+			if name == owner {
+				continue
+			}
+			if deviated[name] == nil {
+				deviated[name] = map[string]bool{}
+			}
+			deviated[name][owner] = true
+		}
+	}
+	for _, name := range names {
+		m := s.ms.Modules[name]
+		addDeviations(m, name)
+		for _, inc := range m.Include {
+			if inc.Module != nil {
+				addDeviations(inc.Module, name)
+			}
+		}
+	}
+
+	sort.Strings(names)
+	mods := make([]*libraryModule, 0, len(names))
+	for _, name := range names {
+		lm := byName[name]
+		for dev := range deviated[name] {
+			lm.deviations = append(lm.deviations, dev)
+		}
+		sort.Strings(lm.deviations)
+		mods = append(mods, lm)
+	}
+	return mods
+}
+
+// moduleRevision returns the most recent revision date of the module
+// m, or the empty string if it has no revision statement.
+func moduleRevision(m *yang.Module) string {
+	rev, _ := latestRevision(m)
+	return rev
+}
+
+func moduleFeatures(m *yang.Module) []string {
+	var features []string
+	for _, f := range m.Feature {
+		features = append(features, f.Name)
+	}
+	return features
+}
@@ -0,0 +1,98 @@
+package modules
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/andaru/opr8/dom"
+)
+
+// flatten returns the leaf values of the tree n as "path=value".
+func flatten(n dom.Node, path string, out []string) []string {
+	path += "/" + n.Name().Local
+	if n.FirstChild() == nil || n.FirstChild().NodeType() == dom.NodeTypeText {
+		return append(out, path+"="+n.ChildValue())
+	}
+	for it := n.FirstChild(); it != nil; it = it.NextSibling() {
+		out = flatten(it, path, out)
+	}
+	return out
+}
+
+func TestCollection_YangLibrary(t *testing.T) {
+	SetYANGPath("testdata")
+	c := NewCollection()
+	if _, _, err := c.YangLibrary(); err == nil {
+		t.Errorf("Collection.YangLibrary() before Process error = nil, wantErr true")
+	}
+	for name, data := range map[string]string{
+		"lib-base": `module lib-base {
+  namespace "urn:lib:base"; prefix lb;
+  include lib-sub;
+  revision 2020-01-01; revision 2021-06-01;
+  feature zeta; feature alpha;
+  container top { leaf x { type string; } leaf y { type string; } }
+}`,
+		"lib-sub": `submodule lib-sub {
+  belongs-to lib-base { prefix lb; }
+  revision 2019-05-05;
+  feature middle;
+}`,
+		"lib-dev": `module lib-dev {
+  namespace "urn:lib:dev"; prefix ld;
+  import lib-base { prefix lb; }
+  deviation /lb:top/lb:x { deviate not-supported; }
+}`,
+	} {
+		if err := c.ReadString(name, data); err != nil {
+			t.Fatalf("Collection.ReadString(%s) error = %v", name, err)
+		}
+	}
+	if errs := c.Process(); errs != nil {
+		t.Fatalf("Collection.Process() = %v", errs)
+	}
+
+	lib, id, err := c.YangLibrary("running", "operational")
+	if err != nil {
+		t.Fatalf("Collection.YangLibrary() error = %v", err)
+	}
+	want := []string{
+		"/yang-library/module-set/name=complete",
+		"/yang-library/module-set/module/name=lib-base",
+		"/yang-library/module-set/module/revision=2021-06-01",
+		"/yang-library/module-set/module/namespace=urn:lib:base",
+		"/yang-library/module-set/module/submodule/name=lib-sub",
+		"/yang-library/module-set/module/submodule/revision=2019-05-05",
+		"/yang-library/module-set/module/feature=alpha",
+		"/yang-library/module-set/module/feature=middle",
+		"/yang-library/module-set/module/feature=zeta",
+		"/yang-library/module-set/module/deviation=lib-dev",
+		"/yang-library/module-set/module/name=lib-dev",
+		"/yang-library/module-set/module/namespace=urn:lib:dev",
+		"/yang-library/schema/name=complete",
+		"/yang-library/schema/module-set=complete",
+		"/yang-library/datastore/name=ds:running",
+		"/yang-library/datastore/schema=complete",
+		"/yang-library/datastore/name=ds:operational",
+		"/yang-library/datastore/schema=complete",
+		"/yang-library/content-id=" + id,
+	}
+	if got := flatten(lib, "", nil); !reflect.DeepEqual(got, want) {
+		t.Errorf("Collection.YangLibrary() =\n%q\nwant\n%q", got, want)
+	}
+	if lib.Name().Space != YangLibraryNamespace {
+		t.Errorf("Collection.YangLibrary() namespace = %q, want %q", lib.Name().Space, YangLibraryNamespace)
+	}
+
+	_, again, _ := c.YangLibrary()
+	if again != id {
+		t.Errorf("Collection.YangLibrary() content-id changed from %s to %s", id, again)
+	}
+	if err := c.ReadString("lib-other", `module lib-other { namespace "urn:lib:other"; prefix lo; }`); err != nil {
+		t.Fatal(err)
+	}
+	c.Process()
+	if _, changed, _ := c.YangLibrary(); changed == id {
+		t.Errorf("Collection.YangLibrary() content-id unchanged after adding a module")
+	}
+}
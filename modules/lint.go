@@ -0,0 +1,220 @@
+package modules
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/openconfig/goyang/pkg/yang"
+)
+
+// Severity is the severity of a Diagnostic.
+type Severity int
+
+const (
+	// SeverityWarning indicates a problem with a module which does not
+	// prevent its use.
+	SeverityWarning Severity = 1 + iota
+	// SeverityError indicates a module is invalid, or conflicts with
+	// other modules of the collection.
+	SeverityError
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	default:
+		return fmt.Sprintf("UNKNOWN(%d)", s)
+	}
+}
+
+// Lint rules reported in Diagnostic.Rule.
+const (
+	// LintUnusedImport reports imports whose prefix is never used.
+	LintUnusedImport = "unused-import"
+	// LintMissingDescription reports containers with no description.
+	LintMissingDescription = "missing-description"
+	// LintRevisionFormat reports revision dates which are not valid
+	// dates, and revisions which are duplicated or are not listed
+	// most recent first.
+	LintRevisionFormat = "revision-format"
+	// LintConflictingNamespace reports modules sharing a namespace.
+	LintConflictingNamespace = "conflicting-namespace"
+)
+
+// Diagnostic is a problem with a module found by Lint.
+type Diagnostic struct {
+	// Module is the name of the module or submodule, with its
+	// revision, e.g., "ietf-interfaces@2018-02-20".
+	Module string
+	// Source is the location of the statement in the module source,
+	// e.g., "ietf-interfaces.yang:12:3".
+	Source string
+	// Rule is the lint rule, e.g., LintUnusedImport.
+	Rule     string
+	Severity Severity
+	Message  string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s: %s (%s)", d.Source, d.Severity, d.Message, d.Rule)
+}
+
+// Lint checks the modules and submodules read by the collection for
+// problems beyond those reported by Process, and returns them sorted
+// by module, and in source order within each module. Lint may be
+// called before Process.
+func (c *Collection) Lint() []Diagnostic {
+	ms := c.Raw()
+	var diags []Diagnostic
+	namespaces := map[string][]*yang.Module{}
+	for _, mods := range []map[string]*yang.Module{ms.Modules, ms.SubModules} {
+		for name, mod := range mods {
+			if name != mod.FullName() {
+				continue
+			}
+			if mod.Namespace != nil {
+				namespaces[mod.Namespace.Name] = append(namespaces[mod.Namespace.Name], mod)
+			}
+			if mod.Source != nil {
+				l := &linter{module: name}
+				l.lint(mod.Source)
+				diags = append(diags, l.diags...)
+			}
+		}
+	}
+
+	for ns, mods := range namespaces {
+		sort.Slice(mods, func(i, j int) bool { return mods[i].FullName() < mods[j].FullName() })
+		for _, mod := range mods[1:] {
+			if mod.Name == mods[0].Name {
+				continue
+			}
+			diags = append(diags, Diagnostic{
+				Module:   mod.FullName(),
+				Source:   mod.Source.Location(),
+				Rule:     LintConflictingNamespace,
+				Severity: SeverityError,
+				Message:  fmt.Sprintf("namespace %q is also used by module %s", ns, mods[0].Name),
+			})
+		}
+	}
+
+	sort.SliceStable(diags, func(i, j int) bool { return diags[i].Module < diags[j].Module })
+	return diags
+}
+
+// prefixRE matches the prefix of a prefixed identifier, e.g., "if"
+// in "if:interface", but not "http" in "http://example.com".
+var prefixRE = regexp.MustCompile(`(?:^|[^\w.:-])([A-Za-z_][\w.-]*):[A-Za-z_]`)
+
+// linter lints the statements of a module or submodule.
+type linter struct {
+	module string
+	diags  []Diagnostic
+}
+
+func (l *linter) report(s *yang.Statement, rule string, format string, args ...interface{}) {
+	l.diags = append(l.diags, Diagnostic{
+		Module:   l.module,
+		Source:   s.Location(),
+		Rule:     rule,
+		Severity: SeverityWarning,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+func (l *linter) lint(module *yang.Statement) {
+	var imports []*yang.Statement
+	used := map[string]bool{}
+	var revisions []*yang.Statement
+	for _, s := range module.SubStatements() {
+		switch s.Keyword {
+		case "import":
+			imports = append(imports, s)
+			continue
+		case "revision":
+			revisions = append(revisions, s)
+		}
+		l.walk(s, used)
+	}
+
+	for _, s := range imports {
+		for _, sub := range s.SubStatements() {
+			if sub.Keyword == "prefix" && !used[sub.Argument] {
+				l.report(s, LintUnusedImport, "module %s imported with prefix %q is not used", s.Argument, sub.Argument)
+			}
+		}
+	}
+
+	seen := map[string]bool{}
+	var last time.Time
+	for _, s := range revisions {
+		date, err := time.Parse(revisionLayout, s.Argument)
+		switch {
+		case err != nil:
+			l.report(s, LintRevisionFormat, "revision %q is not a date in YYYY-MM-DD format", s.Argument)
+		case seen[s.Argument]:
+			l.report(s, LintRevisionFormat, "revision %s is listed more than once", s.Argument)
+		case !last.IsZero() && date.After(last):
+			l.report(s, LintRevisionFormat, "revision %s should be listed before revision %s", s.Argument, last.Format(revisionLayout))
+		}
+		if err == nil {
+			seen[s.Argument] = true
+			last = date
+		}
+	}
+
+	sort.SliceStable(l.diags, func(i, j int) bool {
+		li, ci := sourcePosition(l.diags[i].Source)
+		lj, cj := sourcePosition(l.diags[j].Source)
+		return li < lj || li == lj && ci < cj
+	})
+}
+
+// sourcePosition returns the line and column of the statement
+// location loc, e.g., "module.yang:12:3".
+func sourcePosition(loc string) (line, col int) {
+	parts := strings.Split(loc, ":")
+	if n := len(parts); n >= 3 {
+		line, _ = strconv.Atoi(parts[n-2])
+		col, _ = strconv.Atoi(parts[n-1])
+	}
+	return line, col
+}
+
+// walk records the prefixes used by s and its descendants in used,
+// and reports containers with no description.
+func (l *linter) walk(s *yang.Statement, used map[string]bool) {
+	switch s.Keyword {
+	case "description", "reference", "contact", "organization":
+		// free text
+		return
+	}
+	for _, text := range []string{s.Keyword, s.Argument} {
+		for _, m := range prefixRE.FindAllStringSubmatch(text, -1) {
+			used[m[1]] = true
+		}
+	}
+	if s.Keyword == "container" && !hasSubStatement(s, "description") {
+		l.report(s, LintMissingDescription, "container %s has no description", s.Argument)
+	}
+	for _, sub := range s.SubStatements() {
+		l.walk(sub, used)
+	}
+}
+
+func hasSubStatement(s *yang.Statement, keyword string) bool {
+	for _, sub := range s.SubStatements() {
+		if sub.Keyword == keyword {
+			return true
+		}
+	}
+	return false
+}
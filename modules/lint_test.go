@@ -0,0 +1,65 @@
+package modules
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCollection_Lint(t *testing.T) {
+	c := NewCollection()
+	for name, src := range map[string]string{
+		"base": `module base {
+  namespace urn:base; prefix b;
+  revision 2020-01-01;
+  typedef name { type string; }
+  identity kind;
+}`,
+		"lint": `module lint {
+  namespace urn:lint; prefix l;
+  import base { prefix b; }
+  import unused { prefix u; }
+  import ext { prefix x; }
+  import described { prefix d; description "see d:thing"; }
+  revision 2019-01-01;
+  revision 2020-02-30;
+  revision 2020-01-01;
+  revision 2019-01-01;
+  x:annotation "a";
+  container system {
+    description "http://example.com";
+    container inner {
+      leaf name { type b:name; }
+    }
+  }
+}`,
+		"clash": `module clash { namespace urn:lint; prefix c; container top { description "top"; } }`,
+	} {
+		if err := c.s.ms.Parse(src, name+".yang"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	type diag struct {
+		module, rule string
+		severity     Severity
+	}
+	var got []diag
+	for _, d := range c.Lint() {
+		got = append(got, diag{d.Module, d.Rule, d.Severity})
+		if d.Source == "" || d.Message == "" {
+			t.Errorf("Lint() diagnostic %v missing source or message", d)
+		}
+	}
+	want := []diag{
+		{"lint@2020-02-30", LintUnusedImport, SeverityWarning},
+		{"lint@2020-02-30", LintUnusedImport, SeverityWarning},
+		{"lint@2020-02-30", LintRevisionFormat, SeverityWarning},
+		{"lint@2020-02-30", LintRevisionFormat, SeverityWarning},
+		{"lint@2020-02-30", LintRevisionFormat, SeverityWarning},
+		{"lint@2020-02-30", LintMissingDescription, SeverityWarning},
+		{"lint@2020-02-30", LintConflictingNamespace, SeverityError},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Lint() = %v\nwant %v", got, want)
+	}
+}
@@ -2,10 +2,15 @@ package modules
 
 import (
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	xml "github.com/andaru/flexml"
+	"github.com/andaru/opr8/log"
 
 	"github.com/openconfig/goyang/pkg/yang"
 	"github.com/pkg/errors"
@@ -13,10 +18,45 @@ import (
 
 // Package modules provides a YANG module (schema) collection
 
-// Collection is a YANG module collection
+// revisionLayout is the time layout of YANG revision dates.
+const revisionLayout = "2006-01-02"
+
+// RevisionPolicy selects the revision of each module used by a
+// collection, where it has read more than one revision of the module
+// and no revision is pinned.
+type RevisionPolicy int
+
+const (
+	// RevisionLatest selects the revision with the most recent
+	// revision date.
+	RevisionLatest RevisionPolicy = iota
+	// RevisionEarliest selects the revision with the oldest revision
+	// date.
+	RevisionEarliest
+)
+
+// Collection is a YANG module collection.
+//
+// The methods reading a processed collection may be called
+// concurrently, including while Watch reloads it. The methods reading
+// or removing modules, Process, Mount and Reset must not be called
+// concurrently with them.
 type Collection struct {
-	ms        *yang.Modules
-	processed bool
+	// options are those the collection was created with
+	options []Option
+
+	// mu guards the schema, replaced by Watch, the schema mounts,
+	// the listeners and the files
+	mu     sync.RWMutex
+	s      *schema
+	mounts map[string]*Collection
+	// listeners are called by Watch
+	listeners []func(SchemaEvent)
+	// files is the state of the YANG path read by ImportAll
+	files map[string]fileState
+	// logger logs the modules not imported by ImportAll, and reloads
+	// by Watch
+	logger log.Logger
 }
 
 // SetYANGPath sets the YANG import path. Each path in paths is a
@@ -27,77 +67,259 @@ func SetYANGPath(paths ...string) {
 	yang.Path = paths
 }
 
-// NewCollection returns a new YANG module collection. Prior to
-// creating a collection, YANG paths must have been set using
-// SetYANGPath.
-func NewCollection() *Collection { return &Collection{ms: yang.NewModules()} }
+// Option is a Collection configuration option.
+type Option func(*Collection)
 
-func (c *Collection) Raw() *yang.Modules { return c.ms }
+// WithRevisionPolicy sets the policy selecting the revision of modules
+// whose revision is not pinned. The default is RevisionLatest.
+func WithRevisionPolicy(policy RevisionPolicy) Option {
+	return func(c *Collection) { c.s.policy = policy }
+}
 
-func (c *Collection) GetSchemaNode(schemaNodeID string) (e *yang.Entry) {
-	if match := c.IterLatest(func(m *yang.Module) error {
-		if mod := yang.ToEntry(m); mod != nil && mod.Find(schemaNodeID) != nil {
-			return errors.New("match")
+// WithPinnedRevisions pins the modules named by the keys of revisions
+// to the revisions they map to, e.g., to those a device implements,
+// as if each were imported by Import with a revision. Modules not read
+// in the pinned revision use the collection's RevisionPolicy.
+func WithPinnedRevisions(revisions map[string]string) Option {
+	return func(c *Collection) {
+		if c.s.pinned == nil {
+			c.s.pinned = map[string]string{}
+		}
+		for name, revision := range revisions {
+			c.s.pinned[name] = revision
 		}
-		return nil
-	}); match != nil {
-		return e
 	}
-	return nil
 }
 
-// Import imports a module by its module name. Process must be called
-// before calls to ModuleEntry after this returns.
+// WithLogger sets the logger of the YANG files ImportAll fails to
+// read, and of the reloads made by Watch.
+func WithLogger(l log.Logger) Option {
+	return func(c *Collection) { c.logger = l }
+}
+
+// NewCollection returns a new YANG module collection. Prior to
+// creating a collection, YANG paths must have been set using
+// SetYANGPath.
+func NewCollection(options ...Option) *Collection {
+	c := &Collection{s: &schema{ms: yang.NewModules()}, options: options}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+// current returns the schema of the collection.
+func (c *Collection) current() *schema {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.s
+}
+
+// Raw returns the goyang module set of the collection.
+func (c *Collection) Raw() *yang.Modules { return c.current().ms }
+
+// Import imports a module by its module name. The name may include a
+// revision, e.g., "ietf-interfaces@2018-02-20", to import that
+// revision of the module, which is then pinned: used by ModuleEntry,
+// RootEntry and IterLatest in place of the revision selected by the
+// collection's RevisionPolicy. Process must be
+// called before calls to ModuleEntry after this returns.
 func (c *Collection) Import(moduleName string) error {
 	if len(yang.Path) == 0 {
 		return errors.New("no module paths to search for YANG modules, use SetYANGPath")
 	}
-	if c.ms.Modules[moduleName] != nil {
-		return nil
-	}
 	if strings.HasSuffix(moduleName, ".yang") || strings.Contains(moduleName, string(os.PathSeparator)) {
 		return errors.Errorf("received invalid module name %s", moduleName)
 	}
-	err := c.ms.Read(moduleName)
-	if err == nil {
-		c.processed = false
+	name, revision := moduleName, ""
+	if i := strings.IndexByte(moduleName, '@'); i >= 0 {
+		name, revision = moduleName[:i], moduleName[i+1:]
+		if _, err := time.Parse(revisionLayout, revision); err != nil {
+			return errors.Errorf("invalid revision in module name %s", moduleName)
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.s
+	if s.ms.Modules[moduleName] == nil {
+		if err := s.ms.Read(moduleName); err != nil {
+			return err
+		}
+		s.processed = false
+		if s.ms.Modules[moduleName] == nil {
+			return errors.Errorf("module %s does not have revision %s", name, revision)
+		}
+	}
+	if revision != "" && s.pinned[name] != revision {
+		if s.pinned == nil {
+			s.pinned = map[string]string{}
+		}
+		s.pinned[name] = revision
+		if s.processed {
+			s.buildIndex(c.mounts)
+		}
 	}
-	return err
+	return nil
+}
+
+// latestRevision returns the most recent revision of the module m and
+// its date. Revisions which are not valid dates are ignored. If m has
+// no valid revision, the empty string and the zero time are returned.
+func latestRevision(m *yang.Module) (string, time.Time) {
+	var name string
+	var latest time.Time
+	for _, rev := range m.Revision {
+		date, err := time.Parse(revisionLayout, rev.Name)
+		if err != nil {
+			continue
+		}
+		if name == "" || date.After(latest) {
+			name, latest = rev.Name, date
+		}
+	}
+	return name, latest
 }
 
+// ReadString parses the YANG module or submodule source data, such as
+// fetched from a server, naming the source moduleName. The name is
+// typically the module name, optionally with a revision, e.g.,
+// "ietf-interfaces@2018-02-20", but may be a file name or URL, e.g.,
+// "yang/ietf-interfaces@2018-02-20.yang". If a module or submodule of
+// that name has been read already, data is ignored. A submodule's
+// belongs-to statement is resolved by Process, so submodules may be
+// read before or after their modules. Process must be called before
+// collection accessors after this returns.
 func (c *Collection) ReadString(moduleName string, data string) error {
-	if c.ms.Modules[moduleName] != nil {
+	name := strings.TrimSuffix(path.Base(moduleName), ".yang")
+	if name == "" || name == "." || name == "/" {
+		return errors.Errorf("received invalid module name %s", moduleName)
+	}
+	if c.hasModule(name) {
 		return nil
 	}
-	if strings.HasSuffix(moduleName, ".yang") || strings.Contains(moduleName, string(os.PathSeparator)) {
-		return errors.Errorf("received invalid module name %s", moduleName)
+	return c.parse(data, moduleName)
+}
+
+// hasModule returns true if a module or submodule with the name, or
+// name@revision, has been read.
+func (c *Collection) hasModule(name string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.s.ms.Modules[name] != nil || c.s.ms.SubModules[name] != nil
+}
+
+// parse parses the YANG module or submodule source data, naming the
+// source name.
+func (c *Collection) parse(data, name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.s.ms.Parse(data, name); err != nil {
+		return err
+	}
+	c.s.processed = false
+	return nil
+}
+
+// ReadStrings reads the YANG module and submodule sources data, as by
+// ReadString, keyed by name, returning any errors. This reads a set of
+// modules fetched together, such as from a server, in one call.
+func (c *Collection) ReadStrings(sources map[string]string) []error {
+	names := make([]string, 0, len(sources))
+	for name := range sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var errs []error
+	for _, name := range names {
+		if err := c.ReadString(name, sources[name]); err != nil {
+			errs = append(errs, importError{name, err.Error()})
+		}
 	}
-	err := c.ms.Parse(data, moduleName)
-	if err == nil {
-		c.processed = false
+	return errs
+}
+
+// Remove removes the module with the name from the collection. The
+// name may include a revision, e.g., "ietf-interfaces@2018-02-20", to
+// remove only that revision; otherwise all revisions are removed, with
+// the module's submodules. Any revision pinned by Import is unpinned if
+// removed. Process must be called before collection accessors after
+// this returns.
+func (c *Collection) Remove(moduleName string) error {
+	name, revision := moduleName, ""
+	if i := strings.IndexByte(moduleName, '@'); i >= 0 {
+		name, revision = moduleName[:i], moduleName[i+1:]
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.s
+	removed := false
+	for key, mod := range s.ms.Modules {
+		if mod.Name == name && (revision == "" || mod.FullName() == moduleName) {
+			delete(s.ms.Modules, key)
+			removed = true
+		}
+	}
+	if !removed {
+		return errors.Errorf("module %s not found", moduleName)
+	}
+	if revision == "" || s.pinned[name] == revision {
+		delete(s.pinned, name)
+	}
+
+	// the module name refers to the revision remaining which is
+	// pinned or selected by the collection's policy
+	if mod := s.module(name); mod != nil {
+		s.ms.Modules[name] = mod
+	} else {
+		for key, sub := range s.ms.SubModules {
+			if sub.BelongsTo != nil && sub.BelongsTo.Name == name {
+				delete(s.ms.SubModules, key)
+			}
+		}
 	}
-	return err
+	s.invalidate(c.mounts)
+	return nil
+}
 
+// Reset removes all modules from the collection, with the revisions
+// pinned by Import and the schemas mounted. The options the collection
+// was created with, and the functions registered with Listen, are
+// kept.
+func (c *Collection) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.s = &schema{ms: yang.NewModules()}
+	c.mounts, c.files = nil, nil
+	for _, option := range c.options {
+		option(c)
+	}
+	c.s.invalidate(nil)
 }
 
 // ImportAll reads all YANG files found in the YANG path(s), returning
 // any import errors. Process must be called before calls to
 // ModuleEntry after this returns.
 func (c *Collection) ImportAll() []error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	var errs []error
+	c.files = scanYANGPath()
 	for _, root := range expandYANGPath(yang.Path) {
 		_ = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
 			if err != nil {
+				log.Warn(c.log(), "YANG path not read", "path", path, "error", err)
 				errs = append(errs, importError{path, err.Error()})
 				return nil
 			}
 			if info.Mode().IsRegular() && strings.HasSuffix(path, ".yang") {
-				if err := c.ms.Read(path); err != nil {
+				if err := c.s.ms.Read(path); err != nil {
+					log.Warn(c.log(), "YANG module not imported", "path", path, "error", err)
 					errs = append(errs, importError{path, err.Error()})
 				} else {
+					log.Debug(c.log(), "YANG module imported", "path", path)
 					// clear the processed flag as we've imported a
 					// module potentially unforseen
-					c.processed = false
+					c.s.processed = false
 				}
 			}
 			return nil
@@ -106,24 +328,30 @@ func (c *Collection) ImportAll() []error {
 	return errs
 }
 
+// log returns the collection's logger.
+func (c *Collection) log() log.Logger { return log.OrNop(c.logger) }
+
 // Process processes all modules previous read by Import or ImportAll,
 // and must be called before collection accessors, to ensure the
-// schema Entry tree including all augmentations is built.
+// schema Entry tree including all augmentations is built. If the
+// collection's Fingerprint is unchanged since it was last processed
+// successfully, the schema entries then built are used again.
 func (c *Collection) Process() []error {
-	errs := c.ms.Process()
-	c.processed = len(errs) == 0
-	return errs
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.s.process(c.mounts)
+}
+
+// ModuleByNamespace returns the module with the XML namespace ns, in
+// the same revision as used by RootEntry.
+func (c *Collection) ModuleByNamespace(ns string) (*yang.Module, error) {
+	return c.current().moduleByNamespace(ns)
 }
 
 // ModulesLen returns the number of unique module names in the
 // collection, excluding sub-modules.
-func (c *Collection) ModulesLen() (length int) {
-	for name := range c.ms.Modules {
-		if !strings.Contains(name, "@") {
-			length++
-		}
-	}
-	return
+func (c *Collection) ModulesLen() int {
+	return len(c.current().moduleNames())
 }
 
 // ModuleEntry returns the YANG schema node entry for the given YANG module
@@ -131,52 +359,34 @@ func (c *Collection) ModulesLen() (length int) {
 // such module exists in the collection or the collection is not ready
 // to be read.
 func (c *Collection) ModuleEntry(name string) (*yang.Entry, error) {
-	if !c.processed {
-		return nil, errors.New("must call Process first")
-	}
-	if mod := c.ms.Modules[name]; mod != nil {
-		return yang.ToEntry(mod), nil
-	}
-	return nil, errors.New("not found")
+	return c.current().moduleEntry(name)
 }
 
-// RootEntry scans the latest version of the module matching the
-// name's Space field for child entries matching the name's Local
+// RootEntry returns the top-level schema node of the selected revision
+// of the module matching the name's Space field, with the name's Local
 // field. If no such module is found, or no such child is found within
-// the module, an error is returned.
+// the module, an error is returned. Lookups use an index built by
+// Process.
 func (c *Collection) RootEntry(name xml.Name) (*yang.Entry, error) {
-	if !c.processed {
+	s := c.current()
+	if !s.processed {
 		return nil, errors.New("must call Process first")
 	}
-	var entry *yang.Entry
-	if stopped := c.IterLatest(func(mod *yang.Module) error {
-		// only search modules with a matching namespace
-		if mod.Namespace == nil || mod.Namespace.Name != name.Space {
-			return nil
-		}
-		for local, e := range yang.ToEntry(mod).Dir {
-			if name.Local == local {
-				entry = e
-				return errors.New("stop")
-			}
-		}
-		return nil
-	}); stopped != nil {
+	if entry, ok := s.roots[name]; ok {
 		return entry, nil
 	}
-
 	return nil, errors.New("not found")
 }
 
-// IterLatest iterates oves the latest version of all YANG modules in
-// the underlying module collection.
+// IterLatest iterates over the selected revision of all YANG modules
+// in the underlying module collection, in module name order. This is
+// the pinned revision of the module, if any, or otherwise that chosen
+// by the collection's RevisionPolicy, by default the revision with the
+// most recent revision date.
 func (c *Collection) IterLatest(f func(*yang.Module) error) error {
-	for name, mod := range c.ms.Modules {
-		// only consider "latest" versions, those without a '@' char.
-		if !strings.Contains(name, "@") {
-			if err := f(mod); err != nil {
-				return err
-			}
+	for _, mod := range c.current().latest() {
+		if err := f(mod); err != nil {
+			return err
 		}
 	}
 	return nil
@@ -1,10 +1,14 @@
 package modules
 
 import (
+	"bytes"
+	stdlog "log"
 	"reflect"
+	"strings"
 	"testing"
 
 	xml "github.com/andaru/flexml"
+	"github.com/andaru/opr8/log"
 
 	"github.com/openconfig/goyang/pkg/yang"
 )
@@ -128,6 +132,16 @@ func TestCollection_ImportAll(t *testing.T) {
 	}
 }
 
+func TestCollection_ImportAllLogger(t *testing.T) {
+	var b bytes.Buffer
+	c := NewCollection(WithLogger(log.NewStd(stdlog.New(&b, "", 0), log.LevelWarn)))
+	SetYANGPath("does-not-exist")
+	c.ImportAll()
+	if want := "warn YANG path not read path=does-not-exist error="; !strings.HasPrefix(b.String(), want) {
+		t.Errorf("logged %q, want %q...", b.String(), want)
+	}
+}
+
 func TestCollection_Process(t *testing.T) {
 	tests := []struct {
 		path string
@@ -176,7 +190,7 @@ func TestCollection_ModuleEntry(t *testing.T) {
 			name:   "test module",
 			paths:  []string{"..."},
 			args:   args{"test"},
-			wantFn: func() *yang.Entry { return yang.ToEntry(c.ms.Modules["test"]) },
+			wantFn: func() *yang.Entry { return yang.ToEntry(c.s.ms.Modules["test"]) },
 		},
 	}
 	for _, tt := range tests {
@@ -236,7 +250,7 @@ func TestCollection_RootEntry(t *testing.T) {
 			name:   "system container in test module",
 			paths:  []string{"testdata"},
 			args:   args{xml.Name{Space: "urn:opr8:modules:test:test", Local: "system"}},
-			wantFn: func() *yang.Entry { return yang.ToEntry(c.ms.Modules["test"]).Dir["system"] },
+			wantFn: func() *yang.Entry { return yang.ToEntry(c.s.ms.Modules["test"]).Dir["system"] },
 		},
 	}
 	for _, tt := range tests {
@@ -260,6 +274,38 @@ func TestCollection_RootEntry(t *testing.T) {
 	}
 }
 
+func TestCollection_ModuleByNamespace(t *testing.T) {
+	c := NewCollection()
+	if _, err := c.ModuleByNamespace("urn:opr8:modules:test:test"); err == nil {
+		t.Error("Collection.ModuleByNamespace() before Process: want error")
+	}
+	SetYANGPath("testdata")
+	c.ImportAll()
+	if errs := c.Process(); errs != nil {
+		t.Fatalf("Collection.Process() = %v", errs)
+	}
+	tests := []struct {
+		name    string
+		ns      string
+		want    string
+		wantErr bool
+	}{
+		{name: "test module", ns: "urn:opr8:modules:test:test", want: "test"},
+		{name: "unknown namespace", ns: "test", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := c.ModuleByNamespace(tt.ns)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Collection.ModuleByNamespace() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got.Name != tt.want {
+				t.Errorf("Collection.ModuleByNamespace() = %s, want %s", got.Name, tt.want)
+			}
+		})
+	}
+}
+
 func TestCollection_IterLatest(t *testing.T) {
 	type fields struct {
 		ms        *yang.Modules
@@ -298,10 +344,10 @@ func TestCollection_IterLatest(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			found = false
-			c := &Collection{
+			c := &Collection{s: &schema{
 				ms:        tt.fields.ms,
 				processed: tt.fields.processed,
-			}
+			}}
 			if errs := c.ImportAll(); len(errs) > 0 {
 				t.Fatalf("Collection.ImportAll() %d errors; first error: %s", len(errs), errs[0])
 			}
@@ -316,6 +362,230 @@ func TestCollection_IterLatest(t *testing.T) {
 	}
 }
 
+func TestCollection_IterLatestOrder(t *testing.T) {
+	c := &Collection{s: &schema{ms: yang.NewModules()}}
+	for _, src := range []string{
+		`module zulu { namespace urn:z; prefix z; revision 2019-01-01; revision 2020-06-01; }`,
+		`module zulu { namespace urn:z; prefix z; revision 2018-01-01; }`,
+		`module alpha { namespace urn:a; prefix a; }`,
+		`module mike { namespace urn:m; prefix m; revision 2001-01-01; }`,
+	} {
+		if err := c.s.ms.Parse(src, "test"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var got []string
+	_ = c.IterLatest(func(m *yang.Module) error {
+		got = append(got, m.Name+"@"+moduleRevision(m))
+		return nil
+	})
+	if want := []string{"alpha@", "mike@2001-01-01", "zulu@2020-06-01"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Collection.IterLatest() modules = %v, want %v", got, want)
+	}
+	if got := c.ModulesLen(); got != 3 {
+		t.Errorf("Collection.ModulesLen() = %d, want 3", got)
+	}
+}
+
+func TestCollection_RevisionPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []Option
+		want    string
+	}{
+		{"default", nil, "2020-06-01"},
+		{"latest", []Option{WithRevisionPolicy(RevisionLatest)}, "2020-06-01"},
+		{"earliest", []Option{WithRevisionPolicy(RevisionEarliest)}, "2018-01-01"},
+		{"pinned", []Option{WithPinnedRevisions(map[string]string{"zulu": "2019-03-01"})}, "2019-03-01"},
+		{"pinned earliest", []Option{WithRevisionPolicy(RevisionEarliest), WithPinnedRevisions(map[string]string{"zulu": "2019-03-01"})}, "2019-03-01"},
+		{"pinned unknown", []Option{WithRevisionPolicy(RevisionEarliest), WithPinnedRevisions(map[string]string{"zulu": "2000-01-01"})}, "2018-01-01"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewCollection(tt.options...)
+			for _, src := range []string{
+				`module zulu { namespace urn:z; prefix z; revision 2020-06-01; container r2020; }`,
+				`module zulu { namespace urn:z; prefix z; revision 2018-01-01; container r2018; }`,
+				`module zulu { namespace urn:z; prefix z; revision 2019-03-01; container r2019; }`,
+				`module zulu { namespace urn:z; prefix z; container undated; }`,
+			} {
+				if err := c.s.ms.Parse(src, "zulu"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if errs := c.Process(); errs != nil {
+				t.Fatalf("Collection.Process() = %v", errs)
+			}
+			var got []string
+			_ = c.IterLatest(func(m *yang.Module) error {
+				got = append(got, moduleRevision(m))
+				return nil
+			})
+			if want := []string{tt.want}; !reflect.DeepEqual(got, want) {
+				t.Errorf("Collection.IterLatest() revisions = %v, want %v", got, want)
+			}
+			e, err := c.ModuleEntry("zulu")
+			if err != nil {
+				t.Fatal(err)
+			}
+			local := "r" + tt.want[:4]
+			if e.Dir[local] == nil {
+				t.Errorf("Collection.ModuleEntry() children = %v, want %s", e.Dir, local)
+			}
+			if _, err := c.RootEntry(xml.Name{Space: "urn:z", Local: local}); err != nil {
+				t.Errorf("Collection.RootEntry(%s) error = %v", local, err)
+			}
+		})
+	}
+}
+
+func TestCollection_Remove(t *testing.T) {
+	c := NewCollection(WithPinnedRevisions(map[string]string{"yankee": "2018-01-01"}))
+	for _, src := range []string{
+		`module yankee { namespace urn:y; prefix y; revision 2020-06-01; }`,
+		`module yankee { namespace urn:y; prefix y; revision 2018-01-01; }`,
+		`module zulu { namespace urn:z; prefix z; container top; }`,
+		`module zulu-aug { namespace urn:za; prefix za; import zulu { prefix z; }
+  augment /z:top { leaf extra { type string; } }
+  identity base; identity derived { base base; } }`,
+	} {
+		if err := c.s.ms.Parse(src, "zulu"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if errs := c.Process(); errs != nil {
+		t.Fatalf("Collection.Process() = %v", errs)
+	}
+	if _, err := c.SchemaNode("/z:top/za:extra"); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(c.Identities("")); got != 2 {
+		t.Fatalf("Collection.Identities() returned %d identities, want 1", got)
+	}
+
+	if err := c.Remove("zulu-aug"); err != nil {
+		t.Fatalf("Collection.Remove() error = %v", err)
+	}
+	if _, err := c.ModuleEntry("zulu"); err == nil {
+		t.Error("Collection.ModuleEntry() after Remove: want error until Process")
+	}
+	if errs := c.Process(); errs != nil {
+		t.Fatalf("Collection.Process() = %v", errs)
+	}
+	if _, err := c.SchemaNode("/z:top/za:extra"); err == nil {
+		t.Error("Collection.SchemaNode() found node of removed module")
+	}
+	if _, err := c.ModuleByNamespace("urn:za"); err == nil {
+		t.Error("Collection.ModuleByNamespace() found removed module")
+	}
+	if got := c.Identities(""); len(got) != 0 {
+		t.Errorf("Collection.Identities() = %v, want none", got)
+	}
+
+	// removing the pinned revision selects the latest
+	if mod := c.s.module("yankee"); mod == nil || moduleRevision(mod) != "2018-01-01" {
+		t.Errorf("Collection.module() = %v, want yankee@2018-01-01", mod)
+	}
+	if err := c.Remove("yankee@2018-01-01"); err != nil {
+		t.Fatalf("Collection.Remove() error = %v", err)
+	}
+	if errs := c.Process(); errs != nil {
+		t.Fatalf("Collection.Process() = %v", errs)
+	}
+	if mod := c.s.module("yankee"); mod == nil || moduleRevision(mod) != "2020-06-01" {
+		t.Errorf("Collection.module() = %v, want yankee@2020-06-01", mod)
+	}
+	if got := c.ModulesLen(); got != 2 {
+		t.Errorf("Collection.ModulesLen() = %d, want 2", got)
+	}
+	for _, name := range []string{"zulu-aug", "yankee@2018-01-01", "nope"} {
+		if err := c.Remove(name); err == nil {
+			t.Errorf("Collection.Remove(%s): want error", name)
+		}
+	}
+
+	c.Reset()
+	if got := c.ModulesLen(); got != 0 {
+		t.Errorf("Collection.ModulesLen() after Reset = %d, want 0", got)
+	}
+	if _, err := c.RootEntry(xml.Name{Space: "urn:z", Local: "top"}); err == nil {
+		t.Error("Collection.RootEntry() after Reset: want error")
+	}
+	if c.s.pinned["yankee"] != "2018-01-01" {
+		t.Errorf("Collection.Reset() pinned = %v, want the revisions of WithPinnedRevisions", c.s.pinned)
+	}
+	if err := c.s.ms.Parse(`module zulu { namespace urn:z; prefix z; container other; }`, "zulu"); err != nil {
+		t.Fatal(err)
+	}
+	if errs := c.Process(); errs != nil {
+		t.Fatalf("Collection.Process() = %v", errs)
+	}
+	if _, err := c.RootEntry(xml.Name{Space: "urn:z", Local: "other"}); err != nil {
+		t.Errorf("Collection.RootEntry() error = %v", err)
+	}
+}
+
+func TestCollection_RemoveRevisionPolicy(t *testing.T) {
+	c := NewCollection(WithRevisionPolicy(RevisionEarliest))
+	for _, revision := range []string{"2018-01-01", "2019-01-01", "2020-01-01"} {
+		src := `module yankee { namespace urn:y; prefix y; revision ` + revision + `; }`
+		if err := c.s.ms.Parse(src, "yankee"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.Remove("yankee@2018-01-01"); err != nil {
+		t.Fatalf("Collection.Remove() error = %v", err)
+	}
+	if mod := c.s.ms.Modules["yankee"]; mod == nil || moduleRevision(mod) != "2019-01-01" {
+		t.Errorf("module yankee after Remove = %v, want yankee@2019-01-01", mod)
+	}
+	if errs := c.Process(); errs != nil {
+		t.Fatalf("Collection.Process() = %v", errs)
+	}
+	if e, err := c.ModuleEntry("yankee"); err != nil || moduleRevision(e.Node.(*yang.Module)) != "2019-01-01" {
+		t.Errorf("Collection.ModuleEntry() = %v, %v, want yankee@2019-01-01", e, err)
+	}
+}
+
+func TestCollection_ReadStrings(t *testing.T) {
+	c := NewCollection()
+	errs := c.ReadStrings(map[string]string{
+		"fetched/acme-sub@2020-01-01.yang": `submodule acme-sub {
+  belongs-to acme { prefix a; }
+  revision 2020-01-01;
+  container settings;
+}`,
+		"https://example.com/yang/acme.yang": `module acme {
+  namespace urn:acme; prefix a;
+  include acme-sub;
+  container system;
+}`,
+		"broken": `module broken { }}`,
+	})
+	if len(errs) != 1 || !strings.HasPrefix(errs[0].Error(), "broken: ") {
+		t.Errorf("Collection.ReadStrings() = %v, want an error reading broken", errs)
+	}
+	if err := c.ReadString("acme.yang", `module acme { namespace urn:other; prefix o; }`); err != nil {
+		t.Errorf("Collection.ReadString() of a module read already error = %v", err)
+	}
+	for _, name := range []string{"", "/"} {
+		if err := c.ReadString(name, `module x { namespace urn:x; prefix x; }`); err == nil {
+			t.Errorf("Collection.ReadString(%q): want error", name)
+		}
+	}
+	if errs := c.Process(); errs != nil {
+		t.Fatalf("Collection.Process() = %v", errs)
+	}
+	for _, local := range []string{"system", "settings"} {
+		if _, err := c.RootEntry(xml.Name{Space: "urn:acme", Local: local}); err != nil {
+			t.Errorf("Collection.RootEntry(%s) error = %v", local, err)
+		}
+	}
+	if subs := c.Submodules("acme"); len(subs) != 1 || subs[0].Name != "acme-sub" {
+		t.Errorf("Collection.Submodules() = %v, want acme-sub", subs)
+	}
+}
+
 func Test_expandYANGPath(t *testing.T) {
 	type args struct {
 		paths []string
@@ -358,9 +628,133 @@ func TestCollection_ModulesLen(t *testing.T) {
 			if gotLength := c.ModulesLen(); gotLength != tt.wantLength {
 				t.Errorf("Collection.ModulesLen() = %v, want %v", gotLength, tt.wantLength)
 			}
-			if gotLength := len(c.ms.Modules); gotLength != tt.wantLengthRaw {
+			if gotLength := len(c.s.ms.Modules); gotLength != tt.wantLengthRaw {
 				t.Errorf("Collection.len(.ms.Modules) = %v, want %v", gotLength, tt.wantLengthRaw)
 			}
 		})
 	}
 }
+
+func TestCollection_DataChild(t *testing.T) {
+	SetYANGPath("testdata")
+	c := NewCollection()
+	c.ImportAll()
+	if errs := c.Process(); errs != nil {
+		t.Fatalf("Collection.Process() = %v", errs)
+	}
+	system := yang.ToEntry(c.s.ms.Modules["test"]).Dir["system"]
+	tests := []struct {
+		local string
+		want  *yang.Entry
+	}{
+		{"host-name", system.Dir["host-name"]},
+		{"domain", system.Dir["domain"]},
+		{"banner", system.Dir["login"].Dir["banner"].Dir["banner"]},
+		{"password", system.Dir["login"].Dir["local"].Dir["method"].Dir["password"].Dir["password"]},
+		{"login", nil},
+		{"resolver", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.local, func(t *testing.T) {
+			for i := 0; i < 2; i++ {
+				if got := c.DataChild(system, tt.local); got != tt.want {
+					t.Errorf("Collection.DataChild() lookup %d = %v, want %v", i, got, tt.want)
+				}
+			}
+		})
+	}
+	if got := c.DataChild(nil, "host-name"); got != nil {
+		t.Errorf("Collection.DataChild(nil) = %v, want nil", got)
+	}
+}
+
+func TestCollection_SchemaOrder(t *testing.T) {
+	c := NewCollection()
+	for _, src := range []string{
+		`module order { namespace urn:o; prefix o;
+  grouping addr { leaf address { type string; } }
+  list entry { key "id"; leaf value { type string; } leaf id { type string; } }
+  container top {
+    leaf last { type string; }
+    choice kind { leaf beta { type string; } case a { uses addr; } }
+    leaf first { type string; }
+  } }`,
+		`module order-aug { namespace urn:oa; prefix oa; import order { prefix o; }
+  augment /o:top { leaf extra { type string; } leaf apex { type string; } } }`,
+	} {
+		if err := c.s.ms.Parse(src, "order"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if errs := c.Process(); errs != nil {
+		t.Fatalf("Collection.Process() = %v", errs)
+	}
+	me, err := c.ModuleEntry("order")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int{"last": 0, "beta": 1, "address": 2, "first": 3, "apex": 4, "extra": 5}
+	if got := c.SchemaOrder(me.Dir["top"]); !reflect.DeepEqual(got, want) {
+		t.Errorf("Collection.SchemaOrder(top) = %v, want %v", got, want)
+	}
+	if got := c.SchemaOrder(me.Dir["entry"]); !reflect.DeepEqual(got, map[string]int{"id": 0, "value": 1}) {
+		t.Errorf("Collection.SchemaOrder(entry) = %v, want the key first", got)
+	}
+
+	// orders are discarded with the schema they were built from
+	if err := c.Remove("order-aug"); err != nil {
+		t.Fatal(err)
+	}
+	if errs := c.Process(); errs != nil {
+		t.Fatalf("Collection.Process() = %v", errs)
+	}
+	if me, err = c.ModuleEntry("order"); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.SchemaOrder(me.Dir["top"]); len(got) != 4 {
+		t.Errorf("Collection.SchemaOrder(top) after Remove = %v, want no augmented nodes", got)
+	}
+	if got := len(c.s.orders); got != 1 {
+		t.Errorf("Collection.orders holds %d orders, want 1", got)
+	}
+}
+
+func TestCollection_ImportRevision(t *testing.T) {
+	tests := []struct {
+		name       string
+		module     string
+		wantErr    bool
+		wantSystem bool
+	}{
+		{name: "latest", module: "test", wantSystem: true},
+		{name: "old revision", module: "test@1999-01-01"},
+		{name: "latest revision", module: "test@2017-01-01", wantSystem: true},
+		{name: "invalid revision", module: "test@latest", wantErr: true},
+		{name: "missing revision", module: "test@2000-01-01", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetYANGPath("testdata/...")
+			c := NewCollection()
+			if err := c.Import(tt.module); (err != nil) != tt.wantErr {
+				t.Fatalf("Collection.Import() error = %v, wantErr %v", err, tt.wantErr)
+			} else if tt.wantErr {
+				return
+			}
+			if errs := c.Process(); errs != nil {
+				t.Fatalf("Collection.Process() = %v", errs)
+			}
+			e, err := c.ModuleEntry("test")
+			if err != nil {
+				t.Fatalf("Collection.ModuleEntry() error = %v", err)
+			}
+			if got := e.Dir["system"] != nil; got != tt.wantSystem {
+				t.Errorf("Collection.ModuleEntry() has system container = %v, want %v", got, tt.wantSystem)
+			}
+			_, err = c.RootEntry(xml.Name{Space: "urn:opr8:modules:test:test", Local: "system"})
+			if (err == nil) != tt.wantSystem {
+				t.Errorf("Collection.RootEntry() error = %v, want system container %v", err, tt.wantSystem)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package modules
+
+import (
+	"github.com/openconfig/goyang/pkg/yang"
+	"github.com/pkg/errors"
+)
+
+// Mount declares the container or list schema node with the schema
+// node identifier id a schema mount point (RFC 8528), and mounts the
+// schema of the collection schema there. The top-level data nodes of
+// schema's modules are then the children of the mount point's data
+// nodes, as reported by Mounted. Both collections must be processed.
+// If schema is nil, any schema mounted at id is unmounted.
+//
+// Mount points are kept by identifier, and are found again each time
+// the collection is processed.
+func (c *Collection) Mount(id string, schema *Collection) error {
+	if schema != nil {
+		if schema == c {
+			return errors.Errorf("%s: cannot mount a collection within itself", id)
+		} else if !schema.current().processed {
+			return errors.Errorf("%s: mounted collection must be processed", id)
+		}
+		e, err := c.SchemaNode(id)
+		if err != nil {
+			return err
+		}
+		if !e.IsContainer() && !e.IsList() {
+			return errors.Errorf("%s: mount point must be a container or list", id)
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if schema == nil {
+		delete(c.mounts, id)
+	} else {
+		if c.mounts == nil {
+			c.mounts = map[string]*Collection{}
+		}
+		c.mounts[id] = schema
+	}
+	c.s.resolveMounts(c.mounts)
+	return nil
+}
+
+// Mounted returns the collection mounted at the schema node e by
+// Mount, or nil if e is not a mount point.
+func (c *Collection) Mounted(e *yang.Entry) *Collection {
+	return c.current().mountPoints[e]
+}
+
+// resolveMounts finds the schema nodes of the mount points mounts in
+// the processed schema. Mount points not in the schema are kept by the
+// collection, but are not reported by Mounted.
+func (s *schema) resolveMounts(mounts map[string]*Collection) {
+	points := map[*yang.Entry]*Collection{}
+	for id, mounted := range mounts {
+		if e, err := s.schemaNode(id); err == nil && (e.IsContainer() || e.IsList()) {
+			points[e] = mounted
+		}
+	}
+	s.mountPoints = points
+}
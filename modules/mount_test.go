@@ -0,0 +1,72 @@
+package modules
+
+import (
+	"testing"
+)
+
+func TestCollection_Mount(t *testing.T) {
+	parent, mounted := NewCollection(), NewCollection()
+	if err := parent.ReadString("lne", `module lne {
+  namespace urn:lne; prefix lne;
+  list lne { key name; leaf name { type string; } container root; }
+}`); err != nil {
+		t.Fatal(err)
+	}
+	if err := mounted.ReadString("inner", `module inner { namespace urn:inner; prefix in; container system; }`); err != nil {
+		t.Fatal(err)
+	}
+	if err := parent.Mount("/lne:lne/root", mounted); err == nil {
+		t.Error("Collection.Mount() of unprocessed collection: want error")
+	}
+	for _, c := range []*Collection{parent, mounted} {
+		if errs := c.Process(); errs != nil {
+			t.Fatalf("Collection.Process() = %v", errs)
+		}
+	}
+
+	for _, tt := range []struct {
+		name    string
+		id      string
+		schema  *Collection
+		wantErr bool
+	}{
+		{name: "container", id: "/lne:lne/root", schema: mounted},
+		{name: "list", id: "/lne:lne", schema: mounted},
+		{name: "leaf", id: "/lne:lne/name", schema: mounted, wantErr: true},
+		{name: "unknown node", id: "/lne:lne/nope", schema: mounted, wantErr: true},
+		{name: "itself", id: "/lne:lne/root", schema: parent, wantErr: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := parent.Mount(tt.id, tt.schema); (err != nil) != tt.wantErr {
+				t.Errorf("Collection.Mount() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	root, err := parent.SchemaNode("/lne:lne/root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := parent.Mounted(root); got != mounted {
+		t.Errorf("Collection.Mounted() = %p, want %p", got, mounted)
+	}
+	// mount points are found again once processed
+	if errs := parent.Process(); errs != nil {
+		t.Fatalf("Collection.Process() = %v", errs)
+	}
+	if root, err = parent.SchemaNode("/lne:lne/root"); err != nil {
+		t.Fatal(err)
+	}
+	if got := parent.Mounted(root); got != mounted {
+		t.Errorf("Collection.Mounted() after Process = %p, want %p", got, mounted)
+	}
+	if err := parent.Mount("/lne:lne/root", nil); err != nil {
+		t.Fatalf("Collection.Mount(nil) = %v", err)
+	}
+	if got := parent.Mounted(root); got != nil {
+		t.Errorf("Collection.Mounted() after unmount = %p, want nil", got)
+	}
+	if got := parent.Mounted(root.Parent); got != mounted {
+		t.Errorf("Collection.Mounted() of list = %p, want %p", got, mounted)
+	}
+}
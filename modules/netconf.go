@@ -0,0 +1,168 @@
+package modules
+
+import (
+	"bytes"
+	"context"
+	"strings"
+
+	xml "github.com/andaru/flexml"
+	"github.com/pkg/errors"
+)
+
+// NetconfMonitoringNamespace is the XML namespace of
+// ietf-netconf-monitoring (RFC 6022).
+const NetconfMonitoringNamespace = "urn:ietf:params:xml:ns:yang:ietf-netconf-monitoring"
+
+const netconfBaseNamespace = "urn:ietf:params:xml:ns:netconf:base:1.0"
+
+// YangLibraryCapability is the NETCONF capability URI of the yang
+// library (RFC 8526), without its parameters.
+const YangLibraryCapability = "urn:ietf:params:netconf:capability:yang-library:1.1"
+
+// yangLibraryRevision is the ietf-yang-library revision advertised by
+// the yang library capability.
+const yangLibraryRevision = "2019-01-04"
+
+// Capabilities returns the NETCONF capability URIs describing the
+// collection, for a server's <hello> message: the yang library
+// capability, with the content-id of YangLibrary, followed by a module
+// capability (RFC 6020) for each YANG version 1 module, which clients
+// not supporting the yang library use to discover the server's
+// schema. YANG version 1.1 modules are reported only by the yang
+// library, as required by RFC 7950.
+func (c *Collection) Capabilities() ([]string, error) {
+	s := c.current()
+	if !s.processed {
+		return nil, errors.New("must call Process first")
+	}
+	mods := s.libraryModules()
+	caps := []string{YangLibraryCapability + "?revision=" + yangLibraryRevision + "&content-id=" + libraryContentID(mods)}
+	for _, m := range mods {
+		if m.version != "1" || m.namespace == "" {
+			continue
+		}
+		uri := m.namespace + "?module=" + m.name
+		if m.revision != "" {
+			uri += "&revision=" + m.revision
+		}
+		if len(m.features) > 0 {
+			uri += "&features=" + strings.Join(m.features, ",")
+		}
+		if len(m.deviations) > 0 {
+			uri += "&deviations=" + strings.Join(m.deviations, ",")
+		}
+		caps = append(caps, uri)
+	}
+	return caps, nil
+}
+
+// RPCClient is the interface to a NETCONF client session used by
+// ImportNETCONF to retrieve the schemas of a server.
+type RPCClient interface {
+	// RPC sends a NETCONF <rpc> request containing the operation
+	// element request, and returns the content of the <rpc-reply>
+	// element received in response, e.g., a <data> element. An
+	// <rpc-reply> containing an <rpc-error> is returned as an error.
+	RPC(ctx context.Context, request []byte) ([]byte, error)
+}
+
+// netconfSchema is a schema list entry of ietf-netconf-monitoring.
+type netconfSchema struct {
+	Identifier string   `xml:"identifier"`
+	Version    string   `xml:"version"`
+	Format     string   `xml:"format"`
+	Location   []string `xml:"location"`
+}
+
+// ImportNETCONF reads the YANG modules and submodules supported by a
+// NETCONF server, using the client session client. The server's
+// schema list is read from the ietf-netconf-monitoring state data,
+// and each YANG schema available via NETCONF not already read is
+// retrieved with the <get-schema> operation (RFC 6022).
+//
+// An error is returned for the schema list, or for each schema which
+// could not be retrieved or read. Process must be called before calls
+// to ModuleEntry after this returns.
+func (c *Collection) ImportNETCONF(ctx context.Context, client RPCClient) []error {
+	reply, err := client.RPC(ctx, []byte(`<get xmlns="`+netconfBaseNamespace+`"><filter type="subtree">`+
+		`<netconf-state xmlns="`+NetconfMonitoringNamespace+`"><schemas/></netconf-state></filter></get>`))
+	if err != nil {
+		return []error{errors.Wrap(err, "schema list")}
+	}
+	var data struct {
+		Schemas []netconfSchema `xml:"netconf-state>schemas>schema"`
+	}
+	if err := xml.Unmarshal(reply, &data); err != nil {
+		return []error{errors.Wrap(err, "invalid schema list")}
+	}
+
+	var errs []error
+	for _, schema := range data.Schemas {
+		name := schema.Identifier
+		if schema.Version != "" {
+			name += "@" + schema.Version
+		}
+		if !isNETCONFYANGSchema(schema) || c.hasModule(name) {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return append(errs, err)
+		}
+		text, err := getSchema(ctx, client, schema)
+		if err != nil {
+			errs = append(errs, importError{name, err.Error()})
+			continue
+		}
+		if err := c.parse(text, name); err != nil {
+			errs = append(errs, importError{name, err.Error()})
+		}
+	}
+	return errs
+}
+
+// isNETCONFYANGSchema returns true if schema is in YANG format, and
+// can be retrieved with <get-schema>.
+func isNETCONFYANGSchema(schema netconfSchema) bool {
+	format := schema.Format
+	if i := strings.IndexByte(format, ':'); i >= 0 {
+		format = format[i+1:]
+	}
+	if format != "yang" || schema.Identifier == "" {
+		return false
+	}
+	for _, location := range schema.Location {
+		if location == "NETCONF" {
+			return true
+		}
+	}
+	return false
+}
+
+// getSchema returns the source of schema, retrieved from the server.
+func getSchema(ctx context.Context, client RPCClient, schema netconfSchema) (string, error) {
+	var req bytes.Buffer
+	req.WriteString(`<get-schema xmlns="` + NetconfMonitoringNamespace + `"><identifier>`)
+	_ = xml.EscapeText(&req, []byte(schema.Identifier))
+	req.WriteString(`</identifier>`)
+	if schema.Version != "" {
+		req.WriteString(`<version>`)
+		_ = xml.EscapeText(&req, []byte(schema.Version))
+		req.WriteString(`</version>`)
+	}
+	req.WriteString(`<format>yang</format></get-schema>`)
+
+	reply, err := client.RPC(ctx, req.Bytes())
+	if err != nil {
+		return "", err
+	}
+	var data struct {
+		Text string `xml:",chardata"`
+	}
+	if err := xml.Unmarshal(reply, &data); err != nil {
+		return "", errors.Wrap(err, "invalid get-schema reply")
+	}
+	if strings.TrimSpace(data.Text) == "" {
+		return "", errors.New("empty get-schema reply")
+	}
+	return data.Text, nil
+}
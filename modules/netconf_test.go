@@ -0,0 +1,154 @@
+package modules
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	xml "github.com/andaru/flexml"
+	"github.com/openconfig/goyang/pkg/yang"
+)
+
+// fakeNETCONF is a NETCONF server serving the YANG sources in schemas
+type fakeNETCONF struct {
+	schemaList string
+	schemas    map[string]string
+	requests   []string
+}
+
+var identifierRE = regexp.MustCompile(`<identifier>([^<]*)</identifier>`)
+
+func (f *fakeNETCONF) RPC(ctx context.Context, request []byte) ([]byte, error) {
+	f.requests = append(f.requests, string(request))
+	if bytes.HasPrefix(request, []byte("<get ")) {
+		return []byte(f.schemaList), nil
+	}
+	m := identifierRE.FindSubmatch(request)
+	if m == nil {
+		return nil, errors.New("bad request")
+	}
+	text, ok := f.schemas[string(m[1])]
+	if !ok {
+		return nil, errors.New("invalid-value")
+	}
+	var b bytes.Buffer
+	b.WriteString(`<data xmlns="` + NetconfMonitoringNamespace + `">`)
+	_ = xml.EscapeText(&b, []byte(text))
+	b.WriteString(`</data>`)
+	return b.Bytes(), nil
+}
+
+func TestCollection_ImportNETCONF(t *testing.T) {
+	test, err := ioutil.ReadFile("testdata/test@2017-01-01.yang")
+	if err != nil {
+		t.Fatal(err)
+	}
+	schemaEntry := func(id, version, format string, locations ...string) string {
+		s := `<schema><identifier>` + id + `</identifier><version>` + version + `</version><format>` + format + `</format>`
+		for _, loc := range locations {
+			s += `<location>` + loc + `</location>`
+		}
+		return s + `</schema>`
+	}
+	server := &fakeNETCONF{
+		schemaList: `<data xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><netconf-state xmlns="` + NetconfMonitoringNamespace + `"><schemas>` +
+			schemaEntry("test", "2017-01-01", "ncm:yang", "NETCONF") +
+			schemaEntry("other", "", "yang", "https://example.com/other.yang", "NETCONF") +
+			schemaEntry("test", "2017-01-01", "ncm:yin", "NETCONF") +
+			schemaEntry("remote", "", "yang", "https://example.com/remote.yang") +
+			schemaEntry("missing", "2020-01-01", "yang", "NETCONF") +
+			`</schemas></netconf-state></data>`,
+		schemas: map[string]string{
+			"test":  string(test),
+			"other": `module other { namespace "urn:other"; prefix o; leaf x { type string; } }`,
+		},
+	}
+
+	c := NewCollection()
+	errs := c.ImportNETCONF(context.Background(), server)
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "missing@2020-01-01") {
+		t.Errorf("Collection.ImportNETCONF() = %v, want an error for missing@2020-01-01", errs)
+	}
+	if errs := c.Process(); errs != nil {
+		t.Fatalf("Collection.Process() = %v", errs)
+	}
+	var got []string
+	_ = c.IterLatest(func(m *yang.Module) error {
+		got = append(got, m.Name)
+		return nil
+	})
+	if want := []string{"other", "test"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("modules = %v, want %v", got, want)
+	}
+	if len(server.requests) != 4 {
+		t.Errorf("RPC requests = %d, want 4 (schema list and 3 get-schema)", len(server.requests))
+	}
+
+	// schemas already read are not retrieved again
+	server.requests = nil
+	if errs := c.ImportNETCONF(context.Background(), server); len(errs) != 1 {
+		t.Errorf("Collection.ImportNETCONF() = %v, want 1 error", errs)
+	}
+	if len(server.requests) != 2 {
+		t.Errorf("RPC requests = %d, want 2 (schema list and missing schema)", len(server.requests))
+	}
+
+	server.schemaList = `<data><bad`
+	if errs := c.ImportNETCONF(context.Background(), server); len(errs) != 1 {
+		t.Errorf("Collection.ImportNETCONF() with invalid schema list = %v, want 1 error", errs)
+	}
+}
+
+func TestCollection_Capabilities(t *testing.T) {
+	SetYANGPath("testdata")
+	c := NewCollection()
+	if _, err := c.Capabilities(); err == nil {
+		t.Errorf("Collection.Capabilities() before Process error = nil, wantErr true")
+	}
+	for name, data := range map[string]string{
+		"cap-base": `module cap-base {
+  namespace "urn:cap:base"; prefix cb;
+  revision 2020-01-01;
+  feature beta; feature alpha;
+  container top { leaf x { type string; } }
+}`,
+		"cap-dev": `module cap-dev {
+  namespace "urn:cap:dev"; prefix cd;
+  import cap-base { prefix cb; }
+  deviation /cb:top/cb:x { deviate not-supported; }
+}`,
+		"cap-new": `module cap-new {
+  yang-version 1.1;
+  namespace "urn:cap:new"; prefix cn;
+  revision 2021-01-01;
+}`,
+	} {
+		if err := c.ReadString(name, data); err != nil {
+			t.Fatalf("Collection.ReadString(%s) error = %v", name, err)
+		}
+	}
+	if errs := c.Process(); errs != nil {
+		t.Fatalf("Collection.Process() = %v", errs)
+	}
+	_, id, err := c.YangLibrary()
+	if err != nil {
+		t.Fatalf("Collection.YangLibrary() error = %v", err)
+	}
+	got, err := c.Capabilities()
+	if err != nil {
+		t.Fatalf("Collection.Capabilities() error = %v", err)
+	}
+	want := []string{
+		"urn:ietf:params:netconf:capability:yang-library:1.1?revision=2019-01-04&content-id=" + id,
+		"urn:cap:base?module=cap-base&revision=2020-01-01&features=alpha,beta&deviations=cap-dev",
+		"urn:cap:dev?module=cap-dev",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Collection.Capabilities() = %q, want %q", got, want)
+	}
+}
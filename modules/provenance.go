@@ -0,0 +1,65 @@
+package modules
+
+import (
+	"fmt"
+
+	"github.com/openconfig/goyang/pkg/yang"
+	"github.com/pkg/errors"
+)
+
+// Provenance describes the module and augment statement introducing a
+// schema node.
+type Provenance struct {
+	// Module is the name of the module defining the node, or that
+	// the defining submodule belongs to.
+	Module string
+	// Augment is the augment statement of Module adding the node, or
+	// its nearest ancestor, to the schema tree of another module, or
+	// nil if the node is not added by an augment.
+	Augment *yang.Augment
+}
+
+func (p Provenance) String() string {
+	if p.Augment != nil {
+		return fmt.Sprintf("augment %s from module %s", p.Augment.Name, p.Module)
+	}
+	return "module " + p.Module
+}
+
+// Provenance returns the provenance of the schema node e, such as to
+// filter data by the modules a client supports, or to report that a
+// node was added by an augment of another module.
+func (c *Collection) Provenance(e *yang.Entry) (Provenance, error) {
+	if e == nil {
+		return Provenance{}, errors.New("nil schema node")
+	}
+	ns := e.Namespace()
+	if ns == nil || ns.Name == "" {
+		return Provenance{}, errors.Errorf("schema node %s has no namespace", e.Path())
+	}
+	mod, err := c.current().moduleByNamespace(ns.Name)
+	if err != nil {
+		return Provenance{}, errors.Wrapf(err, "schema node %s", e.Path())
+	}
+	return Provenance{Module: mod.Name, Augment: augmentOf(e)}, nil
+}
+
+// augmentOf returns the augment statement adding e or its nearest
+// ancestor to the tree of its parent, or nil.
+func augmentOf(e *yang.Entry) *yang.Augment {
+	for ; e.Parent != nil; e = e.Parent {
+		ns := e.Namespace()
+		for _, aug := range e.Parent.Augmented {
+			if aug.Dir[e.Name] == nil {
+				continue
+			}
+			if augNS := aug.Namespace(); ns != nil && augNS != nil && augNS.Name != ns.Name {
+				continue
+			}
+			if a, ok := aug.Node.(*yang.Augment); ok {
+				return a
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package modules
+
+import (
+	"testing"
+)
+
+func TestCollection_Provenance(t *testing.T) {
+	c := NewCollection()
+	for name, src := range map[string]string{
+		"ex": `module ex {
+  namespace urn:ex; prefix e;
+  container server { leaf address { type string; } }
+  augment /e:server { leaf enabled { type boolean; } }
+}`,
+		"ex-aug": `module ex-aug {
+  namespace urn:ex-aug; prefix a;
+  import ex { prefix e; }
+  grouping tls { container tls { leaf cert { type string; } } }
+  augment /e:server { leaf port { type uint16; } uses tls; }
+}`,
+	} {
+		if err := c.s.ms.Parse(src, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if errs := c.Process(); errs != nil {
+		t.Fatalf("Collection.Process() = %v", errs)
+	}
+
+	tests := []struct {
+		id   string
+		want string
+	}{
+		{"/e:server", "module ex"},
+		{"/e:server/address", "module ex"},
+		{"/e:server/enabled", "augment /e:server from module ex"},
+		{"/e:server/a:port", "augment /e:server from module ex-aug"},
+		{"/e:server/a:tls/cert", "augment /e:server from module ex-aug"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			e, err := c.SchemaNode(tt.id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := c.Provenance(e)
+			if err != nil {
+				t.Fatalf("Collection.Provenance() error = %v", err)
+			}
+			if got.String() != tt.want {
+				t.Errorf("Collection.Provenance() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+	if _, err := c.Provenance(nil); err == nil {
+		t.Error("Collection.Provenance(nil): want error")
+	}
+}
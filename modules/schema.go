@@ -0,0 +1,201 @@
+package modules
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	xml "github.com/andaru/flexml"
+	"github.com/openconfig/goyang/pkg/yang"
+	"github.com/pkg/errors"
+)
+
+// goyangMu serializes the use of goyang's global cache of schema
+// entries, which Modules.Process resets, and ToEntry and Entry.Find
+// read and add to.
+var goyangMu sync.Mutex
+
+// schema is the modules read by a collection and the state built from
+// them by Process. Watch builds the schema of the modules it reads
+// anew, and replaces that of the collection with it in one step, so
+// that readers see the modules, schema entries and indexes of one
+// reload.
+type schema struct {
+	ms        *yang.Modules
+	processed bool
+	// pinned maps module names to the revision selected by Import or
+	// WithPinnedRevisions
+	pinned map[string]string
+	policy RevisionPolicy
+	// fingerprint is that of the modules when last processed
+	fingerprint string
+	// entries holds the schema entries of the modules as built by
+	// Process, as goyang discards its own when any collection is
+	// processed
+	entries map[*yang.Module]*yang.Entry
+	// namespaces and roots index the selected modules by namespace,
+	// and their top-level schema nodes by qualified name
+	namespaces map[string]*yang.Module
+	roots      map[xml.Name]*yang.Entry
+	// mountPoints are the schema nodes of the schema mount points
+	mountPoints map[*yang.Entry]*Collection
+
+	// mu guards the indexes built on first use: children, used by
+	// DataChild, orders, used by SchemaOrder, the identity graph, and
+	// the digests of the module sources used by Fingerprint
+	mu            sync.Mutex
+	children      map[*yang.Entry]childIndex
+	orders        map[*yang.Entry]map[string]int
+	identityGraph *identityGraph
+	digests       map[*yang.Module][]byte
+}
+
+// module returns the module with the name, in its pinned revision,
+// if any, or the revision selected by the schema's policy.
+func (s *schema) module(name string) *yang.Module {
+	if revision, ok := s.pinned[name]; ok {
+		if mod := s.ms.Modules[name+"@"+revision]; mod != nil {
+			return mod
+		}
+	}
+	var selected *yang.Module
+	var selectedDate time.Time
+	for _, mod := range s.ms.Modules {
+		if mod.Name != name {
+			continue
+		}
+		_, date := latestRevision(mod)
+		switch {
+		case selected == nil:
+		case s.policy == RevisionEarliest:
+			// modules without a valid revision date are selected last
+			if date.IsZero() || !selectedDate.IsZero() && !date.Before(selectedDate) {
+				continue
+			}
+		case !date.After(selectedDate):
+			continue
+		}
+		selected, selectedDate = mod, date
+	}
+	return selected
+}
+
+// moduleNames returns the names of the modules, in sorted order.
+func (s *schema) moduleNames() []string {
+	seen := map[string]bool{}
+	var names []string
+	for _, mod := range s.ms.Modules {
+		if !seen[mod.Name] {
+			seen[mod.Name] = true
+			names = append(names, mod.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// latest returns the selected revision of each module, in module name
+// order, as iterated by IterLatest.
+func (s *schema) latest() []*yang.Module {
+	names := s.moduleNames()
+	mods := make([]*yang.Module, 0, len(names))
+	for _, name := range names {
+		mods = append(mods, s.module(name))
+	}
+	return mods
+}
+
+// entry returns the schema entry of the module mod.
+func (s *schema) entry(mod *yang.Module) *yang.Entry {
+	if e := s.entries[mod]; e != nil {
+		return e
+	}
+	goyangMu.Lock()
+	defer goyangMu.Unlock()
+	return yang.ToEntry(mod)
+}
+
+// moduleEntry returns the schema entry of the selected revision of the
+// module with the name.
+func (s *schema) moduleEntry(name string) (*yang.Entry, error) {
+	if !s.processed {
+		return nil, errors.New("must call Process first")
+	}
+	if mod := s.module(name); mod != nil {
+		return s.entry(mod), nil
+	}
+	return nil, errors.New("not found")
+}
+
+// moduleByNamespace returns the selected module with the namespace ns.
+func (s *schema) moduleByNamespace(ns string) (*yang.Module, error) {
+	if !s.processed {
+		return nil, errors.New("must call Process first")
+	}
+	if mod, ok := s.namespaces[ns]; ok {
+		return mod, nil
+	}
+	return nil, errors.Errorf("no module with namespace %q", ns)
+}
+
+// process processes the modules, building their schema entries, unless
+// they have the fingerprint of the modules last processed.
+func (s *schema) process(mounts map[string]*Collection) []error {
+	fingerprint := s.hash()
+	if s.fingerprint != "" && s.fingerprint == fingerprint {
+		s.processed = true
+		return nil
+	}
+	goyangMu.Lock()
+	errs := s.ms.Process()
+	s.processed = len(errs) == 0
+	s.fingerprint = ""
+	entries := map[*yang.Module]*yang.Entry{}
+	if s.processed {
+		s.fingerprint = fingerprint
+		for _, mod := range s.ms.Modules {
+			entries[mod] = yang.ToEntry(mod)
+		}
+	}
+	goyangMu.Unlock()
+	s.entries = entries
+	s.buildIndex(mounts)
+	return errs
+}
+
+// invalidate discards the processed state of the schema, and the
+// indexes and caches built from it, when modules are removed: the
+// schema entries and source digests, and by buildIndex, the roots,
+// children, schema orders, identities and mount points.
+func (s *schema) invalidate(mounts map[string]*Collection) {
+	s.processed, s.fingerprint, s.entries = false, "", nil
+	s.mu.Lock()
+	s.digests = nil
+	s.mu.Unlock()
+	s.buildIndex(mounts)
+}
+
+// buildIndex indexes the modules by namespace, and their top-level
+// schema nodes by qualified name, for RootEntry, and finds the schema
+// nodes of the mount points mounts. The indexes built on first use are
+// discarded.
+func (s *schema) buildIndex(mounts map[string]*Collection) {
+	namespaces := map[string]*yang.Module{}
+	roots := map[xml.Name]*yang.Entry{}
+	if s.processed {
+		for _, mod := range s.latest() {
+			if mod.Namespace == nil {
+				continue
+			}
+			namespaces[mod.Namespace.Name] = mod
+			for local, e := range s.entry(mod).Dir {
+				roots[xml.Name{Space: mod.Namespace.Name, Local: local}] = e
+			}
+		}
+	}
+	s.namespaces, s.roots = namespaces, roots
+	s.mu.Lock()
+	s.children, s.orders, s.identityGraph = nil, nil, nil
+	s.mu.Unlock()
+	s.resolveMounts(mounts)
+}
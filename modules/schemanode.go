@@ -0,0 +1,119 @@
+package modules
+
+import (
+	"strings"
+
+	"github.com/openconfig/goyang/pkg/yang"
+	"github.com/pkg/errors"
+)
+
+// SchemaNode returns the schema node with the absolute schema node
+// identifier id, e.g., "/if:interfaces/if:interface/if:name". Each
+// node identifier may be qualified by a module prefix or by a module
+// name, as in "/ietf-interfaces:interfaces/interface"; the first must
+// be qualified, and unqualified identifiers are in the module of the
+// preceding one. The leading "/" is optional.
+//
+// Choice and case nodes may be named in the identifier, as in schema
+// node identifiers, or omitted, as in data paths. The implicit case
+// of a shorthand case statement resolves to the node it contains. The
+// "input" and "output" nodes of RPCs and actions are supported. Nodes
+// defined in groupings are found at the point of their use.
+func (c *Collection) SchemaNode(id string) (*yang.Entry, error) {
+	return c.current().schemaNode(id)
+}
+
+func (s *schema) schemaNode(id string) (*yang.Entry, error) {
+	if !s.processed {
+		return nil, errors.New("must call Process first")
+	}
+	path := strings.TrimPrefix(id, "/")
+	if path == "" {
+		return nil, errors.Errorf("invalid schema node identifier %q", id)
+	}
+	var e *yang.Entry
+	var ns string
+	for _, elem := range strings.Split(path, "/") {
+		prefix, local := "", elem
+		if i := strings.IndexByte(elem, ':'); i >= 0 {
+			prefix, local = elem[:i], elem[i+1:]
+		}
+		if local == "" {
+			return nil, errors.Errorf("invalid schema node identifier %q", id)
+		}
+		if prefix != "" {
+			mod := s.prefixModule(prefix)
+			if mod == nil || mod.Namespace == nil {
+				return nil, errors.Errorf("%s: unknown module %q", id, prefix)
+			}
+			ns = mod.Namespace.Name
+			if e == nil {
+				e = s.entry(mod)
+			}
+		} else if e == nil {
+			return nil, errors.Errorf("%s: first node identifier must have a module prefix", id)
+		}
+
+		child := schemaChild(e, local)
+		if sc := shorthandCase(e); child == nil && sc != nil {
+			e = sc
+			child = schemaChild(e, local)
+		}
+		if child == nil {
+			child = s.dataChild(e, local)
+		}
+		if child == nil || child.Namespace() != nil && child.Namespace().Name != ns {
+			return nil, errors.Errorf("%s: no schema node %q in %s", id, elem, e.Path())
+		}
+		e = child
+	}
+	if sc := shorthandCase(e); sc != nil {
+		e = sc
+	}
+	return e, nil
+}
+
+// shorthandCase returns the child of e if e is the implicit case node
+// of a choice's shorthand case statement, or nil.
+func shorthandCase(e *yang.Entry) *yang.Entry {
+	if !e.IsCase() || len(e.Dir) != 1 {
+		return nil
+	}
+	// goyang adds a case node for shorthand cases, whose statement is
+	// that of the node within it
+	if cs, ok := e.Node.(*yang.Case); ok && cs.Source != nil && cs.Source.Keyword == "case" {
+		return nil
+	}
+	for _, child := range e.Dir {
+		return child
+	}
+	return nil
+}
+
+// schemaChild returns the child of the schema node e named local,
+// including the input and output nodes of an RPC or action, or nil.
+func schemaChild(e *yang.Entry, local string) *yang.Entry {
+	if e.RPC != nil {
+		switch local {
+		case "input":
+			return e.RPC.Input
+		case "output":
+			return e.RPC.Output
+		}
+	}
+	return e.Dir[local]
+}
+
+// prefixModule returns the module with the name or prefix given, in
+// the revision used by IterLatest, or nil if none exists.
+func (s *schema) prefixModule(prefix string) *yang.Module {
+	if mod := s.module(prefix); mod != nil {
+		return mod
+	}
+	for _, mod := range s.latest() {
+		if mod.Prefix != nil && mod.Prefix.Name == prefix {
+			return mod
+		}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package modules
+
+import (
+	"testing"
+)
+
+func TestCollection_SchemaNode(t *testing.T) {
+	c := NewCollection()
+	if _, err := c.SchemaNode("/test:system"); err == nil {
+		t.Error("Collection.SchemaNode() before Process: want error")
+	}
+	for name, src := range map[string]string{
+		"ex": `module ex {
+  namespace urn:ex; prefix e;
+  grouping addr { leaf address { type string; } }
+  container server { uses addr; }
+  rpc restart { input { leaf delay { type uint32; } } output { leaf status { type string; } } }
+}`,
+		"ex-aug": `module ex-aug {
+  namespace urn:ex-aug; prefix a;
+  import ex { prefix e; }
+  augment /e:server { leaf port { type uint16; } }
+}`,
+	} {
+		if err := c.s.ms.Parse(src, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	SetYANGPath("testdata/...")
+	if err := c.Import("test"); err != nil {
+		t.Fatal(err)
+	}
+	if errs := c.Process(); errs != nil {
+		t.Fatalf("Collection.Process() = %v", errs)
+	}
+
+	tests := []struct {
+		id       string
+		wantPath string
+		wantErr  bool
+	}{
+		{id: "/test:system", wantPath: "/test/system"},
+		{id: "test:system/host-name", wantPath: "/test/system/host-name"},
+		{id: "/test:system/test:domain/resolver", wantPath: "/test/system/domain/resolver"},
+		{id: "/test:system/login/local/method/password", wantPath: "/test/system/login/local/method/password/password"},
+		{id: "/test:system/login/local/method/password/password", wantPath: "/test/system/login/local/method/password/password"},
+		{id: "/test:system/password", wantPath: "/test/system/login/local/method/password/password"},
+		{id: "/test:system/login/banner", wantPath: "/test/system/login/banner/banner"},
+		{id: "/test:system/login/local", wantPath: "/test/system/login/local"},
+		{id: "/e:server/address", wantPath: "/ex/server/address"},
+		{id: "/ex:server/ex:address", wantPath: "/ex/server/address"},
+		{id: "/e:server/a:port", wantPath: "/ex/server/port"},
+		{id: "/e:restart/input/delay", wantPath: "/ex/restart/input/delay"},
+		{id: "/e:restart/output/status", wantPath: "/ex/restart/output/status"},
+
+		{id: "", wantErr: true},
+		{id: "/", wantErr: true},
+		{id: "/system", wantErr: true},
+		{id: "/test:system/", wantErr: true},
+		{id: "/nope:system", wantErr: true},
+		{id: "/test:system/nope", wantErr: true},
+		{id: "/e:server/port", wantErr: true},
+		{id: "/e:server/a:address", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			got, err := c.SchemaNode(tt.id)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Collection.SchemaNode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got.Path() != tt.wantPath {
+				t.Errorf("Collection.SchemaNode() = %s, want %s", got.Path(), tt.wantPath)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package modules
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/openconfig/goyang/pkg/yang"
+)
+
+// SearchMatch is what a SearchResult matched.
+type SearchMatch int
+
+const (
+	// MatchModule is a match of a module name.
+	MatchModule SearchMatch = 1 + iota
+	// MatchName is a match of a schema node name.
+	MatchName
+	// MatchDescription is a match of the description of a module or
+	// schema node.
+	MatchDescription
+)
+
+func (m SearchMatch) String() string {
+	switch m {
+	case MatchModule:
+		return "module"
+	case MatchName:
+		return "name"
+	case MatchDescription:
+		return "description"
+	}
+	return "unknown"
+}
+
+// SearchResult is a module or schema node found by Search.
+type SearchResult struct {
+	// Module is the name of the module, or of the module defining
+	// the schema node.
+	Module string
+	// Path is the data path of the schema node, as accepted by
+	// SchemaNode, e.g., "/ietf-interfaces:interfaces/interface/name",
+	// or empty for a module.
+	Path  string
+	Match SearchMatch
+	// Entry is the schema node, or the module's entry.
+	Entry *yang.Entry
+}
+
+// Search returns the modules and schema nodes of the processed
+// collection whose names or descriptions contain q, ignoring case.
+// Schema nodes include RPCs and notifications, their inputs and
+// outputs, and the nodes added to other modules by augments. Module
+// matches are returned first, then name matches, then description
+// matches, each sorted by path; modules are matched in name order.
+func (c *Collection) Search(q string) []SearchResult {
+	sc := c.current()
+	if !sc.processed || q == "" {
+		return nil
+	}
+	s := &searcher{q: strings.ToLower(q), modules: map[string]string{}}
+	mods := sc.latest()
+	for _, mod := range mods {
+		if mod.Namespace != nil {
+			s.modules[mod.Namespace.Name] = mod.Name
+		}
+	}
+	for _, mod := range mods {
+		me := sc.entry(mod)
+		if s.match(mod.Name) {
+			s.results = append(s.results, SearchResult{Module: mod.Name, Match: MatchModule, Entry: me})
+		} else if mod.Description != nil && s.match(mod.Description.Name) {
+			s.results = append(s.results, SearchResult{Module: mod.Name, Match: MatchDescription, Entry: me})
+		}
+		for _, e := range sortedChildren(me) {
+			// augmenting nodes are found within the modules they augment
+			if ns := e.Namespace(); ns == nil || mod.Namespace == nil || ns.Name == mod.Namespace.Name {
+				s.walk(e, "", "")
+			}
+		}
+	}
+	sort.SliceStable(s.results, func(i, j int) bool {
+		ri, rj := s.results[i], s.results[j]
+		return ri.Match < rj.Match || ri.Match == rj.Match && ri.Path < rj.Path
+	})
+	return s.results
+}
+
+type searcher struct {
+	q string
+	// modules maps namespaces to module names
+	modules map[string]string
+	results []SearchResult
+}
+
+func (s *searcher) match(text string) bool {
+	return strings.Contains(strings.ToLower(text), s.q)
+}
+
+// walk searches the schema node e and its descendants, where e's
+// parent has the data path parent, in the module module.
+func (s *searcher) walk(e *yang.Entry, parent, module string) {
+	path := parent
+	if !e.IsChoice() && !e.IsCase() {
+		elem := e.Name
+		if ns := e.Namespace(); ns != nil && s.modules[ns.Name] != module {
+			module = s.modules[ns.Name]
+			elem = module + ":" + elem
+		}
+		path = parent + "/" + elem
+		switch {
+		case s.match(e.Name):
+			s.results = append(s.results, SearchResult{Module: module, Path: path, Match: MatchName, Entry: e})
+		case s.match(e.Description):
+			s.results = append(s.results, SearchResult{Module: module, Path: path, Match: MatchDescription, Entry: e})
+		}
+	}
+	if e.RPC != nil {
+		for _, io := range []*yang.Entry{e.RPC.Input, e.RPC.Output} {
+			if io != nil {
+				s.walk(io, path, module)
+			}
+		}
+		return
+	}
+	for _, ch := range sortedChildren(e) {
+		s.walk(ch, path, module)
+	}
+}
+
+// sortedChildren returns the children of e sorted by name.
+func sortedChildren(e *yang.Entry) []*yang.Entry {
+	children := make([]*yang.Entry, 0, len(e.Dir))
+	for _, ch := range e.Dir {
+		children = append(children, ch)
+	}
+	sort.Slice(children, func(i, j int) bool { return children[i].Name < children[j].Name })
+	return children
+}
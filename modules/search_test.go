@@ -0,0 +1,77 @@
+package modules
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCollection_Search(t *testing.T) {
+	c := NewCollection()
+	if got := c.Search("server"); got != nil {
+		t.Errorf("Collection.Search() before Process = %v, want nil", got)
+	}
+	for name, src := range map[string]string{
+		"ex": `module ex {
+  namespace urn:ex; prefix e;
+  description "Example server configuration.";
+  container server {
+    leaf address { type string; description "The server's listen address."; }
+    choice transport { case tcp { leaf tcp-port { type uint16; } } }
+  }
+  rpc restart-server { input { leaf delay { type uint32; } } }
+}`,
+		"ex-aug": `module ex-aug {
+  namespace urn:ex-aug; prefix a;
+  import ex { prefix e; }
+  augment /e:server { leaf port { type uint16; description "Server port."; } }
+}`,
+	} {
+		if err := c.ReadString(name, src); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if errs := c.Process(); errs != nil {
+		t.Fatalf("Collection.Process() = %v", errs)
+	}
+
+	type result struct {
+		Module, Path string
+		Match        SearchMatch
+	}
+	tests := []struct {
+		q    string
+		want []result
+	}{
+		{"ex-", []result{{"ex-aug", "", MatchModule}}},
+		{"SERVER", []result{
+			{"ex", "/ex:restart-server", MatchName},
+			{"ex", "/ex:server", MatchName},
+			{"ex", "", MatchDescription},
+			{"ex", "/ex:server/address", MatchDescription},
+			{"ex-aug", "/ex:server/ex-aug:port", MatchDescription},
+		}},
+		{"port", []result{
+			{"ex-aug", "/ex:server/ex-aug:port", MatchName},
+			{"ex", "/ex:server/tcp-port", MatchName},
+		}},
+		{"delay", []result{{"ex", "/ex:restart-server/input/delay", MatchName}}},
+		{"nothing", nil},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.q, func(t *testing.T) {
+			var got []result
+			for _, r := range c.Search(tt.q) {
+				got = append(got, result{r.Module, r.Path, r.Match})
+				if r.Path != "" {
+					if e, err := c.SchemaNode(r.Path); err != nil || e != r.Entry {
+						t.Errorf("Collection.SchemaNode(%s) = %v, %v, want %v", r.Path, e, err, r.Entry)
+					}
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Collection.Search() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
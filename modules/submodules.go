@@ -0,0 +1,86 @@
+package modules
+
+import (
+	"sort"
+
+	"github.com/openconfig/goyang/pkg/yang"
+	"github.com/pkg/errors"
+)
+
+// Submodules returns the latest revision of each submodule belonging
+// to the named module, sorted by name.
+func (c *Collection) Submodules(module string) []*yang.Module {
+	ms := c.Raw()
+	var subs []*yang.Module
+	seen := map[string]bool{}
+	for _, sub := range ms.SubModules {
+		if sub.BelongsTo == nil || sub.BelongsTo.Name != module || seen[sub.Name] {
+			continue
+		}
+		seen[sub.Name] = true
+		// prefer the entry without a revision suffix, the latest
+		if latest, ok := ms.SubModules[sub.Name]; ok {
+			sub = latest
+		}
+		subs = append(subs, sub)
+	}
+	sort.Slice(subs, func(i, j int) bool { return subs[i].Name < subs[j].Name })
+	return subs
+}
+
+// ParentModule returns the module to which the named submodule
+// belongs.
+func (c *Collection) ParentModule(submodule string) (*yang.Module, error) {
+	ms := c.Raw()
+	sub, ok := ms.SubModules[submodule]
+	if !ok {
+		return nil, errors.Errorf("submodule %s not found", submodule)
+	}
+	if sub.BelongsTo == nil {
+		return nil, errors.Errorf("submodule %s has no belongs-to statement", submodule)
+	}
+	mod, ok := ms.Modules[sub.BelongsTo.Name]
+	if !ok {
+		return nil, errors.Errorf("module %s of submodule %s not found", sub.BelongsTo.Name, submodule)
+	}
+	return mod, nil
+}
+
+// Include is a node of a module's include hierarchy: a module or
+// submodule and the submodules it includes.
+type Include struct {
+	Module   *yang.Module
+	Includes []*Include
+}
+
+// IncludeHierarchy returns the include hierarchy of the named module
+// or submodule, whose root is the module itself. Submodules included
+// more than once in the hierarchy appear at each place they are
+// included, though their own includes are only expanded once.
+func (c *Collection) IncludeHierarchy(name string) (*Include, error) {
+	s := c.current()
+	if !s.processed {
+		return nil, errors.New("must call Process first")
+	}
+	m, ok := s.ms.Modules[name]
+	if !ok {
+		if m, ok = s.ms.SubModules[name]; !ok {
+			return nil, errors.Errorf("module %s not found", name)
+		}
+	}
+	return includeHierarchy(m, map[*yang.Module]bool{}), nil
+}
+
+func includeHierarchy(m *yang.Module, expanded map[*yang.Module]bool) *Include {
+	inc := &Include{Module: m}
+	if expanded[m] {
+		return inc
+	}
+	expanded[m] = true
+	for _, i := range m.Include {
+		if i.Module != nil {
+			inc.Includes = append(inc.Includes, includeHierarchy(i.Module, expanded))
+		}
+	}
+	return inc
+}
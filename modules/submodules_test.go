@@ -0,0 +1,86 @@
+package modules
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCollection_Submodules(t *testing.T) {
+	SetYANGPath("testdata")
+	c := NewCollection()
+	for name, data := range map[string]string{
+		"sub-base": `module sub-base {
+  namespace "urn:sub:base"; prefix sb;
+  include sub-a; include sub-b;
+}`,
+		"sub-a": `submodule sub-a {
+  belongs-to sub-base { prefix sb; }
+  include sub-c;
+}`,
+		"sub-b": `submodule sub-b {
+  belongs-to sub-base { prefix sb; }
+  include sub-c;
+}`,
+		"sub-c": `submodule sub-c {
+  belongs-to sub-base { prefix sb; }
+  revision 2020-02-02;
+}`,
+		"sub-other": `module sub-other { namespace "urn:sub:other"; prefix so; }`,
+	} {
+		if err := c.ReadString(name, data); err != nil {
+			t.Fatalf("Collection.ReadString(%s) error = %v", name, err)
+		}
+	}
+	if _, err := c.IncludeHierarchy("sub-base"); err == nil {
+		t.Errorf("Collection.IncludeHierarchy() before Process error = nil, wantErr true")
+	}
+	if errs := c.Process(); errs != nil {
+		t.Fatalf("Collection.Process() = %v", errs)
+	}
+
+	var names []string
+	for _, sub := range c.Submodules("sub-base") {
+		names = append(names, sub.Name)
+	}
+	if want := []string{"sub-a", "sub-b", "sub-c"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("Collection.Submodules() = %v, want %v", names, want)
+	}
+	if subs := c.Submodules("sub-other"); len(subs) != 0 {
+		t.Errorf("Collection.Submodules(sub-other) = %v, want none", subs)
+	}
+
+	for _, name := range []string{"sub-a", "sub-c"} {
+		if mod, err := c.ParentModule(name); err != nil || mod.Name != "sub-base" {
+			t.Errorf("Collection.ParentModule(%s) = %v, %v, want sub-base", name, mod, err)
+		}
+	}
+	if _, err := c.ParentModule("sub-base"); err == nil {
+		t.Errorf("Collection.ParentModule(sub-base) error = nil, wantErr true")
+	}
+
+	var format func(inc *Include) string
+	format = func(inc *Include) string {
+		s := inc.Module.Name
+		if len(inc.Includes) > 0 {
+			s += "("
+			for i, child := range inc.Includes {
+				if i > 0 {
+					s += " "
+				}
+				s += format(child)
+			}
+			s += ")"
+		}
+		return s
+	}
+	root, err := c.IncludeHierarchy("sub-base")
+	if err != nil {
+		t.Fatalf("Collection.IncludeHierarchy() error = %v", err)
+	}
+	if got, want := format(root), "sub-base(sub-a(sub-c) sub-b(sub-c))"; got != want {
+		t.Errorf("Collection.IncludeHierarchy() = %s, want %s", got, want)
+	}
+	if _, err := c.IncludeHierarchy("missing"); err == nil {
+		t.Errorf("Collection.IncludeHierarchy(missing) error = nil, wantErr true")
+	}
+}
@@ -0,0 +1,342 @@
+package modules
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/openconfig/goyang/pkg/yang"
+	"github.com/pkg/errors"
+)
+
+// TreeOption is an option for Tree.
+type TreeOption func(*treeOptions)
+
+type treeOptions struct {
+	depth int
+}
+
+// TreeDepth limits the tree to depth levels of schema nodes below
+// each top-level node, augment, RPC or notification; deeper levels
+// are elided as "...". A depth of zero is unlimited.
+func TreeDepth(depth int) TreeOption {
+	return func(o *treeOptions) { o.depth = depth }
+}
+
+// Tree writes the tree diagram (RFC 8340), as produced by pyang's tree
+// output format, of the module named module to w. The diagram shows
+// the data nodes of the module, the nodes it augments into other
+// modules, and its RPCs and notifications, with their flags, types,
+// list keys and if-feature conditions, as processed by the
+// collection. Nodes added to the module by other modules' augments
+// are shown in the diagrams of those modules.
+func (c *Collection) Tree(w io.Writer, module string, opts ...TreeOption) error {
+	s := c.current()
+	me, err := s.moduleEntry(module)
+	if err != nil {
+		return errors.Wrapf(err, "module %s", module)
+	}
+	mod := s.module(module)
+	t := &treeWriter{s: s, w: bufio.NewWriter(w), ns: me.Namespace().Name}
+	for _, o := range opts {
+		o(&t.options)
+	}
+
+	var data, rpcs, notifs []*yang.Entry
+	for _, e := range t.children(me) {
+		switch {
+		case e.RPC != nil:
+			rpcs = append(rpcs, e)
+		case e.Kind == yang.NotificationEntry:
+			notifs = append(notifs, e)
+		default:
+			data = append(data, e)
+		}
+	}
+
+	t.printf("module: %s\n", me.Name)
+	t.nodes(data, "  ", "", 1)
+	for _, aug := range mod.Augment {
+		target, err := s.schemaNode(aug.Name)
+		if err != nil {
+			return errors.Wrapf(err, "augment %s", aug.Name)
+		}
+		t.printf("\n  augment %s:\n", aug.Name)
+		t.nodes(t.children(target), "    ", flagsMode(target), 1)
+	}
+	if len(rpcs) > 0 {
+		t.printf("\n  rpcs:\n")
+		t.nodes(rpcs, "    ", "", 1)
+	}
+	if len(notifs) > 0 {
+		t.printf("\n  notifications:\n")
+		t.nodes(notifs, "    ", "", 1)
+	}
+	return t.w.Flush()
+}
+
+// flagsMode returns the flags of the descendants of e, if fixed by an
+// RPC input or output or a notification containing e.
+func flagsMode(e *yang.Entry) string {
+	for it := e; it != nil; it = it.Parent {
+		switch {
+		case it.Kind == yang.NotificationEntry:
+			return "ro"
+		case it.Parent != nil && it.Parent.RPC != nil && it == it.Parent.RPC.Input:
+			return "-w"
+		case it.Parent != nil && it.Parent.RPC != nil && it == it.Parent.RPC.Output:
+			return "ro"
+		}
+	}
+	return ""
+}
+
+type treeWriter struct {
+	s       *schema
+	w       *bufio.Writer
+	ns      string
+	options treeOptions
+}
+
+func (t *treeWriter) printf(format string, args ...interface{}) {
+	// write errors are returned by the final Flush
+	fmt.Fprintf(t.w, format, args...)
+}
+
+// nodes writes the sibling schema nodes es, each line preceded by
+// prefix, at level depth. The flags of nodes within RPC inputs and
+// outputs and notifications are fixed by mode, which is "io" for the
+// input and output nodes themselves.
+func (t *treeWriter) nodes(es []*yang.Entry, prefix, mode string, depth int) {
+	type line struct {
+		label, typ string
+	}
+	lines := make([]line, len(es))
+	width := 0
+	for i, e := range es {
+		lines[i] = line{t.label(e, mode), t.typeOf(e)}
+		if lines[i].typ != "" && len(lines[i].label) > width {
+			width = len(lines[i].label)
+		}
+	}
+	for i, e := range es {
+		l := lines[i]
+		if l.typ != "" {
+			l.label += strings.Repeat(" ", width-len(l.label)) + "   " + l.typ
+		}
+		t.printf("%s%s%s\n", prefix, l.label, features(e))
+
+		children := t.children(e)
+		if len(children) == 0 {
+			continue
+		}
+		next := prefix + "|  "
+		if i == len(es)-1 {
+			next = prefix + "   "
+		}
+		if t.options.depth > 0 && depth >= t.options.depth {
+			t.printf("%s...\n", next)
+			continue
+		}
+		childMode := mode
+		switch {
+		case e.Kind == yang.NotificationEntry:
+			childMode = "ro"
+		case e.RPC != nil:
+			childMode = "io"
+		case mode == "io" && e.Name == "input":
+			childMode = "-w"
+		case mode == "io" && e.Name == "output":
+			childMode = "ro"
+		}
+		t.nodes(children, next, childMode, depth+1)
+	}
+}
+
+// label returns the status, flags, name and options of e.
+func (t *treeWriter) label(e *yang.Entry, mode string) string {
+	status := "+"
+	switch statementArg(e, "status") {
+	case "deprecated":
+		status = "x"
+	case "obsolete":
+		status = "o"
+	}
+
+	if e.IsCase() {
+		return status + "--:(" + e.Name + ")"
+	}
+	var flags string
+	switch {
+	case e.RPC != nil:
+		flags = "-x"
+	case e.Kind == yang.NotificationEntry:
+		flags = "-n"
+	case mode == "io":
+		// input and output nodes of an RPC or action
+		flags = "-w"
+		if e.Name == "output" {
+			flags = "ro"
+		}
+	case mode != "":
+		flags = mode
+	case t.s.mountPoints[e] != nil:
+		flags = "mp"
+	case e.ReadOnly():
+		flags = "ro"
+	default:
+		flags = "rw"
+	}
+
+	name := e.Name
+	switch {
+	case e.IsChoice():
+		name = "(" + name + ")"
+		if !isMandatory(e) {
+			name += "?"
+		}
+	case e.IsList() || e.IsLeafList():
+		name += "*"
+	case e.IsContainer():
+		if c, ok := e.Node.(*yang.Container); ok && c.Presence != nil {
+			name += "!"
+		}
+	case e.Kind == yang.LeafEntry || e.Kind == yang.AnyDataEntry || e.Kind == yang.AnyXMLEntry:
+		if !isMandatory(e) && !isListKey(e) {
+			name += "?"
+		}
+	}
+	return status + "--" + flags + " " + name
+}
+
+// typeOf returns the type column of e: the type of a leaf or
+// leaf-list, the keys of a list, or the kind of an anydata or anyxml.
+func (t *treeWriter) typeOf(e *yang.Entry) string {
+	switch {
+	case e.IsList():
+		if e.Key != "" {
+			return "[" + e.Key + "]"
+		}
+	case e.Kind == yang.AnyDataEntry:
+		return "<anydata>"
+	case e.Kind == yang.AnyXMLEntry:
+		return "<anyxml>"
+	case e.Kind == yang.LeafEntry && e.Type != nil:
+		if e.Type.Kind == yang.Yleafref {
+			return "-> " + e.Type.Path
+		}
+		if name := statementArg(e, "type"); name != "" {
+			return name
+		}
+		return e.Type.Name
+	}
+	return ""
+}
+
+// children returns the children of the schema node e in schema order,
+// excluding those added by other modules' augments.
+func (t *treeWriter) children(e *yang.Entry) []*yang.Entry {
+	if e.RPC != nil {
+		var io []*yang.Entry
+		for _, ch := range []*yang.Entry{e.RPC.Input, e.RPC.Output} {
+			if ch != nil && len(ch.Dir) > 0 {
+				io = append(io, ch)
+			}
+		}
+		return io
+	}
+	if len(e.Dir) == 0 {
+		return nil
+	}
+	order := map[string]int{}
+	if e.Node != nil && e.Node.Statement() != nil {
+		schemaStatements(e.Node.Statement().SubStatements(), e.Node, func(name string) {
+			if _, ok := order[name]; !ok {
+				order[name] = len(order)
+			}
+		})
+	}
+	var children []*yang.Entry
+	for _, ch := range e.Dir {
+		if ns := ch.Namespace(); ns == nil || ns.Name == t.ns {
+			children = append(children, ch)
+		}
+	}
+	sort.Slice(children, func(i, j int) bool {
+		oi, iok := order[children[i].Name]
+		oj, jok := order[children[j].Name]
+		if iok != jok {
+			return iok
+		} else if iok && oi != oj {
+			return oi < oj
+		}
+		return children[i].Name < children[j].Name
+	})
+	return children
+}
+
+// schemaStatements calls add with the name of each schema node
+// defined by stmts, including those of the groupings used, in order.
+// Groupings are found in the scope of the node n.
+func schemaStatements(stmts []*yang.Statement, n yang.Node, add func(string)) {
+	for _, s := range stmts {
+		switch s.Keyword {
+		case "container", "leaf", "leaf-list", "list", "anyxml", "anydata",
+			"choice", "case", "rpc", "action", "notification":
+			add(s.Argument)
+		case "uses":
+			if g := yang.FindGrouping(n, s.Argument, map[string]bool{}); g != nil && g.Source != nil {
+				schemaStatements(g.Source.SubStatements(), g, add)
+			}
+		}
+	}
+}
+
+// statementArg returns the argument of the first substatement of the
+// statement defining e with the keyword, or the empty string.
+func statementArg(e *yang.Entry, keyword string) string {
+	if e.Node == nil || e.Node.Statement() == nil {
+		return ""
+	}
+	for _, s := range e.Node.Statement().SubStatements() {
+		if s.Keyword == keyword {
+			return s.Argument
+		}
+	}
+	return ""
+}
+
+// features returns the if-feature conditions of e, e.g., " {a,b}?".
+func features(e *yang.Entry) string {
+	if e.Node == nil || e.Node.Statement() == nil {
+		return ""
+	}
+	var conds []string
+	for _, s := range e.Node.Statement().SubStatements() {
+		if s.Keyword == "if-feature" {
+			conds = append(conds, s.Argument)
+		}
+	}
+	if len(conds) == 0 {
+		return ""
+	}
+	return " {" + strings.Join(conds, ",") + "}?"
+}
+
+func isMandatory(e *yang.Entry) bool {
+	return e.Mandatory == yang.TSTrue || statementArg(e, "mandatory") == "true"
+}
+
+func isListKey(e *yang.Entry) bool {
+	if e.Parent == nil || !e.Parent.IsList() {
+		return false
+	}
+	for _, key := range strings.Fields(e.Parent.Key) {
+		if key == e.Name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,152 @@
+package modules
+
+import (
+	"bytes"
+	"testing"
+)
+
+const treeTestModule = `module ex {
+  yang-version 1.1;
+  namespace urn:ex; prefix ex;
+  feature fancy;
+  typedef port-number { type uint16; }
+  grouping addr {
+    leaf address { type string; }
+    leaf port { type port-number; default 22; }
+  }
+  container system {
+    leaf host-name { type string; mandatory true; }
+    container login {
+      presence "login enabled";
+      leaf banner { type string; if-feature fancy; }
+    }
+    list server {
+      key name;
+      leaf name { type string; }
+      uses addr;
+      leaf-list alias { type string; }
+      leaf peer { type leafref { path "../name"; } }
+      action reset { input { leaf delay { type uint32; } } }
+    }
+    choice auth {
+      leaf password { type string; }
+      case key {
+        leaf public-key { type binary; }
+      }
+    }
+    leaf uptime { type uint64; config false; status deprecated; }
+    anydata extra;
+  }
+  rpc restart {
+    input { leaf delay { type uint32; } }
+    output { leaf status { type string; } }
+  }
+  notification event {
+    leaf severity { type uint8; }
+  }
+}`
+
+const treeTestAugment = `module ex-aug {
+  namespace urn:ex-aug; prefix aug;
+  import ex { prefix ex; }
+  augment /ex:system {
+    container extra-stats { config false; leaf count { type uint32; } }
+  }
+}`
+
+func TestCollection_Tree(t *testing.T) {
+	c := NewCollection()
+	for name, src := range map[string]string{"ex": treeTestModule, "ex-aug": treeTestAugment} {
+		if err := c.s.ms.Parse(src, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if errs := c.Process(); errs != nil {
+		t.Fatalf("Collection.Process() = %v", errs)
+	}
+
+	tests := []struct {
+		name    string
+		module  string
+		opts    []TreeOption
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "module",
+			module: "ex",
+			want: `module: ex
+  +--rw system
+     +--rw host-name   string
+     +--rw login!
+     |  +--rw banner?   string {fancy}?
+     +--rw server*     [name]
+     |  +--rw name       string
+     |  +--rw address?   string
+     |  +--rw port?      port-number
+     |  +--rw alias*     string
+     |  +--rw peer?      -> ../name
+     |  +---x reset
+     |     +---w input
+     |        +---w delay?   uint32
+     +--rw (auth)?
+     |  +--:(password)
+     |  |  +--rw password?   string
+     |  +--:(key)
+     |     +--rw public-key?   binary
+     x--ro uptime?     uint64
+     +--rw extra?      <anydata>
+
+  rpcs:
+    +---x restart
+       +---w input
+       |  +---w delay?   uint32
+       +--ro output
+          +--ro status?   string
+
+  notifications:
+    +---n event
+       +--ro severity?   uint8
+`,
+		},
+		{
+			name:   "augment",
+			module: "ex-aug",
+			want: `module: ex-aug
+
+  augment /ex:system:
+    +--ro extra-stats
+       +--ro count?   uint32
+`,
+		},
+		{
+			name:   "depth",
+			module: "ex",
+			opts:   []TreeOption{TreeDepth(1)},
+			want: `module: ex
+  +--rw system
+     ...
+
+  rpcs:
+    +---x restart
+       ...
+
+  notifications:
+    +---n event
+       ...
+`,
+		},
+		{name: "unknown module", module: "nope", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b bytes.Buffer
+			if err := c.Tree(&b, tt.module, tt.opts...); (err != nil) != tt.wantErr {
+				t.Fatalf("Collection.Tree() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := b.String(); !tt.wantErr && got != tt.want {
+				t.Errorf("Collection.Tree() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package modules
+
+import (
+	"regexp"
+
+	"github.com/openconfig/goyang/pkg/yang"
+)
+
+// ResolvedType is the effective type of a leaf or leaf-list, with the
+// restrictions of its typedefs applied.
+type ResolvedType struct {
+	// Kind is the built-in type the type is derived from.
+	Kind yang.TypeKind
+	// Typedefs are the names of the typedefs the type is derived
+	// from, from the type of the leaf to the built-in type, e.g.,
+	// ["percent", "uint8"].
+	Typedefs []string
+	// Range and Length are the effective range and length
+	// restrictions, and Patterns the patterns all values must match.
+	Range    yang.YangRange
+	Length   yang.YangRange
+	Patterns []string
+	// FractionDigits is the precision of a decimal64.
+	FractionDigits int
+	// Enum and Bit are the members of an enumeration or bits.
+	Enum *yang.EnumType
+	Bit  *yang.EnumType
+	// IdentityBase is the base of an identityref.
+	IdentityBase *yang.Identity
+	// Path is the path of a leafref, and Target the leaf it refers
+	// to, or nil if the path does not refer to a leaf.
+	Path   string
+	Target *yang.Entry
+	// RequireInstance is true for leafrefs and instance-identifiers
+	// requiring the instance referred to to exist.
+	RequireInstance bool
+	Units           string
+	Default         string
+	// Members are the member types of a union, in schema order. The
+	// members of unions within the union are included in their place.
+	Members []ResolvedType
+	// Type is the type as resolved by goyang.
+	Type *yang.YangType
+}
+
+// ResolveType returns the effective type of the leaf or leaf-list e,
+// or a ResolvedType of Kind yang.Ynone if e has no type.
+func ResolveType(e *yang.Entry) ResolvedType {
+	if e == nil || e.Type == nil {
+		return ResolvedType{}
+	}
+	return resolveType(e, e.Type)
+}
+
+func resolveType(e *yang.Entry, t *yang.YangType) ResolvedType {
+	r := ResolvedType{
+		Kind:            t.Kind,
+		Typedefs:        typedefs(t),
+		Range:           t.Range,
+		Length:          t.Length,
+		Patterns:        t.Pattern,
+		FractionDigits:  t.FractionDigits,
+		Enum:            t.Enum,
+		Bit:             t.Bit,
+		IdentityBase:    t.IdentityBase,
+		Path:            t.Path,
+		RequireInstance: !t.OptionalInstance,
+		Units:           t.Units,
+		Default:         t.Default,
+		Type:            t,
+	}
+	switch t.Kind {
+	case yang.Yunion:
+		for _, member := range t.Type {
+			m := resolveType(e, member)
+			if m.Kind == yang.Yunion {
+				r.Members = append(r.Members, m.Members...)
+			} else {
+				r.Members = append(r.Members, m)
+			}
+		}
+	case yang.Yleafref:
+		r.Target = leafrefTarget(e, t.Path)
+	}
+	return r
+}
+
+// typedefs returns the names of the types t is derived from, ending
+// with its built-in type.
+func typedefs(t *yang.YangType) []string {
+	var names []string
+	seen := map[*yang.YangType]bool{}
+	for t != nil && !seen[t] {
+		seen[t] = true
+		names = append(names, t.Name)
+		if yang.BaseTypedefs[t.Name] != nil || t.Base == nil {
+			break
+		}
+		t = t.Base.YangType
+	}
+	return names
+}
+
+var leafrefPredicate = regexp.MustCompile(`\[[^\]]*\]`)
+
+// leafrefTarget returns the leaf referred to by the leafref path of
+// the leaf e, or nil.
+func leafrefTarget(e *yang.Entry, path string) *yang.Entry {
+	// relative paths are evaluated with the leaf as the context node;
+	// absolute paths may build the schema entries of other modules
+	goyangMu.Lock()
+	defer goyangMu.Unlock()
+	target := e.Find(leafrefPredicate.ReplaceAllString(path, ""))
+	if target == nil || target.Kind != yang.LeafEntry {
+		return nil
+	}
+	return target
+}
@@ -0,0 +1,78 @@
+package modules
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/openconfig/goyang/pkg/yang"
+)
+
+func TestResolveType(t *testing.T) {
+	c := NewCollection()
+	if err := c.s.ms.Parse(`module types {
+  namespace urn:types; prefix t;
+  typedef name { type string { length "1..64"; pattern "[a-z].*"; } }
+  typedef short-name { type name { length "1..8"; pattern ".*[a-z0-9]"; } }
+  typedef percent { type uint8 { range "0..100"; } units percent; }
+  typedef level { type union { type percent; type enumeration { enum low; enum high; } } }
+  container top {
+    leaf host { type short-name; }
+    leaf load { type percent { range "0..50"; } }
+    leaf ratio { type decimal64 { fraction-digits 2; } }
+    leaf setting { type union { type level; type boolean; } }
+    leaf ref { type leafref { path "../load"; } }
+    leaf dangling { type leafref { path "../nope"; require-instance false; } }
+  }
+}`, "types"); err != nil {
+		t.Fatal(err)
+	}
+	if errs := c.Process(); errs != nil {
+		t.Fatalf("Collection.Process() = %v", errs)
+	}
+	top, err := c.SchemaNode("/types:top")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	host := ResolveType(top.Dir["host"])
+	if host.Kind != yang.Ystring || host.Length.String() != "1..8" {
+		t.Errorf("ResolveType(host) = %v length %s, want string length 1..8", host.Kind, host.Length)
+	}
+	if want := []string{"short-name", "name", "string"}; !reflect.DeepEqual(host.Typedefs, want) {
+		t.Errorf("ResolveType(host).Typedefs = %v, want %v", host.Typedefs, want)
+	}
+	if want := []string{"[a-z].*", ".*[a-z0-9]"}; !reflect.DeepEqual(host.Patterns, want) {
+		t.Errorf("ResolveType(host).Patterns = %v, want %v", host.Patterns, want)
+	}
+
+	load := ResolveType(top.Dir["load"])
+	if load.Kind != yang.Yuint8 || load.Range.String() != "0..50" || load.Units != "percent" {
+		t.Errorf("ResolveType(load) = %v range %s units %q, want uint8 range 0..50 units percent", load.Kind, load.Range, load.Units)
+	}
+	if ratio := ResolveType(top.Dir["ratio"]); ratio.Kind != yang.Ydecimal64 || ratio.FractionDigits != 2 {
+		t.Errorf("ResolveType(ratio) = %v fraction-digits %d, want decimal64 fraction-digits 2", ratio.Kind, ratio.FractionDigits)
+	}
+
+	setting := ResolveType(top.Dir["setting"])
+	var kinds []yang.TypeKind
+	for _, m := range setting.Members {
+		kinds = append(kinds, m.Kind)
+	}
+	if want := []yang.TypeKind{yang.Yuint8, yang.Yenum, yang.Ybool}; setting.Kind != yang.Yunion || !reflect.DeepEqual(kinds, want) {
+		t.Errorf("ResolveType(setting) = %v members %v, want union members %v", setting.Kind, kinds, want)
+	}
+	if m := setting.Members[1]; m.Enum == nil || !m.Enum.IsDefined("high") {
+		t.Errorf("ResolveType(setting).Members[1].Enum = %v, want low and high", m.Enum)
+	}
+
+	ref := ResolveType(top.Dir["ref"])
+	if ref.Kind != yang.Yleafref || ref.Target != top.Dir["load"] || !ref.RequireInstance {
+		t.Errorf("ResolveType(ref) = %v target %v, want leafref to load requiring an instance", ref.Kind, ref.Target)
+	}
+	if dangling := ResolveType(top.Dir["dangling"]); dangling.Target != nil || dangling.RequireInstance {
+		t.Errorf("ResolveType(dangling) target %v, want none not requiring an instance", dangling.Target)
+	}
+	if got := ResolveType(top); got.Kind != yang.Ynone {
+		t.Errorf("ResolveType(top).Kind = %v, want %v", got.Kind, yang.Ynone)
+	}
+}
@@ -0,0 +1,157 @@
+package modules
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/andaru/opr8/log"
+	"github.com/openconfig/goyang/pkg/yang"
+)
+
+// WatchInterval is the interval at which Watch scans the YANG path.
+var WatchInterval = 2 * time.Second
+
+// SchemaEvent describes a reload of the modules of a collection by
+// Watch, passed to the functions registered with Listen.
+type SchemaEvent struct {
+	// Files are the YANG files added, changed or removed.
+	Files []string
+	// Errors are the errors reading or processing the modules. If
+	// any occurred, the schema of the collection is unchanged.
+	Errors []error
+}
+
+// Listen registers f to be called with each reload of the modules of
+// the collection by Watch, such as to update the schema of datastores
+// or the capabilities advertised to clients.
+func (c *Collection) Listen(f func(SchemaEvent)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.listeners = append(c.listeners, f)
+}
+
+// Watch scans the YANG path set by SetYANGPath for YANG files every
+// WatchInterval, until ctx is done, and returns ctx's error. When
+// files are added, changed or removed, the modules of the YANG path
+// are read and, unless their Fingerprint is that of the modules of
+// the collection, processed anew, replacing those of the collection
+// if no errors occur. The functions registered with Listen are then
+// called.
+//
+// Modules read other than from the YANG path, such as by ReadString,
+// are not kept when the collection is reloaded; revisions selected by
+// Import and schema mounts are kept.
+func (c *Collection) Watch(ctx context.Context) error {
+	// changes since the modules were read are found by the first scan
+	c.mu.RLock()
+	files := c.files
+	c.mu.RUnlock()
+	if files == nil {
+		files = scanYANGPath()
+	}
+	ticker := time.NewTicker(WatchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		next := scanYANGPath()
+		changed := changedFiles(files, next)
+		if len(changed) == 0 {
+			continue
+		}
+		files = next
+		reloaded, errs := c.reload()
+		if errs == nil && !reloaded {
+			log.Debug(c.log(), "YANG modules unchanged", "files", changed)
+			continue
+		}
+		event := SchemaEvent{Files: changed, Errors: errs}
+		if event.Errors != nil {
+			log.Warn(c.log(), "YANG modules not reloaded", "files", changed, "errors", len(event.Errors))
+		} else {
+			log.Info(c.log(), "YANG modules reloaded", "files", changed)
+		}
+		c.mu.RLock()
+		listeners := c.listeners
+		c.mu.RUnlock()
+		for _, f := range listeners {
+			f(event)
+		}
+	}
+}
+
+// reload reads and processes the modules of the YANG path, replacing
+// the schema of the collection with theirs if successful. It returns
+// true if the schema was replaced, and false if the modules are
+// unchanged, having the fingerprint of those the collection last
+// processed.
+//
+// The schema is built aside and replaced in one step, so the methods
+// reading the collection see either schema in full.
+func (c *Collection) reload() (bool, []error) {
+	cur := c.current()
+	pinned := make(map[string]string, len(cur.pinned))
+	for name, revision := range cur.pinned {
+		pinned[name] = revision
+	}
+	next := &Collection{s: &schema{ms: yang.NewModules(), pinned: pinned, policy: cur.policy}, logger: c.logger}
+	if errs := next.ImportAll(); errs != nil {
+		return false, errs
+	}
+	if cur.processed && next.Fingerprint() == cur.fingerprint {
+		return false, nil
+	}
+	if errs := next.Process(); errs != nil {
+		return false, errs
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	next.s.resolveMounts(c.mounts)
+	c.s = next.s
+	return true, nil
+}
+
+// fileState is the state of a YANG file found by scanYANGPath.
+type fileState struct {
+	size    int64
+	modTime time.Time
+}
+
+// scanYANGPath returns the state of the YANG files in the YANG path.
+func scanYANGPath() map[string]fileState {
+	files := map[string]fileState{}
+	for _, root := range expandYANGPath(yang.Path) {
+		_ = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err == nil && info.Mode().IsRegular() && strings.HasSuffix(path, ".yang") {
+				files[path] = fileState{size: info.Size(), modTime: info.ModTime()}
+			}
+			return nil
+		})
+	}
+	return files
+}
+
+// changedFiles returns the sorted names of the files added, changed
+// or removed between the states prev and next.
+func changedFiles(prev, next map[string]fileState) []string {
+	var changed []string
+	for path, state := range next {
+		if old, ok := prev[path]; !ok || old.size != state.size || !old.modTime.Equal(state.modTime) {
+			changed = append(changed, path)
+		}
+	}
+	for path := range prev {
+		if _, ok := next[path]; !ok {
+			changed = append(changed, path)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
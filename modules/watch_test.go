@@ -0,0 +1,93 @@
+package modules
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCollection_Watch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "opr8-watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	write := func(name, src string) {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("a.yang", `module a { namespace urn:a; prefix a; container top; }`)
+
+	defer func(interval time.Duration) { WatchInterval = interval }(WatchInterval)
+	WatchInterval = 10 * time.Millisecond
+	SetYANGPath(dir)
+	c := NewCollection()
+	if errs := c.ImportAll(); errs != nil {
+		t.Fatalf("Collection.ImportAll() = %v", errs)
+	}
+	if errs := c.Process(); errs != nil {
+		t.Fatalf("Collection.Process() = %v", errs)
+	}
+
+	events := make(chan SchemaEvent, 1)
+	c.Listen(func(ev SchemaEvent) { events <- ev })
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- c.Watch(ctx) }()
+	next := func() SchemaEvent {
+		select {
+		case ev := <-events:
+			return ev
+		case <-time.After(5 * time.Second):
+			t.Fatal("no schema event")
+		}
+		return SchemaEvent{}
+	}
+
+	write("b.yang", `module b { namespace urn:b; prefix b; import a { prefix a; } augment /a:top { leaf x { type string; } } }`)
+	if ev := next(); len(ev.Errors) > 0 || len(ev.Files) != 1 || filepath.Base(ev.Files[0]) != "b.yang" {
+		t.Errorf("SchemaEvent = %+v, want b.yang added", ev)
+	}
+	top, err := c.SchemaNode("/a:top/b:x")
+	if err != nil || top == nil {
+		t.Errorf("Collection.SchemaNode() after reload = %v", err)
+	}
+
+	// files changed without changing their modules keep the schema
+	before, err := c.ModuleEntry("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Now().Add(time.Minute)
+	if err := os.Chtimes(filepath.Join(dir, "a.yang"), modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case ev := <-events:
+		t.Errorf("SchemaEvent = %+v, want none for unchanged modules", ev)
+	case <-time.After(10 * WatchInterval):
+	}
+	if after, _ := c.ModuleEntry("a"); after != before {
+		t.Error("Collection.ModuleEntry() rebuilt after reading unchanged modules")
+	}
+
+	write("c.yang", `module c { namespace urn:c; prefix c; import missing { prefix m; } }`)
+	if ev := next(); len(ev.Errors) == 0 {
+		t.Errorf("SchemaEvent = %+v, want errors", ev)
+	}
+	if _, err := c.SchemaNode("/a:top/b:x"); err != nil {
+		t.Errorf("Collection.SchemaNode() after failed reload = %v", err)
+	}
+	if _, err := c.ModuleEntry("c"); err == nil {
+		t.Error("Collection.ModuleEntry() found module of failed reload")
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Collection.Watch() = %v, want %v", err, context.Canceled)
+	}
+}
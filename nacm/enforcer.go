@@ -0,0 +1,401 @@
+package nacm
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	xml "github.com/andaru/flexml"
+	"github.com/andaru/opr8/datastore"
+	"github.com/andaru/opr8/dom"
+	"github.com/andaru/opr8/modules"
+	"github.com/andaru/opr8/rpc"
+	"github.com/andaru/opr8/session/netconf"
+	"github.com/openconfig/goyang/pkg/yang"
+)
+
+// Option is a constructor option for Enforcer.
+type Option func(*Enforcer)
+
+// WithRecoveryUser is an Enforcer option naming the user of recovery
+// sessions, which access control does not apply to.
+func WithRecoveryUser(user string) Option {
+	return func(e *Enforcer) { e.recovery = user }
+}
+
+// WithExternalGroups is an Enforcer option providing the groups of a
+// user from outside the configuration, such as from the transport's
+// authentication, which are used if enable-external-groups is true.
+func WithExternalGroups(groups func(user string) []string) Option {
+	return func(e *Enforcer) { e.external = groups }
+}
+
+// Enforcer enforces the access control configuration of a datastore.
+// It is an rpc.Authorizer, and safe for concurrent use.
+type Enforcer struct {
+	c        *modules.Collection
+	recovery string
+	external func(user string) []string
+
+	mu  sync.RWMutex
+	cfg *Config
+	err error
+
+	deniedOperations, deniedDataWrites uint32 // accessed atomically
+}
+
+// New returns a new Enforcer of the configuration of the datastore ds,
+// typically running, which is reloaded when ds changes. The data is
+// that of the schema of ds.
+func New(ds *datastore.Datastore, options ...Option) *Enforcer {
+	e := &Enforcer{c: ds.Modules()}
+	for _, option := range options {
+		option(e)
+	}
+	e.load(ds.Snapshot().Root)
+	ds.Listen(func(prev, next *datastore.Snapshot) { e.load(next.Root) })
+	return e
+}
+
+// load loads the configuration of the data tree root, keeping the
+// configuration loaded before if it is invalid.
+func (e *Enforcer) load(root dom.Node) {
+	cfg, err := ParseConfig(root, e.c)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.err = err; err == nil {
+		e.cfg = cfg
+	} else if e.cfg == nil {
+		e.cfg = DefaultConfig()
+	}
+}
+
+// Config returns the configuration enforced.
+func (e *Enforcer) Config() *Config {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.cfg
+}
+
+// Err returns the error loading the datastore's configuration, if it
+// is invalid, in which case the configuration loaded before remains
+// enforced.
+func (e *Enforcer) Err() error {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.err
+}
+
+// DeniedOperations returns the number of protocol operations denied.
+func (e *Enforcer) DeniedOperations() uint32 { return atomic.LoadUint32(&e.deniedOperations) }
+
+// DeniedDataWrites returns the number of operations denied for
+// changing data without write access.
+func (e *Enforcer) DeniedDataWrites() uint32 { return atomic.LoadUint32(&e.deniedDataWrites) }
+
+// rules returns the configuration enforced for the user, and the rules
+// applying to the user's groups, in order, or a nil configuration if
+// access control does not apply to the user.
+func (e *Enforcer) rules(user string) (*Config, []Rule) {
+	cfg := e.Config()
+	if !cfg.Enabled || user == e.recovery && user != "" {
+		return nil, nil
+	}
+	groups := map[string]bool{}
+	for group, users := range cfg.Groups {
+		for _, u := range users {
+			if u == user {
+				groups[group] = true
+			}
+		}
+	}
+	if cfg.ExternalGroups && e.external != nil {
+		for _, group := range e.external(user) {
+			groups[group] = true
+		}
+	}
+	var rules []Rule
+	for _, list := range cfg.RuleLists {
+		for _, group := range list.Groups {
+			if group == "*" || groups[group] {
+				rules = append(rules, list.Rules...)
+				break
+			}
+		}
+	}
+	return cfg, rules
+}
+
+// module returns the name of the module with the namespace ns, or the
+// empty string if it is unknown.
+func (e *Enforcer) module(ns string) string {
+	if ns == netconf.BaseNamespace {
+		return "ietf-netconf"
+	}
+	if e.c != nil {
+		if m, err := e.c.ModuleByNamespace(ns); err == nil {
+			return m.Name
+		}
+	}
+	return ""
+}
+
+// moduleMatches returns true if the rule applies to the module.
+func (r *Rule) moduleMatches(module string) bool { return r.Module == "*" || r.Module == module }
+
+// AuthorizeOperation returns an access-denied error if the user may
+// not invoke the protocol operation with the element name. The
+// close-session operation is always permitted, and kill-session and
+// delete-config are denied unless a rule permits them.
+func (e *Enforcer) AuthorizeOperation(user string, name xml.Name) error {
+	cfg, rules := e.rules(user)
+	if cfg == nil {
+		return nil
+	}
+	base := name.Space == netconf.BaseNamespace
+	if base && name.Local == "close-session" {
+		return nil
+	}
+	module := e.module(name.Space)
+	action := cfg.ExecDefault
+	if base && (name.Local == "kill-session" || name.Local == "delete-config") {
+		action = Deny
+	}
+	for _, r := range rules {
+		if r.Access&AccessExec != 0 && r.moduleMatches(module) &&
+			(r.untyped() || r.RPC == "*" || r.RPC == name.Local) {
+			action = r.Action
+			break
+		}
+	}
+	if action == Permit {
+		return nil
+	}
+	atomic.AddUint32(&e.deniedOperations, 1)
+	return rpc.NewError(rpc.ErrorTypeProtocol, rpc.ErrorTagAccessDenied, "access to operation %s denied", name.Local)
+}
+
+// AuthorizeNotification returns an access-denied error if the user may
+// not receive the event notification with the element name, as decided
+// by the first rule of read access to it, or read-default if none
+// matches (RFC 8341 section 3.4.6). Notifications whose schema has the
+// default-deny-all extension are denied unless a rule permits them.
+func (e *Enforcer) AuthorizeNotification(user string, name xml.Name) error {
+	cfg, rules := e.rules(user)
+	if cfg == nil {
+		return nil
+	}
+	module := e.module(name.Space)
+	action := cfg.ReadDefault
+	if e.c != nil {
+		if me, err := e.c.ModuleEntry(module); err == nil && denyExtension(me.Dir[name.Local], false) {
+			action = Deny
+		}
+	}
+	for _, r := range rules {
+		if r.Access&AccessRead != 0 && r.moduleMatches(module) &&
+			(r.untyped() || r.Notification == "*" || r.Notification == name.Local) {
+			action = r.Action
+			break
+		}
+	}
+	if action == Permit {
+		return nil
+	}
+	return rpc.NewError(rpc.ErrorTypeApplication, rpc.ErrorTagAccessDenied, "access to notification %s denied", name.Local)
+}
+
+// FilterRead removes the data the user may not read from the data tree
+// root. The <nacm> container, and nodes whose schema has the
+// default-deny-all extension, are removed unless a rule permits them
+// to be read.
+func (e *Enforcer) FilterRead(user string, root dom.Node) {
+	cfg, rules := e.rules(user)
+	if cfg == nil {
+		return
+	}
+	var filter func(path []dom.Node, n dom.Node, entry *yang.Entry, defaultAction Action)
+	filter = func(path []dom.Node, n dom.Node, entry *yang.Entry, defaultAction Action) {
+		for it := n.FirstChild(); it != nil; {
+			next := it.NextSibling()
+			if it.NodeType() == dom.NodeTypeElement {
+				childPath := append(path[:len(path):len(path)], it)
+				ce := e.entry(entry, it)
+				d := defaultAction
+				if defaultDeny(ce, it, false) {
+					d = Deny
+				}
+				if action, ok := e.match(rules, childPath, AccessRead); ok && action == Deny || !ok && d == Deny {
+					_ = n.RemoveChild(it)
+				} else {
+					filter(childPath, it, ce, d)
+				}
+			}
+			it = next
+		}
+	}
+	filter(nil, root, nil, cfg.ReadDefault)
+}
+
+// AuthorizeWrite returns an access-denied error if the user may not
+// change the data tree prev into the data tree next: create each data
+// node added, with its descendants, delete each removed and update
+// each leaf changed. Nodes whose schema has the default-deny-write or
+// default-deny-all extension may only be written as a rule permits.
+func (e *Enforcer) AuthorizeWrite(user string, prev, next dom.Node) error {
+	cfg, rules := e.rules(user)
+	if cfg == nil {
+		return nil
+	}
+	if e.c == nil {
+		atomic.AddUint32(&e.deniedDataWrites, 1)
+		return rpc.NewError(rpc.ErrorTypeApplication, rpc.ErrorTagAccessDenied, "write access denied: the datastore has no schema")
+	}
+	for _, edit := range datastore.Diff(prev, next, e.c) {
+		root, access := next, AccessUpdate
+		switch edit.Operation {
+		case datastore.EditCreate:
+			access = AccessCreate
+		case datastore.EditDelete:
+			root, access = prev, AccessDelete
+		}
+		n, err := edit.Path.Resolve(root)
+		if err != nil {
+			return err
+		}
+		var path []dom.Node
+		for it := n; it != nil && it.NodeType() == dom.NodeTypeElement; it = it.Parent() {
+			path = append([]dom.Node{it}, path...)
+		}
+		defaultAction := cfg.WriteDefault
+		var entry *yang.Entry
+		for _, it := range path {
+			if entry = e.entry(entry, it); defaultDeny(entry, it, true) {
+				defaultAction = Deny
+			}
+		}
+		if !e.writable(rules, path, entry, defaultAction, access) {
+			atomic.AddUint32(&e.deniedDataWrites, 1)
+			target := edit.Path.Format(e.module)
+			err := rpc.NewError(rpc.ErrorTypeApplication, rpc.ErrorTagAccessDenied, "%s access to %s denied", access, target)
+			err.Path = target
+			return err
+		}
+	}
+	return nil
+}
+
+// writable returns true if the user of the rules may make the access
+// to the data node at the end of path, of schema node entry, and, for
+// creation, to its descendants, taking the default action if no rule
+// matches.
+func (e *Enforcer) writable(rules []Rule, path []dom.Node, entry *yang.Entry, defaultAction Action, access Access) bool {
+	n := path[len(path)-1]
+	if action, ok := e.match(rules, path, access); ok && action == Deny || !ok && defaultAction == Deny {
+		return false
+	}
+	if access != AccessCreate {
+		return true
+	}
+	for it := n.FirstChild(); it != nil; it = it.NextSibling() {
+		if it.NodeType() != dom.NodeTypeElement {
+			continue
+		}
+		ce, d := e.entry(entry, it), defaultAction
+		if defaultDeny(ce, it, true) {
+			d = Deny
+		}
+		if !e.writable(rules, append(path[:len(path):len(path)], it), ce, d, access) {
+			return false
+		}
+	}
+	return true
+}
+
+// match returns the action of the first rule of access matching the
+// data node at the end of path, and true if one matches.
+func (e *Enforcer) match(rules []Rule, path []dom.Node, access Access) (Action, bool) {
+	n := path[len(path)-1]
+	module := e.module(n.Name().Space)
+	for _, r := range rules {
+		if r.Access&access == 0 || !r.moduleMatches(module) {
+			continue
+		}
+		if r.untyped() || r.Path != nil && pathMatches(r.Path, path) {
+			return r.Action, true
+		}
+	}
+	return Deny, false
+}
+
+// entry returns the schema node of the data node n, the child of a
+// node of schema node parent, or nil for the document, or nil if it is
+// unknown.
+func (e *Enforcer) entry(parent *yang.Entry, n dom.Node) *yang.Entry {
+	if e.c == nil {
+		return nil
+	}
+	if parent == nil {
+		if re, err := e.c.RootEntry(n.Name()); err == nil {
+			return re
+		}
+		return nil
+	}
+	return e.c.DataChild(parent, n.Name().Local)
+}
+
+// defaultDeny returns true if the data node n, of schema node entry,
+// may not be accessed by default: the <nacm> container and nodes
+// whose schema has the default-deny-all extension, or, for writes,
+// default-deny-write.
+func defaultDeny(entry *yang.Entry, n dom.Node, write bool) bool {
+	if n.Name() == (xml.Name{Space: Namespace, Local: "nacm"}) {
+		return true
+	}
+	return denyExtension(entry, write)
+}
+
+// denyExtension returns true if the schema node entry, if not nil, has the
+// default-deny-all extension, or, for writes, default-deny-write.
+func denyExtension(entry *yang.Entry, write bool) bool {
+	if entry == nil {
+		return false
+	}
+	for _, ext := range entry.Exts {
+		if strings.HasSuffix(ext.Keyword, ":default-deny-all") ||
+			write && strings.HasSuffix(ext.Keyword, ":default-deny-write") {
+			return true
+		}
+	}
+	return false
+}
+
+// pathMatches returns true if the rule path id addresses the data node
+// at the end of path, or one of its ancestors.
+func pathMatches(id datastore.InstanceID, path []dom.Node) bool {
+	if len(id) > len(path) {
+		return false
+	}
+	for i, elem := range id {
+		n := path[i]
+		if n.Name() != elem.Name {
+			return false
+		}
+		for _, key := range elem.Keys {
+			v := ""
+			if key.Name.Local == "." {
+				v = n.ChildValue()
+			} else if k := n.ChildByName(key.Name); k != nil {
+				v = k.ChildValue()
+			} else {
+				return false
+			}
+			if v != key.Value {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+var _ rpc.Authorizer = &Enforcer{}
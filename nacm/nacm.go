@@ -0,0 +1,332 @@
+/*
+Package nacm has the NETCONF Access Control Model (RFC 8341), which
+controls the protocol operations and data available to each user.
+
+An Enforcer loads the ietf-netconf-acm configuration, the <nacm>
+container, from a datastore, reloading it after each commit. Its rules
+are matched by the groups of a session's user, in rule-list order, with
+the first matching rule permitting or denying the access, and the
+configured defaults applying when none match. The Enforcer is an
+rpc.Authorizer, checking operations before they are dispatched and the
+data read and written by the base operations:
+
+	e := nacm.New(set.Get(datastore.Running), nacm.WithRecoveryUser("root"))
+	d.SetAuthorizer(e)
+
+Data rules are matched by instance-identifier paths, whose prefixes are
+XML namespace prefixes in scope of the <path> element, or module names
+or prefixes of the datastore's schema.
+*/
+package nacm
+
+import (
+	"strings"
+
+	xml "github.com/andaru/flexml"
+	"github.com/andaru/opr8/datastore"
+	"github.com/andaru/opr8/dom"
+	"github.com/andaru/opr8/modules"
+	"github.com/pkg/errors"
+)
+
+// Namespace is the namespace of the ietf-netconf-acm module.
+const Namespace = "urn:ietf:params:xml:ns:yang:ietf-netconf-acm"
+
+// Action is the action of a rule or default: permit or deny.
+type Action int
+
+// Actions.
+const (
+	Deny Action = iota
+	Permit
+)
+
+func (a Action) String() string {
+	if a == Permit {
+		return "permit"
+	}
+	return "deny"
+}
+
+// parseAction parses the action-type s.
+func parseAction(s string) (Action, error) {
+	switch s {
+	case "permit":
+		return Permit, nil
+	case "deny":
+		return Deny, nil
+	}
+	return Deny, errors.Errorf("invalid action %q", s)
+}
+
+// Access is a set of access operations.
+type Access uint8
+
+// Access operations.
+const (
+	AccessCreate Access = 1 << iota
+	AccessRead
+	AccessUpdate
+	AccessDelete
+	AccessExec
+
+	// AccessAll is every access operation, "*".
+	AccessAll = AccessCreate | AccessRead | AccessUpdate | AccessDelete | AccessExec
+)
+
+var accessNames = []struct {
+	a    Access
+	name string
+}{
+	{AccessCreate, "create"},
+	{AccessRead, "read"},
+	{AccessUpdate, "update"},
+	{AccessDelete, "delete"},
+	{AccessExec, "exec"},
+}
+
+func (a Access) String() string {
+	if a == AccessAll {
+		return "*"
+	}
+	var names []string
+	for _, an := range accessNames {
+		if a&an.a != 0 {
+			names = append(names, an.name)
+		}
+	}
+	return strings.Join(names, " ")
+}
+
+// parseAccess parses the access-operations s, "*" or a space separated
+// list of operations.
+func parseAccess(s string) (Access, error) {
+	if s == "*" {
+		return AccessAll, nil
+	}
+	var a Access
+next:
+	for _, name := range strings.Fields(s) {
+		for _, an := range accessNames {
+			if an.name == name {
+				a |= an.a
+				continue next
+			}
+		}
+		return 0, errors.Errorf("invalid access operation %q", name)
+	}
+	return a, nil
+}
+
+// Config is the access control configuration of the <nacm> container.
+type Config struct {
+	// Enabled is false if access control is disabled.
+	Enabled bool
+	// ReadDefault, WriteDefault and ExecDefault are the actions taken
+	// when no rule matches a read, write or exec access.
+	ReadDefault, WriteDefault, ExecDefault Action
+	// ExternalGroups is true if groups provided for users by the
+	// Enforcer's WithExternalGroups option are used.
+	ExternalGroups bool
+	// Groups are the user names of each group, by group name.
+	Groups map[string][]string
+	// RuleLists are the rule lists, in order.
+	RuleLists []RuleList
+}
+
+// DefaultConfig returns the configuration used when the datastore has
+// no <nacm> container: enabled, permitting reads and operations and
+// denying writes.
+func DefaultConfig() *Config {
+	return &Config{
+		Enabled:        true,
+		ReadDefault:    Permit,
+		WriteDefault:   Deny,
+		ExecDefault:    Permit,
+		ExternalGroups: true,
+		Groups:         map[string][]string{},
+	}
+}
+
+// RuleList is a named, ordered list of rules applying to the users of
+// its groups.
+type RuleList struct {
+	Name string
+	// Groups are the names of the groups the rules apply to, which
+	// include "*" for all groups.
+	Groups []string
+	Rules  []Rule
+}
+
+// Rule is an access control rule. A rule with none of RPC,
+// Notification or Path set applies to any protocol operation,
+// notification or data node of its module.
+type Rule struct {
+	Name string
+	// Module is the name of the module the rule applies to, or "*"
+	// for all modules.
+	Module string
+	// RPC is the name of the protocol operation of the rule, or "*"
+	// for all operations.
+	RPC string
+	// Notification is the name of the notification of the rule, or
+	// "*" for all notifications.
+	Notification string
+	// Path is the data node of the rule, which applies to the node
+	// and its descendants.
+	Path datastore.InstanceID
+	// Access are the access operations the rule applies to.
+	Access Access
+	// Action is the rule's action.
+	Action Action
+}
+
+// untyped returns true if the rule applies to all kinds of access.
+func (r *Rule) untyped() bool { return r.RPC == "" && r.Notification == "" && r.Path == nil }
+
+// ParseConfig returns the configuration of the <nacm> container of the
+// data tree root, or the DefaultConfig if it has none. Module names and
+// prefixes in rule paths are those of the collection c, if not nil.
+func ParseConfig(root dom.Node, c *modules.Collection) (*Config, error) {
+	cfg := DefaultConfig()
+	n := root.ChildByName(xml.Name{Space: Namespace, Local: "nacm"})
+	if n == nil {
+		return cfg, nil
+	}
+	var err error
+	for _, f := range []struct {
+		local string
+		b     *bool
+	}{
+		{"enable-nacm", &cfg.Enabled},
+		{"enable-external-groups", &cfg.ExternalGroups},
+	} {
+		if v, ok := value(n, f.local); ok {
+			if v != "true" && v != "false" {
+				return nil, errors.Errorf("invalid %s %q", f.local, v)
+			}
+			*f.b = v == "true"
+		}
+	}
+	for _, f := range []struct {
+		local string
+		a     *Action
+	}{
+		{"read-default", &cfg.ReadDefault},
+		{"write-default", &cfg.WriteDefault},
+		{"exec-default", &cfg.ExecDefault},
+	} {
+		if v, ok := value(n, f.local); ok {
+			if *f.a, err = parseAction(v); err != nil {
+				return nil, errors.Wrap(err, f.local)
+			}
+		}
+	}
+
+	if groups := child(n, "groups"); groups != nil {
+		for _, g := range children(groups, "group") {
+			name, _ := value(g, "name")
+			cfg.Groups[name] = append(cfg.Groups[name], values(g, "user-name")...)
+		}
+	}
+	for _, rl := range children(n, "rule-list") {
+		list := RuleList{Groups: values(rl, "group")}
+		list.Name, _ = value(rl, "name")
+		for _, r := range children(rl, "rule") {
+			rule, err := parseRule(r, c)
+			if err != nil {
+				return nil, errors.Wrapf(err, "rule-list %s", list.Name)
+			}
+			list.Rules = append(list.Rules, rule)
+		}
+		cfg.RuleLists = append(cfg.RuleLists, list)
+	}
+	return cfg, nil
+}
+
+// parseRule returns the rule of the <rule> element r.
+func parseRule(r dom.Node, c *modules.Collection) (Rule, error) {
+	rule := Rule{Module: "*", Access: AccessAll}
+	rule.Name, _ = value(r, "name")
+	if v, ok := value(r, "module-name"); ok {
+		rule.Module = v
+	}
+	rule.RPC, _ = value(r, "rpc-name")
+	rule.Notification, _ = value(r, "notification-name")
+	if p := child(r, "path"); p != nil {
+		path, err := datastore.ParseInstanceID(strings.TrimSpace(p.ChildValue()), namespaceLookup(p, c))
+		if err != nil {
+			return rule, errors.Wrapf(err, "rule %s path", rule.Name)
+		}
+		rule.Path = path
+	}
+	var err error
+	if v, ok := value(r, "access-operations"); ok {
+		if rule.Access, err = parseAccess(v); err != nil {
+			return rule, errors.Wrapf(err, "rule %s", rule.Name)
+		}
+	}
+	v, ok := value(r, "action")
+	if !ok {
+		return rule, errors.Errorf("rule %s has no action", rule.Name)
+	}
+	if rule.Action, err = parseAction(v); err != nil {
+		return rule, errors.Wrapf(err, "rule %s", rule.Name)
+	}
+	return rule, nil
+}
+
+// namespaceLookup returns the namespace of a prefix of a path in the
+// element n: an XML namespace prefix in scope, or a module name or
+// prefix of c.
+func namespaceLookup(n dom.Node, c *modules.Collection) func(string) (string, error) {
+	return func(prefix string) (string, error) {
+		for it := n; it != nil; it = it.Parent() {
+			ap, ok := it.(dom.AttributeProvider)
+			if !ok {
+				continue
+			}
+			for a := dom.Node(ap.FirstAttribute()); a != nil; a = a.NextSibling() {
+				if name := a.Name(); name.Space == "xmlns" && name.Local == prefix {
+					return a.Value(), nil
+				}
+			}
+		}
+		if c != nil {
+			if e, err := c.ModuleEntry(prefix); err == nil {
+				return e.Namespace().Name, nil
+			}
+			if mod, err := c.Raw().FindModuleByPrefix(prefix); err == nil && mod.Namespace != nil {
+				return mod.Namespace.Name, nil
+			}
+		}
+		return "", errors.Errorf("undeclared namespace prefix %q", prefix)
+	}
+}
+
+// child returns the ietf-netconf-acm child element local of n, or nil.
+func child(n dom.Node, local string) dom.Node {
+	return n.ChildByName(xml.Name{Space: Namespace, Local: local})
+}
+
+// children returns the ietf-netconf-acm child elements local of n.
+func children(n dom.Node, local string) []dom.Node {
+	return n.ChildrenByName(xml.Name{Space: Namespace, Local: local})
+}
+
+// value returns the value of the leaf local of n, and true if n has it.
+func value(n dom.Node, local string) (string, bool) {
+	if c := child(n, local); c != nil {
+		return strings.TrimSpace(c.ChildValue()), true
+	}
+	return "", false
+}
+
+// values returns the values of the leaf-list local of n.
+func values(n dom.Node, local string) []string {
+	var vs []string
+	for _, c := range children(n, local) {
+		vs = append(vs, strings.TrimSpace(c.ChildValue()))
+	}
+	return vs
+}
@@ -0,0 +1,316 @@
+package nacm
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	xml "github.com/andaru/flexml"
+	"github.com/andaru/opr8/datastore"
+	"github.com/andaru/opr8/dom"
+	"github.com/andaru/opr8/modules"
+	"github.com/andaru/opr8/rpc"
+	"github.com/andaru/opr8/session"
+	"github.com/andaru/opr8/session/netconf"
+	"github.com/andaru/opr8/transport/transporttest"
+)
+
+const testModule = `module nacm-test {
+  namespace "urn:nacm-test"; prefix nt;
+  extension default-deny-all;
+  container system {
+    leaf host-name { type string; }
+    list user { key name; leaf name { type string; } leaf uid { type uint32; } }
+    container secret { nt:default-deny-all; leaf key { type string; } }
+  }
+  notification link-up { leaf if { type string; } }
+  notification link-down { leaf if { type string; } }
+  notification alarm { nt:default-deny-all; }
+}`
+
+const testData = `<system xmlns="urn:nacm-test"><host-name>a</host-name>` +
+	`<user><name>x</name><uid>1</uid></user><secret><key>k</key></secret></system>`
+
+const testConfig = `<nacm xmlns="urn:ietf:params:xml:ns:yang:ietf-netconf-acm">
+  <write-default>permit</write-default>
+  <groups>
+    <group><name>admin</name><user-name>alice</user-name></group>
+    <group><name>ops</name><user-name>bob</user-name></group>
+  </groups>
+  <rule-list>
+    <name>admin</name><group>admin</group>
+    <rule><name>all</name><action>permit</action></rule>
+  </rule-list>
+  <rule-list>
+    <name>ops</name><group>ops</group>
+    <rule>
+      <name>users</name><path xmlns:t="urn:nacm-test">/t:system/t:user</path>
+      <access-operations>create update delete</access-operations><action>deny</action>
+    </rule>
+    <rule>
+      <name>uids</name><path>/nacm-test:system/user/uid</path>
+      <access-operations>read</access-operations><action>deny</action>
+    </rule>
+    <rule>
+      <name>link-up</name><notification-name>link-up</notification-name>
+      <access-operations>read</access-operations><action>deny</action>
+    </rule>
+    <rule>
+      <name>validate</name><module-name>ietf-netconf</module-name><rpc-name>validate</rpc-name>
+      <action>deny</action>
+    </rule>
+  </rule-list>
+</nacm>`
+
+// parse returns the document of the XML s.
+func parse(t *testing.T, s string) dom.Document {
+	t.Helper()
+	doc := dom.NewDocument(nil)
+	if _, err := dom.NewUnmarshaler(dom.NewBuilder(doc, dom.WithTrimPCData())).XMLReader().ReadFrom(strings.NewReader(s)); err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+// set returns an edit function replacing the data with that of the XML
+// documents.
+func set(t *testing.T, docs ...string) func(root dom.Document) error {
+	return func(root dom.Document) error {
+		for it := root.FirstChild(); it != nil; it = root.FirstChild() {
+			_ = root.RemoveChild(it)
+		}
+		for _, s := range docs {
+			if err := root.AppendChild(dom.CloneNode(parse(t, s).DocumentElement(), true)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// marshal returns the XML encoding of the children of n.
+func marshal(t *testing.T, n dom.Node) string {
+	t.Helper()
+	var b bytes.Buffer
+	for it := n.FirstChild(); it != nil; it = it.NextSibling() {
+		if _, err := dom.NewMarshaler(it).XMLWriter().WriteTo(&b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return b.String()
+}
+
+func newTestCollection(t *testing.T) *modules.Collection {
+	t.Helper()
+	c := modules.NewCollection()
+	if err := c.ReadString("nacm-test", testModule); err != nil {
+		t.Fatal(err)
+	}
+	if errs := c.Process(); errs != nil {
+		t.Fatal(errs)
+	}
+	return c
+}
+
+func newTestDatastore(t *testing.T) *datastore.Datastore {
+	t.Helper()
+	ds := datastore.New(datastore.Running, newTestCollection(t))
+	if _, err := ds.Update(0, "", set(t, testData, testConfig)); err != nil {
+		t.Fatal(err)
+	}
+	return ds
+}
+
+func TestParseConfig(t *testing.T) {
+	c := newTestCollection(t)
+	cfg, err := ParseConfig(parse(t, testConfig), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.Enabled || cfg.ReadDefault != Permit || cfg.WriteDefault != Permit || cfg.ExecDefault != Permit {
+		t.Errorf("ParseConfig() = %+v, want enabled, permitting by default", cfg)
+	}
+	if want := map[string][]string{"admin": {"alice"}, "ops": {"bob"}}; !reflect.DeepEqual(cfg.Groups, want) {
+		t.Errorf("Groups = %v, want %v", cfg.Groups, want)
+	}
+	if len(cfg.RuleLists) != 2 || len(cfg.RuleLists[1].Rules) != 4 {
+		t.Fatalf("RuleLists = %+v, want admin and ops", cfg.RuleLists)
+	}
+	users := cfg.RuleLists[1].Rules[0]
+	if users.Access != AccessCreate|AccessUpdate|AccessDelete || users.Action != Deny || users.Path.Format(nil) != "/urn:nacm-test:system/user" {
+		t.Errorf("rule = %+v, want deny writes of /system/user", users)
+	}
+
+	for _, tt := range []struct {
+		name, config string
+		wantErr      bool
+	}{
+		{name: "none", config: `<system xmlns="urn:nacm-test"/>`},
+		{name: "bad action", config: `<nacm xmlns="urn:ietf:params:xml:ns:yang:ietf-netconf-acm"><read-default>maybe</read-default></nacm>`, wantErr: true},
+		{name: "bad boolean", config: `<nacm xmlns="urn:ietf:params:xml:ns:yang:ietf-netconf-acm"><enable-nacm>yes</enable-nacm></nacm>`, wantErr: true},
+		{name: "bad access", config: `<nacm xmlns="urn:ietf:params:xml:ns:yang:ietf-netconf-acm"><rule-list><rule><access-operations>write</access-operations><action>deny</action></rule></rule-list></nacm>`, wantErr: true},
+		{name: "no action", config: `<nacm xmlns="urn:ietf:params:xml:ns:yang:ietf-netconf-acm"><rule-list><rule><name>r</name></rule></rule-list></nacm>`, wantErr: true},
+		{name: "undeclared prefix", config: `<nacm xmlns="urn:ietf:params:xml:ns:yang:ietf-netconf-acm"><rule-list><rule><path>/x:system</path><action>deny</action></rule></rule-list></nacm>`, wantErr: true},
+	} {
+		if _, err := ParseConfig(parse(t, tt.config), c); (err != nil) != tt.wantErr {
+			t.Errorf("%s: ParseConfig() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestEnforcer(t *testing.T) {
+	ds := newTestDatastore(t)
+	e := New(ds, WithRecoveryUser("root"))
+	if err := e.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	op := func(local string) xml.Name { return xml.Name{Space: netconf.BaseNamespace, Local: local} }
+	for _, tt := range []struct {
+		user, op string
+		wantErr  bool
+	}{
+		{user: "bob", op: "get"},
+		{user: "bob", op: "validate", wantErr: true},
+		{user: "bob", op: "close-session"},
+		{user: "carol", op: "kill-session", wantErr: true},
+		{user: "carol", op: "delete-config", wantErr: true},
+		{user: "alice", op: "kill-session"},
+		{user: "root", op: "kill-session"},
+	} {
+		err := e.AuthorizeOperation(tt.user, op(tt.op))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("AuthorizeOperation(%s, %s) error = %v, wantErr %v", tt.user, tt.op, err, tt.wantErr)
+		}
+	}
+	if got := e.DeniedOperations(); got != 3 {
+		t.Errorf("DeniedOperations() = %d, want 3", got)
+	}
+
+	for _, tt := range []struct {
+		user, event string
+		wantErr     bool
+	}{
+		{user: "bob", event: "link-down"},
+		{user: "bob", event: "link-up", wantErr: true},
+		{user: "carol", event: "link-up"},
+		{user: "bob", event: "alarm", wantErr: true},
+		{user: "alice", event: "alarm"},
+	} {
+		err := e.AuthorizeNotification(tt.user, xml.Name{Space: "urn:nacm-test", Local: tt.event})
+		if (err != nil) != tt.wantErr {
+			t.Errorf("AuthorizeNotification(%s, %s) error = %v, wantErr %v", tt.user, tt.event, err, tt.wantErr)
+		}
+	}
+
+	const system = `<system xmlns="urn:nacm-test"><host-name>a</host-name>`
+	for _, tt := range []struct {
+		user, want string
+	}{
+		{user: "bob", want: system + `<user><name>x</name></user></system>`},
+		{user: "carol", want: system + `<user><name>x</name><uid>1</uid></user></system>`},
+		{user: "alice", want: testData + "<nacm"},
+		{user: "root", want: testData + "<nacm"},
+	} {
+		root := dom.CloneNode(ds.Snapshot().Root, true)
+		e.FilterRead(tt.user, root)
+		if got := marshal(t, root); !strings.HasPrefix(got, tt.want) || !strings.HasSuffix(tt.want, "<nacm") && got != tt.want {
+			t.Errorf("FilterRead(%s) = %s, want %s", tt.user, got, tt.want)
+		}
+	}
+
+	for _, tt := range []struct {
+		name, user, data string
+		wantErr          bool
+	}{
+		{name: "update host-name", user: "bob", data: `<system xmlns="urn:nacm-test"><host-name>b</host-name><user><name>x</name><uid>1</uid></user><secret><key>k</key></secret></system>`},
+		{name: "create user", user: "bob", data: `<system xmlns="urn:nacm-test"><host-name>a</host-name><user><name>x</name><uid>1</uid></user><user><name>y</name></user><secret><key>k</key></secret></system>`, wantErr: true},
+		{name: "update uid", user: "bob", data: `<system xmlns="urn:nacm-test"><host-name>a</host-name><user><name>x</name><uid>2</uid></user><secret><key>k</key></secret></system>`, wantErr: true},
+		{name: "create user by other", user: "carol", data: `<system xmlns="urn:nacm-test"><host-name>a</host-name><user><name>x</name><uid>1</uid></user><user><name>y</name></user><secret><key>k</key></secret></system>`},
+		{name: "delete secret", user: "carol", data: `<system xmlns="urn:nacm-test"><host-name>a</host-name><user><name>x</name><uid>1</uid></user></system>`, wantErr: true},
+		{name: "delete secret by admin", user: "alice", data: `<system xmlns="urn:nacm-test"><host-name>a</host-name><user><name>x</name><uid>1</uid></user></system>`},
+	} {
+		prev := ds.Snapshot().Root
+		next := dom.CloneNode(prev, true).(dom.Document)
+		if err := set(t, tt.data, testConfig)(next); err != nil {
+			t.Fatal(err)
+		}
+		err := e.AuthorizeWrite(tt.user, prev, next)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: AuthorizeWrite(%s) error = %v, wantErr %v", tt.name, tt.user, err, tt.wantErr)
+		}
+	}
+	if got := e.DeniedDataWrites(); got != 3 {
+		t.Errorf("DeniedDataWrites() = %d, want 3", got)
+	}
+
+	// the configuration is reloaded when the datastore changes, and an
+	// invalid configuration is not
+	disabled := strings.Replace(testConfig, "<write-default>", "<enable-nacm>false</enable-nacm><write-default>", 1)
+	if _, err := ds.Update(0, "", set(t, testData, disabled)); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.AuthorizeOperation("carol", op("kill-session")); err != nil || e.Config().Enabled {
+		t.Errorf("AuthorizeOperation() with NACM disabled error = %v, want nil", err)
+	}
+	invalid := strings.Replace(testConfig, "<action>permit</action>", "<action>allow</action>", 1)
+	if _, err := ds.Update(0, "", set(t, testData, invalid)); err != nil {
+		t.Fatal(err)
+	}
+	if e.Err() == nil || e.Config().Enabled {
+		t.Errorf("Err(), Config() after invalid configuration = %v, %+v, want error and the previous configuration", e.Err(), e.Config())
+	}
+}
+
+func TestEnforcer_rpc(t *testing.T) {
+	ds := newTestDatastore(t)
+	d := rpc.NewDispatcher()
+	mgr := session.NewManager(session.WithAcceptor(netconf.NewAcceptor(nil, d)))
+	rpc.NewBase(datastore.NewSet(ds), mgr).Register(d)
+	d.SetAuthorizer(New(ds))
+
+	client, server := transporttest.Pipe(transporttest.WithKind("ssh"), transporttest.WithUsername("bob"))
+	if _, err := mgr.Accept(context.Background(), server); err != nil {
+		t.Fatal(err)
+	}
+	dec := xml.NewDecoder(client)
+	if err := dec.Decode(&struct{}{}); err != nil {
+		t.Fatal(err)
+	}
+	write := func(s string) {
+		if _, err := client.Write([]byte(s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(`<hello xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><capabilities><capability>urn:ietf:params:netconf:base:1.0</capability></capabilities></hello>`)
+
+	var reply struct {
+		Tag  string `xml:"rpc-error>error-tag"`
+		Data struct {
+			UIDs []string `xml:"system>user>uid"`
+		} `xml:"data"`
+	}
+	call := func(id int, op string) {
+		t.Helper()
+		write(fmt.Sprintf(`<rpc xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="%d">%s</rpc>`, id, op))
+		reply.Tag, reply.Data.UIDs = "", nil
+		if err := dec.Decode(&reply); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if call(1, `<validate><source><running/></source></validate>`); reply.Tag != "access-denied" {
+		t.Errorf("validate error-tag = %q, want access-denied", reply.Tag)
+	}
+	if call(2, `<get/>`); reply.Tag != "" || len(reply.Data.UIDs) != 0 {
+		t.Errorf("get = %+v, want no uids", reply)
+	}
+	if call(3, `<edit-config><target><running/></target><config><system xmlns="urn:nacm-test"><user><name>y</name></user></system></config></edit-config>`); reply.Tag != "access-denied" {
+		t.Errorf("edit-config error-tag = %q, want access-denied", reply.Tag)
+	}
+	if call(4, `<edit-config><target><running/></target><config><system xmlns="urn:nacm-test"><host-name>b</host-name></system></config></edit-config>`); reply.Tag != "" {
+		t.Errorf("edit-config error-tag = %q, want none", reply.Tag)
+	}
+}
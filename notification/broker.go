@@ -0,0 +1,223 @@
+package notification
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	xml "github.com/andaru/flexml"
+	"github.com/andaru/opr8/session"
+	"github.com/pkg/errors"
+)
+
+// OverflowPolicy is the policy of a subscription's delivery queue
+// when it is full.
+type OverflowPolicy int
+
+const (
+	// OverflowWait makes Publish wait for room in the queue, so slow
+	// subscribers apply backpressure to publishers.
+	OverflowWait OverflowPolicy = iota
+	// OverflowDrop drops notifications published while the queue is
+	// full, counting them.
+	OverflowDrop
+)
+
+// Option is a constructor option for Broker.
+type Option func(*Broker)
+
+// WithQueue is a Broker option setting the size of each
+// subscription's delivery queue, 64 by default, and the policy
+// applied when it is full.
+func WithQueue(size int, overflow OverflowPolicy) Option {
+	return func(b *Broker) { b.queueSize, b.overflow = size, overflow }
+}
+
+// WithEventLogs is a Broker option giving each stream added the event
+// log returned by newLog for its name, supporting the replay of its
+// notifications to subscriptions with a startTime. The log of the
+// NETCONF stream has the notifications published on every stream.
+// Streams have no log, and do not support replay, by default.
+func WithEventLogs(newLog func(stream string) EventLog) Option {
+	return func(b *Broker) { b.newLog = newLog }
+}
+
+// WithAuthorizer is a Broker option setting the access control of the
+// notifications delivered to subscribers, by the username of their
+// sessions. Notifications are not checked by default.
+func WithAuthorizer(a Authorizer) Option {
+	return func(b *Broker) { b.auth = a }
+}
+
+// Authorizer is the access control of event notifications, such as the
+// NETCONF access control model's (RFC 8341 section 3.4.6).
+type Authorizer interface {
+	// AuthorizeNotification returns an error if the user may not
+	// receive the notification with the event element name.
+	AuthorizeNotification(user string, name xml.Name) error
+}
+
+// Broker holds the event streams of a server and the subscriptions to
+// them. It is safe for concurrent use.
+type Broker struct {
+	mgr       session.Manager
+	queueSize int
+	overflow  OverflowPolicy
+	newLog    func(stream string) EventLog
+	auth      Authorizer
+
+	mu      sync.Mutex
+	streams map[string]*Stream
+	// subs are the subscriptions, by session ID
+	subs map[session.ID]*subscription
+}
+
+// NewBroker returns a new Broker with the default NETCONF stream,
+// ending subscriptions when their sessions, managed by mgr, end.
+func NewBroker(mgr session.Manager, options ...Option) *Broker {
+	b := &Broker{
+		mgr:       mgr,
+		queueSize: 64,
+		streams:   map[string]*Stream{},
+		subs:      map[session.ID]*subscription{},
+	}
+	for _, option := range options {
+		option(b)
+	}
+	b.AddStream(DefaultStream, "default NETCONF event stream")
+	return b
+}
+
+// AddStream adds the named stream with the description, returning it,
+// or the stream of that name already added.
+func (b *Broker) AddStream(name, description string) *Stream {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if s, ok := b.streams[name]; ok {
+		return s
+	}
+	s := &Stream{b: b, name: name, description: description}
+	if b.newLog != nil {
+		s.log = b.newLog(name)
+	}
+	b.streams[name] = s
+	return s
+}
+
+// Stream returns the named stream, or nil if there is none.
+func (b *Broker) Stream(name string) *Stream {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.streams[name]
+}
+
+// Streams returns the streams, sorted by name.
+func (b *Broker) Streams() []*Stream {
+	b.mu.Lock()
+	streams := make([]*Stream, 0, len(b.streams))
+	for _, s := range b.streams {
+		streams = append(streams, s)
+	}
+	b.mu.Unlock()
+	sort.Slice(streams, func(i, j int) bool { return streams[i].name < streams[j].name })
+	return streams
+}
+
+// Subscribed returns true if the session with the ID has a
+// subscription.
+func (b *Broker) Subscribed(id session.ID) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, ok := b.subs[id]
+	return ok
+}
+
+// Capabilities returns the capability URIs of event notifications,
+// to be advertised by the NETCONF acceptor.
+func (b *Broker) Capabilities() []string { return []string{CapNotification, CapInterleave} }
+
+// Stream is a named event stream.
+type Stream struct {
+	b                 *Broker
+	name, description string
+	// log is the stream's event log, or nil if it does not support
+	// replay
+	log EventLog
+
+	published, dropped uint64 // accessed atomically
+}
+
+// Name returns the stream name.
+func (s *Stream) Name() string { return s.name }
+
+// Description returns the stream description.
+func (s *Stream) Description() string { return s.description }
+
+// Log returns the stream's event log, or nil if the stream does not
+// support replay.
+func (s *Stream) Log() EventLog { return s.log }
+
+// Published returns the number of notifications published on the
+// stream.
+func (s *Stream) Published() uint64 { return atomic.LoadUint64(&s.published) }
+
+// Dropped returns the number of notifications published on the stream
+// which were dropped from the full delivery queues of subscribers.
+func (s *Stream) Dropped() uint64 { return atomic.LoadUint64(&s.dropped) }
+
+// Publish queues the notification n for delivery to the subscribers
+// of the stream, and those of the NETCONF stream, whose filters select
+// it, after appending it to the event logs of the stream and the
+// NETCONF stream. With the OverflowWait policy, Publish waits for room
+// in the queues of slow subscribers, returning the context's error if
+// it is done first. An error appending n to a log is returned once n
+// is queued.
+func (s *Stream) Publish(ctx context.Context, n *Notification) error {
+	atomic.AddUint64(&s.published, 1)
+	s.b.mu.Lock()
+	// logs are appended to with the lock held, so subscriptions
+	// replaying them receive each notification once
+	logErr := s.append(n)
+	var subs []*subscription
+	for _, sub := range s.b.subs {
+		if sub.stream == s || sub.stream.name == DefaultStream {
+			subs = append(subs, sub)
+		}
+	}
+	s.b.mu.Unlock()
+
+	for _, sub := range subs {
+		if !sub.selects(n) {
+			continue
+		}
+		if s.b.overflow == OverflowDrop {
+			if !sub.offer(n) {
+				atomic.AddUint64(&s.dropped, 1)
+			}
+			continue
+		}
+		if err := sub.wait(ctx, n); err != nil {
+			return err
+		}
+	}
+	return logErr
+}
+
+// append appends n to the event logs of the stream and the NETCONF
+// stream, with the Broker's lock held.
+func (s *Stream) append(n *Notification) error {
+	streams := []*Stream{s}
+	if def := s.b.streams[DefaultStream]; def != nil && def != s {
+		streams = append(streams, def)
+	}
+	for _, it := range streams {
+		if it.log == nil {
+			continue
+		}
+		if err := it.log.Append(n); err != nil {
+			return errors.Wrapf(err, "stream %s event log", it.name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+/*
+Package notification has NETCONF event notifications (RFC 5277): named
+event streams, <create-subscription> and the delivery of the
+<notification> messages of a stream to its subscribers.
+
+A Broker holds the streams, including the default NETCONF stream,
+which carries the notifications published on every stream. Its
+create-subscription handler is registered with an rpc.Dispatcher:
+
+	b := notification.NewBroker(mgr)
+	b.Register(d)
+	acc := netconf.NewAcceptor(c, d, netconf.WithCapabilities(b.Capabilities()...))
+	...
+	b.Stream(notification.DefaultStream).Publish(ctx, notification.New(event))
+
+Each subscription has a delivery queue, written to its session in the
+background. Publish waits for room in the queues of slow subscribers,
+or drops their notifications, according to the Broker's
+OverflowPolicy. Subscriptions end with their sessions.
+
+Streams given an EventLog, with the WithEventLogs option, support the
+replay of their logged notifications to subscriptions with a
+startTime, before those published after the subscription, followed by
+a replayComplete notification. MemoryLog keeps a stream's most recent
+notifications in memory:
+
+	b := notification.NewBroker(mgr, notification.WithEventLogs(func(string) notification.EventLog {
+		return notification.NewMemoryLog(1000)
+	}))
+
+Push has YANG-Push (RFC 8641) subscriptions to datastores, made with
+the establish-subscription, modify-subscription and delete-subscription
+operations of RFC 8639. Periodic subscriptions send the subscribed data
+in a <push-update> every period; on-change subscriptions send it once,
+then a <push-change-update> YANG Patch of each commit changing it, no
+more often than their dampening period:
+
+	p := notification.NewPush(set, mgr)
+	p.Register(d)
+*/
+package notification
+
+import (
+	"bytes"
+	"time"
+
+	xml "github.com/andaru/flexml"
+	"github.com/andaru/opr8/dom"
+	"github.com/pkg/errors"
+)
+
+// Event notification namespaces, capabilities and the default stream.
+const (
+	// Namespace is the namespace of the <notification> envelope and
+	// the create-subscription operation.
+	Namespace = "urn:ietf:params:xml:ns:netconf:notification:1.0"
+	// NetmodNamespace is the namespace of the stream list and the
+	// replayComplete and notificationComplete notifications.
+	NetmodNamespace = "urn:ietf:params:xml:ns:netmod:notification"
+	// CapNotification is the :notification:1.0 capability.
+	CapNotification = "urn:ietf:params:netconf:capability:notification:1.0"
+	// CapInterleave is the :interleave:1.0 capability, allowing RPCs
+	// on sessions with a subscription.
+	CapInterleave = "urn:ietf:params:netconf:capability:interleave:1.0"
+	// DefaultStream is the name of the stream carrying every
+	// notification.
+	DefaultStream = "NETCONF"
+)
+
+// Notification is an event notification.
+type Notification struct {
+	// EventTime is the time the event occurred.
+	EventTime time.Time
+	// Event is the event's element, such as that of a YANG
+	// notification statement.
+	Event dom.Node
+}
+
+// New returns the notification of the event element, occurring now.
+func New(event dom.Node) *Notification {
+	return &Notification{EventTime: time.Now(), Event: event}
+}
+
+// Element returns the <notification> message of the notification, with
+// its eventTime and a copy of the event element.
+func (n *Notification) Element() dom.Element {
+	e := dom.CreateElement(xml.StartElement{Name: xml.Name{Space: Namespace, Local: "notification"}})
+	eventTime := dom.CreateElement(xml.StartElement{Name: xml.Name{Space: Namespace, Local: "eventTime"}})
+	_ = eventTime.AppendChild(dom.CreateText(xml.CharData(n.EventTime.Format(time.RFC3339Nano))))
+	_ = e.AppendChild(eventTime)
+	if n.Event != nil {
+		_ = e.AppendChild(dom.CloneNode(n.Event, true))
+	}
+	return e
+}
+
+// Marshal returns the XML encoding of the <notification> message.
+func (n *Notification) Marshal() ([]byte, error) {
+	var b bytes.Buffer
+	if _, err := dom.NewMarshaler(n.Element()).XMLWriter().WriteTo(&b); err != nil {
+		return nil, errors.Wrap(err, "notification")
+	}
+	return b.Bytes(), nil
+}
+
+// netmodEvent returns the notification of the event element named
+// local in the netmod notification namespace, such as
+// notificationComplete.
+func netmodEvent(local string) *Notification {
+	return New(dom.CreateElement(xml.StartElement{Name: xml.Name{Space: NetmodNamespace, Local: local}}))
+}
@@ -0,0 +1,385 @@
+package notification
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	xml "github.com/andaru/flexml"
+	"github.com/andaru/opr8/dom"
+	"github.com/andaru/opr8/rpc"
+	"github.com/andaru/opr8/session"
+	"github.com/andaru/opr8/session/netconf"
+	"github.com/andaru/opr8/transport/transporttest"
+	"github.com/pkg/errors"
+)
+
+// testEvent returns the event element of the XML document s.
+func testEvent(t *testing.T, s string) dom.Element {
+	t.Helper()
+	doc := dom.NewDocument(nil)
+	if _, err := dom.NewUnmarshaler(dom.NewBuilder(doc, dom.WithTrimPCData())).XMLReader().ReadFrom(strings.NewReader(s)); err != nil {
+		t.Fatal(err)
+	}
+	return doc.DocumentElement()
+}
+
+func TestNotification_Marshal(t *testing.T) {
+	n := &Notification{
+		EventTime: time.Date(2007, 7, 8, 0, 1, 0, 0, time.UTC),
+		Event:     testEvent(t, `<link-down xmlns="urn:test"><if>eth0</if></link-down>`),
+	}
+	b, err := n.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<notification xmlns="urn:ietf:params:xml:ns:netconf:notification:1.0"><eventTime>2007-07-08T00:01:00Z</eventTime>` +
+		`<link-down xmlns="urn:test"><if>eth0</if></link-down></notification>`
+	if string(b) != want {
+		t.Errorf("Marshal() = %s, want %s", b, want)
+	}
+}
+
+// testClient is the client of a NETCONF session.
+type testClient struct {
+	t  *testing.T
+	w  io.Writer
+	d  *xml.Decoder
+	id int
+}
+
+type testMessage struct {
+	XMLName xml.Name
+	OK      *struct{} `xml:"ok"`
+	Tag     string    `xml:"rpc-error>error-tag"`
+	Event   struct {
+		XMLName xml.Name
+		If      string `xml:"if"`
+	} `xml:",any"`
+}
+
+func newTestClient(t *testing.T, mgr session.Manager, options ...transporttest.Option) (*testClient, session.ID) {
+	t.Helper()
+	client, server := transporttest.Pipe(append([]transporttest.Option{transporttest.WithKind("ssh")}, options...)...)
+	s, err := mgr.Accept(context.Background(), server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &testClient{t: t, w: client, d: xml.NewDecoder(client)}
+	if err := c.d.Decode(&struct{}{}); err != nil {
+		t.Fatal(err)
+	}
+	c.write(`<hello xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><capabilities><capability>urn:ietf:params:netconf:base:1.0</capability></capabilities></hello>`)
+	return c, s.ID()
+}
+
+func (c *testClient) write(msg string) {
+	c.t.Helper()
+	if _, err := c.w.Write([]byte(msg)); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *testClient) read() testMessage {
+	c.t.Helper()
+	var m testMessage
+	if err := c.d.Decode(&m); err != nil {
+		c.t.Fatal(err)
+	}
+	return m
+}
+
+// rpc sends the operation op and returns the reply's result, "ok" or
+// its error-tag.
+func (c *testClient) rpc(op string) string {
+	c.t.Helper()
+	c.id++
+	c.write(fmt.Sprintf(`<rpc xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="%d">%s</rpc>`, c.id, op))
+	if m := c.read(); m.OK == nil {
+		return m.Tag
+	}
+	return "ok"
+}
+
+func TestBroker(t *testing.T) {
+	d := rpc.NewDispatcher()
+	mgr := session.NewManager(session.WithAcceptor(netconf.NewAcceptor(nil, d)))
+	b := NewBroker(mgr)
+	b.Register(d)
+	ports := b.AddStream("ports", "port events")
+	if got := len(b.Streams()); got != 2 || b.Streams()[0].Name() != DefaultStream {
+		t.Errorf("Streams() = %d streams, want NETCONF and ports", got)
+	}
+	c, id := newTestClient(t, mgr)
+
+	const sub = `<create-subscription xmlns="urn:ietf:params:xml:ns:netconf:notification:1.0">%s</create-subscription>`
+	for _, tt := range []struct {
+		name, params, want string
+	}{
+		{"unknown stream", `<stream>nope</stream>`, "invalid-value"},
+		{"xpath filter", `<filter type="xpath" select="/link-down"/>`, "operation-not-supported"},
+		{"bad startTime", `<startTime>yesterday</startTime>`, "invalid-value"},
+		{"stopTime alone", `<stopTime>2020-01-01T00:00:00Z</stopTime>`, "missing-element"},
+		{"stopTime before startTime", `<startTime>2020-01-02T00:00:00Z</startTime><stopTime>2020-01-01T00:00:00Z</stopTime>`, "bad-element"},
+		{"startTime in the future", `<startTime>2999-01-01T00:00:00Z</startTime>`, "bad-element"},
+		{"no replay", `<startTime>2020-01-01T00:00:00Z</startTime>`, "operation-failed"},
+		{"subscribe", `<stream>NETCONF</stream><filter><link-down xmlns="urn:test"><if>eth1</if></link-down></filter>`, "ok"},
+		{"subscribed", ``, "in-use"},
+	} {
+		if got := c.rpc(fmt.Sprintf(sub, tt.params)); got != tt.want {
+			t.Errorf("%s: reply = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+	if !b.Subscribed(id) {
+		t.Fatalf("Subscribed(%d) = false, want true", id)
+	}
+
+	ctx := context.Background()
+	for _, event := range []string{
+		`<link-down xmlns="urn:test"><if>eth0</if></link-down>`,
+		`<link-up xmlns="urn:test"><if>eth1</if></link-up>`,
+		`<link-down xmlns="urn:test"><if>eth1</if></link-down>`,
+	} {
+		if err := ports.Publish(ctx, New(testEvent(t, event))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m := c.read()
+	if m.XMLName.Local != "notification" || m.Event.XMLName.Local != "link-down" || m.Event.If != "eth1" {
+		t.Errorf("notification = %+v, want link-down of eth1", m)
+	}
+	if got := ports.Published(); got != 3 {
+		t.Errorf("Published() = %d, want 3", got)
+	}
+	if s, ok := mgr.Get(id); !ok {
+		t.Errorf("Get(%d) = false, want true", id)
+	} else if got := s.(session.Stats).OutNotifications(); got != 1 {
+		t.Errorf("OutNotifications() = %d, want 1", got)
+	}
+
+	if err := mgr.Terminate(id, nil); err != nil {
+		t.Fatal(err)
+	}
+	if b.Subscribed(id) {
+		t.Errorf("Subscribed(%d) after session end = true, want false", id)
+	}
+}
+
+// testNotifier is a notifier recording the notifications delivered,
+// which waits for release to be closed before each.
+type testNotifier struct {
+	release chan struct{}
+	mu      sync.Mutex
+	got     []string
+}
+
+func (n *testNotifier) Notify(e dom.Element) error {
+	<-n.release
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.got = append(n.got, e.LastChild().Name().Local)
+	return nil
+}
+
+func (n *testNotifier) delivered() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]string(nil), n.got...)
+}
+
+func TestStream_Publish_overflow(t *testing.T) {
+	event := func(local string) *Notification {
+		return New(dom.CreateElement(xml.StartElement{Name: xml.Name{Space: "urn:test", Local: local}}))
+	}
+
+	t.Run("drop", func(t *testing.T) {
+		b := NewBroker(nil, WithQueue(1, OverflowDrop))
+		stream := b.Stream(DefaultStream)
+		n := &testNotifier{release: make(chan struct{})}
+		sub, err := b.subscribe(1, "", n, stream, nil, time.Time{}, time.Time{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer sub.cancel()
+		go sub.deliver()
+		// the first is taken by the delivery goroutine, and the second
+		// queued, before the third is dropped
+		for _, local := range []string{"a", "b", "c"} {
+			if err := stream.Publish(context.Background(), event(local)); err != nil {
+				t.Fatal(err)
+			}
+			if local == "a" {
+				for len(sub.queue) > 0 {
+					time.Sleep(time.Millisecond)
+				}
+			}
+		}
+		if got := stream.Dropped(); got != 1 {
+			t.Errorf("Dropped() = %d, want 1", got)
+		}
+		close(n.release)
+		for start := time.Now(); len(n.delivered()) < 2; time.Sleep(time.Millisecond) {
+			if time.Since(start) > time.Second {
+				t.Fatalf("delivered = %v, want [a b]", n.delivered())
+			}
+		}
+	})
+
+	t.Run("wait", func(t *testing.T) {
+		b := NewBroker(nil, WithQueue(0, OverflowWait))
+		stream := b.Stream(DefaultStream)
+		n := &testNotifier{release: make(chan struct{})}
+		sub, err := b.subscribe(1, "", n, stream, nil, time.Time{}, time.Time{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer sub.cancel()
+		go sub.deliver()
+		if err := stream.Publish(context.Background(), event("a")); err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		if err := stream.Publish(ctx, event("b")); err != context.DeadlineExceeded {
+			t.Errorf("Publish() to a full queue error = %v, want %v", err, context.DeadlineExceeded)
+		}
+		close(n.release)
+	})
+
+	t.Run("stop", func(t *testing.T) {
+		b := NewBroker(nil)
+		n := &testNotifier{release: make(chan struct{})}
+		close(n.release)
+		sub, err := b.subscribe(1, "", n, b.Stream(DefaultStream), nil, time.Time{}, time.Now().Add(10*time.Millisecond))
+		if err != nil {
+			t.Fatal(err)
+		}
+		go sub.deliver()
+		for start := time.Now(); b.Subscribed(1); time.Sleep(time.Millisecond) {
+			if time.Since(start) > time.Second {
+				t.Fatal("subscription did not end at its stop time")
+			}
+		}
+		if got := n.delivered(); len(got) != 1 || got[0] != "notificationComplete" {
+			t.Errorf("delivered = %v, want [notificationComplete]", got)
+		}
+	})
+}
+
+// authorizerFunc is an Authorizer calling the function.
+type authorizerFunc func(user string, name xml.Name) error
+
+func (f authorizerFunc) AuthorizeNotification(user string, name xml.Name) error { return f(user, name) }
+
+func TestBroker_authorizer(t *testing.T) {
+	b := NewBroker(nil, WithAuthorizer(authorizerFunc(func(user string, name xml.Name) error {
+		if user == "bob" && name.Local == "link-up" {
+			return errors.New("denied")
+		}
+		return nil
+	})))
+	stream := b.Stream(DefaultStream)
+	n := &testNotifier{release: make(chan struct{})}
+	close(n.release)
+	sub, err := b.subscribe(1, "bob", n, stream, nil, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.cancel()
+	go sub.deliver()
+	for _, local := range []string{"link-up", "link-down"} {
+		event := dom.CreateElement(xml.StartElement{Name: xml.Name{Space: "urn:test", Local: local}})
+		if err := stream.Publish(context.Background(), New(event)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for start := time.Now(); len(n.delivered()) < 1; time.Sleep(time.Millisecond) {
+		if time.Since(start) > time.Second {
+			t.Fatal("no notification delivered")
+		}
+	}
+	if got := n.delivered(); len(got) != 1 || got[0] != "link-down" {
+		t.Errorf("delivered = %v, want [link-down]", got)
+	}
+}
+
+func TestBroker_replay(t *testing.T) {
+	d := rpc.NewDispatcher()
+	mgr := session.NewManager(session.WithAcceptor(netconf.NewAcceptor(nil, d)))
+	b := NewBroker(mgr, WithEventLogs(func(stream string) EventLog {
+		if stream == DefaultStream {
+			return NewMemoryLog(10)
+		}
+		return NewMemoryLog(2)
+	}))
+	b.Register(d)
+	ports := b.AddStream("ports", "port events")
+	if ports.Log() == nil || ports.Log().Created().IsZero() {
+		t.Fatal("ports has no event log")
+	}
+	ctx := context.Background()
+	start := time.Now().Add(-time.Hour).UTC()
+	for i, event := range []string{
+		`<link-down xmlns="urn:test"><if>eth0</if></link-down>`,
+		`<link-up xmlns="urn:test"><if>eth1</if></link-up>`,
+		`<link-down xmlns="urn:test"><if>eth1</if></link-down>`,
+	} {
+		n := &Notification{EventTime: start.Add(time.Duration(i) * time.Minute), Event: testEvent(t, event)}
+		if err := ports.Publish(ctx, n); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	const sub = `<create-subscription xmlns="urn:ietf:params:xml:ns:netconf:notification:1.0">%s</create-subscription>`
+	for _, tt := range []struct {
+		name, params string
+		// want are the notifications delivered, then a live one if
+		// the subscription does not end
+		want []string
+	}{
+		{
+			name:   "stream",
+			params: `<stream>ports</stream><startTime>` + start.Format(time.RFC3339Nano) + `</startTime>`,
+			want:   []string{"link-up eth1", "link-down eth1", "replayComplete ", "link-down eth2"},
+		},
+		{
+			name: "NETCONF with filter and stopTime",
+			params: `<filter><link-up xmlns="urn:test"/></filter><startTime>` + start.Format(time.RFC3339Nano) + `</startTime>` +
+				`<stopTime>` + start.Add(90*time.Second).Format(time.RFC3339Nano) + `</stopTime>`,
+			want: []string{"link-up eth1", "replayComplete ", "notificationComplete "},
+		},
+		{
+			name:   "no notifications",
+			params: `<startTime>` + start.Add(time.Hour).Format(time.RFC3339Nano) + `</startTime>`,
+			want:   []string{"replayComplete ", "link-down eth2"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c, id := newTestClient(t, mgr)
+			defer func() { _ = mgr.Terminate(id, nil) }()
+			if got := c.rpc(fmt.Sprintf(sub, tt.params)); got != "ok" {
+				t.Fatalf("reply = %q, want ok", got)
+			}
+			for i, want := range tt.want {
+				if strings.HasSuffix(want, "eth2") {
+					// live, but too old to be replayed by later subscriptions
+					n := &Notification{EventTime: start.Add(-time.Minute), Event: testEvent(t, `<link-down xmlns="urn:test"><if>eth2</if></link-down>`)}
+					if err := ports.Publish(ctx, n); err != nil {
+						t.Fatal(err)
+					}
+				}
+				m := c.read()
+				if got := m.Event.XMLName.Local + " " + m.Event.If; got != want {
+					t.Errorf("notification %d = %q, want %q", i, got, want)
+				}
+			}
+		})
+	}
+	if got := ports.Log().(*MemoryLog).Len(); got != 2 {
+		t.Errorf("Len() = %d, want 2", got)
+	}
+}
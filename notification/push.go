@@ -0,0 +1,539 @@
+package notification
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	xml "github.com/andaru/flexml"
+	"github.com/andaru/opr8/datastore"
+	"github.com/andaru/opr8/dom"
+	"github.com/andaru/opr8/rpc"
+	"github.com/andaru/opr8/session"
+	"github.com/andaru/opr8/session/netconf"
+)
+
+// YANG-Push namespaces.
+const (
+	// SubscribedNamespace is the namespace of the subscription
+	// operations of ietf-subscribed-notifications (RFC 8639).
+	SubscribedNamespace = "urn:ietf:params:xml:ns:yang:ietf-subscribed-notifications"
+	// PushNamespace is the namespace of ietf-yang-push (RFC 8641): the
+	// datastore subscription parameters and the push-update and
+	// push-change-update notifications.
+	PushNamespace = "urn:ietf:params:xml:ns:yang:ietf-yang-push"
+)
+
+// Push has YANG-Push (RFC 8641) subscriptions to the datastores of a
+// Set, sending the subscribed data periodically or when it changes.
+// It is safe for concurrent use.
+type Push struct {
+	set  *datastore.Set
+	mgr  session.Manager
+	auth rpc.Authorizer
+
+	mu     sync.Mutex
+	nextID uint32
+	subs   map[uint32]*pushSubscription
+	// listening are the datastores whose commits are listened to
+	listening map[*datastore.Datastore]bool
+}
+
+// PushOption is a constructor option for Push.
+type PushOption func(*Push)
+
+// WithPushAuthorizer is a Push option setting the access control of
+// the data sent to subscribers: the data their sessions' users may not
+// read is removed from each update, before it is compared with the
+// data sent before.
+func WithPushAuthorizer(a rpc.Authorizer) PushOption {
+	return func(p *Push) { p.auth = a }
+}
+
+// NewPush returns a new Push of the datastores of set, ending
+// subscriptions when their sessions, managed by mgr, end.
+func NewPush(set *datastore.Set, mgr session.Manager, options ...PushOption) *Push {
+	p := &Push{
+		set:       set,
+		mgr:       mgr,
+		subs:      map[uint32]*pushSubscription{},
+		listening: map[*datastore.Datastore]bool{},
+	}
+	for _, option := range options {
+		option(p)
+	}
+	return p
+}
+
+// Register registers the establish-subscription, modify-subscription
+// and delete-subscription handlers with d.
+func (p *Push) Register(d *rpc.Dispatcher) {
+	d.HandleFunc(xml.Name{Space: SubscribedNamespace, Local: "establish-subscription"}, p.establish)
+	d.HandleFunc(xml.Name{Space: SubscribedNamespace, Local: "modify-subscription"}, p.modify)
+	d.HandleFunc(xml.Name{Space: SubscribedNamespace, Local: "delete-subscription"}, p.delete)
+}
+
+// Subscriptions returns the number of subscriptions.
+func (p *Push) Subscriptions() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.subs)
+}
+
+// pushParams are the update policy and filter of a subscription.
+type pushParams struct {
+	// filter is the subtree filter selecting the data, or nil
+	filter dom.Node
+	// period and anchor are those of periodic subscriptions; period
+	// is zero for on-change subscriptions
+	period time.Duration
+	anchor time.Time
+	// dampening is the minimum time between push-change-update
+	// notifications of on-change subscriptions
+	dampening   time.Duration
+	syncOnStart bool
+}
+
+// pushSubscription is a session's subscription to a datastore.
+type pushSubscription struct {
+	p    *Push
+	id   uint32
+	sid  session.ID
+	user string
+	s    notifier
+	ds   *datastore.Datastore
+
+	mu     sync.Mutex
+	params pushParams
+	// patches counts the push-change-updates sent, numbering them
+	patches uint64
+
+	// changed is signalled when the datastore changes, and modified
+	// when the parameters do
+	changed, modified chan struct{}
+	done              chan struct{}
+	once              sync.Once
+}
+
+func (p *Push) establish(ctx context.Context, s *netconf.Session, op dom.Node) ([]dom.Node, error) {
+	if op.ChildByName(xml.Name{Space: SubscribedNamespace, Local: "stream"}) != nil {
+		return nil, rpc.NewError(rpc.ErrorTypeApplication, rpc.ErrorTagOperationNotSupported, "event stream subscriptions are not supported")
+	}
+	dsParam := pushParam(op, "datastore")
+	if dsParam == nil {
+		e := rpc.NewError(rpc.ErrorTypeApplication, rpc.ErrorTagMissingElement, "a datastore is required")
+		e.Info = badElement("datastore")
+		return nil, e
+	}
+	// the datastore is an identity, such as ds:running
+	name := strings.TrimSpace(dsParam.ChildValue())
+	if i := strings.LastIndexByte(name, ':'); i >= 0 {
+		name = name[i+1:]
+	}
+	ds := p.set.Get(name)
+	if ds == nil {
+		e := rpc.NewError(rpc.ErrorTypeApplication, rpc.ErrorTagInvalidValue, "unknown datastore %s", name)
+		e.Info = badElement("datastore")
+		return nil, e
+	}
+	params := pushParams{syncOnStart: true}
+	if err := params.update(op, true); err != nil {
+		return nil, err
+	}
+	if params.period == 0 && ds.Modules() == nil {
+		e := rpc.NewError(rpc.ErrorTypeApplication, rpc.ErrorTagOperationFailed, "datastore %s has no schema for on-change updates", name)
+		e.AppTag = "ietf-yang-push:on-change-unsupported"
+		return nil, e
+	}
+
+	sub := &pushSubscription{
+		p:        p,
+		sid:      s.ID(),
+		user:     s.Username(),
+		s:        s,
+		ds:       ds,
+		params:   params,
+		changed:  make(chan struct{}, 1),
+		modified: make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	p.add(sub)
+	if err := p.mgr.OnRelease(s.ID(), sub.cancel); err != nil {
+		sub.cancel()
+		return nil, err
+	}
+	// updates follow the reply with the subscription's id
+	s.AfterReply(func() { go sub.run() })
+	id := dom.CreateElement(xml.StartElement{Name: xml.Name{Space: SubscribedNamespace, Local: "id"}})
+	_ = id.AppendChild(dom.CreateText(xml.CharData(strconv.FormatUint(uint64(sub.id), 10))))
+	return []dom.Node{id}, nil
+}
+
+func (p *Push) modify(ctx context.Context, s *netconf.Session, op dom.Node) ([]dom.Node, error) {
+	sub, err := p.subscription(s.ID(), op)
+	if err != nil {
+		return nil, err
+	}
+	sub.mu.Lock()
+	params := sub.params
+	err = params.update(op, false)
+	if err == nil {
+		sub.params = params
+	}
+	sub.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case sub.modified <- struct{}{}:
+	default:
+	}
+	return nil, nil
+}
+
+func (p *Push) delete(ctx context.Context, s *netconf.Session, op dom.Node) ([]dom.Node, error) {
+	sub, err := p.subscription(s.ID(), op)
+	if err != nil {
+		return nil, err
+	}
+	sub.cancel()
+	return nil, nil
+}
+
+// subscription returns the subscription with the <id> of op, which
+// must belong to the session sid.
+func (p *Push) subscription(sid session.ID, op dom.Node) (*pushSubscription, error) {
+	var sub *pushSubscription
+	if n := op.ChildByName(xml.Name{Space: SubscribedNamespace, Local: "id"}); n != nil {
+		if id, err := strconv.ParseUint(strings.TrimSpace(n.ChildValue()), 10, 32); err == nil {
+			p.mu.Lock()
+			sub = p.subs[uint32(id)]
+			p.mu.Unlock()
+		}
+	}
+	if sub == nil || sub.sid != sid {
+		e := rpc.NewError(rpc.ErrorTypeApplication, rpc.ErrorTagInvalidValue, "no such subscription")
+		e.AppTag = "ietf-subscribed-notifications:no-such-subscription"
+		e.Info = badElement("id")
+		return nil, e
+	}
+	return sub, nil
+}
+
+// add assigns the subscription its ID and adds it, listening to
+// commits of its datastore.
+func (p *Push) add(sub *pushSubscription) {
+	p.mu.Lock()
+	p.nextID++
+	sub.id = p.nextID
+	p.subs[sub.id] = sub
+	listen := !p.listening[sub.ds]
+	p.listening[sub.ds] = true
+	p.mu.Unlock()
+	// listeners are called with the datastore's writer lock held, so
+	// p.mu is not held while adding one
+	if listen {
+		ds := sub.ds
+		ds.Listen(func(prev, next *datastore.Snapshot) { p.changed(ds) })
+	}
+}
+
+// changed signals the subscriptions to ds that it has changed.
+func (p *Push) changed(ds *datastore.Datastore) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, sub := range p.subs {
+		if sub.ds == ds {
+			select {
+			case sub.changed <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// update sets the parameters given by the establish-subscription or
+// modify-subscription operation op. The update policy, periodic or
+// on-change, is required when establishing and cannot be modified.
+func (pp *pushParams) update(op dom.Node, establish bool) error {
+	if f := pushParam(op, "datastore-subtree-filter"); f != nil {
+		pp.filter = dom.CloneNode(f, true)
+	} else if pushParam(op, "datastore-xpath-filter") != nil {
+		return rpc.NewError(rpc.ErrorTypeApplication, rpc.ErrorTagOperationNotSupported, "xpath filters are not supported")
+	}
+	periodic, onChange := pushParam(op, "periodic"), pushParam(op, "on-change")
+	switch {
+	case periodic != nil && onChange != nil:
+		e := rpc.NewError(rpc.ErrorTypeApplication, rpc.ErrorTagBadElement, "periodic and on-change are exclusive")
+		e.Info = badElement("on-change")
+		return e
+	case establish && periodic == nil && onChange == nil:
+		e := rpc.NewError(rpc.ErrorTypeApplication, rpc.ErrorTagMissingElement, "an update trigger, periodic or on-change, is required")
+		e.Info = badElement("periodic")
+		return e
+	case !establish && (periodic != nil && pp.period == 0 || onChange != nil && pp.period != 0):
+		e := rpc.NewError(rpc.ErrorTypeApplication, rpc.ErrorTagInvalidValue, "the update trigger cannot be modified")
+		e.Info = badElement("update-trigger")
+		return e
+	}
+	if periodic != nil {
+		period, err := centiseconds(periodic, "period")
+		if err != nil {
+			return err
+		}
+		if period > 0 {
+			pp.period = period
+		} else if establish || pushParam(periodic, "period") != nil {
+			e := rpc.NewError(rpc.ErrorTypeApplication, rpc.ErrorTagInvalidValue, "period must be positive")
+			e.AppTag = "ietf-yang-push:period-unsupported"
+			e.Info = badElement("period")
+			return e
+		}
+		if p := pushParam(periodic, "anchor-time"); p != nil {
+			anchor, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(p.ChildValue()))
+			if err != nil {
+				e := rpc.NewError(rpc.ErrorTypeApplication, rpc.ErrorTagInvalidValue, "invalid anchor-time: %v", err)
+				e.Info = badElement("anchor-time")
+				return e
+			}
+			pp.anchor = anchor
+		}
+	}
+	if onChange != nil {
+		dampening, err := centiseconds(onChange, "dampening-period")
+		if err != nil {
+			return err
+		}
+		pp.dampening = dampening
+		if p := pushParam(onChange, "sync-on-start"); p != nil {
+			pp.syncOnStart = strings.TrimSpace(p.ChildValue()) == "true"
+		}
+	}
+	return nil
+}
+
+// next returns the time of the periodic update following t: a whole
+// number of periods from the anchor time, or from start if there is
+// none.
+func (pp *pushParams) next(start, t time.Time) time.Time {
+	anchor := pp.anchor
+	if anchor.IsZero() {
+		anchor = start
+	}
+	if t.Before(anchor) {
+		return anchor
+	}
+	return anchor.Add((t.Sub(anchor)/pp.period + 1) * pp.period)
+}
+
+// run sends the subscription's updates until it ends.
+func (sub *pushSubscription) run() {
+	start := time.Now()
+	var (
+		tick, damp *time.Timer
+		// last is the data last sent by an on-change subscription,
+		// and quiet the time before which no changes are sent
+		last  dom.Document
+		quiet time.Time
+	)
+	stop := func(t *time.Timer) *time.Timer {
+		if t != nil {
+			t.Stop()
+		}
+		return nil
+	}
+	timerC := func(t *time.Timer) <-chan time.Time {
+		if t == nil {
+			return nil
+		}
+		return t.C
+	}
+	// reset (re)starts the subscription with its current parameters
+	reset := func() bool {
+		tick, damp = stop(tick), stop(damp)
+		params := sub.parameters()
+		if params.period > 0 {
+			tick = time.NewTimer(time.Until(params.next(start, time.Now())))
+			return true
+		}
+		last = sub.contents(params)
+		if params.syncOnStart {
+			return sub.send(sub.update(last)) == nil
+		}
+		return true
+	}
+	defer func() { stop(tick); stop(damp) }()
+
+	ok := reset()
+	for ok {
+		select {
+		case <-timerC(tick):
+			params := sub.parameters()
+			ok = sub.send(sub.update(sub.contents(params))) == nil
+			tick = time.NewTimer(time.Until(params.next(start, time.Now())))
+		case <-sub.changed:
+			if sub.parameters().period > 0 || damp != nil {
+				continue
+			}
+			if wait := time.Until(quiet); wait > 0 {
+				damp = time.NewTimer(wait)
+				continue
+			}
+			last, quiet, ok = sub.sendChanges(last)
+		case <-timerC(damp):
+			damp = nil
+			last, quiet, ok = sub.sendChanges(last)
+		case <-sub.modified:
+			ok = reset()
+		case <-sub.done:
+			return
+		}
+	}
+	sub.cancel()
+}
+
+// sendChanges sends a push-change-update of the changes to the data
+// since last, if any, returning the data sent and the end of the
+// dampening period it starts.
+func (sub *pushSubscription) sendChanges(last dom.Document) (dom.Document, time.Time, bool) {
+	params := sub.parameters()
+	next := sub.contents(params)
+	edits := datastore.Diff(last, next, sub.ds.Modules())
+	if len(edits) == 0 {
+		return last, time.Time{}, true
+	}
+	sub.patches++
+	if err := sub.send(sub.changeUpdate(edits)); err != nil {
+		return next, time.Time{}, false
+	}
+	return next, time.Now().Add(params.dampening), true
+}
+
+// parameters returns the subscription's current parameters.
+func (sub *pushSubscription) parameters() pushParams {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	return sub.params
+}
+
+// contents returns a copy of the datastore's data selected by the
+// filter, which the subscription's user may read.
+func (sub *pushSubscription) contents(params pushParams) dom.Document {
+	root := sub.ds.Snapshot().Root
+	var data dom.Document
+	if params.filter != nil {
+		data = rpc.SubtreeFilter(root, params.filter)
+	} else {
+		data = dom.CloneNode(root, true).(dom.Document)
+	}
+	if sub.p.auth != nil {
+		sub.p.auth.FilterRead(sub.user, data)
+	}
+	return data
+}
+
+// update returns the push-update notification event of the data.
+func (sub *pushSubscription) update(data dom.Document) dom.Element {
+	e := sub.event("push-update")
+	contents := pushElement(e, "datastore-contents", "")
+	for _, n := range dataChildren(data) {
+		_ = contents.AppendChild(dom.CloneNode(n, true))
+	}
+	return e
+}
+
+// changeUpdate returns the push-change-update notification event of the
+// edits, as a YANG Patch.
+func (sub *pushSubscription) changeUpdate(edits []datastore.Edit) dom.Element {
+	c := sub.ds.Modules()
+	prefix := func(ns string) string {
+		if m, err := c.ModuleByNamespace(ns); err == nil {
+			return m.Name
+		}
+		return ns
+	}
+	e := sub.event("push-change-update")
+	patch := pushElement(pushElement(e, "datastore-changes", ""), "yang-patch", "")
+	pushElement(patch, "patch-id", strconv.FormatUint(sub.patches, 10))
+	for i, edit := range edits {
+		ye := pushElement(patch, "edit", "")
+		pushElement(ye, "edit-id", strconv.Itoa(i+1))
+		pushElement(ye, "operation", edit.Operation.String())
+		pushElement(ye, "target", edit.Path.Format(prefix))
+		if len(edit.Nodes) > 0 {
+			value := pushElement(ye, "value", "")
+			for _, n := range edit.Nodes {
+				_ = value.AppendChild(dom.CloneNode(n, true))
+			}
+		}
+	}
+	return e
+}
+
+// event returns the notification event element named local, with the
+// subscription's id.
+func (sub *pushSubscription) event(local string) dom.Element {
+	e := dom.CreateElement(xml.StartElement{Name: xml.Name{Space: PushNamespace, Local: local}})
+	pushElement(e, "id", strconv.FormatUint(uint64(sub.id), 10))
+	return e
+}
+
+// send sends the notification of the event element.
+func (sub *pushSubscription) send(event dom.Element) error {
+	return sub.s.Notify(New(event).Element())
+}
+
+// cancel ends the subscription.
+func (sub *pushSubscription) cancel() {
+	sub.once.Do(func() {
+		close(sub.done)
+		sub.p.mu.Lock()
+		delete(sub.p.subs, sub.id)
+		sub.p.mu.Unlock()
+	})
+}
+
+// centiseconds returns the duration of the parameter local of n, in
+// centiseconds, or zero if n has none.
+func centiseconds(n dom.Node, local string) (time.Duration, error) {
+	p := pushParam(n, local)
+	if p == nil {
+		return 0, nil
+	}
+	v, err := strconv.ParseUint(strings.TrimSpace(p.ChildValue()), 10, 32)
+	if err != nil {
+		e := rpc.NewError(rpc.ErrorTypeApplication, rpc.ErrorTagInvalidValue, "invalid %s: %v", local, err)
+		e.Info = badElement(local)
+		return 0, e
+	}
+	return time.Duration(v) * 10 * time.Millisecond, nil
+}
+
+// pushParam returns the YANG-Push parameter local of n, or nil.
+func pushParam(n dom.Node, local string) dom.Node {
+	return n.ChildByName(xml.Name{Space: PushNamespace, Local: local})
+}
+
+// pushElement appends a YANG-Push element named local to parent, with
+// the text value, if not empty, and returns it.
+func pushElement(parent dom.Node, local, value string) dom.Node {
+	e := dom.CreateElement(xml.StartElement{Name: xml.Name{Space: PushNamespace, Local: local}})
+	if value != "" {
+		_ = e.AppendChild(dom.CreateText(xml.CharData(value)))
+	}
+	_ = parent.AppendChild(e)
+	return parent.LastChild()
+}
+
+// dataChildren returns the element children of n.
+func dataChildren(n dom.Node) []dom.Node {
+	var children []dom.Node
+	for it := n.FirstChild(); it != nil; it = it.NextSibling() {
+		if it.NodeType() == dom.NodeTypeElement {
+			children = append(children, it)
+		}
+	}
+	return children
+}
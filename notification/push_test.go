@@ -0,0 +1,262 @@
+package notification
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	xml "github.com/andaru/flexml"
+	"github.com/andaru/opr8/datastore"
+	"github.com/andaru/opr8/dom"
+	"github.com/andaru/opr8/modules"
+	"github.com/andaru/opr8/nacm"
+	"github.com/andaru/opr8/rpc"
+	"github.com/andaru/opr8/session"
+	"github.com/andaru/opr8/session/netconf"
+	"github.com/andaru/opr8/transport/transporttest"
+)
+
+const testPushModule = `module push-test {
+  namespace "urn:push-test"; prefix pt;
+  container system {
+    leaf host-name { type string; }
+    list user { key name; leaf name { type string; } }
+  }
+}`
+
+// pushMessage is an <rpc-reply> or a YANG-Push <notification>.
+type pushMessage struct {
+	XMLName xml.Name
+	ID      string    `xml:"id"`
+	OK      *struct{} `xml:"ok"`
+	Tag     string    `xml:"rpc-error>error-tag"`
+	AppTag  string    `xml:"rpc-error>error-app-tag"`
+	Update  *struct {
+		ID     string `xml:"id"`
+		System struct {
+			HostName string   `xml:"host-name"`
+			Users    []string `xml:"user>name"`
+		} `xml:"datastore-contents>system"`
+		NACM *struct{} `xml:"datastore-contents>nacm"`
+	} `xml:"push-update"`
+	Change *struct {
+		ID    string `xml:"id"`
+		Edits []struct {
+			Operation string `xml:"operation"`
+			Target    string `xml:"target"`
+		} `xml:"datastore-changes>yang-patch>edit"`
+	} `xml:"push-change-update"`
+}
+
+func (c *testClient) readPush() pushMessage {
+	c.t.Helper()
+	var m pushMessage
+	if err := c.d.Decode(&m); err != nil {
+		c.t.Fatal(err)
+	}
+	return m
+}
+
+// call sends the subscription operation local, with the parameters,
+// and returns the reply, skipping any notifications.
+func (c *testClient) call(local, params string) pushMessage {
+	c.t.Helper()
+	c.id++
+	c.write(fmt.Sprintf(`<rpc xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="%d"><%s xmlns="%s">%s</%s></rpc>`,
+		c.id, local, SubscribedNamespace, params, local))
+	for {
+		if m := c.readPush(); m.XMLName.Local == "rpc-reply" {
+			return m
+		}
+	}
+}
+
+// edits returns the operations and targets of a push-change-update.
+func (m pushMessage) edits() []string {
+	var edits []string
+	if m.Change != nil {
+		for _, e := range m.Change.Edits {
+			edits = append(edits, e.Operation+" "+e.Target)
+		}
+	}
+	return edits
+}
+
+func TestPush(t *testing.T) {
+	c := modules.NewCollection()
+	if err := c.ReadString("push-test", testPushModule); err != nil {
+		t.Fatal(err)
+	}
+	if errs := c.Process(); errs != nil {
+		t.Fatal(errs)
+	}
+	running := datastore.New(datastore.Running, c)
+	set := func(edit func(system dom.Node)) {
+		t.Helper()
+		_, err := running.Update(0, "", func(root dom.Document) error {
+			system := root.FirstChild()
+			if system == nil {
+				_ = root.AppendChild(dom.CreateElement(xml.StartElement{Name: xml.Name{Space: "urn:push-test", Local: "system"}}))
+				system = root.FirstChild()
+			}
+			edit(system)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	leaf := func(parent dom.Node, local, value string) {
+		e := dom.CreateElement(xml.StartElement{Name: xml.Name{Space: "urn:push-test", Local: local}})
+		_ = e.AppendChild(dom.CreateText(xml.CharData(value)))
+		_ = parent.AppendChild(e)
+	}
+	user := func(name string) func(dom.Node) {
+		return func(system dom.Node) {
+			u := dom.CreateElement(xml.StartElement{Name: xml.Name{Space: "urn:push-test", Local: "user"}})
+			leaf(u, "name", name)
+			_ = system.AppendChild(u)
+		}
+	}
+	set(func(system dom.Node) { leaf(system, "host-name", "a") })
+
+	d := rpc.NewDispatcher()
+	mgr := session.NewManager(session.WithAcceptor(netconf.NewAcceptor(nil, d)))
+	p := NewPush(datastore.NewSet(running), mgr)
+	p.Register(d)
+	cl, id := newTestClient(t, mgr)
+
+	const ds = `<datastore xmlns="urn:ietf:params:xml:ns:yang:ietf-yang-push" xmlns:ds="urn:ietf:params:xml:ns:yang:ietf-datastores">ds:%s</datastore>`
+	const yp = `<%s xmlns="urn:ietf:params:xml:ns:yang:ietf-yang-push">%s</%[1]s>`
+	for _, tt := range []struct {
+		name, op, params string
+		wantTag, wantApp string
+	}{
+		{"no datastore", "establish-subscription", fmt.Sprintf(yp, "on-change", ""), "missing-element", ""},
+		{"unknown datastore", "establish-subscription", fmt.Sprintf(ds, "startup") + fmt.Sprintf(yp, "on-change", ""), "invalid-value", ""},
+		{"no trigger", "establish-subscription", fmt.Sprintf(ds, "running"), "missing-element", ""},
+		{"zero period", "establish-subscription", fmt.Sprintf(ds, "running") + fmt.Sprintf(yp, "periodic", "<period>0</period>"),
+			"invalid-value", "ietf-yang-push:period-unsupported"},
+		{"xpath filter", "establish-subscription", fmt.Sprintf(ds, "running") + fmt.Sprintf(yp, "datastore-xpath-filter", "/system") +
+			fmt.Sprintf(yp, "on-change", ""), "operation-not-supported", ""},
+		{"modify unknown", "modify-subscription", "<id>99</id>", "invalid-value", "ietf-subscribed-notifications:no-such-subscription"},
+		{"delete unknown", "delete-subscription", "<id>99</id>", "invalid-value", "ietf-subscribed-notifications:no-such-subscription"},
+	} {
+		if m := cl.call(tt.op, tt.params); m.Tag != tt.wantTag || m.AppTag != tt.wantApp {
+			t.Errorf("%s: reply error = %q, %q, want %q, %q", tt.name, m.Tag, m.AppTag, tt.wantTag, tt.wantApp)
+		}
+	}
+
+	// on-change, with a 100ms dampening period
+	m := cl.call("establish-subscription", fmt.Sprintf(ds, "running")+fmt.Sprintf(yp, "on-change", "<dampening-period>10</dampening-period>"))
+	if m.ID != "1" {
+		t.Fatalf("establish-subscription reply = %+v, want id 1", m)
+	}
+	if m = cl.readPush(); m.Update == nil || m.Update.ID != "1" || m.Update.System.HostName != "a" {
+		t.Errorf("sync-on-start = %+v, want push-update of host-name a", m)
+	}
+	set(func(system dom.Node) { _ = system.FirstChild().FirstChild().SetValue("b") })
+	if got, want := cl.readPush().edits(), []string{"replace /push-test:system/host-name"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("push-change-update edits = %q, want %q", got, want)
+	}
+	// both changes are made within the dampening period, and sent
+	// together at its end
+	set(user("x"))
+	set(user("y"))
+	want := []string{"create /push-test:system/user[name='x']", "create /push-test:system/user[name='y']"}
+	if got := cl.readPush().edits(); !reflect.DeepEqual(got, want) {
+		t.Errorf("dampened push-change-update edits = %q, want %q", got, want)
+	}
+	if m := cl.call("modify-subscription", "<id>1</id>"+fmt.Sprintf(yp, "periodic", "<period>1</period>")); m.Tag != "invalid-value" {
+		t.Errorf("modify-subscription to periodic error = %q, want invalid-value", m.Tag)
+	}
+	if m := cl.call("delete-subscription", "<id>1</id>"); m.OK == nil {
+		t.Errorf("delete-subscription reply = %+v, want ok", m)
+	}
+	if got := p.Subscriptions(); got != 0 {
+		t.Errorf("Subscriptions() after delete = %d, want 0", got)
+	}
+
+	// periodic, every 20ms, of the host-name only
+	m = cl.call("establish-subscription", fmt.Sprintf(ds, "running")+
+		fmt.Sprintf(yp, "datastore-subtree-filter", `<system xmlns="urn:push-test"><host-name/></system>`)+
+		fmt.Sprintf(yp, "periodic", "<period>2</period>"))
+	if m.ID != "2" {
+		t.Fatalf("establish-subscription reply = %+v, want id 2", m)
+	}
+	for i := 0; i < 2; i++ {
+		if m = cl.readPush(); m.Update == nil || m.Update.System.HostName != "b" || len(m.Update.System.Users) != 0 {
+			t.Errorf("periodic update %d = %+v, want push-update of host-name b", i, m)
+		}
+	}
+	if m := cl.call("modify-subscription", "<id>2</id>"+fmt.Sprintf(yp, "periodic", "<period>1</period>")); m.OK == nil {
+		t.Errorf("modify-subscription reply = %+v, want ok", m)
+	}
+
+	if err := mgr.Terminate(id, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := p.Subscriptions(); got != 0 {
+		t.Errorf("Subscriptions() after session end = %d, want 0", got)
+	}
+}
+
+func TestPush_authorizer(t *testing.T) {
+	c := modules.NewCollection()
+	if err := c.ReadString("push-test", testPushModule); err != nil {
+		t.Fatal(err)
+	}
+	if errs := c.Process(); errs != nil {
+		t.Fatal(errs)
+	}
+	running := datastore.New(datastore.Running, c)
+	set := func(data string) {
+		t.Helper()
+		_, err := running.Update(0, "", func(root dom.Document) error {
+			for it := root.FirstChild(); it != nil; it = root.FirstChild() {
+				_ = root.RemoveChild(it)
+			}
+			for _, s := range []string{data, `<nacm xmlns="urn:ietf:params:xml:ns:yang:ietf-netconf-acm">
+  <groups><group><name>ops</name><user-name>bob</user-name></group></groups>
+  <rule-list>
+    <name>ops</name><group>ops</group>
+    <rule>
+      <name>users</name><path>/push-test:system/user</path>
+      <access-operations>read</access-operations><action>deny</action>
+    </rule>
+  </rule-list>
+</nacm>`} {
+				if err := root.AppendChild(dom.CloneNode(testEvent(t, s), true)); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	set(`<system xmlns="urn:push-test"><host-name>a</host-name><user><name>x</name></user></system>`)
+
+	d := rpc.NewDispatcher()
+	mgr := session.NewManager(session.WithAcceptor(netconf.NewAcceptor(nil, d)))
+	p := NewPush(datastore.NewSet(running), mgr, WithPushAuthorizer(nacm.New(running)))
+	p.Register(d)
+	cl, _ := newTestClient(t, mgr, transporttest.WithUsername("bob"))
+
+	const establish = `<datastore xmlns="urn:ietf:params:xml:ns:yang:ietf-yang-push" xmlns:ds="urn:ietf:params:xml:ns:yang:ietf-datastores">ds:running</datastore>` +
+		`<on-change xmlns="urn:ietf:params:xml:ns:yang:ietf-yang-push"/>`
+	if m := cl.call("establish-subscription", establish); m.ID != "1" {
+		t.Fatalf("establish-subscription reply = %+v, want id 1", m)
+	}
+	m := cl.readPush()
+	if m.Update == nil || m.Update.System.HostName != "a" || len(m.Update.System.Users) != 0 || m.Update.NACM != nil {
+		t.Errorf("sync-on-start = %+v, want push-update of host-name a alone", m)
+	}
+	// the users added are not read, so only the host-name changes
+	set(`<system xmlns="urn:push-test"><host-name>a</host-name><user><name>x</name></user><user><name>y</name></user></system>`)
+	set(`<system xmlns="urn:push-test"><host-name>b</host-name><user><name>x</name></user><user><name>y</name></user></system>`)
+	if got, want := cl.readPush().edits(), []string{"replace /push-test:system/host-name"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("push-change-update edits = %q, want %q", got, want)
+	}
+}
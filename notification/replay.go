@@ -0,0 +1,90 @@
+package notification
+
+import (
+	"sync"
+	"time"
+)
+
+// EventLog is the log of the notifications published on a stream,
+// replayed to subscriptions with a startTime (RFC 5277 section 3.3).
+// MemoryLog is a bounded in-memory log; logs persisted to storage,
+// surviving restarts of the server, implement the interface too. Its
+// methods are called with the Broker's lock held, so must not call the
+// Broker.
+type EventLog interface {
+	// Append adds the notification n to the log.
+	Append(n *Notification) error
+	// Replay calls f with the notifications of the log whose event
+	// time is not before start nor, if stop is not zero, after stop,
+	// in the order they were appended, until f returns false.
+	Replay(start, stop time.Time, f func(*Notification) bool) error
+	// Created returns the time the log was created, the earliest time
+	// notifications may be replayed from.
+	Created() time.Time
+}
+
+// MemoryLog is an EventLog keeping the most recent notifications
+// appended in memory, up to its size. It is safe for concurrent use.
+type MemoryLog struct {
+	created time.Time
+
+	mu sync.Mutex
+	// log is a ring of the notifications, the oldest at next once it
+	// is full
+	log  []*Notification
+	next int
+	full bool
+}
+
+// NewMemoryLog returns a new MemoryLog keeping up to size
+// notifications, which must be positive.
+func NewMemoryLog(size int) *MemoryLog {
+	return &MemoryLog{created: time.Now(), log: make([]*Notification, size)}
+}
+
+// Append adds the notification n to the log, discarding the oldest
+// notification if the log is full.
+func (l *MemoryLog) Append(n *Notification) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.log[l.next] = n
+	if l.next++; l.next == len(l.log) {
+		l.next, l.full = 0, true
+	}
+	return nil
+}
+
+// Replay calls f with the notifications of the log in the time range,
+// as EventLog requires.
+func (l *MemoryLog) Replay(start, stop time.Time, f func(*Notification) bool) error {
+	l.mu.Lock()
+	log := append([]*Notification(nil), l.log[:l.next]...)
+	if l.full {
+		log = append(append([]*Notification(nil), l.log[l.next:]...), log...)
+	}
+	l.mu.Unlock()
+	for _, n := range log {
+		if n.EventTime.Before(start) || !stop.IsZero() && n.EventTime.After(stop) {
+			continue
+		}
+		if !f(n) {
+			break
+		}
+	}
+	return nil
+}
+
+// Created returns the time the log was made.
+func (l *MemoryLog) Created() time.Time { return l.created }
+
+// Len returns the number of notifications in the log.
+func (l *MemoryLog) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.full {
+		return len(l.log)
+	}
+	return l.next
+}
+
+var _ EventLog = &MemoryLog{}
@@ -0,0 +1,279 @@
+package notification
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	xml "github.com/andaru/flexml"
+	"github.com/andaru/opr8/dom"
+	"github.com/andaru/opr8/rpc"
+	"github.com/andaru/opr8/session"
+	"github.com/andaru/opr8/session/netconf"
+)
+
+// notifier is the interface to the sessions notifications are
+// delivered to, implemented by *netconf.Session.
+type notifier interface {
+	Notify(dom.Element) error
+}
+
+// subscription is a session's subscription to a stream.
+type subscription struct {
+	b      *Broker
+	id     session.ID
+	user   string
+	s      notifier
+	stream *Stream
+	// filter is the subtree filter selecting notifications, or nil
+	filter dom.Node
+	// start is the time replay starts from, and stop the time the
+	// subscription ends, or the zero time
+	start, stop time.Time
+	// replay are the logged notifications delivered before those
+	// queued
+	replay []*Notification
+
+	queue chan *Notification
+	done  chan struct{}
+	once  sync.Once
+}
+
+// Register registers the create-subscription handler with d.
+func (b *Broker) Register(d *rpc.Dispatcher) {
+	d.HandleFunc(xml.Name{Space: Namespace, Local: "create-subscription"}, b.createSubscription)
+}
+
+func (b *Broker) createSubscription(ctx context.Context, s *netconf.Session, op dom.Node) ([]dom.Node, error) {
+	name := DefaultStream
+	if p := param(op, "stream"); p != nil {
+		name = strings.TrimSpace(p.ChildValue())
+	}
+	stream := b.Stream(name)
+	if stream == nil {
+		e := rpc.NewError(rpc.ErrorTypeApplication, rpc.ErrorTagInvalidValue, "unknown stream %s", name)
+		e.Info = badElement("stream")
+		return nil, e
+	}
+	filter := param(op, "filter")
+	if filter != nil {
+		if typ, ok := attrValue(filter, xml.Name{Local: "type"}); ok && typ != "subtree" {
+			return nil, rpc.NewError(rpc.ErrorTypeProtocol, rpc.ErrorTagOperationNotSupported, "filter type %s is not supported", typ)
+		}
+	}
+	start, err := timeParam(op, "startTime")
+	if err != nil {
+		return nil, err
+	}
+	stop, err := timeParam(op, "stopTime")
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case !stop.IsZero() && start.IsZero():
+		e := rpc.NewError(rpc.ErrorTypeProtocol, rpc.ErrorTagMissingElement, "stopTime requires startTime")
+		e.Info = badElement("startTime")
+		return nil, e
+	case !stop.IsZero() && stop.Before(start):
+		e := rpc.NewError(rpc.ErrorTypeProtocol, rpc.ErrorTagBadElement, "stopTime is before startTime")
+		e.Info = badElement("stopTime")
+		return nil, e
+	case start.After(time.Now()):
+		e := rpc.NewError(rpc.ErrorTypeProtocol, rpc.ErrorTagBadElement, "startTime is in the future")
+		e.Info = badElement("startTime")
+		return nil, e
+	case !start.IsZero() && stream.log == nil:
+		return nil, rpc.NewError(rpc.ErrorTypeApplication, rpc.ErrorTagOperationFailed, "stream %s does not support replay", name)
+	}
+
+	sub, err := b.subscribe(s.ID(), s.Username(), s, stream, filter, start, stop)
+	if err != nil {
+		return nil, err
+	}
+	if err := b.mgr.OnRelease(s.ID(), sub.cancel); err != nil {
+		sub.cancel()
+		return nil, err
+	}
+	// replayed notifications follow the reply
+	s.AfterReply(func() { go sub.deliver() })
+	return nil, nil
+}
+
+// subscribe adds the subscription of the session with the ID, of the
+// user, and notifier s, to the stream, until the stop time, if not zero. If the
+// start time is not zero, the notifications of the stream's log from
+// then are replayed first. Its notifications are queued until deliver
+// is called.
+func (b *Broker) subscribe(id session.ID, user string, s notifier, stream *Stream, filter dom.Node, start, stop time.Time) (*subscription, error) {
+	sub := &subscription{
+		b:      b,
+		id:     id,
+		user:   user,
+		s:      s,
+		stream: stream,
+		start:  start,
+		stop:   stop,
+		queue:  make(chan *Notification, b.queueSize),
+		done:   make(chan struct{}),
+	}
+	if filter != nil {
+		sub.filter = dom.CloneNode(filter, true)
+	}
+	b.mu.Lock()
+	if _, ok := b.subs[id]; ok {
+		b.mu.Unlock()
+		return nil, rpc.NewError(rpc.ErrorTypeProtocol, rpc.ErrorTagInUse, "session %d already has a subscription", id)
+	}
+	if !start.IsZero() && stream.log != nil {
+		// the log is read with the lock held, so the notifications
+		// published after it are those queued
+		err := stream.log.Replay(start, stop, func(n *Notification) bool {
+			if sub.selects(n) {
+				sub.replay = append(sub.replay, n)
+			}
+			return true
+		})
+		if err != nil {
+			b.mu.Unlock()
+			return nil, rpc.NewError(rpc.ErrorTypeApplication, rpc.ErrorTagOperationFailed, "replay stream %s: %v", stream.name, err)
+		}
+	}
+	b.subs[id] = sub
+	b.mu.Unlock()
+	return sub, nil
+}
+
+// deliver writes the replayed notifications, then a replayComplete
+// notification, and the queued notifications to the session until the
+// subscription ends, ending it once its stop time is reached, after a
+// notificationComplete notification, or if a write fails.
+func (sub *subscription) deliver() {
+	if !sub.start.IsZero() {
+		replay := append(sub.replay, netmodEvent("replayComplete"))
+		sub.replay = nil
+		for _, n := range replay {
+			if err := sub.s.Notify(n.Element()); err != nil {
+				sub.cancel()
+				return
+			}
+		}
+	}
+	var stopc <-chan time.Time
+	if !sub.stop.IsZero() {
+		t := time.NewTimer(time.Until(sub.stop))
+		defer t.Stop()
+		stopc = t.C
+	}
+	for {
+		select {
+		case n := <-sub.queue:
+			if !sub.stop.IsZero() && n.EventTime.After(sub.stop) {
+				continue
+			}
+			if err := sub.s.Notify(n.Element()); err != nil {
+				sub.cancel()
+				return
+			}
+		case <-stopc:
+			_ = sub.s.Notify(netmodEvent("notificationComplete").Element())
+			sub.cancel()
+			return
+		case <-sub.done:
+			return
+		}
+	}
+}
+
+// cancel ends the subscription.
+func (sub *subscription) cancel() {
+	sub.once.Do(func() {
+		close(sub.done)
+		sub.b.mu.Lock()
+		if sub.b.subs[sub.id] == sub {
+			delete(sub.b.subs, sub.id)
+		}
+		sub.b.mu.Unlock()
+	})
+}
+
+// selects returns true if the subscription's filter selects n, and
+// the subscription's user may receive it.
+func (sub *subscription) selects(n *Notification) bool {
+	if a := sub.b.auth; a != nil && n.Event != nil && a.AuthorizeNotification(sub.user, n.Event.Name()) != nil {
+		return false
+	}
+	if sub.filter == nil {
+		return true
+	}
+	if n.Event == nil {
+		return false
+	}
+	root := dom.NewDocument(nil)
+	_ = root.AppendChild(dom.CloneNode(n.Event, true))
+	return rpc.SubtreeFilter(root, sub.filter).FirstChild() != nil
+}
+
+// offer queues n without waiting, returning false if the queue is
+// full. Notifications offered after the subscription ends are
+// discarded.
+func (sub *subscription) offer(n *Notification) bool {
+	select {
+	case sub.queue <- n:
+	case <-sub.done:
+	default:
+		return false
+	}
+	return true
+}
+
+// wait queues n, waiting for room in the queue until the subscription
+// ends or the context is done.
+func (sub *subscription) wait(ctx context.Context, n *Notification) error {
+	select {
+	case sub.queue <- n:
+	case <-sub.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return nil
+}
+
+// timeParam returns the time of the create-subscription parameter
+// local of op, or the zero time if op has none.
+func timeParam(op dom.Node, local string) (time.Time, error) {
+	p := param(op, local)
+	if p == nil {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(p.ChildValue()))
+	if err != nil {
+		e := rpc.NewError(rpc.ErrorTypeProtocol, rpc.ErrorTagInvalidValue, "invalid %s: %v", local, err)
+		e.Info = badElement(local)
+		return time.Time{}, e
+	}
+	return t, nil
+}
+
+// param returns the create-subscription parameter local of op, or nil.
+func param(op dom.Node, local string) dom.Node {
+	return op.ChildByName(xml.Name{Space: Namespace, Local: local})
+}
+
+// attrValue returns the value of the attribute of n with the name, and
+// true if n has it.
+func attrValue(n dom.Node, name xml.Name) (string, bool) {
+	if ap, ok := n.(dom.AttributeProvider); ok {
+		for a := dom.Node(ap.FirstAttribute()); a != nil; a = a.NextSibling() {
+			if a.Name() == name {
+				return a.Value(), true
+			}
+		}
+	}
+	return "", false
+}
+
+// badElement returns the error-info of an error in the element.
+func badElement(name string) []rpc.ErrorInfo {
+	return []rpc.ErrorInfo{{Name: xml.Name{Local: "bad-element"}, Value: name}}
+}
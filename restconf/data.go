@@ -0,0 +1,373 @@
+package restconf
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/andaru/opr8/datastore"
+	"github.com/andaru/opr8/dom"
+	"github.com/andaru/opr8/rpc"
+	"github.com/openconfig/goyang/pkg/yang"
+)
+
+// data serves the data resource at the api-path path, relative to
+// {+restconf}/data.
+func (s *Server) data(w http.ResponseWriter, r *http.Request, path string) {
+	methods := []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+	if path == "" || path == "/" {
+		// the datastore resource is not replaced or deleted as a whole
+		methods = methods[:3]
+	}
+	if !allow(w, r, methods...) {
+		return
+	}
+	media, err := negotiate(r)
+	if err != nil {
+		writeError(w, r, media, err)
+		return
+	}
+	ds, err := s.running()
+	if err != nil {
+		writeError(w, r, media, err)
+		return
+	}
+	id, e, err := datastore.ParseAPIPath(path, ds.Modules())
+	if err != nil {
+		writeError(w, r, media, newError(http.StatusBadRequest, rpc.ErrorTagInvalidValue, "%v", err))
+		return
+	}
+	if e != nil && (e.IsList() || e.IsLeafList()) && len(id[len(id)-1].Keys) == 0 {
+		writeError(w, r, media, newError(http.StatusBadRequest, rpc.ErrorTagInvalidValue, "%s entries are addressed by key", e.Name))
+		return
+	}
+	q, err := parseQuery(r, ds.Modules())
+	if err != nil {
+		writeError(w, r, media, err)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		err = s.get(w, r, media, ds, id, q)
+	case http.MethodPost:
+		err = s.post(w, r, ds, id, e)
+	case http.MethodPut:
+		err = s.put(w, r, ds, id, e)
+	case http.MethodPatch:
+		err = s.patch(w, r, ds, id, e)
+	case http.MethodDelete:
+		err = s.delete(w, r, ds, id, e)
+	}
+	if err != nil {
+		writeError(w, r, media, err)
+	}
+}
+
+// get responds to a read of the data resource id, the datastore
+// resource if id is empty.
+func (s *Server) get(w http.ResponseWriter, r *http.Request, media string, ds *datastore.Datastore, id datastore.InstanceID, q *query) error {
+	_, user := s.user(r)
+	snap := ds.Snapshot()
+	root := s.readTree(ds, user, snap.Root)
+	datastore.ApplyDefaults(root, ds.Modules(), q.defaults)
+	target, err := resolve(root, id)
+	if err != nil {
+		return err
+	} else if target == nil {
+		return newError(http.StatusNotFound, rpc.ErrorTagInvalidValue, "no such data resource")
+	}
+
+	tag := entityTag(target)
+	setValidators(w, tag, snap.Time)
+	if notModified(r, tag, snap.Time) {
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+	q.apply(target)
+	nodes := []dom.Node{target}
+	if len(id) == 0 {
+		nodes = dataChildren(target)
+	}
+	body, err := encodeData(ds.Modules(), media, nodes, len(id) == 0)
+	if err != nil {
+		return err
+	}
+	writeBody(w, r, http.StatusOK, media, body)
+	return nil
+}
+
+// post creates the data resource of the request body, a child of the
+// data resource id, of schema node e, responding with its location.
+func (s *Server) post(w http.ResponseWriter, r *http.Request, ds *datastore.Datastore, id datastore.InstanceID, e *yang.Entry) error {
+	if e != nil && e.Kind != yang.DirectoryEntry {
+		return newError(http.StatusBadRequest, rpc.ErrorTagInvalidValue, "%s has no child data resources", e.Name)
+	}
+	if err := writable(ds, e); err != nil {
+		return err
+	}
+	n, err := decodeBody(r, ds.Modules(), id, e)
+	if err != nil {
+		return err
+	}
+	var ce *yang.Entry
+	if e == nil {
+		ce, err = ds.Modules().RootEntry(n.Name())
+	} else {
+		ce = ds.Modules().DataChild(e, n.Name().Local)
+	}
+	if err != nil || ce == nil {
+		return newError(http.StatusBadRequest, rpc.ErrorTagUnknownElement, "unknown data node %s", n.Name().Local)
+	}
+	step := datastore.StepOf(n, ce)
+	if ce.IsList() && len(step.Keys) != len(strings.Fields(ce.Key)) {
+		return newError(http.StatusBadRequest, rpc.ErrorTagMissingElement, "%s requires the keys %s", ce.Name, ce.Key)
+	}
+	child := append(id[:len(id):len(id)], step)
+
+	snap, err := s.update(r, ds, child, func(root dom.Document, target dom.Node) error {
+		return datastore.ApplyEdits(root, ds.Modules(), []datastore.Edit{{Operation: datastore.EditCreate, Path: child, Schema: ce, Nodes: []dom.Node{n}}})
+	})
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Location", s.root+"/data"+datastore.FormatAPIPath(child, ds.Modules()))
+	s.written(w, r, ds, snap, child, http.StatusCreated)
+	return nil
+}
+
+// put creates or replaces the data resource id, of schema node e, with
+// that of the request body.
+func (s *Server) put(w http.ResponseWriter, r *http.Request, ds *datastore.Datastore, id datastore.InstanceID, e *yang.Entry) error {
+	n, err := s.decodeTarget(r, ds, id, e)
+	if err != nil {
+		return err
+	}
+	created := false
+	snap, err := s.update(r, ds, id, func(root dom.Document, target dom.Node) error {
+		created = target == nil
+		return datastore.ApplyEdits(root, ds.Modules(), []datastore.Edit{{Operation: datastore.EditReplace, Path: id, Schema: e, Nodes: []dom.Node{n}}})
+	})
+	if err != nil {
+		return err
+	}
+	status := http.StatusNoContent
+	if created {
+		status = http.StatusCreated
+	}
+	s.written(w, r, ds, snap, id, status)
+	return nil
+}
+
+// patch merges the data resource of the request body into the data
+// resource id, of schema node e, which must exist.
+func (s *Server) patch(w http.ResponseWriter, r *http.Request, ds *datastore.Datastore, id datastore.InstanceID, e *yang.Entry) error {
+	if _, err := bodyType(r); err != nil {
+		// YANG Patch (RFC 8072) is not supported
+		return err
+	}
+	n, err := s.decodeTarget(r, ds, id, e)
+	if err != nil {
+		return err
+	}
+	snap, err := s.update(r, ds, id, func(root dom.Document, target dom.Node) error {
+		if target == nil {
+			return newError(http.StatusNotFound, rpc.ErrorTagInvalidValue, "no such data resource")
+		}
+		return datastore.ApplyEdits(root, ds.Modules(), []datastore.Edit{{Operation: datastore.EditMerge, Path: id, Schema: e, Nodes: []dom.Node{n}}})
+	})
+	if err != nil {
+		return err
+	}
+	s.written(w, r, ds, snap, id, http.StatusNoContent)
+	return nil
+}
+
+// delete deletes the data resource id, of schema node e, which must
+// exist.
+func (s *Server) delete(w http.ResponseWriter, r *http.Request, ds *datastore.Datastore, id datastore.InstanceID, e *yang.Entry) error {
+	if err := writable(ds, e); err != nil {
+		return err
+	}
+	snap, err := s.update(r, ds, id, func(root dom.Document, target dom.Node) error {
+		if target == nil {
+			return newError(http.StatusNotFound, rpc.ErrorTagInvalidValue, "no such data resource")
+		}
+		return datastore.ApplyEdits(root, ds.Modules(), []datastore.Edit{{Operation: datastore.EditDelete, Path: id, Schema: e}})
+	})
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Last-Modified", snap.Time.UTC().Format(http.TimeFormat))
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// decodeTarget returns the data node of the request body replacing or
+// merged with the data resource id, of schema node e, which must have
+// its name and keys.
+func (s *Server) decodeTarget(r *http.Request, ds *datastore.Datastore, id datastore.InstanceID, e *yang.Entry) (dom.Node, error) {
+	if err := writable(ds, e); err != nil {
+		return nil, err
+	}
+	n, err := decodeBody(r, ds.Modules(), id[:len(id)-1], parentEntry(e, len(id)))
+	if err != nil {
+		return nil, err
+	}
+	want, got := id[len(id)-1], datastore.StepOf(n, e)
+	if got.Name != want.Name || !sameKeys(got.Keys, want.Keys) {
+		return nil, newError(http.StatusBadRequest, rpc.ErrorTagInvalidValue, "the request body's data node is not the target resource %s", want.Name.Local)
+	}
+	return n, nil
+}
+
+// update commits the change made by edit to the running datastore ds,
+// if the request's preconditions are met and its user may make it.
+// The edit function is called with the data tree being changed and the
+// data node id of the data tree before, or nil if there is none.
+func (s *Server) update(r *http.Request, ds *datastore.Datastore, id datastore.InstanceID, edit func(root dom.Document, target dom.Node) error) (*datastore.Snapshot, error) {
+	sid, user := s.user(r)
+	return ds.Update(sid, "restconf "+r.Method+" "+r.URL.Path, func(root dom.Document) error {
+		// the snapshot is that being changed, as Update holds the
+		// writer lock
+		prev := ds.Snapshot()
+		target, err := resolve(prev.Root, id)
+		if err != nil {
+			return err
+		}
+		if err := s.preconditions(r, ds, user, prev, id); err != nil {
+			return err
+		}
+		if err := edit(root, target); err != nil {
+			return err
+		}
+		if s.authorizer != nil {
+			return s.authorizer.AuthorizeWrite(user, prev.Root, root)
+		}
+		return nil
+	})
+}
+
+// written responds to a write of the data resource id committed as the
+// snapshot snap with the status, and the resource's entity tag and last
+// modified time.
+func (s *Server) written(w http.ResponseWriter, r *http.Request, ds *datastore.Datastore, snap *datastore.Snapshot, id datastore.InstanceID, status int) {
+	_, user := s.user(r)
+	if target, err := resolve(s.readTree(ds, user, snap.Root), id); err == nil && target != nil {
+		setValidators(w, entityTag(target), snap.Time)
+	} else {
+		w.Header().Set("Last-Modified", snap.Time.UTC().Format(http.TimeFormat))
+	}
+	w.WriteHeader(status)
+}
+
+// preconditions returns an error with the status 412 Precondition
+// Failed if the conditions of the request r on the data resource id of
+// the snapshot prev, as read by the user, are not met.
+func (s *Server) preconditions(r *http.Request, ds *datastore.Datastore, user string, prev *datastore.Snapshot, id datastore.InstanceID) error {
+	failed := newError(http.StatusPreconditionFailed, rpc.ErrorTagOperationFailed, "precondition failed")
+	if since, err := http.ParseTime(r.Header.Get("If-Unmodified-Since")); err == nil && prev.Time.Truncate(time.Second).After(since) {
+		return failed
+	}
+	ifMatch, ifNoneMatch := r.Header.Get("If-Match"), r.Header.Get("If-None-Match")
+	if ifMatch == "" && ifNoneMatch == "" {
+		return nil
+	}
+	target, err := resolve(s.readTree(ds, user, prev.Root), id)
+	if err != nil {
+		return err
+	}
+	tag := ""
+	if target != nil {
+		tag = entityTag(target)
+	}
+	if ifMatch != "" && !matchTag(ifMatch, tag) || ifNoneMatch != "" && matchTag(ifNoneMatch, tag) {
+		return failed
+	}
+	return nil
+}
+
+// resolve returns the data node id of the data tree root, root itself
+// if id is empty, or nil if there is none.
+func resolve(root dom.Node, id datastore.InstanceID) (dom.Node, error) {
+	if len(id) == 0 {
+		return root, nil
+	}
+	n, _ := id.Resolve(root)
+	return n, nil
+}
+
+// writable returns an error if the datastore ds, or data nodes of the
+// schema node e, may not be written.
+func writable(ds *datastore.Datastore, e *yang.Entry) error {
+	if ds.ReadOnly() {
+		return newError(http.StatusMethodNotAllowed, rpc.ErrorTagOperationNotSupported, "datastore %s is read-only", ds.Name())
+	}
+	if e != nil && e.ReadOnly() {
+		return newError(http.StatusMethodNotAllowed, rpc.ErrorTagOperationNotSupported, "%s is not configuration", e.Name)
+	}
+	return nil
+}
+
+// parentEntry returns the schema node of the parent of the data nodes
+// of schema node e, at the depth of an api-path, or nil for top-level
+// nodes.
+func parentEntry(e *yang.Entry, depth int) *yang.Entry {
+	if depth <= 1 {
+		return nil
+	}
+	p := e.Parent
+	for p != nil && (p.IsChoice() || p.IsCase()) {
+		p = p.Parent
+	}
+	return p
+}
+
+// sameKeys returns true if the list keys or leaf-list values a and b
+// are equal.
+func sameKeys(a, b []datastore.InstanceIDKey) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Name.Local != b[i].Name.Local || a[i].Value != b[i].Value {
+			return false
+		}
+	}
+	return true
+}
+
+// entityTag returns the entity tag of the data node n.
+func entityTag(n dom.Node) string { return `"` + datastore.Hash(n) + `"` }
+
+// setValidators sets the ETag and Last-Modified response headers.
+func setValidators(w http.ResponseWriter, tag string, modified time.Time) {
+	w.Header().Set("ETag", tag)
+	w.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+}
+
+// notModified returns true if the conditions of the read request r are
+// not met by the resource with the entity tag, last modified at the
+// time.
+func notModified(r *http.Request, tag string, modified time.Time) bool {
+	if h := r.Header.Get("If-None-Match"); h != "" {
+		return matchTag(h, tag)
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	return err == nil && !modified.Truncate(time.Second).After(since)
+}
+
+// matchTag returns true if the If-Match or If-None-Match header value h
+// lists the entity tag, or is "*" and tag is not empty, as it is for
+// resources that exist. Weak tags match their strong equivalents.
+func matchTag(h, tag string) bool {
+	if tag == "" {
+		return false
+	}
+	for _, t := range strings.Split(h, ",") {
+		if t = strings.TrimSpace(t); t == "*" || strings.TrimPrefix(t, "W/") == tag {
+			return true
+		}
+	}
+	return false
+}
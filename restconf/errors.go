@@ -0,0 +1,112 @@
+package restconf
+
+import (
+	"encoding/json"
+	"net/http"
+
+	xml "github.com/andaru/flexml"
+	"github.com/andaru/opr8/rpc"
+	"github.com/pkg/errors"
+)
+
+// statusError is an error responded to with an HTTP status other than
+// that of its error-tag.
+type statusError struct {
+	status int
+	err    *rpc.RPCError
+}
+
+func newError(status int, tag rpc.ErrorTag, format string, args ...interface{}) error {
+	return &statusError{status: status, err: rpc.NewError(rpc.ErrorTypeProtocol, tag, format, args...)}
+}
+
+func (e *statusError) Error() string { return e.err.Error() }
+
+// Cause returns the error's rpc-error.
+func (e *statusError) Cause() error { return e.err }
+
+// statusOf returns the HTTP status of the error-tag (RFC 8040 section
+// 7).
+func statusOf(tag rpc.ErrorTag) int {
+	switch tag {
+	case rpc.ErrorTagInUse, rpc.ErrorTagLockDenied, rpc.ErrorTagResourceDenied,
+		rpc.ErrorTagDataExists, rpc.ErrorTagDataMissing:
+		return http.StatusConflict
+	case rpc.ErrorTagTooBig:
+		return http.StatusRequestEntityTooLarge
+	case rpc.ErrorTagAccessDenied:
+		return http.StatusForbidden
+	case rpc.ErrorTagOperationNotSupported:
+		return http.StatusNotImplemented
+	case rpc.ErrorTagRollbackFailed, rpc.ErrorTagOperationFailed:
+		return http.StatusInternalServerError
+	}
+	return http.StatusBadRequest
+}
+
+// restconfError is an error of an ietf-restconf errors document.
+type restconfError struct {
+	Type    rpc.ErrorType `json:"error-type" xml:"error-type"`
+	Tag     rpc.ErrorTag  `json:"error-tag" xml:"error-tag"`
+	AppTag  string        `json:"error-app-tag,omitempty" xml:"error-app-tag,omitempty"`
+	Path    string        `json:"error-path,omitempty" xml:"error-path,omitempty"`
+	Message string        `json:"error-message,omitempty" xml:"error-message,omitempty"`
+}
+
+// errorsDocument is the ietf-restconf errors document.
+type errorsDocument struct {
+	XMLName xml.Name        `json:"-" xml:"urn:ietf:params:xml:ns:yang:ietf-restconf errors"`
+	Errors  []restconfError `json:"error" xml:"error"`
+}
+
+// writeError responds to r with the errors document of err, encoded in
+// the media type, or YANG/JSON if it is empty. The status is that of
+// err, if it has one, or otherwise that of its first error-tag.
+func writeError(w http.ResponseWriter, r *http.Request, media string, err error) {
+	status := 0
+	var list rpc.ErrorList
+	var se *statusError
+	var re *rpc.RPCError
+	switch err = rpc.FromError(err); {
+	case errors.As(err, &se):
+		status, list = se.status, rpc.ErrorList{se.err}
+	case errors.As(err, &list):
+	case errors.As(err, &re):
+		list = rpc.ErrorList{re}
+	default:
+		list = rpc.ErrorList{rpc.NewError(rpc.ErrorTypeApplication, rpc.ErrorTagOperationFailed, "%v", err)}
+	}
+	if len(list) == 0 {
+		list = rpc.ErrorList{rpc.NewError(rpc.ErrorTypeApplication, rpc.ErrorTagOperationFailed, "unknown error")}
+	}
+	if status == 0 {
+		status = statusOf(list[0].Tag)
+	}
+
+	doc := errorsDocument{}
+	for _, e := range list {
+		doc.Errors = append(doc.Errors, restconfError{Type: e.Type, Tag: e.Tag, AppTag: e.AppTag, Path: e.Path, Message: e.Message})
+	}
+	var body []byte
+	if media == MediaTypeXML {
+		body, err = xml.Marshal(doc)
+	} else {
+		media = MediaTypeJSON
+		body, err = json.Marshal(map[string]errorsDocument{"ietf-restconf:errors": doc})
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeBody(w, r, status, media, body)
+}
+
+// writeBody responds to r with the status and the body of the media
+// type, which is omitted for HEAD requests.
+func writeBody(w http.ResponseWriter, r *http.Request, status int, media string, body []byte) {
+	w.Header().Set("Content-Type", media)
+	w.WriteHeader(status)
+	if r.Method != http.MethodHead {
+		_, _ = w.Write(body)
+	}
+}
@@ -0,0 +1,158 @@
+package restconf
+
+import (
+	"bytes"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	xml "github.com/andaru/flexml"
+	"github.com/andaru/opr8/datastore"
+	"github.com/andaru/opr8/dom"
+	"github.com/andaru/opr8/modules"
+	"github.com/andaru/opr8/rpc"
+	"github.com/openconfig/goyang/pkg/yang"
+)
+
+// Media types of YANG data.
+const (
+	MediaTypeXML  = "application/yang-data+xml"
+	MediaTypeJSON = "application/yang-data+json"
+)
+
+// negotiate returns the media type of the response to r most preferred
+// by its Accept header, YANG/JSON if it has none, or an error with the
+// status 406 Not Acceptable if neither YANG/XML nor YANG/JSON is
+// acceptable.
+func negotiate(r *http.Request) (string, error) {
+	accept := strings.Join(r.Header["Accept"], ",")
+	if strings.TrimSpace(accept) == "" {
+		return MediaTypeJSON, nil
+	}
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(accept, ",") {
+		mt, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if media := mediaType(mt, true); media != "" && q > bestQ {
+			best, bestQ = media, q
+		}
+	}
+	if best == "" {
+		return "", newError(http.StatusNotAcceptable, rpc.ErrorTagInvalidValue, "none of the media types accepted is supported")
+	}
+	return best, nil
+}
+
+// bodyType returns the media type of the body of r, or an error with
+// the status 415 Unsupported Media Type if it is not YANG data.
+func bodyType(r *http.Request) (string, error) {
+	mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if media := mediaType(mt, false); err == nil && media != "" {
+		return media, nil
+	}
+	return "", newError(http.StatusUnsupportedMediaType, rpc.ErrorTagInvalidValue, "unsupported media type %q", r.Header.Get("Content-Type"))
+}
+
+// mediaType returns the YANG data media type the media type mt, which
+// may be a wildcard if accepted is true, is, or the empty string.
+func mediaType(mt string, accepted bool) string {
+	switch mt {
+	case MediaTypeJSON, "application/json":
+		return MediaTypeJSON
+	case MediaTypeXML, "application/xml", "text/xml":
+		return MediaTypeXML
+	case "*/*", "application/*":
+		if accepted {
+			return MediaTypeJSON
+		}
+	}
+	return ""
+}
+
+// encodeData returns the encoding of the data nodes in the media type.
+// The nodes of the datastore resource, the children of the data tree's
+// root, are encoded in its <data> container, and other nodes as
+// themselves; several such nodes, such as leaf-list entries, may only
+// be encoded as YANG/JSON.
+func encodeData(c *modules.Collection, media string, nodes []dom.Node, datastoreResource bool) ([]byte, error) {
+	if media == MediaTypeJSON {
+		body := datastore.MarshalJSON(c, nodes)
+		if datastoreResource {
+			body = append(append([]byte(`{"ietf-restconf:data":`), body...), '}')
+		}
+		return body, nil
+	}
+	if datastoreResource {
+		data := dom.CreateElement(xml.StartElement{Name: xml.Name{Space: Namespace, Local: "data"}})
+		for _, n := range nodes {
+			_ = data.AppendChild(dom.CloneNode(n, true))
+		}
+		return encodeXML(data)
+	}
+	// detached copies are encoded with their namespaces
+	copies := make([]dom.Node, len(nodes))
+	for i, n := range nodes {
+		copies[i] = dom.CloneNode(n, true)
+	}
+	return encodeXML(copies...)
+}
+
+// encodeXML returns the XML encoding of the nodes.
+func encodeXML(nodes ...dom.Node) ([]byte, error) {
+	var b bytes.Buffer
+	for _, n := range nodes {
+		if _, err := dom.NewMarshaler(n).XMLWriter().WriteTo(&b); err != nil {
+			return nil, err
+		}
+	}
+	return b.Bytes(), nil
+}
+
+// decodeBody returns the data node of the body of r, a child of the
+// data node at the path parent, of schema node e, or of the data
+// tree's root if parent is empty. The body must have a single data
+// node, which must be configuration.
+func decodeBody(r *http.Request, c *modules.Collection, parent datastore.InstanceID, e *yang.Entry) (dom.Node, error) {
+	media, err := bodyType(r)
+	if err != nil {
+		return nil, err
+	}
+	// the decoding's root has no parent, as the decoder requires
+	var n dom.Node = dom.NewDocument(nil)
+	if len(parent) > 0 {
+		n = dom.CreateElement(xml.StartElement{Name: parent[len(parent)-1].Name})
+	}
+	td := &datastore.Decoder{Node: n, Modules: c, Config: true, Attrs: datastore.AttrNamespaces()}
+	td.SetSchema(e)
+	un := dom.NewUnmarshaler(td)
+	un.InitializeArgs = []string{"mediatype", media}
+	reader := un.XMLReader()
+	if media == MediaTypeJSON {
+		reader = un.JSONReader()
+	}
+	if _, err := reader.ReadFrom(r.Body); err != nil {
+		return nil, newError(http.StatusBadRequest, rpc.ErrorTagMalformedMessage, "invalid request body: %v", err)
+	}
+	for _, err := range td.DecodingErrors() {
+		// instances required by instance-identifier values are
+		// outside the body, so cannot be resolved here
+		if de, ok := err.(*datastore.DecodeError); !ok || de.Tag != datastore.ErrorTagDataMissing {
+			return nil, rpc.FromError(err)
+		}
+	}
+	nodes := dataChildren(n)
+	if len(nodes) != 1 {
+		return nil, newError(http.StatusBadRequest, rpc.ErrorTagInvalidValue, "the request body must have one data node, not %d", len(nodes))
+	}
+	_ = n.RemoveChild(nodes[0])
+	return nodes[0], nil
+}
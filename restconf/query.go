@@ -0,0 +1,213 @@
+package restconf
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andaru/opr8/datastore"
+	"github.com/andaru/opr8/dom"
+	"github.com/andaru/opr8/modules"
+	"github.com/andaru/opr8/rpc"
+	"github.com/pkg/errors"
+)
+
+// query is the query parameters of a request for a data resource.
+type query struct {
+	// depth is the number of levels of descendants returned, or zero
+	// if unbounded
+	depth int
+	// fields selects the descendants returned, or is nil
+	fields   *fieldNode
+	defaults datastore.WithDefaults
+}
+
+// parseQuery returns the query parameters of the request r, with the
+// schema of the collection c. Only GET and HEAD requests may have any.
+func parseQuery(r *http.Request, c *modules.Collection) (*query, error) {
+	q := &query{}
+	for name, values := range r.URL.Query() {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			return nil, newError(http.StatusBadRequest, rpc.ErrorTagInvalidValue, "query parameter %s is not supported for %s", name, r.Method)
+		}
+		if len(values) != 1 {
+			return nil, newError(http.StatusBadRequest, rpc.ErrorTagInvalidValue, "query parameter %s may only be given once", name)
+		}
+		v := values[0]
+		var err error
+		switch name {
+		case "depth":
+			if v != "unbounded" {
+				if q.depth, err = strconv.Atoi(v); err == nil && (q.depth < 1 || q.depth > 65535) {
+					err = errors.New("out of range")
+				}
+			}
+		case "fields":
+			q.fields, err = parseFields(v, c)
+		case "with-defaults":
+			q.defaults, err = datastore.ParseWithDefaults(v)
+		default:
+			return nil, newError(http.StatusBadRequest, rpc.ErrorTagInvalidValue, "unsupported query parameter %s", name)
+		}
+		if err != nil {
+			return nil, newError(http.StatusBadRequest, rpc.ErrorTagInvalidValue, "invalid %s %q: %v", name, v, err)
+		}
+	}
+	return q, nil
+}
+
+// apply removes the descendants of the data node n not selected by the
+// fields and depth parameters. The datastore resource, the root, is at
+// depth 0, so its children are at depth 1, as are other targets.
+func (q *query) apply(n dom.Node) {
+	if q.fields != nil {
+		q.fields.apply(n)
+	}
+	if q.depth > 0 {
+		level := 1
+		if n.NodeType() != dom.NodeTypeElement {
+			level = 0
+		}
+		pruneDepth(n, level, q.depth)
+	}
+}
+
+// pruneDepth removes the descendants of the data node n, at the level,
+// deeper than depth.
+func pruneDepth(n dom.Node, level, depth int) {
+	for _, child := range dataChildren(n) {
+		if level >= depth {
+			_ = n.RemoveChild(child)
+		} else {
+			pruneDepth(child, level+1, depth)
+		}
+	}
+}
+
+// fieldNode is a node of a fields selection: a data node selected with
+// all of its descendants, or with those of its children.
+type fieldNode struct {
+	all      bool
+	children []*fieldNode
+	// namespace is empty if the field's name has no module name
+	namespace, local string
+}
+
+// child returns the child selection of the name, adding it if needed.
+func (f *fieldNode) child(namespace, local string) *fieldNode {
+	for _, c := range f.children {
+		if c.namespace == namespace && c.local == local {
+			return c
+		}
+	}
+	c := &fieldNode{namespace: namespace, local: local}
+	f.children = append(f.children, c)
+	return c
+}
+
+// match returns the child selection of the data node n, or nil.
+func (f *fieldNode) match(n dom.Node) *fieldNode {
+	for _, c := range f.children {
+		if c.local == n.Name().Local && (c.namespace == "" || c.namespace == n.Name().Space) {
+			return c
+		}
+	}
+	return nil
+}
+
+// apply removes the descendants of the data node n not selected.
+func (f *fieldNode) apply(n dom.Node) {
+	if f.all {
+		return
+	}
+	for _, child := range dataChildren(n) {
+		if c := f.match(child); c != nil {
+			c.apply(child)
+		} else {
+			_ = n.RemoveChild(child)
+		}
+	}
+}
+
+// parseFields parses the fields query parameter s (RFC 8040 section
+// 4.8.3), whose module names are those of the collection c:
+//
+//	fields-expr = path "(" fields-expr ")" / path ";" fields-expr / path
+//	path = api-identifier [ "/" path ]
+func parseFields(s string, c *modules.Collection) (*fieldNode, error) {
+	p := &fieldsParser{s: s, c: c}
+	root := &fieldNode{}
+	if err := p.expr(root); err != nil {
+		return nil, err
+	}
+	if p.i < len(p.s) {
+		return nil, errors.Errorf("unexpected %q at offset %d", p.s[p.i], p.i)
+	}
+	return root, nil
+}
+
+type fieldsParser struct {
+	s string
+	i int
+	c *modules.Collection
+}
+
+// expr parses a fields-expr, adding its selections to sel.
+func (p *fieldsParser) expr(sel *fieldNode) error {
+	for {
+		f := sel
+		for {
+			namespace, local, err := p.identifier()
+			if err != nil {
+				return err
+			}
+			f = f.child(namespace, local)
+			if !p.accept('/') {
+				break
+			}
+		}
+		if p.accept('(') {
+			if err := p.expr(f); err != nil {
+				return err
+			}
+			if !p.accept(')') {
+				return errors.Errorf("missing ) at offset %d", p.i)
+			}
+		} else {
+			f.all = true
+		}
+		if !p.accept(';') {
+			return nil
+		}
+	}
+}
+
+// identifier parses an api-identifier, [module-name ":"] identifier,
+// returning the namespace of its module, if any, and its name.
+func (p *fieldsParser) identifier() (namespace, local string, err error) {
+	start := p.i
+	for p.i < len(p.s) && !strings.ContainsRune("/;()", rune(p.s[p.i])) {
+		p.i++
+	}
+	id := p.s[start:p.i]
+	if i := strings.IndexByte(id, ':'); i >= 0 {
+		module := id[:i]
+		e, err := p.c.ModuleEntry(module)
+		if err != nil {
+			return "", "", errors.Errorf("unknown module %q", module)
+		}
+		namespace, id = e.Namespace().Name, id[i+1:]
+	}
+	if id == "" {
+		return "", "", errors.Errorf("missing identifier at offset %d", start)
+	}
+	return namespace, id, nil
+}
+
+func (p *fieldsParser) accept(c byte) bool {
+	if p.i < len(p.s) && p.s[p.i] == c {
+		p.i++
+		return true
+	}
+	return false
+}
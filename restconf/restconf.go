@@ -0,0 +1,318 @@
+/*
+Package restconf has the RESTCONF (RFC 8040) HTTP server, exposing the
+data of the running datastore as resources of the API root,
+{+restconf}:
+
+	{+restconf}                       the API root resource
+	{+restconf}/data                  the datastore resource
+	{+restconf}/data/<api-path>       data resources, e.g.,
+	                                  /data/ietf-interfaces:interfaces/interface=eth0
+	{+restconf}/operations            the operations of the schema
+	{+restconf}/yang-library-version  the ietf-yang-library revision
+	/.well-known/host-meta            the root resource discovery document
+
+Data resources are read by GET and HEAD, created by POST, created or
+replaced by PUT, merged with the request body (a plain patch) by PATCH
+and deleted by DELETE. Writes are committed to the running datastore.
+Responses are encoded as YANG/XML or YANG/JSON (RFC 7951), as preferred
+by the request's Accept header, and request bodies are decoded as their
+Content-Type. Reads support the depth, fields and with-defaults query
+parameters.
+
+Data resource responses carry an ETag, a hash of the resource, and a
+Last-Modified time, that of the datastore's last commit. Reads are
+conditional on If-None-Match and If-Modified-Since, and writes on
+If-Match, If-None-Match and If-Unmodified-Since.
+
+The ietf-yang-library data is included in the datastore resource if the
+datastore's collection has the ietf-yang-library module. Operations are
+listed, but may not be invoked.
+
+The Server is typically wrapped by the Handler of the session/restconf
+package, so each request is a session of the session manager, and the
+session's username is that whose access is controlled by the Server's
+Authorizer:
+
+	srv := restconf.NewServer(set, restconf.WithAuthorizer(enforcer))
+	http.Handle("/", restconfsession.Handler(mgr, username, srv))
+*/
+package restconf
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	xml "github.com/andaru/flexml"
+	"github.com/andaru/opr8/datastore"
+	"github.com/andaru/opr8/dom"
+	"github.com/andaru/opr8/modules"
+	"github.com/andaru/opr8/rpc"
+	"github.com/andaru/opr8/session"
+	restconfsession "github.com/andaru/opr8/session/restconf"
+	"github.com/openconfig/goyang/pkg/yang"
+)
+
+const (
+	// Namespace is the XML namespace of the ietf-restconf module.
+	Namespace = "urn:ietf:params:xml:ns:yang:ietf-restconf"
+	// YangLibraryVersion is the revision of the ietf-yang-library
+	// module implemented, reported by the yang-library-version
+	// resource.
+	YangLibraryVersion = "2019-01-04"
+
+	// DefaultRoot is the default path of the API root resource.
+	DefaultRoot = "/restconf"
+)
+
+// Option is a constructor option for Server.
+type Option func(*Server)
+
+// WithRoot is a Server option setting the path of the API root
+// resource, DefaultRoot by default.
+func WithRoot(path string) Option {
+	return func(s *Server) { s.root = strings.TrimSuffix(path, "/") }
+}
+
+// WithAuthorizer is a Server option setting the access control of the
+// data read and written, by the username of each request's session.
+func WithAuthorizer(a rpc.Authorizer) Option {
+	return func(s *Server) { s.authorizer = a }
+}
+
+// Server is the RESTCONF HTTP server of the datastores of a Set. It is
+// an http.Handler, and safe for concurrent use.
+type Server struct {
+	set        *datastore.Set
+	root       string
+	authorizer rpc.Authorizer
+}
+
+// NewServer returns a new RESTCONF server of the datastores of set,
+// whose running datastore's data it serves.
+func NewServer(set *datastore.Set, options ...Option) *Server {
+	s := &Server{set: set, root: DefaultRoot}
+	for _, option := range options {
+		option(s)
+	}
+	return s
+}
+
+// ServeHTTP serves the RESTCONF request r.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// the escaped path keeps percent-encoded key values intact
+	path := r.URL.EscapedPath()
+	switch {
+	case path == "/.well-known/host-meta":
+		s.hostMeta(w, r)
+	case path == s.root || path == s.root+"/":
+		s.apiRoot(w, r)
+	case path == s.root+"/data" || strings.HasPrefix(path, s.root+"/data/"):
+		s.data(w, r, strings.TrimPrefix(path, s.root+"/data"))
+	case path == s.root+"/operations":
+		s.operations(w, r)
+	case strings.HasPrefix(path, s.root+"/operations/"):
+		writeError(w, r, "", newError(http.StatusNotImplemented, rpc.ErrorTagOperationNotSupported, "operations may not be invoked"))
+	case path == s.root+"/yang-library-version":
+		s.libraryVersion(w, r)
+	default:
+		writeError(w, r, "", newError(http.StatusNotFound, rpc.ErrorTagInvalidValue, "no such resource %s", path))
+	}
+}
+
+// hostMeta serves the root resource discovery document (RFC 6415),
+// linking to the API root.
+func (s *Server) hostMeta(w http.ResponseWriter, r *http.Request) {
+	if !readOnly(w, r) {
+		return
+	}
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s.root))
+	writeBody(w, r, http.StatusOK, "application/xrd+xml",
+		[]byte(`<XRD xmlns="http://docs.oasis-open.org/ns/xri/xrd-1.0"><Link rel="restconf" href="`+b.String()+`"/></XRD>`))
+}
+
+// apiRoot serves the API root resource.
+func (s *Server) apiRoot(w http.ResponseWriter, r *http.Request) {
+	if !readOnly(w, r) {
+		return
+	}
+	media, err := negotiate(r)
+	if err != nil {
+		writeError(w, r, media, err)
+		return
+	}
+	body := `{"ietf-restconf:restconf":{"data":{},"operations":{},"yang-library-version":"` + YangLibraryVersion + `"}}`
+	if media == MediaTypeXML {
+		body = `<restconf xmlns="` + Namespace + `"><data/><operations/><yang-library-version>` +
+			YangLibraryVersion + `</yang-library-version></restconf>`
+	}
+	writeBody(w, r, http.StatusOK, media, []byte(body))
+}
+
+// libraryVersion serves the yang-library-version resource.
+func (s *Server) libraryVersion(w http.ResponseWriter, r *http.Request) {
+	if !readOnly(w, r) {
+		return
+	}
+	media, err := negotiate(r)
+	if err != nil {
+		writeError(w, r, media, err)
+		return
+	}
+	body := `{"ietf-restconf:yang-library-version":"` + YangLibraryVersion + `"}`
+	if media == MediaTypeXML {
+		body = `<yang-library-version xmlns="` + Namespace + `">` + YangLibraryVersion + `</yang-library-version>`
+	}
+	writeBody(w, r, http.StatusOK, media, []byte(body))
+}
+
+// operations serves the operations resource, listing the operations of
+// the running datastore's schema.
+func (s *Server) operations(w http.ResponseWriter, r *http.Request) {
+	if !readOnly(w, r) {
+		return
+	}
+	media, err := negotiate(r)
+	if err != nil {
+		writeError(w, r, media, err)
+		return
+	}
+	ds, err := s.running()
+	if err != nil {
+		writeError(w, r, media, err)
+		return
+	}
+	ops := dom.CreateElement(xml.StartElement{Name: xml.Name{Space: Namespace, Local: "operations"}})
+	for _, name := range rpcNames(ds.Modules()) {
+		_ = ops.AppendChild(dom.CreateElement(xml.StartElement{Name: name}))
+	}
+	if media == MediaTypeJSON {
+		// operations are encoded as empty leaves, as RFC 8040 requires
+		var b strings.Builder
+		b.WriteString(`{"ietf-restconf:operations":{`)
+		for i, n := range dataChildren(ops) {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(`"` + moduleName(ds.Modules(), n.Name().Space) + ":" + n.Name().Local + `":[null]`)
+		}
+		b.WriteString(`}}`)
+		writeBody(w, r, http.StatusOK, media, []byte(b.String()))
+		return
+	}
+	body, err := encodeXML(ops)
+	if err != nil {
+		writeError(w, r, media, err)
+		return
+	}
+	writeBody(w, r, http.StatusOK, media, body)
+}
+
+// running returns the running datastore.
+func (s *Server) running() (*datastore.Datastore, error) {
+	ds := s.set.Get(datastore.Running)
+	if ds == nil || ds.Modules() == nil {
+		return nil, newError(http.StatusInternalServerError, rpc.ErrorTagOperationFailed, "no running datastore with a schema")
+	}
+	return ds, nil
+}
+
+// user returns the session ID and username of the request's session,
+// or zero and the empty string if the request has no session.
+func (s *Server) user(r *http.Request) (session.ID, string) {
+	sess, ok := restconfsession.FromContext(r.Context())
+	if !ok {
+		return 0, ""
+	}
+	if t, ok := sess.Transport().(*restconfsession.Transport); ok {
+		return sess.ID(), t.Username()
+	}
+	return sess.ID(), ""
+}
+
+// readTree returns a copy of the data tree root of the datastore ds,
+// with the yang-library, with the data the user may not read removed.
+func (s *Server) readTree(ds *datastore.Datastore, user string, root dom.Node) dom.Node {
+	tree := dom.CloneNode(root, true)
+	c := ds.Modules()
+	if _, err := c.ModuleEntry("ietf-yang-library"); err == nil {
+		if lib, _, err := c.YangLibrary(s.set.Names()...); err == nil {
+			_ = tree.AppendChild(lib)
+		}
+	}
+	if s.authorizer != nil {
+		s.authorizer.FilterRead(user, tree)
+	}
+	return tree
+}
+
+// readOnly returns true if r is a GET or HEAD request. Otherwise, it
+// responds to OPTIONS requests, and others with 405 Method Not
+// Allowed, and returns false.
+func readOnly(w http.ResponseWriter, r *http.Request) bool {
+	return allow(w, r, http.MethodGet, http.MethodHead)
+}
+
+// allow returns true if the method of r is one of methods. Otherwise,
+// it responds to an OPTIONS request with the methods allowed, and to
+// others with 405 Method Not Allowed, and returns false.
+func allow(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, m := range methods {
+		if r.Method == m {
+			return true
+		}
+	}
+	w.Header().Set("Allow", strings.Join(append(methods, http.MethodOptions), ", "))
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return false
+	}
+	writeError(w, r, "", newError(http.StatusMethodNotAllowed, rpc.ErrorTagOperationNotSupported, "method %s is not allowed", r.Method))
+	return false
+}
+
+// rpcNames returns the names of the operations of the collection c, in
+// order.
+func rpcNames(c *modules.Collection) []xml.Name {
+	var names []xml.Name
+	_ = c.IterLatest(func(mod *yang.Module) error {
+		me, err := c.ModuleEntry(mod.Name)
+		if err != nil {
+			return nil
+		}
+		for _, e := range me.Dir {
+			if e.RPC != nil {
+				names = append(names, xml.Name{Space: e.Namespace().Name, Local: e.Name})
+			}
+		}
+		return nil
+	})
+	sort.Slice(names, func(i, j int) bool {
+		if names[i].Space != names[j].Space {
+			return names[i].Space < names[j].Space
+		}
+		return names[i].Local < names[j].Local
+	})
+	return names
+}
+
+// moduleName returns the name of the module of c with the namespace
+// ns, or ns if there is none.
+func moduleName(c *modules.Collection, ns string) string {
+	if m, err := c.ModuleByNamespace(ns); err == nil {
+		return m.Name
+	}
+	return ns
+}
+
+// dataChildren returns the element children of n.
+func dataChildren(n dom.Node) []dom.Node {
+	var children []dom.Node
+	for it := n.FirstChild(); it != nil; it = it.NextSibling() {
+		if it.NodeType() == dom.NodeTypeElement {
+			children = append(children, it)
+		}
+	}
+	return children
+}
@@ -0,0 +1,421 @@
+package restconf
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andaru/opr8/datastore"
+	"github.com/andaru/opr8/dom"
+	"github.com/andaru/opr8/modules"
+)
+
+const testModule = `module rc-test {
+  namespace "urn:rc-test"; prefix rt;
+  container system {
+    leaf host-name { type string; }
+    leaf mtu { type uint16; default 1500; }
+    list user { key name; leaf name { type string; } leaf uid { type uint32; } }
+    container state { config false; leaf uptime { type uint32; } }
+  }
+  rpc reboot;
+}`
+
+const testData = `<system xmlns="urn:rc-test"><host-name>a</host-name>` +
+	`<user><name>x</name><uid>1</uid></user><user><name>y z</name><uid>2</uid></user></system>`
+
+func newTestServer(t *testing.T) (*Server, *datastore.Datastore) {
+	t.Helper()
+	c := modules.NewCollection()
+	if err := c.ReadString("rc-test", testModule); err != nil {
+		t.Fatal(err)
+	}
+	if errs := c.Process(); errs != nil {
+		t.Fatal(errs)
+	}
+	ds := datastore.New(datastore.Running, c)
+	_, err := ds.Update(0, "", func(root dom.Document) error {
+		doc := dom.NewDocument(nil)
+		if _, err := dom.NewUnmarshaler(dom.NewBuilder(doc, dom.WithTrimPCData())).XMLReader().ReadFrom(strings.NewReader(testData)); err != nil {
+			return err
+		}
+		return root.AppendChild(dom.CloneNode(doc.DocumentElement(), true))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewServer(datastore.NewSet(ds)), ds
+}
+
+// do returns the response of srv to the request, whose headers are
+// given as name and value pairs.
+func do(srv http.Handler, method, target, body string, headers ...string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	for i := 0; i+1 < len(headers); i += 2 {
+		r.Header.Set(headers[i], headers[i+1])
+	}
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, r)
+	return w
+}
+
+func TestServer_read(t *testing.T) {
+	srv, _ := newTestServer(t)
+	for _, tt := range []struct {
+		name         string
+		method       string
+		target       string
+		headers      []string
+		wantStatus   int
+		wantType     string
+		wantBody     string
+		wantContains []string
+	}{
+		{
+			name:       "leaf json",
+			target:     "/restconf/data/rc-test:system/host-name",
+			wantStatus: http.StatusOK,
+			wantType:   MediaTypeJSON,
+			wantBody:   `{"rc-test:host-name":"a"}`,
+		},
+		{
+			name:       "leaf xml",
+			target:     "/restconf/data/rc-test:system/host-name",
+			headers:    []string{"Accept", "application/yang-data+xml"},
+			wantStatus: http.StatusOK,
+			wantType:   MediaTypeXML,
+			wantBody:   `<host-name xmlns="urn:rc-test">a</host-name>`,
+		},
+		{
+			name:       "list entry with escaped key",
+			target:     "/restconf/data/rc-test:system/user=y%20z/uid",
+			wantStatus: http.StatusOK,
+			wantBody:   `{"rc-test:uid":2}`,
+		},
+		{
+			name:         "datastore resource",
+			target:       "/restconf/data",
+			wantStatus:   http.StatusOK,
+			wantContains: []string{`{"ietf-restconf:data":{"rc-test:system":{`, `"host-name":"a"`},
+		},
+		{
+			name:         "datastore resource xml",
+			target:       "/restconf/data",
+			headers:      []string{"Accept", "application/xml"},
+			wantStatus:   http.StatusOK,
+			wantContains: []string{`<data xmlns="urn:ietf:params:xml:ns:yang:ietf-restconf"><system xmlns="urn:rc-test">`},
+		},
+		{
+			name:       "depth",
+			target:     "/restconf/data/rc-test:system?depth=1",
+			wantStatus: http.StatusOK,
+			wantBody:   `{"rc-test:system":{}}`,
+		},
+		{
+			name:       "fields",
+			target:     "/restconf/data/rc-test:system?fields=user(name)",
+			wantStatus: http.StatusOK,
+			wantBody:   `{"rc-test:system":{"user":[{"name":"x"},{"name":"y z"}]}}`,
+		},
+		{
+			name:         "with-defaults report-all",
+			target:       "/restconf/data/rc-test:system?with-defaults=report-all",
+			wantStatus:   http.StatusOK,
+			wantContains: []string{`"mtu":1500`},
+		},
+		{
+			name:       "missing resource",
+			target:     "/restconf/data/rc-test:system/user=q",
+			wantStatus: http.StatusNotFound,
+			wantContains: []string{
+				`{"ietf-restconf:errors":{"error":[{"error-type":"protocol","error-tag":"invalid-value"`,
+			},
+		},
+		{
+			name:       "unknown module",
+			target:     "/restconf/data/nope:system",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "unknown query parameter",
+			target:     "/restconf/data/rc-test:system?filter=x",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "bad fields",
+			target:     "/restconf/data/rc-test:system?fields=user(name",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "not acceptable",
+			target:     "/restconf/data",
+			headers:    []string{"Accept", "text/html"},
+			wantStatus: http.StatusNotAcceptable,
+		},
+		{
+			name:       "head",
+			method:     http.MethodHead,
+			target:     "/restconf/data/rc-test:system/host-name",
+			wantStatus: http.StatusOK,
+			wantType:   MediaTypeJSON,
+		},
+		{
+			name:       "api root",
+			target:     "/restconf",
+			wantStatus: http.StatusOK,
+			wantBody:   `{"ietf-restconf:restconf":{"data":{},"operations":{},"yang-library-version":"2019-01-04"}}`,
+		},
+		{
+			name:       "yang-library-version xml",
+			target:     "/restconf/yang-library-version",
+			headers:    []string{"Accept", "application/yang-data+xml"},
+			wantStatus: http.StatusOK,
+			wantBody:   `<yang-library-version xmlns="urn:ietf:params:xml:ns:yang:ietf-restconf">2019-01-04</yang-library-version>`,
+		},
+		{
+			name:       "operations",
+			target:     "/restconf/operations",
+			wantStatus: http.StatusOK,
+			wantBody:   `{"ietf-restconf:operations":{"rc-test:reboot":[null]}}`,
+		},
+		{
+			name:         "host-meta",
+			target:       "/.well-known/host-meta",
+			wantStatus:   http.StatusOK,
+			wantContains: []string{`<Link rel="restconf" href="/restconf"/>`},
+		},
+		{
+			name:       "unknown resource",
+			target:     "/restconf/nope",
+			wantStatus: http.StatusNotFound,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			w := do(srv, method, tt.target, "", tt.headers...)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status: got %d, want %d (body %s)", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantType != "" && w.Header().Get("Content-Type") != tt.wantType {
+				t.Errorf("Content-Type: got %q, want %q", w.Header().Get("Content-Type"), tt.wantType)
+			}
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				t.Errorf("body:\n got %s\nwant %s", w.Body, tt.wantBody)
+			}
+			for _, s := range tt.wantContains {
+				if !strings.Contains(w.Body.String(), s) {
+					t.Errorf("body %s does not contain %s", w.Body, s)
+				}
+			}
+			if method == http.MethodHead && w.Body.Len() != 0 {
+				t.Errorf("HEAD response has a body: %s", w.Body)
+			}
+		})
+	}
+}
+
+func TestServer_conditional(t *testing.T) {
+	srv, _ := newTestServer(t)
+	const target = "/restconf/data/rc-test:system/host-name"
+	w := do(srv, http.MethodGet, target, "")
+	tag, modified := w.Header().Get("ETag"), w.Header().Get("Last-Modified")
+	if tag == "" || modified == "" {
+		t.Fatalf("missing validators: ETag %q, Last-Modified %q", tag, modified)
+	}
+	if w := do(srv, http.MethodGet, target, "", "If-None-Match", tag); w.Code != http.StatusNotModified {
+		t.Errorf("If-None-Match: got status %d, want 304", w.Code)
+	}
+	if w := do(srv, http.MethodGet, target, "", "If-Modified-Since", modified); w.Code != http.StatusNotModified {
+		t.Errorf("If-Modified-Since: got status %d, want 304", w.Code)
+	}
+	if w := do(srv, http.MethodGet, "/restconf/data/rc-test:system/user=x", "", "If-None-Match", tag); w.Code != http.StatusOK {
+		t.Errorf("If-None-Match of another resource: got status %d, want 200", w.Code)
+	}
+
+	body := `{"rc-test:host-name":"b"}`
+	if w := do(srv, http.MethodPut, target, body, "Content-Type", MediaTypeJSON, "If-Match", `"other"`); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("If-Match mismatch: got status %d, want 412 (body %s)", w.Code, w.Body)
+	}
+	w = do(srv, http.MethodPut, target, body, "Content-Type", MediaTypeJSON, "If-Match", tag)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("If-Match: got status %d, want 204 (body %s)", w.Code, w.Body)
+	}
+	if w.Header().Get("ETag") == tag {
+		t.Errorf("ETag unchanged by the write: %s", tag)
+	}
+	if w := do(srv, http.MethodGet, target, "", "If-None-Match", tag); w.Code != http.StatusOK {
+		t.Errorf("If-None-Match after write: got status %d, want 200", w.Code)
+	}
+}
+
+func TestServer_write(t *testing.T) {
+	for _, tt := range []struct {
+		name         string
+		method       string
+		target       string
+		contentType  string
+		body         string
+		wantStatus   int
+		wantLocation string
+		// wantData is the XML encoding of the system container after
+		// the request
+		wantData string
+	}{
+		{
+			name:        "put replace leaf",
+			method:      http.MethodPut,
+			target:      "/restconf/data/rc-test:system/host-name",
+			contentType: MediaTypeJSON,
+			body:        `{"rc-test:host-name":"b"}`,
+			wantStatus:  http.StatusNoContent,
+			wantData: `<system xmlns="urn:rc-test">` +
+				`<user><name>x</name><uid>1</uid></user><user><name>y z</name><uid>2</uid></user><host-name>b</host-name></system>`,
+		},
+		{
+			name:        "put create list entry",
+			method:      http.MethodPut,
+			target:      "/restconf/data/rc-test:system/user=w",
+			contentType: MediaTypeXML,
+			body:        `<user xmlns="urn:rc-test"><name>w</name><uid>3</uid></user>`,
+			wantStatus:  http.StatusCreated,
+			wantData: `<system xmlns="urn:rc-test"><host-name>a</host-name>` +
+				`<user><name>x</name><uid>1</uid></user><user><name>y z</name><uid>2</uid></user>` +
+				`<user><name>w</name><uid>3</uid></user></system>`,
+		},
+		{
+			name:        "put key mismatch",
+			method:      http.MethodPut,
+			target:      "/restconf/data/rc-test:system/user=w",
+			contentType: MediaTypeJSON,
+			body:        `{"rc-test:user":[{"name":"v"}]}`,
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name:         "post list entry",
+			method:       http.MethodPost,
+			target:       "/restconf/data/rc-test:system",
+			contentType:  MediaTypeJSON,
+			body:         `{"rc-test:user":[{"name":"v,w","uid":4}]}`,
+			wantStatus:   http.StatusCreated,
+			wantLocation: "/restconf/data/rc-test:system/user=v%2Cw",
+			wantData: `<system xmlns="urn:rc-test"><host-name>a</host-name>` +
+				`<user><name>x</name><uid>1</uid></user><user><name>y z</name><uid>2</uid></user>` +
+				`<user><name>v,w</name><uid>4</uid></user></system>`,
+		},
+		{
+			name:        "post existing",
+			method:      http.MethodPost,
+			target:      "/restconf/data/rc-test:system",
+			contentType: MediaTypeJSON,
+			body:        `{"rc-test:user":[{"name":"x"}]}`,
+			wantStatus:  http.StatusConflict,
+		},
+		{
+			name:        "post to leaf",
+			method:      http.MethodPost,
+			target:      "/restconf/data/rc-test:system/host-name",
+			contentType: MediaTypeJSON,
+			body:        `{"rc-test:host-name":"b"}`,
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name:        "patch merge",
+			method:      http.MethodPatch,
+			target:      "/restconf/data/rc-test:system/user=x",
+			contentType: MediaTypeJSON,
+			body:        `{"rc-test:user":[{"name":"x","uid":9}]}`,
+			wantStatus:  http.StatusNoContent,
+			wantData: `<system xmlns="urn:rc-test"><host-name>a</host-name>` +
+				`<user><name>x</name><uid>9</uid></user><user><name>y z</name><uid>2</uid></user></system>`,
+		},
+		{
+			name:        "patch missing",
+			method:      http.MethodPatch,
+			target:      "/restconf/data/rc-test:system/user=q",
+			contentType: MediaTypeJSON,
+			body:        `{"rc-test:user":[{"name":"q","uid":9}]}`,
+			wantStatus:  http.StatusNotFound,
+		},
+		{
+			name:       "delete",
+			method:     http.MethodDelete,
+			target:     "/restconf/data/rc-test:system/user=x",
+			wantStatus: http.StatusNoContent,
+			wantData: `<system xmlns="urn:rc-test"><host-name>a</host-name>` +
+				`<user><name>y z</name><uid>2</uid></user></system>`,
+		},
+		{
+			name:       "delete missing",
+			method:     http.MethodDelete,
+			target:     "/restconf/data/rc-test:system/user=q",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:        "unsupported media type",
+			method:      http.MethodPut,
+			target:      "/restconf/data/rc-test:system/host-name",
+			contentType: "text/plain",
+			body:        `b`,
+			wantStatus:  http.StatusUnsupportedMediaType,
+		},
+		{
+			name:        "state data",
+			method:      http.MethodPut,
+			target:      "/restconf/data/rc-test:system/state",
+			contentType: MediaTypeJSON,
+			body:        `{"rc-test:state":{}}`,
+			wantStatus:  http.StatusMethodNotAllowed,
+		},
+		{
+			name:       "delete datastore resource",
+			method:     http.MethodDelete,
+			target:     "/restconf/data",
+			wantStatus: http.StatusMethodNotAllowed,
+		},
+		{
+			name:       "query parameter",
+			method:     http.MethodDelete,
+			target:     "/restconf/data/rc-test:system/user=x?depth=1",
+			wantStatus: http.StatusBadRequest,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, ds := newTestServer(t)
+			w := do(srv, tt.method, tt.target, tt.body, "Content-Type", tt.contentType)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status: got %d, want %d (body %s)", w.Code, tt.wantStatus, w.Body)
+			}
+			if got := w.Header().Get("Location"); got != tt.wantLocation {
+				t.Errorf("Location: got %q, want %q", got, tt.wantLocation)
+			}
+			if tt.wantData == "" {
+				return
+			}
+			got, err := encodeXML(dataChildren(ds.Snapshot().Root)...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.wantData {
+				t.Errorf("data:\n got %s\nwant %s", got, tt.wantData)
+			}
+		})
+	}
+}
+
+func TestServer_options(t *testing.T) {
+	srv, _ := newTestServer(t)
+	for target, want := range map[string]string{
+		"/restconf/data":                "GET, HEAD, POST, OPTIONS",
+		"/restconf/data/rc-test:system": "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS",
+		"/restconf/operations":          "GET, HEAD, OPTIONS",
+	} {
+		w := do(srv, http.MethodOptions, target, "")
+		if w.Code != http.StatusOK || w.Header().Get("Allow") != want {
+			t.Errorf("OPTIONS %s: got %d, Allow %q, want 200, Allow %q", target, w.Code, w.Header().Get("Allow"), want)
+		}
+	}
+}
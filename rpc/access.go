@@ -0,0 +1,22 @@
+package rpc
+
+import (
+	xml "github.com/andaru/flexml"
+	"github.com/andaru/opr8/dom"
+)
+
+// Authorizer is the interface to access control, such as the NETCONF
+// access control model (RFC 8341), by the username of a session.
+// Denials are reported by returning an RPCError with the access-denied
+// error-tag.
+type Authorizer interface {
+	// AuthorizeOperation returns an error if the user may not invoke
+	// the operation with the element name.
+	AuthorizeOperation(user string, name xml.Name) error
+	// FilterRead removes the data the user may not read from the data
+	// tree root.
+	FilterRead(user string, root dom.Node)
+	// AuthorizeWrite returns an error if the user may not change the
+	// data tree prev into the data tree next.
+	AuthorizeWrite(user string, prev, next dom.Node) error
+}
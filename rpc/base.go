@@ -0,0 +1,623 @@
+package rpc
+
+import (
+	"context"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	xml "github.com/andaru/flexml"
+	"github.com/andaru/opr8/datastore"
+	"github.com/andaru/opr8/dom"
+	"github.com/andaru/opr8/modules"
+	"github.com/andaru/opr8/session"
+	"github.com/andaru/opr8/session/netconf"
+	"github.com/pkg/errors"
+)
+
+// NETCONF capability URIs of the base operations (RFC 6241 section 8).
+const (
+	CapWritableRunning = "urn:ietf:params:netconf:capability:writable-running:1.0"
+	CapCandidate       = "urn:ietf:params:netconf:capability:candidate:1.0"
+	CapStartup         = "urn:ietf:params:netconf:capability:startup:1.0"
+	CapValidate        = "urn:ietf:params:netconf:capability:validate:1.1"
+	CapConfirmedCommit = "urn:ietf:params:netconf:capability:confirmed-commit:1.1"
+)
+
+// Base has the handlers of the base NETCONF operations (RFC 6241
+// section 7), on the datastores of a datastore.Set and the sessions of
+// a session.Manager:
+//
+//	base := rpc.NewBase(set, mgr)
+//	d := rpc.NewDispatcher()
+//	base.Register(d)
+//	acc := netconf.NewAcceptor(c, d, netconf.WithCapabilities(base.Capabilities()...))
+//
+// The get operation reads the running datastore. The candidate and
+// startup datastores are optional, as are the operations using them.
+// Datastore locks are held until unlocked or the session holding them
+// ends. Subtree filters are supported, and xpath filters are not.
+//
+// The Authorizer of the Dispatcher the handlers are registered with,
+// if any, filters the data read by get and get-config, and checks the
+// changes made by edit-config, copy-config and delete-config. Commit
+// and discard-changes copy between datastores without data checks.
+//
+// Confirmed commits and cancel-commit are supported once a
+// datastore.Confirmer is set with SetConfirmer.
+type Base struct {
+	set *datastore.Set
+	mgr session.Manager
+	// d is the Dispatcher the handlers are registered with
+	d *Dispatcher
+	// confirmer, if not nil, makes commits to the running datastore
+	confirmer *datastore.Confirmer
+
+	mu sync.Mutex
+	// locks are the IDs of the sessions holding datastore locks
+	locks map[string]session.ID
+}
+
+// NewBase returns the base operations on the datastores of set, whose
+// locks are released when their sessions, managed by mgr, end.
+func NewBase(set *datastore.Set, mgr session.Manager) *Base {
+	return &Base{set: set, mgr: mgr, locks: map[string]session.ID{}}
+}
+
+// Register registers the handlers of the base operations with d.
+func (b *Base) Register(d *Dispatcher) {
+	b.d = d
+	for local, f := range map[string]HandlerFunc{
+		"get":             b.get,
+		"get-config":      b.getConfig,
+		"edit-config":     b.editConfig,
+		"copy-config":     b.copyConfig,
+		"delete-config":   b.deleteConfig,
+		"lock":            b.lock,
+		"unlock":          b.unlock,
+		"close-session":   b.closeSession,
+		"kill-session":    b.killSession,
+		"validate":        b.validate,
+		"commit":          b.commit,
+		"discard-changes": b.discardChanges,
+		"cancel-commit":   b.cancelCommit,
+	} {
+		d.Handle(xml.Name{Space: netconf.BaseNamespace, Local: local}, f)
+	}
+}
+
+// Capabilities returns the capability URIs of the base operations on
+// the datastores in the set, to be advertised by the NETCONF acceptor.
+func (b *Base) Capabilities() []string {
+	var caps []string
+	if running := b.set.Get(datastore.Running); running != nil && !running.ReadOnly() {
+		caps = append(caps, CapWritableRunning)
+	}
+	if b.set.Get(datastore.Candidate) != nil {
+		caps = append(caps, CapCandidate)
+	}
+	if b.set.Get(datastore.Startup) != nil {
+		caps = append(caps, CapStartup)
+	}
+	caps = append(caps, CapValidate)
+	if b.confirmer != nil && b.set.Get(datastore.Candidate) != nil {
+		caps = append(caps, CapConfirmedCommit)
+	}
+	return caps
+}
+
+// SetConfirmer sets the Confirmer of commits to the running datastore,
+// supporting confirmed commits. It is set before the capabilities are
+// advertised.
+func (b *Base) SetConfirmer(c *datastore.Confirmer) { b.confirmer = c }
+
+func (b *Base) get(ctx context.Context, s *netconf.Session, op dom.Node) ([]dom.Node, error) {
+	ds := b.set.Get(datastore.Running)
+	if ds == nil {
+		return nil, NewError(ErrorTypeApplication, ErrorTagOperationFailed, "no running datastore")
+	}
+	var root dom.Node = ds.Snapshot().Root
+	if b.authorizer() != nil {
+		root = dom.CloneNode(root, true)
+		b.filterRead(s, root)
+	}
+	return b.data(op, root)
+}
+
+func (b *Base) getConfig(ctx context.Context, s *netconf.Session, op dom.Node) ([]dom.Node, error) {
+	ds, err := b.datastore(op, "source")
+	if err != nil {
+		return nil, err
+	}
+	root := dom.CloneNode(ds.Snapshot().Root, true)
+	if err := datastore.FilterConfig(root, ds.Modules(), nil, datastore.ConfigOnly); err != nil {
+		return nil, err
+	}
+	b.filterRead(s, root)
+	return b.data(op, root)
+}
+
+// data returns the <data> element of the reply to op, with the data
+// tree root selected by op's <filter>, if any.
+func (b *Base) data(op, root dom.Node) ([]dom.Node, error) {
+	if f := param(op, "filter"); f != nil {
+		if typ, ok := attrValue(f, xml.Name{Local: "type"}); ok && typ != "subtree" {
+			return nil, NewError(ErrorTypeProtocol, ErrorTagOperationNotSupported, "filter type %s is not supported", typ)
+		}
+		root = SubtreeFilter(root, f)
+	}
+	data := dom.CreateElement(xml.StartElement{Name: xml.Name{Space: netconf.BaseNamespace, Local: "data"}})
+	for it := root.FirstChild(); it != nil; it = it.NextSibling() {
+		if it.NodeType() == dom.NodeTypeElement {
+			_ = data.AppendChild(dom.CloneNode(it, true))
+		}
+	}
+	return []dom.Node{data}, nil
+}
+
+func (b *Base) editConfig(ctx context.Context, s *netconf.Session, op dom.Node) ([]dom.Node, error) {
+	ds, err := b.datastore(op, "target")
+	if err != nil {
+		return nil, err
+	}
+	if err := b.writable(s, ds); err != nil {
+		return nil, err
+	}
+	defaultOp := datastore.EditMerge
+	if p := param(op, "default-operation"); p != nil {
+		defaultOp, err = datastore.ParseEditOperation(strings.TrimSpace(p.ChildValue()))
+		if err != nil || defaultOp != datastore.EditMerge && defaultOp != datastore.EditReplace && defaultOp != datastore.EditNone {
+			return nil, invalidValue(p)
+		}
+	}
+	testOnly := false
+	if p := param(op, "test-option"); p != nil {
+		switch strings.TrimSpace(p.ChildValue()) {
+		case "test-then-set", "set":
+		case "test-only":
+			testOnly = true
+		default:
+			return nil, invalidValue(p)
+		}
+	}
+	if p := param(op, "error-option"); p != nil {
+		switch strings.TrimSpace(p.ChildValue()) {
+		case "stop-on-error", "rollback-on-error":
+			// edits are applied atomically
+		case "continue-on-error":
+			return nil, NewError(ErrorTypeProtocol, ErrorTagOperationNotSupported, "continue-on-error is not supported")
+		default:
+			return nil, invalidValue(p)
+		}
+	}
+	config := param(op, "config")
+	if config == nil {
+		if param(op, "url") != nil {
+			return nil, NewError(ErrorTypeProtocol, ErrorTagOperationNotSupported, "url is not supported")
+		}
+		return nil, missingElement("config")
+	}
+	edit, err := decodeConfig(config, ds.Modules())
+	if err != nil {
+		return nil, err
+	}
+
+	if testOnly {
+		prev := ds.Snapshot().Root
+		root := dom.CloneNode(prev, true)
+		if err := datastore.EditConfig(root, edit, ds.Modules(), defaultOp); err != nil {
+			return nil, FromError(err)
+		}
+		if a := b.authorizer(); a != nil {
+			if err := a.AuthorizeWrite(s.Username(), prev, root); err != nil {
+				return nil, err
+			}
+		}
+		return nil, FromValidation(ds.Validate(root))
+	}
+	return nil, b.update(s, ds, "edit-config", func(root dom.Document) error {
+		return datastore.EditConfig(root, edit, ds.Modules(), defaultOp)
+	})
+}
+
+func (b *Base) copyConfig(ctx context.Context, s *netconf.Session, op dom.Node) ([]dom.Node, error) {
+	ds, err := b.datastore(op, "target")
+	if err != nil {
+		return nil, err
+	}
+	if err := b.writable(s, ds); err != nil {
+		return nil, err
+	}
+	src, err := b.source(op, ds.Modules())
+	if err != nil {
+		return nil, err
+	}
+	return nil, b.update(s, ds, "copy-config", replaceContent(src))
+}
+
+func (b *Base) deleteConfig(ctx context.Context, s *netconf.Session, op dom.Node) ([]dom.Node, error) {
+	ds, err := b.datastore(op, "target")
+	if err != nil {
+		return nil, err
+	}
+	if ds.Name() == datastore.Running {
+		return nil, invalidValue(param(op, "target"))
+	}
+	if err := b.writable(s, ds); err != nil {
+		return nil, err
+	}
+	return nil, b.update(s, ds, "delete-config", replaceContent(dom.NewDocument(nil)))
+}
+
+func (b *Base) lock(ctx context.Context, s *netconf.Session, op dom.Node) ([]dom.Node, error) {
+	ds, err := b.datastore(op, "target")
+	if err != nil {
+		return nil, err
+	}
+	name, id := ds.Name(), s.ID()
+	b.mu.Lock()
+	if holder, ok := b.locks[name]; ok {
+		b.mu.Unlock()
+		e := NewError(ErrorTypeProtocol, ErrorTagLockDenied, "datastore %s is locked", name)
+		e.Info = []ErrorInfo{{Name: xml.Name{Local: "session-id"}, Value: strconv.FormatUint(uint64(holder), 10)}}
+		return nil, e
+	}
+	b.locks[name] = id
+	b.mu.Unlock()
+
+	if err := b.mgr.OnRelease(id, func() { b.release(name, id) }); err != nil {
+		b.release(name, id)
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (b *Base) unlock(ctx context.Context, s *netconf.Session, op dom.Node) ([]dom.Node, error) {
+	ds, err := b.datastore(op, "target")
+	if err != nil {
+		return nil, err
+	}
+	if !b.release(ds.Name(), s.ID()) {
+		return nil, NewError(ErrorTypeProtocol, ErrorTagOperationFailed, "datastore %s is not locked by this session", ds.Name())
+	}
+	return nil, nil
+}
+
+// release releases the lock on the named datastore, returning true if
+// the session with the ID held it.
+func (b *Base) release(name string, id session.ID) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if holder, ok := b.locks[name]; !ok || holder != id {
+		return false
+	}
+	delete(b.locks, name)
+	return true
+}
+
+func (b *Base) closeSession(ctx context.Context, s *netconf.Session, op dom.Node) ([]dom.Node, error) {
+	s.CloseAfterReply()
+	return nil, nil
+}
+
+func (b *Base) killSession(ctx context.Context, s *netconf.Session, op dom.Node) ([]dom.Node, error) {
+	p := param(op, "session-id")
+	if p == nil {
+		return nil, missingElement("session-id")
+	}
+	id, err := strconv.ParseUint(strings.TrimSpace(p.ChildValue()), 10, 32)
+	if err != nil || session.ID(id) == s.ID() {
+		return nil, invalidValue(p)
+	}
+	if err := b.mgr.Terminate(session.ID(id), errors.Errorf("killed by session %d", s.ID())); err != nil {
+		return nil, invalidValue(p)
+	}
+	return nil, nil
+}
+
+func (b *Base) validate(ctx context.Context, s *netconf.Session, op dom.Node) ([]dom.Node, error) {
+	ds := b.set.Get(datastore.Candidate)
+	if ds == nil {
+		ds = b.set.Get(datastore.Running)
+	}
+	if ds == nil {
+		return nil, NewError(ErrorTypeApplication, ErrorTagOperationFailed, "no running datastore")
+	}
+	src, err := b.source(op, ds.Modules())
+	if err != nil {
+		return nil, err
+	}
+	return nil, FromValidation(ds.Validate(src))
+}
+
+func (b *Base) commit(ctx context.Context, s *netconf.Session, op dom.Node) ([]dom.Node, error) {
+	var p datastore.ConfirmParams
+	p.Confirmed = param(op, "confirmed") != nil
+	if t := param(op, "confirm-timeout"); t != nil {
+		secs, err := strconv.ParseUint(strings.TrimSpace(t.ChildValue()), 10, 32)
+		if err != nil || secs == 0 {
+			return nil, invalidValue(t)
+		}
+		p.Timeout = time.Duration(secs) * time.Second
+	}
+	if v := param(op, "persist"); v != nil {
+		p.Persist = strings.TrimSpace(v.ChildValue())
+	}
+	if v := param(op, "persist-id"); v != nil {
+		p.PersistID = strings.TrimSpace(v.ChildValue())
+	}
+	if b.confirmer == nil {
+		if p != (datastore.ConfirmParams{}) {
+			return nil, NewError(ErrorTypeProtocol, ErrorTagOperationNotSupported, "confirmed commit is not supported")
+		}
+		return nil, b.replace(s, datastore.Candidate, datastore.Running, "commit")
+	}
+	src, dst := b.set.Get(datastore.Candidate), b.set.Get(datastore.Running)
+	if src == nil || dst == nil {
+		return nil, NewError(ErrorTypeProtocol, ErrorTagOperationNotSupported, "commit requires the candidate datastore")
+	}
+	if err := b.writable(s, dst); err != nil {
+		return nil, err
+	}
+	if _, err := b.confirmer.Commit(s.ID(), "commit", p, replaceContent(src.Snapshot().Root)); err != nil {
+		return nil, confirmError(err)
+	}
+	if p.Confirmed && p.Persist == "" {
+		// a commit which is not persistent is rolled back when its
+		// session ends
+		id := s.ID()
+		if err := b.mgr.OnRelease(id, func() { _ = b.confirmer.Release(id) }); err != nil {
+			_ = b.confirmer.Release(id)
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+func (b *Base) cancelCommit(ctx context.Context, s *netconf.Session, op dom.Node) ([]dom.Node, error) {
+	if b.confirmer == nil {
+		return nil, NewError(ErrorTypeProtocol, ErrorTagOperationNotSupported, "confirmed commit is not supported")
+	}
+	var persistID string
+	if v := param(op, "persist-id"); v != nil {
+		persistID = strings.TrimSpace(v.ChildValue())
+	}
+	return nil, confirmError(b.confirmer.Cancel(s.ID(), persistID))
+}
+
+// confirmError returns the rpc-error of the error of a Confirmer.
+func confirmError(err error) error {
+	switch errors.Cause(err) {
+	case datastore.ErrNoConfirmedCommit:
+		e := NewError(ErrorTypeProtocol, ErrorTagInvalidValue, "%v", err)
+		e.Info = badElement("persist-id")
+		return e
+	case datastore.ErrConfirmedCommitInUse:
+		return NewError(ErrorTypeProtocol, ErrorTagInUse, "%v", err)
+	}
+	return FromError(err)
+}
+
+func (b *Base) discardChanges(ctx context.Context, s *netconf.Session, op dom.Node) ([]dom.Node, error) {
+	return nil, b.replace(s, datastore.Running, datastore.Candidate, "discard-changes")
+}
+
+// replace replaces the content of the datastore named to with that of
+// from, for commit and discard-changes.
+func (b *Base) replace(s *netconf.Session, from, to, comment string) error {
+	src, dst := b.set.Get(from), b.set.Get(to)
+	if src == nil || dst == nil {
+		return NewError(ErrorTypeProtocol, ErrorTagOperationNotSupported, "%s requires the candidate datastore", comment)
+	}
+	if err := b.writable(s, dst); err != nil {
+		return err
+	}
+	_, err := dst.Update(s.ID(), comment, replaceContent(src.Snapshot().Root))
+	return FromError(err)
+}
+
+// update commits the change made to ds by edit, if the Authorizer
+// permits the session's user to make it.
+func (b *Base) update(s *netconf.Session, ds *datastore.Datastore, comment string, edit func(root dom.Document) error) error {
+	a := b.authorizer()
+	_, err := ds.Update(s.ID(), comment, func(root dom.Document) error {
+		// the snapshot is that being changed, as Update holds the
+		// writer lock
+		prev := ds.Snapshot().Root
+		if err := edit(root); err != nil || a == nil {
+			return err
+		}
+		return a.AuthorizeWrite(s.Username(), prev, root)
+	})
+	return FromError(err)
+}
+
+// filterRead removes the data the session's user may not read from
+// root, a copy of a datastore's data tree.
+func (b *Base) filterRead(s *netconf.Session, root dom.Node) {
+	if a := b.authorizer(); a != nil {
+		a.FilterRead(s.Username(), root)
+	}
+}
+
+// authorizer returns the Authorizer of the Dispatcher, or nil.
+func (b *Base) authorizer() Authorizer {
+	if b.d == nil {
+		return nil
+	}
+	return b.d.Authorizer()
+}
+
+// writable returns an error if the datastore ds may not be modified
+// by the session s.
+func (b *Base) writable(s *netconf.Session, ds *datastore.Datastore) error {
+	if ds.ReadOnly() {
+		return NewError(ErrorTypeProtocol, ErrorTagOperationNotSupported, "datastore %s is read-only", ds.Name())
+	}
+	b.mu.Lock()
+	holder, ok := b.locks[ds.Name()]
+	b.mu.Unlock()
+	if ok && holder != s.ID() {
+		return NewError(ErrorTypeProtocol, ErrorTagInUse, "datastore %s is locked by session %d", ds.Name(), holder)
+	}
+	return nil
+}
+
+// datastore returns the datastore named by the parameter local of op,
+// such as <target><running/></target>.
+func (b *Base) datastore(op dom.Node, local string) (*datastore.Datastore, error) {
+	p := param(op, local)
+	if p == nil {
+		return nil, missingElement(local)
+	}
+	children := elementChildren(p)
+	if len(children) != 1 {
+		return nil, invalidValue(p)
+	}
+	name := children[0].Name().Local
+	switch {
+	case name == "url":
+		return nil, NewError(ErrorTypeProtocol, ErrorTagOperationNotSupported, "url is not supported")
+	case name == "config":
+		return nil, invalidValue(children[0])
+	}
+	ds := b.set.Get(name)
+	if ds == nil || name == datastore.FactoryDefault {
+		e := NewError(ErrorTypeProtocol, ErrorTagInvalidValue, "unknown datastore %s", name)
+		e.Info = badElement(name)
+		return nil, e
+	}
+	return ds, nil
+}
+
+// source returns the configuration of the <source> parameter of op, a
+// datastore or an inline <config> element decoded with the schema c.
+func (b *Base) source(op dom.Node, c *modules.Collection) (dom.Node, error) {
+	if p := param(op, "source"); p != nil {
+		if config := param(p, "config"); config != nil {
+			return decodeConfig(config, c)
+		}
+	}
+	ds, err := b.datastore(op, "source")
+	if err != nil {
+		return nil, err
+	}
+	root := dom.CloneNode(ds.Snapshot().Root, true)
+	if err := datastore.FilterConfig(root, ds.Modules(), nil, datastore.ConfigOnly); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+// replaceContent returns an edit function for Datastore.Update
+// replacing the datastore's content with a copy of that of root.
+func replaceContent(root dom.Node) func(dom.Document) error {
+	return func(dst dom.Document) error {
+		for it := dst.FirstChild(); it != nil; it = dst.FirstChild() {
+			if err := dst.RemoveChild(it); err != nil {
+				return err
+			}
+		}
+		for it := root.FirstChild(); it != nil; it = it.NextSibling() {
+			if it.NodeType() != dom.NodeTypeElement {
+				continue
+			}
+			if err := dst.AppendChild(dom.CloneNode(it, true)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// decodeConfig returns a document with the content of the <config>
+// element, decoded with the schema c, keeping its edit operation and
+// insert attributes. The first decoding error is returned.
+func decodeConfig(config dom.Node, c *modules.Collection) (dom.Document, error) {
+	doc := dom.NewDocument(nil)
+	dec := &datastore.Decoder{
+		Node:    doc,
+		Modules: c,
+		Config:  true,
+		Attrs:   datastore.AttrNamespaces(netconf.BaseNamespace, datastore.YANGNamespace),
+	}
+	if err := dec.Initialize("mediatype", "application/yang-data+xml"); err != nil {
+		return nil, err
+	}
+	for _, n := range elementChildren(config) {
+		if err := decodeTokens(dec, n); err != nil {
+			return nil, FromError(err)
+		}
+	}
+	if err := dec.End(io.EOF); err != nil {
+		return nil, FromError(err)
+	}
+	if errs := dec.DecodingErrors(); len(errs) > 0 {
+		return nil, FromError(errs[0])
+	}
+	return doc, nil
+}
+
+// decodeTokens passes the tokens of the element n and its descendants
+// to the decoder td.
+func decodeTokens(td dom.TokenDecoder, n dom.Node) error {
+	se := xml.StartElement{Name: n.Name()}
+	if ap, ok := n.(dom.AttributeProvider); ok {
+		for a := dom.Node(ap.FirstAttribute()); a != nil; a = a.NextSibling() {
+			se.Attr = append(se.Attr, xml.Attr{Name: a.Name(), Value: a.Value()})
+		}
+	}
+	if err := td.StartElement(se); err != nil {
+		return err
+	}
+	for it := n.FirstChild(); it != nil; it = it.NextSibling() {
+		var err error
+		switch it.NodeType() {
+		case dom.NodeTypeElement:
+			err = decodeTokens(td, it)
+		case dom.NodeTypeText:
+			err = td.CharData(xml.CharData(it.Value()))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return td.EndElement(xml.EndElement{Name: se.Name})
+}
+
+// attrValue returns the value of the attribute of n with the name, and
+// true if n has it.
+func attrValue(n dom.Node, name xml.Name) (string, bool) {
+	if ap, ok := n.(dom.AttributeProvider); ok {
+		for a := dom.Node(ap.FirstAttribute()); a != nil; a = a.NextSibling() {
+			if a.Name() == name {
+				return a.Value(), true
+			}
+		}
+	}
+	return "", false
+}
+
+// param returns the NETCONF base element child of op named local, or
+// nil.
+func param(op dom.Node, local string) dom.Node {
+	return op.ChildByName(xml.Name{Space: netconf.BaseNamespace, Local: local})
+}
+
+// missingElement returns the error of an operation missing its
+// parameter local.
+func missingElement(local string) error {
+	e := NewError(ErrorTypeProtocol, ErrorTagMissingElement, "missing %s", local)
+	e.Info = badElement(local)
+	return e
+}
+
+// invalidValue returns the error of an operation parameter p with an
+// invalid value.
+func invalidValue(p dom.Node) error {
+	e := NewError(ErrorTypeProtocol, ErrorTagInvalidValue, "invalid %s", p.Name().Local)
+	e.Info = badElement(p.Name().Local)
+	return e
+}
@@ -0,0 +1,232 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	xml "github.com/andaru/flexml"
+	"github.com/andaru/opr8/datastore"
+	"github.com/andaru/opr8/modules"
+	"github.com/andaru/opr8/session"
+	"github.com/andaru/opr8/session/netconf"
+	"github.com/andaru/opr8/transport/transporttest"
+)
+
+const testBaseModule = `module base-test {
+  namespace "urn:base-test"; prefix bt;
+  container system {
+    leaf host-name { type string; }
+    leaf uptime { type uint32; config false; }
+    list user { key name; leaf name { type string; } leaf uid { type uint32; } }
+  }
+}`
+
+// testClient is the client of a NETCONF session.
+type testClient struct {
+	t  *testing.T
+	w  io.Writer
+	d  *xml.Decoder
+	id int
+}
+
+type testReply struct {
+	OK     *struct{} `xml:"ok"`
+	Errors []struct {
+		Tag       string `xml:"error-tag"`
+		SessionID string `xml:"error-info>session-id"`
+	} `xml:"rpc-error"`
+	Data *struct {
+		Content string `xml:",innerxml"`
+	} `xml:"data"`
+}
+
+// String returns the reply's result: "ok", the data, or the error-tag
+// and session-id of its errors.
+func (r testReply) String() string {
+	switch {
+	case r.OK != nil:
+		return "ok"
+	case r.Data != nil:
+		return r.Data.Content
+	}
+	s := ""
+	for _, e := range r.Errors {
+		s += e.Tag + e.SessionID
+	}
+	return s
+}
+
+func newTestClient(t *testing.T, mgr session.Manager) *testClient {
+	t.Helper()
+	client, server := transporttest.Pipe(transporttest.WithUsername("admin"), transporttest.WithKind("ssh"))
+	if _, err := mgr.Accept(context.Background(), server); err != nil {
+		t.Fatal(err)
+	}
+	c := &testClient{t: t, w: client, d: xml.NewDecoder(client)}
+	var hello struct{}
+	if err := c.d.Decode(&hello); err != nil {
+		t.Fatal(err)
+	}
+	c.write(`<hello xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><capabilities><capability>urn:ietf:params:netconf:base:1.0</capability></capabilities></hello>`)
+	return c
+}
+
+func (c *testClient) write(msg string) {
+	c.t.Helper()
+	if _, err := c.w.Write([]byte(msg)); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// rpc sends the operation op and returns the reply.
+func (c *testClient) rpc(op string) string {
+	c.t.Helper()
+	c.id++
+	c.write(fmt.Sprintf(`<rpc xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="%d">%s</rpc>`, c.id, op))
+	var reply testReply
+	if err := c.d.Decode(&reply); err != nil {
+		c.t.Fatal(err)
+	}
+	return reply.String()
+}
+
+func TestBase(t *testing.T) {
+	c := modules.NewCollection()
+	if err := c.ReadString("base-test", testBaseModule); err != nil {
+		t.Fatal(err)
+	}
+	if errs := c.Process(); errs != nil {
+		t.Fatal(errs)
+	}
+	set := datastore.NewSet(datastore.New(datastore.Running, c), datastore.New(datastore.Candidate, c))
+	d := NewDispatcher()
+	mgr := session.NewManager(session.WithAcceptor(netconf.NewAcceptor(c, d)))
+	base := NewBase(set, mgr)
+	base.Register(d)
+	if got, want := base.Capabilities(), []string{CapWritableRunning, CapCandidate, CapValidate}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Capabilities() = %v, want %v", got, want)
+	}
+	a, b := newTestClient(t, mgr), newTestClient(t, mgr)
+
+	const (
+		system    = `<system xmlns="urn:base-test"><host-name>r1</host-name><user><name>alice</name><uid>1</uid></user></system>`
+		hostName  = `<system xmlns="urn:base-test"><host-name>r1</host-name></system>`
+		aliceOnly = `<system xmlns="urn:base-test"><user><name>alice</name><uid>1</uid></user></system>`
+	)
+	for _, tt := range []struct {
+		name   string
+		client *testClient
+		op     string
+		want   string
+	}{
+		{"edit candidate", a, `<edit-config><target><candidate/></target><config>` + system + `</config></edit-config>`, "ok"},
+		{"get-config running before commit", a, `<get-config><source><running/></source></get-config>`, ""},
+		{"commit", a, `<commit/>`, "ok"},
+		{"get-config filtered", a, `<get-config><source><running/></source><filter type="subtree"><system xmlns="urn:base-test"><host-name/></system></filter></get-config>`, hostName},
+		{"get content match", a, `<get><filter><system xmlns="urn:base-test"><user><name>alice</name></user></system></filter></get>`, aliceOnly},
+		{"get xpath filter", a, `<get><filter type="xpath" select="/system"/></get>`, "operation-not-supported"},
+		{"lock", a, `<lock><target><running/></target></lock>`, "ok"},
+		{"lock held", b, `<lock><target><running/></target></lock>`, "lock-denied1"},
+		{"edit locked", b, `<edit-config><target><running/></target><config>` + hostName + `</config></edit-config>`, "in-use"},
+		{"edit create existing", b, `<edit-config><target><candidate/></target><config><system xmlns="urn:base-test"><user xmlns:nc="urn:ietf:params:xml:ns:netconf:base:1.0" nc:operation="create"><name>alice</name></user></system></config></edit-config>`, "data-exists"},
+		{"edit test-only", b, `<edit-config><target><candidate/></target><test-option>test-only</test-option><config><system xmlns="urn:base-test"><host-name>r2</host-name></system></config></edit-config>`, "ok"},
+		{"edit state", b, `<edit-config><target><candidate/></target><config><system xmlns="urn:base-test"><uptime>1</uptime></system></config></edit-config>`, "bad-element"},
+		{"edit continue-on-error", b, `<edit-config><target><candidate/></target><error-option>continue-on-error</error-option><config/></edit-config>`, "operation-not-supported"},
+		{"edit no config", b, `<edit-config><target><candidate/></target></edit-config>`, "missing-element"},
+		{"delete running", b, `<delete-config><target><running/></target></delete-config>`, "invalid-value"},
+		{"unknown datastore", b, `<get-config><source><startup/></source></get-config>`, "invalid-value"},
+		{"validate config", b, `<validate><source><config><system xmlns="urn:base-test"><user><name>bob</name><uid>x</uid></user></system></config></source></validate>`, "invalid-value"},
+		{"validate candidate", b, `<validate><source><candidate/></source></validate>`, "ok"},
+		{"kill self", b, `<kill-session><session-id>2</session-id></kill-session>`, "invalid-value"},
+		{"kill", b, `<kill-session><session-id>1</session-id></kill-session>`, "ok"},
+		{"lock released", b, `<lock><target><running/></target></lock>`, "ok"},
+		{"unlock", b, `<unlock><target><running/></target></unlock>`, "ok"},
+		{"unlock not held", b, `<unlock><target><running/></target></unlock>`, "operation-failed"},
+		{"delete candidate", b, `<delete-config><target><candidate/></target></delete-config>`, "ok"},
+		{"discard-changes", b, `<discard-changes/>`, "ok"},
+		{"get-config candidate", b, `<get-config><source><candidate/></source></get-config>`, system},
+		{"copy-config", b, `<copy-config><target><running/></target><source><config>` + hostName + `</config></source></copy-config>`, "ok"},
+		{"get-config copied", b, `<get-config><source><running/></source></get-config>`, hostName},
+		{"edit delete", b, `<edit-config><target><running/></target><default-operation>none</default-operation><config><system xmlns="urn:base-test"><host-name xmlns:nc="urn:ietf:params:xml:ns:netconf:base:1.0" nc:operation="delete"/></system></config></edit-config>`, "ok"},
+		{"get-config deleted", b, `<get-config><source><running/></source></get-config>`, `<system xmlns="urn:base-test"></system>`},
+		{"close-session", b, `<close-session/>`, "ok"},
+	} {
+		if got := tt.client.rpc(tt.op); got != tt.want {
+			t.Errorf("%s: reply = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+	for start := time.Now(); len(mgr.Sessions()) > 0; time.Sleep(time.Millisecond) {
+		if time.Since(start) > time.Second {
+			t.Fatalf("Manager.Sessions() after close-session = %+v, want none", mgr.Sessions())
+		}
+	}
+}
+
+func TestBaseConfirmedCommit(t *testing.T) {
+	c := modules.NewCollection()
+	if err := c.ReadString("base-test", testBaseModule); err != nil {
+		t.Fatal(err)
+	}
+	if errs := c.Process(); errs != nil {
+		t.Fatal(errs)
+	}
+	running := datastore.New(datastore.Running, c)
+	set := datastore.NewSet(running, datastore.New(datastore.Candidate, c))
+	d := NewDispatcher()
+	mgr := session.NewManager(session.WithAcceptor(netconf.NewAcceptor(c, d)))
+	base := NewBase(set, mgr)
+	base.Register(d)
+	confirmer, err := datastore.NewConfirmer(running, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base.SetConfirmer(confirmer)
+	if got, want := base.Capabilities(), []string{CapWritableRunning, CapCandidate, CapValidate, CapConfirmedCommit}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Capabilities() = %v, want %v", got, want)
+	}
+	a, b := newTestClient(t, mgr), newTestClient(t, mgr)
+
+	const (
+		r1 = `<system xmlns="urn:base-test"><host-name>r1</host-name></system>`
+		r2 = `<system xmlns="urn:base-test"><host-name>r2</host-name></system>`
+	)
+	for _, tt := range []struct {
+		name   string
+		client *testClient
+		op     string
+		want   string
+	}{
+		{"edit candidate", a, `<edit-config><target><candidate/></target><config>` + r1 + `</config></edit-config>`, "ok"},
+		{"confirmed commit", a, `<commit><confirmed/><confirm-timeout>60</confirm-timeout></commit>`, "ok"},
+		{"get-config committed", a, `<get-config><source><running/></source></get-config>`, r1},
+		{"commit by another session", b, `<commit/>`, "in-use"},
+		{"cancel-commit", a, `<cancel-commit/>`, "ok"},
+		{"get-config cancelled", a, `<get-config><source><running/></source></get-config>`, ""},
+		{"bad confirm-timeout", a, `<commit><confirmed/><confirm-timeout>0</confirm-timeout></commit>`, "invalid-value"},
+		{"persistent commit", a, `<commit><confirmed/><persist>p1</persist></commit>`, "ok"},
+		{"commit without persist-id", b, `<commit/>`, "in-use"},
+		{"edit candidate again", b, `<edit-config><target><candidate/></target><config>` + r2 + `</config></edit-config>`, "ok"},
+		{"confirming commit", b, `<commit><persist-id>p1</persist-id></commit>`, "ok"},
+		{"get-config confirmed", b, `<get-config><source><running/></source></get-config>`, r2},
+		{"cancel-commit none pending", b, `<cancel-commit><persist-id>p1</persist-id></cancel-commit>`, "invalid-value"},
+		{"confirmed commit before close", a, `<commit><confirmed/></commit>`, "ok"},
+		{"close-session", a, `<close-session/>`, "ok"},
+	} {
+		if got := tt.client.rpc(tt.op); got != tt.want {
+			t.Errorf("%s: reply = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+	// the commit of the closed session is rolled back
+	for start := time.Now(); confirmer.Pending() != nil; time.Sleep(time.Millisecond) {
+		if time.Since(start) > time.Second {
+			t.Fatal("confirmed commit pending after its session closed")
+		}
+	}
+	if got := b.rpc(`<get-config><source><running/></source></get-config>`); got != r2 {
+		t.Errorf("get-config after rollback = %q, want %q", got, r2)
+	}
+}
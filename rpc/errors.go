@@ -0,0 +1,229 @@
+package rpc
+
+import (
+	"fmt"
+	"strings"
+
+	xml "github.com/andaru/flexml"
+	"github.com/andaru/opr8/datastore"
+	"github.com/andaru/opr8/dom"
+	"github.com/andaru/opr8/session/netconf"
+	"github.com/pkg/errors"
+)
+
+// ErrorType is an RFC 6241 rpc-error error-type value, the protocol
+// layer where an error occurred.
+type ErrorType string
+
+// RFC 6241 error-type values.
+const (
+	ErrorTypeTransport   ErrorType = "transport"
+	ErrorTypeRPC         ErrorType = "rpc"
+	ErrorTypeProtocol    ErrorType = "protocol"
+	ErrorTypeApplication ErrorType = "application"
+)
+
+// ErrorTag is an RFC 6241 rpc-error error-tag value, identifying the
+// error condition.
+type ErrorTag string
+
+// RFC 6241 error-tag values (RFC 6241 appendix A).
+const (
+	ErrorTagInUse                 ErrorTag = "in-use"
+	ErrorTagInvalidValue          ErrorTag = "invalid-value"
+	ErrorTagTooBig                ErrorTag = "too-big"
+	ErrorTagMissingAttribute      ErrorTag = "missing-attribute"
+	ErrorTagBadAttribute          ErrorTag = "bad-attribute"
+	ErrorTagUnknownAttribute      ErrorTag = "unknown-attribute"
+	ErrorTagMissingElement        ErrorTag = "missing-element"
+	ErrorTagBadElement            ErrorTag = "bad-element"
+	ErrorTagUnknownElement        ErrorTag = "unknown-element"
+	ErrorTagUnknownNamespace      ErrorTag = "unknown-namespace"
+	ErrorTagAccessDenied          ErrorTag = "access-denied"
+	ErrorTagLockDenied            ErrorTag = "lock-denied"
+	ErrorTagResourceDenied        ErrorTag = "resource-denied"
+	ErrorTagRollbackFailed        ErrorTag = "rollback-failed"
+	ErrorTagDataExists            ErrorTag = "data-exists"
+	ErrorTagDataMissing           ErrorTag = "data-missing"
+	ErrorTagOperationNotSupported ErrorTag = "operation-not-supported"
+	ErrorTagOperationFailed       ErrorTag = "operation-failed"
+	ErrorTagMalformedMessage      ErrorTag = "malformed-message"
+)
+
+// ErrorInfo is an rpc-error error-info child element, such as
+// bad-element or session-id.
+type ErrorInfo struct {
+	// Name is the element name; names without a namespace are in the
+	// NETCONF base namespace.
+	Name  xml.Name
+	Value string
+}
+
+// RPCError is an RFC 6241 <rpc-error>. Handlers return it, or errors
+// wrapping it, to describe the error in the reply; it implements
+// netconf.ReplyError.
+type RPCError struct {
+	Type     ErrorType
+	Tag      ErrorTag
+	Severity datastore.ErrorSeverity
+	// AppTag is the optional error-app-tag, e.g., "instance-required".
+	AppTag string
+	// Path is the optional error-path, the data node the error is
+	// associated with.
+	Path    string
+	Message string
+	Info    []ErrorInfo
+
+	// Err is the underlying cause of the error, if any.
+	Err error
+}
+
+// NewError returns an error of the type and tag, with the message
+// formatted as for fmt.Sprintf.
+func NewError(errorType ErrorType, tag ErrorTag, format string, args ...interface{}) *RPCError {
+	return &RPCError{Type: errorType, Tag: tag, Message: fmt.Sprintf(format, args...)}
+}
+
+// FromDecodeError returns the application error describing the YANG
+// data error de.
+func FromDecodeError(de *datastore.DecodeError) *RPCError {
+	e := &RPCError{
+		Type:     ErrorTypeApplication,
+		Tag:      ErrorTag(de.Tag),
+		Severity: de.Severity,
+		AppTag:   de.AppTag,
+		Path:     de.Path,
+		Message:  de.Error(),
+		Err:      de,
+	}
+	if de.Element != "" {
+		e.Info = badElement(de.Element)
+	}
+	return e
+}
+
+// FromValidation returns an ErrorList with an error for each of those
+// of the validation report r, or nil if r is valid. Warnings are
+// included with the errors.
+func FromValidation(r *datastore.ValidationReport) error {
+	if r.Valid() {
+		return nil
+	}
+	list := make(ErrorList, 0, len(r.Errors))
+	for _, de := range r.Errors {
+		list = append(list, FromDecodeError(de))
+	}
+	return list
+}
+
+// FromError returns err, if it is nil or is or wraps a
+// netconf.ReplyError, an *RPCError describing the
+// *datastore.DecodeError err wraps, with err's text as the message, or
+// otherwise err, reported as an operation-failed error.
+func FromError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var re netconf.ReplyError
+	if errors.As(err, &re) {
+		return err
+	}
+	var de *datastore.DecodeError
+	if errors.As(err, &de) {
+		e := FromDecodeError(de)
+		e.Message, e.Err = err.Error(), err
+		return e
+	}
+	return err
+}
+
+func (e *RPCError) Error() string { return e.Message }
+
+// Cause returns the underlying cause of the error, if any.
+func (e *RPCError) Cause() error { return e.Err }
+
+// Unwrap returns the underlying cause of the error, if any.
+func (e *RPCError) Unwrap() error { return e.Err }
+
+// Element returns the error's <rpc-error> element.
+func (e *RPCError) Element() dom.Element {
+	rpcError := dom.CreateElement(xml.StartElement{Name: xml.Name{Space: netconf.BaseNamespace, Local: "rpc-error"}})
+	appendElement(rpcError, "error-type", string(e.Type))
+	appendElement(rpcError, "error-tag", string(e.Tag))
+	appendElement(rpcError, "error-severity", e.Severity.String())
+	if e.AppTag != "" {
+		appendElement(rpcError, "error-app-tag", e.AppTag)
+	}
+	if e.Path != "" {
+		appendElement(rpcError, "error-path", e.Path)
+	}
+	if e.Message != "" {
+		appendElement(rpcError, "error-message", e.Message)
+	}
+	if len(e.Info) > 0 {
+		info := appendElement(rpcError, "error-info", "")
+		for _, child := range e.Info {
+			name := child.Name
+			if name.Space == "" {
+				name.Space = netconf.BaseNamespace
+			}
+			c := dom.CreateElement(xml.StartElement{Name: name})
+			if child.Value != "" {
+				_ = c.AppendChild(dom.CreateText(xml.CharData(child.Value)))
+			}
+			_ = info.AppendChild(c)
+		}
+	}
+	return rpcError
+}
+
+// RPCErrors returns the error's <rpc-error> element.
+func (e *RPCError) RPCErrors() []dom.Element { return []dom.Element{e.Element()} }
+
+// ErrorList is a list of errors reported together, such as those
+// found by validation.
+type ErrorList []*RPCError
+
+func (l ErrorList) Error() string {
+	switch len(l) {
+	case 0:
+		return "no errors"
+	case 1:
+		return l[0].Error()
+	}
+	msgs := make([]string, len(l))
+	for i, e := range l {
+		msgs[i] = e.Error()
+	}
+	return fmt.Sprintf("%d errors: %s", len(l), strings.Join(msgs, "; "))
+}
+
+// RPCErrors returns the <rpc-error> elements of the errors.
+func (l ErrorList) RPCErrors() []dom.Element {
+	elements := make([]dom.Element, len(l))
+	for i, e := range l {
+		elements[i] = e.Element()
+	}
+	return elements
+}
+
+// badElement returns the error-info of an error in the element.
+func badElement(name string) []ErrorInfo {
+	return []ErrorInfo{{Name: xml.Name{Local: "bad-element"}, Value: name}}
+}
+
+// appendElement appends a NETCONF base element named local to parent,
+// with the text value, if not empty, and returns it.
+func appendElement(parent dom.Node, local, value string) dom.Node {
+	e := dom.CreateElement(xml.StartElement{Name: xml.Name{Space: netconf.BaseNamespace, Local: local}})
+	if value != "" {
+		_ = e.AppendChild(dom.CreateText(xml.CharData(value)))
+	}
+	_ = parent.AppendChild(e)
+	return parent.LastChild()
+}
+
+var (
+	_ netconf.ReplyError = &RPCError{}
+	_ netconf.ReplyError = ErrorList{}
+)
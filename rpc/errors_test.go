@@ -0,0 +1,109 @@
+package rpc
+
+import (
+	"testing"
+
+	xml "github.com/andaru/flexml"
+	"github.com/andaru/opr8/datastore"
+	"github.com/pkg/errors"
+)
+
+func TestRPCError_Element(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		err  *RPCError
+		want string
+	}{
+		{
+			name: "minimal",
+			err:  &RPCError{Type: ErrorTypeRPC, Tag: ErrorTagMissingElement},
+			want: `<rpc-error xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><error-type>rpc</error-type><error-tag>missing-element</error-tag><error-severity>error</error-severity></rpc-error>`,
+		},
+		{
+			name: "all",
+			err: &RPCError{
+				Type:     ErrorTypeApplication,
+				Tag:      ErrorTagDataMissing,
+				Severity: datastore.SeverityWarning,
+				AppTag:   "instance-required",
+				Path:     "/m:system/m:peer",
+				Message:  "no such peer",
+				Info: []ErrorInfo{
+					{Name: xml.Name{Local: "bad-element"}, Value: "peer"},
+					{Name: xml.Name{Space: "urn:x", Local: "hint"}, Value: "add it"},
+				},
+			},
+			want: `<rpc-error xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><error-type>application</error-type><error-tag>data-missing</error-tag>` +
+				`<error-severity>warning</error-severity><error-app-tag>instance-required</error-app-tag><error-path>/m:system/m:peer</error-path>` +
+				`<error-message>no such peer</error-message><error-info><bad-element>peer</bad-element><hint xmlns="urn:x">add it</hint></error-info></rpc-error>`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			elements := tt.err.RPCErrors()
+			if len(elements) != 1 {
+				t.Fatalf("RPCErrors() = %d elements, want 1", len(elements))
+			}
+			if got := testMarshal(t, elements[0]); got != tt.want {
+				t.Errorf("RPCErrors() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFromError(t *testing.T) {
+	de := &datastore.DecodeError{Path: "/m:system/port", Element: "port", Tag: datastore.ErrorTagInvalidValue, AppTag: "range", Message: "out of range"}
+	lockDenied := NewError(ErrorTypeProtocol, ErrorTagLockDenied, "locked")
+	other := errors.New("disk full")
+
+	if got := FromError(nil); got != nil {
+		t.Errorf("FromError(nil) = %v, want nil", got)
+	}
+	if got := FromError(other); got != other {
+		t.Errorf("FromError(other) = %v, want %v", got, other)
+	}
+	wrapped := errors.Wrap(lockDenied, "lock")
+	if got := FromError(wrapped); got != wrapped {
+		t.Errorf("FromError(wrapped RPCError) = %v, want %v", got, wrapped)
+	}
+
+	got, ok := FromError(errors.Wrap(de, "edit failed")).(*RPCError)
+	if !ok {
+		t.Fatalf("FromError(DecodeError) is not an *RPCError")
+	}
+	want := RPCError{Type: ErrorTypeApplication, Tag: ErrorTagInvalidValue, AppTag: "range", Path: "/m:system/port", Message: "edit failed: out of range"}
+	if got.Type != want.Type || got.Tag != want.Tag || got.AppTag != want.AppTag || got.Path != want.Path || got.Message != want.Message {
+		t.Errorf("FromError(DecodeError) = %+v, want %+v", got, want)
+	}
+	if len(got.Info) != 1 || got.Info[0].Value != "port" {
+		t.Errorf("FromError(DecodeError).Info = %v, want bad-element port", got.Info)
+	}
+	var cause *datastore.DecodeError
+	if !errors.As(got, &cause) || cause != de {
+		t.Errorf("FromError(DecodeError) does not wrap the DecodeError")
+	}
+}
+
+func TestFromValidation(t *testing.T) {
+	if err := FromValidation(&datastore.ValidationReport{}); err != nil {
+		t.Errorf("FromValidation(valid) = %v, want nil", err)
+	}
+	report := &datastore.ValidationReport{Errors: []*datastore.DecodeError{
+		{Element: "a", Tag: datastore.ErrorTagMissingElement, Message: "a is missing"},
+		{Element: "b", Tag: datastore.ErrorTagInvalidValue, Severity: datastore.SeverityWarning, Message: "b is odd"},
+	}}
+	err := FromValidation(report)
+	list, ok := err.(ErrorList)
+	if !ok || len(list) != 2 {
+		t.Fatalf("FromValidation() = %#v, want an ErrorList of 2", err)
+	}
+	if got, want := err.Error(), "2 errors: a is missing; b is odd"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+	var tags []string
+	for _, e := range list.RPCErrors() {
+		tags = append(tags, e.ChildByName(xml.Name{Space: e.Name().Space, Local: "error-tag"}).ChildValue())
+	}
+	if len(tags) != 2 || tags[0] != "missing-element" || tags[1] != "invalid-value" {
+		t.Errorf("RPCErrors() error-tags = %v, want [missing-element invalid-value]", tags)
+	}
+}
@@ -0,0 +1,110 @@
+package rpc
+
+import (
+	"strings"
+
+	"github.com/andaru/opr8/dom"
+)
+
+// SubtreeFilter returns a document with copies of the data selected
+// from the data tree root by the <filter> element f, as NETCONF
+// subtree filtering does (RFC 6241 section 6). Filter elements without
+// a namespace match data elements in any namespace.
+func SubtreeFilter(root, f dom.Node) dom.Document {
+	out := dom.NewDocument(nil)
+	for it := root.FirstChild(); it != nil; it = it.NextSibling() {
+		if it.NodeType() != dom.NodeTypeElement {
+			continue
+		}
+		for _, fc := range elementChildren(f) {
+			if !filterMatches(fc, it) {
+				continue
+			}
+			if n, ok := filterSubtree(it, fc); ok {
+				_ = out.AppendChild(n)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// filterSubtree returns a copy of the data node n, matched by the
+// filter node f, with the descendants f selects, and true if f selects
+// it.
+func filterSubtree(n, f dom.Node) (dom.Node, bool) {
+	var contents, others []dom.Node
+	for _, fc := range elementChildren(f) {
+		if isContentMatch(fc) {
+			contents = append(contents, fc)
+		} else {
+			others = append(others, fc)
+		}
+	}
+	// every content match node must match a child of n
+	matched := map[dom.Node]bool{}
+	for _, fc := range contents {
+		found := false
+		for _, child := range elementChildren(n) {
+			if filterMatches(fc, child) && strings.TrimSpace(child.ChildValue()) == strings.TrimSpace(fc.ChildValue()) {
+				matched[child] = true
+				found = true
+			}
+		}
+		if !found {
+			return nil, false
+		}
+	}
+	if len(others) == 0 {
+		// a selection node, or content match nodes only, selects the
+		// whole subtree
+		return dom.CloneNode(n, true), true
+	}
+
+	out := dom.CloneNode(n, false)
+	selected := false
+	for _, child := range elementChildren(n) {
+		if matched[child] {
+			_ = out.AppendChild(dom.CloneNode(child, true))
+			continue
+		}
+		for _, fc := range others {
+			if !filterMatches(fc, child) {
+				continue
+			}
+			if c, ok := filterSubtree(child, fc); ok {
+				_ = out.AppendChild(c)
+				selected = true
+				break
+			}
+		}
+	}
+	if !selected && len(contents) == 0 {
+		return nil, false
+	}
+	return out, true
+}
+
+// filterMatches returns true if the filter node f matches the data
+// node n: they have the same local name, and the same namespace unless
+// f has none.
+func filterMatches(f, n dom.Node) bool {
+	return f.Name().Local == n.Name().Local && (f.Name().Space == "" || f.Name().Space == n.Name().Space)
+}
+
+// isContentMatch returns true if the filter node f is a content match
+// node, a leaf with a value.
+func isContentMatch(f dom.Node) bool {
+	return len(elementChildren(f)) == 0 && strings.TrimSpace(f.ChildValue()) != ""
+}
+
+// elementChildren returns the element children of n.
+func elementChildren(n dom.Node) []dom.Node {
+	var children []dom.Node
+	for it := n.FirstChild(); it != nil; it = it.NextSibling() {
+		if it.NodeType() == dom.NodeTypeElement {
+			children = append(children, it)
+		}
+	}
+	return children
+}
@@ -0,0 +1,233 @@
+/*
+Package rpc has the NETCONF RPC dispatcher, a netconf.Handler passing
+the operation of each <rpc> to the Handler registered for the
+operation's element name.
+
+The NETCONF session reads <rpc> messages from its transport, replying
+to those without a message-id attribute with an error, and writes the
+<rpc-reply> to each, echoing the <rpc>'s attributes. A Dispatcher
+passed to netconf.NewAcceptor reports <rpc> elements without exactly
+one operation, and operations with no handler registered, in the
+<rpc-error> elements of the reply:
+
+	d := rpc.NewDispatcher()
+	d.HandleFunc(xml.Name{Space: netconf.BaseNamespace, Local: "get"}, get)
+	acc := netconf.NewAcceptor(c, d)
+
+Base has the handlers of the base NETCONF operations, such as
+get-config, edit-config and lock, on the datastores of a
+datastore.Set, registered with a Dispatcher by Base.Register.
+
+An Authorizer set on the Dispatcher, such as the NACM enforcer of the
+nacm package, controls the operations each user may invoke, and the
+data read and written by Base.
+
+Handlers describe errors with an RPCError, or an ErrorList of them,
+reported in the <rpc-error> elements of the reply. FromError converts
+the YANG data errors of the datastore package, and FromValidation the
+errors of a validation report.
+*/
+package rpc
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	xml "github.com/andaru/flexml"
+	"github.com/andaru/opr8/dom"
+	"github.com/andaru/opr8/metrics"
+	"github.com/andaru/opr8/session/netconf"
+	"github.com/pkg/errors"
+)
+
+// Handler is the interface to NETCONF operation handlers.
+type Handler interface {
+	// HandleOperation handles the operation element op, the child of
+	// an <rpc> received on the session s, returning the content of
+	// the <rpc-reply> as a netconf.Handler does.
+	HandleOperation(ctx context.Context, s *netconf.Session, op dom.Node) ([]dom.Node, error)
+}
+
+// HandlerFunc is an adapter allowing the use of functions as a
+// Handler.
+type HandlerFunc func(ctx context.Context, s *netconf.Session, op dom.Node) ([]dom.Node, error)
+
+// HandleOperation calls f(ctx, s, op).
+func (f HandlerFunc) HandleOperation(ctx context.Context, s *netconf.Session, op dom.Node) ([]dom.Node, error) {
+	return f(ctx, s, op)
+}
+
+// Dispatcher passes NETCONF operations to the handlers registered for
+// their element names. It implements netconf.Handler, and is safe for
+// concurrent use.
+type Dispatcher struct {
+	mu         sync.RWMutex
+	handlers   map[xml.Name]Handler
+	authorizer Authorizer
+	metrics    metrics.Registry
+}
+
+// NewDispatcher returns a new Dispatcher with no handlers registered.
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{handlers: map[xml.Name]Handler{}, metrics: metrics.Discard()}
+}
+
+// Handle registers the handler for operations with the element name,
+// replacing any registered, or removes the handler registered if h is
+// nil.
+func (d *Dispatcher) Handle(name xml.Name, h Handler) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if h == nil {
+		delete(d.handlers, name)
+		return
+	}
+	d.handlers[name] = h
+}
+
+// HandleFunc registers the function f as the handler for operations
+// with the element name.
+func (d *Dispatcher) HandleFunc(name xml.Name, f func(ctx context.Context, s *netconf.Session, op dom.Node) ([]dom.Node, error)) {
+	d.Handle(name, HandlerFunc(f))
+}
+
+// Handler returns the handler registered for operations with the
+// element name, or nil if there is none.
+func (d *Dispatcher) Handler(name xml.Name) Handler {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.handlers[name]
+}
+
+// Operations returns the element names of the operations with handlers
+// registered, sorted by namespace and local name.
+func (d *Dispatcher) Operations() []xml.Name {
+	d.mu.RLock()
+	names := make([]xml.Name, 0, len(d.handlers))
+	for name := range d.handlers {
+		names = append(names, name)
+	}
+	d.mu.RUnlock()
+	sort.Slice(names, func(i, j int) bool {
+		if names[i].Space != names[j].Space {
+			return names[i].Space < names[j].Space
+		}
+		return names[i].Local < names[j].Local
+	})
+	return names
+}
+
+// SetAuthorizer sets the Authorizer of the operations dispatched, and
+// of the data read and written by the handlers of Base, or removes it
+// if a is nil.
+func (d *Dispatcher) SetAuthorizer(a Authorizer) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.authorizer = a
+}
+
+// Authorizer returns the Authorizer set, or nil.
+func (d *Dispatcher) Authorizer() Authorizer {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.authorizer
+}
+
+// SetMetrics sets the registry reporting the operations dispatched,
+// those failing, by error-tag, and their latencies, labelled by
+// operation name, or stops reporting them if r is nil.
+func (d *Dispatcher) SetMetrics(r metrics.Registry) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.metrics = metrics.OrDiscard(r)
+}
+
+// HandleRPC passes the operation of the <rpc> element rpc to the
+// handler registered for it. An rpc-error is returned if the rpc does
+// not contain exactly one operation element, if no handler is
+// registered for its operation, or if the Authorizer does not permit
+// the session's user to invoke it.
+func (d *Dispatcher) HandleRPC(ctx context.Context, s *netconf.Session, rpc dom.Element) ([]dom.Node, error) {
+	start := time.Now()
+	d.mu.RLock()
+	r := d.metrics
+	d.mu.RUnlock()
+	op, err := operation(rpc)
+	if err != nil {
+		d.observe(r, "", start, err)
+		return nil, err
+	}
+	name := op.Name().Local
+	h := d.Handler(op.Name())
+	if h == nil {
+		err := NewError(ErrorTypeProtocol, ErrorTagOperationNotSupported, "operation %s in namespace %s is not supported", op.Name().Local, op.Name().Space)
+		// unsupported operations are not labelled by name, which the
+		// client chooses
+		d.observe(r, "", start, err)
+		return nil, err
+	}
+	if a := d.Authorizer(); a != nil {
+		if err := a.AuthorizeOperation(s.Username(), op.Name()); err != nil {
+			d.observe(r, name, start, err)
+			return nil, err
+		}
+	}
+	reply, err := h.HandleOperation(ctx, s, op)
+	d.observe(r, name, start, err)
+	return reply, err
+}
+
+// observe reports an operation named name, dispatched at start and
+// returning err, to the registry r.
+func (d *Dispatcher) observe(r metrics.Registry, name string, start time.Time, err error) {
+	r.Counter("rpc_requests_total", "Operations dispatched.", "operation", name).Add(1)
+	if err != nil {
+		r.Counter("rpc_errors_total", "Operations failed.", "operation", name, "tag", string(errorTag(err))).Add(1)
+	}
+	metrics.ObserveSince(r.Histogram("rpc_duration_seconds", "Latency of operations.", nil, "operation", name), start)
+}
+
+// errorTag returns the error-tag of the first error of err, or
+// operation-failed if it is not an RPCError or ErrorList.
+func errorTag(err error) ErrorTag {
+	var e *RPCError
+	var l ErrorList
+	switch {
+	case errors.As(err, &e):
+		return e.Tag
+	case errors.As(err, &l) && len(l) > 0:
+		return l[0].Tag
+	}
+	return ErrorTagOperationFailed
+}
+
+// operation returns the operation element of the <rpc> element rpc.
+func operation(rpc dom.Element) (dom.Node, error) {
+	var op dom.Node
+	for n := rpc.FirstChild(); n != nil; n = n.NextSibling() {
+		switch n.NodeType() {
+		case dom.NodeTypeElement:
+			if op != nil {
+				e := NewError(ErrorTypeRPC, ErrorTagUnknownElement, "rpc has more than one operation")
+				e.Info = badElement(n.Name().Local)
+				return nil, e
+			}
+			op = n
+		case dom.NodeTypeText:
+			if strings.TrimSpace(n.Value()) != "" {
+				e := NewError(ErrorTypeRPC, ErrorTagBadElement, "rpc contains text")
+				e.Info = badElement("rpc")
+				return nil, e
+			}
+		}
+	}
+	if op == nil {
+		return nil, NewError(ErrorTypeRPC, ErrorTagMissingElement, "rpc has no operation")
+	}
+	return op, nil
+}
+
+var _ netconf.Handler = &Dispatcher{}
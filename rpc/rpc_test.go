@@ -0,0 +1,185 @@
+package rpc
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	xml "github.com/andaru/flexml"
+	"github.com/andaru/opr8/dom"
+	"github.com/andaru/opr8/metrics"
+	"github.com/andaru/opr8/session/netconf"
+	"github.com/andaru/opr8/transport/transporttest"
+)
+
+// testElement returns the document element of the XML document s.
+func testElement(t *testing.T, s string) dom.Element {
+	t.Helper()
+	doc := dom.NewDocument(nil)
+	if _, err := dom.NewUnmarshaler(dom.NewBuilder(doc, dom.WithTrimPCData())).XMLReader().ReadFrom(strings.NewReader(s)); err != nil {
+		t.Fatal(err)
+	}
+	return doc.DocumentElement()
+}
+
+// testMarshal returns the XML encoding of the nodes.
+func testMarshal(t *testing.T, nodes ...dom.Node) string {
+	t.Helper()
+	var b strings.Builder
+	for _, n := range nodes {
+		if _, err := dom.NewMarshaler(n).XMLWriter().WriteTo(&b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return b.String()
+}
+
+var (
+	testGet  = xml.Name{Space: netconf.BaseNamespace, Local: "get"}
+	testPing = xml.Name{Space: "urn:test", Local: "ping"}
+)
+
+func testDispatcher() *Dispatcher {
+	d := NewDispatcher()
+	d.HandleFunc(testGet, func(ctx context.Context, s *netconf.Session, op dom.Node) ([]dom.Node, error) {
+		return []dom.Node{dom.CreateElement(xml.StartElement{Name: xml.Name{Space: netconf.BaseNamespace, Local: "data"}})}, nil
+	})
+	d.HandleFunc(testPing, func(ctx context.Context, s *netconf.Session, op dom.Node) ([]dom.Node, error) {
+		return nil, nil
+	})
+	return d
+}
+
+func TestDispatcher(t *testing.T) {
+	d := testDispatcher()
+	r := metrics.NewExpvar()
+	d.SetMetrics(r)
+	if got, want := d.Operations(), []xml.Name{testGet, testPing}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Operations() = %v, want %v", got, want)
+	}
+	for _, tt := range []struct {
+		name      string
+		rpc       string
+		want      string
+		wantTag   string
+		wantError string
+	}{
+		{
+			name: "get",
+			rpc:  `<rpc xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="1"> <get/> </rpc>`,
+			want: `<data xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"></data>`,
+		},
+		{
+			name: "ping",
+			rpc:  `<rpc xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="2"><ping xmlns="urn:test"/></rpc>`,
+		},
+		{
+			name:      "unknown namespace",
+			rpc:       `<rpc xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="3"><get xmlns="urn:other"/></rpc>`,
+			wantTag:   "operation-not-supported",
+			wantError: "<error-type>protocol</error-type>",
+		},
+		{
+			name:    "no operation",
+			rpc:     `<rpc xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="4"/>`,
+			wantTag: "missing-element",
+		},
+		{
+			name:      "two operations",
+			rpc:       `<rpc xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="5"><get/><ping xmlns="urn:test"/></rpc>`,
+			wantTag:   "unknown-element",
+			wantError: "<bad-element>ping</bad-element>",
+		},
+		{
+			name:    "text",
+			rpc:     `<rpc xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="6">get</rpc>`,
+			wantTag: "bad-element",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			nodes, err := d.HandleRPC(context.Background(), nil, testElement(t, tt.rpc))
+			if tt.wantTag == "" {
+				if err != nil {
+					t.Fatalf("HandleRPC() error = %v", err)
+				}
+				if got := testMarshal(t, nodes...); got != tt.want {
+					t.Errorf("HandleRPC() = %s, want %s", got, tt.want)
+				}
+				return
+			}
+			re, ok := err.(netconf.ReplyError)
+			if !ok {
+				t.Fatalf("HandleRPC() error = %v, want a netconf.ReplyError", err)
+			}
+			var rpcErrors []dom.Node
+			for _, e := range re.RPCErrors() {
+				rpcErrors = append(rpcErrors, e)
+			}
+			got := testMarshal(t, rpcErrors...)
+			if !strings.Contains(got, "<error-tag>"+tt.wantTag+"</error-tag>") || !strings.Contains(got, tt.wantError) {
+				t.Errorf("HandleRPC() rpc-error = %s, want tag %q containing %q", got, tt.wantTag, tt.wantError)
+			}
+		})
+	}
+
+	for key, want := range map[string]float64{
+		`rpc_requests_total{operation="get"}`:                             1,
+		`rpc_requests_total{operation="ping"}`:                            1,
+		`rpc_requests_total{operation=""}`:                                4,
+		`rpc_errors_total{operation="",tag="operation-not-supported"}`:    1,
+		`rpc_errors_total{operation="",tag="missing-element"}`:            1,
+		`rpc_errors_total{operation="get",tag="operation-not-supported"}`: 0,
+	} {
+		if got, _ := r.Value(key); got != want {
+			t.Errorf("%s = %v, want %v", key, got, want)
+		}
+	}
+
+	d.Handle(testPing, nil)
+	if h := d.Handler(testPing); h != nil {
+		t.Errorf("Handler() of a removed handler = %v, want nil", h)
+	}
+}
+
+func TestDispatcher_session(t *testing.T) {
+	client, server := transporttest.Pipe(transporttest.WithUsername("admin"))
+	s, err := netconf.NewAcceptor(nil, testDispatcher()).Accept(context.Background(), server, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.(*netconf.Session).Kill(nil)
+	d := xml.NewDecoder(client)
+	var hello struct{}
+	if err := d.Decode(&hello); err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range []string{
+		`<hello xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><capabilities><capability>urn:ietf:params:netconf:base:1.0</capability></capabilities></hello>`,
+		`<rpc xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="7"><ping xmlns="urn:test"/></rpc>`,
+		`<rpc xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="8"><kill-session/></rpc>`,
+	} {
+		if _, err := client.Write([]byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, want := range []struct {
+		messageID, tag string
+		ok             bool
+	}{
+		{messageID: "7", ok: true},
+		{messageID: "8", tag: "operation-not-supported"},
+	} {
+		var reply struct {
+			MessageID string    `xml:"message-id,attr"`
+			OK        *struct{} `xml:"ok"`
+			Tag       string    `xml:"rpc-error>error-tag"`
+		}
+		if err := d.Decode(&reply); err != nil {
+			t.Fatal(err)
+		}
+		if reply.MessageID != want.messageID || (reply.OK != nil) != want.ok || reply.Tag != want.tag {
+			t.Errorf("reply = message-id %q, ok %v, error-tag %q, want %q, %v, %q", reply.MessageID, reply.OK != nil, reply.Tag, want.messageID, want.ok, want.tag)
+		}
+	}
+}
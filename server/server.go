@@ -0,0 +1,695 @@
+/*
+Package server assembles a network management server from a Config:
+the datastores of a module collection, the session manager, and the
+NETCONF, RESTCONF and gNMI frontends serving them.
+
+	srv, err := server.New(server.Config{
+		Modules:    c,
+		Datastores: server.DatastoreConfig{Candidate: true, History: 16},
+		NACM:       &server.NACMConfig{RecoveryUser: "root"},
+		NETCONF:    &server.NETCONFConfig{SSH: sshConfig},
+		RESTCONF:   &server.RESTCONFConfig{TLS: tlsConfig, CertMapper: certToName},
+	})
+	if err != nil {
+		...
+	}
+	go srv.Run(ctx)
+	...
+	srv.Shutdown(ctx)
+
+NETCONF sessions have the base operations of the rpc package, RFC 5277
+event notifications and YANG-Push subscriptions, on the running
+datastore and the optional candidate, startup and factory-default
+datastores. RESTCONF and gNMI serve the running datastore. If NACM is
+configured, the access control configuration of the running datastore
+is enforced by every frontend, and on event notifications and YANG-Push
+updates.
+
+The parts of the Server, such as its Dispatcher and Broker, are
+available for further operations and event streams to be added before
+it is run.
+*/
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/andaru/opr8/audit"
+	"github.com/andaru/opr8/datastore"
+	"github.com/andaru/opr8/gnmi"
+	"github.com/andaru/opr8/log"
+	"github.com/andaru/opr8/metrics"
+	"github.com/andaru/opr8/modules"
+	"github.com/andaru/opr8/nacm"
+	"github.com/andaru/opr8/notification"
+	"github.com/andaru/opr8/restconf"
+	"github.com/andaru/opr8/rpc"
+	"github.com/andaru/opr8/session"
+	gnmisession "github.com/andaru/opr8/session/gnmi"
+	"github.com/andaru/opr8/session/netconf"
+	restconfsession "github.com/andaru/opr8/session/restconf"
+	"github.com/andaru/opr8/transport"
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// Default addresses of the frontends.
+const (
+	// DefaultNETCONFAddr is the address of the NETCONF over SSH port
+	// (RFC 6242).
+	DefaultNETCONFAddr = ":830"
+	// DefaultRESTCONFAddr is the address of the HTTPS port.
+	DefaultRESTCONFAddr = ":443"
+	// DefaultGNMIAddr is the address of the gNMI port registered with
+	// IANA.
+	DefaultGNMIAddr = ":9339"
+)
+
+// ErrShutdown is the error the sessions of a Server are terminated
+// with when it stops.
+var ErrShutdown = errors.New("server shutdown")
+
+// Config is the configuration of a Server. Frontends are served if
+// their configuration is set.
+type Config struct {
+	// Modules is the processed module collection of the datastores'
+	// schema.
+	Modules *modules.Collection
+	// Datastores configures the datastores.
+	Datastores DatastoreConfig
+	// Sessions configures the session manager.
+	Sessions SessionConfig
+	// NACM, if not nil, enforces the access control configuration of
+	// the running datastore (RFC 8341).
+	NACM *NACMConfig
+	// Audit, if not nil, records the commits to the datastores in an
+	// audit log.
+	Audit *AuditConfig
+	// Metrics is the registry reporting the metrics of the sessions,
+	// datastores and operations, metrics.Default() if nil.
+	Metrics metrics.Registry
+	// Logger, if not nil, logs the events of the datastores, the SSH
+	// server and the sessions.
+	Logger log.Logger
+
+	NETCONF  *NETCONFConfig
+	RESTCONF *RESTCONFConfig
+	GNMI     *GNMIConfig
+}
+
+// DatastoreConfig configures the datastores of a Server, which always
+// has the running datastore.
+type DatastoreConfig struct {
+	// Candidate and Startup add the candidate and startup datastores.
+	Candidate, Startup bool
+	// FactoryDefault, if not nil, builds the content of the
+	// factory-default datastore, with which the other datastores are
+	// initialized.
+	FactoryDefault datastore.Builder
+	// History is the number of revisions of the running datastore's
+	// commit history kept for rollback, none if zero.
+	History int
+	// Validate enables the validation of commits to the running and
+	// startup datastores, with the custom Validators, if not nil, in
+	// addition to the standard checks.
+	Validate   bool
+	Validators *datastore.Validators
+	// ConfirmedCommitFile, if not empty, is the file a pending
+	// confirmed commit is stored in, so that a restart during its
+	// confirmation window restores it. Confirmed commits require the
+	// candidate datastore.
+	ConfirmedCommitFile string
+}
+
+// SessionConfig configures the session manager of a Server. Zero
+// values set no limit.
+type SessionConfig struct {
+	// IdleTimeout and MaxLifetime limit the duration of sessions.
+	IdleTimeout, MaxLifetime time.Duration
+	// AcceptQueue limits the sessions being accepted at once; further
+	// sessions are rejected.
+	AcceptQueue int
+}
+
+// NACMConfig configures the NETCONF access control model.
+type NACMConfig struct {
+	// RecoveryUser, if not empty, is the user access control does not
+	// apply to.
+	RecoveryUser string
+	// ExternalGroups, if not nil, provides the groups of users from
+	// outside the configuration.
+	ExternalGroups func(user string) []string
+}
+
+// AuditConfig configures the audit log of configuration changes.
+type AuditConfig struct {
+	// Sinks are written each record.
+	Sinks []audit.Sink
+	// Patch records the new values of the data changed, in addition
+	// to their paths.
+	Patch bool
+	// Size is the number of records kept to be queried,
+	// audit.DefaultSize if zero.
+	Size int
+}
+
+// NETCONFConfig configures the NETCONF over SSH frontend.
+type NETCONFConfig struct {
+	// Addr is the address listened on, DefaultNETCONFAddr if empty.
+	Addr string
+	// Listener, if not nil, is served instead of listening on Addr.
+	Listener net.Listener
+	// SSH is the configuration of the SSH server.
+	SSH transport.SSHServerConfig
+	// Capabilities are capability URIs advertised in addition to
+	// those of the Server's operations.
+	Capabilities []string
+}
+
+// RESTCONFConfig configures the RESTCONF frontend.
+type RESTCONFConfig struct {
+	// Addr is the address listened on, DefaultRESTCONFAddr if empty.
+	Addr string
+	// Listener, if not nil, is served instead of listening on Addr.
+	Listener net.Listener
+	// Root is the path of the API root resource, restconf.DefaultRoot
+	// if empty.
+	Root string
+	// TLS, if not nil, serves HTTPS with the configuration, as
+	// RESTCONF requires; otherwise HTTP is served.
+	TLS *tls.Config
+	// Username returns the authenticated user of each request. If nil,
+	// users are mapped by CertMapper from their TLS client
+	// certificates.
+	Username func(*http.Request) string
+	// CertMapper maps client certificates to usernames.
+	CertMapper transport.CertMapper
+}
+
+// GNMIConfig configures the gNMI frontend.
+type GNMIConfig struct {
+	// Addr is the address listened on, DefaultGNMIAddr if empty.
+	Addr string
+	// Listener, if not nil, is served instead of listening on Addr.
+	Listener net.Listener
+	// TLS, if not nil, serves gRPC over TLS with the configuration.
+	TLS *tls.Config
+	// Username returns the authenticated user of each RPC, such as
+	// gnmisession.MetadataUsername once the RPC's credentials are
+	// checked. If nil, users are mapped by CertMapper from their TLS
+	// client certificates.
+	Username func(context.Context) string
+	// CertMapper maps client certificates to usernames.
+	CertMapper transport.CertMapper
+}
+
+// Server is a network management server assembled from a Config.
+type Server struct {
+	cfg        Config
+	set        *datastore.Set
+	mgr        session.Manager
+	dispatcher *rpc.Dispatcher
+	base       *rpc.Base
+	confirmer  *datastore.Confirmer
+	broker     *notification.Broker
+	push       *notification.Push
+	enforcer   *nacm.Enforcer
+	audit      *audit.Log
+	ssh        *transport.SSHServer
+
+	mu sync.Mutex
+	// stop stops the Server's Run, which closes done when it returns
+	stop     context.CancelFunc
+	shutdown bool
+	done     chan struct{}
+}
+
+// New returns a new Server with the configuration. Run serves its
+// frontends.
+func New(cfg Config) (*Server, error) {
+	if cfg.Modules == nil {
+		return nil, errors.New("server has no module collection")
+	}
+	if cfg.Metrics == nil {
+		cfg.Metrics = metrics.Default()
+	}
+	cfg.Logger = log.OrNop(cfg.Logger)
+	s := &Server{cfg: cfg, dispatcher: rpc.NewDispatcher()}
+	s.dispatcher.SetMetrics(cfg.Metrics)
+	if err := s.datastores(); err != nil {
+		return nil, err
+	}
+	if cfg.NETCONF != nil {
+		sshConfig := cfg.NETCONF.SSH
+		if sshConfig.Logger == nil {
+			sshConfig.Logger = cfg.Logger
+		}
+		ssh, err := transport.NewSSHServer(sshConfig)
+		if err != nil {
+			return nil, errors.Wrap(err, "netconf")
+		}
+		s.ssh = ssh
+	}
+	if cfg.RESTCONF != nil && cfg.RESTCONF.Username == nil && cfg.RESTCONF.CertMapper == nil {
+		return nil, errors.New("restconf has no username or certificate mapping")
+	}
+	if cfg.GNMI != nil && cfg.GNMI.Username == nil && cfg.GNMI.CertMapper == nil {
+		return nil, errors.New("gnmi has no username or certificate mapping")
+	}
+
+	// the NETCONF acceptor advertises the capabilities of operations
+	// using the manager, so is made once they are
+	nc := &netconfAcceptor{}
+	options := []session.ManagerOption{
+		session.WithAcceptor(nc, restconfsession.NewAcceptor(), gnmisession.NewAcceptor()),
+		session.WithTransportClose(),
+		session.WithMetrics(cfg.Metrics),
+	}
+	if c := cfg.Sessions; c.IdleTimeout > 0 {
+		options = append(options, session.WithIdleTimeout(c.IdleTimeout))
+	}
+	if c := cfg.Sessions; c.MaxLifetime > 0 {
+		options = append(options, session.WithMaxLifetime(c.MaxLifetime))
+	}
+	if c := cfg.Sessions; c.AcceptQueue > 0 {
+		options = append(options, session.WithAcceptQueue(c.AcceptQueue, session.OverflowReject))
+	}
+	options = append(options, session.WithLogger(cfg.Logger))
+	s.mgr = session.NewManager(options...)
+	if cfg.Audit != nil {
+		options := []audit.Option{}
+		for _, sink := range cfg.Audit.Sinks {
+			options = append(options, audit.WithSink(sink))
+		}
+		if cfg.Audit.Patch {
+			options = append(options, audit.WithPatch())
+		}
+		if cfg.Audit.Size > 0 {
+			options = append(options, audit.WithSize(cfg.Audit.Size))
+		}
+		s.audit = audit.New(s.mgr, options...)
+		for _, name := range []string{datastore.Running, datastore.Candidate, datastore.Startup} {
+			if ds := s.set.Get(name); ds != nil {
+				s.audit.Watch(ds)
+			}
+		}
+	}
+
+	s.base = rpc.NewBase(s.set, s.mgr)
+	s.base.Register(s.dispatcher)
+	if cfg.Datastores.Candidate {
+		var store datastore.ConfirmedStore
+		if path := cfg.Datastores.ConfirmedCommitFile; path != "" {
+			store = datastore.NewFileConfirmedStore(path)
+		}
+		confirmer, err := datastore.NewConfirmer(s.set.Get(datastore.Running), store)
+		if err != nil {
+			return nil, err
+		}
+		s.confirmer = confirmer
+		s.base.SetConfirmer(confirmer)
+	}
+	if cfg.NACM != nil {
+		var options []nacm.Option
+		if cfg.NACM.RecoveryUser != "" {
+			options = append(options, nacm.WithRecoveryUser(cfg.NACM.RecoveryUser))
+		}
+		if cfg.NACM.ExternalGroups != nil {
+			options = append(options, nacm.WithExternalGroups(cfg.NACM.ExternalGroups))
+		}
+		s.enforcer = nacm.New(s.set.Get(datastore.Running), options...)
+		s.dispatcher.SetAuthorizer(s.enforcer)
+	}
+	var brokerOptions []notification.Option
+	var pushOptions []notification.PushOption
+	if s.enforcer != nil {
+		brokerOptions = append(brokerOptions, notification.WithAuthorizer(s.enforcer))
+		pushOptions = append(pushOptions, notification.WithPushAuthorizer(s.enforcer))
+	}
+	s.broker = notification.NewBroker(s.mgr, brokerOptions...)
+	s.broker.Register(s.dispatcher)
+	s.push = notification.NewPush(s.set, s.mgr, pushOptions...)
+	s.push.Register(s.dispatcher)
+	caps := append(s.base.Capabilities(), s.broker.Capabilities()...)
+	if cfg.NETCONF != nil {
+		caps = append(caps, cfg.NETCONF.Capabilities...)
+	}
+	nc.Acceptor = netconf.NewAcceptor(cfg.Modules, s.dispatcher, netconf.WithCapabilities(caps...))
+
+	return s, nil
+}
+
+// datastores adds the configured datastores to the Server's set.
+func (s *Server) datastores() error {
+	c, cfg := s.cfg.Modules, s.cfg.Datastores
+	common := []datastore.Option{datastore.WithMetrics(s.cfg.Metrics), datastore.WithLogger(s.cfg.Logger)}
+	if cfg.Validate {
+		common = append(common, datastore.WithValidation(cfg.Validators))
+	}
+	running := common
+	if cfg.History > 0 {
+		running = append(running[:len(running):len(running)], datastore.WithHistory(cfg.History))
+	}
+	s.set = datastore.NewSet(datastore.New(datastore.Running, c, running...))
+	if cfg.Candidate {
+		s.set.Add(datastore.New(datastore.Candidate, c, datastore.WithMetrics(s.cfg.Metrics), datastore.WithLogger(s.cfg.Logger)))
+	}
+	if cfg.Startup {
+		s.set.Add(datastore.New(datastore.Startup, c, common...))
+	}
+	if cfg.FactoryDefault == nil {
+		return nil
+	}
+	factory, err := datastore.NewFactoryDefault(c, cfg.FactoryDefault)
+	if err != nil {
+		return err
+	}
+	s.set.Add(factory)
+	for _, name := range []string{datastore.Startup, datastore.Running, datastore.Candidate} {
+		if s.set.Get(name) == nil {
+			continue
+		}
+		if _, err := s.set.Reset(name, 0); err != nil {
+			return errors.Wrapf(err, "initializing %s", name)
+		}
+	}
+	return nil
+}
+
+// Datastores returns the Server's datastores.
+func (s *Server) Datastores() *datastore.Set { return s.set }
+
+// Manager returns the Server's session manager.
+func (s *Server) Manager() session.Manager { return s.mgr }
+
+// Dispatcher returns the dispatcher of the NETCONF operations.
+func (s *Server) Dispatcher() *rpc.Dispatcher { return s.dispatcher }
+
+// Broker returns the broker of the NETCONF event streams.
+func (s *Server) Broker() *notification.Broker { return s.broker }
+
+// Enforcer returns the access control enforcer, or nil if NACM is not
+// configured.
+func (s *Server) Enforcer() *nacm.Enforcer { return s.enforcer }
+
+// Audit returns the audit log, or nil if it is not configured.
+func (s *Server) Audit() *audit.Log { return s.audit }
+
+// Run serves the configured frontends until the context is done, or
+// Shutdown is called, when it closes their listeners and terminates
+// every session with ErrShutdown. Run returns nil once stopped by
+// Shutdown, the context's error if it is done, or the error of a
+// frontend failing to listen or serve. A Server is run once.
+func (s *Server) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	s.mu.Lock()
+	if s.done != nil {
+		s.mu.Unlock()
+		return errors.New("server already run")
+	}
+	s.stop, s.done = cancel, make(chan struct{})
+	shutdown := s.shutdown
+	s.mu.Unlock()
+	defer close(s.done)
+	if shutdown {
+		return nil
+	}
+
+	frontends, err := s.listen()
+	if err != nil {
+		return err
+	}
+	errs := make(chan error, len(frontends))
+	for _, f := range frontends {
+		go func(f frontend) { errs <- errors.Wrap(f.serve(ctx), f.name) }(f)
+	}
+	var first error
+	if len(frontends) > 0 {
+		select {
+		case first = <-errs:
+			frontends = frontends[1:]
+		case <-ctx.Done():
+		}
+	}
+	cancel()
+	for range frontends {
+		if err := <-errs; first == nil {
+			first = err
+		}
+	}
+	s.mgr.TerminateAll(ErrShutdown)
+	if s.confirmer != nil {
+		// a stored persistent commit is restored by the next Server
+		s.confirmer.Stop()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case first != nil:
+		return first
+	case s.shutdown:
+		return nil
+	}
+	return ctx.Err()
+}
+
+// Shutdown stops the Server's Run, waiting for it to return until the
+// context is done. A Server shut down before it is run does not run.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.shutdown = true
+	stop, done := s.stop, s.done
+	s.mu.Unlock()
+	if stop == nil {
+		return nil
+	}
+	stop()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// frontend serves a protocol until its context is done, returning nil
+// if it stops then.
+type frontend struct {
+	name  string
+	serve func(ctx context.Context) error
+}
+
+// listen returns the configured frontends, listening on their
+// addresses.
+func (s *Server) listen() ([]frontend, error) {
+	var frontends []frontend
+	var listeners []net.Listener
+	listen := func(l net.Listener, addr, defaultAddr string) (net.Listener, error) {
+		if l == nil {
+			if addr == "" {
+				addr = defaultAddr
+			}
+			var err error
+			if l, err = net.Listen("tcp", addr); err != nil {
+				// the listeners provided are closed as those opened
+				s.closeListeners(listeners)
+				return nil, errors.WithStack(err)
+			}
+		}
+		listeners = append(listeners, l)
+		return l, nil
+	}
+
+	if cfg := s.cfg.NETCONF; cfg != nil {
+		l, err := listen(cfg.Listener, cfg.Addr, DefaultNETCONFAddr)
+		if err != nil {
+			return nil, errors.Wrap(err, "netconf")
+		}
+		frontends = append(frontends, frontend{name: "netconf", serve: func(ctx context.Context) error {
+			if err := session.Serve(ctx, l, s.ssh.Transport, s.mgr); ctx.Err() == nil {
+				return err
+			}
+			return nil
+		}})
+	}
+	if cfg := s.cfg.RESTCONF; cfg != nil {
+		l, err := listen(cfg.Listener, cfg.Addr, DefaultRESTCONFAddr)
+		if err != nil {
+			return nil, errors.Wrap(err, "restconf")
+		}
+		if cfg.TLS != nil {
+			l = tls.NewListener(l, cfg.TLS)
+		}
+		hs := &http.Server{Handler: s.restconfHandler()}
+		frontends = append(frontends, frontend{name: "restconf", serve: func(ctx context.Context) error {
+			return serveUntilDone(ctx, func() error { return hs.Serve(l) }, func() { _ = hs.Close() })
+		}})
+	}
+	if cfg := s.cfg.GNMI; cfg != nil {
+		l, err := listen(cfg.Listener, cfg.Addr, DefaultGNMIAddr)
+		if err != nil {
+			return nil, errors.Wrap(err, "gnmi")
+		}
+		unary, stream := s.gnmiInterceptors()
+		options := []grpc.ServerOption{grpc.UnaryInterceptor(unary), grpc.StreamInterceptor(stream)}
+		if cfg.TLS != nil {
+			options = append(options, grpc.Creds(credentials.NewTLS(cfg.TLS)))
+		}
+		g := grpc.NewServer(options...)
+		gpb.RegisterGNMIServer(g, s.gnmi())
+		frontends = append(frontends, frontend{name: "gnmi", serve: func(ctx context.Context) error {
+			return serveUntilDone(ctx, func() error { return g.Serve(l) }, g.Stop)
+		}})
+	}
+	return frontends, nil
+}
+
+// closeListeners closes the listeners, and those of the configuration.
+func (s *Server) closeListeners(listeners []net.Listener) {
+	if cfg := s.cfg.NETCONF; cfg != nil && cfg.Listener != nil {
+		listeners = append(listeners, cfg.Listener)
+	}
+	if cfg := s.cfg.RESTCONF; cfg != nil && cfg.Listener != nil {
+		listeners = append(listeners, cfg.Listener)
+	}
+	if cfg := s.cfg.GNMI; cfg != nil && cfg.Listener != nil {
+		listeners = append(listeners, cfg.Listener)
+	}
+	for _, l := range listeners {
+		_ = l.Close()
+	}
+}
+
+// serveUntilDone calls serve, calling stop to end it when the context
+// is done. Errors returned once the context is done are ignored.
+func serveUntilDone(ctx context.Context, serve func() error, stop func()) error {
+	served := make(chan struct{})
+	defer close(served)
+	go func() {
+		select {
+		case <-ctx.Done():
+			stop()
+		case <-served:
+		}
+	}()
+	if err := serve(); ctx.Err() == nil {
+		return err
+	}
+	return nil
+}
+
+// restconf returns the RESTCONF server.
+func (s *Server) restconf() *restconf.Server {
+	var options []restconf.Option
+	if root := s.cfg.RESTCONF.Root; root != "" {
+		options = append(options, restconf.WithRoot(root))
+	}
+	if s.enforcer != nil {
+		options = append(options, restconf.WithAuthorizer(s.enforcer))
+	}
+	return restconf.NewServer(s.set, options...)
+}
+
+// restconfHandler returns the HTTP handler of RESTCONF requests, each
+// a session of the Server's manager. Requests whose client certificate
+// is not mapped to a user are responded to with 401 Unauthorized.
+func (s *Server) restconfHandler() http.Handler {
+	cfg := s.cfg.RESTCONF
+	if cfg.Username != nil {
+		return restconfsession.Handler(s.mgr, cfg.Username, s.restconf())
+	}
+	type userKey struct{}
+	h := restconfsession.Handler(s.mgr, func(r *http.Request) string {
+		return r.Context().Value(userKey{}).(string)
+	}, s.restconf())
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var username string
+		var err error
+		if r.TLS == nil {
+			err = errors.New("no client certificate")
+		} else {
+			username, err = transport.CertUsername(cfg.CertMapper, *r.TLS)
+		}
+		if err != nil {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userKey{}, username)))
+	})
+}
+
+// gnmiInterceptors returns the gRPC interceptors accepting a session of
+// the Server's manager for each gNMI RPC. RPCs whose client
+// certificate is not mapped to a user fail with the code
+// Unauthenticated.
+func (s *Server) gnmiInterceptors() (grpc.UnaryServerInterceptor, grpc.StreamServerInterceptor) {
+	cfg := s.cfg.GNMI
+	if cfg.Username != nil {
+		return gnmisession.UnaryServerInterceptor(s.mgr, cfg.Username), gnmisession.StreamServerInterceptor(s.mgr, cfg.Username)
+	}
+	type userKey struct{}
+	username := func(ctx context.Context) string { return ctx.Value(userKey{}).(string) }
+	unary := gnmisession.UnaryServerInterceptor(s.mgr, username)
+	stream := gnmisession.StreamServerInterceptor(s.mgr, username)
+	withUser := func(ctx context.Context) (context.Context, error) {
+		p, ok := peer.FromContext(ctx)
+		if !ok {
+			return nil, status.Error(codes.Unauthenticated, "no client certificate")
+		}
+		info, ok := p.AuthInfo.(credentials.TLSInfo)
+		if !ok {
+			return nil, status.Error(codes.Unauthenticated, "no client certificate")
+		}
+		username, err := transport.CertUsername(cfg.CertMapper, info.State)
+		if err != nil {
+			return nil, status.Error(codes.Unauthenticated, "unauthorized")
+		}
+		return context.WithValue(ctx, userKey{}, username), nil
+	}
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			ctx, err := withUser(ctx)
+			if err != nil {
+				return nil, err
+			}
+			return unary(ctx, req, info, handler)
+		}, func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			ctx, err := withUser(ss.Context())
+			if err != nil {
+				return err
+			}
+			return stream(srv, userStream{ss, ctx}, info, handler)
+		}
+}
+
+// userStream is a server stream whose context carries its user.
+type userStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s userStream) Context() context.Context { return s.ctx }
+
+// gnmi returns the gNMI server.
+func (s *Server) gnmi() *gnmi.Server {
+	var options []gnmi.Option
+	if s.enforcer != nil {
+		options = append(options, gnmi.WithAuthorizer(s.enforcer))
+	}
+	return gnmi.NewServer(s.set, options...)
+}
+
+// netconfAcceptor is the NETCONF acceptor of a Server's session
+// manager.
+type netconfAcceptor struct{ *netconf.Acceptor }
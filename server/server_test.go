@@ -0,0 +1,320 @@
+package server
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	xml "github.com/andaru/flexml"
+	"github.com/andaru/opr8/datastore"
+	"github.com/andaru/opr8/dom"
+	"github.com/andaru/opr8/modules"
+	"github.com/andaru/opr8/transport"
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const testModule = `module server-test {
+  namespace "urn:server-test";
+  prefix st;
+  container system {
+    leaf host-name { type string; }
+  }
+}`
+
+func testCollection(t *testing.T) *modules.Collection {
+	t.Helper()
+	c := modules.NewCollection()
+	if err := c.ReadString("server-test", testModule); err != nil {
+		t.Fatal(err)
+	}
+	if errs := c.Process(); errs != nil {
+		t.Fatal(errs)
+	}
+	return c
+}
+
+func testSigner(t *testing.T) ssh.Signer {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+func testListener(t *testing.T) net.Listener {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+// factoryDefault returns a builder of a data tree with the host-name.
+func factoryDefault(t *testing.T, c *modules.Collection) datastore.Builder {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "factory-default.xml")
+	if err := ioutil.WriteFile(path, []byte(`<system xmlns="urn:server-test"><host-name>factory</host-name></system>`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return datastore.FileBuilder(c, path)
+}
+
+func TestNew(t *testing.T) {
+	c := testCollection(t)
+	for _, tt := range []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{name: "running only", cfg: Config{Modules: c}},
+		{name: "no modules", cfg: Config{}, wantErr: true},
+		{name: "no ssh host keys", cfg: Config{Modules: c, NETCONF: &NETCONFConfig{}}, wantErr: true},
+		{name: "no restconf username", cfg: Config{Modules: c, RESTCONF: &RESTCONFConfig{}}, wantErr: true},
+		{name: "no gnmi username", cfg: Config{Modules: c, GNMI: &GNMIConfig{}}, wantErr: true},
+		{name: "gnmi certificate mapping", cfg: Config{Modules: c, GNMI: &GNMIConfig{CertMapper: transport.CertToName{}}}},
+		{
+			name: "failed factory-default",
+			cfg: Config{Modules: c, Datastores: DatastoreConfig{FactoryDefault: func(dom.Document) error {
+				return errors.New("failed")
+			}}},
+			wantErr: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestServer(t *testing.T) {
+	c, hostKey := testCollection(t), testSigner(t)
+	nl, rl, gl := testListener(t), testListener(t), testListener(t)
+	srv, err := New(Config{
+		Modules:    c,
+		Datastores: DatastoreConfig{Candidate: true, FactoryDefault: factoryDefault(t, c), History: 4},
+		NACM:       &NACMConfig{RecoveryUser: "root"},
+		NETCONF: &NETCONFConfig{
+			Listener: nl,
+			SSH: transport.SSHServerConfig{
+				HostKeys: []ssh.Signer{hostKey},
+				Password: func(conn ssh.ConnMetadata, password string) error {
+					if password != "secret" {
+						return errors.New("denied")
+					}
+					return nil
+				},
+			},
+		},
+		RESTCONF: &RESTCONFConfig{Listener: rl, Username: func(*http.Request) string { return "root" }},
+		GNMI:     &GNMIConfig{Listener: gl, Username: func(context.Context) string { return "root" }},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if srv.Enforcer() == nil || srv.Broker() == nil || srv.Manager() == nil || srv.Dispatcher() == nil {
+		t.Fatal("Server parts are nil")
+	}
+	if names := srv.Datastores().Names(); strings.Join(names, " ") != "candidate factory-default running" {
+		t.Errorf("Datastores().Names() = %q", names)
+	}
+	ran := make(chan error, 1)
+	go func() { ran <- srv.Run(context.Background()) }()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	t.Run("netconf", func(t *testing.T) {
+		c, err := transport.DialSSH(ctx, nl.Addr().String(), "root", transport.FixedHostKey(hostKey.PublicKey()), transport.WithPassword("secret"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		d := xml.NewDecoder(c)
+		var hello struct {
+			Capabilities []string `xml:"capabilities>capability"`
+		}
+		if err := d.Decode(&hello); err != nil {
+			t.Fatal(err)
+		}
+		if caps := strings.Join(hello.Capabilities, " "); !strings.Contains(caps, ":candidate:1.0") || !strings.Contains(caps, ":notification:1.0") {
+			t.Errorf("hello capabilities = %v", hello.Capabilities)
+		}
+		for _, msg := range []string{
+			`<hello xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><capabilities><capability>urn:ietf:params:netconf:base:1.0</capability></capabilities></hello>`,
+			`<rpc xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="1"><get-config><source><candidate/></source></get-config></rpc>`,
+		} {
+			if _, err := c.Write([]byte(msg)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		var reply struct {
+			Data string `xml:",innerxml"`
+		}
+		if err := d.Decode(&reply); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(reply.Data, "<host-name>factory</host-name>") {
+			t.Errorf("get-config reply = %s, want the factory-default host-name", reply.Data)
+		}
+
+		// Leaf values keep their whitespace, including text split
+		// across tokens, while whitespace between elements is ignored.
+		for _, msg := range []string{
+			`<rpc xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="2">
+  <edit-config>
+    <target><candidate/></target>
+    <config>
+      <system xmlns="urn:server-test">
+        <host-name>  padded <![CDATA[&]]> name  </host-name>
+      </system>
+    </config>
+  </edit-config>
+</rpc>`,
+			`<rpc xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="3"><get-config><source><candidate/></source></get-config></rpc>`,
+		} {
+			if _, err := c.Write([]byte(msg)); err != nil {
+				t.Fatal(err)
+			}
+			reply.Data = ""
+			if err := d.Decode(&reply); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if !strings.Contains(reply.Data, "<host-name>  padded &amp; name  </host-name>") {
+			t.Errorf("get-config reply = %s, want the padded host-name", reply.Data)
+		}
+	})
+
+	t.Run("restconf", func(t *testing.T) {
+		resp, err := http.Get("http://" + rl.Addr().String() + "/restconf/data/server-test:system/host-name")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		b, _ := ioutil.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK || !strings.Contains(string(b), "factory") {
+			t.Errorf("GET = %s %s, want 200 with the factory-default host-name", resp.Status, b)
+		}
+	})
+
+	t.Run("gnmi", func(t *testing.T) {
+		conn, err := grpc.DialContext(ctx, gl.Addr().String(), grpc.WithInsecure())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		resp, err := gpb.NewGNMIClient(conn).Get(ctx, &gpb.GetRequest{
+			Path:     []*gpb.Path{{Elem: []*gpb.PathElem{{Name: "server-test:system"}, {Name: "host-name"}}}},
+			Encoding: gpb.Encoding_JSON_IETF,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(resp.GetNotification()[0].GetUpdate()[0].GetVal().GetJsonIetfVal()); got != `"factory"` {
+			t.Errorf("Get() value = %s, want %q", got, `"factory"`)
+		}
+	})
+
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Errorf("Shutdown() error = %v", err)
+	}
+	if err := <-ran; err != nil {
+		t.Errorf("Run() error = %v, want nil", err)
+	}
+	if err := srv.Run(ctx); err == nil {
+		t.Error("second Run() error = nil, want an error")
+	}
+	if _, err := http.Get("http://" + rl.Addr().String() + "/restconf/data"); err == nil {
+		t.Error("GET after Shutdown() error = nil, want an error")
+	}
+}
+
+func TestServer_gnmiCertificates(t *testing.T) {
+	gl := testListener(t)
+	srv, err := New(Config{Modules: testCollection(t), GNMI: &GNMIConfig{Listener: gl, CertMapper: transport.CertToName{}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ran := make(chan error, 1)
+	go func() { ran <- srv.Run(context.Background()) }()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	conn, err := grpc.DialContext(ctx, gl.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_, err = gpb.NewGNMIClient(conn).Get(ctx, &gpb.GetRequest{Encoding: gpb.Encoding_JSON_IETF})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Get() without a client certificate error = %v, want code %v", err, codes.Unauthenticated)
+	}
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Errorf("Shutdown() error = %v", err)
+	}
+	<-ran
+}
+
+func TestRun(t *testing.T) {
+	c := testCollection(t)
+	t.Run("context done", func(t *testing.T) {
+		srv, err := New(Config{Modules: c, GNMI: &GNMIConfig{Listener: testListener(t), Username: func(context.Context) string { return "" }}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		if err := srv.Run(ctx); err != context.DeadlineExceeded {
+			t.Errorf("Run() error = %v, want %v", err, context.DeadlineExceeded)
+		}
+	})
+
+	t.Run("listen error", func(t *testing.T) {
+		l := testListener(t)
+		defer l.Close()
+		srv, err := New(Config{
+			Modules:  c,
+			GNMI:     &GNMIConfig{Listener: testListener(t), Username: func(context.Context) string { return "" }},
+			RESTCONF: &RESTCONFConfig{Addr: l.Addr().String(), Username: func(*http.Request) string { return "" }},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := srv.Run(context.Background()); err == nil || !strings.Contains(err.Error(), "restconf") {
+			t.Errorf("Run() error = %v, want a restconf listen error", err)
+		}
+	})
+
+	t.Run("shutdown before run", func(t *testing.T) {
+		srv, err := New(Config{Modules: c, GNMI: &GNMIConfig{Listener: testListener(t), Username: func(context.Context) string { return "" }}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := srv.Shutdown(context.Background()); err != nil {
+			t.Errorf("Shutdown() error = %v", err)
+		}
+		if err := srv.Run(context.Background()); err != nil {
+			t.Errorf("Run() error = %v, want nil", err)
+		}
+	})
+}
@@ -13,10 +13,29 @@ which should be responded with by an attempt to create a session using
 the provided transport and session ID. The session is started and the
 Server session interface returned to the session manager.
 
-The Session's application must respond to the context passed to
-Accept's termination by calling the session's Release method, at which
-time any session errors are returned to the Server Wait channel before
-the channel is closed.
+The session's lifetime is bound to the context passed to Accept: when
+it is done, the manager terminates the session with the context's
+error. The session's application calls the session's Release method
+when it has finished with the session, at which time any session
+errors are returned to the Server Wait channel before the channel is
+closed.
+
+Sessions ended by the manager, with Terminate or on expiry, are ended
+with an error saying why, such as ErrIdleTimeout. Sessions
+implementing Killer receive it with Kill, and deliver it on their Wait
+channel for their application to observe; others are released. Server
+implementations embed Lifecycle to implement Wait, Release, Kill and
+Done accordingly.
+
+The manager logs sessions as they are accepted and end with the
+log.Logger given by WithLogger. Acceptors log with the session's logger, which
+adds its session ID, username and transport to each message, using
+LoggerFromContext on the context passed to Accept.
+
+Network servers use Serve to accept connections from a listener,
+starting a session with the manager over a transport for each, until
+the context passed is done. ServeMux does likewise for the channels of
+a transport.Mux.
 
 */
 package session
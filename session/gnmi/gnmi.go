@@ -0,0 +1,246 @@
+/*
+Package gnmi has the gNMI server session, an Acceptor for the session
+manager making each gNMI RPC a session.
+
+The gRPC server interceptors returned by UnaryServerInterceptor and
+StreamServerInterceptor accept a session for each RPC they intercept,
+such as Get, Set or a Subscribe stream, so gNMI RPCs appear in the
+manager's session table and are limited by the manager as NETCONF
+sessions are. The session lasts until the RPC handler returns.
+*/
+package gnmi
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+
+	"github.com/andaru/opr8/session"
+	"github.com/andaru/opr8/transport"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// ErrNoStream is returned by the Read and Write methods of gNMI
+// transports, as gNMI messages are exchanged by the RPC handler.
+var ErrNoStream = errors.New("gNMI transports carry no byte stream")
+
+// Transport is the server transport of a gNMI RPC.
+type Transport struct {
+	method   string
+	username string
+	// remote and state describe the client's connection, set from
+	// the RPC's peer
+	remote net.Addr
+	state  tls.ConnectionState
+}
+
+// NewTransport returns the transport of the gRPC method, such as
+// "/gnmi.gNMI/Get", called by the authenticated user username.
+func NewTransport(method, username string) *Transport {
+	return &Transport{method: method, username: username}
+}
+
+// Read returns ErrNoStream.
+func (t *Transport) Read([]byte) (int, error) { return 0, ErrNoStream }
+
+// Write returns ErrNoStream.
+func (t *Transport) Write([]byte) (int, error) { return 0, ErrNoStream }
+
+// CloseWrite returns nil.
+func (t *Transport) CloseWrite() error { return nil }
+
+// Close returns nil; the RPC ends when its handler returns.
+func (t *Transport) Close() error { return nil }
+
+// Error returns nil; gNMI transports have no error channel.
+func (t *Transport) Error() io.ReadWriter { return nil }
+
+// Username returns the authenticated username of the RPC.
+func (t *Transport) Username() string { return t.username }
+
+// Kind returns "gnmi".
+func (t *Transport) Kind() string { return "gnmi" }
+
+// RemoteAddr returns the network address of the client, or nil if
+// unknown.
+func (t *Transport) RemoteAddr() net.Addr { return t.remote }
+
+// LocalAddr returns nil; gRPC does not report the local address.
+func (t *Transport) LocalAddr() net.Addr { return nil }
+
+// ConnectionState returns the TLS connection state of the RPC, the
+// zero state if it was not received over TLS.
+func (t *Transport) ConnectionState() tls.ConnectionState { return t.state }
+
+// Method returns the full gRPC method name of the RPC.
+func (t *Transport) Method() string { return t.method }
+
+// Acceptor is the gNMI session acceptor. It implements
+// session.Acceptor, accepting sessions on gNMI Transports.
+type Acceptor struct{}
+
+// NewAcceptor returns a new gNMI session acceptor.
+func NewAcceptor() *Acceptor { return &Acceptor{} }
+
+// Supported returns true if t is a gNMI Transport.
+func (a *Acceptor) Supported(t transport.ServerTransport) bool {
+	_, ok := t.(*Transport)
+	return ok
+}
+
+// Accept returns a new session for the gNMI RPC transport t with the
+// session ID id. The session lasts until it is released, such as by
+// the interceptors once the RPC handler returns.
+func (a *Acceptor) Accept(ctx context.Context, t transport.ServerTransport, id session.ID) (session.Server, error) {
+	tr := t.(*Transport)
+	meta := session.TransportMeta(tr)
+	meta.Protocol = "gnmi"
+	s := &Session{id: id, t: tr, meta: meta}
+	return s, nil
+}
+
+// Session is a gNMI server session, lasting for one RPC. It implements
+// session.Server, session.Killer, session.Doner and
+// session.MetaProvider.
+type Session struct {
+	id   session.ID
+	t    *Transport
+	meta session.Meta
+	session.Lifecycle
+}
+
+// ID returns the session identifier.
+func (s *Session) ID() session.ID { return s.id }
+
+// Type returns session.TypeServer.
+func (s *Session) Type() session.Type { return session.TypeServer }
+
+// Transport returns the session transport, a *Transport.
+func (s *Session) Transport() transport.Transport { return s.t }
+
+// Meta returns the session's description. Its protocol is "gnmi".
+func (s *Session) Meta() session.Meta { return s.meta }
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying the session s.
+func NewContext(ctx context.Context, s *Session) context.Context {
+	return context.WithValue(ctx, contextKey{}, s)
+}
+
+// FromContext returns the session carried by ctx, and true, or false
+// if it carries none.
+func FromContext(ctx context.Context) (*Session, bool) {
+	s, ok := ctx.Value(contextKey{}).(*Session)
+	return s, ok
+}
+
+// MetadataUsername returns the value of the "username" metadata of
+// the incoming RPC context ctx, as sent by gNMI clients authenticating
+// with a username and password, or the empty string.
+func MetadataUsername(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get("username"); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// UnaryServerInterceptor returns a gRPC interceptor accepting a
+// session from the manager m for each unary RPC, made by the user
+// returned by username, such as MetadataUsername. The session is
+// carried by the context passed to the handler, which is cancelled if
+// the session is terminated, and released when the handler returns.
+// RPCs fail with the code Unavailable if the manager cannot accept a
+// session, or PermissionDenied if the manager's authorizer denies it.
+//
+// The manager must have a gnmi Acceptor registered.
+func UnaryServerInterceptor(m session.Manager, username func(context.Context) string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, end, err := accept(ctx, m, info.FullMethod, username)
+		if err != nil {
+			return nil, err
+		}
+		defer end()
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor returns a gRPC interceptor accepting a
+// session for each streaming RPC, such as Subscribe, as
+// UnaryServerInterceptor does for unary RPCs. The session is carried
+// by the context of the stream passed to the handler.
+func StreamServerInterceptor(m session.Manager, username func(context.Context) string) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, end, err := accept(ss.Context(), m, info.FullMethod, username)
+		if err != nil {
+			return err
+		}
+		defer end()
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// accept accepts a session for the RPC method from the manager m,
+// returning the RPC context carrying it, and a function ending the
+// session.
+func accept(ctx context.Context, m session.Manager, method string, username func(context.Context) string) (context.Context, func(), error) {
+	t := NewTransport(method, username(ctx))
+	if p, ok := peer.FromContext(ctx); ok {
+		t.remote = p.Addr
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			t.state = info.State
+		}
+	}
+	accepted, err := m.Accept(ctx, t)
+	if denied, ok := err.(*session.AccessDeniedError); ok {
+		return nil, nil, status.Error(codes.PermissionDenied, denied.Error())
+	}
+	if err != nil {
+		return nil, nil, status.Error(codes.Unavailable, "session unavailable")
+	}
+	s, ok := accepted.(*Session)
+	if !ok {
+		accepted.Release()
+		return nil, nil, status.Error(codes.Unavailable, "session unavailable")
+	}
+	ctx, cancel := context.WithCancel(NewContext(ctx, s))
+	go func() {
+		select {
+		case <-s.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() {
+		cancel()
+		s.Release()
+	}, nil
+}
+
+// serverStream is a grpc.ServerStream with the context ctx.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (ss *serverStream) Context() context.Context { return ss.ctx }
+
+var (
+	_ session.Acceptor           = &Acceptor{}
+	_ session.Server             = &Session{}
+	_ session.Killer             = &Session{}
+	_ session.Doner              = &Session{}
+	_ session.MetaProvider       = &Session{}
+	_ transport.ServerTransport  = &Transport{}
+	_ transport.Kinder           = &Transport{}
+	_ transport.Addresser        = &Transport{}
+	_ transport.ConnectionStater = &Transport{}
+)
@@ -0,0 +1,122 @@
+package gnmi
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/andaru/opr8/session"
+	"github.com/andaru/opr8/transport"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// testStream is a grpc.ServerStream with a context.
+type testStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (ss *testStream) Context() context.Context { return ss.ctx }
+
+func waitNoSessions(t *testing.T, m session.Manager) {
+	t.Helper()
+	for start := time.Now(); len(m.Sessions()) > 0; time.Sleep(time.Millisecond) {
+		if time.Since(start) > time.Second {
+			t.Fatalf("Manager.Sessions() after RPC = %+v, want none", m.Sessions())
+		}
+	}
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	m := session.NewManager(session.WithAcceptor(NewAcceptor()))
+	intercept := UnaryServerInterceptor(m, MetadataUsername)
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("username", "admin"))
+	remote := &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 50000}
+	ctx = peer.NewContext(ctx, &peer.Peer{Addr: remote, AuthInfo: credentials.TLSInfo{State: tls.ConnectionState{HandshakeComplete: true}}})
+
+	var during []session.SessionInfo
+	reply, err := intercept(ctx, "request", &grpc.UnaryServerInfo{FullMethod: "/gnmi.gNMI/Get"}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		s, ok := FromContext(ctx)
+		if !ok {
+			return nil, errors.New("no session")
+		}
+		if got := s.Transport().(*Transport).Method(); got != "/gnmi.gNMI/Get" {
+			t.Errorf("Transport.Method() = %q, want %q", got, "/gnmi.gNMI/Get")
+		}
+		during = m.Sessions()
+		if meta := s.Meta(); meta.Protocol != "gnmi" || meta.RemoteAddr != remote || meta.Security != "tls" || meta.TLS == nil {
+			t.Errorf("Session.Meta() = %+v, want gnmi over tls from %v", meta, remote)
+		}
+		return req, nil
+	})
+	if err != nil || reply != "request" {
+		t.Fatalf("interceptor = %v, %v, want %q, nil", reply, err, "request")
+	}
+	if len(during) != 1 || during[0].Username != "admin" || during[0].Transport != "gnmi" {
+		t.Errorf("Manager.Sessions() during RPC = %+v", during)
+	}
+	waitNoSessions(t, m)
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	m := session.NewManager(session.WithAcceptor(NewAcceptor()))
+	intercept := StreamServerInterceptor(m, MetadataUsername)
+	killed := errors.New("killed")
+	var got error
+	err := intercept(nil, &testStream{ctx: context.Background()}, &grpc.StreamServerInfo{FullMethod: "/gnmi.gNMI/Subscribe"}, func(srv interface{}, ss grpc.ServerStream) error {
+		s, ok := FromContext(ss.Context())
+		if !ok {
+			return errors.New("no session")
+		}
+		if err := m.Terminate(s.ID(), killed); err != nil {
+			t.Errorf("Manager.Terminate() error = %v", err)
+		}
+		select {
+		case <-ss.Context().Done():
+		case <-time.After(time.Second):
+			t.Error("stream context not done after Terminate")
+		}
+		got = <-s.Wait()
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("interceptor error = %v", err)
+	}
+	if got != killed {
+		t.Errorf("Session.Wait() error = %v, want %v", got, killed)
+	}
+	waitNoSessions(t, m)
+}
+
+func TestUnaryServerInterceptor_unavailable(t *testing.T) {
+	intercept := UnaryServerInterceptor(session.NewManager(), MetadataUsername)
+	_, err := intercept(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/gnmi.gNMI/Get"}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		t.Error("handler called without a session")
+		return nil, nil
+	})
+	if status.Code(err) != codes.Unavailable {
+		t.Errorf("interceptor error = %v, want code %v", err, codes.Unavailable)
+	}
+}
+
+func TestUnaryServerInterceptor_denied(t *testing.T) {
+	m := session.NewManager(session.WithAcceptor(NewAcceptor()), session.WithAuthorizer(func(ctx context.Context, t transport.ServerTransport) error {
+		return errors.New("maintenance")
+	}))
+	intercept := UnaryServerInterceptor(m, MetadataUsername)
+	_, err := intercept(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/gnmi.gNMI/Set"}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		t.Error("handler called without a session")
+		return nil, nil
+	})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Errorf("interceptor error = %v, want code %v", err, codes.PermissionDenied)
+	}
+}
@@ -0,0 +1,55 @@
+package session
+
+import "sync"
+
+// Lifecycle implements the Wait, Release, Kill and Done methods of
+// server sessions, delivering the error a session is killed with on
+// its Wait channel. Server implementations embed a Lifecycle to
+// implement Server, Killer and Doner. The zero value is ready to use.
+type Lifecycle struct {
+	init sync.Once
+	end  sync.Once
+	wait chan error
+	done chan struct{}
+}
+
+func (l *Lifecycle) channels() {
+	l.init.Do(func() {
+		l.wait = make(chan error, 1)
+		l.done = make(chan struct{})
+	})
+}
+
+// Wait returns the session's error channel, receiving the error the
+// session was killed with, if any, and closed when the session ends.
+func (l *Lifecycle) Wait() <-chan error {
+	l.channels()
+	return l.wait
+}
+
+// Done returns a channel closed when the session ends.
+func (l *Lifecycle) Done() <-chan struct{} {
+	l.channels()
+	return l.done
+}
+
+// Release ends the session.
+func (l *Lifecycle) Release() { l.Kill(nil) }
+
+// Kill ends the session, first sending err, if not nil, to the Wait
+// channel. Only the first call to Kill or Release has effect.
+func (l *Lifecycle) Kill(err error) {
+	l.channels()
+	l.end.Do(func() {
+		if err != nil {
+			l.wait <- err
+		}
+		close(l.wait)
+		close(l.done)
+	})
+}
+
+var (
+	_ Killer = &Lifecycle{}
+	_ Doner  = &Lifecycle{}
+)
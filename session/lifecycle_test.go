@@ -0,0 +1,37 @@
+package session
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLifecycle(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		end  func(*Lifecycle)
+		want error
+	}{
+		{name: "release", end: func(l *Lifecycle) { l.Release() }},
+		{name: "kill", end: func(l *Lifecycle) { l.Kill(errors.New("killed")) }, want: errors.New("killed")},
+		{name: "kill after release", end: func(l *Lifecycle) { l.Release(); l.Kill(errors.New("killed")) }},
+		{name: "release after kill", end: func(l *Lifecycle) { l.Kill(errors.New("killed")); l.Release() }, want: errors.New("killed")},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var l Lifecycle
+			select {
+			case <-l.Done():
+				t.Fatal("Lifecycle.Done() closed before the session ended")
+			default:
+			}
+			tt.end(&l)
+			<-l.Done()
+			var got []error
+			for err := range l.Wait() {
+				got = append(got, err)
+			}
+			if tt.want == nil && len(got) != 0 || tt.want != nil && (len(got) != 1 || got[0].Error() != tt.want.Error()) {
+				t.Errorf("Lifecycle.Wait() errors = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
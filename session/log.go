@@ -0,0 +1,25 @@
+package session
+
+import (
+	"context"
+
+	"github.com/andaru/opr8/log"
+)
+
+type loggerKey struct{}
+
+// NewLoggerContext returns a copy of ctx carrying the logger l. The
+// manager passes acceptors a context carrying the session's logger.
+func NewLoggerContext(ctx context.Context, l log.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// LoggerFromContext returns the logger carried by ctx, or log.Nop() if
+// it carries none. Acceptors use it to log with the fields of the
+// session, its session ID, username and transport.
+func LoggerFromContext(ctx context.Context) log.Logger {
+	if l, ok := ctx.Value(loggerKey{}).(log.Logger); ok {
+		return l
+	}
+	return log.Nop()
+}
@@ -0,0 +1,20 @@
+package session
+
+import (
+	"bytes"
+	"context"
+	stdlog "log"
+	"testing"
+
+	"github.com/andaru/opr8/log"
+)
+
+func TestLoggerFromContext(t *testing.T) {
+	if got := LoggerFromContext(context.Background()); got != log.Nop() {
+		t.Errorf("LoggerFromContext() without a logger = %v, want log.Nop()", got)
+	}
+	l := log.NewStd(stdlog.New(&bytes.Buffer{}, "", 0), log.LevelInfo)
+	if got := LoggerFromContext(NewLoggerContext(context.Background(), l)); got != l {
+		t.Errorf("LoggerFromContext() = %v, want %v", got, l)
+	}
+}
@@ -2,10 +2,18 @@ package session
 
 import (
 	"context"
+	"fmt"
+	"sort"
 	"sync"
+	"time"
 
+	"github.com/andaru/opr8/log"
+	"github.com/andaru/opr8/metrics"
 	"github.com/andaru/opr8/transport"
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // ManagerOption is a constructor option for Manager.
@@ -14,7 +22,7 @@ type ManagerOption func(*manager)
 // NewManager returns a new session manager configured with supplied
 // options.
 func NewManager(options ...ManagerOption) Manager {
-	mgr := &manager{sessions: map[ID]Server{}, idgen: &genIncrement{}}
+	mgr := &manager{sessions: map[ID]*record{}, idgen: &genIncrement{}, logger: log.Nop(), metrics: metrics.Discard(), totals: Totals{Start: time.Now()}}
 	for _, option := range options {
 		option(mgr)
 	}
@@ -27,6 +35,133 @@ func WithAcceptor(acc ...Acceptor) ManagerOption {
 	return func(m *manager) { m.acc = append(m.acc, acc...) }
 }
 
+// WithTransportClose is a Manager option which closes the transport
+// of sessions ended by Terminate, once they are released, so the
+// client is disconnected even if the session's application does not
+// close it.
+func WithTransportClose() ManagerOption {
+	return func(m *manager) { m.closeTransport = true }
+}
+
+// WithIdleTimeout is a Manager option which terminates sessions with
+// ErrIdleTimeout when Touch has not been called for them, nor were
+// they accepted, within the duration d.
+func WithIdleTimeout(d time.Duration) ManagerOption {
+	return func(m *manager) { m.idleTimeout = d }
+}
+
+// WithMaxLifetime is a Manager option which terminates sessions with
+// ErrMaxLifetime the duration d after they are accepted.
+func WithMaxLifetime(d time.Duration) ManagerOption {
+	return func(m *manager) { m.maxLifetime = d }
+}
+
+// WithLogger is a Manager option which logs the acceptance and end of
+// sessions with the logger l. Each session has a logger adding its
+// session ID, username and transport to messages, carried by the
+// context passed to acceptors; see LoggerFromContext.
+func WithLogger(l log.Logger) ManagerOption {
+	return func(m *manager) { m.logger = l }
+}
+
+// WithTracer is a Manager option which creates OpenTelemetry spans
+// with the tracer t around the acceptance and termination of
+// sessions. The context passed to acceptors carries the accept span.
+func WithTracer(t trace.Tracer) ManagerOption {
+	return func(m *manager) { m.tracer = t }
+}
+
+// WithMetrics is a Manager option which reports the sessions accepted,
+// rejected and active, and their durations, labelled by transport
+// kind, with the registry r.
+func WithMetrics(r metrics.Registry) ManagerOption {
+	return func(m *manager) { m.metrics = metrics.OrDiscard(r) }
+}
+
+// OverflowPolicy is the policy of a manager's accept queue when it is
+// full.
+type OverflowPolicy int
+
+const (
+	// OverflowReject fails Accept calls with ErrAcceptQueueFull when
+	// the accept queue is full.
+	OverflowReject OverflowPolicy = iota
+	// OverflowWait makes Accept calls wait for room in the accept
+	// queue when it is full.
+	OverflowWait
+)
+
+// WithAcceptQueue is a Manager option which queues Accept calls for
+// the manager's acceptors, which accept one session at a time, so at
+// most size calls are waiting for, or being served by, the acceptors.
+// Further calls are handled by the overflow policy. Calls waiting in
+// the queue fail when their context is done, or after the accept
+// timeout set by WithAcceptTimeout.
+func WithAcceptQueue(size int, overflow OverflowPolicy) ManagerOption {
+	return func(m *manager) {
+		m.queue = make(chan struct{}, size)
+		m.turn = make(chan struct{}, 1)
+		m.overflow = overflow
+	}
+}
+
+// WithAcceptTimeout is a Manager option which fails Accept calls with
+// ErrAcceptTimeout when they wait in the accept queue for longer than
+// the duration d.
+func WithAcceptTimeout(d time.Duration) ManagerOption {
+	return func(m *manager) { m.acceptTimeout = d }
+}
+
+// Authorizer authorizes a session on the transport, returning an
+// error saying why it is denied, if so.
+type Authorizer func(context.Context, transport.ServerTransport) error
+
+// WithAuthorizer is a Manager option which calls the authorizer auth
+// for each transport passed to Accept before accepting a session on
+// it, so users or sources can be denied sessions, such as by a
+// deny-list or during maintenance, whatever the session's protocol.
+// Accept fails with an *AccessDeniedError if auth returns an error.
+func WithAuthorizer(auth Authorizer) ManagerOption {
+	return func(m *manager) { m.authorize = auth }
+}
+
+// AccessDeniedError is returned by Accept when the manager's
+// authorizer denies a session.
+type AccessDeniedError struct {
+	// Err is the authorizer's error.
+	Err error
+}
+
+func (e *AccessDeniedError) Error() string { return "session access denied: " + e.Err.Error() }
+
+// Unwrap returns the authorizer's error.
+func (e *AccessDeniedError) Unwrap() error { return e.Err }
+
+// DuplicateLoginPolicy is the policy of a manager accepting a session
+// for a user already holding one.
+type DuplicateLoginPolicy int
+
+const (
+	// DuplicateLoginAllow accepts any number of sessions for a user.
+	DuplicateLoginAllow DuplicateLoginPolicy = iota
+	// DuplicateLoginReject fails Accept with ErrDuplicateLogin for a
+	// user already holding a session.
+	DuplicateLoginReject
+	// DuplicateLoginTerminateOldest accepts the session of a user
+	// already holding one, terminating the user's oldest session with
+	// ErrSessionSuperseded.
+	DuplicateLoginTerminateOldest
+)
+
+// WithDuplicateLogin is a Manager option setting the policy for users
+// already holding a session, such as to allow a single management
+// session per user. Sessions without a username are always accepted.
+// The policy applies to sessions of every transport, so is unsuited to
+// managers accepting a session for each RESTCONF request or gNMI RPC.
+func WithDuplicateLogin(policy DuplicateLoginPolicy) ManagerOption {
+	return func(m *manager) { m.duplicateLogin = policy }
+}
+
 // WithIDSource is a Manager option which sets the manager's session
 // ID source to the provided IDGenerator.
 func WithIDSource(gen IDGenerator) ManagerOption {
@@ -50,19 +185,121 @@ func (gen *genIncrement) NextID() ID {
 type manager struct {
 	sync.Mutex
 	acc      []Acceptor
-	sessions map[ID]Server
+	sessions map[ID]*record
 	idgen    IDGenerator
+
+	closeTransport bool
+	idleTimeout    time.Duration
+	maxLifetime    time.Duration
+
+	logger    log.Logger
+	tracer    trace.Tracer
+	metrics   metrics.Registry
+	authorize Authorizer
+
+	duplicateLogin DuplicateLoginPolicy
+
+	// queue holds a token for each Accept call queued, and turn one
+	// for the call being served, if the accept queue is used
+	queue, turn   chan struct{}
+	overflow      OverflowPolicy
+	acceptTimeout time.Duration
+
+	// totals are the statistics of the sessions no longer tracked
+	totals Totals
+}
+
+var (
+	// ErrIdleTimeout is the error sessions are terminated with when
+	// idle for longer than the manager's idle timeout.
+	ErrIdleTimeout = errors.New("session idle timeout")
+	// ErrMaxLifetime is the error sessions are terminated with when
+	// they reach the manager's maximum session lifetime.
+	ErrMaxLifetime = errors.New("session maximum lifetime reached")
+	// ErrAcceptQueueFull is returned by Accept when the accept queue
+	// is full and its overflow policy is OverflowReject.
+	ErrAcceptQueueFull = errors.New("session accept queue full")
+	// ErrAcceptTimeout is returned by Accept when it waited in the
+	// accept queue for longer than the accept timeout.
+	ErrAcceptTimeout = errors.New("session accept timeout")
+	// ErrDuplicateLogin is returned by Accept for a user already
+	// holding a session, with the DuplicateLoginReject policy.
+	ErrDuplicateLogin = errors.New("user already holds a session")
+	// ErrSessionSuperseded is the error sessions are terminated with
+	// when their user logs in again, with the
+	// DuplicateLoginTerminateOldest policy.
+	ErrSessionSuperseded = errors.New("session superseded by a new login")
+)
+
+// record is the manager's record of a session.
+type record struct {
+	server Server
+	info   SessionInfo
+
+	// lastActivity is the time of the last Touch, or of Accept
+	lastActivity time.Time
+	// idle and lifetime expire the session, if not nil
+	idle, lifetime *time.Timer
+
+	// log is the session's logger, and span that of its acceptance
+	log  log.Logger
+	span trace.SpanContext
+
+	// onRelease are the functions called once the session ends
+	onRelease []func()
+}
+
+// transportKind returns the kind of the transport t.
+func transportKind(t transport.Transport) string {
+	if k, ok := t.(transport.Kinder); ok {
+		return k.Kind()
+	}
+	return fmt.Sprintf("%T", t)
 }
 
 const (
 	maxIDtries = 16
 )
 
+// sessionBuckets are the histogram buckets of session durations, in
+// seconds.
+var sessionBuckets = []float64{1, 10, 60, 300, 900, 3600, 4 * 3600, 24 * 3600}
+
 // Accept accepts a session using the specified transport. If no
 // session can be accepted by the system, an error is
 // returned. Otherwise, the session is started and returned to the
-// caller. It is safe to call from concurrent goroutines.
+// caller. The session is terminated with the context's error when the
+// context is done. It is safe to call from concurrent goroutines.
 func (mgr *manager) Accept(ctx context.Context, using transport.ServerTransport) (session Session, err error) {
+	kind := transportKind(using)
+	defer func() {
+		if err != nil {
+			log.Warn(mgr.logger, "session not accepted", "username", using.Username(), "transport", kind, "error", err)
+			mgr.metrics.Counter("session_rejected_total", "Sessions not accepted.", "transport", kind).Add(1)
+		}
+	}()
+	if mgr.tracer != nil {
+		var span trace.Span
+		ctx, span = mgr.tracer.Start(ctx, "session.Accept", trace.WithAttributes(
+			attribute.String("session.username", using.Username()),
+			attribute.String("session.transport", kind)))
+		defer func() {
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			} else {
+				span.SetAttributes(attribute.Int64("session.id", int64(session.ID())))
+			}
+			span.End()
+		}()
+	}
+
+	if mgr.authorize != nil {
+		if err := mgr.authorize(ctx, using); err != nil {
+			return nil, &AccessDeniedError{Err: err}
+		}
+	}
+
 	// find an acceptor for this transport type
 	var acceptor Acceptor
 	for _, acc := range mgr.acc {
@@ -74,15 +311,43 @@ func (mgr *manager) Accept(ctx context.Context, using transport.ServerTransport)
 	if acceptor == nil {
 		return nil, errors.Errorf("failed to create session using transport %T", using)
 	}
+	served, err := mgr.enqueue(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer served()
 
 	var serverSession Server
 	var id ID
+	var rec *record
+
+	// the user's session superseded by this one, ended once the
+	// critical section is left
+	var superseded *record
+	defer func() {
+		if superseded != nil {
+			mgr.end(superseded, ErrSessionSuperseded)
+		}
+	}()
 
 	// critical section
 	{
 		mgr.Lock()
 		defer mgr.Unlock()
 
+		// apply the duplicate login policy
+		var oldest *record
+		if username := using.Username(); username != "" && mgr.duplicateLogin != DuplicateLoginAllow {
+			for _, r := range mgr.sessions {
+				if r.info.Username == username && (oldest == nil || r.info.Start.Before(oldest.info.Start)) {
+					oldest = r
+				}
+			}
+		}
+		if oldest != nil && mgr.duplicateLogin == DuplicateLoginReject {
+			return nil, ErrDuplicateLogin
+		}
+
 		// get a unique, valid session ID
 		for i := 0; i < maxIDtries; i++ {
 			if id = mgr.idgen.NextID(); id != 0 && mgr.sessions[id] == nil {
@@ -93,8 +358,10 @@ func (mgr *manager) Accept(ctx context.Context, using transport.ServerTransport)
 			return nil, errors.Errorf("failed to get unique session ID after %d tries", maxIDtries)
 		}
 
-		// accept the real session from the backend
-		serverSession, err = acceptor.Accept(ctx, using, id)
+		// accept the real session from the backend, passing it
+		// the session's logger
+		l := mgr.logger.With("session-id", id, "username", using.Username(), "transport", kind)
+		serverSession, err = acceptor.Accept(NewLoggerContext(ctx, l), using, id)
 		if err != nil {
 			return nil, errors.Wrap(err, "failed to accept transport")
 		}
@@ -105,31 +372,357 @@ func (mgr *manager) Accept(ctx context.Context, using transport.ServerTransport)
 		}
 
 		// track the session
-		mgr.sessions[id] = serverSession
+		rec = &record{
+			server: serverSession,
+			info: SessionInfo{
+				ID:        id,
+				Type:      serverSession.Type(),
+				Username:  using.Username(),
+				Transport: kind,
+				Start:     time.Now(),
+			},
+			log:  l,
+			span: trace.SpanContextFromContext(ctx),
+		}
+		if tagger, ok := serverSession.(Tagger); ok {
+			rec.info.Tags = copyTags(tagger.Tags())
+		}
+		rec.lastActivity = rec.info.Start
+		mgr.sessions[id] = rec
+		mgr.totals.Sessions++
+		mgr.metrics.Gauge("sessions_active", "Sessions active.", "transport", kind).Add(1)
+		if oldest != nil {
+			mgr.remove(oldest, true)
+			superseded = oldest
+		}
+		if mgr.idleTimeout > 0 {
+			rec.idle = time.AfterFunc(mgr.idleTimeout, func() { mgr.checkIdle(rec) })
+		}
+		if mgr.maxLifetime > 0 {
+			rec.lifetime = time.AfterFunc(mgr.maxLifetime, func() { mgr.expire(rec, ErrMaxLifetime) })
+		}
 	}
 	// end critical section
 
 	go func() {
-		// delete the session when it ends
-		<-serverSession.Wait()
+		// delete the session when it ends, unless terminated and
+		// the ID reused since, or terminate it when the context is
+		// done
+		var done <-chan struct{}
+		var wait <-chan error
+		if d, ok := serverSession.(Doner); ok {
+			done = d.Done()
+		} else {
+			wait = serverSession.Wait()
+		}
+		select {
+		case <-done:
+		case <-wait:
+		case <-ctx.Done():
+			mgr.expire(rec, ctx.Err())
+			return
+		}
 		mgr.Lock()
-		delete(mgr.sessions, id)
+		removed := mgr.remove(rec, false)
 		mgr.Unlock()
+		if removed {
+			log.Info(rec.log, "session ended")
+			rec.released()
+		}
 	}()
 
 	// return the session, ready for application use
+	log.Info(rec.log, "session accepted")
+	mgr.metrics.Counter("session_accepted_total", "Sessions accepted.", "transport", kind).Add(1)
 	return serverSession, nil
 }
 
+// enqueue waits for the turn of an Accept call with the context ctx in
+// the accept queue, if used, returning a function to call once the
+// call has been served.
+func (mgr *manager) enqueue(ctx context.Context) (func(), error) {
+	if mgr.queue == nil {
+		return func() {}, nil
+	}
+	var expired <-chan time.Time
+	if mgr.acceptTimeout > 0 {
+		t := time.NewTimer(mgr.acceptTimeout)
+		defer t.Stop()
+		expired = t.C
+	}
+	wait := func(c chan struct{}) error {
+		select {
+		case c <- struct{}{}:
+			return nil
+		case <-ctx.Done():
+			return errors.Wrap(ctx.Err(), "waiting in accept queue")
+		case <-expired:
+			return ErrAcceptTimeout
+		}
+	}
+	select {
+	case mgr.queue <- struct{}{}:
+	default:
+		if mgr.overflow == OverflowReject {
+			return nil, ErrAcceptQueueFull
+		}
+		if err := wait(mgr.queue); err != nil {
+			return nil, err
+		}
+	}
+	if err := wait(mgr.turn); err != nil {
+		<-mgr.queue
+		return nil, err
+	}
+	return func() {
+		<-mgr.turn
+		<-mgr.queue
+	}, nil
+}
+
 func (mgr *manager) Terminate(id ID, with error) error {
+	mgr.Lock()
+	r, ok := mgr.sessions[id]
+	if ok {
+		mgr.remove(r, true)
+	}
+	mgr.Unlock()
+	if !ok {
+		return errors.Errorf("session %v does not exist", id)
+	}
+	mgr.end(r, with)
+	return nil
+}
+
+func (mgr *manager) TerminateAll(with error) { mgr.TerminateWhere(SessionFilter{}, with) }
+
+func (mgr *manager) TerminateWhere(filter SessionFilter, with error) {
+	now := time.Now()
+	var ended []*record
+	mgr.Lock()
+	for _, r := range mgr.sessions {
+		if filter.Match(r.info, now) {
+			mgr.remove(r, true)
+			ended = append(ended, r)
+		}
+	}
+	mgr.Unlock()
+	for _, r := range ended {
+		mgr.end(r, with)
+	}
+}
+
+// remove stops tracking the session of record r, if still tracked,
+// returning true if so, adding its statistics to the totals. The
+// caller must hold the lock.
+func (mgr *manager) remove(r *record, dropped bool) bool {
+	if mgr.sessions[r.info.ID] != r {
+		// terminated, and the ID possibly reused since
+		return false
+	}
+	delete(mgr.sessions, r.info.ID)
+	mgr.totals.add(r.stats())
+	if dropped {
+		mgr.totals.DroppedSessions++
+	}
+	kind := r.info.Transport
+	mgr.metrics.Gauge("sessions_active", "Sessions active.", "transport", kind).Add(-1)
+	mgr.metrics.Histogram("session_duration_seconds", "Durations of sessions ended.", sessionBuckets, "transport", kind).Observe(time.Since(r.info.Start).Seconds())
+	for _, t := range []*time.Timer{r.idle, r.lifetime} {
+		if t != nil {
+			t.Stop()
+		}
+	}
+	return true
+}
+
+// end ends the session of record r with the error. It is called
+// outside the critical section, as the session's application may call
+// the manager as it ends.
+func (mgr *manager) end(r *record, with error) {
+	level := log.LevelInfo
+	if with != nil {
+		level = log.LevelWarn
+	}
+	r.log.Log(level, "session terminated", "error", with)
+	if mgr.tracer != nil {
+		opts := []trace.SpanStartOption{trace.WithAttributes(attribute.Int64("session.id", int64(r.info.ID)))}
+		if r.span.IsValid() {
+			opts = append(opts, trace.WithLinks(trace.Link{SpanContext: r.span}))
+		}
+		_, span := mgr.tracer.Start(context.Background(), "session.Terminate", opts...)
+		if with != nil {
+			span.RecordError(with)
+		}
+		defer span.End()
+	}
+	if k, ok := r.server.(Killer); ok {
+		k.Kill(with)
+	} else {
+		r.server.Release()
+	}
+	if mgr.closeTransport {
+		if t := r.server.Transport(); t != nil {
+			_ = t.Close()
+		}
+	}
+	r.released()
+}
+
+// released calls the functions registered by OnRelease for the
+// session of record r, once no longer tracked.
+func (r *record) released() {
+	for i := len(r.onRelease) - 1; i >= 0; i-- {
+		r.onRelease[i]()
+	}
+}
+
+// expire terminates the session of record r with the error, if still
+// tracked.
+func (mgr *manager) expire(r *record, with error) {
+	mgr.Lock()
+	removed := mgr.remove(r, true)
+	mgr.Unlock()
+	if removed {
+		mgr.end(r, with)
+	}
+}
+
+// checkIdle expires the session of record r if idle for the idle
+// timeout, or otherwise resets its idle timer.
+func (mgr *manager) checkIdle(r *record) {
+	mgr.Lock()
+	if mgr.sessions[r.info.ID] != r {
+		mgr.Unlock()
+		return
+	}
+	if d := time.Since(r.lastActivity); d < mgr.idleTimeout {
+		r.idle.Reset(mgr.idleTimeout - d)
+		mgr.Unlock()
+		return
+	}
+	mgr.Unlock()
+	mgr.expire(r, ErrIdleTimeout)
+}
+
+func (mgr *manager) OnRelease(id ID, f func()) error {
+	mgr.Lock()
+	defer mgr.Unlock()
+	r, ok := mgr.sessions[id]
+	if !ok {
+		return errors.Errorf("session %v does not exist", id)
+	}
+	r.onRelease = append(r.onRelease, f)
+	return nil
+}
+
+func (mgr *manager) SetTag(id ID, key, value string) error {
 	mgr.Lock()
 	defer mgr.Unlock()
-	if s, ok := mgr.sessions[id]; ok {
-		// release session resources and cease tracking it
-		s.Release()
+	r, ok := mgr.sessions[id]
+	if !ok {
+		return errors.Errorf("session %v does not exist", id)
+	}
+	if value == "" {
+		delete(r.info.Tags, key)
 		return nil
 	}
-	return errors.Errorf("session %v does not exist", id)
+	if r.info.Tags == nil {
+		r.info.Tags = map[string]string{}
+	}
+	r.info.Tags[key] = value
+	return nil
+}
+
+func (mgr *manager) Tags(id ID) (map[string]string, bool) {
+	mgr.Lock()
+	defer mgr.Unlock()
+	if r, ok := mgr.sessions[id]; ok {
+		return copyTags(r.info.Tags), true
+	}
+	return nil, false
+}
+
+// copyTags returns a copy of the tags, or nil if there are none.
+func copyTags(tags map[string]string) map[string]string {
+	if len(tags) == 0 {
+		return nil
+	}
+	c := make(map[string]string, len(tags))
+	for k, v := range tags {
+		c[k] = v
+	}
+	return c
+}
+
+func (mgr *manager) Touch(id ID) {
+	mgr.Lock()
+	defer mgr.Unlock()
+	if r, ok := mgr.sessions[id]; ok {
+		r.lastActivity = time.Now()
+	}
+}
+
+func (mgr *manager) Sessions() []SessionInfo { return mgr.FindSessions(SessionFilter{}) }
+
+func (mgr *manager) FindSessions(filter SessionFilter) []SessionInfo {
+	now := time.Now()
+	mgr.Lock()
+	infos := make([]SessionInfo, 0, len(mgr.sessions))
+	for _, r := range mgr.sessions {
+		if !filter.Match(r.info, now) {
+			continue
+		}
+		info := r.info
+		info.Stats = r.stats()
+		info.Tags = copyTags(info.Tags)
+		infos = append(infos, info)
+	}
+	mgr.Unlock()
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+	return infos
+}
+
+func (mgr *manager) Totals() Totals {
+	mgr.Lock()
+	defer mgr.Unlock()
+	totals := mgr.totals
+	for _, r := range mgr.sessions {
+		totals.add(r.stats())
+	}
+	return totals
+}
+
+// stats returns the statistics of the session of record r.
+func (r *record) stats() SessionStats {
+	stats := SessionStats{LastActivity: r.lastActivity}
+	if c, ok := r.server.(RPCCounters); ok {
+		stats.InRPCs = uint64(c.InRPCs())
+		stats.InBadRPCs = uint64(c.InBadRPCs())
+		stats.OutRPCErrors = uint64(c.OutRPCErrors())
+		stats.OutNotifications = uint64(c.OutNotifications())
+	}
+	if st, ok := r.server.(Stats); ok {
+		stats.OutRPCs = uint64(st.OutRPCs())
+		stats.BytesIn = st.BytesIn()
+		stats.BytesOut = st.BytesOut()
+		if last := st.LastActivity(); last.After(stats.LastActivity) {
+			stats.LastActivity = last
+		}
+	} else if ts, ok := r.server.Transport().(transport.StatsProvider); ok {
+		t := ts.Stats()
+		stats.BytesIn, stats.BytesOut = t.BytesIn, t.BytesOut
+	}
+	return stats
+}
+
+func (mgr *manager) Get(id ID) (Session, bool) {
+	mgr.Lock()
+	defer mgr.Unlock()
+	if r, ok := mgr.sessions[id]; ok {
+		return r.server, true
+	}
+	return nil, false
 }
 
 var _ Manager = &manager{}
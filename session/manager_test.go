@@ -1,14 +1,24 @@
 package session
 
 import (
+	"bytes"
 	"context"
 	"io"
+	stdlog "log"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"math"
 
+	"github.com/andaru/opr8/log"
+	"github.com/andaru/opr8/metrics"
 	"github.com/andaru/opr8/transport"
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
 )
 
 type testSessionBase struct {
@@ -186,3 +196,813 @@ func TestManager(t *testing.T) {
 		})
 	}
 }
+
+// testServer is a server session whose Wait channel is closed by
+// Release.
+type testServer struct {
+	id   ID
+	once sync.Once
+	done chan error
+}
+
+func newTestServer(id ID) *testServer { return &testServer{id: id, done: make(chan error, 1)} }
+
+func (s *testServer) ID() ID                         { return s.id }
+func (s *testServer) Type() Type                     { return TypeServer }
+func (s *testServer) Transport() transport.Transport { return nil }
+func (s *testServer) Wait() <-chan error             { return s.done }
+func (s *testServer) Release()                       { s.once.Do(func() { close(s.done) }) }
+
+// testTransportUser is a transport with a username and kind.
+type testTransportUser struct {
+	testTransport
+	username, kind string
+}
+
+func (t *testTransportUser) Username() string { return t.username }
+func (t *testTransportUser) Kind() string     { return t.kind }
+
+// testAcceptorServer accepts sessions on any transport, made by
+// newServer if not nil, or testServer sessions.
+type testAcceptorServer struct {
+	newServer func(ID) Server
+}
+
+func (testAcceptorServer) Supported(transport.ServerTransport) bool { return true }
+func (a testAcceptorServer) Accept(_ context.Context, _ transport.ServerTransport, id ID) (Server, error) {
+	if a.newServer != nil {
+		return a.newServer(id), nil
+	}
+	return newTestServer(id), nil
+}
+
+// waitRemoved waits for the manager to stop tracking the session id.
+func waitRemoved(t *testing.T, m Manager, id ID) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if _, ok := m.Get(id); !ok {
+			return
+		}
+	}
+	t.Fatalf("session %v still tracked by the manager", id)
+}
+
+func TestManager_Sessions(t *testing.T) {
+	m := NewManager(WithAcceptor(testAcceptorServer{}))
+	if got := m.Sessions(); len(got) != 0 {
+		t.Errorf("Manager.Sessions() = %v, want none", got)
+	}
+	start := time.Now()
+	alice, err := m.Accept(context.Background(), &testTransportUser{username: "alice", kind: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, err := m.Accept(context.Background(), &testTransportFoo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := m.Sessions()
+	if len(got) != 2 {
+		t.Fatalf("Manager.Sessions() = %v, want 2 sessions", got)
+	}
+	for _, info := range got {
+		if info.Start.Before(start) || info.Start.After(time.Now()) {
+			t.Errorf("Manager.Sessions() start = %v, want the time of Accept", info.Start)
+		}
+	}
+	if want := (SessionInfo{ID: alice.ID(), Type: TypeServer, Username: "alice", Transport: "test", Start: got[0].Start, Stats: SessionStats{LastActivity: got[0].Start}}); !reflect.DeepEqual(got[0], want) {
+		t.Errorf("Manager.Sessions()[0] = %+v, want %+v", got[0], want)
+	}
+	if want := (SessionInfo{ID: bob.ID(), Type: TypeServer, Transport: "*session.testTransportFoo", Start: got[1].Start, Stats: SessionStats{LastActivity: got[1].Start}}); !reflect.DeepEqual(got[1], want) {
+		t.Errorf("Manager.Sessions()[1] = %+v, want %+v", got[1], want)
+	}
+
+	if s, ok := m.Get(alice.ID()); !ok || s != alice {
+		t.Errorf("Manager.Get() = %v, %v, want %v, true", s, ok, alice)
+	}
+	alice.Release()
+	waitRemoved(t, m, alice.ID())
+	if got := m.Sessions(); len(got) != 1 || got[0].ID != bob.ID() {
+		t.Errorf("Manager.Sessions() after Release = %v, want session %v", got, bob.ID())
+	}
+	if s, ok := m.Get(0); ok {
+		t.Errorf("Manager.Get(0) = %v, true, want false", s)
+	}
+}
+
+// testTaggedServer is a testServer with initial tags.
+type testTaggedServer struct {
+	*testServer
+	tags map[string]string
+}
+
+func (s *testTaggedServer) Tags() map[string]string { return s.tags }
+
+func TestManager_Tags(t *testing.T) {
+	m := NewManager(WithAcceptor(testAcceptorServer{newServer: func(id ID) Server {
+		if id == 1 {
+			return &testTaggedServer{testServer: newTestServer(id), tags: map[string]string{"origin": "call-home"}}
+		}
+		return newTestServer(id)
+	}}))
+	for i := 0; i < 2; i++ {
+		if _, err := m.Accept(context.Background(), &testTransportFoo{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.SetTag(1, "tenant", "blue"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.SetTag(2, "tenant", "red"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.SetTag(3, "tenant", "red"); err == nil {
+		t.Error("Manager.SetTag() of unknown session error = nil, want error")
+	}
+	want := map[string]string{"origin": "call-home", "tenant": "blue"}
+	if got, ok := m.Tags(1); !ok || !reflect.DeepEqual(got, want) {
+		t.Errorf("Manager.Tags() = %v, %v, want %v, true", got, ok, want)
+	}
+	if got := m.Sessions(); !reflect.DeepEqual(got[0].Tags, want) {
+		t.Errorf("Manager.Sessions()[0].Tags = %v, want %v", got[0].Tags, want)
+	}
+	if got := m.FindSessions(SessionFilter{Tags: map[string]string{"tenant": "red"}}); len(got) != 1 || got[0].ID != 2 {
+		t.Errorf("Manager.FindSessions() by tag = %+v, want session 2", got)
+	}
+
+	// tags returned are copies
+	tags, _ := m.Tags(2)
+	tags["tenant"] = "green"
+	if err := m.SetTag(2, "tenant", ""); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := m.Tags(2); !ok || got != nil {
+		t.Errorf("Manager.Tags() after removal = %v, %v, want nil, true", got, ok)
+	}
+}
+
+// testKillServer is a testServer which can be killed with an error.
+type testKillServer struct {
+	*testServer
+	transport *testTransportClose
+	ended     chan struct{}
+}
+
+func (s *testKillServer) Kill(err error) {
+	s.once.Do(func() {
+		if err != nil {
+			s.done <- err
+		}
+		close(s.done)
+		close(s.ended)
+	})
+}
+
+func (s *testKillServer) Release()              { s.Kill(nil) }
+func (s *testKillServer) Done() <-chan struct{} { return s.ended }
+
+func (s *testKillServer) Transport() transport.Transport { return s.transport }
+
+// testTransportClose is a transport recording whether it was closed.
+type testTransportClose struct {
+	testTransport
+	closed bool
+}
+
+func (t *testTransportClose) Close() error { t.closed = true; return nil }
+
+func TestSessionFilter_Match(t *testing.T) {
+	now := time.Now()
+	info := SessionInfo{ID: 1, Type: TypeServer, Username: "alice", Transport: "ssh", Start: now.Add(-time.Minute)}
+	for _, tt := range []struct {
+		name   string
+		filter SessionFilter
+		want   bool
+	}{
+		{name: "zero", want: true},
+		{name: "username", filter: SessionFilter{Username: "alice"}, want: true},
+		{name: "other username", filter: SessionFilter{Username: "bob"}},
+		{name: "transport", filter: SessionFilter{Username: "alice", Transport: "ssh"}, want: true},
+		{name: "other transport", filter: SessionFilter{Username: "alice", Transport: "tls"}},
+		{name: "type", filter: SessionFilter{Type: TypeServer}, want: true},
+		{name: "other type", filter: SessionFilter{Type: TypeClient}},
+		{name: "age", filter: SessionFilter{MinAge: time.Second, MaxAge: time.Hour}, want: true},
+		{name: "too young", filter: SessionFilter{MinAge: time.Hour}},
+		{name: "too old", filter: SessionFilter{MaxAge: time.Second}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Match(info, now); got != tt.want {
+				t.Errorf("SessionFilter.Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestManager_FindSessions(t *testing.T) {
+	m := NewManager(WithAcceptor(testAcceptorServer{}))
+	for _, tt := range []*testTransportUser{
+		{username: "alice", kind: "ssh"},
+		{username: "bob", kind: "ssh"},
+		{username: "alice", kind: "tls"},
+	} {
+		if _, err := m.Accept(context.Background(), tt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ids := func(infos []SessionInfo) (ids []ID) {
+		for _, info := range infos {
+			ids = append(ids, info.ID)
+		}
+		return ids
+	}
+	for _, tt := range []struct {
+		filter SessionFilter
+		want   []ID
+	}{
+		{filter: SessionFilter{}, want: []ID{1, 2, 3}},
+		{filter: SessionFilter{Username: "alice"}, want: []ID{1, 3}},
+		{filter: SessionFilter{Transport: "ssh"}, want: []ID{1, 2}},
+		{filter: SessionFilter{Username: "carol"}},
+	} {
+		if got := ids(m.FindSessions(tt.filter)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Manager.FindSessions(%+v) = %v, want %v", tt.filter, got, tt.want)
+		}
+	}
+}
+
+func TestManager_Terminate(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		options   []ManagerOption
+		kill      bool
+		err       error
+		wantErr   error
+		wantClose bool
+	}{
+		{name: "release", err: errors.New("killed")},
+		{name: "kill", kill: true, err: errors.New("killed"), wantErr: errors.New("killed")},
+		{name: "kill without error", kill: true},
+		{name: "close", options: []ManagerOption{WithTransportClose()}, kill: true, err: errors.New("killed"), wantErr: errors.New("killed"), wantClose: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var server Server
+			tr := &testTransportClose{}
+			acc := testAcceptorServer{newServer: func(id ID) Server {
+				server = newTestServer(id)
+				if tt.kill {
+					server = &testKillServer{testServer: server.(*testServer), transport: tr, ended: make(chan struct{})}
+				}
+				return server
+			}}
+			m := NewManager(append(tt.options, WithAcceptor(acc))...)
+			s, err := m.Accept(context.Background(), &testTransportFoo{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := m.Terminate(s.ID(), tt.err); err != nil {
+				t.Fatalf("Manager.Terminate() error = %v", err)
+			}
+			if _, ok := m.Get(s.ID()); ok {
+				t.Error("Manager.Get() after Terminate = true, want false")
+			}
+			if got := m.Sessions(); len(got) != 0 {
+				t.Errorf("Manager.Sessions() after Terminate = %v, want none", got)
+			}
+			var got error
+			for err := range server.Wait() {
+				got = err
+			}
+			if (got == nil) != (tt.wantErr == nil) || got != nil && got.Error() != tt.wantErr.Error() {
+				t.Errorf("Server.Wait() error = %v, want %v", got, tt.wantErr)
+			}
+			if tr.closed != tt.wantClose {
+				t.Errorf("transport closed = %v, want %v", tr.closed, tt.wantClose)
+			}
+			if err := m.Terminate(s.ID(), nil); err == nil {
+				t.Error("Manager.Terminate() of terminated session error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestManager_TerminateWhere(t *testing.T) {
+	servers := map[ID]*testKillServer{}
+	acc := testAcceptorServer{newServer: func(id ID) Server {
+		servers[id] = &testKillServer{testServer: newTestServer(id), ended: make(chan struct{})}
+		return servers[id]
+	}}
+	m := NewManager(WithAcceptor(acc))
+	for _, tt := range []*testTransportUser{
+		{username: "alice", kind: "ssh"},
+		{username: "bob", kind: "ssh"},
+		{username: "alice", kind: "tls"},
+	} {
+		if _, err := m.Accept(context.Background(), tt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wantErr := func(id ID, want error) {
+		t.Helper()
+		var got error
+		for err := range servers[id].Wait() {
+			got = err
+		}
+		if got != want {
+			t.Errorf("session %v Server.Wait() error = %v, want %v", id, got, want)
+		}
+	}
+
+	revoked := errors.New("revoked")
+	m.TerminateWhere(SessionFilter{Username: "alice"}, revoked)
+	wantErr(1, revoked)
+	wantErr(3, revoked)
+	if got := m.Sessions(); len(got) != 1 || got[0].ID != 2 {
+		t.Errorf("Manager.Sessions() after TerminateWhere = %+v, want session 2", got)
+	}
+
+	maintenance := errors.New("maintenance")
+	m.TerminateAll(maintenance)
+	wantErr(2, maintenance)
+	if got := m.Sessions(); len(got) != 0 {
+		t.Errorf("Manager.Sessions() after TerminateAll = %+v, want none", got)
+	}
+	if got := m.Totals().DroppedSessions; got != 3 {
+		t.Errorf("Manager.Totals().DroppedSessions = %d, want 3", got)
+	}
+}
+
+func TestManager_OnRelease(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		options []ManagerOption
+		end     func(m Manager, s Session)
+	}{
+		{name: "release", end: func(m Manager, s Session) { s.Release() }},
+		{name: "terminate", end: func(m Manager, s Session) { _ = m.Terminate(s.ID(), nil) }},
+		{name: "terminate all", end: func(m Manager, s Session) { m.TerminateAll(nil) }},
+		{name: "expiry", options: []ManagerOption{WithMaxLifetime(time.Millisecond)}, end: func(Manager, Session) {}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewManager(append(tt.options, WithAcceptor(testAcceptorServer{}))...)
+			s, err := m.Accept(context.Background(), &testTransportFoo{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			called := make(chan string, 2)
+			for _, name := range []string{"subscription", "lock"} {
+				name := name
+				if err := m.OnRelease(s.ID(), func() { called <- name }); err != nil {
+					t.Fatalf("Manager.OnRelease() error = %v", err)
+				}
+			}
+			tt.end(m, s)
+			for _, want := range []string{"lock", "subscription"} {
+				select {
+				case got := <-called:
+					if got != want {
+						t.Errorf("released %q, want %q", got, want)
+					}
+				case <-time.After(time.Second):
+					t.Fatalf("%q not released", want)
+				}
+			}
+			if err := m.OnRelease(s.ID(), func() {}); err == nil {
+				t.Error("Manager.OnRelease() of ended session error = nil, want error")
+			}
+		})
+	}
+}
+
+// testBlockingAcceptor accepts sessions once its gate is open.
+type testBlockingAcceptor struct{ gate chan struct{} }
+
+func (testBlockingAcceptor) Supported(transport.ServerTransport) bool { return true }
+func (a testBlockingAcceptor) Accept(_ context.Context, _ transport.ServerTransport, id ID) (Server, error) {
+	<-a.gate
+	return newTestServer(id), nil
+}
+
+func TestManager_AcceptQueue(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, tt := range []struct {
+		name    string
+		options []ManagerOption
+		queued  int
+		ctx     context.Context
+		wantErr error
+	}{
+		{name: "reject", options: []ManagerOption{WithAcceptQueue(2, OverflowReject)}, queued: 2, ctx: context.Background(), wantErr: ErrAcceptQueueFull},
+		{name: "wait timeout", options: []ManagerOption{WithAcceptQueue(1, OverflowWait), WithAcceptTimeout(20 * time.Millisecond)}, queued: 1, ctx: context.Background(), wantErr: ErrAcceptTimeout},
+		{name: "wait canceled", options: []ManagerOption{WithAcceptQueue(1, OverflowWait)}, queued: 1, ctx: canceled, wantErr: context.Canceled},
+		{name: "turn timeout", options: []ManagerOption{WithAcceptQueue(2, OverflowWait), WithAcceptTimeout(20 * time.Millisecond)}, queued: 1, ctx: context.Background(), wantErr: ErrAcceptTimeout},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			gate := make(chan struct{})
+			m := NewManager(append(tt.options, WithAcceptor(testBlockingAcceptor{gate: gate}))...)
+			errs := make(chan error, tt.queued)
+			for i := 0; i < tt.queued; i++ {
+				go func() {
+					_, err := m.Accept(context.Background(), &testTransportFoo{})
+					errs <- err
+				}()
+			}
+			for start := time.Now(); len(m.(*manager).queue) < tt.queued; time.Sleep(time.Millisecond) {
+				if time.Since(start) > time.Second {
+					t.Fatal("Accept calls not queued")
+				}
+			}
+			if _, err := m.Accept(tt.ctx, &testTransportFoo{}); errors.Cause(err) != tt.wantErr {
+				t.Errorf("Manager.Accept() error = %v, want %v", err, tt.wantErr)
+			}
+			close(gate)
+			for i := 0; i < tt.queued; i++ {
+				if err := <-errs; err != nil {
+					t.Errorf("queued Manager.Accept() error = %v", err)
+				}
+			}
+			if _, err := m.Accept(context.Background(), &testTransportFoo{}); err != nil {
+				t.Errorf("Manager.Accept() after queue drained error = %v", err)
+			}
+		})
+	}
+}
+
+func TestManager_Authorizer(t *testing.T) {
+	denied := errors.New("user denied")
+	acc := &testAcceptorCounting{}
+	m := NewManager(WithAcceptor(acc), WithAuthorizer(func(ctx context.Context, t transport.ServerTransport) error {
+		if t.Username() == "mallory" {
+			return denied
+		}
+		return nil
+	}))
+	if _, err := m.Accept(context.Background(), &testTransportUser{username: "alice"}); err != nil {
+		t.Fatalf("Manager.Accept() of authorized user error = %v", err)
+	}
+	_, err := m.Accept(context.Background(), &testTransportUser{username: "mallory"})
+	if e, ok := err.(*AccessDeniedError); !ok || e.Err != denied {
+		t.Errorf("Manager.Accept() of denied user error = %#v, want *AccessDeniedError", err)
+	}
+	if acc.supported != 1 {
+		t.Errorf("acceptor consulted %d times, want 1", acc.supported)
+	}
+}
+
+// testAcceptorCounting is a testAcceptorServer counting calls to
+// Supported.
+type testAcceptorCounting struct {
+	testAcceptorServer
+	supported int
+}
+
+func (a *testAcceptorCounting) Supported(t transport.ServerTransport) bool {
+	a.supported++
+	return true
+}
+
+func TestManager_DuplicateLogin(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		policy     DuplicateLoginPolicy
+		wantErr    error
+		wantKilled error
+		wantIDs    []ID
+	}{
+		{name: "allow", policy: DuplicateLoginAllow, wantIDs: []ID{1, 2, 3, 4, 5}},
+		{name: "reject", policy: DuplicateLoginReject, wantErr: ErrDuplicateLogin, wantIDs: []ID{1, 2, 3, 4}},
+		{name: "terminate oldest", policy: DuplicateLoginTerminateOldest, wantKilled: ErrSessionSuperseded, wantIDs: []ID{2, 3, 4, 5}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			servers := map[ID]*testKillServer{}
+			acc := testAcceptorServer{newServer: func(id ID) Server {
+				servers[id] = &testKillServer{testServer: newTestServer(id), ended: make(chan struct{})}
+				return servers[id]
+			}}
+			m := NewManager(WithAcceptor(acc), WithDuplicateLogin(tt.policy))
+			// sessions without a username are never duplicates
+			for _, tr := range []*testTransportUser{{username: "alice"}, {username: "bob"}, {}, {}} {
+				if _, err := m.Accept(context.Background(), tr); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if _, err := m.Accept(context.Background(), &testTransportUser{username: "alice"}); err != tt.wantErr {
+				t.Errorf("Manager.Accept() of second alice session error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantKilled != nil {
+				var got error
+				for err := range servers[1].Wait() {
+					got = err
+				}
+				if got != tt.wantKilled {
+					t.Errorf("oldest session Server.Wait() error = %v, want %v", got, tt.wantKilled)
+				}
+			}
+			var ids []ID
+			for _, info := range m.Sessions() {
+				ids = append(ids, info.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.wantIDs) {
+				t.Errorf("Manager.Sessions() IDs = %v, want %v", ids, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestManager_Expiry(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		options []ManagerOption
+		touch   bool
+		wantErr error
+	}{
+		{name: "idle", options: []ManagerOption{WithIdleTimeout(20 * time.Millisecond)}, wantErr: ErrIdleTimeout},
+		{name: "idle touched", options: []ManagerOption{WithIdleTimeout(60 * time.Millisecond), WithMaxLifetime(150 * time.Millisecond)}, touch: true, wantErr: ErrMaxLifetime},
+		{name: "lifetime", options: []ManagerOption{WithMaxLifetime(20 * time.Millisecond)}, wantErr: ErrMaxLifetime},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var server *testKillServer
+			acc := testAcceptorServer{newServer: func(id ID) Server {
+				server = &testKillServer{testServer: newTestServer(id), ended: make(chan struct{})}
+				return server
+			}}
+			m := NewManager(append(tt.options, WithAcceptor(acc))...)
+			start := time.Now()
+			s, err := m.Accept(context.Background(), &testTransportFoo{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.touch {
+				// keep the session active past its idle timeout
+				for i := 0; i < 5; i++ {
+					time.Sleep(20 * time.Millisecond)
+					m.Touch(s.ID())
+				}
+				if _, ok := m.Get(s.ID()); !ok {
+					t.Fatal("touched session expired")
+				}
+			}
+			var got error
+			for err := range server.Wait() {
+				got = err
+			}
+			if got != tt.wantErr {
+				t.Errorf("Server.Wait() error = %v, want %v", got, tt.wantErr)
+			}
+			if tt.touch && time.Since(start) < 150*time.Millisecond {
+				t.Errorf("session expired after %v, before its maximum lifetime", time.Since(start))
+			}
+			if _, ok := m.Get(s.ID()); ok {
+				t.Error("Manager.Get() after expiry = true, want false")
+			}
+		})
+	}
+}
+
+func TestManager_Context(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		ctx     func() (context.Context, context.CancelFunc)
+		cancel  bool
+		wantErr error
+	}{
+		{name: "cancel", ctx: func() (context.Context, context.CancelFunc) { return context.WithCancel(context.Background()) }, cancel: true, wantErr: context.Canceled},
+		{name: "deadline", ctx: func() (context.Context, context.CancelFunc) {
+			return context.WithTimeout(context.Background(), 20*time.Millisecond)
+		}, wantErr: context.DeadlineExceeded},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var server *testKillServer
+			acc := testAcceptorServer{newServer: func(id ID) Server {
+				server = &testKillServer{testServer: newTestServer(id), ended: make(chan struct{})}
+				return server
+			}}
+			m := NewManager(WithAcceptor(acc))
+			ctx, cancel := tt.ctx()
+			defer cancel()
+			s, err := m.Accept(ctx, &testTransportFoo{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.cancel {
+				cancel()
+			}
+			var got error
+			for err := range server.Wait() {
+				got = err
+			}
+			if got != tt.wantErr {
+				t.Errorf("Server.Wait() error = %v, want %v", got, tt.wantErr)
+			}
+			for start := time.Now(); len(m.Sessions()) > 0; time.Sleep(time.Millisecond) {
+				if time.Since(start) > time.Second {
+					t.Fatalf("Manager.Sessions() after context done = %+v, want none", m.Sessions())
+				}
+			}
+			if _, ok := m.Get(s.ID()); ok {
+				t.Error("Manager.Get() after context done = true, want false")
+			}
+		})
+	}
+}
+
+// testLogWriter is a log writer safe for concurrent use.
+type testLogWriter struct {
+	sync.Mutex
+	bytes.Buffer
+}
+
+func (w *testLogWriter) Write(b []byte) (int, error) {
+	w.Lock()
+	defer w.Unlock()
+	return w.Buffer.Write(b)
+}
+
+func (w *testLogWriter) String() string {
+	w.Lock()
+	defer w.Unlock()
+	return w.Buffer.String()
+}
+
+// testLoggingAcceptor logs with the context's logger as it accepts.
+type testLoggingAcceptor struct{ testAcceptorServer }
+
+func (a testLoggingAcceptor) Accept(ctx context.Context, t transport.ServerTransport, id ID) (Server, error) {
+	log.Info(LoggerFromContext(ctx), "accepting")
+	return a.testAcceptorServer.Accept(ctx, t, id)
+}
+
+func TestManager_Logger(t *testing.T) {
+	var w testLogWriter
+	m := NewManager(WithAcceptor(testLoggingAcceptor{}), WithLogger(log.NewStd(stdlog.New(&w, "", 0), log.LevelDebug)))
+	alice, err := m.Accept(context.Background(), &testTransportUser{username: "alice", kind: "ssh"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Terminate(alice.ID(), errors.New("killed")); err != nil {
+		t.Fatal(err)
+	}
+	bob, err := m.Accept(context.Background(), &testTransportUser{username: "bob", kind: "tls"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob.Release()
+	waitRemoved(t, m, bob.ID())
+	want := strings.Join([]string{
+		"info accepting session-id=1 username=alice transport=ssh",
+		"info session accepted session-id=1 username=alice transport=ssh",
+		"warn session terminated session-id=1 username=alice transport=ssh error=killed",
+		"info accepting session-id=2 username=bob transport=tls",
+		"info session accepted session-id=2 username=bob transport=tls",
+		"info session ended session-id=2 username=bob transport=tls",
+	}, "\n") + "\n"
+	for start := time.Now(); w.String() != want; time.Sleep(time.Millisecond) {
+		if time.Since(start) > time.Second {
+			t.Fatalf("logged\n%s\nwant\n%s", w.String(), want)
+		}
+	}
+}
+
+// testTracer is a tracer recording the spans it starts.
+type testTracer struct {
+	noop.Tracer
+	sync.Mutex
+	spans []string
+}
+
+func (tr *testTracer) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	config := trace.NewSpanStartConfig(opts...)
+	for _, kv := range config.Attributes() {
+		name += " " + string(kv.Key) + "=" + kv.Value.Emit()
+	}
+	tr.Lock()
+	tr.spans = append(tr.spans, name)
+	tr.Unlock()
+	return tr.Tracer.Start(ctx, name, opts...)
+}
+
+func TestManager_Tracer(t *testing.T) {
+	tr := &testTracer{}
+	m := NewManager(WithAcceptor(testAcceptorServer{}), WithTracer(tr))
+	s, err := m.Accept(context.Background(), &testTransportUser{username: "alice", kind: "ssh"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Terminate(s.ID(), nil); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"session.Accept session.username=alice session.transport=ssh",
+		"session.Terminate session.id=1",
+	}
+	if !reflect.DeepEqual(tr.spans, want) {
+		t.Errorf("spans = %q, want %q", tr.spans, want)
+	}
+}
+
+func TestManager_Metrics(t *testing.T) {
+	r := metrics.NewExpvar()
+	m := NewManager(WithAcceptor(testAcceptorServer{}), WithMetrics(r), WithDuplicateLogin(DuplicateLoginReject))
+	s, err := m.Accept(context.Background(), &testTransportUser{username: "alice", kind: "ssh"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Accept(context.Background(), &testTransportUser{username: "alice", kind: "ssh"}); err != ErrDuplicateLogin {
+		t.Fatalf("Manager.Accept() of duplicate login error = %v, want %v", err, ErrDuplicateLogin)
+	}
+	if v, _ := r.Value(`sessions_active{transport="ssh"}`); v != 1 {
+		t.Errorf("sessions_active = %v, want 1", v)
+	}
+	if err := m.Terminate(s.ID(), nil); err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]float64{
+		`session_accepted_total{transport="ssh"}`: 1,
+		`session_rejected_total{transport="ssh"}`: 1,
+		`sessions_active{transport="ssh"}`:        0,
+	} {
+		if got, ok := r.Value(key); !ok || got != want {
+			t.Errorf("%s = %v, want %v", key, got, want)
+		}
+	}
+	if !strings.Contains(r.String(), `"session_duration_seconds{transport=\"ssh\"}":{"count":1,`) {
+		t.Errorf("session_duration_seconds not observed: %s", r.String())
+	}
+}
+
+// testTransportServer is a testServer with a transport.
+type testTransportServer struct {
+	*testServer
+	transport transport.Transport
+}
+
+func (s *testTransportServer) Transport() transport.Transport { return s.transport }
+
+// testTransportDiscard is a transport discarding writes.
+type testTransportDiscard struct{ testTransport }
+
+func (t testTransportDiscard) Write(b []byte) (int, error) { return len(b), nil }
+
+func TestManager_transportStats(t *testing.T) {
+	m := NewManager(WithAcceptor(testAcceptorServer{newServer: func(id ID) Server {
+		return &testTransportServer{testServer: newTestServer(id), transport: transport.NewMetrics(testTransportDiscard{})}
+	}}))
+	s, err := m.Accept(context.Background(), &testTransportFoo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Transport().Write([]byte("<hello/>")); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.Sessions()[0].Stats.BytesOut; got != 8 {
+		t.Errorf("Manager.Sessions() BytesOut = %d, want 8", got)
+	}
+}
+
+// testStatsServer is a testKillServer reporting statistics.
+type testStatsServer struct {
+	*testKillServer
+	last time.Time
+}
+
+func (s *testStatsServer) InRPCs() uint32           { return 5 }
+func (s *testStatsServer) InBadRPCs() uint32        { return 1 }
+func (s *testStatsServer) OutRPCs() uint32          { return 4 }
+func (s *testStatsServer) OutRPCErrors() uint32     { return 2 }
+func (s *testStatsServer) OutNotifications() uint32 { return 0 }
+func (s *testStatsServer) BytesIn() uint64          { return 100 }
+func (s *testStatsServer) BytesOut() uint64         { return 200 }
+func (s *testStatsServer) LastActivity() time.Time  { return s.last }
+
+func TestManager_Totals(t *testing.T) {
+	last := time.Now().Add(time.Hour)
+	m := NewManager(WithAcceptor(testAcceptorServer{newServer: func(id ID) Server {
+		return &testStatsServer{testKillServer: &testKillServer{testServer: newTestServer(id), ended: make(chan struct{})}, last: last}
+	}}))
+	start := m.Totals().Start
+	var ids []ID
+	for i := 0; i < 3; i++ {
+		s, err := m.Accept(context.Background(), &testTransportFoo{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, s.ID())
+	}
+	want := SessionStats{InRPCs: 5, InBadRPCs: 1, OutRPCs: 4, OutRPCErrors: 2, BytesIn: 100, BytesOut: 200, LastActivity: last}
+	if got := m.Sessions()[0].Stats; got != want {
+		t.Errorf("Manager.Sessions() stats = %+v, want %+v", got, want)
+	}
+
+	// one session released, one terminated and one still tracked
+	s, _ := m.Get(ids[0])
+	s.Release()
+	waitRemoved(t, m, ids[0])
+	if err := m.Terminate(ids[1], nil); err != nil {
+		t.Fatal(err)
+	}
+	want = SessionStats{InRPCs: 15, InBadRPCs: 3, OutRPCs: 12, OutRPCErrors: 6, BytesIn: 300, BytesOut: 600, LastActivity: last}
+	if got := m.Totals(); got != (Totals{Start: start, Sessions: 3, DroppedSessions: 1, SessionStats: want}) {
+		t.Errorf("Manager.Totals() = %+v, want 3 sessions, 1 dropped and %+v", got, want)
+	}
+}
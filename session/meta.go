@@ -0,0 +1,57 @@
+package session
+
+import (
+	"crypto/tls"
+	"net"
+	"time"
+
+	"github.com/andaru/opr8/transport"
+)
+
+// Meta describes a session for audit logs and monitoring.
+type Meta struct {
+	// RemoteAddr and LocalAddr are the network addresses of the
+	// session's connection, or nil if unknown.
+	RemoteAddr, LocalAddr net.Addr
+	// LoginTime is the time the session was accepted.
+	LoginTime time.Time
+	// Protocol is the management protocol, e.g., "netconf", and
+	// Version its version, e.g., "1.1", or empty if unknown.
+	Protocol, Version string
+	// Security is the kind of transport security, e.g., "ssh" or
+	// "tls", or empty for insecure transports.
+	Security string
+	// TLS is the connection state of sessions secured by TLS, or nil.
+	TLS *tls.ConnectionState
+}
+
+// MetaProvider is the optional interface to sessions describing
+// themselves, populated by their acceptor.
+type MetaProvider interface {
+	// Meta returns the session's description.
+	Meta() Meta
+}
+
+// secureTransports are the transport kinds providing security.
+var secureTransports = map[string]bool{"ssh": true, "tls": true}
+
+// TransportMeta returns the description of a session on the transport
+// t, accepted now, with the addresses and security reported by its
+// optional transport.Addresser, transport.ConnectionStater and
+// transport.Kinder interfaces. Acceptors set the protocol and version.
+func TransportMeta(t transport.Transport) Meta {
+	meta := Meta{LoginTime: time.Now()}
+	if a, ok := t.(transport.Addresser); ok {
+		meta.RemoteAddr, meta.LocalAddr = a.RemoteAddr(), a.LocalAddr()
+	}
+	if k, ok := t.(transport.Kinder); ok && secureTransports[k.Kind()] {
+		meta.Security = k.Kind()
+	}
+	if cs, ok := t.(transport.ConnectionStater); ok {
+		if state := cs.ConnectionState(); state.HandshakeComplete {
+			meta.Security = "tls"
+			meta.TLS = &state
+		}
+	}
+	return meta
+}
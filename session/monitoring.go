@@ -0,0 +1,128 @@
+package session
+
+import (
+	"net"
+	"strconv"
+	"time"
+
+	xml "github.com/andaru/flexml"
+	"github.com/andaru/opr8/dom"
+	"github.com/andaru/opr8/modules"
+)
+
+// RPCCounters is the optional interface to server sessions counting
+// the RPCs and notifications they exchange, as reported by
+// ietf-netconf-monitoring.
+type RPCCounters interface {
+	// InRPCs returns the number of correct rpc messages received.
+	InRPCs() uint32
+	// InBadRPCs returns the number of messages received which were
+	// expected to be rpc messages but were not correct.
+	InBadRPCs() uint32
+	// OutRPCErrors returns the number of rpc-reply messages sent
+	// containing an rpc-error.
+	OutRPCErrors() uint32
+	// OutNotifications returns the number of notification messages
+	// sent.
+	OutNotifications() uint32
+}
+
+// monitoringTransports maps transport kinds to their
+// ietf-netconf-monitoring transport identities.
+var monitoringTransports = map[string]string{
+	"ssh":  "netconf-ssh",
+	"tls":  "netconf-tls",
+	"beep": "netconf-beep",
+}
+
+// MonitoringSessions returns the ietf-netconf-monitoring (RFC 6022)
+// sessions container, the /netconf-state/sessions subtree, describing
+// the NETCONF sessions of the manager m. Sessions with transports of
+// kinds other than "ssh", "tls" and "beep" are not NETCONF sessions,
+// and are not included. Counters are reported for sessions
+// implementing RPCCounters, and source hosts for sessions implementing
+// MetaProvider.
+func MonitoringSessions(m Manager) dom.Element {
+	sessions := dom.CreateElement(xml.StartElement{Name: xml.Name{Space: modules.NetconfMonitoringNamespace, Local: "sessions"}})
+	for _, info := range m.Sessions() {
+		identity, ok := monitoringTransports[info.Transport]
+		if !ok {
+			continue
+		}
+		server, ok := m.Get(info.ID)
+		if !ok {
+			// released since listed
+			continue
+		}
+		s := appendMonitoringElement(sessions, "session", "")
+		appendMonitoringElement(s, "session-id", strconv.FormatUint(uint64(info.ID), 10))
+		transport := dom.CreateElement(xml.StartElement{
+			Name: xml.Name{Space: modules.NetconfMonitoringNamespace, Local: "transport"},
+			Attr: []xml.Attr{{Name: xml.Name{Space: "xmlns", Local: "ncm"}, Value: modules.NetconfMonitoringNamespace}},
+		})
+		_ = transport.AppendChild(dom.CreateText(xml.CharData("ncm:" + identity)))
+		_ = s.AppendChild(transport)
+		appendMonitoringElement(s, "username", info.Username)
+		if mp, ok := server.(MetaProvider); ok {
+			if addr := mp.Meta().RemoteAddr; addr != nil {
+				host := addr.String()
+				if h, _, err := net.SplitHostPort(host); err == nil {
+					host = h
+				}
+				appendMonitoringElement(s, "source-host", host)
+			}
+		}
+		appendMonitoringElement(s, "login-time", info.Start.UTC().Format(time.RFC3339))
+
+		if c, ok := server.(RPCCounters); ok {
+			for _, counter := range []struct {
+				local string
+				value uint32
+			}{
+				{"in-rpcs", c.InRPCs()},
+				{"in-bad-rpcs", c.InBadRPCs()},
+				{"out-rpc-errors", c.OutRPCErrors()},
+				{"out-notifications", c.OutNotifications()},
+			} {
+				appendMonitoringElement(s, counter.local, strconv.FormatUint(uint64(counter.value), 10))
+			}
+		}
+	}
+	return sessions
+}
+
+// MonitoringStatistics returns the ietf-netconf-monitoring (RFC 6022)
+// statistics container, the /netconf-state/statistics subtree, with
+// the totals of the manager m. The totals include sessions of every
+// protocol the manager accepts sessions for.
+func MonitoringStatistics(m Manager) dom.Element {
+	totals := m.Totals()
+	statistics := dom.CreateElement(xml.StartElement{Name: xml.Name{Space: modules.NetconfMonitoringNamespace, Local: "statistics"}})
+	appendMonitoringElement(statistics, "netconf-start-time", totals.Start.UTC().Format(time.RFC3339))
+	for _, counter := range []struct {
+		local string
+		value uint64
+	}{
+		{"in-sessions", totals.Sessions},
+		{"dropped-sessions", totals.DroppedSessions},
+		{"in-rpcs", totals.InRPCs},
+		{"in-bad-rpcs", totals.InBadRPCs},
+		{"out-rpc-errors", totals.OutRPCErrors},
+		{"out-notifications", totals.OutNotifications},
+	} {
+		appendMonitoringElement(statistics, counter.local, strconv.FormatUint(counter.value, 10))
+	}
+	return statistics
+}
+
+// appendMonitoringElement appends an ietf-netconf-monitoring element
+// named local to parent, with the text value, if not empty, and
+// returns it.
+func appendMonitoringElement(parent dom.Node, local, value string) dom.Node {
+	e := dom.CreateElement(xml.StartElement{Name: xml.Name{Space: modules.NetconfMonitoringNamespace, Local: local}})
+	if value != "" {
+		_ = e.AppendChild(dom.CreateText(xml.CharData(value)))
+	}
+	_ = parent.AppendChild(e)
+	return parent.LastChild()
+}
@@ -0,0 +1,113 @@
+package session
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/andaru/opr8/dom"
+)
+
+// testCountingServer is a server session counting RPCs.
+type testCountingServer struct {
+	*testServer
+	in, inBad, outErrors, outNotifications uint32
+}
+
+func (s *testCountingServer) InRPCs() uint32           { return s.in }
+func (s *testCountingServer) InBadRPCs() uint32        { return s.inBad }
+func (s *testCountingServer) OutRPCErrors() uint32     { return s.outErrors }
+func (s *testCountingServer) OutNotifications() uint32 { return s.outNotifications }
+
+// testMetaServer is a server session with a remote address.
+type testMetaServer struct {
+	*testServer
+	remote net.Addr
+}
+
+func (s *testMetaServer) Meta() Meta { return Meta{RemoteAddr: s.remote} }
+
+func TestMonitoringSessions(t *testing.T) {
+	m := NewManager(WithAcceptor(testAcceptorServer{newServer: func(id ID) Server {
+		switch id {
+		case 1:
+			return &testCountingServer{testServer: newTestServer(id), in: 10, inBad: 1, outErrors: 2, outNotifications: 3}
+		case 2:
+			return &testMetaServer{testServer: newTestServer(id), remote: &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 830}}
+		}
+		return newTestServer(id)
+	}}))
+	for _, tt := range []*testTransportUser{
+		{username: "alice", kind: "ssh"},
+		{username: "bob", kind: "tls"},
+		{username: "carol", kind: "http"},
+	} {
+		if _, err := m.Accept(context.Background(), tt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	infos := m.Sessions()
+
+	login := func(i int) string { return infos[i].Start.UTC().Format(time.RFC3339) }
+	want := []string{
+		"/sessions/session/session-id=1",
+		"/sessions/session/transport=ncm:netconf-ssh",
+		"/sessions/session/username=alice",
+		"/sessions/session/login-time=" + login(0),
+		"/sessions/session/in-rpcs=10",
+		"/sessions/session/in-bad-rpcs=1",
+		"/sessions/session/out-rpc-errors=2",
+		"/sessions/session/out-notifications=3",
+		"/sessions/session/session-id=2",
+		"/sessions/session/transport=ncm:netconf-tls",
+		"/sessions/session/username=bob",
+		"/sessions/session/source-host=2001:db8::1",
+		"/sessions/session/login-time=" + login(1),
+	}
+	sessions := MonitoringSessions(m)
+	if got := flatten(sessions, "", nil); !reflect.DeepEqual(got, want) {
+		t.Errorf("MonitoringSessions() =\n%q\nwant\n%q", got, want)
+	}
+	if ns := sessions.Name().Space; ns != "urn:ietf:params:xml:ns:yang:ietf-netconf-monitoring" {
+		t.Errorf("MonitoringSessions() namespace = %q", ns)
+	}
+}
+
+func TestMonitoringStatistics(t *testing.T) {
+	m := NewManager(WithAcceptor(testAcceptorServer{newServer: func(id ID) Server {
+		return &testCountingServer{testServer: newTestServer(id), in: 10, inBad: 1, outErrors: 2, outNotifications: 3}
+	}}))
+	for i := 0; i < 2; i++ {
+		if _, err := m.Accept(context.Background(), &testTransportUser{kind: "ssh"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.Terminate(1, nil); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"/statistics/netconf-start-time=" + m.Totals().Start.UTC().Format(time.RFC3339),
+		"/statistics/in-sessions=2",
+		"/statistics/dropped-sessions=1",
+		"/statistics/in-rpcs=20",
+		"/statistics/in-bad-rpcs=2",
+		"/statistics/out-rpc-errors=4",
+		"/statistics/out-notifications=6",
+	}
+	if got := flatten(MonitoringStatistics(m), "", nil); !reflect.DeepEqual(got, want) {
+		t.Errorf("MonitoringStatistics() =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func flatten(n dom.Node, path string, out []string) []string {
+	path += "/" + n.Name().Local
+	if n.FirstChild() == nil || n.FirstChild().NodeType() == dom.NodeTypeText {
+		return append(out, path+"="+n.ChildValue())
+	}
+	for it := n.FirstChild(); it != nil; it = it.NextSibling() {
+		out = flatten(it, path, out)
+	}
+	return out
+}
@@ -0,0 +1,144 @@
+/*
+Package netconf has the NETCONF server session, an Acceptor for the
+session manager.
+
+Sessions exchange <hello> messages with their clients, advertising
+the capabilities of a modules.Collection and the session ID assigned
+by the manager, then pass each <rpc> element received to a Handler,
+writing the <rpc-reply> it results in.
+
+Message framing is provided by session transports: each message is
+sent with a single Write call, and a Read returns the data of no more
+than one message. The :base:1.1 capability is advertised only on
+transports implementing transport.RFC6242Framer, and chunked framing
+is enabled on them when negotiated. Transports over byte streams,
+such as SSH channels, frame messages with a transport.Framer.
+*/
+package netconf
+
+import (
+	"context"
+
+	"github.com/andaru/opr8/dom"
+	"github.com/andaru/opr8/modules"
+	"github.com/andaru/opr8/session"
+	"github.com/andaru/opr8/transport"
+	"github.com/pkg/errors"
+)
+
+// NETCONF base capability URIs and namespace.
+const (
+	// CapBase10 is the :base:1.0 capability, using end-of-message
+	// framing (RFC 4742).
+	CapBase10 = "urn:ietf:params:netconf:base:1.0"
+	// CapBase11 is the :base:1.1 capability, using chunked framing
+	// (RFC 6242).
+	CapBase11 = "urn:ietf:params:netconf:base:1.1"
+	// BaseNamespace is the XML namespace of NETCONF protocol messages.
+	BaseNamespace = "urn:ietf:params:xml:ns:netconf:base:1.0"
+)
+
+// Handler is the interface to NETCONF RPC handlers.
+type Handler interface {
+	// HandleRPC handles the <rpc> element rpc received on the session
+	// s, returning the content of the <rpc-reply>, such as a <data>
+	// element, or no nodes for an <ok/> reply. An error is reported
+	// to the client in an <rpc-error>. The context is cancelled when
+	// the session ends.
+	HandleRPC(ctx context.Context, s *Session, rpc dom.Element) ([]dom.Node, error)
+}
+
+// HandlerFunc is an adapter allowing the use of functions as a
+// Handler.
+type HandlerFunc func(ctx context.Context, s *Session, rpc dom.Element) ([]dom.Node, error)
+
+// HandleRPC calls f(ctx, s, rpc).
+func (f HandlerFunc) HandleRPC(ctx context.Context, s *Session, rpc dom.Element) ([]dom.Node, error) {
+	return f(ctx, s, rpc)
+}
+
+// ReplyError is the interface to Handler errors describing their own
+// <rpc-error> elements. Other errors, and errors describing none, are
+// reported as an application operation-failed error with their text
+// as the error-message.
+type ReplyError interface {
+	error
+	// RPCErrors returns the <rpc-error> elements of the reply.
+	RPCErrors() []dom.Element
+}
+
+// replyError returns the ReplyError err is or wraps, or nil if there
+// is none.
+func replyError(err error) ReplyError {
+	var re ReplyError
+	if errors.As(err, &re) {
+		return re
+	}
+	return nil
+}
+
+// Acceptor is the NETCONF server session acceptor. It implements
+// session.Acceptor.
+type Acceptor struct {
+	modules      *modules.Collection
+	handler      Handler
+	capabilities []string
+}
+
+// Option is a constructor option for Acceptor.
+type Option func(*Acceptor)
+
+// WithCapabilities is an Acceptor option which advertises the
+// capability URIs, such as ":candidate" or ":xpath", in addition to
+// the base and module capabilities.
+func WithCapabilities(uris ...string) Option {
+	return func(a *Acceptor) { a.capabilities = append(a.capabilities, uris...) }
+}
+
+// NewAcceptor returns a new NETCONF session acceptor advertising the
+// capabilities of the processed module collection c, and passing RPCs
+// to the handler h.
+func NewAcceptor(c *modules.Collection, h Handler, options ...Option) *Acceptor {
+	a := &Acceptor{modules: c, handler: h}
+	for _, option := range options {
+		option(a)
+	}
+	return a
+}
+
+// netconfTransports are the transport kinds NETCONF is used over.
+var netconfTransports = map[string]bool{"ssh": true, "tls": true, "beep": true}
+
+// Supported returns true for transports of the kinds "ssh", "tls" and
+// "beep", and for transports not reporting their kind.
+func (a *Acceptor) Supported(t transport.ServerTransport) bool {
+	if k, ok := t.(transport.Kinder); ok {
+		return netconfTransports[k.Kind()]
+	}
+	return true
+}
+
+// Accept starts a NETCONF server session on the transport t with the
+// session ID id. The hello exchange and RPC handling continue in the
+// background, until the client closes the transport or the session
+// is released.
+func (a *Acceptor) Accept(ctx context.Context, t transport.ServerTransport, id session.ID) (session.Server, error) {
+	caps := []string{CapBase10}
+	if _, ok := t.(transport.RFC6242Framer); ok {
+		caps = append(caps, CapBase11)
+	}
+	if a.modules != nil {
+		moduleCaps, err := a.modules.Capabilities()
+		if err != nil {
+			return nil, errors.Wrap(err, "module capabilities")
+		}
+		caps = append(caps, moduleCaps...)
+	}
+	caps = append(caps, a.capabilities...)
+
+	s := newSession(id, t, a.handler, caps)
+	go s.serve(ctx)
+	return s, nil
+}
+
+var _ session.Acceptor = &Acceptor{}
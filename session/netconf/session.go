@@ -0,0 +1,461 @@
+package netconf
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	xml "github.com/andaru/flexml"
+	"github.com/andaru/opr8/dom"
+	"github.com/andaru/opr8/log"
+	"github.com/andaru/opr8/session"
+	"github.com/andaru/opr8/transport"
+	"github.com/pkg/errors"
+)
+
+// ErrReleased is returned when writing to a released session.
+var ErrReleased = errors.New("session released")
+
+// Session is a NETCONF server session. It implements session.Server,
+// session.Killer, session.Doner, session.Stats and
+// session.MetaProvider.
+type Session struct {
+	id      session.ID
+	t       transport.ServerTransport
+	handler Handler
+	// capabilities are the capabilities advertised to the client
+	capabilities []string
+
+	// peer are the client's capabilities, set by the hello exchange
+	peer   []string
+	helloc chan struct{}
+
+	mu   sync.Mutex
+	meta session.Meta
+
+	session.Lifecycle
+	wmu sync.Mutex
+
+	inRPCs, inBadRPCs, outRPCs, outRPCErrors, outNotifications uint32
+	bytesIn, bytesOut                                          uint64
+	// lastActivity is the time an rpc was last received, in Unix
+	// nanoseconds
+	lastActivity int64
+	// closing is set to 1 when the session is to end after the reply
+	// being handled is sent
+	closing int32
+	// afterReply are called once the reply being handled is sent; it
+	// is only accessed by the session's goroutine
+	afterReply []func()
+}
+
+func newSession(id session.ID, t transport.ServerTransport, h Handler, capabilities []string) *Session {
+	meta := session.TransportMeta(t)
+	meta.Protocol = "netconf"
+	return &Session{
+		id:           id,
+		t:            t,
+		handler:      h,
+		capabilities: capabilities,
+		helloc:       make(chan struct{}),
+		meta:         meta,
+	}
+}
+
+// ID returns the session identifier.
+func (s *Session) ID() session.ID { return s.id }
+
+// Type returns session.TypeServer.
+func (s *Session) Type() session.Type { return session.TypeServer }
+
+// Transport returns the session transport.
+func (s *Session) Transport() transport.Transport { return s.t }
+
+// Username returns the client username on the session's transport.
+func (s *Session) Username() string { return s.t.Username() }
+
+// Capabilities returns the capabilities advertised by the client in
+// its <hello>, or nil if the hello exchange has not completed.
+func (s *Session) Capabilities() []string {
+	select {
+	case <-s.helloc:
+		return s.peer
+	default:
+		return nil
+	}
+}
+
+// Meta returns the session's description. Its protocol is "netconf",
+// with the version of the base protocol negotiated, "1.0" or "1.1",
+// once the hello exchange has completed.
+func (s *Session) Meta() session.Meta {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.meta
+}
+
+// InRPCs returns the number of <rpc> messages received.
+func (s *Session) InRPCs() uint32 { return atomic.LoadUint32(&s.inRPCs) }
+
+// InBadRPCs returns the number of messages received which were not
+// correct <rpc> messages.
+func (s *Session) InBadRPCs() uint32 { return atomic.LoadUint32(&s.inBadRPCs) }
+
+// OutRPCs returns the number of <rpc-reply> messages sent.
+func (s *Session) OutRPCs() uint32 { return atomic.LoadUint32(&s.outRPCs) }
+
+// OutRPCErrors returns the number of <rpc-reply> messages sent
+// containing an <rpc-error>.
+func (s *Session) OutRPCErrors() uint32 { return atomic.LoadUint32(&s.outRPCErrors) }
+
+// OutNotifications returns the number of <notification> messages sent.
+func (s *Session) OutNotifications() uint32 { return atomic.LoadUint32(&s.outNotifications) }
+
+// BytesIn returns the number of bytes read from the transport.
+func (s *Session) BytesIn() uint64 { return atomic.LoadUint64(&s.bytesIn) }
+
+// BytesOut returns the number of bytes written to the transport.
+func (s *Session) BytesOut() uint64 { return atomic.LoadUint64(&s.bytesOut) }
+
+// LastActivity returns the time an <rpc> was last received, or the
+// zero time if none has been.
+func (s *Session) LastActivity() time.Time {
+	if last := atomic.LoadInt64(&s.lastActivity); last != 0 {
+		return time.Unix(0, last)
+	}
+	return time.Time{}
+}
+
+// CloseAfterReply ends the session once the reply to the <rpc> being
+// handled is sent, as for the close-session operation. It is called by
+// a Handler.
+func (s *Session) CloseAfterReply() { atomic.StoreInt32(&s.closing, 1) }
+
+// AfterReply calls f once the reply to the <rpc> being handled is
+// sent, such as to start sending notifications which must follow it.
+// It is called by a Handler, and f is not called if the reply cannot
+// be sent.
+func (s *Session) AfterReply(f func()) { s.afterReply = append(s.afterReply, f) }
+
+// read reads from the session transport, counting the bytes read.
+func (s *Session) read(b []byte) (int, error) {
+	n, err := s.t.Read(b)
+	atomic.AddUint64(&s.bytesIn, uint64(n))
+	return n, err
+}
+
+// Write writes the message b to the client, in a single Write call to
+// the transport, returning ErrReleased if the session has ended.
+func (s *Session) Write(b []byte) error {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	select {
+	case <-s.Done():
+		return ErrReleased
+	default:
+	}
+	n, err := s.t.Write(b)
+	atomic.AddUint64(&s.bytesOut, uint64(n))
+	return err
+}
+
+// serve runs the session until it ends, ending it with the error
+// which caused it to. The context passed to the handler is cancelled
+// when the session ends.
+func (s *Session) serve(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-s.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	err := s.run(ctx)
+	if err == io.EOF || err == ErrReleased {
+		err = nil
+	}
+	if err != nil {
+		log.Warn(session.LoggerFromContext(ctx), "netconf session failed", "error", err)
+	}
+	s.Kill(err)
+}
+
+func (s *Session) run(ctx context.Context) error {
+	if err := s.Write(s.hello()); err != nil {
+		return errors.Wrap(err, "hello")
+	}
+	d := xml.NewDecoder(readerFunc(s.read))
+	if err := s.readHello(d); err != nil {
+		return err
+	}
+	for {
+		start, err := NextStartElement(d)
+		if err != nil {
+			return err
+		}
+		if start.Name != (xml.Name{Space: BaseNamespace, Local: "rpc"}) {
+			atomic.AddUint32(&s.inBadRPCs, 1)
+			if err := d.Skip(); err != nil {
+				return err
+			}
+			continue
+		}
+		rpc, err := ReadElement(d, start)
+		if err != nil {
+			return errors.Wrap(err, "malformed message")
+		}
+		atomic.StoreInt64(&s.lastActivity, time.Now().UnixNano())
+		err = s.writeReply(s.reply(ctx, rpc))
+		after := s.afterReply
+		s.afterReply = nil
+		if err != nil {
+			return err
+		}
+		for _, f := range after {
+			f()
+		}
+		if atomic.LoadInt32(&s.closing) == 1 {
+			return nil
+		}
+	}
+}
+
+// hello returns the server's <hello> message.
+func (s *Session) hello() []byte {
+	var b bytes.Buffer
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>`)
+	b.WriteString(`<hello xmlns="` + BaseNamespace + `"><capabilities>`)
+	for _, uri := range s.capabilities {
+		b.WriteString(`<capability>`)
+		_ = xml.EscapeText(&b, []byte(uri))
+		b.WriteString(`</capability>`)
+	}
+	b.WriteString(`</capabilities><session-id>` + strconv.FormatUint(uint64(s.id), 10) + `</session-id></hello>`)
+	return b.Bytes()
+}
+
+// readHello reads the client's <hello>, and negotiates the base
+// protocol version.
+func (s *Session) readHello(d *xml.Decoder) error {
+	start, err := NextStartElement(d)
+	if err != nil {
+		return errors.Wrap(err, "hello")
+	}
+	if start.Name != (xml.Name{Space: BaseNamespace, Local: "hello"}) {
+		return errors.Errorf("expected hello, got %s", start.Name.Local)
+	}
+	var hello struct {
+		Capabilities []string `xml:"capabilities>capability"`
+		SessionID    *string  `xml:"session-id"`
+	}
+	if err := d.DecodeElement(&hello, &start); err != nil {
+		return errors.Wrap(err, "hello")
+	}
+	if hello.SessionID != nil {
+		return errors.New("client hello must not contain a session-id")
+	}
+	peer := map[string]bool{}
+	for i, uri := range hello.Capabilities {
+		hello.Capabilities[i] = strings.TrimSpace(uri)
+		peer[hello.Capabilities[i]] = true
+	}
+	version := "1.0"
+	framer, chunked := s.t.(transport.RFC6242Framer)
+	switch {
+	case chunked && peer[CapBase11]:
+		if err := framer.EnableChunkedFraming(); err != nil {
+			return errors.Wrap(err, "enable chunked framing")
+		}
+		version = "1.1"
+	case !peer[CapBase10]:
+		return errors.New("no common base capability")
+	}
+	s.mu.Lock()
+	s.meta.Version = version
+	s.mu.Unlock()
+	s.peer = hello.Capabilities
+	close(s.helloc)
+	return nil
+}
+
+// reply returns the <rpc-reply> to the <rpc> element rpc.
+func (s *Session) reply(ctx context.Context, rpc dom.Element) dom.Element {
+	reply, ok := newReply(rpc)
+	if !ok {
+		atomic.AddUint32(&s.inBadRPCs, 1)
+		atomic.AddUint32(&s.outRPCErrors, 1)
+		rpcError := appendRPCError(reply, "rpc", "missing-attribute", "")
+		info := appendElement(rpcError, "error-info", "")
+		appendElement(info, "bad-attribute", "message-id")
+		appendElement(info, "bad-element", "rpc")
+		return reply
+	}
+
+	atomic.AddUint32(&s.inRPCs, 1)
+	nodes, err := s.handler.HandleRPC(ctx, s, rpc)
+	if err == nil && len(nodes) == 0 {
+		appendElement(reply, "ok", "")
+	}
+	for _, n := range nodes {
+		if err != nil {
+			break
+		}
+		err = reply.AppendChild(n)
+	}
+	if err != nil {
+		atomic.AddUint32(&s.outRPCErrors, 1)
+		reply, _ = newReply(rpc)
+		if re := replyError(err); re != nil {
+			for _, e := range re.RPCErrors() {
+				_ = reply.AppendChild(e)
+			}
+		}
+		if reply.FirstChild() == nil {
+			appendRPCError(reply, "application", "operation-failed", err.Error())
+		}
+	}
+	return reply
+}
+
+// newReply returns an empty <rpc-reply> to the <rpc> element rpc, and
+// true if the rpc has the message-id attribute.
+func newReply(rpc dom.Element) (dom.Element, bool) {
+	reply := dom.CreateElement(xml.StartElement{Name: xml.Name{Space: BaseNamespace, Local: "rpc-reply"}})
+	messageID := false
+	// the attributes of the rpc are returned in the reply
+	for a := dom.Node(rpc.FirstAttribute()); a != nil; a = a.NextSibling() {
+		name := a.Name()
+		if name.Space == "xmlns" || name.Space == "" && name.Local == "xmlns" {
+			continue
+		}
+		if name == (xml.Name{Local: "message-id"}) {
+			messageID = true
+		}
+		_ = reply.AppendAttribute(xml.Attr{Name: name, Value: a.Value()})
+	}
+	return reply, messageID
+}
+
+// appendRPCError appends an <rpc-error> to reply, with the error-type,
+// error-tag and error-message, if not empty, and returns it.
+func appendRPCError(reply dom.Node, errorType, tag, message string) dom.Node {
+	rpcError := appendElement(reply, "rpc-error", "")
+	appendElement(rpcError, "error-type", errorType)
+	appendElement(rpcError, "error-tag", tag)
+	appendElement(rpcError, "error-severity", "error")
+	if message != "" {
+		appendElement(rpcError, "error-message", message)
+	}
+	return rpcError
+}
+
+// writeReply writes the <rpc-reply> element reply to the client.
+func (s *Session) writeReply(reply dom.Element) error {
+	var b bytes.Buffer
+	if _, err := dom.NewMarshaler(reply).XMLWriter().WriteTo(&b); err != nil {
+		return errors.Wrap(err, "rpc-reply")
+	}
+	atomic.AddUint32(&s.outRPCs, 1)
+	return s.Write(b.Bytes())
+}
+
+// Notify writes the <notification> element n to the client, such as
+// for an event notification subscription, returning ErrReleased if the
+// session has ended.
+func (s *Session) Notify(n dom.Element) error {
+	var b bytes.Buffer
+	if _, err := dom.NewMarshaler(n).XMLWriter().WriteTo(&b); err != nil {
+		return errors.Wrap(err, "notification")
+	}
+	if err := s.Write(b.Bytes()); err != nil {
+		return err
+	}
+	atomic.AddUint32(&s.outNotifications, 1)
+	return nil
+}
+
+// readerFunc is an adapter allowing the use of a function as an
+// io.Reader.
+type readerFunc func([]byte) (int, error)
+
+func (f readerFunc) Read(b []byte) (int, error) { return f(b) }
+
+// NextStartElement returns the next start element read from d,
+// skipping the declarations, whitespace and comments between
+// messages. It is used by clients as well as sessions.
+func NextStartElement(d *xml.Decoder) (xml.StartElement, error) {
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return xml.StartElement{}, err
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			return tok, nil
+		case xml.CharData:
+			if len(bytes.TrimSpace(tok)) > 0 {
+				return xml.StartElement{}, errors.New("unexpected text between messages")
+			}
+		}
+	}
+}
+
+// ReadElement reads the element started by start from d, returning
+// it as a DOM element. Text is kept as sent, since leaf values may
+// have significant whitespace.
+func ReadElement(d *xml.Decoder, start xml.StartElement) (dom.Element, error) {
+	e := dom.CreateElement(start)
+	b := dom.NewBuilder(e)
+	for depth := 0; ; {
+		tok, err := d.Token()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			depth++
+			err = b.StartElement(tok)
+		case xml.EndElement:
+			if depth == 0 {
+				return e, nil
+			}
+			depth--
+			err = b.EndElement(tok)
+		case xml.CharData:
+			err = b.CharData(tok)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// appendElement appends a NETCONF base element named local to parent,
+// with the text value, if not empty, and returns it.
+func appendElement(parent dom.Node, local, value string) dom.Node {
+	e := dom.CreateElement(xml.StartElement{Name: xml.Name{Space: BaseNamespace, Local: local}})
+	if value != "" {
+		_ = e.AppendChild(dom.CreateText(xml.CharData(value)))
+	}
+	_ = parent.AppendChild(e)
+	return parent.LastChild()
+}
+
+var (
+	_ session.Server = &Session{}
+	_ session.Killer = &Session{}
+	_ session.Doner  = &Session{}
+	_ session.Stats  = &Session{}
+
+	_ session.MetaProvider = &Session{}
+)
@@ -0,0 +1,325 @@
+package netconf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	xml "github.com/andaru/flexml"
+	"github.com/andaru/opr8/dom"
+	"github.com/andaru/opr8/modules"
+	"github.com/andaru/opr8/session"
+	"github.com/andaru/opr8/transport/transporttest"
+)
+
+// testTransport is a server transport connected to a test client by
+// pipes, each client Write being read as a single message.
+type testTransport struct {
+	*io.PipeReader
+	*io.PipeWriter
+}
+
+func (t *testTransport) Close() error {
+	_ = t.PipeReader.Close()
+	return t.PipeWriter.Close()
+}
+func (t *testTransport) CloseWrite() error    { return t.PipeWriter.Close() }
+func (t *testTransport) Error() io.ReadWriter { return nil }
+func (t *testTransport) Username() string     { return "admin" }
+
+// testFramerTransport is a testTransport implementing
+// transport.RFC6242Framer.
+type testFramerTransport struct {
+	*testTransport
+	mu      sync.Mutex
+	chunked bool
+}
+
+func (t *testFramerTransport) EnableChunkedFraming() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.chunked = true
+	return nil
+}
+
+// testClient is the client end of a testTransport.
+type testClient struct {
+	r *io.PipeReader
+	w *io.PipeWriter
+}
+
+func newTestTransport() (*testTransport, *testClient) {
+	cr, sw := io.Pipe()
+	sr, cw := io.Pipe()
+	return &testTransport{PipeReader: sr, PipeWriter: sw}, &testClient{r: cr, w: cw}
+}
+
+func (c *testClient) send(t *testing.T, msg string) {
+	t.Helper()
+	if _, err := c.w.Write([]byte(msg)); err != nil {
+		t.Fatalf("client write error = %v", err)
+	}
+}
+
+func (c *testClient) receive(t *testing.T, v interface{}) {
+	t.Helper()
+	b := make([]byte, 1<<16)
+	n, err := c.r.Read(b)
+	if err != nil {
+		t.Fatalf("client read error = %v", err)
+	}
+	if err := xml.Unmarshal(b[:n], v); err != nil {
+		t.Fatalf("client received %q: %v", b[:n], err)
+	}
+}
+
+type testHello struct {
+	Capabilities []string `xml:"capabilities>capability"`
+	SessionID    string   `xml:"session-id"`
+}
+
+type testReply struct {
+	MessageID string    `xml:"message-id,attr"`
+	Extra     string    `xml:"extra,attr"`
+	OK        *struct{} `xml:"ok"`
+	Data      *struct {
+		Value string `xml:"value"`
+	} `xml:"data"`
+	Errors []struct {
+		Type         string `xml:"error-type"`
+		Tag          string `xml:"error-tag"`
+		Message      string `xml:"error-message"`
+		BadAttribute string `xml:"error-info>bad-attribute"`
+	} `xml:"rpc-error"`
+}
+
+const clientHello11 = `<?xml version="1.0" encoding="UTF-8"?>
+<hello xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><capabilities>
+  <capability>urn:ietf:params:netconf:base:1.0</capability>
+  <capability>urn:ietf:params:netconf:base:1.1</capability>
+</capabilities></hello>`
+
+// testHandler replies to <get> with data, to <fail> with an error and
+// to other operations with ok.
+var testHandler = HandlerFunc(func(ctx context.Context, s *Session, rpc dom.Element) ([]dom.Node, error) {
+	op := rpc.FirstChild()
+	for op != nil && op.NodeType() != dom.NodeTypeElement {
+		op = op.NextSibling()
+	}
+	if op == nil {
+		return nil, errors.New("no operation")
+	}
+	switch op.Name().Local {
+	case "get":
+		data := dom.CreateElement(xml.StartElement{Name: xml.Name{Space: BaseNamespace, Local: "data"}})
+		value := dom.CreateElement(xml.StartElement{Name: xml.Name{Space: "urn:test", Local: "value"}})
+		_ = value.AppendChild(dom.CreateText(xml.CharData(op.ChildValue())))
+		_ = data.AppendChild(value)
+		return []dom.Node{data}, nil
+	case "fail":
+		return nil, errors.New("operation failed")
+	case "deny":
+		return nil, fmt.Errorf("deny: %w", testReplyError{})
+	}
+	return nil, nil
+})
+
+// testReplyError is an access-denied ReplyError.
+type testReplyError struct{}
+
+func (testReplyError) Error() string { return "access denied" }
+
+func (testReplyError) RPCErrors() []dom.Element {
+	rpcError := dom.CreateElement(xml.StartElement{Name: xml.Name{Space: BaseNamespace, Local: "rpc-error"}})
+	for _, child := range [][2]string{{"error-type", "protocol"}, {"error-tag", "access-denied"}, {"error-severity", "error"}} {
+		appendElement(rpcError, child[0], child[1])
+	}
+	return []dom.Element{rpcError}
+}
+
+func testCollection(t *testing.T) *modules.Collection {
+	t.Helper()
+	c := modules.NewCollection()
+	if err := c.ReadString("nc-test", `module nc-test {
+  namespace "urn:nc:test"; prefix nt;
+  revision 2020-01-01;
+  leaf value { type string; }
+}`); err != nil {
+		t.Fatal(err)
+	}
+	if errs := c.Process(); errs != nil {
+		t.Fatal(errs)
+	}
+	return c
+}
+
+func TestSession(t *testing.T) {
+	c := testCollection(t)
+	modCaps, err := c.Capabilities()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr, client := newTestTransport()
+	ftr := &testFramerTransport{testTransport: tr}
+	acc := NewAcceptor(c, testHandler, WithCapabilities("urn:ietf:params:netconf:capability:candidate:1.0"))
+	m := session.NewManager(session.WithAcceptor(acc))
+	s, err := m.Accept(context.Background(), ftr)
+	if err != nil {
+		t.Fatalf("Manager.Accept() error = %v", err)
+	}
+	ns := s.(*Session)
+
+	var hello testHello
+	client.receive(t, &hello)
+	wantCaps := append([]string{CapBase10, CapBase11}, modCaps...)
+	wantCaps = append(wantCaps, "urn:ietf:params:netconf:capability:candidate:1.0")
+	if !reflect.DeepEqual(hello.Capabilities, wantCaps) {
+		t.Errorf("hello capabilities = %q, want %q", hello.Capabilities, wantCaps)
+	}
+	if hello.SessionID != "1" {
+		t.Errorf("hello session-id = %q, want %q", hello.SessionID, "1")
+	}
+
+	client.send(t, clientHello11)
+	var reply testReply
+	client.send(t, `<rpc xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="101" extra="x"><get>a &amp; b</get></rpc>`)
+	client.receive(t, &reply)
+	if reply.MessageID != "101" || reply.Extra != "x" || reply.Data == nil || reply.Data.Value != "a & b" {
+		t.Errorf("get reply = %+v, want message-id 101, extra x and data value %q", reply, "a & b")
+	}
+	ftr.mu.Lock()
+	if !ftr.chunked {
+		t.Error("chunked framing not enabled after :base:1.1 negotiation")
+	}
+	ftr.mu.Unlock()
+	if meta := ns.Meta(); meta.Protocol != "netconf" || meta.Version != "1.1" || meta.LoginTime.IsZero() {
+		t.Errorf("Session.Meta() = %+v, want netconf 1.1", meta)
+	}
+	if got := ns.Capabilities(); !reflect.DeepEqual(got, []string{CapBase10, CapBase11}) {
+		t.Errorf("Session.Capabilities() = %q", got)
+	}
+
+	for _, tt := range []struct {
+		rpc     string
+		wantOK  bool
+		wantTag string
+	}{
+		{rpc: `<rpc xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="102"><lock/></rpc>`, wantOK: true},
+		{rpc: `<rpc xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="103"><fail/></rpc>`, wantTag: "operation-failed"},
+		{rpc: `<rpc xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="104"><deny/></rpc>`, wantTag: "access-denied"},
+		{rpc: `<rpc xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><get/></rpc>`, wantTag: "missing-attribute"},
+	} {
+		reply = testReply{}
+		client.send(t, tt.rpc)
+		client.receive(t, &reply)
+		if (reply.OK != nil) != tt.wantOK {
+			t.Errorf("%s: reply ok = %v, want %v", tt.rpc, reply.OK != nil, tt.wantOK)
+		}
+		if tt.wantTag == "" && len(reply.Errors) > 0 || tt.wantTag != "" && (len(reply.Errors) != 1 || reply.Errors[0].Tag != tt.wantTag) {
+			t.Errorf("%s: reply errors = %+v, want tag %q", tt.rpc, reply.Errors, tt.wantTag)
+		}
+	}
+
+	if got := [5]uint32{ns.InRPCs(), ns.InBadRPCs(), ns.OutRPCs(), ns.OutRPCErrors(), ns.OutNotifications()}; got != [5]uint32{4, 1, 5, 3, 0} {
+		t.Errorf("session counters = %v, want %v", got, [5]uint32{4, 1, 5, 3, 0})
+	}
+	if ns.BytesIn() == 0 || ns.BytesOut() == 0 || ns.LastActivity().IsZero() {
+		t.Errorf("session bytes in %d, out %d, last activity %v, want non-zero", ns.BytesIn(), ns.BytesOut(), ns.LastActivity())
+	}
+	if stats := m.Sessions()[0].Stats; stats.OutRPCs != 5 || stats.BytesIn != ns.BytesIn() {
+		t.Errorf("Manager.Sessions() stats = %+v", stats)
+	}
+
+	_ = client.w.Close()
+	for err := range s.(session.Server).Wait() {
+		t.Errorf("Session.Wait() error = %v after client close, want none", err)
+	}
+}
+
+func TestSession_helloErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		framer  bool
+		hello   string
+		wantErr string
+	}{
+		{
+			name:    "base:1.1 without framing",
+			hello:   `<hello xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><capabilities><capability>urn:ietf:params:netconf:base:1.1</capability></capabilities></hello>`,
+			wantErr: "no common base capability",
+		},
+		{
+			name:    "session-id",
+			framer:  true,
+			hello:   `<hello xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><capabilities><capability>urn:ietf:params:netconf:base:1.1</capability></capabilities><session-id>4</session-id></hello>`,
+			wantErr: "session-id",
+		},
+		{
+			name:    "not hello",
+			hello:   `<rpc xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="1"><get/></rpc>`,
+			wantErr: "expected hello",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			tr, client := newTestTransport()
+			acc := NewAcceptor(nil, testHandler)
+			var s session.Server
+			var err error
+			if tt.framer {
+				s, err = acc.Accept(context.Background(), &testFramerTransport{testTransport: tr}, 7)
+			} else {
+				s, err = acc.Accept(context.Background(), tr, 7)
+			}
+			if err != nil {
+				t.Fatalf("Acceptor.Accept() error = %v", err)
+			}
+			var hello testHello
+			client.receive(t, &hello)
+			if hello.SessionID != "7" {
+				t.Errorf("hello session-id = %q, want %q", hello.SessionID, "7")
+			}
+			client.send(t, tt.hello)
+			var got error
+			for err := range s.Wait() {
+				got = err
+			}
+			if got == nil || !strings.Contains(got.Error(), tt.wantErr) {
+				t.Errorf("Session.Wait() error = %v, want error containing %q", got, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSession_partialReads(t *testing.T) {
+	client, server := transporttest.Pipe(transporttest.WithUsername("admin"), transporttest.WithMaxRead(5))
+	s, err := NewAcceptor(nil, testHandler).Accept(context.Background(), server, 3)
+	if err != nil {
+		t.Fatalf("Acceptor.Accept() error = %v", err)
+	}
+	d := xml.NewDecoder(client)
+	var hello testHello
+	if err := d.Decode(&hello); err != nil || hello.SessionID != "3" {
+		t.Fatalf("client hello = %+v, %v, want session-id 3", hello, err)
+	}
+	for _, msg := range []string{
+		`<hello xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><capabilities><capability>urn:ietf:params:netconf:base:1.0</capability></capabilities></hello>`,
+		`<rpc xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="1"><get>value</get></rpc>`,
+	} {
+		if _, err := client.Write([]byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var reply testReply
+	if err := d.Decode(&reply); err != nil || reply.MessageID != "1" || reply.Data == nil || reply.Data.Value != "value" {
+		t.Errorf("get reply = %+v, %v, want message-id 1 and data value %q", reply, err, "value")
+	}
+	_ = client.CloseWrite()
+	for err := range s.Wait() {
+		t.Errorf("Session.Wait() error = %v after client close, want none", err)
+	}
+}
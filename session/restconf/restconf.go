@@ -0,0 +1,207 @@
+/*
+Package restconf has the RESTCONF server session, an Acceptor for the
+session manager modelling each HTTP request as a short-lived session.
+
+Handler accepts a session for each request it serves, so RESTCONF
+requests are tracked and limited by the manager as sessions of other
+protocols are, and releases it when the request has been served.
+*/
+package restconf
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+
+	"github.com/andaru/opr8/session"
+	"github.com/andaru/opr8/transport"
+)
+
+// Transport is the server transport of a RESTCONF request. Reads read
+// the request body, and writes write the response body.
+type Transport struct {
+	w        http.ResponseWriter
+	r        *http.Request
+	username string
+}
+
+// NewTransport returns the transport of the request r, responded to
+// with w, made by the authenticated user username.
+func NewTransport(w http.ResponseWriter, r *http.Request, username string) *Transport {
+	return &Transport{w: w, r: r, username: username}
+}
+
+// Read reads the request body.
+func (t *Transport) Read(b []byte) (int, error) { return t.r.Body.Read(b) }
+
+// Write writes the response body.
+func (t *Transport) Write(b []byte) (int, error) { return t.w.Write(b) }
+
+// CloseWrite flushes the response written so far to the client.
+func (t *Transport) CloseWrite() error {
+	if f, ok := t.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+// Close closes the request body.
+func (t *Transport) Close() error { return t.r.Body.Close() }
+
+// Error returns nil; RESTCONF transports have no error channel.
+func (t *Transport) Error() io.ReadWriter { return nil }
+
+// Username returns the authenticated username of the request.
+func (t *Transport) Username() string { return t.username }
+
+// Kind returns "restconf".
+func (t *Transport) Kind() string { return "restconf" }
+
+// RemoteAddr returns the network address of the client, or nil if
+// unknown.
+func (t *Transport) RemoteAddr() net.Addr {
+	addr, err := net.ResolveTCPAddr("tcp", t.r.RemoteAddr)
+	if err != nil {
+		return nil
+	}
+	return addr
+}
+
+// LocalAddr returns the network address the request was received on,
+// or nil if unknown.
+func (t *Transport) LocalAddr() net.Addr {
+	addr, _ := t.r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	return addr
+}
+
+// ConnectionState returns the TLS connection state of the request,
+// the zero state if it was not received over TLS.
+func (t *Transport) ConnectionState() tls.ConnectionState {
+	if t.r.TLS == nil {
+		return tls.ConnectionState{}
+	}
+	return *t.r.TLS
+}
+
+// Request returns the HTTP request.
+func (t *Transport) Request() *http.Request { return t.r }
+
+// ResponseWriter returns the HTTP response writer of the request.
+func (t *Transport) ResponseWriter() http.ResponseWriter { return t.w }
+
+// Acceptor is the RESTCONF session acceptor. It implements
+// session.Acceptor, accepting sessions on RESTCONF Transports.
+type Acceptor struct{}
+
+// NewAcceptor returns a new RESTCONF session acceptor.
+func NewAcceptor() *Acceptor { return &Acceptor{} }
+
+// Supported returns true if t is a RESTCONF Transport.
+func (a *Acceptor) Supported(t transport.ServerTransport) bool {
+	_, ok := t.(*Transport)
+	return ok
+}
+
+// Accept returns a new session for the RESTCONF request transport t
+// with the session ID id. The session lasts until it is released, such
+// as by Handler once the request has been served.
+func (a *Acceptor) Accept(ctx context.Context, t transport.ServerTransport, id session.ID) (session.Server, error) {
+	tr := t.(*Transport)
+	meta := session.TransportMeta(tr)
+	meta.Protocol, meta.Version = "restconf", tr.r.Proto
+	s := &Session{id: id, t: tr, meta: meta}
+	return s, nil
+}
+
+// Session is a RESTCONF server session, lasting for one request. It
+// implements session.Server, session.Killer, session.Doner and
+// session.MetaProvider.
+type Session struct {
+	id   session.ID
+	t    *Transport
+	meta session.Meta
+	session.Lifecycle
+}
+
+// ID returns the session identifier.
+func (s *Session) ID() session.ID { return s.id }
+
+// Type returns session.TypeServer.
+func (s *Session) Type() session.Type { return session.TypeServer }
+
+// Transport returns the session transport, a *Transport.
+func (s *Session) Transport() transport.Transport { return s.t }
+
+// Meta returns the session's description. Its protocol is "restconf",
+// with the HTTP version of the request, e.g., "HTTP/1.1".
+func (s *Session) Meta() session.Meta { return s.meta }
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying the session s.
+func NewContext(ctx context.Context, s *Session) context.Context {
+	return context.WithValue(ctx, contextKey{}, s)
+}
+
+// FromContext returns the session carried by ctx, and true, or false
+// if it carries none.
+func FromContext(ctx context.Context) (*Session, bool) {
+	s, ok := ctx.Value(contextKey{}).(*Session)
+	return s, ok
+}
+
+// Handler returns an HTTP handler accepting a session from the manager
+// m for each request, made by the user returned by username, and
+// serving the request with next. The session is carried by the
+// request's context, which is cancelled if the session is terminated.
+// The session is released when next returns. Requests are responded
+// to with 503 Service Unavailable if the manager cannot accept a
+// session, such as when the number of sessions is limited, or with 403
+// Forbidden if the manager's authorizer denies it.
+//
+// The manager must have a restconf Acceptor registered.
+func Handler(m session.Manager, username func(*http.Request) string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accepted, err := m.Accept(r.Context(), NewTransport(w, r, username(r)))
+		if _, ok := err.(*session.AccessDeniedError); ok {
+			http.Error(w, "access denied", http.StatusForbidden)
+			return
+		}
+		if err != nil {
+			http.Error(w, "session unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		s, ok := accepted.(*Session)
+		if !ok {
+			accepted.Release()
+			http.Error(w, "session unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		defer s.Release()
+
+		ctx, cancel := context.WithCancel(NewContext(r.Context(), s))
+		defer cancel()
+		go func() {
+			select {
+			case <-s.Done():
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+var (
+	_ session.Acceptor           = &Acceptor{}
+	_ session.Server             = &Session{}
+	_ session.Killer             = &Session{}
+	_ session.Doner              = &Session{}
+	_ session.MetaProvider       = &Session{}
+	_ transport.ServerTransport  = &Transport{}
+	_ transport.Kinder           = &Transport{}
+	_ transport.Addresser        = &Transport{}
+	_ transport.ConnectionStater = &Transport{}
+)
@@ -0,0 +1,125 @@
+package restconf
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andaru/opr8/session"
+	"github.com/andaru/opr8/transport"
+)
+
+func basicUsername(r *http.Request) string {
+	username, _, _ := r.BasicAuth()
+	return username
+}
+
+func TestHandler(t *testing.T) {
+	m := session.NewManager(session.WithAcceptor(NewAcceptor()))
+	var during []session.SessionInfo
+	var meta session.Meta
+	h := Handler(m, basicUsername, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s, ok := FromContext(r.Context())
+		if !ok {
+			t.Error("FromContext() = false, want true")
+			return
+		}
+		during = m.Sessions()
+		meta = s.Meta()
+		body, _ := ioutil.ReadAll(s.Transport())
+		_, _ = s.Transport().Write([]byte(strings.ToUpper(string(body))))
+	}))
+
+	for i := 1; i <= 2; i++ {
+		r := httptest.NewRequest("POST", "/restconf/data", strings.NewReader("body"))
+		r.SetBasicAuth("admin", "secret")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if got := w.Body.String(); got != "BODY" {
+			t.Errorf("response body = %q, want %q", got, "BODY")
+		}
+		if len(during) != 1 || during[0].ID != session.ID(i) || during[0].Username != "admin" || during[0].Transport != "restconf" {
+			t.Errorf("Manager.Sessions() during request %d = %+v", i, during)
+		}
+		if meta.Protocol != "restconf" || meta.Version != "HTTP/1.1" || meta.RemoteAddr == nil || meta.RemoteAddr.String() != r.RemoteAddr || meta.Security != "" {
+			t.Errorf("Session.Meta() = %+v, want restconf HTTP/1.1 from %s", meta, r.RemoteAddr)
+		}
+		for start := time.Now(); len(m.Sessions()) > 0; time.Sleep(time.Millisecond) {
+			if time.Since(start) > time.Second {
+				t.Fatalf("Manager.Sessions() after request = %+v, want none", m.Sessions())
+			}
+		}
+	}
+}
+
+func TestHandler_terminate(t *testing.T) {
+	m := session.NewManager(session.WithAcceptor(NewAcceptor()))
+	killed := errors.New("killed")
+	var got error
+	h := Handler(m, basicUsername, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s, _ := FromContext(r.Context())
+		if err := m.Terminate(s.ID(), killed); err != nil {
+			t.Errorf("Manager.Terminate() error = %v", err)
+		}
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+			t.Error("request context not done after Terminate")
+		}
+		got = <-s.Wait()
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/restconf/data", nil))
+	if got != killed {
+		t.Errorf("Session.Wait() error = %v, want %v", got, killed)
+	}
+}
+
+func TestHandler_unavailable(t *testing.T) {
+	m := session.NewManager()
+	h := Handler(m, basicUsername, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler called without a session")
+	}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/restconf/data", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("response status = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestHandler_denied(t *testing.T) {
+	m := session.NewManager(session.WithAcceptor(NewAcceptor()), session.WithAuthorizer(func(ctx context.Context, t transport.ServerTransport) error {
+		return errors.New("maintenance")
+	}))
+	h := Handler(m, basicUsername, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler called without a session")
+	}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/restconf/data", nil))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("response status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
+
+func TestAcceptor_context(t *testing.T) {
+	m := session.NewManager(session.WithAcceptor(NewAcceptor()))
+	ctx, cancel := context.WithCancel(context.Background())
+	r := httptest.NewRequest("GET", "/restconf/data", nil)
+	s, err := m.Accept(ctx, NewTransport(httptest.NewRecorder(), r, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	select {
+	case err := <-s.(*Session).Wait():
+		if err != context.Canceled {
+			t.Errorf("Session.Wait() error = %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(time.Second):
+		t.Error("session not terminated when context done")
+	}
+}
@@ -0,0 +1,129 @@
+package session
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/andaru/opr8/transport"
+)
+
+// Serve accepts connections from the listener l until the context is
+// done, starting a session with the manager mgr for each over the
+// transport returned by factory, such as a transport.Conn or a
+// transport.Framer over one. Connections for which factory returns
+// nil are closed.
+//
+// Sessions are accepted with the context, so are terminated when it
+// is done, and each session's transport is closed when the session
+// ends, as is that of a session not accepted. Temporary listener
+// errors are retried after a delay, as net/http does. Serve closes
+// the listener and returns the context's error when the context is
+// done, or the listener's error if it fails, once no more sessions are
+// being accepted.
+func Serve(ctx context.Context, l net.Listener, factory func(net.Conn) transport.ServerTransport, mgr Manager) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = l.Close()
+		case <-stop:
+		}
+	}()
+
+	var delay time.Duration
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				if delay == 0 {
+					delay = 5 * time.Millisecond
+				} else if delay *= 2; delay > time.Second {
+					delay = time.Second
+				}
+				select {
+				case <-time.After(delay):
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+				continue
+			}
+			return err
+		}
+		delay = 0
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			serveConn(ctx, conn, factory, mgr)
+		}()
+	}
+}
+
+// serveConn starts a session with the manager for the connection.
+func serveConn(ctx context.Context, conn net.Conn, factory func(net.Conn) transport.ServerTransport, mgr Manager) {
+	t := factory(conn)
+	if t == nil {
+		_ = conn.Close()
+		return
+	}
+	serveTransport(ctx, t, mgr)
+}
+
+// serveTransport starts a session with the manager over the transport,
+// closing the transport when the session ends, or if not accepted.
+func serveTransport(ctx context.Context, t transport.ServerTransport, mgr Manager) {
+	s, err := mgr.Accept(ctx, t)
+	if err != nil {
+		_ = t.Close()
+		return
+	}
+	if err := mgr.OnRelease(s.ID(), func() { _ = t.Close() }); err != nil {
+		// the session has already ended
+		_ = t.Close()
+	}
+}
+
+// ServeMux starts a session with the manager mgr over each channel
+// opened by the peer of the mux, such as separate RPC and notification
+// channels, until the context is done. Sessions and their channels end
+// as those started by Serve do. ServeMux closes the mux and returns the
+// context's error when the context is done, or the error the mux ended
+// with, io.EOF if its transport ended, once no more sessions are being
+// accepted.
+func ServeMux(ctx context.Context, mux *transport.Mux, mgr Manager) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = mux.Close()
+		case <-stop:
+		}
+	}()
+
+	for {
+		c, err := mux.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			serveTransport(ctx, c, mgr)
+		}()
+	}
+}
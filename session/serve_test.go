@@ -0,0 +1,177 @@
+package session
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/andaru/opr8/transport"
+	"github.com/pkg/errors"
+)
+
+// waitSessions waits for the manager to track n sessions, returning
+// them.
+func waitSessions(t *testing.T, m Manager, n int) []SessionInfo {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if got := m.Sessions(); len(got) == n {
+			return got
+		}
+	}
+	t.Fatalf("manager has %d sessions, want %d", len(m.Sessions()), n)
+	return nil
+}
+
+// readEOF checks the connection c is closed by the peer.
+func readEOF(t *testing.T, c net.Conn) {
+	t.Helper()
+	_ = c.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := ioutil.ReadAll(c); err != nil {
+		t.Errorf("client read error = %v, want EOF", err)
+	}
+}
+
+func TestServe(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewManager(WithAcceptor(testAcceptorServer{}))
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- Serve(ctx, l, func(c net.Conn) transport.ServerTransport { return transport.NewConn(c, "admin") }, m)
+	}()
+
+	c1, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c1.Close()
+	sessions := waitSessions(t, m, 1)
+	if s := sessions[0]; s.Username != "admin" || s.Transport != "tcp" {
+		t.Errorf("session username, transport = %q, %q, want %q, %q", s.Username, s.Transport, "admin", "tcp")
+	}
+	// the transport is closed when the session ends
+	if err := m.Terminate(sessions[0].ID, nil); err != nil {
+		t.Fatal(err)
+	}
+	readEOF(t, c1)
+
+	c2, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c2.Close()
+	waitSessions(t, m, 1)
+
+	// sessions end when the context is done
+	cancel()
+	select {
+	case err := <-served:
+		if err != context.Canceled {
+			t.Errorf("Serve() error = %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Serve() did not return when the context was done")
+	}
+	waitSessions(t, m, 0)
+	readEOF(t, c2)
+	if c, err := net.Dial("tcp", l.Addr().String()); err == nil {
+		_ = c.Close()
+		t.Error("listener not closed by Serve")
+	}
+}
+
+func TestServe_notAccepted(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewManager(WithAcceptor(testAcceptorServer{}), WithAuthorizer(func(context.Context, transport.ServerTransport) error {
+		return errors.New("denied")
+	}))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		_ = Serve(ctx, l, func(c net.Conn) transport.ServerTransport { return transport.NewConn(c, "") }, m)
+	}()
+
+	c, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	readEOF(t, c)
+	if got := m.Sessions(); len(got) != 0 {
+		t.Errorf("Manager.Sessions() = %v, want none", got)
+	}
+}
+
+func TestServeMux(t *testing.T) {
+	c, s := net.Pipe()
+	client := transport.NewMux(transport.NewConn(c, ""))
+	defer client.Close()
+	m := NewManager(WithAcceptor(testAcceptorServer{}))
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- ServeMux(ctx, transport.NewMux(transport.NewConn(s, "admin")), m) }()
+
+	for id := uint32(1); id <= 2; id++ {
+		ch, err := client.Open(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ch.Write([]byte("<hello/>")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, s := range waitSessions(t, m, 2) {
+		if s.Username != "admin" || s.Transport != "pipe" {
+			t.Errorf("session username, transport = %q, %q, want %q, %q", s.Username, s.Transport, "admin", "pipe")
+		}
+	}
+
+	cancel()
+	select {
+	case err := <-served:
+		if err != context.Canceled {
+			t.Errorf("ServeMux() error = %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("ServeMux() did not return when the context was done")
+	}
+	waitSessions(t, m, 0)
+}
+
+// testTempError is a temporary net.Error.
+type testTempError struct{}
+
+func (testTempError) Error() string   { return "temporary" }
+func (testTempError) Timeout() bool   { return false }
+func (testTempError) Temporary() bool { return true }
+
+// testListener is a listener returning its errors in turn.
+type testListener struct {
+	net.Listener
+	errs []error
+}
+
+func (l *testListener) Accept() (net.Conn, error) {
+	err := l.errs[0]
+	l.errs = l.errs[1:]
+	return nil, err
+}
+
+func (l *testListener) Close() error { return nil }
+
+func TestServe_listenerErrors(t *testing.T) {
+	failed := errors.New("failed")
+	l := &testListener{errs: []error{testTempError{}, testTempError{}, failed}}
+	m := NewManager(WithAcceptor(testAcceptorServer{}))
+	if err := Serve(context.Background(), l, nil, m); err != failed {
+		t.Errorf("Serve() error = %v, want %v", err, failed)
+	}
+}
@@ -3,6 +3,7 @@ package session
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/andaru/opr8/transport"
 )
@@ -90,6 +91,46 @@ type Server interface {
 	Wait() <-chan error
 }
 
+// Killer is the optional interface to server sessions which can be
+// ended with an error.
+type Killer interface {
+	// Kill ends the session as Release does, but first sends err, if
+	// not nil, to the session's Wait channel.
+	Kill(err error)
+}
+
+// Doner is the optional interface to server sessions reporting their
+// end other than by their Wait channel. The manager watches the Done
+// channel of such sessions, rather than receiving from their Wait
+// channel, so any error sent there by Kill is left for the session's
+// application to receive.
+type Doner interface {
+	// Done returns a channel closed when the session is released.
+	Done() <-chan struct{}
+}
+
+// Tagger is the optional interface to server sessions labelled by
+// their acceptor, such as with the tenant of the transport's client.
+type Tagger interface {
+	// Tags returns the session's initial tags.
+	Tags() map[string]string
+}
+
+// Stats is the optional interface to server sessions reporting their
+// statistics, aggregated by the Manager.
+type Stats interface {
+	RPCCounters
+	// OutRPCs returns the number of rpc-reply messages sent.
+	OutRPCs() uint32
+	// BytesIn returns the number of bytes read from the transport.
+	BytesIn() uint64
+	// BytesOut returns the number of bytes written to the transport.
+	BytesOut() uint64
+	// LastActivity returns the time a message was last received, or
+	// the zero time if none has been.
+	LastActivity() time.Time
+}
+
 // Manager is the server session manager interface.
 //
 // Sessions received from this interface are assigned by transports to
@@ -99,14 +140,169 @@ type Manager interface {
 	// session for the provided transport using the context. The
 	// session manager tracks the session and manages session
 	// resources, releasing references automatically upon completion
-	// of the accepted session. Accept returns an error if the system
+	// of the accepted session. The session is terminated with the
+	// context's error, context.Canceled or context.DeadlineExceeded,
+	// when the context is done. Accept returns an error if the system
 	// is presently unable to service a new session.
 	Accept(context.Context, transport.ServerTransport) (Session, error)
 
 	// Terminate ends a session by ID as soon as possible with the
-	// provided error. Terminate returns in error if the session did
-	// not exist.
+	// provided error, such as for a NETCONF kill-session operation.
+	// The error is delivered on the session's Wait channel if the
+	// session implements Killer; otherwise the session is released.
+	// The manager stops tracking the session before Terminate
+	// returns. Terminate returns in error if the session did not
+	// exist.
 	Terminate(ID, error) error
+
+	// TerminateAll terminates every session tracked by the manager
+	// with the error, as Terminate does, such as when entering
+	// maintenance.
+	TerminateAll(error)
+
+	// TerminateWhere terminates the sessions matched by the filter
+	// with the error, as Terminate does, such as those of a user
+	// whose credentials were revoked. Sessions are matched and stop
+	// being tracked at once, so none accepted during the call are
+	// missed or mistaken for those matched.
+	TerminateWhere(SessionFilter, error)
+
+	// Sessions returns a description of each session presently
+	// tracked by the manager, sorted by session ID.
+	Sessions() []SessionInfo
+
+	// FindSessions returns a description of each session presently
+	// tracked by the manager and matched by the filter, sorted by
+	// session ID.
+	FindSessions(SessionFilter) []SessionInfo
+
+	// Get returns the session with the ID, and true if the manager is
+	// tracking it, or false if not.
+	Get(ID) (Session, bool)
+
+	// OnRelease registers the function f to be called once the
+	// session with the ID ends, however it ends, so resources held
+	// for it, such as notification subscriptions, datastore locks or
+	// a confirmed commit, are cleaned up. Functions are called in the
+	// reverse order of their registration, after the manager stops
+	// tracking the session. OnRelease returns in error if the session
+	// does not exist.
+	OnRelease(ID, func()) error
+
+	// SetTag sets the tag key of the session with the ID to value, or
+	// removes it if value is empty. SetTag returns in error if the
+	// session does not exist.
+	SetTag(id ID, key, value string) error
+
+	// Tags returns the tags of the session with the ID, and true if
+	// the manager is tracking it, or false if not.
+	Tags(ID) (map[string]string, bool)
+
+	// Touch records activity on the session with the ID, such as the
+	// receipt of a request, deferring its idle timeout.
+	Touch(ID)
+
+	// Totals returns the statistics of the sessions the manager has
+	// accepted, both those presently tracked and those ended.
+	Totals() Totals
+}
+
+// SessionInfo describes a session tracked by a Manager.
+type SessionInfo struct {
+	// ID is the session identifier.
+	ID ID
+	// Type is the session type.
+	Type Type
+	// Username is the client username reported by the session's
+	// transport.
+	Username string
+	// Transport is the kind of the session's transport, as reported
+	// by transport.Kinder, or its Go type otherwise.
+	Transport string
+	// Start is the time the session was accepted.
+	Start time.Time
+	// Stats are the session's statistics.
+	Stats SessionStats
+	// Tags are the session's labels, such as its tenant or origin,
+	// set by its Server implementing Tagger or with Manager.SetTag,
+	// or nil if it has none.
+	Tags map[string]string
+}
+
+// SessionFilter selects sessions by their description. Its zero value
+// matches all sessions; each field not the zero value must match.
+type SessionFilter struct {
+	// Username matches sessions of the client username.
+	Username string
+	// Transport matches sessions with the transport kind, such as
+	// "ssh".
+	Transport string
+	// Type matches sessions of the type.
+	Type Type
+	// MinAge and MaxAge match sessions accepted at least, and at
+	// most, the duration ago.
+	MinAge, MaxAge time.Duration
+	// Tags matches sessions with each of the tags.
+	Tags map[string]string
+}
+
+// Match returns true if the filter matches the session described by
+// info, as of the time now.
+func (f SessionFilter) Match(info SessionInfo, now time.Time) bool {
+	age := now.Sub(info.Start)
+	switch {
+	case f.Username != "" && info.Username != f.Username,
+		f.Transport != "" && info.Transport != f.Transport,
+		f.Type != 0 && info.Type != f.Type,
+		f.MinAge > 0 && age < f.MinAge,
+		f.MaxAge > 0 && age > f.MaxAge:
+		return false
+	}
+	for k, v := range f.Tags {
+		if tag, ok := info.Tags[k]; !ok || tag != v {
+			return false
+		}
+	}
+	return true
+}
+
+// SessionStats are the statistics of a session, or the sum of those
+// of several. The counters are zero for sessions not implementing
+// Stats, or RPCCounters, except the byte counts of sessions whose
+// transport implements transport.StatsProvider.
+type SessionStats struct {
+	InRPCs, InBadRPCs, OutRPCs, OutRPCErrors, OutNotifications uint64
+	BytesIn, BytesOut                                          uint64
+	// LastActivity is the time a message was last received on the
+	// session, or the session was last touched or accepted.
+	LastActivity time.Time
+}
+
+// add adds the statistics o to s.
+func (s *SessionStats) add(o SessionStats) {
+	s.InRPCs += o.InRPCs
+	s.InBadRPCs += o.InBadRPCs
+	s.OutRPCs += o.OutRPCs
+	s.OutRPCErrors += o.OutRPCErrors
+	s.OutNotifications += o.OutNotifications
+	s.BytesIn += o.BytesIn
+	s.BytesOut += o.BytesOut
+	if o.LastActivity.After(s.LastActivity) {
+		s.LastActivity = o.LastActivity
+	}
+}
+
+// Totals are the statistics of the sessions of a Manager.
+type Totals struct {
+	// Start is the time the manager was created.
+	Start time.Time
+	// Sessions is the number of sessions accepted.
+	Sessions uint64
+	// DroppedSessions is the number of sessions terminated, by
+	// Terminate or expiry, rather than released by their application.
+	DroppedSessions uint64
+	// SessionStats is the sum of the statistics of the sessions.
+	SessionStats
 }
 
 // Acceptor is the interface used by session preparation code and is
@@ -0,0 +1,153 @@
+package transport
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Direction is the direction of captured traffic.
+type Direction int
+
+const (
+	// DirectionIn is traffic read from the peer.
+	DirectionIn Direction = 1 + iota
+	// DirectionOut is traffic written to the peer.
+	DirectionOut
+)
+
+func (d Direction) String() string {
+	switch d {
+	case DirectionIn:
+		return "in"
+	case DirectionOut:
+		return "out"
+	default:
+		return fmt.Sprintf("UNKNOWN(%d)", int(d))
+	}
+}
+
+// CaptureSink is the interface to receivers of captured traffic. It
+// must be safe for concurrent use, as reads and writes may be.
+type CaptureSink interface {
+	// Capture receives the data b, read or written in the direction
+	// dir. It must not modify or retain b.
+	Capture(dir Direction, b []byte)
+}
+
+// CaptureFunc is a function implementing CaptureSink.
+type CaptureFunc func(dir Direction, b []byte)
+
+// Capture calls f(dir, b).
+func (f CaptureFunc) Capture(dir Direction, b []byte) { f(dir, b) }
+
+// Redactor returns the data to capture in place of the data b, read
+// or written in the direction dir, such as with passwords masked. It
+// must not modify b.
+type Redactor func(dir Direction, b []byte) []byte
+
+// RedactElements returns a Redactor replacing the content of the XML
+// elements with the local names, such as "password", with "***".
+// Data is redacted a read or write at a time, so content split across
+// reads is not redacted; capture messages, before framing, to redact
+// those written reliably.
+func RedactElements(names ...string) Redactor {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = regexp.QuoteMeta(name)
+	}
+	re := regexp.MustCompile(`(<(?:[\w.-]+:)?(?:` + strings.Join(quoted, "|") + `)(?:\s[^>]*)?>)[^<]*(</)`)
+	return func(_ Direction, b []byte) []byte {
+		return re.ReplaceAll(b, []byte("${1}***${2}"))
+	}
+}
+
+// CaptureOption is a constructor option for Capture.
+type CaptureOption func(*Capture)
+
+// WithRedactor is a Capture option passing captured data to the sink
+// redacted by r.
+func WithRedactor(r Redactor) CaptureOption {
+	return func(c *Capture) { c.redact = r }
+}
+
+// Capture is a Transport passing the data read from and written to
+// another to a sink, such as to debug NETCONF traffic. Capturing a
+// transport's byte stream captures the traffic with its framing,
+// while capturing a transport framing messages, such as one using a
+// Framer, captures the messages.
+type Capture struct {
+	Transport
+	sink   CaptureSink
+	redact Redactor
+}
+
+// NewCapture returns a transport over t capturing its traffic to the
+// sink.
+func NewCapture(t Transport, sink CaptureSink, options ...CaptureOption) *Capture {
+	c := &Capture{Transport: t, sink: sink}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+// capture passes the data b to the sink, redacted.
+func (c *Capture) capture(dir Direction, b []byte) {
+	if len(b) == 0 {
+		return
+	}
+	if c.redact != nil {
+		b = c.redact(dir, b)
+	}
+	c.sink.Capture(dir, b)
+}
+
+// Read reads from the transport, capturing the data read.
+func (c *Capture) Read(b []byte) (int, error) {
+	n, err := c.Transport.Read(b)
+	c.capture(DirectionIn, b[:n])
+	return n, err
+}
+
+// Write writes to the transport, capturing the data written.
+func (c *Capture) Write(b []byte) (int, error) {
+	n, err := c.Transport.Write(b)
+	c.capture(DirectionOut, b[:n])
+	return n, err
+}
+
+// Username returns the username of the transport, or the empty string
+// if it reports none.
+func (c *Capture) Username() string { return usernameOf(c.Transport) }
+
+// Kind returns the kind of the transport, or its Go type if it
+// reports none.
+func (c *Capture) Kind() string { return kindOf(c.Transport) }
+
+// NewWriterSink returns a sink writing captured data to w, each read
+// or write preceded by a line with the time, direction and length,
+// e.g.:
+//
+//	# 2020-05-01T10:00:00.000Z in 41
+//	<rpc message-id="1"><get/></rpc>]]>]]>
+func NewWriterSink(w io.Writer) CaptureSink { return &writerSink{w: w} }
+
+type writerSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (s *writerSink) Capture(dir Direction, b []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, _ = fmt.Fprintf(s.w, "# %s %v %d\n%s\n", time.Now().UTC().Format("2006-01-02T15:04:05.000Z07:00"), dir, len(b), b)
+}
+
+var (
+	_ ServerTransport = &Capture{}
+	_ Kinder          = &Capture{}
+)
@@ -0,0 +1,59 @@
+package transport
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// testRWTransport is a transport reading from and writing to
+// io.Reader and io.Writer.
+type testRWTransport struct {
+	io.Reader
+	io.Writer
+}
+
+func (t testRWTransport) Close() error         { return nil }
+func (t testRWTransport) CloseWrite() error    { return nil }
+func (t testRWTransport) Error() io.ReadWriter { return nil }
+
+func TestCapture(t *testing.T) {
+	var captured []string
+	sink := CaptureFunc(func(dir Direction, b []byte) { captured = append(captured, dir.String()+" "+string(b)) })
+	var out bytes.Buffer
+	raw := testRWTransport{Reader: strings.NewReader(`<rpc><edit-config><password>secret</password></edit-config></rpc>]]>]]>`), Writer: &out}
+
+	// capture the framed byte stream, redacting passwords
+	f := NewFramer(NewCapture(raw, sink, WithRedactor(RedactElements("password", "key"))))
+	if _, err := f.Write([]byte(`<hello><sys:key xmlns:sys="urn:sys" type="rsa">AAAA</sys:key></hello>`)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ioutil.ReadAll(f); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		`out <hello><sys:key xmlns:sys="urn:sys" type="rsa">***</sys:key></hello>]]>]]>`,
+		`in <rpc><edit-config><password>***</password></edit-config></rpc>]]>]]>`,
+	}
+	if !reflect.DeepEqual(captured, want) {
+		t.Errorf("captured\n%q\nwant\n%q", captured, want)
+	}
+	if !strings.Contains(out.String(), "AAAA") {
+		t.Errorf("written %q, want unredacted data", out.String())
+	}
+}
+
+func TestWriterSink(t *testing.T) {
+	var b bytes.Buffer
+	sink := NewWriterSink(&b)
+	sink.Capture(DirectionIn, []byte("<rpc/>"))
+	sink.Capture(DirectionOut, []byte("<rpc-reply/>"))
+	re := regexp.MustCompile(`^# \d{4}-\d\d-\d\dT\d\d:\d\d:\d\d\.\d{3}Z in 6\n<rpc/>\n# \S+ out 12\n<rpc-reply/>\n$`)
+	if !re.Match(b.Bytes()) {
+		t.Errorf("captured %q, want match of %v", b.String(), re)
+	}
+}
@@ -0,0 +1,232 @@
+package transport
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrNoCertMapping is returned by CertMappers finding no username for
+// a certificate.
+var ErrNoCertMapping = errors.New("no username mapped from the client certificate")
+
+// CertMapper is the interface to mappers of TLS client certificates to
+// usernames, such as CertToName.
+type CertMapper interface {
+	// MapCertificate returns the username of the client presenting
+	// the certificate chain, its own certificate first, or an error,
+	// such as ErrNoCertMapping, if the client is not mapped.
+	MapCertificate(chain []*x509.Certificate) (string, error)
+}
+
+// CertMapType is the way a CertToNameEntry derives the username from a
+// client certificate, as the ietf-x509-cert-to-name (RFC7407)
+// cert-to-name map types do.
+type CertMapType int
+
+const (
+	// MapSpecified maps to the entry's Name.
+	MapSpecified CertMapType = 1 + iota
+	// MapSANRFC822Name maps to the certificate's first email address
+	// subjectAltName, with its host part in lowercase.
+	MapSANRFC822Name
+	// MapSANDNSName maps to the certificate's first DNS name
+	// subjectAltName, in lowercase.
+	MapSANDNSName
+	// MapSANIPAddress maps to the certificate's first IP address
+	// subjectAltName, an IPv4 address in dotted decimal or an IPv6
+	// address in 32 lowercase hexadecimal digits.
+	MapSANIPAddress
+	// MapSANAny maps to the certificate's first email address, DNS
+	// name or IP address subjectAltName, in that order.
+	MapSANAny
+	// MapCommonName maps to the certificate subject's common name.
+	MapCommonName
+)
+
+func (t CertMapType) String() string {
+	switch t {
+	case MapSpecified:
+		return "specified"
+	case MapSANRFC822Name:
+		return "san-rfc822-name"
+	case MapSANDNSName:
+		return "san-dns-name"
+	case MapSANIPAddress:
+		return "san-ip-address"
+	case MapSANAny:
+		return "san-any"
+	case MapCommonName:
+		return "common-name"
+	default:
+		return fmt.Sprintf("UNKNOWN(%d)", int(t))
+	}
+}
+
+// CertToNameEntry is a CertToName entry, mapping clients presenting a
+// certificate with the fingerprint, or one issued by a CA with it, to
+// a username.
+type CertToNameEntry struct {
+	// ID orders the entries, the lowest first.
+	ID uint32
+	// Fingerprint is the tls-fingerprint of the certificate, as
+	// returned by TLSFingerprint: a hash algorithm identifier and the
+	// certificate's hash as colon separated hexadecimal octets, e.g.,
+	// "04:a1:...". The MD5 and SHA-224 algorithms are not supported.
+	Fingerprint string
+	// MapType is the way the username is derived.
+	MapType CertMapType
+	// Name is the username of MapSpecified entries.
+	Name string
+}
+
+// CertToName is a CertMapper mapping client certificates to usernames
+// as the ietf-x509-cert-to-name (RFC7407) cert-to-name list does. Its
+// entries are tried in order of their IDs; the first whose
+// fingerprint matches a certificate in the client's chain and which
+// can derive a username from the client's certificate maps it.
+type CertToName []CertToNameEntry
+
+// MapCertificate returns the username of the client presenting the
+// certificate chain.
+func (m CertToName) MapCertificate(chain []*x509.Certificate) (string, error) {
+	if len(chain) == 0 {
+		return "", errors.Wrap(ErrNoCertMapping, "no client certificate")
+	}
+	entries := append(CertToName(nil), m...)
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].ID < entries[j].ID })
+	for _, e := range entries {
+		matched := false
+		for _, cert := range chain {
+			if fingerprintMatches(e.Fingerprint, cert) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+		if name := e.MapType.name(e, chain[0]); name != "" {
+			return name, nil
+		}
+	}
+	return "", ErrNoCertMapping
+}
+
+// name returns the username derived from the client certificate cert
+// by the entry e, or the empty string if none can be.
+func (t CertMapType) name(e CertToNameEntry, cert *x509.Certificate) string {
+	switch t {
+	case MapSpecified:
+		return e.Name
+	case MapSANRFC822Name:
+		if len(cert.EmailAddresses) > 0 {
+			addr := cert.EmailAddresses[0]
+			if i := strings.LastIndexByte(addr, '@'); i >= 0 {
+				return addr[:i] + strings.ToLower(addr[i:])
+			}
+			return addr
+		}
+	case MapSANDNSName:
+		if len(cert.DNSNames) > 0 {
+			return strings.ToLower(cert.DNSNames[0])
+		}
+	case MapSANIPAddress:
+		if len(cert.IPAddresses) > 0 {
+			ip := cert.IPAddresses[0]
+			if ip4 := ip.To4(); ip4 != nil {
+				return ip4.String()
+			}
+			return hex.EncodeToString(ip)
+		}
+	case MapSANAny:
+		for _, t := range []CertMapType{MapSANRFC822Name, MapSANDNSName, MapSANIPAddress} {
+			if name := t.name(e, cert); name != "" {
+				return name
+			}
+		}
+	case MapCommonName:
+		return cert.Subject.CommonName
+	}
+	return ""
+}
+
+// fingerprint hash algorithm identifiers, from the TLS HashAlgorithm
+// registry
+var fingerprintHashes = map[byte]func() hash.Hash{
+	2: sha1.New,
+	4: sha256.New,
+	5: sha512.New384,
+	6: sha512.New,
+}
+
+// TLSFingerprint returns the SHA-256 tls-fingerprint of the
+// certificate, for CertToNameEntry.
+func TLSFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return formatFingerprint(4, sum[:])
+}
+
+func formatFingerprint(alg byte, sum []byte) string {
+	octets := make([]string, 0, len(sum)+1)
+	octets = append(octets, hex.EncodeToString([]byte{alg}))
+	for _, b := range sum {
+		octets = append(octets, hex.EncodeToString([]byte{b}))
+	}
+	return strings.Join(octets, ":")
+}
+
+// fingerprintMatches returns true if the tls-fingerprint fp is that of
+// the certificate.
+func fingerprintMatches(fp string, cert *x509.Certificate) bool {
+	b, err := hex.DecodeString(strings.Replace(fp, ":", "", -1))
+	if err != nil || len(b) < 2 {
+		return false
+	}
+	newHash, ok := fingerprintHashes[b[0]]
+	if !ok {
+		return false
+	}
+	h := newHash()
+	_, _ = h.Write(cert.Raw)
+	return bytes.Equal(h.Sum(nil), b[1:])
+}
+
+// CertUsername returns the username mapped by m from the client
+// certificate chain of the TLS connection state, such as that of an
+// HTTP request. The verified chain is used if the client's
+// certificate was verified, or the certificates presented otherwise.
+func CertUsername(m CertMapper, state tls.ConnectionState) (string, error) {
+	chain := state.PeerCertificates
+	if len(state.VerifiedChains) > 0 {
+		chain = state.VerifiedChains[0]
+	}
+	return m.MapCertificate(chain)
+}
+
+// NewTLSConn returns a transport over the TLS connection c, completing
+// its handshake, whose username is mapped by m from the client's
+// certificate. It returns an error if the handshake fails or the
+// client is not mapped to a username.
+func NewTLSConn(c *tls.Conn, m CertMapper) (*Conn, error) {
+	if err := c.Handshake(); err != nil {
+		return nil, errors.Wrap(err, "tls handshake")
+	}
+	username, err := CertUsername(m, c.ConnectionState())
+	if err != nil {
+		return nil, err
+	}
+	return NewConn(c, username), nil
+}
+
+var _ CertMapper = CertToName{}
@@ -0,0 +1,127 @@
+package transport
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// testClientCertificate returns a client certificate issued by the CA
+// certificate ca, from the template.
+func testClientCertificate(t *testing.T, ca tls.Certificate, template *x509.Certificate) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template.SerialNumber = big.NewInt(2)
+	template.NotBefore, template.NotAfter = time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.Leaf, &key.PublicKey, ca.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: cert}
+}
+
+func TestCertToName(t *testing.T) {
+	ca, _ := testCertificate(t)
+	client := testClientCertificate(t, ca, &x509.Certificate{
+		Subject:        pkix.Name{CommonName: "Alice"},
+		EmailAddresses: []string{"alice@Example.COM"},
+		DNSNames:       []string{"Alice.Example.com"},
+		IPAddresses:    []net.IP{net.ParseIP("2001:db8::1")},
+	})
+	bare := testClientCertificate(t, ca, &x509.Certificate{Subject: pkix.Name{CommonName: "bob"}})
+	chain := []*x509.Certificate{client.Leaf, ca.Leaf}
+	caFP, clientFP := TLSFingerprint(ca.Leaf), TLSFingerprint(client.Leaf)
+	sum := sha1.Sum(client.Leaf.Raw)
+	clientSHA1 := formatFingerprint(2, sum[:])
+
+	for _, tt := range []struct {
+		name    string
+		m       CertToName
+		chain   []*x509.Certificate
+		want    string
+		wantErr error
+	}{
+		{name: "specified", m: CertToName{{ID: 1, Fingerprint: clientFP, MapType: MapSpecified, Name: "admin"}}, chain: chain, want: "admin"},
+		{name: "sha-1 fingerprint", m: CertToName{{ID: 1, Fingerprint: clientSHA1, MapType: MapSpecified, Name: "admin"}}, chain: chain, want: "admin"},
+		{name: "upper case fingerprint", m: CertToName{{ID: 1, Fingerprint: strings.ToUpper(clientFP), MapType: MapCommonName}}, chain: chain, want: "Alice"},
+		{name: "rfc822 name via ca", m: CertToName{{ID: 1, Fingerprint: caFP, MapType: MapSANRFC822Name}}, chain: chain, want: "alice@example.com"},
+		{name: "dns name", m: CertToName{{ID: 1, Fingerprint: caFP, MapType: MapSANDNSName}}, chain: chain, want: "alice.example.com"},
+		{name: "ip address", m: CertToName{{ID: 1, Fingerprint: caFP, MapType: MapSANIPAddress}}, chain: chain, want: "20010db8000000000000000000000001"},
+		{name: "san any", m: CertToName{{ID: 1, Fingerprint: caFP, MapType: MapSANAny}}, chain: chain, want: "alice@example.com"},
+		{
+			name: "ordered by id",
+			m: CertToName{
+				{ID: 20, Fingerprint: caFP, MapType: MapCommonName},
+				{ID: 10, Fingerprint: caFP, MapType: MapSpecified, Name: "first"},
+			},
+			chain: chain,
+			want:  "first",
+		},
+		{
+			name: "next entry when no name derived",
+			m: CertToName{
+				{ID: 1, Fingerprint: caFP, MapType: MapSANAny},
+				{ID: 2, Fingerprint: caFP, MapType: MapCommonName},
+			},
+			chain: []*x509.Certificate{bare.Leaf, ca.Leaf},
+			want:  "bob",
+		},
+		{name: "no fingerprint match", m: CertToName{{ID: 1, Fingerprint: clientFP, MapType: MapCommonName}}, chain: []*x509.Certificate{bare.Leaf, ca.Leaf}, wantErr: ErrNoCertMapping},
+		{name: "bad fingerprint", m: CertToName{{ID: 1, Fingerprint: "01:ab", MapType: MapCommonName}}, chain: chain, wantErr: ErrNoCertMapping},
+		{name: "no certificate", m: CertToName{{ID: 1, Fingerprint: caFP, MapType: MapCommonName}}, wantErr: ErrNoCertMapping},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.m.MapCertificate(tt.chain)
+			if errors.Cause(err) != tt.wantErr {
+				t.Fatalf("MapCertificate() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("MapCertificate() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewTLSConn(t *testing.T) {
+	ca, pool := testCertificate(t)
+	client := testClientCertificate(t, ca, &x509.Certificate{Subject: pkix.Name{CommonName: "alice"}})
+	m := CertToName{{ID: 1, Fingerprint: TLSFingerprint(ca.Leaf), MapType: MapCommonName}}
+
+	c, s := net.Pipe()
+	go func() {
+		tc := tls.Client(c, &tls.Config{RootCAs: pool, ServerName: "127.0.0.1", Certificates: []tls.Certificate{client}})
+		_ = tc.Handshake()
+	}()
+	tr, err := NewTLSConn(tls.Server(s, &tls.Config{
+		Certificates: []tls.Certificate{ca},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+	}), m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tr.Close()
+	if tr.Username() != "alice" || tr.Kind() != "tls" {
+		t.Errorf("Username(), Kind() = %q, %q, want %q, %q", tr.Username(), tr.Kind(), "alice", "tls")
+	}
+}
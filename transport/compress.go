@@ -0,0 +1,169 @@
+package transport
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"sync"
+)
+
+// FlushWriter is the interface to compressing writers, flushing data
+// written so far so it can be decompressed as it is received.
+type FlushWriter interface {
+	io.WriteCloser
+	// Flush compresses and writes the data written so far.
+	Flush() error
+}
+
+// Codec is the interface to compression formats of Compress
+// transports. Both peers must use the same codec, agreed out-of-band
+// such as by configuration. Codecs for other formats, such as zstd,
+// wrap their encoders and decoders, which implement FlushWriter and
+// io.Reader.
+type Codec interface {
+	// Name returns the codec's name, e.g., "gzip".
+	Name() string
+	// NewReader returns a reader decompressing data read from r.
+	NewReader(r io.Reader) (io.Reader, error)
+	// NewWriter returns a writer compressing data to w.
+	NewWriter(w io.Writer) (FlushWriter, error)
+}
+
+var (
+	// Gzip is the gzip (RFC1952) codec.
+	Gzip Codec = gzipCodec{}
+	// Deflate is the DEFLATE (RFC1951) codec, with less overhead than
+	// Gzip.
+	Deflate Codec = deflateCodec{}
+)
+
+type gzipCodec struct{}
+
+func (gzipCodec) Name() string                               { return "gzip" }
+func (gzipCodec) NewReader(r io.Reader) (io.Reader, error)   { return gzip.NewReader(r) }
+func (gzipCodec) NewWriter(w io.Writer) (FlushWriter, error) { return gzip.NewWriter(w), nil }
+
+type deflateCodec struct{}
+
+func (deflateCodec) Name() string                             { return "deflate" }
+func (deflateCodec) NewReader(r io.Reader) (io.Reader, error) { return flate.NewReader(r), nil }
+func (deflateCodec) NewWriter(w io.Writer) (FlushWriter, error) {
+	return flate.NewWriter(w, flate.DefaultCompression)
+}
+
+// Compress is a Transport compressing the data written to another and
+// decompressing the data read from it, such as to save bandwidth on
+// WAN links carrying large replies. It compresses the byte stream, so
+// is used beneath a Framer, not above one.
+//
+// Each Write is compressed, flushed and written with a single Write,
+// so the peer can decompress each message as it is received. The
+// compressed stream is ended by CloseWrite or Close.
+type Compress struct {
+	Transport
+	codec Codec
+
+	rmu  sync.Mutex
+	r    io.Reader
+	rerr error
+
+	wmu sync.Mutex
+	buf bytes.Buffer
+	w   FlushWriter
+}
+
+// NewCompress returns a transport over t compressing its traffic with
+// the codec.
+func NewCompress(t Transport, codec Codec) *Compress {
+	return &Compress{Transport: t, codec: codec}
+}
+
+// Read reads and decompresses data from the transport.
+func (c *Compress) Read(b []byte) (int, error) {
+	c.rmu.Lock()
+	defer c.rmu.Unlock()
+	if c.r == nil && c.rerr == nil {
+		// the reader is made on the first read, as it may read a
+		// header from the transport
+		c.r, c.rerr = c.codec.NewReader(c.Transport)
+	}
+	if c.rerr != nil {
+		return 0, c.rerr
+	}
+	return c.r.Read(b)
+}
+
+// Write compresses b and writes it to the transport.
+func (c *Compress) Write(b []byte) (int, error) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.w == nil {
+		w, err := c.codec.NewWriter(&c.buf)
+		if err != nil {
+			return 0, err
+		}
+		c.w = w
+	}
+	if _, err := c.w.Write(b); err != nil {
+		return 0, err
+	}
+	if err := c.w.Flush(); err != nil {
+		return 0, err
+	}
+	return len(b), c.writeBuffered()
+}
+
+// writeBuffered writes the compressed data buffered to the
+// transport. c.wmu is held.
+func (c *Compress) writeBuffered() error {
+	defer c.buf.Reset()
+	if c.buf.Len() == 0 {
+		return nil
+	}
+	_, err := c.Transport.Write(c.buf.Bytes())
+	return err
+}
+
+// finish ends the compressed stream, if one was started.
+func (c *Compress) finish() error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.w == nil {
+		return nil
+	}
+	err := c.w.Close()
+	if werr := c.writeBuffered(); err == nil {
+		err = werr
+	}
+	c.w = nil
+	return err
+}
+
+// CloseWrite ends the compressed stream and closes the writing side of
+// the transport.
+func (c *Compress) CloseWrite() error {
+	if err := c.finish(); err != nil {
+		return err
+	}
+	return c.Transport.CloseWrite()
+}
+
+// Close ends the compressed stream and closes the transport.
+func (c *Compress) Close() error {
+	_ = c.finish()
+	return c.Transport.Close()
+}
+
+// Username returns the username of the transport, or the empty string
+// if it reports none.
+func (c *Compress) Username() string { return usernameOf(c.Transport) }
+
+// Kind returns the kind of the transport, or its Go type if it
+// reports none.
+func (c *Compress) Kind() string { return kindOf(c.Transport) }
+
+var (
+	_ ServerTransport = &Compress{}
+	_ Kinder          = &Compress{}
+)
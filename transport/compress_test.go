@@ -0,0 +1,69 @@
+package transport
+
+import (
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// testCountWriter counts the bytes written to it.
+type testCountWriter struct {
+	io.Writer
+	n int64
+}
+
+func (w *testCountWriter) Write(b []byte) (int, error) {
+	n, err := w.Writer.Write(b)
+	atomic.AddInt64(&w.n, int64(n))
+	return n, err
+}
+
+// testPipeWriterTransport is a transport writing to a pipe, closed by
+// CloseWrite.
+type testPipeWriterTransport struct {
+	testRWTransport
+	w *io.PipeWriter
+}
+
+func (t testPipeWriterTransport) CloseWrite() error { return t.w.Close() }
+
+func TestCompress(t *testing.T) {
+	for _, codec := range []Codec{Gzip, Deflate} {
+		t.Run(codec.Name(), func(t *testing.T) {
+			pr, pw := io.Pipe()
+			count := &testCountWriter{Writer: pw}
+			client := NewCompress(testPipeWriterTransport{testRWTransport: testRWTransport{Writer: count}, w: pw}, codec)
+			server := NewCompress(testRWTransport{Reader: pr}, codec)
+
+			// each message written can be read in full before the next
+			msg := "<rpc-reply><data>" + strings.Repeat("<interface><name>eth0</name></interface>", 100) + "</data></rpc-reply>"
+			errc := make(chan error, 1)
+			go func() {
+				for i := 0; i < 2; i++ {
+					if _, err := client.Write([]byte(msg)); err != nil {
+						errc <- err
+						return
+					}
+				}
+				errc <- client.CloseWrite()
+			}()
+			for i := 0; i < 2; i++ {
+				b := make([]byte, len(msg))
+				if _, err := io.ReadFull(server, b); err != nil || string(b) != msg {
+					t.Fatalf("message %d read %d bytes, %v", i, len(b), err)
+				}
+			}
+			if b, err := ioutil.ReadAll(server); err != nil || len(b) != 0 {
+				t.Errorf("read %q, %v after the stream ended, want EOF", b, err)
+			}
+			if err := <-errc; err != nil {
+				t.Fatal(err)
+			}
+			if n := atomic.LoadInt64(&count.n); n >= int64(len(msg)) {
+				t.Errorf("wrote %d compressed bytes for %d bytes of messages", n, 2*len(msg))
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package transport
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+)
+
+// Conn is a ServerTransport over a network connection, such as one
+// accepted by a TCP or TLS listener. It implements Addresser and
+// DeadlineSetter, and ConnectionStater for TLS connections.
+type Conn struct {
+	net.Conn
+	username string
+}
+
+// NewConn returns a transport over the connection c, for the client
+// username, such as one authenticated by a TLS client certificate.
+func NewConn(c net.Conn, username string) *Conn {
+	return &Conn{Conn: c, username: username}
+}
+
+// CloseWrite closes the writing side of the connection if it supports
+// it, as *net.TCPConn and *tls.Conn do, or the connection otherwise.
+func (c *Conn) CloseWrite() error {
+	if cw, ok := c.Conn.(CloseWriter); ok {
+		return cw.CloseWrite()
+	}
+	return c.Conn.Close()
+}
+
+// Error returns nil; network connections have no error channel.
+func (c *Conn) Error() io.ReadWriter { return nil }
+
+// Username returns the client username.
+func (c *Conn) Username() string { return c.username }
+
+// Kind returns "tls" for TLS connections, or the network of the
+// connection's local address otherwise, e.g., "tcp".
+func (c *Conn) Kind() string {
+	if _, ok := c.Conn.(*tls.Conn); ok {
+		return "tls"
+	}
+	if addr := c.Conn.LocalAddr(); addr != nil {
+		return addr.Network()
+	}
+	return "conn"
+}
+
+// ConnectionState returns the TLS connection state of TLS
+// connections, or the zero value otherwise.
+func (c *Conn) ConnectionState() tls.ConnectionState {
+	if tc, ok := c.Conn.(*tls.Conn); ok {
+		return tc.ConnectionState()
+	}
+	return tls.ConnectionState{}
+}
+
+var (
+	_ ServerTransport  = &Conn{}
+	_ Kinder           = &Conn{}
+	_ Addresser        = &Conn{}
+	_ DeadlineSetter   = &Conn{}
+	_ ConnectionStater = &Conn{}
+)
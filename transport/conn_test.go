@@ -0,0 +1,52 @@
+package transport
+
+import (
+	"io/ioutil"
+	"net"
+	"testing"
+)
+
+func TestConn(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		c, _ := l.Accept()
+		accepted <- c
+	}()
+	client, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	c := NewConn(<-accepted, "admin")
+	defer c.Close()
+
+	if c.Username() != "admin" || c.Kind() != "tcp" {
+		t.Errorf("Username(), Kind() = %q, %q, want %q, %q", c.Username(), c.Kind(), "admin", "tcp")
+	}
+	if c.ConnectionState().HandshakeComplete {
+		t.Error("ConnectionState().HandshakeComplete = true for a TCP connection")
+	}
+	if _, err := c.Write([]byte("<hello/>")); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.CloseWrite(); err != nil {
+		t.Fatal(err)
+	}
+	// the client reads the data written and EOF, with the connection
+	// still open for reads
+	if b, err := ioutil.ReadAll(client); err != nil || string(b) != "<hello/>" {
+		t.Errorf("client read %q, %v, want %q, nil", b, err, "<hello/>")
+	}
+	if _, err := client.Write([]byte("<rpc/>")); err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 16)
+	if n, err := c.Read(b); err != nil || string(b[:n]) != "<rpc/>" {
+		t.Errorf("Read() = %q, %v, want %q, nil", b[:n], err, "<rpc/>")
+	}
+}
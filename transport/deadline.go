@@ -0,0 +1,122 @@
+package transport
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrNoDeadlines is returned for transports not implementing
+// DeadlineSetter by functions applying timeouts.
+var ErrNoDeadlines = errors.New("transport does not support deadlines")
+
+// ReadTimeout reads from r into b, failing if the read does not
+// complete within the duration d. r must implement DeadlineSetter, or
+// ErrNoDeadlines is returned.
+func ReadTimeout(r io.Reader, b []byte, d time.Duration) (int, error) {
+	ds, ok := r.(DeadlineSetter)
+	if !ok {
+		return 0, ErrNoDeadlines
+	}
+	if err := ds.SetReadDeadline(time.Now().Add(d)); err != nil {
+		return 0, err
+	}
+	defer func() { _ = ds.SetReadDeadline(time.Time{}) }()
+	return r.Read(b)
+}
+
+// WriteTimeout writes b to w, failing if the write does not complete
+// within the duration d. w must implement DeadlineSetter, or
+// ErrNoDeadlines is returned.
+func WriteTimeout(w io.Writer, b []byte, d time.Duration) (int, error) {
+	ds, ok := w.(DeadlineSetter)
+	if !ok {
+		return 0, ErrNoDeadlines
+	}
+	if err := ds.SetWriteDeadline(time.Now().Add(d)); err != nil {
+		return 0, err
+	}
+	defer func() { _ = ds.SetWriteDeadline(time.Time{}) }()
+	return w.Write(b)
+}
+
+// Timeouts is a Transport applying a timeout to each read and write,
+// so a peer which stops reading or sending mid-message cannot hold a
+// server's goroutines indefinitely.
+type Timeouts struct {
+	Transport
+	read, write time.Duration
+}
+
+// NewTimeouts returns a transport over t failing reads and writes not
+// completed within the durations read and write, or with no timeout
+// if zero. It returns ErrNoDeadlines if t does not implement
+// DeadlineSetter.
+func NewTimeouts(t Transport, read, write time.Duration) (*Timeouts, error) {
+	if _, ok := t.(DeadlineSetter); !ok {
+		return nil, errors.Wrapf(ErrNoDeadlines, "%T", t)
+	}
+	return &Timeouts{Transport: t, read: read, write: write}, nil
+}
+
+// Read reads from the transport, within the read timeout.
+func (t *Timeouts) Read(b []byte) (int, error) {
+	if t.read == 0 {
+		return t.Transport.Read(b)
+	}
+	return ReadTimeout(t.Transport, b, t.read)
+}
+
+// Write writes to the transport, within the write timeout.
+func (t *Timeouts) Write(b []byte) (int, error) {
+	if t.write == 0 {
+		return t.Transport.Write(b)
+	}
+	return WriteTimeout(t.Transport, b, t.write)
+}
+
+// SetReadDeadline sets the read deadline of the transport, for reads
+// without a timeout.
+func (t *Timeouts) SetReadDeadline(d time.Time) error {
+	return t.Transport.(DeadlineSetter).SetReadDeadline(d)
+}
+
+// SetWriteDeadline sets the write deadline of the transport, for
+// writes without a timeout.
+func (t *Timeouts) SetWriteDeadline(d time.Time) error {
+	return t.Transport.(DeadlineSetter).SetWriteDeadline(d)
+}
+
+// Username returns the username of the transport, or the empty string
+// if it reports none.
+func (t *Timeouts) Username() string { return usernameOf(t.Transport) }
+
+// Kind returns the kind of the transport, or its Go type if it
+// reports none.
+func (t *Timeouts) Kind() string { return kindOf(t.Transport) }
+
+// usernameOf returns the username of the transport t, or the empty
+// string if it reports none.
+func usernameOf(t Transport) string {
+	if u, ok := t.(ClientUsernameProvider); ok {
+		return u.Username()
+	}
+	return ""
+}
+
+// kindOf returns the kind of the transport t, or its Go type if it
+// reports none.
+func kindOf(t Transport) string {
+	if k, ok := t.(Kinder); ok {
+		return k.Kind()
+	}
+	return fmt.Sprintf("%T", t)
+}
+
+var (
+	_ ServerTransport = &Timeouts{}
+	_ DeadlineSetter  = &Timeouts{}
+	_ Kinder          = &Timeouts{}
+)
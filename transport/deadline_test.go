@@ -0,0 +1,63 @@
+package transport
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// testConnTransport is a transport over a net.Conn.
+type testConnTransport struct{ net.Conn }
+
+func (t testConnTransport) CloseWrite() error    { return nil }
+func (t testConnTransport) Error() io.ReadWriter { return nil }
+func (t testConnTransport) Username() string     { return "alice" }
+
+func isTimeout(err error) bool {
+	ne, ok := errors.Cause(err).(net.Error)
+	return ok && ne.Timeout()
+}
+
+func TestTimeouts(t *testing.T) {
+	c, peer := net.Pipe()
+	defer peer.Close()
+	tr, err := NewTimeouts(testConnTransport{c}, 20*time.Millisecond, 20*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tr.Close()
+	if tr.Username() != "alice" {
+		t.Errorf("Username() = %q, want %q", tr.Username(), "alice")
+	}
+
+	b := make([]byte, 4)
+	if _, err := tr.Read(b); !isTimeout(err) {
+		t.Errorf("Read() of silent peer error = %v, want a timeout", err)
+	}
+	if _, err := tr.Write(b); !isTimeout(err) {
+		t.Errorf("Write() to peer not reading error = %v, want a timeout", err)
+	}
+
+	// each read has its own deadline, from the time it begins
+	go func() {
+		time.Sleep(40 * time.Millisecond)
+		_, _ = peer.Write([]byte("data"))
+	}()
+	time.Sleep(30 * time.Millisecond)
+	if n, err := tr.Read(b); err != nil || string(b[:n]) != "data" {
+		t.Errorf("Read() = %q, %v, want %q, nil", b[:n], err, "data")
+	}
+}
+
+func TestNewTimeouts_unsupported(t *testing.T) {
+	tr, _ := newTestPipeTransport()
+	if _, err := NewTimeouts(tr, time.Second, time.Second); errors.Cause(err) != ErrNoDeadlines {
+		t.Errorf("NewTimeouts() error = %v, want %v", err, ErrNoDeadlines)
+	}
+	if _, err := ReadTimeout(tr, nil, time.Second); err != ErrNoDeadlines {
+		t.Errorf("ReadTimeout() error = %v, want %v", err, ErrNoDeadlines)
+	}
+}
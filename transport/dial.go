@@ -0,0 +1,193 @@
+package transport
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/proxy"
+)
+
+// ContextDialer is the interface to dialers of network connections,
+// as net.Dialer is, used by client transports to connect through
+// proxies and jump hosts.
+type ContextDialer interface {
+	// DialContext connects to the address on the named network.
+	DialContext(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+// directDialer returns the dialer d, or a net.Dialer if nil.
+func directDialer(d ContextDialer) ContextDialer {
+	if d == nil {
+		return &net.Dialer{}
+	}
+	return d
+}
+
+// ProxyAuth is the username and password authenticating with a proxy.
+type ProxyAuth struct {
+	Username, Password string
+}
+
+// HTTPConnectDialer returns a dialer connecting through the HTTP proxy
+// at the address proxyAddr with CONNECT requests, authenticating with
+// auth if not nil. The proxy is dialed with forward, or directly if
+// nil.
+func HTTPConnectDialer(proxyAddr string, auth *ProxyAuth, forward ContextDialer) ContextDialer {
+	return &httpConnectDialer{addr: proxyAddr, auth: auth, forward: directDialer(forward)}
+}
+
+type httpConnectDialer struct {
+	addr    string
+	auth    *ProxyAuth
+	forward ContextDialer
+}
+
+func (d *httpConnectDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	conn, err := d.forward.DialContext(ctx, "tcp", d.addr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "dial proxy %s", d.addr)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	c, err := d.connect(conn, addr)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return c, nil
+}
+
+// connect requests the proxy connected by conn to connect to addr.
+func (d *httpConnectDialer) connect(conn net.Conn, addr string) (net.Conn, error) {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Host: addr},
+		Host:   addr,
+		Header: http.Header{},
+	}
+	if d.auth != nil {
+		req.Header.Set("Proxy-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(d.auth.Username+":"+d.auth.Password)))
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, errors.Wrapf(err, "proxy %s", d.addr)
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "proxy %s", d.addr)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("proxy %s: CONNECT %s: %s", d.addr, addr, resp.Status)
+	}
+	if br.Buffered() > 0 {
+		// the peer sent data with the proxy's response
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn is a connection read through a buffered reader.
+type bufferedConn struct {
+	net.Conn
+	r io.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) { return c.r.Read(b) }
+
+// SOCKS5Dialer returns a dialer connecting through the SOCKS5 proxy at
+// the address proxyAddr, authenticating with auth if not nil. The
+// proxy is dialed with forward, or directly if nil.
+func SOCKS5Dialer(proxyAddr string, auth *ProxyAuth, forward ContextDialer) (ContextDialer, error) {
+	var pa *proxy.Auth
+	if auth != nil {
+		pa = &proxy.Auth{User: auth.Username, Password: auth.Password}
+	}
+	d, err := proxy.SOCKS5("tcp", proxyAddr, pa, forwardDialer{directDialer(forward)})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	cd, ok := d.(ContextDialer)
+	if !ok {
+		return nil, errors.Errorf("SOCKS5 dialer %T does not dial with contexts", d)
+	}
+	return cd, nil
+}
+
+// forwardDialer adapts a ContextDialer to the proxy package's dialers.
+type forwardDialer struct{ ContextDialer }
+
+func (d forwardDialer) Dial(network, addr string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, addr)
+}
+
+// TLSClient is a ClientTransport over a TLS connection, framing
+// messages with a Framer, as NETCONF over TLS (RFC7589) does. It
+// implements RFC6242Framer.
+type TLSClient struct {
+	*Framer
+	conn *tls.Conn
+}
+
+// DialTLS connects to the TLS server at the address addr with the
+// configuration, through the dialer, or directly if nil. The context
+// bounds the time taken to connect.
+func DialTLS(ctx context.Context, addr string, config *tls.Config, dialer ContextDialer) (*TLSClient, error) {
+	conn, err := directDialer(dialer).DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if config == nil {
+		config = &tls.Config{}
+	}
+	if config.ServerName == "" {
+		config = config.Clone()
+		config.ServerName, _, _ = net.SplitHostPort(addr)
+	}
+	tc := tls.Client(conn, config)
+	if err := tc.HandshakeContext(ctx); err != nil {
+		_ = conn.Close()
+		return nil, errors.Wrapf(err, "tls connection to %s", addr)
+	}
+	return &TLSClient{Framer: NewFramer(tc), conn: tc}, nil
+}
+
+// CloseWrite closes the writing side of the connection.
+func (t *TLSClient) CloseWrite() error { return t.conn.CloseWrite() }
+
+// Close closes the connection.
+func (t *TLSClient) Close() error { return t.conn.Close() }
+
+// Error returns nil; TLS connections have no error channel.
+func (t *TLSClient) Error() io.ReadWriter { return nil }
+
+// Kind returns "tls".
+func (t *TLSClient) Kind() string { return "tls" }
+
+// LocalAddr returns the local address of the connection.
+func (t *TLSClient) LocalAddr() net.Addr { return t.conn.LocalAddr() }
+
+// RemoteAddr returns the address of the server.
+func (t *TLSClient) RemoteAddr() net.Addr { return t.conn.RemoteAddr() }
+
+// ConnectionState returns the TLS connection state.
+func (t *TLSClient) ConnectionState() tls.ConnectionState { return t.conn.ConnectionState() }
+
+var (
+	_ ContextDialer    = &httpConnectDialer{}
+	_ ClientTransport  = &TLSClient{}
+	_ RFC6242Framer    = &TLSClient{}
+	_ Kinder           = &TLSClient{}
+	_ Addresser        = &TLSClient{}
+	_ ConnectionStater = &TLSClient{}
+)
@@ -0,0 +1,251 @@
+package transport
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// testCertificate returns a self-signed certificate for 127.0.0.1 and
+// a pool with it.
+func testCertificate(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "server"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: cert}, pool
+}
+
+// testListen listens on a local TCP port, serving each connection with
+// serve.
+func testListen(t *testing.T, serve func(net.Conn)) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serve(conn)
+		}
+	}()
+	return l.Addr().String()
+}
+
+// testHTTPProxy runs an HTTP proxy serving CONNECT requests, requiring
+// the credentials auth if not nil.
+func testHTTPProxy(t *testing.T, auth *ProxyAuth) string {
+	return testListen(t, func(conn net.Conn) {
+		defer conn.Close()
+		req, err := http.ReadRequest(bufio.NewReader(conn))
+		if err != nil || req.Method != http.MethodConnect {
+			return
+		}
+		if auth != nil && req.Header.Get("Proxy-Authorization") != "Basic "+base64.StdEncoding.EncodeToString([]byte(auth.Username+":"+auth.Password)) {
+			_, _ = io.WriteString(conn, "HTTP/1.1 407 Proxy Authentication Required\r\n\r\n")
+			return
+		}
+		target, err := net.Dial("tcp", req.Host)
+		if err != nil {
+			_, _ = io.WriteString(conn, "HTTP/1.1 502 Bad Gateway\r\n\r\n")
+			return
+		}
+		_, _ = io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+		testSplice(conn, target)
+	})
+}
+
+// testSOCKS5Proxy runs a SOCKS5 proxy serving CONNECT requests for
+// IPv4 addresses, requiring the credentials auth if not nil.
+func testSOCKS5Proxy(t *testing.T, auth *ProxyAuth) string {
+	return testListen(t, func(conn net.Conn) {
+		defer conn.Close()
+		b := make([]byte, 262)
+		if _, err := io.ReadFull(conn, b[:2]); err != nil {
+			return
+		}
+		if _, err := io.ReadFull(conn, b[:b[1]]); err != nil {
+			return
+		}
+		if auth == nil {
+			_, _ = conn.Write([]byte{5, 0})
+		} else {
+			_, _ = conn.Write([]byte{5, 2})
+			var creds [2]string
+			if _, err := io.ReadFull(conn, b[:1]); err != nil {
+				return
+			}
+			for i := range creds {
+				if _, err := io.ReadFull(conn, b[:1]); err != nil {
+					return
+				}
+				n := int(b[0])
+				if _, err := io.ReadFull(conn, b[:n]); err != nil {
+					return
+				}
+				creds[i] = string(b[:n])
+			}
+			if creds != [2]string{auth.Username, auth.Password} {
+				_, _ = conn.Write([]byte{1, 1})
+				return
+			}
+			_, _ = conn.Write([]byte{1, 0})
+		}
+		// a CONNECT request for an IPv4 address
+		if _, err := io.ReadFull(conn, b[:10]); err != nil || b[1] != 1 || b[3] != 1 {
+			return
+		}
+		addr := net.JoinHostPort(net.IP(b[4:8]).String(), strconv.Itoa(int(binary.BigEndian.Uint16(b[8:10]))))
+		target, err := net.Dial("tcp", addr)
+		if err != nil {
+			_, _ = conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+			return
+		}
+		_, _ = conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+		testSplice(conn, target)
+	})
+}
+
+// testEcho checks messages written to c are echoed.
+func testEcho(t *testing.T, c ClientTransport) {
+	t.Helper()
+	if _, err := c.Write([]byte("<hello/>")); err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 64)
+	if n, err := c.Read(b); err != nil || string(b[:n]) != "<hello/>" {
+		t.Errorf("Read() = %q, %v, want %q, nil", b[:n], err, "<hello/>")
+	}
+}
+
+func TestDialTLS(t *testing.T) {
+	cert, pool := testCertificate(t)
+	config := &tls.Config{Certificates: []tls.Certificate{cert}}
+	addr := testListen(t, func(conn net.Conn) {
+		tc := tls.Server(conn, config)
+		defer tc.Close()
+		_, _ = io.Copy(tc, tc)
+	})
+	auth := &ProxyAuth{Username: "proxy", Password: "secret"}
+	socks5, err := SOCKS5Dialer(testSOCKS5Proxy(t, nil), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	socks5Auth, err := SOCKS5Dialer(testSOCKS5Proxy(t, auth), auth, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	socks5BadAuth, err := SOCKS5Dialer(testSOCKS5Proxy(t, auth), &ProxyAuth{Username: "proxy"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		name    string
+		dialer  ContextDialer
+		wantErr bool
+	}{
+		{name: "direct"},
+		{name: "http", dialer: HTTPConnectDialer(testHTTPProxy(t, nil), nil, nil)},
+		{name: "http auth", dialer: HTTPConnectDialer(testHTTPProxy(t, auth), auth, nil)},
+		{name: "http bad auth", dialer: HTTPConnectDialer(testHTTPProxy(t, auth), nil, nil), wantErr: true},
+		{name: "socks5", dialer: socks5},
+		{name: "socks5 auth", dialer: socks5Auth},
+		{name: "socks5 bad auth", dialer: socks5BadAuth, wantErr: true},
+		// a SOCKS5 proxy reached through an HTTP proxy
+		{name: "chained", dialer: func() ContextDialer {
+			d, err := SOCKS5Dialer(testSOCKS5Proxy(t, nil), nil, HTTPConnectDialer(testHTTPProxy(t, nil), nil, nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return d
+		}()},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			c, err := DialTLS(ctx, addr, &tls.Config{RootCAs: pool}, tt.dialer)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DialTLS() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			defer c.Close()
+			if !c.ConnectionState().HandshakeComplete || c.Kind() != "tls" {
+				t.Errorf("ConnectionState().HandshakeComplete, Kind() = %v, %q", c.ConnectionState().HandshakeComplete, c.Kind())
+			}
+			testEcho(t, c)
+		})
+	}
+}
+
+func TestDialSSH_jumpHost(t *testing.T) {
+	addr, hostKey := testSSHServer(t, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// the jump host is reached through an HTTP proxy, and a second
+	// jump host through it
+	jump, err := DialJumpHost(ctx, addr, "alice", FixedHostKey(hostKey), WithPassword("secret"), WithDialer(HTTPConnectDialer(testHTTPProxy(t, nil), nil, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jump.Close()
+	jump2, err := DialJumpHost(ctx, addr, "alice", FixedHostKey(hostKey), WithPassword("secret"), WithDialer(jump))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jump2.Close()
+
+	c, err := DialSSH(ctx, addr, "alice", FixedHostKey(hostKey), WithPassword("secret"), WithDialer(jump2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	testEcho(t, c)
+
+	if _, err := DialSSH(ctx, "127.0.0.1:1", "alice", FixedHostKey(hostKey), WithPassword("secret"), WithDialer(jump)); err == nil {
+		t.Error("DialSSH() via jump host to a closed port error = nil, want an error")
+	}
+}
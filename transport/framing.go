@@ -0,0 +1,460 @@
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+)
+
+// EndOfMessage is the :base:1.0 (RFC4742) end-of-message delimiter,
+// sent after each message.
+const EndOfMessage = "]]>]]>"
+
+// maxChunkSize is the largest chunk size allowed by RFC6242.
+const maxChunkSize = 4294967295
+
+var (
+	// ErrDelimiterInMessage is returned by Framer writes of messages
+	// containing the end-of-message delimiter, or ending with "]]>" so
+	// the delimiter would be found early, which cannot be sent with
+	// end-of-message framing. Well-formed XML has the delimiter only
+	// in comments, processing instructions and CDATA sections.
+	ErrDelimiterInMessage = errors.New("message contains the end-of-message delimiter")
+	// ErrBadChunk is returned by Framer reads of malformed chunked
+	// framing.
+	ErrBadChunk = errors.New("malformed chunked framing")
+)
+
+// TooLargeError is returned by Framer reads of messages exceeding a
+// limit set by a FramerOption.
+type TooLargeError struct {
+	// Limit is the limit exceeded: "message", "chunk" or "chunk
+	// header".
+	Limit string
+	// Max is the maximum size, in bytes.
+	Max int
+}
+
+func (e *TooLargeError) Error() string {
+	return fmt.Sprintf("%s exceeds the %d byte limit", e.Limit, e.Max)
+}
+
+// FramerOption is a constructor option for Framer.
+type FramerOption func(*Framer)
+
+// WithMaxMessageSize is a Framer option limiting messages read to n
+// bytes.
+func WithMaxMessageSize(n int) FramerOption {
+	return func(f *Framer) { f.maxMessage = n }
+}
+
+// WithMaxChunkSize is a Framer option limiting the chunks read to n
+// bytes, and splitting messages written into chunks of no more than n
+// bytes.
+func WithMaxChunkSize(n int) FramerOption {
+	return func(f *Framer) { f.maxChunk = n }
+}
+
+// WithMaxHeaderLength is a Framer option limiting the chunk size in
+// chunk headers read to n digits, rather than the ten needed for the
+// largest chunk.
+func WithMaxHeaderLength(n int) FramerOption {
+	return func(f *Framer) { f.maxHeader = n }
+}
+
+// WithCloseOnLimit is a Framer option closing the stream, if an
+// io.Closer, when a message read exceeds a limit, ending the session.
+// Reads then return the *TooLargeError.
+func WithCloseOnLimit() FramerOption {
+	return func(f *Framer) { f.closeOnLimit = true }
+}
+
+// Framer frames NETCONF messages on a byte stream, such as an SSH
+// channel's. It uses end-of-message framing until chunked framing is
+// enabled, after capability negotiation, implementing RFC6242Framer.
+//
+// Each Write writes one message. Reads read message data with the
+// framing removed, with each Read returning the data of no more than
+// one message, so a stream of messages can be decoded as one XML
+// document stream.
+//
+// Reads of messages exceeding a limit return a *TooLargeError, and the
+// rest of the message is discarded, so the next read returns the next
+// message's data. Chunk headers exceeding the header length limit
+// cannot be skipped, so the error is returned by later reads too.
+type Framer struct {
+	rw io.ReadWriter
+	r  *bufio.Reader
+
+	maxMessage, maxChunk, maxHeader int
+	closeOnLimit                    bool
+
+	wmu sync.Mutex
+	w   io.Writer
+
+	chunked int32
+	// rchunked is true once reads use chunked framing
+	rchunked bool
+
+	// inMessage is true when message data has been read since the
+	// last message ended
+	inMessage bool
+	// chunkLeft is the number of bytes of the current chunk to read
+	chunkLeft uint64
+	// messageLen is the length of the message read so far, or of its
+	// chunks when chunked
+	messageLen uint64
+	// discard is true when the rest of the message is to be discarded
+	discard bool
+	// rerr is the error returned by all reads, once one cannot continue
+	rerr error
+
+	framesIn, framesOut, framingErrors uint64
+}
+
+// NewFramer returns a framer of messages read from and written to rw.
+func NewFramer(rw io.ReadWriter, options ...FramerOption) *Framer {
+	f := &Framer{rw: rw, r: bufio.NewReader(rw), w: rw}
+	for _, option := range options {
+		option(f)
+	}
+	return f
+}
+
+// EnableChunkedFraming switches the framer to chunked framing, for
+// the messages following those already written, or read in full.
+func (f *Framer) EnableChunkedFraming() error {
+	atomic.StoreInt32(&f.chunked, 1)
+	return nil
+}
+
+// Write writes b as one message, returning ErrDelimiterInMessage if
+// it contains the end-of-message delimiter, or ends with "]]>", and
+// chunked framing is not enabled. The framed message is written with
+// a single Write call.
+func (f *Framer) Write(b []byte) (int, error) {
+	var msg []byte
+	if atomic.LoadInt32(&f.chunked) == 1 {
+		if len(b) == 0 {
+			// messages have at least one chunk, so none are empty
+			return 0, nil
+		}
+		size := len(b)
+		if f.maxChunk > 0 && size > f.maxChunk {
+			size = f.maxChunk
+		}
+		msg = make([]byte, 0, len(b)+(len(b)/size+1)*14+4)
+		for rest := b; len(rest) > 0; rest = rest[size:] {
+			if len(rest) < size {
+				size = len(rest)
+			}
+			msg = append(append(append(msg, "\n#"...), strconv.Itoa(size)+"\n"...), rest[:size]...)
+		}
+		msg = append(msg, "\n##\n"...)
+	} else {
+		// the delimiter repeats after three bytes, so a message
+		// ending with "]]>" would end three bytes early
+		if bytes.Contains(b, []byte(EndOfMessage)) || bytes.HasSuffix(b, []byte(EndOfMessage[:3])) {
+			atomic.AddUint64(&f.framingErrors, 1)
+			return 0, ErrDelimiterInMessage
+		}
+		msg = make([]byte, 0, len(b)+len(EndOfMessage))
+		msg = append(append(msg, b...), EndOfMessage...)
+	}
+	f.wmu.Lock()
+	defer f.wmu.Unlock()
+	if _, err := f.w.Write(msg); err != nil {
+		return 0, err
+	}
+	atomic.AddUint64(&f.framesOut, 1)
+	return len(b), nil
+}
+
+// Stats returns the framer's frame counts: the messages read and
+// written, and the framing errors found reading and writing them.
+func (f *Framer) Stats() Stats {
+	return Stats{
+		FramesIn:      atomic.LoadUint64(&f.framesIn),
+		FramesOut:     atomic.LoadUint64(&f.framesOut),
+		FramingErrors: atomic.LoadUint64(&f.framingErrors),
+	}
+}
+
+// counted returns the read error err, counting framing errors.
+func (f *Framer) counted(err error) error {
+	if _, ok := err.(*TooLargeError); ok || err == io.ErrUnexpectedEOF || errors.Cause(err) == ErrBadChunk {
+		atomic.AddUint64(&f.framingErrors, 1)
+	}
+	return err
+}
+
+// Read reads message data into b. It returns io.EOF when the stream
+// ends between messages, or io.ErrUnexpectedEOF within one.
+func (f *Framer) Read(b []byte) (int, error) {
+	if f.rerr != nil {
+		return 0, f.rerr
+	}
+	n, err := f.read(b)
+	if tl, ok := err.(*TooLargeError); ok && (f.closeOnLimit || tl.Limit == "chunk header") {
+		f.rerr = err
+		if c, ok := f.rw.(io.Closer); ok && f.closeOnLimit {
+			_ = c.Close()
+		}
+	}
+	return n, f.counted(err)
+}
+
+// tooLarge returns the error for a message exceeding the limit, the
+// rest of the message to be discarded.
+func (f *Framer) tooLarge(limit string, max int) error {
+	f.discard = true
+	return &TooLargeError{Limit: limit, Max: max}
+}
+
+func (f *Framer) read(b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+	if atomic.LoadInt32(&f.chunked) == 1 {
+		if !f.rchunked {
+			// discard the rest of the last end-of-message framed
+			// message, such as the delimiter after a <hello>
+			for buf := make([]byte, 512); f.inMessage; {
+				if _, _, err := f.readEOM(buf); err != nil {
+					return 0, err
+				}
+			}
+			f.rchunked = true
+			f.messageLen, f.discard = 0, false
+		}
+		if f.discard {
+			if err := f.discardChunked(); err != nil {
+				return 0, err
+			}
+		}
+		return f.readChunked(b)
+	}
+	if f.discard {
+		for buf := make([]byte, 512); ; {
+			_, end, err := f.readEOM(buf)
+			if err != nil {
+				return 0, err
+			}
+			if end {
+				f.discard = false
+				break
+			}
+		}
+	}
+	for {
+		n, end, err := f.readEOM(b)
+		if f.messageLen += uint64(n); end {
+			over := f.maxMessage > 0 && f.messageLen > uint64(f.maxMessage)
+			f.messageLen = 0
+			if over {
+				return 0, &TooLargeError{Limit: "message", Max: f.maxMessage}
+			}
+		} else if f.maxMessage > 0 && f.messageLen > uint64(f.maxMessage) {
+			f.messageLen = 0
+			return 0, f.tooLarge("message", f.maxMessage)
+		}
+		if n > 0 || err != nil {
+			return n, err
+		}
+	}
+}
+
+// readEOM reads end-of-message framed data, keeping back buffered data
+// which may begin a delimiter split across reads of the stream. It
+// returns true if the end of a message was read, in which case no data
+// may have been.
+func (f *Framer) readEOM(b []byte) (int, bool, error) {
+	for want := 1; ; want++ {
+		p, err := f.r.Peek(want)
+		if len(p) < want {
+			if err == io.EOF && len(p) > 0 {
+				// a truncated delimiter
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, false, f.eof(err)
+		}
+		p, _ = f.r.Peek(f.r.Buffered())
+		if i := bytes.Index(p, []byte(EndOfMessage)); i >= 0 {
+			n := copy(b, p[:i])
+			_, _ = f.r.Discard(n)
+			if n < i {
+				f.inMessage = true
+				return n, false, nil
+			}
+			_, _ = f.r.Discard(len(EndOfMessage))
+			if f.inMessage || n > 0 {
+				atomic.AddUint64(&f.framesIn, 1)
+			}
+			f.inMessage = false
+			return n, true, nil
+		}
+		if n := len(p) - delimiterPrefix(p); n > 0 {
+			n = copy(b, p[:n])
+			_, _ = f.r.Discard(n)
+			f.inMessage = true
+			return n, false, nil
+		}
+		// all buffered data may begin a delimiter, so read more
+		want = len(p)
+	}
+}
+
+// delimiterPrefix returns the length of the longest suffix of p which
+// is a prefix of the end-of-message delimiter.
+func delimiterPrefix(p []byte) int {
+	for n := len(EndOfMessage) - 1; n > 0; n-- {
+		if len(p) >= n && bytes.HasSuffix(p, []byte(EndOfMessage[:n])) {
+			return n
+		}
+	}
+	return 0
+}
+
+// readChunked reads chunked framed data.
+func (f *Framer) readChunked(b []byte) (int, error) {
+	for f.chunkLeft == 0 {
+		size, err := f.readChunkHeader()
+		if err != nil {
+			return 0, err
+		}
+		if size == 0 {
+			atomic.AddUint64(&f.framesIn, 1)
+			f.messageLen = 0
+		}
+		f.chunkLeft = size
+		f.inMessage = size > 0
+		f.messageLen += size
+		if f.maxChunk > 0 && size > uint64(f.maxChunk) {
+			return 0, f.tooLarge("chunk", f.maxChunk)
+		}
+		if f.maxMessage > 0 && f.messageLen > uint64(f.maxMessage) {
+			return 0, f.tooLarge("message", f.maxMessage)
+		}
+	}
+	if uint64(len(b)) > f.chunkLeft {
+		b = b[:f.chunkLeft]
+	}
+	n, err := f.r.Read(b)
+	f.chunkLeft -= uint64(n)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// discardChunked discards the rest of the chunked framed message.
+func (f *Framer) discardChunked() error {
+	for {
+		for f.chunkLeft > 0 {
+			n := f.chunkLeft
+			if n > 1<<20 {
+				n = 1 << 20
+			}
+			d, err := f.r.Discard(int(n))
+			f.chunkLeft -= uint64(d)
+			if err != nil {
+				return f.eof(err)
+			}
+		}
+		if !f.inMessage {
+			break
+		}
+		size, err := f.readChunkHeader()
+		if err != nil {
+			return err
+		}
+		if size == 0 {
+			atomic.AddUint64(&f.framesIn, 1)
+		}
+		f.chunkLeft = size
+		f.inMessage = size > 0
+	}
+	f.messageLen = 0
+	f.discard = false
+	return nil
+}
+
+// readChunkHeader reads a chunk header, returning the chunk size, or
+// zero for the end-of-chunks marker ending a message.
+func (f *Framer) readChunkHeader() (uint64, error) {
+	c, err := f.r.ReadByte()
+	if err != nil {
+		return 0, f.eof(err)
+	}
+	// the stream may not end within a header
+	next := func() (byte, error) {
+		c, err := f.r.ReadByte()
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return c, err
+	}
+	if c != '\n' {
+		return 0, errors.Wrapf(ErrBadChunk, "got %q, want a chunk header", c)
+	}
+	if c, err = next(); err != nil {
+		return 0, err
+	} else if c != '#' {
+		return 0, errors.Wrapf(ErrBadChunk, "got %q, want '#'", c)
+	}
+	if c, err = next(); err != nil {
+		return 0, err
+	}
+	if c == '#' {
+		if !f.inMessage {
+			return 0, errors.Wrap(ErrBadChunk, "end-of-chunks without a chunk")
+		}
+		if c, err = next(); err != nil {
+			return 0, err
+		} else if c != '\n' {
+			return 0, errors.Wrapf(ErrBadChunk, "got %q ending end-of-chunks, want newline", c)
+		}
+		return 0, nil
+	}
+	if c < '1' || c > '9' {
+		return 0, errors.Wrapf(ErrBadChunk, "chunk size begins with %q", c)
+	}
+	size := uint64(c - '0')
+	for digits := 1; ; digits++ {
+		if f.maxHeader > 0 && digits > f.maxHeader {
+			return 0, &TooLargeError{Limit: "chunk header", Max: f.maxHeader}
+		}
+		if c, err = next(); err != nil {
+			return 0, err
+		}
+		if c == '\n' {
+			return size, nil
+		}
+		if c < '0' || c > '9' {
+			return 0, errors.Wrapf(ErrBadChunk, "chunk size has %q", c)
+		}
+		if size = size*10 + uint64(c-'0'); size > maxChunkSize {
+			return 0, errors.Wrap(ErrBadChunk, "chunk size too large")
+		}
+	}
+}
+
+// eof returns the error to return for the read error err, returning
+// io.ErrUnexpectedEOF for the end of the stream within a message.
+func (f *Framer) eof(err error) error {
+	if err == io.EOF && f.inMessage {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+var (
+	_ RFC6242Framer = &Framer{}
+	_ StatsProvider = &Framer{}
+)
@@ -0,0 +1,256 @@
+package transport
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+// testPieces is a stream read in pieces, one per Read, to split
+// framing across reads.
+type testPieces struct {
+	pieces []string
+	bytes.Buffer
+}
+
+func (p *testPieces) Read(b []byte) (int, error) {
+	if len(p.pieces) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(b, p.pieces[0])
+	if p.pieces[0] = p.pieces[0][n:]; p.pieces[0] == "" {
+		p.pieces = p.pieces[1:]
+	}
+	return n, nil
+}
+
+// readMessages reads f until it fails, checking no Read returns data
+// of more than one of the messages want.
+func readMessages(t *testing.T, f *Framer, want []string) (string, error) {
+	t.Helper()
+	var ends []int
+	end := 0
+	for _, msg := range want {
+		end += len(msg)
+		ends = append(ends, end)
+	}
+	var got strings.Builder
+	b := make([]byte, 4)
+	for {
+		n, err := f.Read(b)
+		start := got.Len()
+		got.Write(b[:n])
+		for _, end := range ends {
+			if start < end && got.Len() > end {
+				t.Errorf("Read() of %q spans messages", b[:n])
+			}
+		}
+		if err != nil {
+			return got.String(), err
+		}
+	}
+}
+
+func TestFramer_Read(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		pieces  []string
+		chunked bool
+		want    []string
+		wantErr error
+	}{
+		{name: "eom", pieces: []string{"<hello/>]]>]]>"}, want: []string{"<hello/>"}, wantErr: io.EOF},
+		{name: "eom messages", pieces: []string{"<a/>]]>]]><b/>]]>]]>"}, want: []string{"<a/>", "<b/>"}, wantErr: io.EOF},
+		{name: "eom split delimiter", pieces: []string{"<a/>]]", ">]]", ">", "<b/>]]>]", "]>"}, want: []string{"<a/>", "<b/>"}, wantErr: io.EOF},
+		{name: "eom partial delimiters", pieces: []string{"a]]>b]]", ">]c]]>]]>"}, want: []string{"a]]>b]]>]c"}, wantErr: io.EOF},
+		{name: "eom empty message", pieces: []string{"]]>]]><a/>]]>]]>"}, want: []string{"<a/>"}, wantErr: io.EOF},
+		{name: "eom truncated", pieces: []string{"<a/>]]>]]><b"}, want: []string{"<a/>", "<b"}, wantErr: io.ErrUnexpectedEOF},
+		{name: "eom truncated delimiter", pieces: []string{"<a/>]]>]]"}, want: []string{"<a/>"}, wantErr: io.ErrUnexpectedEOF},
+		{name: "chunked", chunked: true, pieces: []string{"\n#4\n<a/>\n##\n\n#2\n<b\n#3\n/>\n\n##\n"}, want: []string{"<a/>", "<b/>\n"}, wantErr: io.EOF},
+		{name: "chunked split", chunked: true, pieces: []string{"\n", "#1", "2\n<rpc", "/></rpc>\n#", "#", "\n"}, want: []string{"<rpc/></rpc>"}, wantErr: io.EOF},
+		{name: "chunked truncated", chunked: true, pieces: []string{"\n#4\n<a"}, want: []string{"<a"}, wantErr: io.ErrUnexpectedEOF},
+		{name: "chunked truncated header", chunked: true, pieces: []string{"\n#4\n<a/>\n#"}, want: []string{"<a/>"}, wantErr: io.ErrUnexpectedEOF},
+		{name: "chunked no chunks", chunked: true, pieces: []string{"\n##\n"}, wantErr: ErrBadChunk},
+		{name: "chunked zero size", chunked: true, pieces: []string{"\n#0\n"}, wantErr: ErrBadChunk},
+		{name: "chunked leading zero", chunked: true, pieces: []string{"\n#01\na"}, wantErr: ErrBadChunk},
+		{name: "chunked too large", chunked: true, pieces: []string{"\n#4294967296\n"}, wantErr: ErrBadChunk},
+		{name: "chunked bad size", chunked: true, pieces: []string{"\n#1a\n"}, wantErr: ErrBadChunk},
+		{name: "chunked eom", chunked: true, pieces: []string{"<a/>]]>]]>"}, wantErr: ErrBadChunk},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			f := NewFramer(&testPieces{pieces: tt.pieces})
+			if tt.chunked {
+				_ = f.EnableChunkedFraming()
+			}
+			got, err := readMessages(t, f, tt.want)
+			if errors.Cause(err) != tt.wantErr {
+				t.Errorf("Read() error = %v, want %v", err, tt.wantErr)
+			}
+			if want := strings.Join(tt.want, ""); got != want {
+				t.Errorf("Read() data = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestFramer_Write(t *testing.T) {
+	var b testPieces
+	f := NewFramer(&b)
+	if _, err := f.Write([]byte("<hello/>")); err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range []string{"<!-- ]]>]]> -->", "<![CDATA[x]]>"} {
+		if _, err := f.Write([]byte(msg)); err != ErrDelimiterInMessage {
+			t.Errorf("Write(%q) error = %v, want %v", msg, err, ErrDelimiterInMessage)
+		}
+	}
+	_ = f.EnableChunkedFraming()
+	for _, msg := range []string{"<rpc/>", "", "<!-- ]]>]]> -->"} {
+		if n, err := f.Write([]byte(msg)); n != len(msg) || err != nil {
+			t.Errorf("Write(%q) = %d, %v, want %d, nil", msg, n, err, len(msg))
+		}
+	}
+	want := "<hello/>]]>]]>\n#6\n<rpc/>\n##\n\n#15\n<!-- ]]>]]> -->\n##\n"
+	if got := b.String(); got != want {
+		t.Errorf("written %q, want %q", got, want)
+	}
+}
+
+func TestFramer_EnableChunkedFraming(t *testing.T) {
+	// the <hello> is read without its delimiter before chunked
+	// framing is enabled, as by an XML decoder
+	f := NewFramer(&testPieces{pieces: []string{"<hello/>", "]]>]]>\n#6\n<rpc/>\n##\n"}})
+	b := make([]byte, len("<hello/>"))
+	if n, err := io.ReadFull(f, b); err != nil || string(b[:n]) != "<hello/>" {
+		t.Fatalf("Read() of hello = %q, %v", b[:n], err)
+	}
+	_ = f.EnableChunkedFraming()
+	b = make([]byte, 16)
+	if n, err := f.Read(b); err != nil || string(b[:n]) != "<rpc/>" {
+		t.Errorf("Read() after EnableChunkedFraming = %q, %v, want %q", b[:n], err, "<rpc/>")
+	}
+}
+
+// testClosePieces is a testPieces recording whether it was closed.
+type testClosePieces struct {
+	testPieces
+	closed bool
+}
+
+func (p *testClosePieces) Close() error {
+	p.closed = true
+	return nil
+}
+
+func TestFramer_limits(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		chunked bool
+		options []FramerOption
+		stream  string
+		want    string
+		wantErr []string
+		sticky  bool
+	}{
+		{
+			name:    "message",
+			options: []FramerOption{WithMaxMessageSize(8)},
+			stream:  "<a/>]]>]]><rpc>toolong</rpc>]]>]]><b/>]]>]]>",
+			want:    "<a/><rpc>too<b/>",
+			wantErr: []string{"message exceeds the 8 byte limit"},
+		},
+		{
+			name:    "chunk",
+			chunked: true,
+			options: []FramerOption{WithMaxChunkSize(4)},
+			stream:  "\n#3\n<a/\n#1\n>\n##\n\n#9\n<rpc/>xyz\n#2\nab\n##\n\n#4\n<b/>\n##\n",
+			want:    "<a/><b/>",
+			wantErr: []string{"chunk exceeds the 4 byte limit"},
+		},
+		{
+			name:    "chunked message",
+			chunked: true,
+			options: []FramerOption{WithMaxMessageSize(6)},
+			stream:  "\n#4\n<rpc\n#4\n/>ab\n##\n\n#4\n<b/>\n##\n",
+			want:    "<rpc<b/>",
+			wantErr: []string{"message exceeds the 6 byte limit"},
+		},
+		{
+			name:    "chunk header",
+			chunked: true,
+			options: []FramerOption{WithMaxHeaderLength(2)},
+			stream:  "\n#4\n<a/>\n##\n\n#100\n",
+			want:    "<a/>",
+			wantErr: []string{"chunk header exceeds the 2 byte limit"},
+			sticky:  true,
+		},
+		{
+			name:    "close on limit",
+			options: []FramerOption{WithMaxMessageSize(4), WithCloseOnLimit()},
+			stream:  "<a/>]]>]]><rpc/>]]>]]><b/>]]>]]>",
+			want:    "<a/><rpc",
+			wantErr: []string{"message exceeds the 4 byte limit"},
+			sticky:  true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &testClosePieces{testPieces: testPieces{pieces: []string{tt.stream}}}
+			f := NewFramer(p, tt.options...)
+			if tt.chunked {
+				_ = f.EnableChunkedFraming()
+			}
+			var got strings.Builder
+			var gotErr []string
+			b := make([]byte, 4)
+			for {
+				n, err := f.Read(b)
+				got.Write(b[:n])
+				if err == io.EOF {
+					break
+				}
+				tl, ok := err.(*TooLargeError)
+				if err != nil && !ok {
+					t.Fatalf("Read() error = %v", err)
+				}
+				if ok {
+					gotErr = append(gotErr, tl.Error())
+					if tt.sticky {
+						if _, err := f.Read(b); err != tl {
+							t.Errorf("Read() after %v error = %v, want the same error", tl, err)
+						}
+						break
+					}
+				}
+			}
+			if got.String() != tt.want {
+				t.Errorf("read %q, want %q", got.String(), tt.want)
+			}
+			if strings.Join(gotErr, "; ") != strings.Join(tt.wantErr, "; ") {
+				t.Errorf("Read() errors = %q, want %q", gotErr, tt.wantErr)
+			}
+			if want := tt.name == "close on limit"; p.closed != want {
+				t.Errorf("stream closed = %v, want %v", p.closed, want)
+			}
+			if stats := f.Stats(); stats.FramingErrors != uint64(len(tt.wantErr)) {
+				t.Errorf("Stats().FramingErrors = %d, want %d", stats.FramingErrors, len(tt.wantErr))
+			}
+		})
+	}
+}
+
+func TestFramer_WriteMaxChunkSize(t *testing.T) {
+	var out bytes.Buffer
+	f := NewFramer(&testRWTransport{Writer: &out}, WithMaxChunkSize(3))
+	_ = f.EnableChunkedFraming()
+	for _, msg := range []string{"<rpc/>", "<a/>x", "<b>"} {
+		if _, err := f.Write([]byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := "\n#3\n<rp\n#3\nc/>\n##\n\n#3\n<a/\n#2\n>x\n##\n\n#3\n<b>\n##\n"; out.String() != want {
+		t.Errorf("wrote %q, want %q", out.String(), want)
+	}
+}
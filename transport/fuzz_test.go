@@ -0,0 +1,91 @@
+package transport
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+// fuzzPieces returns b split into pieces of size bytes, the last
+// perhaps shorter.
+func fuzzPieces(b []byte, size uint8) []string {
+	n := int(size)%16 + 1
+	var pieces []string
+	for ; len(b) > n; b = b[n:] {
+		pieces = append(pieces, string(b[:n]))
+	}
+	return append(pieces, string(b))
+}
+
+func FuzzFramer_Read(f *testing.F) {
+	for _, seed := range []string{
+		"<hello/>]]>]]>",
+		"<a/>]]>]]><b/>]]>]]>",
+		"a]]>b]]>]c]]>]]>",
+		"\n#4\n<a/>\n##\n\n#2\n<b\n#3\n/>\n\n##\n",
+		"\n#12\n<rpc/></rpc>\n##\n",
+		"\n#4294967295\n",
+		"\n#01\na",
+	} {
+		f.Add([]byte(seed), false, uint8(3))
+		f.Add([]byte(seed), true, uint8(0))
+	}
+	f.Fuzz(func(t *testing.T, b []byte, chunked bool, size uint8) {
+		fr := NewFramer(&testPieces{pieces: fuzzPieces(b, size)},
+			WithMaxMessageSize(1<<16), WithMaxChunkSize(1<<12), WithMaxHeaderLength(8))
+		if chunked {
+			_ = fr.EnableChunkedFraming()
+		}
+		buf := make([]byte, int(size)%64+1)
+		var read int
+		// each Read returns data, or an error having consumed input
+		for reads := 0; reads <= 2*len(b)+2; reads++ {
+			n, err := fr.Read(buf)
+			if n < 0 || n > len(buf) {
+				t.Fatalf("Read() = %d, buffer of %d bytes", n, len(buf))
+			}
+			if read += n; read > len(b) {
+				t.Fatalf("read %d bytes of a %d byte stream", read, len(b))
+			}
+			if err == io.EOF || err == io.ErrUnexpectedEOF || (err != nil && fr.rerr != nil) {
+				return
+			}
+		}
+		t.Fatalf("reads of a %d byte stream did not end", len(b))
+	})
+}
+
+func FuzzFramer_WriteRead(f *testing.F) {
+	f.Add([]byte("<rpc/>"), false, 0)
+	f.Add([]byte("<!-- ]]>]]> -->"), true, 4)
+	f.Add([]byte("a]]>b]]"), false, 1)
+	f.Fuzz(func(t *testing.T, msg []byte, chunked bool, maxChunk int) {
+		var options []FramerOption
+		if maxChunk > 0 {
+			options = append(options, WithMaxChunkSize(maxChunk%1024+1))
+		}
+		var stream bytes.Buffer
+		w := NewFramer(&stream, options...)
+		if chunked {
+			_ = w.EnableChunkedFraming()
+		}
+		n, err := w.Write(msg)
+		if err == ErrDelimiterInMessage && !chunked {
+			return
+		} else if err != nil || n != len(msg) {
+			t.Fatalf("Write() = %d, %v, want %d, nil", n, err, len(msg))
+		}
+		r := NewFramer(&stream)
+		if chunked {
+			_ = r.EnableChunkedFraming()
+		}
+		got, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatalf("ReadAll() error = %v", err)
+		}
+		if !bytes.Equal(got, msg) {
+			t.Errorf("read %q, wrote %q", got, msg)
+		}
+	})
+}
@@ -0,0 +1,219 @@
+package transport
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// TimeoutError is the error of transports whose peer is found dead,
+// having sent nothing for longer than the transport's timeout. It
+// implements net.Error, reporting a timeout.
+type TimeoutError struct {
+	// Idle is the time since data was last read from the peer.
+	Idle time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("transport peer idle for %v", e.Idle.Round(time.Millisecond))
+}
+
+// Timeout returns true.
+func (e *TimeoutError) Timeout() bool { return true }
+
+// Temporary returns false; the transport is closed.
+func (e *TimeoutError) Temporary() bool { return false }
+
+// KeepaliveOption is a constructor option for Keepalive.
+type KeepaliveOption func(*Keepalive)
+
+// WithProbe is a Keepalive option calling probe each interval the
+// peer is idle for, such as to send an SSH keepalive request, whose
+// reply resets the idle time. The peer is found dead with the error
+// probe returns, if not nil.
+func WithProbe(interval time.Duration, probe func() error) KeepaliveOption {
+	return func(k *Keepalive) {
+		k.interval = interval
+		k.probe = probe
+	}
+}
+
+// Keepalive is a Transport detecting dead peers. It tracks the time
+// since data was last read from the peer, optionally probing the peer
+// while it is idle, and closes the underlying transport when the peer
+// is idle for longer than its timeout, or a probe fails. Pending and
+// later reads, writes and operations on the error channel then fail
+// with the error, a *TimeoutError if the peer timed out.
+type Keepalive struct {
+	Transport
+
+	timeout  time.Duration
+	interval time.Duration
+	probe    func() error
+
+	// lastRead is the time data was last read, in Unix nanoseconds
+	lastRead int64
+
+	mu    sync.Mutex
+	timer *time.Timer
+	err   error
+	dead  chan struct{}
+}
+
+// NewKeepalive returns a Keepalive transport over t, whose peer is
+// found dead when idle for the duration timeout.
+func NewKeepalive(t Transport, timeout time.Duration, options ...KeepaliveOption) *Keepalive {
+	k := &Keepalive{Transport: t, timeout: timeout, dead: make(chan struct{})}
+	for _, option := range options {
+		option(k)
+	}
+	atomic.StoreInt64(&k.lastRead, time.Now().UnixNano())
+	k.mu.Lock()
+	k.timer = time.AfterFunc(k.next(0), k.check)
+	k.mu.Unlock()
+	return k
+}
+
+// next returns the time to wait to check a peer idle for idle.
+func (k *Keepalive) next(idle time.Duration) time.Duration {
+	wait := k.timeout - idle
+	if k.probe != nil && k.interval > 0 && k.interval-idle%k.interval < wait {
+		wait = k.interval - idle%k.interval
+	}
+	return wait
+}
+
+// check finds the peer dead if idle for the timeout, or probes it if
+// due, re-arming the timer otherwise.
+func (k *Keepalive) check() {
+	idle := time.Since(time.Unix(0, atomic.LoadInt64(&k.lastRead)))
+	if idle >= k.timeout {
+		k.fail(&TimeoutError{Idle: idle})
+		return
+	}
+	if k.probe != nil && k.interval > 0 && idle >= k.interval {
+		if err := k.probe(); err != nil {
+			k.fail(err)
+			return
+		}
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.err == nil {
+		k.timer.Reset(k.next(idle))
+	}
+}
+
+// fail finds the peer dead with the error err, closing the transport.
+func (k *Keepalive) fail(err error) {
+	k.mu.Lock()
+	if k.err != nil {
+		k.mu.Unlock()
+		return
+	}
+	k.err = err
+	k.timer.Stop()
+	close(k.dead)
+	k.mu.Unlock()
+	_ = k.Transport.Close()
+}
+
+// Err returns the error the peer was found dead with, or nil.
+func (k *Keepalive) Err() error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.err
+}
+
+// Dead returns a channel closed when the peer is found dead.
+func (k *Keepalive) Dead() <-chan struct{} { return k.dead }
+
+// result returns err, or the error the peer was found dead with if
+// found dead.
+func (k *Keepalive) result(err error) error {
+	if err != nil {
+		if dead := k.Err(); dead != nil {
+			return dead
+		}
+	}
+	return err
+}
+
+// Read reads from the transport, noting the time data was read.
+func (k *Keepalive) Read(b []byte) (int, error) {
+	if err := k.Err(); err != nil {
+		return 0, err
+	}
+	n, err := k.Transport.Read(b)
+	if n > 0 {
+		atomic.StoreInt64(&k.lastRead, time.Now().UnixNano())
+	}
+	return n, k.result(err)
+}
+
+// Write writes to the transport.
+func (k *Keepalive) Write(b []byte) (int, error) {
+	if err := k.Err(); err != nil {
+		return 0, err
+	}
+	n, err := k.Transport.Write(b)
+	return n, k.result(err)
+}
+
+// Error returns the transport's error channel, or nil if it has none.
+// Data read from it also resets the peer's idle time.
+func (k *Keepalive) Error() io.ReadWriter {
+	rw := k.Transport.Error()
+	if rw == nil {
+		return nil
+	}
+	return keepaliveError{k: k, rw: rw}
+}
+
+// Close stops detecting a dead peer and closes the transport.
+func (k *Keepalive) Close() error {
+	k.mu.Lock()
+	k.timer.Stop()
+	k.mu.Unlock()
+	return k.Transport.Close()
+}
+
+// Username returns the username of the transport, or the empty string
+// if it reports none.
+func (k *Keepalive) Username() string { return usernameOf(k.Transport) }
+
+// Kind returns the kind of the transport, or its Go type if it
+// reports none.
+func (k *Keepalive) Kind() string { return kindOf(k.Transport) }
+
+// keepaliveError is the error channel of a Keepalive transport.
+type keepaliveError struct {
+	k  *Keepalive
+	rw io.ReadWriter
+}
+
+func (e keepaliveError) Read(b []byte) (int, error) {
+	if err := e.k.Err(); err != nil {
+		return 0, err
+	}
+	n, err := e.rw.Read(b)
+	if n > 0 {
+		atomic.StoreInt64(&e.k.lastRead, time.Now().UnixNano())
+	}
+	return n, e.k.result(err)
+}
+
+func (e keepaliveError) Write(b []byte) (int, error) {
+	if err := e.k.Err(); err != nil {
+		return 0, err
+	}
+	n, err := e.rw.Write(b)
+	return n, e.k.result(err)
+}
+
+var (
+	_ ServerTransport = &Keepalive{}
+	_ Kinder          = &Keepalive{}
+)
@@ -0,0 +1,97 @@
+package transport
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// testPipeTransport is a transport reading from a pipe, closed by
+// Close.
+type testPipeTransport struct {
+	r *io.PipeReader
+	io.Writer
+}
+
+func newTestPipeTransport() (*testPipeTransport, *io.PipeWriter) {
+	r, w := io.Pipe()
+	return &testPipeTransport{r: r, Writer: ioutil.Discard}, w
+}
+
+func (t *testPipeTransport) Read(b []byte) (int, error) { return t.r.Read(b) }
+func (t *testPipeTransport) Close() error               { return t.r.CloseWithError(errors.New("closed")) }
+func (t *testPipeTransport) CloseWrite() error          { return nil }
+func (t *testPipeTransport) Error() io.ReadWriter       { return nil }
+func (t *testPipeTransport) Username() string           { return "alice" }
+
+func TestKeepalive_timeout(t *testing.T) {
+	tr, w := newTestPipeTransport()
+	k := NewKeepalive(tr, 60*time.Millisecond)
+	defer k.Close()
+	if k.Username() != "alice" || k.Kind() != "*transport.testPipeTransport" {
+		t.Errorf("Username(), Kind() = %q, %q", k.Username(), k.Kind())
+	}
+
+	// data read within the timeout keeps the peer alive
+	go func() {
+		for i := 0; i < 4; i++ {
+			time.Sleep(30 * time.Millisecond)
+			_, _ = w.Write([]byte("x"))
+		}
+	}()
+	b := make([]byte, 1)
+	for i := 0; i < 4; i++ {
+		if _, err := k.Read(b); err != nil {
+			t.Fatalf("Read() of live peer error = %v", err)
+		}
+	}
+
+	_, err := k.Read(b)
+	var timeout *TimeoutError
+	if !errors.As(err, &timeout) || !timeout.Timeout() || timeout.Idle < 60*time.Millisecond {
+		t.Fatalf("Read() of idle peer error = %v, want *TimeoutError", err)
+	}
+	if _, ok := err.(net.Error); !ok {
+		t.Errorf("Read() error %T is not a net.Error", err)
+	}
+	select {
+	case <-k.Dead():
+	default:
+		t.Error("Dead() not closed after timeout")
+	}
+	if _, err := k.Write(b); err != timeout {
+		t.Errorf("Write() after timeout error = %v, want %v", err, timeout)
+	}
+}
+
+func TestKeepalive_probe(t *testing.T) {
+	tr, w := newTestPipeTransport()
+	var probes int32
+	k := NewKeepalive(tr, 100*time.Millisecond, WithProbe(20*time.Millisecond, func() error {
+		// the peer replies to probes
+		atomic.AddInt32(&probes, 1)
+		go func() { _, _ = w.Write([]byte("pong")) }()
+		return nil
+	}))
+	defer k.Close()
+	b := make([]byte, 4)
+	for start := time.Now(); time.Since(start) < 200*time.Millisecond; {
+		if _, err := k.Read(b); err != nil {
+			t.Fatalf("Read() of probed peer error = %v", err)
+		}
+	}
+	if atomic.LoadInt32(&probes) < 5 {
+		t.Errorf("probes = %d, want at least 5", probes)
+	}
+
+	failed := errors.New("probe failed")
+	k = NewKeepalive(tr, time.Second, WithProbe(10*time.Millisecond, func() error { return failed }))
+	if _, err := k.Read(b); err != failed {
+		t.Errorf("Read() after failed probe error = %v, want %v", err, failed)
+	}
+}
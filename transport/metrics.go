@@ -0,0 +1,159 @@
+package transport
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/andaru/opr8/metrics"
+)
+
+// Stats are the statistics of a transport.
+type Stats struct {
+	// Start is the time the transport was opened, and End the time it
+	// was closed, or the zero time if it is open.
+	Start, End time.Time
+	// BytesIn and BytesOut are the number of bytes read and written.
+	BytesIn, BytesOut uint64
+	// FramesIn and FramesOut are the number of messages read and
+	// written, and FramingErrors the number of framing errors found
+	// reading or writing them.
+	FramesIn, FramesOut, FramingErrors uint64
+}
+
+// Duration returns the time the transport has been, or was, open.
+func (s Stats) Duration() time.Duration {
+	if s.Start.IsZero() {
+		return 0
+	}
+	if s.End.IsZero() {
+		return time.Since(s.Start)
+	}
+	return s.End.Sub(s.Start)
+}
+
+// StatsProvider is the optional interface to transports, and framers,
+// reporting their statistics.
+type StatsProvider interface {
+	// Stats returns the statistics.
+	Stats() Stats
+}
+
+// Metrics is a Transport counting the bytes read from and written to
+// another, and the time it is open, implementing StatsProvider. The
+// frame counts are those of the transport, if a StatsProvider, such
+// as one framing messages with a Framer.
+type Metrics struct {
+	Transport
+
+	bytesIn, bytesOut uint64
+
+	// the counters reported to a registry, if any
+	regIn, regOut metrics.Counter
+	reg           metrics.Registry
+
+	mu         sync.Mutex
+	start, end time.Time
+}
+
+// MetricsOption is a constructor option for Metrics.
+type MetricsOption func(*Metrics)
+
+// WithRegistry is a Metrics option which also reports the transport's
+// statistics with the registry r, labelled by its kind: the bytes read
+// and written as they are, and the frames, framing errors and the
+// time the transport was open once it is closed.
+func WithRegistry(r metrics.Registry) MetricsOption {
+	return func(m *Metrics) { m.reg = r }
+}
+
+// NewMetrics returns a transport over t, opened now, counting its
+// traffic.
+func NewMetrics(t Transport, options ...MetricsOption) *Metrics {
+	m := &Metrics{Transport: t, start: time.Now()}
+	for _, option := range options {
+		option(m)
+	}
+	if m.reg != nil {
+		kind := kindOf(t)
+		m.regIn = m.reg.Counter("transport_read_bytes_total", "Bytes read from transports.", "transport", kind)
+		m.regOut = m.reg.Counter("transport_written_bytes_total", "Bytes written to transports.", "transport", kind)
+	}
+	return m
+}
+
+// Read reads from the transport, counting the bytes read.
+func (m *Metrics) Read(b []byte) (int, error) {
+	n, err := m.Transport.Read(b)
+	atomic.AddUint64(&m.bytesIn, uint64(n))
+	if m.regIn != nil && n > 0 {
+		m.regIn.Add(float64(n))
+	}
+	return n, err
+}
+
+// Write writes to the transport, counting the bytes written.
+func (m *Metrics) Write(b []byte) (int, error) {
+	n, err := m.Transport.Write(b)
+	atomic.AddUint64(&m.bytesOut, uint64(n))
+	if m.regOut != nil && n > 0 {
+		m.regOut.Add(float64(n))
+	}
+	return n, err
+}
+
+// Close closes the transport, ending the time it is open.
+func (m *Metrics) Close() error {
+	m.mu.Lock()
+	closed := m.end.IsZero()
+	if closed {
+		m.end = time.Now()
+	}
+	m.mu.Unlock()
+	if closed && m.reg != nil {
+		m.report()
+	}
+	return m.Transport.Close()
+}
+
+// Stats returns the statistics of the transport.
+func (m *Metrics) Stats() Stats {
+	var s Stats
+	if p, ok := m.Transport.(StatsProvider); ok {
+		s = p.Stats()
+	}
+	m.mu.Lock()
+	s.Start, s.End = m.start, m.end
+	m.mu.Unlock()
+	s.BytesIn = atomic.LoadUint64(&m.bytesIn)
+	s.BytesOut = atomic.LoadUint64(&m.bytesOut)
+	return s
+}
+
+// report reports the statistics of the closed transport to the
+// registry.
+func (m *Metrics) report() {
+	s, kind := m.Stats(), kindOf(m.Transport)
+	m.reg.Counter("transport_frames_read_total", "Messages read from transports.", "transport", kind).Add(float64(s.FramesIn))
+	m.reg.Counter("transport_frames_written_total", "Messages written to transports.", "transport", kind).Add(float64(s.FramesOut))
+	m.reg.Counter("transport_framing_errors_total", "Framing errors reading and writing messages.", "transport", kind).Add(float64(s.FramingErrors))
+	m.reg.Histogram("transport_open_seconds", "Time transports were open.", openBuckets, "transport", kind).Observe(s.Duration().Seconds())
+}
+
+// openBuckets are the histogram buckets of the time transports are
+// open, in seconds.
+var openBuckets = []float64{1, 10, 60, 300, 900, 3600, 4 * 3600, 24 * 3600}
+
+// Username returns the username of the transport, or the empty string
+// if it reports none.
+func (m *Metrics) Username() string { return usernameOf(m.Transport) }
+
+// Kind returns the kind of the transport, or its Go type if it
+// reports none.
+func (m *Metrics) Kind() string { return kindOf(m.Transport) }
+
+var (
+	_ ServerTransport = &Metrics{}
+	_ StatsProvider   = &Metrics{}
+	_ Kinder          = &Metrics{}
+)
@@ -0,0 +1,84 @@
+package transport
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andaru/opr8/metrics"
+)
+
+// testFramedTransport is a transport framing messages with a Framer.
+type testFramedTransport struct {
+	*Framer
+	testRWTransport
+}
+
+func (t testFramedTransport) Read(b []byte) (int, error)  { return t.Framer.Read(b) }
+func (t testFramedTransport) Write(b []byte) (int, error) { return t.Framer.Write(b) }
+
+func TestMetrics(t *testing.T) {
+	raw := testRWTransport{Reader: strings.NewReader("<a/>]]>]]><b/>]]>]]><c"), Writer: &bytes.Buffer{}}
+	m := NewMetrics(testFramedTransport{Framer: NewFramer(raw), testRWTransport: raw})
+	if _, err := m.Write([]byte("<hello/>")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Write([]byte("]]>]]>")); err == nil {
+		t.Fatal("Write() of delimiter error = nil, want error")
+	}
+	if _, err := ioutil.ReadAll(m); err == nil {
+		t.Fatal("ReadAll() of truncated message error = nil, want error")
+	}
+	time.Sleep(time.Millisecond)
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	got := m.Stats()
+	want := Stats{Start: got.Start, End: got.End, BytesIn: 10, BytesOut: 8, FramesIn: 2, FramesOut: 1, FramingErrors: 2}
+	if got != want {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+	if d := got.Duration(); d < time.Millisecond || d != got.End.Sub(got.Start) {
+		t.Errorf("Stats().Duration() = %v, want the time open", d)
+	}
+}
+
+func TestMetrics_Registry(t *testing.T) {
+	r := metrics.NewExpvar()
+	raw := testRWTransport{Reader: strings.NewReader("<a/>]]>]]><b/>]]>]]>"), Writer: &bytes.Buffer{}}
+	m := NewMetrics(testFramedTransport{Framer: NewFramer(raw), testRWTransport: raw}, WithRegistry(r))
+	if _, err := m.Write([]byte("<hello/>")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ioutil.ReadAll(m); err != nil {
+		t.Fatal(err)
+	}
+	kind := `{transport="transport.testFramedTransport"}`
+	if v, _ := r.Value("transport_read_bytes_total" + kind); v != 8 {
+		t.Errorf("transport_read_bytes_total = %v before Close(), want 8", v)
+	}
+	if v, ok := r.Value("transport_frames_read_total" + kind); ok {
+		t.Errorf("transport_frames_read_total = %v before Close(), want none", v)
+	}
+	for i := 0; i < 2; i++ {
+		if err := m.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, want := range map[string]float64{
+		"transport_read_bytes_total":     8,
+		"transport_written_bytes_total":  8,
+		"transport_frames_read_total":    2,
+		"transport_frames_written_total": 1,
+		"transport_framing_errors_total": 0,
+	} {
+		if got, _ := r.Value(name + kind); got != want {
+			t.Errorf("%s = %v, want %v", name, got, want)
+		}
+	}
+	if !strings.Contains(r.String(), `"transport_open_seconds{transport=\"transport.testFramedTransport\"}":{"count":1,`) {
+		t.Errorf("transport_open_seconds not observed once: %s", r.String())
+	}
+}
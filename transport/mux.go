@@ -0,0 +1,313 @@
+package transport
+
+import (
+	"encoding/binary"
+	"io"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// ErrChannelOpen is returned by Mux.Open for channels already open.
+var ErrChannelOpen = errors.New("mux channel already open")
+
+// mux frame types
+const (
+	muxData byte = 1 + iota
+	muxCloseWrite
+	muxClose
+)
+
+// muxHeaderLen is the length of a mux frame header: the channel ID,
+// frame type and payload length.
+const muxHeaderLen = 9
+
+// Mux multiplexes channels, each a Transport, over one transport, such
+// as an RPC channel and a notification channel over one connection.
+// Data is carried in frames prefixed with the channel ID, frame type
+// and payload length, one for each channel write, so each channel read
+// returns the data of no more than one write.
+//
+// Either peer opens a channel with Open, which the other accepts when
+// it first receives data for it, and either may close it. Channel IDs
+// should not be reused while data for a closed channel may be in
+// flight. Channels are not flow controlled: data received is buffered
+// until read.
+type Mux struct {
+	t Transport
+
+	wmu sync.Mutex
+
+	mu       sync.Mutex
+	channels map[uint32]*Channel
+	err      error
+	accept   chan *Channel
+	done     chan struct{}
+}
+
+// NewMux returns a mux of channels over the transport t, reading from
+// it until it ends or the mux is closed.
+func NewMux(t Transport) *Mux {
+	m := &Mux{
+		t:        t,
+		channels: map[uint32]*Channel{},
+		accept:   make(chan *Channel, 16),
+		done:     make(chan struct{}),
+	}
+	go m.read()
+	return m
+}
+
+// Open opens the channel with the ID, returning ErrChannelOpen if it
+// is open.
+func (m *Mux) Open(id uint32) (*Channel, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return nil, m.err
+	}
+	if _, ok := m.channels[id]; ok {
+		return nil, errors.Wrapf(ErrChannelOpen, "channel %d", id)
+	}
+	return m.newChannel(id), nil
+}
+
+// Accept returns the next channel opened by the peer, or the error the
+// mux ended with, io.EOF if the transport ended.
+func (m *Mux) Accept() (*Channel, error) {
+	select {
+	case c := <-m.accept:
+		return c, nil
+	case <-m.done:
+		select {
+		case c := <-m.accept:
+			return c, nil
+		default:
+		}
+		return nil, m.Err()
+	}
+}
+
+// Err returns the error the mux ended with, or nil while running.
+func (m *Mux) Err() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.err
+}
+
+// Close closes the mux, its channels and transport.
+func (m *Mux) Close() error {
+	m.fail(io.ErrClosedPipe)
+	return m.t.Close()
+}
+
+// newChannel returns a new channel with the ID. m.mu is held.
+func (m *Mux) newChannel(id uint32) *Channel {
+	c := &Channel{m: m, id: id}
+	c.cond = sync.NewCond(&c.mu)
+	m.channels[id] = c
+	return c
+}
+
+// fail ends the mux with the error err, ending its channels' reads.
+func (m *Mux) fail(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return
+	}
+	m.err = err
+	close(m.done)
+	for _, c := range m.channels {
+		c.ended(err)
+	}
+}
+
+// read reads frames from the transport, passing them to their channels.
+func (m *Mux) read() {
+	header := make([]byte, muxHeaderLen)
+	for {
+		if _, err := io.ReadFull(m.t, header); err != nil {
+			m.fail(err)
+			return
+		}
+		id, typ := binary.BigEndian.Uint32(header), header[4]
+		data := make([]byte, binary.BigEndian.Uint32(header[5:]))
+		if _, err := io.ReadFull(m.t, data); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			m.fail(err)
+			return
+		}
+
+		m.mu.Lock()
+		c, ok := m.channels[id]
+		if !ok && typ == muxData {
+			c = m.newChannel(id)
+			select {
+			case m.accept <- c:
+			default:
+				// too many channels are waiting to be accepted, so
+				// refuse the channel
+				delete(m.channels, id)
+				c = nil
+				go func() { _ = m.write(id, muxClose, nil) }()
+			}
+		}
+		if typ == muxClose && c != nil {
+			delete(m.channels, id)
+		}
+		m.mu.Unlock()
+		if c != nil {
+			c.received(data, typ)
+		}
+	}
+}
+
+// write writes a frame of the type for the channel with the ID.
+func (m *Mux) write(id uint32, typ byte, b []byte) error {
+	frame := make([]byte, muxHeaderLen+len(b))
+	binary.BigEndian.PutUint32(frame, id)
+	frame[4] = typ
+	binary.BigEndian.PutUint32(frame[5:], uint32(len(b)))
+	copy(frame[muxHeaderLen:], b)
+	m.wmu.Lock()
+	defer m.wmu.Unlock()
+	_, err := m.t.Write(frame)
+	return err
+}
+
+// Channel is a channel of a Mux. It is a ServerTransport and
+// ClientTransport, reporting the username and kind of the mux's
+// transport.
+type Channel struct {
+	m  *Mux
+	id uint32
+
+	mu   sync.Mutex
+	cond *sync.Cond
+	data [][]byte
+	// eof is true once the peer closes its writing side, and
+	// peerClosed once it closes the channel
+	eof, peerClosed bool
+	// err is the error the mux ended with
+	err    error
+	closed bool
+}
+
+// ID returns the channel ID.
+func (c *Channel) ID() uint32 { return c.id }
+
+// received receives a frame of the type from the peer.
+func (c *Channel) received(data []byte, typ byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch typ {
+	case muxData:
+		if len(data) > 0 {
+			c.data = append(c.data, data)
+		}
+	case muxCloseWrite:
+		c.eof = true
+	case muxClose:
+		c.eof, c.peerClosed = true, true
+	}
+	c.cond.Broadcast()
+}
+
+// ended ends the channel with the error the mux ended with.
+func (c *Channel) ended(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.eof, c.err = true, err
+	c.cond.Broadcast()
+}
+
+// Read reads data written to the channel by the peer, returning io.EOF
+// once the peer closes the channel or the mux ends.
+func (c *Channel) Read(b []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.data) == 0 && !c.eof && !c.closed {
+		c.cond.Wait()
+	}
+	if c.closed {
+		return 0, io.ErrClosedPipe
+	}
+	if len(c.data) == 0 {
+		if c.err != nil && c.err != io.EOF && c.err != io.ErrClosedPipe {
+			return 0, c.err
+		}
+		return 0, io.EOF
+	}
+	n := copy(b, c.data[0])
+	if c.data[0] = c.data[0][n:]; len(c.data[0]) == 0 {
+		c.data = c.data[1:]
+	}
+	return n, nil
+}
+
+// Write writes b to the channel in one frame.
+func (c *Channel) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	closed, err := c.closed || c.peerClosed, c.err
+	c.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+	if closed {
+		return 0, io.ErrClosedPipe
+	}
+	if len(b) == 0 {
+		return 0, nil
+	}
+	if err := c.m.write(c.id, muxData, b); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// CloseWrite closes the writing side of the channel, so the peer reads
+// io.EOF once it has read the data written.
+func (c *Channel) CloseWrite() error { return c.m.write(c.id, muxCloseWrite, nil) }
+
+// Close closes the channel.
+func (c *Channel) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	c.data = nil
+	c.cond.Broadcast()
+	peerClosed, err := c.peerClosed, c.err
+	c.mu.Unlock()
+	c.m.mu.Lock()
+	if c.m.channels[c.id] == c {
+		delete(c.m.channels, c.id)
+	}
+	c.m.mu.Unlock()
+	if peerClosed || err != nil {
+		return nil
+	}
+	return c.m.write(c.id, muxClose, nil)
+}
+
+// Error returns nil; channels have no error channel.
+func (c *Channel) Error() io.ReadWriter { return nil }
+
+// Username returns the username of the mux's transport, or the empty
+// string if it reports none.
+func (c *Channel) Username() string { return usernameOf(c.m.t) }
+
+// Kind returns the kind of the mux's transport, or its Go type if it
+// reports none.
+func (c *Channel) Kind() string { return kindOf(c.m.t) }
+
+var (
+	_ ServerTransport = &Channel{}
+	_ ClientTransport = &Channel{}
+	_ Kinder          = &Channel{}
+)
@@ -0,0 +1,118 @@
+package transport
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestMux(t *testing.T) {
+	c, s := net.Pipe()
+	client, server := NewMux(testConnTransport{c}), NewMux(testConnTransport{s})
+	defer client.Close()
+	defer server.Close()
+
+	rpc, err := client.Open(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notif, err := client.Open(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Open(1); errors.Cause(err) != ErrChannelOpen {
+		t.Errorf("Open() of an open channel error = %v, want %v", err, ErrChannelOpen)
+	}
+	for _, msg := range []struct {
+		c    *Channel
+		data string
+	}{{rpc, "<rpc/>"}, {notif, "<create-subscription/>"}, {rpc, "<get/>"}} {
+		if _, err := msg.c.Write([]byte(msg.data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// channels are accepted in the order opened, each read returning
+	// the data of one write
+	accepted := map[uint32][]string{}
+	b := make([]byte, 64)
+	for i, want := range []uint32{1, 2} {
+		ch, err := server.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ch.ID() != want || ch.Username() != "alice" {
+			t.Errorf("channel %d ID(), Username() = %d, %q, want %d, %q", i, ch.ID(), ch.Username(), want, "alice")
+		}
+		n, err := ch.Read(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		accepted[ch.ID()] = append(accepted[ch.ID()], string(b[:n]))
+		if ch.ID() == 1 {
+			if n, err = ch.Read(b); err != nil {
+				t.Fatal(err)
+			}
+			accepted[1] = append(accepted[1], string(b[:n]))
+			if _, err := ch.Write([]byte("<rpc-reply/>")); err != nil {
+				t.Fatal(err)
+			}
+			if err := ch.CloseWrite(); err != nil {
+				t.Fatal(err)
+			}
+		} else {
+			_ = ch.Close()
+		}
+	}
+	if got := accepted[1]; len(got) != 2 || got[0] != "<rpc/>" || got[1] != "<get/>" {
+		t.Errorf("channel 1 read %q", got)
+	}
+	if got := accepted[2]; len(got) != 1 || got[0] != "<create-subscription/>" {
+		t.Errorf("channel 2 read %q", got)
+	}
+
+	// the reply is read, then EOF once the peer's writes are closed
+	if b, err := ioutil.ReadAll(rpc); err != nil || string(b) != "<rpc-reply/>" {
+		t.Errorf("channel 1 ReadAll() = %q, %v, want %q, nil", b, err, "<rpc-reply/>")
+	}
+	// writes fail once the peer closes the channel
+	if _, err := ioutil.ReadAll(notif); err != nil {
+		t.Errorf("channel 2 ReadAll() error = %v", err)
+	}
+	if _, err := notif.Write([]byte("x")); err != io.ErrClosedPipe {
+		t.Errorf("Write() to a channel closed by the peer error = %v, want %v", err, io.ErrClosedPipe)
+	}
+}
+
+func TestMux_transportEnds(t *testing.T) {
+	c, s := net.Pipe()
+	client, server := NewMux(testConnTransport{c}), NewMux(testConnTransport{s})
+	ch, err := server.Open(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = client.Close()
+	if _, err := server.Accept(); err != io.EOF {
+		t.Errorf("Accept() error = %v, want %v", err, io.EOF)
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := ch.Read(make([]byte, 1))
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != io.EOF {
+			t.Errorf("Read() error = %v, want %v", err, io.EOF)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Read() not ended by the transport ending")
+	}
+	if _, err := server.Open(8); err != io.EOF {
+		t.Errorf("Open() error = %v, want %v", err, io.EOF)
+	}
+}
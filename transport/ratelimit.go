@@ -0,0 +1,165 @@
+package transport
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// RateLimitOption is a constructor option for RateLimit.
+type RateLimitOption func(*RateLimit)
+
+// WithBurst is a RateLimit option allowing bursts of up to n bytes
+// read or written at once, one second's worth of data by default.
+func WithBurst(n int) RateLimitOption {
+	return func(t *RateLimit) { t.burst = n }
+}
+
+// RateLimit is a Transport limiting the rate of the data read from
+// and written to another with token buckets, one for each direction,
+// so a client streaming large requests or reading large replies
+// cannot monopolise a small server. Limits are set per transport, such
+// as by the factory passed to session.Serve for a listener.
+//
+// Each read reads no more than the burst size, and a write is written
+// with a single Write whatever its size, so messages written by a
+// Framer stay whole; the time taken to send data over the limit is
+// waited for before the next read or write in the same direction.
+type RateLimit struct {
+	Transport
+	burst       int
+	read, write *bucket
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// NewRateLimit returns a transport over t limited to reading read and
+// writing write bytes per second, or not limited in a direction if
+// zero.
+func NewRateLimit(t Transport, read, write int, options ...RateLimitOption) *RateLimit {
+	r := &RateLimit{Transport: t, closed: make(chan struct{})}
+	for _, option := range options {
+		option(r)
+	}
+	if read > 0 {
+		r.read = newBucket(read, r.burst)
+	}
+	if write > 0 {
+		r.write = newBucket(write, r.burst)
+	}
+	return r
+}
+
+// wait waits for the bucket b to have tokens, returning
+// io.ErrClosedPipe if the transport is closed meanwhile.
+func (t *RateLimit) wait(b *bucket) error {
+	d := b.wait()
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-t.closed:
+		return io.ErrClosedPipe
+	}
+}
+
+// Read reads from the transport, within the read rate limit.
+func (t *RateLimit) Read(b []byte) (int, error) {
+	if t.read == nil {
+		return t.Transport.Read(b)
+	}
+	if err := t.wait(t.read); err != nil {
+		return 0, err
+	}
+	if len(b) > t.read.burst {
+		b = b[:t.read.burst]
+	}
+	n, err := t.Transport.Read(b)
+	t.read.take(n)
+	return n, err
+}
+
+// Write writes to the transport, within the write rate limit.
+func (t *RateLimit) Write(b []byte) (int, error) {
+	if t.write == nil {
+		return t.Transport.Write(b)
+	}
+	if err := t.wait(t.write); err != nil {
+		return 0, err
+	}
+	n, err := t.Transport.Write(b)
+	t.write.take(n)
+	return n, err
+}
+
+// Close closes the transport, ending reads and writes waiting for the
+// rate limit.
+func (t *RateLimit) Close() error {
+	t.closeOnce.Do(func() { close(t.closed) })
+	return t.Transport.Close()
+}
+
+// Username returns the username of the transport, or the empty string
+// if it reports none.
+func (t *RateLimit) Username() string { return usernameOf(t.Transport) }
+
+// Kind returns the kind of the transport, or its Go type if it
+// reports none.
+func (t *RateLimit) Kind() string { return kindOf(t.Transport) }
+
+// bucket is a token bucket, holding up to burst tokens, each a byte,
+// refilled at rate tokens per second. Its tokens go negative when
+// more are taken than it holds, the debt repaid before more are.
+type bucket struct {
+	rate, burst int
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newBucket(rate, burst int) *bucket {
+	if burst <= 0 {
+		burst = rate
+	}
+	return &bucket{rate: rate, burst: burst, tokens: float64(burst), last: time.Now()}
+}
+
+// refill adds the tokens accrued since last refilled. b.mu is held.
+func (b *bucket) refill() {
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * float64(b.rate)
+	if b.tokens > float64(b.burst) {
+		b.tokens = float64(b.burst)
+	}
+	b.last = now
+}
+
+// wait returns the time to wait for the bucket to have tokens.
+func (b *bucket) wait() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill()
+	if b.tokens > 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / float64(b.rate) * float64(time.Second))
+}
+
+// take takes n tokens from the bucket.
+func (b *bucket) take(n int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill()
+	b.tokens -= float64(n)
+}
+
+var (
+	_ ServerTransport = &RateLimit{}
+	_ Kinder          = &RateLimit{}
+)
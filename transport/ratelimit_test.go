@@ -0,0 +1,67 @@
+package transport
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateLimit(t *testing.T) {
+	var out bytes.Buffer
+	raw := testRWTransport{Reader: strings.NewReader(strings.Repeat("x", 300)), Writer: &out}
+	tr := NewRateLimit(raw, 2000, 2000, WithBurst(100))
+
+	// reads are no larger than the burst, and the 200 bytes over it
+	// take 100ms at 2000 bytes per second
+	start := time.Now()
+	b := make([]byte, 1000)
+	var reads []int
+	for {
+		n, err := tr.Read(b)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		reads = append(reads, n)
+	}
+	if d := time.Since(start); d < 90*time.Millisecond {
+		t.Errorf("read 300 bytes in %v, want at least 100ms", d)
+	}
+	if len(reads) != 3 || reads[0] != 100 {
+		t.Errorf("reads = %v, want 3 of 100 bytes", reads)
+	}
+
+	// writes are whole, the one after a write over the burst waiting
+	start = time.Now()
+	for _, msg := range []string{strings.Repeat("y", 300), "z"} {
+		if n, err := tr.Write([]byte(msg)); err != nil || n != len(msg) {
+			t.Fatalf("Write() = %d, %v, want %d, nil", n, err, len(msg))
+		}
+	}
+	if d := time.Since(start); d < 90*time.Millisecond {
+		t.Errorf("wrote 301 bytes in %v, want at least 100ms", d)
+	}
+	if out.Len() != 301 {
+		t.Errorf("wrote %d bytes, want 301", out.Len())
+	}
+
+	// Close ends a write waiting for the limit
+	if _, err := tr.Write([]byte(strings.Repeat("y", 300))); err != nil {
+		t.Fatal(err)
+	}
+	time.AfterFunc(10*time.Millisecond, func() { _ = tr.Close() })
+	if _, err := tr.Write([]byte("z")); err != io.ErrClosedPipe {
+		t.Errorf("Write() waiting when closed error = %v, want %v", err, io.ErrClosedPipe)
+	}
+}
+
+func TestRateLimit_unlimited(t *testing.T) {
+	raw := testRWTransport{Reader: strings.NewReader(strings.Repeat("x", 300)), Writer: &bytes.Buffer{}}
+	tr := NewRateLimit(raw, 0, 0)
+	if n, err := tr.Read(make([]byte, 1000)); err != nil || n != 300 {
+		t.Errorf("Read() = %d, %v, want 300, nil", n, err)
+	}
+}
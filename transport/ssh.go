@@ -0,0 +1,252 @@
+package transport
+
+import (
+	"context"
+	"io"
+	"net"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// NetconfSubsystem is the SSH subsystem of NETCONF (RFC6242).
+const NetconfSubsystem = "netconf"
+
+// HostKeyPolicy is the policy verifying SSH server host keys, such as
+// KnownHosts or FixedHostKey.
+type HostKeyPolicy = ssh.HostKeyCallback
+
+// KnownHosts returns a host key policy accepting the host keys of the
+// servers listed in the OpenSSH known_hosts files.
+func KnownHosts(files ...string) (HostKeyPolicy, error) {
+	return knownhosts.New(files...)
+}
+
+// FixedHostKey returns a host key policy accepting only the host key.
+func FixedHostKey(key ssh.PublicKey) HostKeyPolicy { return ssh.FixedHostKey(key) }
+
+// InsecureIgnoreHostKey returns a host key policy accepting any host
+// key. It is for tests and labs only, as it does not protect against
+// man-in-the-middle attacks.
+func InsecureIgnoreHostKey() HostKeyPolicy { return ssh.InsecureIgnoreHostKey() }
+
+// SSHOption is a DialSSH option.
+type SSHOption func(*sshDialer)
+
+type sshDialer struct {
+	config    ssh.ClientConfig
+	subsystem string
+	dialer    ContextDialer
+}
+
+// WithPassword is a DialSSH option authenticating with the password.
+func WithPassword(password string) SSHOption {
+	return func(d *sshDialer) { d.config.Auth = append(d.config.Auth, ssh.Password(password)) }
+}
+
+// WithPublicKeys is a DialSSH option authenticating with the private
+// keys of the signers, such as those returned by ssh.ParsePrivateKey.
+func WithPublicKeys(signers ...ssh.Signer) SSHOption {
+	return func(d *sshDialer) { d.config.Auth = append(d.config.Auth, ssh.PublicKeys(signers...)) }
+}
+
+// WithKeyboardInteractive is a DialSSH option authenticating by
+// answering the server's questions with challenge.
+func WithKeyboardInteractive(challenge ssh.KeyboardInteractiveChallenge) SSHOption {
+	return func(d *sshDialer) { d.config.Auth = append(d.config.Auth, ssh.KeyboardInteractive(challenge)) }
+}
+
+// WithDialer is a DialSSH option connecting with the dialer, such as a
+// proxy dialer or an SSHJump, rather than directly.
+func WithDialer(dialer ContextDialer) SSHOption {
+	return func(d *sshDialer) { d.dialer = dialer }
+}
+
+// WithSubsystem is a DialSSH option requesting the subsystem, rather
+// than the netconf subsystem.
+func WithSubsystem(name string) SSHOption {
+	return func(d *sshDialer) { d.subsystem = name }
+}
+
+// SSHClient is a ClientTransport over the netconf subsystem of an SSH
+// connection, framing messages with a Framer, so each Write writes one
+// message. It implements RFC6242Framer.
+type SSHClient struct {
+	*Framer
+	client  *ssh.Client
+	session *ssh.Session
+	stdin   io.WriteCloser
+	stderr  io.Reader
+	user    string
+}
+
+// DialSSH dials the SSH server at the address addr, authenticating as
+// the user with the methods given by the options, and requests the
+// netconf subsystem, verifying the server's host key with the policy.
+// The context bounds the time taken to connect.
+func DialSSH(ctx context.Context, addr, user string, hostKey HostKeyPolicy, options ...SSHOption) (*SSHClient, error) {
+	d := newSSHDialer(user, hostKey, options)
+	client, err := d.dial(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	return newSSHClient(client, user, d.subsystem)
+}
+
+func newSSHDialer(user string, hostKey HostKeyPolicy, options []SSHOption) *sshDialer {
+	d := &sshDialer{config: ssh.ClientConfig{User: user, HostKeyCallback: hostKey}, subsystem: NetconfSubsystem}
+	for _, option := range options {
+		option(d)
+	}
+	if d.dialer == nil {
+		d.dialer = &net.Dialer{}
+	}
+	return d
+}
+
+// dial returns an SSH connection to the server at the address addr.
+func (d *sshDialer) dial(ctx context.Context, addr string) (*ssh.Client, error) {
+	conn, err := d.dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, &d.config)
+	if err != nil {
+		_ = conn.Close()
+		return nil, errors.Wrapf(err, "ssh connection to %s", addr)
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+// SSHJump is a ContextDialer connecting through an SSH jump host, or
+// bastion, with TCP forwarding. Jump hosts are chained by dialing one
+// with WithDialer and another SSHJump.
+type SSHJump struct {
+	client *ssh.Client
+}
+
+// DialJumpHost connects to the SSH jump host at the address addr as
+// DialSSH does, returning a dialer of connections through it.
+func DialJumpHost(ctx context.Context, addr, user string, hostKey HostKeyPolicy, options ...SSHOption) (*SSHJump, error) {
+	client, err := newSSHDialer(user, hostKey, options).dial(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	return &SSHJump{client: client}, nil
+}
+
+// DialContext connects to the address on the network through the jump
+// host, which must be a TCP network.
+func (j *SSHJump) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		conn, err := j.client.Dial(network, addr)
+		done <- result{conn, err}
+	}()
+	select {
+	case r := <-done:
+		return r.conn, errors.Wrapf(r.err, "dial %s via jump host %s", addr, j.client.RemoteAddr())
+	case <-ctx.Done():
+		go func() {
+			if r := <-done; r.conn != nil {
+				_ = r.conn.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+// Close closes the connection to the jump host, and those made through
+// it.
+func (j *SSHJump) Close() error { return j.client.Close() }
+
+// newSSHClient returns a transport over the subsystem of a new session
+// of the client, closing the client if it cannot be made.
+func newSSHClient(client *ssh.Client, user, subsystem string) (*SSHClient, error) {
+	t, err := func() (*SSHClient, error) {
+		s, err := client.NewSession()
+		if err != nil {
+			return nil, errors.Wrap(err, "ssh session")
+		}
+		t := &SSHClient{client: client, session: s, user: user}
+		if t.stdin, err = s.StdinPipe(); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		stdout, err := s.StdoutPipe()
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if t.stderr, err = s.StderrPipe(); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if err := s.RequestSubsystem(subsystem); err != nil {
+			return nil, errors.Wrapf(err, "ssh subsystem %q", subsystem)
+		}
+		t.Framer = NewFramer(struct {
+			io.Reader
+			io.Writer
+		}{stdout, t.stdin})
+		return t, nil
+	}()
+	if err != nil {
+		_ = client.Close()
+		return nil, err
+	}
+	return t, nil
+}
+
+// CloseWrite closes the server's standard input.
+func (t *SSHClient) CloseWrite() error { return t.stdin.Close() }
+
+// Close closes the session and SSH connection.
+func (t *SSHClient) Close() error {
+	_ = t.session.Close()
+	return t.client.Close()
+}
+
+// Error returns a reader of the server's standard error.
+func (t *SSHClient) Error() io.ReadWriter {
+	return struct {
+		io.Reader
+		io.Writer
+	}{t.stderr, errorWriter{}}
+}
+
+// Username returns the username the client authenticated as.
+func (t *SSHClient) Username() string { return t.user }
+
+// Kind returns "ssh".
+func (t *SSHClient) Kind() string { return "ssh" }
+
+// LocalAddr returns the local address of the SSH connection.
+func (t *SSHClient) LocalAddr() net.Addr { return t.client.LocalAddr() }
+
+// RemoteAddr returns the address of the SSH server.
+func (t *SSHClient) RemoteAddr() net.Addr { return t.client.RemoteAddr() }
+
+// errorWriter fails writes to a client's error channel, which can only
+// be read.
+type errorWriter struct{}
+
+func (errorWriter) Write([]byte) (int, error) {
+	return 0, errors.New("client error channel cannot be written")
+}
+
+var (
+	_ ContextDialer          = &SSHJump{}
+	_ ClientTransport        = &SSHClient{}
+	_ RFC6242Framer          = &SSHClient{}
+	_ ClientUsernameProvider = &SSHClient{}
+	_ Kinder                 = &SSHClient{}
+	_ Addresser              = &SSHClient{}
+)
@@ -0,0 +1,212 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+)
+
+func testSigner(t *testing.T) ssh.Signer {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+// testSSHServer runs an SSH server accepting the password "secret",
+// the public key user, or the keyboard-interactive answer "yes" for
+// user alice, whose netconf subsystem echoes its input, writing
+// "ready" to standard error. It returns the server's address and host
+// key.
+func testSSHServer(t *testing.T, user ssh.PublicKey) (string, ssh.PublicKey) {
+	t.Helper()
+	hostKey := testSigner(t)
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if c.User() == "alice" && string(password) == "secret" {
+				return nil, nil
+			}
+			return nil, errors.New("denied")
+		},
+		PublicKeyCallback: func(c ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if c.User() == "alice" && user != nil && bytes.Equal(key.Marshal(), user.Marshal()) {
+				return nil, nil
+			}
+			return nil, errors.New("denied")
+		},
+		KeyboardInteractiveCallback: func(c ssh.ConnMetadata, challenge ssh.KeyboardInteractiveChallenge) (*ssh.Permissions, error) {
+			answers, err := challenge("", "", []string{"Continue? "}, []bool{true})
+			if err != nil {
+				return nil, err
+			}
+			if c.User() == "alice" && len(answers) == 1 && answers[0] == "yes" {
+				return nil, nil
+			}
+			return nil, errors.New("denied")
+		},
+	}
+	config.AddHostKey(hostKey)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go testSSHServe(conn, config)
+		}
+	}()
+	return l.Addr().String(), hostKey.PublicKey()
+}
+
+func testSSHServe(conn net.Conn, config *ssh.ServerConfig) {
+	sc, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		_ = conn.Close()
+		return
+	}
+	defer sc.Close()
+	go ssh.DiscardRequests(reqs)
+	for nc := range chans {
+		if nc.ChannelType() == "direct-tcpip" {
+			go testSSHForward(nc)
+			continue
+		}
+		ch, reqs, err := nc.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer ch.Close()
+			for req := range reqs {
+				if req.Type != "subsystem" || len(req.Payload) < 4 || string(req.Payload[4:4+binary.BigEndian.Uint32(req.Payload)]) != NetconfSubsystem {
+					_ = req.Reply(false, nil)
+					continue
+				}
+				_ = req.Reply(true, nil)
+				_, _ = ch.Stderr().Write([]byte("ready"))
+				_, _ = io.Copy(ch, ch)
+				_ = ch.CloseWrite()
+				return
+			}
+		}()
+	}
+}
+
+// testSSHForward forwards the direct-tcpip channel nc.
+func testSSHForward(nc ssh.NewChannel) {
+	var target struct {
+		Host       string
+		Port       uint32
+		OriginHost string
+		OriginPort uint32
+	}
+	if err := ssh.Unmarshal(nc.ExtraData(), &target); err != nil {
+		_ = nc.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	conn, err := net.Dial("tcp", net.JoinHostPort(target.Host, strconv.Itoa(int(target.Port))))
+	if err != nil {
+		_ = nc.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	ch, reqs, err := nc.Accept()
+	if err != nil {
+		_ = conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	testSplice(ch, conn)
+}
+
+// testSplice copies data between a and b until either ends.
+func testSplice(a, b io.ReadWriteCloser) {
+	done := make(chan struct{}, 2)
+	go func() { _, _ = io.Copy(a, b); done <- struct{}{} }()
+	go func() { _, _ = io.Copy(b, a); done <- struct{}{} }()
+	<-done
+	_ = a.Close()
+	_ = b.Close()
+}
+
+func TestDialSSH(t *testing.T) {
+	userKey := testSigner(t)
+	addr, hostKey := testSSHServer(t, userKey.PublicKey())
+	for _, tt := range []struct {
+		name    string
+		hostKey HostKeyPolicy
+		options []SSHOption
+		wantErr bool
+	}{
+		{name: "password", hostKey: FixedHostKey(hostKey), options: []SSHOption{WithPassword("secret")}},
+		{name: "public key", hostKey: FixedHostKey(hostKey), options: []SSHOption{WithPublicKeys(userKey)}},
+		{name: "keyboard-interactive", hostKey: FixedHostKey(hostKey), options: []SSHOption{
+			WithKeyboardInteractive(func(_, _ string, _ []string, _ []bool) ([]string, error) {
+				return []string{"yes"}, nil
+			}),
+		}},
+		{name: "fallback", hostKey: InsecureIgnoreHostKey(), options: []SSHOption{WithPublicKeys(testSigner(t)), WithPassword("secret")}},
+		{name: "wrong password", hostKey: FixedHostKey(hostKey), options: []SSHOption{WithPassword("guess")}, wantErr: true},
+		{name: "wrong host key", hostKey: FixedHostKey(userKey.PublicKey()), options: []SSHOption{WithPassword("secret")}, wantErr: true},
+		{name: "unknown subsystem", hostKey: FixedHostKey(hostKey), options: []SSHOption{WithPassword("secret"), WithSubsystem("shell")}, wantErr: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			c, err := DialSSH(ctx, addr, "alice", tt.hostKey, tt.options...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DialSSH() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			defer c.Close()
+			if c.Username() != "alice" || c.Kind() != "ssh" || c.RemoteAddr().String() != addr {
+				t.Errorf("Username(), Kind(), RemoteAddr() = %q, %q, %v", c.Username(), c.Kind(), c.RemoteAddr())
+			}
+			b := make([]byte, 64)
+			if n, err := io.ReadFull(c.Error(), b[:5]); err != nil || string(b[:n]) != "ready" {
+				t.Errorf("error channel read %q, %v, want %q", b[:n], err, "ready")
+			}
+
+			// messages are framed, the server echoing them
+			if _, err := c.Write([]byte("<hello/>")); err != nil {
+				t.Fatal(err)
+			}
+			if n, err := c.Read(b); err != nil || string(b[:n]) != "<hello/>" {
+				t.Errorf("Read() = %q, %v, want %q, nil", b[:n], err, "<hello/>")
+			}
+			_ = c.EnableChunkedFraming()
+			if _, err := c.Write([]byte("<rpc/>")); err != nil {
+				t.Fatal(err)
+			}
+			if err := c.CloseWrite(); err != nil {
+				t.Fatal(err)
+			}
+			if b, err := ioutil.ReadAll(c); err != nil || string(b) != "<rpc/>" {
+				t.Errorf("ReadAll() = %q, %v, want %q, nil", b, err, "<rpc/>")
+			}
+		})
+	}
+}
@@ -0,0 +1,324 @@
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andaru/opr8/log"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+)
+
+// ErrAuthRateLimited is returned to SSH clients authenticating after
+// too many failed attempts, as set by an AuthRateLimit.
+var ErrAuthRateLimited = errors.New("too many failed authentication attempts")
+
+// AuthorizedKeys is the interface to providers of the public keys
+// users are authorized to authenticate with.
+type AuthorizedKeys interface {
+	// AuthorizedKeys returns the public keys of the user.
+	AuthorizedKeys(user string) ([]ssh.PublicKey, error)
+}
+
+// AuthorizedKeysFunc is a function implementing AuthorizedKeys.
+type AuthorizedKeysFunc func(user string) ([]ssh.PublicKey, error)
+
+// AuthorizedKeys returns f(user).
+func (f AuthorizedKeysFunc) AuthorizedKeys(user string) ([]ssh.PublicKey, error) { return f(user) }
+
+// AuthorizedKeysFile returns a provider of the keys in the OpenSSH
+// authorized_keys file at the path, in which "%u" is replaced by the
+// username, e.g., "/home/%u/.ssh/authorized_keys". Users whose file
+// does not exist have no keys.
+func AuthorizedKeysFile(path string) AuthorizedKeys {
+	return AuthorizedKeysFunc(func(user string) ([]ssh.PublicKey, error) {
+		if strings.ContainsAny(user, "/\x00") || user == "." || user == ".." {
+			return nil, errors.Errorf("bad username %q", user)
+		}
+		b, err := ioutil.ReadFile(strings.Replace(path, "%u", user, -1))
+		if os.IsNotExist(err) {
+			return nil, nil
+		} else if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		var keys []ssh.PublicKey
+		for s := bufio.NewScanner(bytes.NewReader(b)); s.Scan(); {
+			line := bytes.TrimSpace(s.Bytes())
+			if len(line) == 0 || line[0] == '#' {
+				continue
+			}
+			key, _, _, _, err := ssh.ParseAuthorizedKey(line)
+			if err != nil {
+				return nil, errors.Wrapf(err, "%s", path)
+			}
+			keys = append(keys, key)
+		}
+		return keys, nil
+	})
+}
+
+// AuthRateLimit limits the failed attempts to authenticate with a
+// method, counted for each username and client address. Its zero value
+// sets no limit.
+type AuthRateLimit struct {
+	// Attempts is the number of failed attempts allowed in the
+	// period, after which attempts are refused without being checked.
+	Attempts int
+	// Period is the time failed attempts are counted for.
+	Period time.Duration
+}
+
+// SSHServerConfig is the configuration of an SSHServer.
+type SSHServerConfig struct {
+	// HostKeys are the server's host keys.
+	HostKeys []ssh.Signer
+	// AuthorizedKeys, if not nil, authenticates users with the
+	// public keys it provides.
+	AuthorizedKeys AuthorizedKeys
+	// Password, if not nil, authenticates users by password,
+	// returning an error if it is not theirs.
+	Password func(conn ssh.ConnMetadata, password string) error
+	// Banner, if not empty, is sent to clients before authentication.
+	Banner string
+	// Ciphers, KeyExchanges and MACs, if not empty, restrict the
+	// algorithms used to those listed, in order of preference, as
+	// ssh.Config does.
+	Ciphers, KeyExchanges, MACs []string
+	// PasswordRateLimit and PublicKeyRateLimit limit the failed
+	// attempts to authenticate by password and public key.
+	PasswordRateLimit, PublicKeyRateLimit AuthRateLimit
+	// HandshakeTimeout, if not zero, limits the time for a client to
+	// authenticate and request the netconf subsystem.
+	HandshakeTimeout time.Duration
+	// Logger, if not nil, logs the connections not accepted, at
+	// log.LevelInfo, and the channels and requests refused, at
+	// log.LevelDebug.
+	Logger log.Logger
+}
+
+// SSHServer accepts NETCONF over SSH (RFC6242) server transports on
+// network connections.
+type SSHServer struct {
+	config  ssh.ServerConfig
+	timeout time.Duration
+	logger  log.Logger
+}
+
+// NewSSHServer returns an SSH server with the configuration. At least
+// one host key and authentication method is required.
+func NewSSHServer(c SSHServerConfig) (*SSHServer, error) {
+	if len(c.HostKeys) == 0 {
+		return nil, errors.New("ssh server has no host keys")
+	}
+	if c.AuthorizedKeys == nil && c.Password == nil {
+		return nil, errors.New("ssh server has no authentication methods")
+	}
+	s := &SSHServer{timeout: c.HandshakeTimeout, logger: log.OrNop(c.Logger)}
+	s.config.Ciphers, s.config.KeyExchanges, s.config.MACs = c.Ciphers, c.KeyExchanges, c.MACs
+	for _, key := range c.HostKeys {
+		s.config.AddHostKey(key)
+	}
+	if c.Banner != "" {
+		banner := c.Banner
+		s.config.BannerCallback = func(ssh.ConnMetadata) string { return banner }
+	}
+	if c.Password != nil {
+		limit := newAuthLimiter(c.PasswordRateLimit)
+		s.config.PasswordCallback = func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			return nil, limit.check(conn, func() error { return c.Password(conn, string(password)) })
+		}
+	}
+	if c.AuthorizedKeys != nil {
+		limit := newAuthLimiter(c.PublicKeyRateLimit)
+		s.config.PublicKeyCallback = func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			return nil, limit.check(conn, func() error {
+				keys, err := c.AuthorizedKeys.AuthorizedKeys(conn.User())
+				if err != nil {
+					return err
+				}
+				for _, k := range keys {
+					if bytes.Equal(k.Marshal(), key.Marshal()) {
+						return nil
+					}
+				}
+				return errors.Errorf("public key not authorized for %q", conn.User())
+			})
+		}
+	}
+	return s, nil
+}
+
+// Accept performs the SSH handshake on the connection, authenticating
+// the client, and waits for it to request the netconf subsystem,
+// returning a transport over the subsystem's channel. Clients may open
+// one session on each connection.
+func (s *SSHServer) Accept(conn net.Conn) (*SSHServerTransport, error) {
+	if s.timeout > 0 {
+		_ = conn.SetDeadline(time.Now().Add(s.timeout))
+	}
+	sc, chans, reqs, err := ssh.NewServerConn(conn, &s.config)
+	if err != nil {
+		_ = conn.Close()
+		return nil, errors.Wrap(err, "ssh handshake")
+	}
+	go ssh.DiscardRequests(reqs)
+	t, err := s.subsystem(sc, chans)
+	if err != nil {
+		_ = sc.Close()
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Time{})
+	// refuse further channels
+	go func() {
+		for nc := range chans {
+			_ = nc.Reject(ssh.Prohibited, "one session per connection")
+		}
+	}()
+	return t, nil
+}
+
+// Transport returns the transport accepted on the connection, or nil
+// if none is, for use as the factory passed to session.Serve.
+func (s *SSHServer) Transport(conn net.Conn) ServerTransport {
+	t, err := s.Accept(conn)
+	if err != nil {
+		log.Info(s.logger, "ssh connection not accepted", "remote", conn.RemoteAddr(), "error", err)
+		return nil
+	}
+	return t
+}
+
+// subsystem waits for a session channel requesting the netconf
+// subsystem.
+func (s *SSHServer) subsystem(sc *ssh.ServerConn, chans <-chan ssh.NewChannel) (*SSHServerTransport, error) {
+	for nc := range chans {
+		if nc.ChannelType() != "session" {
+			log.Debug(s.logger, "ssh channel refused", "user", sc.User(), "type", nc.ChannelType())
+			_ = nc.Reject(ssh.UnknownChannelType, "only session channels are supported")
+			continue
+		}
+		ch, reqs, err := nc.Accept()
+		if err != nil {
+			return nil, errors.Wrap(err, "ssh session")
+		}
+		for req := range reqs {
+			var subsystem struct{ Name string }
+			if req.Type != "subsystem" || ssh.Unmarshal(req.Payload, &subsystem) != nil || subsystem.Name != NetconfSubsystem {
+				// refuse shells, commands, other subsystems and
+				// terminals, but accept environment variables
+				if req.Type != "env" {
+					log.Debug(s.logger, "ssh request refused", "user", sc.User(), "type", req.Type)
+				}
+				_ = req.Reply(req.Type == "env", nil)
+				continue
+			}
+			_ = req.Reply(true, nil)
+			go ssh.DiscardRequests(reqs)
+			return &SSHServerTransport{Framer: NewFramer(ch), conn: sc, ch: ch}, nil
+		}
+		_ = ch.Close()
+	}
+	return nil, errors.New("ssh connection closed without requesting the netconf subsystem")
+}
+
+// SSHServerTransport is a ServerTransport over the netconf subsystem
+// of an SSH connection, framing messages with a Framer. It implements
+// RFC6242Framer.
+type SSHServerTransport struct {
+	*Framer
+	conn *ssh.ServerConn
+	ch   ssh.Channel
+}
+
+// CloseWrite closes the client's standard input.
+func (t *SSHServerTransport) CloseWrite() error { return t.ch.CloseWrite() }
+
+// Close closes the channel and SSH connection.
+func (t *SSHServerTransport) Close() error {
+	_ = t.ch.Close()
+	return t.conn.Close()
+}
+
+// Error returns a writer of the client's standard error.
+func (t *SSHServerTransport) Error() io.ReadWriter { return t.ch.Stderr() }
+
+// Username returns the username the client authenticated as.
+func (t *SSHServerTransport) Username() string { return t.conn.User() }
+
+// Kind returns "ssh".
+func (t *SSHServerTransport) Kind() string { return "ssh" }
+
+// LocalAddr returns the local address of the SSH connection.
+func (t *SSHServerTransport) LocalAddr() net.Addr { return t.conn.LocalAddr() }
+
+// RemoteAddr returns the address of the SSH client.
+func (t *SSHServerTransport) RemoteAddr() net.Addr { return t.conn.RemoteAddr() }
+
+// authLimiter enforces an AuthRateLimit.
+type authLimiter struct {
+	limit AuthRateLimit
+
+	mu       sync.Mutex
+	failures map[string][]time.Time
+}
+
+func newAuthLimiter(limit AuthRateLimit) *authLimiter {
+	return &authLimiter{limit: limit, failures: map[string][]time.Time{}}
+}
+
+// check returns the result of the authentication attempt auth by the
+// client, or ErrAuthRateLimited without attempting it if the client
+// has failed too often.
+func (l *authLimiter) check(conn ssh.ConnMetadata, auth func() error) error {
+	if l.limit.Attempts <= 0 {
+		return auth()
+	}
+	host := conn.RemoteAddr().String()
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	key := conn.User() + "\x00" + host
+	now := time.Now()
+
+	l.mu.Lock()
+	recent := l.failures[key][:0]
+	for _, t := range l.failures[key] {
+		if now.Sub(t) < l.limit.Period {
+			recent = append(recent, t)
+		}
+	}
+	if len(recent) > 0 {
+		l.failures[key] = recent
+	} else {
+		delete(l.failures, key)
+	}
+	limited := len(recent) >= l.limit.Attempts
+	l.mu.Unlock()
+	if limited {
+		return ErrAuthRateLimited
+	}
+
+	err := auth()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err != nil {
+		l.failures[key] = append(l.failures[key], now)
+	} else {
+		delete(l.failures, key)
+	}
+	return err
+}
+
+var (
+	_ ServerTransport = &SSHServerTransport{}
+	_ RFC6242Framer   = &SSHServerTransport{}
+	_ Kinder          = &SSHServerTransport{}
+	_ Addresser       = &SSHServerTransport{}
+)
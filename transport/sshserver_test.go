@@ -0,0 +1,189 @@
+package transport
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+)
+
+// testSSHServerListen serves the SSH server on a local port, sending
+// the transports accepted on ts.
+func testSSHServerListen(t *testing.T, s *SSHServer) (string, <-chan *SSHServerTransport) {
+	t.Helper()
+	ts := make(chan *SSHServerTransport, 8)
+	addr := testListen(t, func(conn net.Conn) {
+		if tr, err := s.Accept(conn); err == nil {
+			ts <- tr
+		}
+	})
+	return addr, ts
+}
+
+func TestSSHServer(t *testing.T) {
+	hostKey, userKey := testSigner(t), testSigner(t)
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "alice"), append([]byte("# alice's keys\n\n"), ssh.MarshalAuthorizedKey(userKey.PublicKey())...), 0600); err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewSSHServer(SSHServerConfig{
+		HostKeys:       []ssh.Signer{hostKey},
+		AuthorizedKeys: AuthorizedKeysFile(filepath.Join(dir, "%u")),
+		Password: func(conn ssh.ConnMetadata, password string) error {
+			if conn.User() == "bob" && password == "secret" {
+				return nil
+			}
+			return errors.New("denied")
+		},
+		Banner:           "authorized use only\n",
+		HandshakeTimeout: 5 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr, ts := testSSHServerListen(t, s)
+
+	for _, tt := range []struct {
+		name    string
+		user    string
+		options []SSHOption
+		wantErr bool
+	}{
+		{name: "public key", user: "alice", options: []SSHOption{WithPublicKeys(userKey)}},
+		{name: "password", user: "bob", options: []SSHOption{WithPassword("secret")}},
+		{name: "unauthorized key", user: "bob", options: []SSHOption{WithPublicKeys(userKey)}, wantErr: true},
+		{name: "wrong password", user: "alice", options: []SSHOption{WithPassword("secret")}, wantErr: true},
+		{name: "other subsystem", user: "bob", options: []SSHOption{WithPassword("secret"), WithSubsystem("sftp")}, wantErr: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			c, err := DialSSH(ctx, addr, tt.user, FixedHostKey(hostKey.PublicKey()), tt.options...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DialSSH() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			defer c.Close()
+			var tr *SSHServerTransport
+			select {
+			case tr = <-ts:
+			case <-ctx.Done():
+				t.Fatal("no transport accepted")
+			}
+			defer tr.Close()
+			if tr.Username() != tt.user || tr.Kind() != "ssh" {
+				t.Errorf("Username(), Kind() = %q, %q, want %q, %q", tr.Username(), tr.Kind(), tt.user, "ssh")
+			}
+
+			if _, err := c.Write([]byte("<hello/>")); err != nil {
+				t.Fatal(err)
+			}
+			b := make([]byte, 64)
+			if n, err := tr.Read(b); err != nil || string(b[:n]) != "<hello/>" {
+				t.Errorf("server Read() = %q, %v, want %q, nil", b[:n], err, "<hello/>")
+			}
+			if _, err := tr.Error().Write([]byte("warning")); err != nil {
+				t.Fatal(err)
+			}
+			if n, err := c.Error().Read(b); err != nil || string(b[:n]) != "warning" {
+				t.Errorf("client error channel Read() = %q, %v, want %q, nil", b[:n], err, "warning")
+			}
+		})
+	}
+
+	// the banner is sent before authentication
+	var banner string
+	config := &ssh.ClientConfig{
+		User:            "bob",
+		Auth:            []ssh.AuthMethod{ssh.Password("secret")},
+		HostKeyCallback: FixedHostKey(hostKey.PublicKey()),
+		BannerCallback:  func(msg string) error { banner = msg; return nil },
+	}
+	client, err := ssh.Dial("tcp", addr, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = client.Close()
+	if banner != "authorized use only\n" {
+		t.Errorf("banner = %q, want %q", banner, "authorized use only\n")
+	}
+}
+
+func TestSSHServer_restrictions(t *testing.T) {
+	hostKey := testSigner(t)
+	var attempts int32
+	s, err := NewSSHServer(SSHServerConfig{
+		HostKeys: []ssh.Signer{hostKey},
+		Password: func(_ ssh.ConnMetadata, password string) error {
+			atomic.AddInt32(&attempts, 1)
+			if password == "secret" {
+				return nil
+			}
+			return errors.New("denied")
+		},
+		Ciphers:           []string{"aes128-ctr"},
+		PasswordRateLimit: AuthRateLimit{Attempts: 2, Period: time.Minute},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr, _ := testSSHServerListen(t, s)
+	dial := func(password string, ciphers ...string) error {
+		config := &ssh.ClientConfig{
+			User:            "alice",
+			Auth:            []ssh.AuthMethod{ssh.Password(password)},
+			HostKeyCallback: FixedHostKey(hostKey.PublicKey()),
+		}
+		config.Ciphers = ciphers
+		client, err := ssh.Dial("tcp", addr, config)
+		if err == nil {
+			_ = client.Close()
+		}
+		return err
+	}
+
+	if err := dial("secret", "aes256-ctr"); err == nil {
+		t.Error("dial with a cipher not allowed error = nil, want an error")
+	}
+	if err := dial("secret", "aes128-ctr"); err != nil {
+		t.Errorf("dial with an allowed cipher error = %v", err)
+	}
+	// the correct password is refused after two failed attempts,
+	// which are not checked
+	for i, password := range []string{"guess", "guess", "secret"} {
+		if err := dial(password); err == nil {
+			t.Errorf("dial %d error = nil, want an error", i)
+		}
+	}
+	if got := atomic.LoadInt32(&attempts); got != 3 {
+		t.Errorf("passwords checked %d times, want 3", got)
+	}
+}
+
+func TestNewSSHServer_errors(t *testing.T) {
+	if _, err := NewSSHServer(SSHServerConfig{Password: func(ssh.ConnMetadata, string) error { return nil }}); err == nil {
+		t.Error("NewSSHServer() without host keys error = nil, want an error")
+	}
+	if _, err := NewSSHServer(SSHServerConfig{HostKeys: []ssh.Signer{testSigner(t)}}); err == nil {
+		t.Error("NewSSHServer() without authentication methods error = nil, want an error")
+	}
+}
+
+func TestAuthorizedKeysFile(t *testing.T) {
+	keys, err := AuthorizedKeysFile(filepath.Join(t.TempDir(), "%u")).AuthorizedKeys("nobody")
+	if err != nil || len(keys) != 0 {
+		t.Errorf("AuthorizedKeys() of a user without a file = %v, %v, want none", keys, err)
+	}
+	if _, err := AuthorizedKeysFile(filepath.Join(os.TempDir(), "%u")).AuthorizedKeys("../etc"); err == nil {
+		t.Error("AuthorizedKeys() of a bad username error = nil, want an error")
+	}
+}
@@ -0,0 +1,253 @@
+/*
+Package transporttest has in-memory transports for testing sessions
+and the layers above them without network connections.
+
+Pipe returns a connected pair of transports, one for the client and
+one for the server. Data written to one is read from the other, after
+an optional latency, and reads can be limited to a few bytes at a time
+to exercise code reading messages split across reads. Errors can be
+injected into either transport's reads and writes.
+
+A read returns the data of no more than one write, so writing each
+message with a single Write frames messages as session transports
+do.
+*/
+package transporttest
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/andaru/opr8/transport"
+)
+
+// Option is a constructor option for Pipe.
+type Option func(*config)
+
+type config struct {
+	username, kind string
+	latency        time.Duration
+	maxRead        int
+}
+
+// WithUsername is a Pipe option setting the username reported by the
+// transports.
+func WithUsername(username string) Option {
+	return func(c *config) { c.username = username }
+}
+
+// WithKind is a Pipe option setting the kind reported by the
+// transports, "pipe" by default.
+func WithKind(kind string) Option {
+	return func(c *config) { c.kind = kind }
+}
+
+// WithLatency is a Pipe option delaying the data written to either
+// transport by the duration d before it can be read from the other.
+func WithLatency(d time.Duration) Option {
+	return func(c *config) { c.latency = d }
+}
+
+// WithMaxRead is a Pipe option limiting each read from the transports
+// to n bytes, so data is read in pieces.
+func WithMaxRead(n int) Option {
+	return func(c *config) { c.maxRead = n }
+}
+
+// Pipe returns a connected pair of in-memory transports, for the
+// client and server. Writes do not block, buffering the data written
+// until it is read.
+func Pipe(options ...Option) (client, server *Transport) {
+	c := config{kind: "pipe"}
+	for _, option := range options {
+		option(&c)
+	}
+	toServer, toClient := newPipe(c.latency), newPipe(c.latency)
+	client = &Transport{config: c, r: toClient, w: toServer}
+	server = &Transport{config: c, r: toServer, w: toClient}
+	return client, server
+}
+
+// Transport is an in-memory transport, one of a pair returned by
+// Pipe. It implements transport.ServerTransport and
+// transport.ClientTransport.
+type Transport struct {
+	config
+	r, w *pipe
+
+	mu                    sync.Mutex
+	readErr, writeErr     error
+	readBytes, wroteBytes int
+}
+
+// Read reads data written to the other transport.
+func (t *Transport) Read(b []byte) (int, error) {
+	t.mu.Lock()
+	err := t.readErr
+	t.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+	if t.maxRead > 0 && len(b) > t.maxRead {
+		b = b[:t.maxRead]
+	}
+	n, err := t.r.read(b)
+	t.mu.Lock()
+	t.readBytes += n
+	t.mu.Unlock()
+	return n, err
+}
+
+// Write writes data to be read from the other transport.
+func (t *Transport) Write(b []byte) (int, error) {
+	t.mu.Lock()
+	err := t.writeErr
+	t.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+	if err := t.w.write(b); err != nil {
+		return 0, err
+	}
+	t.mu.Lock()
+	t.wroteBytes += len(b)
+	t.mu.Unlock()
+	return len(b), nil
+}
+
+// FailReads makes reads fail with err, or succeed again if nil.
+func (t *Transport) FailReads(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.readErr = err
+}
+
+// FailWrites makes writes fail with err, or succeed again if nil.
+func (t *Transport) FailWrites(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.writeErr = err
+}
+
+// Counts returns the number of bytes read from and written to the
+// transport.
+func (t *Transport) Counts() (read, written int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.readBytes, t.wroteBytes
+}
+
+// CloseWrite closes the writing side of the transport, so reads from
+// the other transport return io.EOF once the data written is read.
+func (t *Transport) CloseWrite() error {
+	t.w.closeWrite()
+	return nil
+}
+
+// Close closes the transport. Reads from and writes to it fail with
+// io.ErrClosedPipe, while the other transport reads io.EOF once the
+// data written is read, and its writes fail with io.ErrClosedPipe.
+func (t *Transport) Close() error {
+	t.w.closeWrite()
+	t.r.closeRead()
+	return nil
+}
+
+// Error returns nil; pipe transports have no error channel.
+func (t *Transport) Error() io.ReadWriter { return nil }
+
+// Username returns the username set by WithUsername.
+func (t *Transport) Username() string { return t.username }
+
+// Kind returns the kind set by WithKind, "pipe" by default.
+func (t *Transport) Kind() string { return t.kind }
+
+// pipe is a unidirectional in-memory pipe, buffering data written
+// until read.
+type pipe struct {
+	latency time.Duration
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	chunks []chunk
+	// wclosed is true once the writer closes, and rclosed once the
+	// reader closes
+	wclosed, rclosed bool
+}
+
+// chunk is data written to a pipe, readable from the time ready.
+type chunk struct {
+	data  []byte
+	ready time.Time
+}
+
+func newPipe(latency time.Duration) *pipe {
+	p := &pipe{latency: latency}
+	p.cond = sync.NewCond(&p.mu)
+	return p
+}
+
+func (p *pipe) write(b []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.wclosed || p.rclosed {
+		return io.ErrClosedPipe
+	}
+	if len(b) > 0 {
+		p.chunks = append(p.chunks, chunk{data: append([]byte(nil), b...), ready: time.Now().Add(p.latency)})
+		p.cond.Broadcast()
+	}
+	return nil
+}
+
+func (p *pipe) read(b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for {
+		switch {
+		case p.rclosed:
+			return 0, io.ErrClosedPipe
+		case len(p.chunks) > 0:
+			c := &p.chunks[0]
+			if wait := time.Until(c.ready); wait > 0 {
+				p.mu.Unlock()
+				time.Sleep(wait)
+				p.mu.Lock()
+				continue
+			}
+			n := copy(b, c.data)
+			if c.data = c.data[n:]; len(c.data) == 0 {
+				p.chunks = p.chunks[1:]
+			}
+			return n, nil
+		case p.wclosed:
+			return 0, io.EOF
+		}
+		p.cond.Wait()
+	}
+}
+
+func (p *pipe) closeWrite() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.wclosed = true
+	p.cond.Broadcast()
+}
+
+func (p *pipe) closeRead() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.rclosed = true
+	p.chunks = nil
+	p.cond.Broadcast()
+}
+
+var (
+	_ transport.ServerTransport = &Transport{}
+	_ transport.ClientTransport = &Transport{}
+	_ transport.Kinder          = &Transport{}
+)
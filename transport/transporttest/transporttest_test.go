@@ -0,0 +1,110 @@
+package transporttest
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestPipe(t *testing.T) {
+	client, server := Pipe(WithUsername("admin"), WithMaxRead(3))
+	if server.Username() != "admin" || server.Kind() != "pipe" {
+		t.Errorf("Username(), Kind() = %q, %q, want %q, %q", server.Username(), server.Kind(), "admin", "pipe")
+	}
+	for _, msg := range []string{"<hello/>", "<rpc/>"} {
+		if _, err := client.Write([]byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_ = client.CloseWrite()
+
+	var reads []string
+	b := make([]byte, 16)
+	for {
+		n, err := server.Read(b)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		reads = append(reads, string(b[:n]))
+	}
+	want := []string{"<he", "llo", "/>", "<rp", "c/>"}
+	if len(reads) != len(want) {
+		t.Fatalf("reads = %q, want %q", reads, want)
+	}
+	for i := range want {
+		if reads[i] != want[i] {
+			t.Errorf("reads = %q, want %q", reads, want)
+			break
+		}
+	}
+	if read, written := server.Counts(); read != 14 || written != 0 {
+		t.Errorf("Counts() = %d, %d, want 14, 0", read, written)
+	}
+}
+
+func TestPipe_latency(t *testing.T) {
+	client, server := Pipe(WithLatency(30 * time.Millisecond))
+	start := time.Now()
+	if _, err := server.Write([]byte("<hello/>")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Read(make([]byte, 16)); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < 30*time.Millisecond {
+		t.Errorf("read after %v, want at least the latency", d)
+	}
+}
+
+func TestPipe_errors(t *testing.T) {
+	client, server := Pipe()
+	failed := errors.New("failed")
+	server.FailReads(failed)
+	server.FailWrites(failed)
+	if _, err := server.Read(make([]byte, 1)); err != failed {
+		t.Errorf("Read() error = %v, want %v", err, failed)
+	}
+	if _, err := server.Write([]byte("x")); err != failed {
+		t.Errorf("Write() error = %v, want %v", err, failed)
+	}
+	server.FailWrites(nil)
+	if _, err := server.Write([]byte("x")); err != nil {
+		t.Errorf("Write() after FailWrites(nil) error = %v", err)
+	}
+
+	// closing one transport ends the other's reads once drained, and
+	// fails writes to it
+	_ = server.Close()
+	if b, err := ioutil.ReadAll(client); err != nil || string(b) != "x" {
+		t.Errorf("ReadAll() of closed peer = %q, %v, want %q, nil", b, err, "x")
+	}
+	if _, err := client.Write([]byte("x")); err != io.ErrClosedPipe {
+		t.Errorf("Write() to closed peer error = %v, want %v", err, io.ErrClosedPipe)
+	}
+	if _, err := server.Write([]byte("x")); err != io.ErrClosedPipe {
+		t.Errorf("Write() after Close error = %v, want %v", err, io.ErrClosedPipe)
+	}
+}
+
+func TestPipe_closeUnblocksRead(t *testing.T) {
+	_, server := Pipe()
+	errc := make(chan error)
+	go func() {
+		_, err := server.Read(make([]byte, 1))
+		errc <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	_ = server.Close()
+	select {
+	case err := <-errc:
+		if err != io.ErrClosedPipe {
+			t.Errorf("Read() error = %v, want %v", err, io.ErrClosedPipe)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Read() not unblocked by Close")
+	}
+}
@@ -1,6 +1,11 @@
 package transport
 
-import "io"
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"time"
+)
 
 // Transport is the low-level NETCONF transport interface.
 type Transport interface {
@@ -71,3 +76,39 @@ type ClientUsernameProvider interface {
 	// Username returns the client username on this network transport.
 	Username() string
 }
+
+// Kinder is the optional interface to transports reporting their
+// kind, used to describe sessions, e.g., "ssh" or "tls".
+type Kinder interface {
+	// Kind returns the transport kind.
+	Kind() string
+}
+
+// Addresser is the optional interface to transports reporting the
+// network addresses of their connection, as net.Conn does.
+type Addresser interface {
+	// LocalAddr returns the local network address, or nil if unknown.
+	LocalAddr() net.Addr
+	// RemoteAddr returns the remote network address, or nil if
+	// unknown.
+	RemoteAddr() net.Addr
+}
+
+// ConnectionStater is the optional interface to transports secured by
+// TLS reporting the connection state, as *tls.Conn does. The state's
+// HandshakeComplete is false for transports not secured by TLS.
+type ConnectionStater interface {
+	// ConnectionState returns the TLS connection state.
+	ConnectionState() tls.ConnectionState
+}
+
+// DeadlineSetter is the optional interface to transports supporting
+// read and write deadlines, as net.Conn does. Reads and writes not
+// completed by the deadline fail with an error reporting a timeout,
+// as net.Error does. The zero time means no deadline.
+type DeadlineSetter interface {
+	// SetReadDeadline sets the deadline for reads.
+	SetReadDeadline(t time.Time) error
+	// SetWriteDeadline sets the deadline for writes.
+	SetWriteDeadline(t time.Time) error
+}
@@ -0,0 +1,620 @@
+package xpath
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/andaru/opr8/dom"
+	"github.com/pkg/errors"
+)
+
+// expr is a parsed expression.
+type expr interface {
+	eval(x *Context) (interface{}, error)
+}
+
+type literal struct{ v interface{} }
+
+func (l literal) eval(*Context) (interface{}, error) { return l.v, nil }
+
+type binaryExpr struct {
+	op   string
+	l, r expr
+}
+
+func (b binaryExpr) eval(x *Context) (interface{}, error) {
+	l, err := b.l.eval(x)
+	if err != nil {
+		return nil, err
+	}
+	switch b.op {
+	case "or", "and":
+		if Boolean(l) == (b.op == "or") {
+			return b.op == "or", nil
+		}
+		r, err := b.r.eval(x)
+		if err != nil {
+			return nil, err
+		}
+		return Boolean(r), nil
+	}
+	r, err := b.r.eval(x)
+	if err != nil {
+		return nil, err
+	}
+	switch b.op {
+	case "|":
+		ln, lok := l.([]dom.Node)
+		rn, rok := r.([]dom.Node)
+		if !lok || !rok {
+			return nil, errors.New("union of non node-sets")
+		}
+		return uniqueNodes(append(append([]dom.Node{}, ln...), rn...)), nil
+	case "+":
+		return Number(l) + Number(r), nil
+	case "-":
+		return Number(l) - Number(r), nil
+	case "*":
+		return Number(l) * Number(r), nil
+	case "div":
+		return Number(l) / Number(r), nil
+	case "mod":
+		return math.Mod(Number(l), Number(r)), nil
+	}
+	return compare(b.op, l, r), nil
+}
+
+type negation struct{ x expr }
+
+func (n negation) eval(x *Context) (interface{}, error) {
+	v, err := n.x.eval(x)
+	if err != nil {
+		return nil, err
+	}
+	return -Number(v), nil
+}
+
+// locationPath is a location path, or a filter expression with its
+// predicates followed by relative steps when filter is set.
+type locationPath struct {
+	absolute   bool
+	filter     expr
+	predicates []expr
+	steps      []locationStep
+}
+
+type locationStep struct {
+	axis string
+	// test is "node", "text" or "comment" for node type tests, or
+	// empty for name tests, where local is "*" for any name
+	test          string
+	prefix, local string
+	predicates    []expr
+}
+
+// axes are the supported axes, true for reverse axes.
+var axes = map[string]bool{
+	"ancestor":           true,
+	"ancestor-or-self":   true,
+	"child":              false,
+	"descendant":         false,
+	"descendant-or-self": false,
+	"following":          false,
+	"following-sibling":  false,
+	"parent":             true,
+	"preceding":          true,
+	"preceding-sibling":  true,
+	"self":               false,
+}
+
+func (p locationPath) eval(x *Context) (interface{}, error) {
+	var nodes []dom.Node
+	switch {
+	case p.filter != nil:
+		v, err := p.filter.eval(x)
+		if err != nil {
+			return nil, err
+		}
+		if len(p.steps) == 0 && len(p.predicates) == 0 {
+			return v, nil
+		}
+		var ok bool
+		if nodes, ok = v.([]dom.Node); !ok {
+			return nil, errors.New("path step or predicate applied to a non node-set")
+		}
+		if nodes, err = filterNodes(x, nodes, p.predicates); err != nil {
+			return nil, err
+		}
+	case p.absolute:
+		root := x.Node
+		for root != nil && root.Parent() != nil {
+			root = root.Parent()
+		}
+		nodes = []dom.Node{root}
+	default:
+		nodes = []dom.Node{x.Node}
+	}
+	for _, step := range p.steps {
+		var err error
+		if nodes, err = step.apply(x, nodes); err != nil {
+			return nil, err
+		}
+	}
+	return nodes, nil
+}
+
+func (s locationStep) apply(x *Context, in []dom.Node) ([]dom.Node, error) {
+	var space string
+	if s.prefix != "" {
+		var err error
+		if space, err = x.Env.namespace(s.prefix); err != nil {
+			return nil, err
+		}
+	}
+	match := func(n dom.Node) bool {
+		switch s.test {
+		case "node":
+			return true
+		case "text":
+			return n.NodeType() == dom.NodeTypeText
+		case "comment":
+			return n.NodeType() == dom.NodeTypeComment
+		}
+		if n.NodeType() != dom.NodeTypeElement {
+			return false
+		}
+		name := n.Name()
+		return (s.local == "*" || name.Local == s.local) && (s.prefix == "" || name.Space == space)
+	}
+
+	var out []dom.Node
+	for _, n := range in {
+		// nodes are selected in the axis' order, as positions are
+		// counted in predicates
+		var selected []dom.Node
+		for _, it := range axisNodes(s.axis, n) {
+			if match(it) {
+				selected = append(selected, it)
+			}
+		}
+		selected, err := filterNodes(x, selected, s.predicates)
+		if err != nil {
+			return nil, err
+		}
+		if axes[s.axis] {
+			for i, j := 0, len(selected)-1; i < j; i, j = i+1, j-1 {
+				selected[i], selected[j] = selected[j], selected[i]
+			}
+		}
+		out = append(out, selected...)
+	}
+	return uniqueNodes(out), nil
+}
+
+// axisNodes returns the nodes of the axis from n, in document order
+// for forward axes, and in reverse document order for reverse axes.
+// Only nodes with a parent have siblings.
+func axisNodes(axis string, n dom.Node) []dom.Node {
+	var nodes []dom.Node
+	switch axis {
+	case "self":
+		nodes = []dom.Node{n}
+	case "parent":
+		if p := n.Parent(); p != nil {
+			nodes = []dom.Node{p}
+		}
+	case "ancestor-or-self":
+		nodes = []dom.Node{n}
+		fallthrough
+	case "ancestor":
+		for it := n.Parent(); it != nil; it = it.Parent() {
+			nodes = append(nodes, it)
+		}
+	case "descendant-or-self":
+		nodes = descendantsOrSelf(n, nil)
+	case "descendant":
+		nodes = descendantsOrSelf(n, nil)[1:]
+	case "following-sibling":
+		for it := dom.NewFollowingSiblingIterator(n); it.NextSibling() != nil; {
+			nodes = append(nodes, it.Node())
+		}
+	case "preceding-sibling":
+		for it := dom.NewPrecedingSiblingIterator(n); it.NextSibling() != nil; {
+			nodes = append(nodes, it.Node())
+		}
+	case "following":
+		for it := n; it.Parent() != nil; it = it.Parent() {
+			for sib := it.NextSibling(); sib != nil; sib = sib.NextSibling() {
+				nodes = descendantsOrSelf(sib, nodes)
+			}
+		}
+	case "preceding":
+		for it := n; it.Parent() != nil; it = it.Parent() {
+			for sib := it.PreviousSibling(); sib != nil; sib = sib.PreviousSibling() {
+				subtree := descendantsOrSelf(sib, nil)
+				for i := len(subtree) - 1; i >= 0; i-- {
+					nodes = append(nodes, subtree[i])
+				}
+			}
+		}
+	default:
+		for it := n.FirstChild(); it != nil; it = it.NextSibling() {
+			nodes = append(nodes, it)
+		}
+	}
+	return nodes
+}
+
+// filterNodes returns the nodes for which each predicate in turn is
+// true, or equal to the node's position if a number.
+func filterNodes(x *Context, nodes []dom.Node, predicates []expr) ([]dom.Node, error) {
+	for _, pred := range predicates {
+		var kept []dom.Node
+		for i, n := range nodes {
+			v, err := pred.eval(x.with(n, i+1, len(nodes)))
+			if err != nil {
+				return nil, err
+			}
+			if f, ok := v.(float64); ok {
+				if f == float64(i+1) {
+					kept = append(kept, n)
+				}
+			} else if Boolean(v) {
+				kept = append(kept, n)
+			}
+		}
+		nodes = kept
+	}
+	return nodes, nil
+}
+
+func descendantsOrSelf(n dom.Node, out []dom.Node) []dom.Node {
+	out = append(out, n)
+	for it := n.FirstChild(); it != nil; it = it.NextSibling() {
+		out = descendantsOrSelf(it, out)
+	}
+	return out
+}
+
+// uniqueNodes removes duplicate nodes from nodes, keeping the first
+// occurrence of each.
+func uniqueNodes(nodes []dom.Node) []dom.Node {
+	seen := make(map[dom.Node]bool, len(nodes))
+	out := nodes[:0]
+	for _, n := range nodes {
+		if !seen[n] {
+			seen[n] = true
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+// funcCall is a call to a core function, or to the function ext if
+// it is not nil.
+type funcCall struct {
+	name string
+	args []expr
+	ext  *Function
+}
+
+// arity are the minimum and maximum number of arguments of each core
+// function, where -1 is any number.
+var arity = map[string][2]int{
+	// node-set functions
+	"last":          {0, 0},
+	"position":      {0, 0},
+	"count":         {1, 1},
+	"local-name":    {0, 1},
+	"namespace-uri": {0, 1},
+	"name":          {0, 1},
+	// string functions
+	"string":           {0, 1},
+	"concat":           {2, -1},
+	"starts-with":      {2, 2},
+	"contains":         {2, 2},
+	"substring-before": {2, 2},
+	"substring-after":  {2, 2},
+	"substring":        {2, 3},
+	"string-length":    {0, 1},
+	"normalize-space":  {0, 1},
+	"translate":        {3, 3},
+	// boolean functions
+	"boolean": {1, 1},
+	"not":     {1, 1},
+	"true":    {0, 0},
+	"false":   {0, 0},
+	// number functions
+	"number":  {0, 1},
+	"sum":     {1, 1},
+	"floor":   {1, 1},
+	"ceiling": {1, 1},
+	"round":   {1, 1},
+	// YANG's current function
+	"current": {0, 0},
+}
+
+func (f funcCall) eval(x *Context) (interface{}, error) {
+	args := make([]interface{}, len(f.args))
+	for i, arg := range f.args {
+		v, err := arg.eval(x)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+	if f.ext != nil {
+		return f.ext.Call(x, args)
+	}
+	if len(args) == 0 {
+		switch f.name {
+		case "string", "number", "string-length", "normalize-space", "local-name", "namespace-uri", "name":
+			// these default to the context node
+			args = []interface{}{[]dom.Node{x.Node}}
+		}
+	}
+	switch f.name {
+	case "last":
+		return float64(x.Size), nil
+	case "position":
+		return float64(x.Position), nil
+	case "count":
+		nodes, err := NodeSet(f.name, args[0])
+		if err != nil {
+			return nil, err
+		}
+		return float64(len(nodes)), nil
+	case "local-name", "namespace-uri", "name":
+		nodes, err := NodeSet(f.name, args[0])
+		if err != nil {
+			return nil, err
+		}
+		if len(nodes) == 0 || nodes[0].NodeType() != dom.NodeTypeElement {
+			return "", nil
+		}
+		name := nodes[0].Name()
+		switch f.name {
+		case "local-name":
+			return name.Local, nil
+		case "namespace-uri":
+			return name.Space, nil
+		}
+		return x.Env.qualify(name), nil
+	case "string":
+		return String(args[0]), nil
+	case "concat":
+		var b strings.Builder
+		for _, arg := range args {
+			b.WriteString(String(arg))
+		}
+		return b.String(), nil
+	case "starts-with":
+		return strings.HasPrefix(String(args[0]), String(args[1])), nil
+	case "contains":
+		return strings.Contains(String(args[0]), String(args[1])), nil
+	case "substring-before", "substring-after":
+		s, sep := String(args[0]), String(args[1])
+		i := strings.Index(s, sep)
+		switch {
+		case i < 0:
+			return "", nil
+		case f.name == "substring-before":
+			return s[:i], nil
+		}
+		return s[i+len(sep):], nil
+	case "substring":
+		length := math.Inf(1)
+		if len(args) == 3 {
+			length = Number(args[2])
+		}
+		return substring(String(args[0]), Number(args[1]), length), nil
+	case "string-length":
+		return float64(utf8.RuneCountInString(String(args[0]))), nil
+	case "normalize-space":
+		return strings.Join(strings.Fields(String(args[0])), " "), nil
+	case "translate":
+		return translate(String(args[0]), String(args[1]), String(args[2])), nil
+	case "boolean":
+		return Boolean(args[0]), nil
+	case "not":
+		return !Boolean(args[0]), nil
+	case "true", "false":
+		return f.name == "true", nil
+	case "number":
+		return Number(args[0]), nil
+	case "sum":
+		nodes, err := NodeSet(f.name, args[0])
+		if err != nil {
+			return nil, err
+		}
+		var sum float64
+		for _, n := range nodes {
+			sum += Number(NodeString(n))
+		}
+		return sum, nil
+	case "floor":
+		return math.Floor(Number(args[0])), nil
+	case "ceiling":
+		return math.Ceil(Number(args[0])), nil
+	case "round":
+		return round(Number(args[0])), nil
+	case "current":
+		return []dom.Node{x.Current}, nil
+	}
+	return nil, errors.Errorf("unsupported function %s", f.name)
+}
+
+// substring returns the characters of s from the position start,
+// counted from 1, for length characters, as the substring function.
+func substring(s string, start, length float64) string {
+	first := round(start)
+	last := first + round(length)
+	var b strings.Builder
+	pos := 0.0
+	for _, r := range s {
+		if pos++; pos >= first && pos < last {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// translate returns s with the characters in from replaced by
+// those at the same position in to, or removed if to is shorter.
+func translate(s, from, to string) string {
+	fromRunes, toRunes := []rune(from), []rune(to)
+	var b strings.Builder
+	for _, r := range s {
+		i := 0
+		for i < len(fromRunes) && fromRunes[i] != r {
+			i++
+		}
+		switch {
+		case i == len(fromRunes):
+			b.WriteRune(r)
+		case i < len(toRunes):
+			b.WriteRune(toRunes[i])
+		}
+	}
+	return b.String()
+}
+
+// round rounds f to the closest integer, or towards positive
+// infinity if there are two.
+func round(f float64) float64 {
+	if math.IsNaN(f) || math.IsInf(f, 0) || f == 0 {
+		return f
+	}
+	return math.Floor(f + 0.5)
+}
+
+// Boolean returns the value v converted to a boolean, as the boolean
+// function.
+func Boolean(v interface{}) bool {
+	switch v := v.(type) {
+	case bool:
+		return v
+	case float64:
+		return v != 0 && !math.IsNaN(v)
+	case string:
+		return v != ""
+	case []dom.Node:
+		return len(v) > 0
+	}
+	return false
+}
+
+// String returns the value v converted to a string, as the string
+// function.
+func String(v interface{}) string {
+	switch v := v.(type) {
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		switch {
+		case math.IsNaN(v):
+			return "NaN"
+		case math.IsInf(v, 0):
+			if v > 0 {
+				return "Infinity"
+			}
+			return "-Infinity"
+		case v == math.Trunc(v):
+			return strconv.FormatInt(int64(v), 10)
+		}
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		return v
+	case []dom.Node:
+		if len(v) == 0 {
+			return ""
+		}
+		return NodeString(v[0])
+	}
+	return ""
+}
+
+// Number returns the value v converted to a number, as the number
+// function.
+func Number(v interface{}) float64 {
+	switch v := v.(type) {
+	case bool:
+		if v {
+			return 1
+		}
+		return 0
+	case float64:
+		return v
+	}
+	s := strings.TrimSpace(String(v))
+	// only decimal numbers are numbers in XPath
+	if s == "" || strings.IndexFunc(s, func(r rune) bool { return r != '-' && r != '.' && (r < '0' || r > '9') }) >= 0 {
+		return math.NaN()
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return math.NaN()
+	}
+	return f
+}
+
+// compare compares l and r using the comparison operator op,
+// following the XPath 1.0 rules for node-sets.
+func compare(op string, l, r interface{}) bool {
+	if ln, ok := l.([]dom.Node); ok {
+		if _, ok := r.(bool); ok {
+			return compareAtoms(op, Boolean(ln), r)
+		}
+		for _, n := range ln {
+			if compare(op, NodeString(n), r) {
+				return true
+			}
+		}
+		return false
+	}
+	if rn, ok := r.([]dom.Node); ok {
+		if _, ok := l.(bool); ok {
+			return compareAtoms(op, l, Boolean(rn))
+		}
+		for _, n := range rn {
+			if compare(op, l, NodeString(n)) {
+				return true
+			}
+		}
+		return false
+	}
+	return compareAtoms(op, l, r)
+}
+
+func compareAtoms(op string, l, r interface{}) bool {
+	if op == "=" || op == "!=" {
+		var eq bool
+		_, lb := l.(bool)
+		_, rb := r.(bool)
+		_, lf := l.(float64)
+		_, rf := r.(float64)
+		switch {
+		case lb || rb:
+			eq = Boolean(l) == Boolean(r)
+		case lf || rf:
+			eq = Number(l) == Number(r)
+		default:
+			eq = String(l) == String(r)
+		}
+		return eq == (op == "=")
+	}
+	a, b := Number(l), Number(r)
+	switch op {
+	case "<":
+		return a < b
+	case "<=":
+		return a <= b
+	case ">":
+		return a > b
+	case ">=":
+		return a >= b
+	}
+	return false
+}
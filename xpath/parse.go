@@ -0,0 +1,351 @@
+package xpath
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// token is a lexical token. Operators, including "..", "." and
+// "*", have kind 'o'; names 'n'; string literals 's'; numbers '0'.
+type token struct {
+	kind byte
+	text string
+}
+
+func lex(s string) ([]token, error) {
+	var toks []token
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '\'' || c == '"':
+			end := strings.IndexByte(s[i+1:], c)
+			if end < 0 {
+				return nil, errors.Errorf("unterminated literal at offset %d", i)
+			}
+			toks = append(toks, token{'s', s[i+1 : i+1+end]})
+			i += end + 2
+		case c >= '0' && c <= '9' || c == '.' && i+1 < len(s) && s[i+1] >= '0' && s[i+1] <= '9':
+			j := i + 1
+			for j < len(s) && (s[j] >= '0' && s[j] <= '9' || s[j] == '.') {
+				j++
+			}
+			toks = append(toks, token{'0', s[i:j]})
+			i = j
+		case isNameStart(c):
+			j := i + 1
+			for j < len(s) && (isNameStart(s[j]) || s[j] >= '0' && s[j] <= '9' || s[j] == '-' || s[j] == '.' ||
+				s[j] == ':' && j+1 < len(s) && isNameStart(s[j+1]) && !strings.Contains(s[i:j], ":")) {
+				j++
+			}
+			// prefix:* tests any name in a namespace
+			if strings.HasPrefix(s[j:], ":*") && !strings.Contains(s[i:j], ":") {
+				j += 2
+			}
+			toks = append(toks, token{'n', s[i:j]})
+			i = j
+		case c == '$':
+			return nil, errors.Errorf("unsupported variable reference at offset %d", i)
+		default:
+			op := ""
+			for _, candidate := range []string{"..", "//", "!=", "<=", ">=", "::", "/", ".", "*", "(", ")", "[", "]", ",", "=", "<", ">", "|", "+", "-"} {
+				if strings.HasPrefix(s[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, errors.Errorf("unexpected character %q at offset %d", c, i)
+			}
+			toks = append(toks, token{'o', op})
+			i += len(op)
+		}
+	}
+	return toks, nil
+}
+
+func isNameStart(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_'
+}
+
+type parser struct {
+	toks      []token
+	pos       int
+	functions Functions
+}
+
+func (p *parser) peek() token {
+	if p.pos < len(p.toks) {
+		return p.toks[p.pos]
+	}
+	return token{}
+}
+
+// peekNext returns the text of the token after the next.
+func (p *parser) peekNext() string {
+	if p.pos+1 < len(p.toks) {
+		return p.toks[p.pos+1].text
+	}
+	return ""
+}
+
+// accept consumes the next token if it is an operator or name with
+// one of the texts provided, and returns its text.
+func (p *parser) accept(texts ...string) (string, bool) {
+	t := p.peek()
+	if t.kind != 'o' && t.kind != 'n' {
+		return "", false
+	}
+	for _, text := range texts {
+		if t.text == text {
+			p.pos++
+			return text, true
+		}
+	}
+	return "", false
+}
+
+func (p *parser) expect(text string) error {
+	if _, ok := p.accept(text); !ok {
+		if p.pos >= len(p.toks) {
+			return errors.Errorf("expected %q at end of expression", text)
+		}
+		return errors.Errorf("expected %q, got %q", text, p.peek().text)
+	}
+	return nil
+}
+
+// binary parses a left-associative sequence of operands separated by
+// the operators ops.
+func (p *parser) binary(operand func() (expr, error), ops ...string) (expr, error) {
+	l, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.accept(ops...)
+		if !ok {
+			return l, nil
+		}
+		r, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		l = binaryExpr{op: op, l: l, r: r}
+	}
+}
+
+func (p *parser) or() (expr, error) { return p.binary(p.and, "or") }
+
+func (p *parser) and() (expr, error) { return p.binary(p.equality, "and") }
+
+func (p *parser) equality() (expr, error) { return p.binary(p.relational, "=", "!=") }
+
+func (p *parser) relational() (expr, error) {
+	return p.binary(p.additive, "<", "<=", ">", ">=")
+}
+
+func (p *parser) additive() (expr, error) { return p.binary(p.multiplicative, "+", "-") }
+
+// multiplicative parses multiplications; "*" following an operand is
+// an operator, not a name test.
+func (p *parser) multiplicative() (expr, error) {
+	return p.binary(p.unary, "*", "div", "mod")
+}
+
+func (p *parser) unary() (expr, error) {
+	if _, ok := p.accept("-"); ok {
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return negation{x}, nil
+	}
+	return p.union()
+}
+
+func (p *parser) union() (expr, error) { return p.binary(p.path, "|") }
+
+// isNodeType returns true if the name is that of a node type test.
+func isNodeType(name string) bool {
+	return name == "node" || name == "text" || name == "comment" || name == "processing-instruction"
+}
+
+func (p *parser) path() (expr, error) {
+	t := p.peek()
+	var filter expr
+	switch {
+	case t.kind == 's':
+		p.pos++
+		filter = literal{t.text}
+	case t.kind == '0':
+		p.pos++
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, errors.Errorf("invalid number %q", t.text)
+		}
+		filter = literal{f}
+	case t.kind == 'o' && t.text == "(":
+		p.pos++
+		x, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		filter = x
+	case t.kind == 'n' && p.peekNext() == "(" && !isNodeType(t.text):
+		call, err := p.call()
+		if err != nil {
+			return nil, err
+		}
+		filter = call
+	}
+
+	path := locationPath{filter: filter}
+	if filter == nil {
+		if _, ok := p.accept("/"); ok {
+			path.absolute = true
+			if !p.stepFollows() {
+				return path, nil
+			}
+		} else if _, ok := p.accept("//"); ok {
+			path.absolute = true
+			path.steps = append(path.steps, locationStep{axis: "descendant-or-self", test: "node"})
+		}
+		step, err := p.step()
+		if err != nil {
+			return nil, err
+		}
+		path.steps = append(path.steps, step)
+	} else {
+		var err error
+		if path.predicates, err = p.predicates(); err != nil {
+			return nil, err
+		}
+	}
+	for {
+		sep, ok := p.accept("/", "//")
+		if !ok {
+			return path, nil
+		}
+		if sep == "//" {
+			path.steps = append(path.steps, locationStep{axis: "descendant-or-self", test: "node"})
+		}
+		step, err := p.step()
+		if err != nil {
+			return nil, err
+		}
+		path.steps = append(path.steps, step)
+	}
+}
+
+func (p *parser) stepFollows() bool {
+	t := p.peek()
+	return t.kind == 'n' || t.kind == 'o' && (t.text == "." || t.text == ".." || t.text == "*")
+}
+
+func (p *parser) step() (locationStep, error) {
+	t := p.peek()
+	step := locationStep{axis: "child"}
+	switch {
+	case t.kind == 'o' && t.text == ".":
+		step.axis, step.test = "self", "node"
+		p.pos++
+		return step, nil
+	case t.kind == 'o' && t.text == "..":
+		step.axis, step.test = "parent", "node"
+		p.pos++
+		return step, nil
+	case t.kind == 'n' && p.peekNext() == "::":
+		if _, ok := axes[t.text]; !ok {
+			return step, errors.Errorf("unsupported axis %s", t.text)
+		}
+		step.axis = t.text
+		p.pos += 2
+		t = p.peek()
+	}
+	switch {
+	case t.kind == 'o' && t.text == "*":
+		step.local = "*"
+	case t.kind == 'n' && isNodeType(t.text) && p.peekNext() == "(":
+		if t.text == "processing-instruction" {
+			return step, errors.New("unsupported node type test processing-instruction()")
+		}
+		step.test = t.text
+		p.pos += 2
+		if t = p.peek(); t.text != ")" {
+			return step, errors.Errorf("expected \")\", got %q", t.text)
+		}
+	case t.kind == 'n':
+		if i := strings.IndexByte(t.text, ':'); i >= 0 {
+			step.prefix, step.local = t.text[:i], t.text[i+1:]
+		} else {
+			step.local = t.text
+		}
+	case t.kind == 0:
+		return step, errors.New("unexpected end of expression")
+	default:
+		return step, errors.Errorf("unexpected %q", t.text)
+	}
+	p.pos++
+	var err error
+	step.predicates, err = p.predicates()
+	return step, err
+}
+
+// predicates parses the predicates following a step or filter
+// expression.
+func (p *parser) predicates() ([]expr, error) {
+	var predicates []expr
+	for {
+		if _, ok := p.accept("["); !ok {
+			return predicates, nil
+		}
+		x, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("]"); err != nil {
+			return nil, err
+		}
+		predicates = append(predicates, x)
+	}
+}
+
+func (p *parser) call() (expr, error) {
+	name := p.peek().text
+	call := funcCall{name: name}
+	arity, ok := arity[name]
+	if !ok {
+		f, ok := p.functions[name]
+		if !ok {
+			return nil, errors.Errorf("unsupported function %s", name)
+		}
+		arity, call.ext = [2]int{f.MinArgs, f.MaxArgs}, &f
+	}
+	p.pos += 2
+	if _, ok := p.accept(")"); !ok {
+		for {
+			arg, err := p.or()
+			if err != nil {
+				return nil, err
+			}
+			call.args = append(call.args, arg)
+			if _, ok := p.accept(","); !ok {
+				break
+			}
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+	}
+	if len(call.args) < arity[0] || arity[1] >= 0 && len(call.args) > arity[1] {
+		return nil, errors.Errorf("function %s called with %d arguments", name, len(call.args))
+	}
+	return call, nil
+}
@@ -0,0 +1,154 @@
+/*
+Package xpath evaluates XPath 1.0 expressions over dom trees, as YANG
+uses for when and must expressions and leafref paths (RFC 7950 section
+6.4).
+
+	x, err := xpath.Compile("../mtu >= 1500", nil)
+	if err != nil {
+		...
+	}
+	v, err := x.Eval(n, &xpath.Env{Namespace: namespace})
+	ok := xpath.Boolean(v)
+
+Location paths with every axis but attribute and namespace, node type
+tests and predicates, filter expressions, string and number literals,
+the logical, comparison, arithmetic and union operators, and the core
+function library except id and lang are supported, along with YANG's
+current function. Further functions, such as the others YANG defines,
+are added by the Functions an expression is compiled with. Variable
+references are an error.
+
+Values are node-sets ([]dom.Node, in document order), strings
+(string), numbers (float64) and booleans (bool).
+*/
+package xpath
+
+import (
+	"strings"
+
+	xml "github.com/andaru/flexml"
+	"github.com/andaru/opr8/dom"
+	"github.com/pkg/errors"
+)
+
+// Env is the environment an expression is evaluated in.
+type Env struct {
+	// Namespace returns the XML namespace of the prefix of a name.
+	// Prefixed names are an error if Namespace is nil; unprefixed
+	// names match elements by local name alone.
+	Namespace func(prefix string) (string, error)
+	// Prefix returns the prefix qualifying the names of elements in
+	// the namespace space, as returned by the name function, or the
+	// empty string if there is none. If nil, names are unqualified.
+	Prefix func(space string) string
+}
+
+// namespace returns the namespace of the prefix.
+func (env *Env) namespace(prefix string) (string, error) {
+	if env == nil || env.Namespace == nil {
+		return "", errors.Errorf("unknown prefix %q", prefix)
+	}
+	return env.Namespace(prefix)
+}
+
+// qualify returns name qualified by the prefix of its namespace.
+func (env *Env) qualify(name xml.Name) string {
+	if env != nil && env.Prefix != nil && name.Space != "" {
+		if prefix := env.Prefix(name.Space); prefix != "" {
+			return prefix + ":" + name.Local
+		}
+	}
+	return name.Local
+}
+
+// Context is the context of an evaluation, as passed to Functions.
+type Context struct {
+	// Env is the environment of the evaluation.
+	Env *Env
+	// Node is the context node, and Current the initial context node,
+	// as returned by the current function.
+	Node, Current dom.Node
+	// Position and Size are the context position and size.
+	Position, Size int
+}
+
+func (x *Context) with(n dom.Node, pos, size int) *Context {
+	return &Context{Env: x.Env, Node: n, Current: x.Current, Position: pos, Size: size}
+}
+
+// Function is a function available to expressions in addition to the
+// core function library.
+type Function struct {
+	// MinArgs and MaxArgs are the number of arguments the function
+	// accepts, checked by Compile. MaxArgs is -1 for any number.
+	MinArgs, MaxArgs int
+	// Call returns the value of the function for the values of its
+	// arguments, in the context x.
+	Call func(x *Context, args []interface{}) (interface{}, error)
+}
+
+// Functions are the functions available to expressions, by name.
+type Functions map[string]Function
+
+// Expr is a compiled expression. It is safe for concurrent use.
+type Expr struct {
+	s string
+	x expr
+}
+
+// Compile parses the expression s, whose function calls are to the
+// core function library or functions, which may be nil.
+func Compile(s string, functions Functions) (*Expr, error) {
+	toks, err := lex(s)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid expression %q", s)
+	}
+	p := &parser{toks: toks, functions: functions}
+	x, err := p.or()
+	if err == nil && p.pos < len(p.toks) {
+		err = errors.Errorf("unexpected %q", p.toks[p.pos].text)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid expression %q", s)
+	}
+	return &Expr{s: s, x: x}, nil
+}
+
+// String returns the source of the expression.
+func (e *Expr) String() string { return e.s }
+
+// Eval returns the value of the expression with the context node ctx
+// in the environment env, which may be nil.
+func (e *Expr) Eval(ctx dom.Node, env *Env) (interface{}, error) {
+	v, err := e.x.eval(&Context{Env: env, Node: ctx, Current: ctx, Position: 1, Size: 1})
+	if err != nil {
+		return nil, errors.Wrapf(err, "evaluating %q", e.s)
+	}
+	return v, nil
+}
+
+// NodeSet returns the value v, an argument of the function name, as a
+// node-set, or an error if it is not one.
+func NodeSet(name string, v interface{}) ([]dom.Node, error) {
+	nodes, ok := v.([]dom.Node)
+	if !ok {
+		return nil, errors.Errorf("%s of a non node-set", name)
+	}
+	return nodes, nil
+}
+
+// NodeString returns the string-value of n: the value of a text or
+// comment node, or the text of the descendants of other nodes.
+func NodeString(n dom.Node) string {
+	switch n.NodeType() {
+	case dom.NodeTypeText, dom.NodeTypeComment:
+		return n.Value()
+	}
+	var b strings.Builder
+	for _, it := range descendantsOrSelf(n, nil) {
+		if it.NodeType() == dom.NodeTypeText {
+			b.WriteString(it.Value())
+		}
+	}
+	return b.String()
+}
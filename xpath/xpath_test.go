@@ -0,0 +1,131 @@
+package xpath
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/andaru/opr8/dom"
+	"github.com/pkg/errors"
+)
+
+func testDocument(t *testing.T, data string) dom.Document {
+	doc := dom.NewDocument(nil)
+	if _, err := dom.NewUnmarshaler(dom.NewBuilder(doc, dom.WithTrimPCData())).XMLReader().ReadFrom(strings.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func testEnv() *Env {
+	return &Env{
+		Namespace: func(prefix string) (string, error) {
+			if prefix == "x" {
+				return "urn:x", nil
+			}
+			return "", errors.Errorf("unknown prefix %q", prefix)
+		},
+		Prefix: func(space string) string {
+			if space == "urn:x" {
+				return "x"
+			}
+			return ""
+		},
+	}
+}
+
+func TestExpr_Eval(t *testing.T) {
+	doc := testDocument(t, `<link xmlns="urn:x"><type>x:ethernet</type><mtu>1500</mtu><vlan><id>10</id></vlan></link>`)
+	link := doc.FirstChild()
+	for _, tt := range []struct {
+		expr    string
+		want    bool
+		wantErr bool
+	}{
+		{expr: "mtu", want: true},
+		{expr: "mtu = 1500 and mtu != '9000'", want: true},
+		{expr: "mtu > 1500 or mtu < 1000", want: false},
+		{expr: "count(*) = 3", want: true},
+		{expr: "vlan[id = 10]/id = /x:link/vlan/id", want: true},
+		{expr: "count(//id | vlan/id) = 1", want: true},
+		{expr: "starts-with(type, 'x:') and contains(string(type), 'eth')", want: true},
+		{expr: "not(current()/mtu) or false()", want: false},
+		{expr: "-mtu < 0", want: true},
+		{expr: "mtu div 2 + 10 * 3 - mtu mod 7 = 778", want: true},
+		{expr: "*[2] = 1500 and *[last()]/id = 10 and count(*[position() > 1]) = 2", want: true},
+		{expr: "child::x:* [self::mtu] and vlan/ancestor::link and vlan/id/ancestor-or-self::*[1] = 10", want: true},
+		{expr: "type/following-sibling::*[1] = 1500 and vlan/preceding-sibling::node()[1] = 1500", want: true},
+		{expr: "count(vlan/preceding::*) = 2 and count(type/following::*) = 3 and count(descendant::text()) = 3", want: true},
+		{expr: "(type | vlan)[2]/id = 10 and local-name(*) = 'type' and namespace-uri() = 'urn:x' and name() = 'x:link'", want: true},
+		{expr: "concat(substring-before(type, ':'), '-', substring-after(type, ':')) = 'x-ethernet'", want: true},
+		{expr: "substring('12345', 1.5, 2.6) = '234' and substring('12345', 0, 3) = '12' and string-length(type) = 10", want: true},
+		{expr: "normalize-space('  a  b ') = 'a b' and translate('bar', 'abc', 'AB') = 'BAr'", want: true},
+		{expr: "sum(*[position() > 1]) = 1510 and floor(-1.5) = -2 and ceiling(1.2) = 2 and round(2.5) = 3 and string(1 div 0) = 'Infinity'", want: true},
+		{expr: "other:mtu", wantErr: true},
+		{expr: "namespace::*", wantErr: true},
+		{expr: "lang('en')", wantErr: true},
+		{expr: "re-match(mtu, '1.*')", wantErr: true},
+		{expr: "mtu = $mtu", wantErr: true},
+		{expr: "mtu = ", wantErr: true},
+	} {
+		t.Run(tt.expr, func(t *testing.T) {
+			var v interface{}
+			x, err := Compile(tt.expr, nil)
+			if err == nil {
+				v, err = x.Eval(link, testEnv())
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Eval() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := Boolean(v); got != tt.want {
+				t.Errorf("Eval() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompile_functions(t *testing.T) {
+	doc := testDocument(t, `<a><b>x</b><b>y</b></a>`)
+	functions := Functions{
+		"join": {MinArgs: 1, MaxArgs: 2, Call: func(x *Context, args []interface{}) (interface{}, error) {
+			nodes, err := NodeSet("join", args[0])
+			if err != nil {
+				return nil, err
+			}
+			sep := ","
+			if len(args) == 2 {
+				sep = String(args[1])
+			}
+			var values []string
+			for _, n := range nodes {
+				values = append(values, NodeString(n))
+			}
+			return strings.Join(values, sep), nil
+		}},
+	}
+	for _, tt := range []struct {
+		expr    string
+		want    string
+		wantErr bool
+	}{
+		{expr: "join(b)", want: "x,y"},
+		{expr: "join(b, '-')", want: "x-y"},
+		{expr: "join(b[join(../b) = 'x,y'], string(count(b)))", want: "x2y"},
+		{expr: "join()", wantErr: true},
+		{expr: "join('b')", wantErr: true},
+		{expr: "split(b)", wantErr: true},
+	} {
+		t.Run(tt.expr, func(t *testing.T) {
+			var v interface{}
+			x, err := Compile(tt.expr, functions)
+			if err == nil {
+				v, err = x.Eval(doc.FirstChild(), nil)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Eval() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := String(v); !tt.wantErr && got != tt.want {
+				t.Errorf("Eval() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}